@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	AlertEventSwap       = "swap"
+	AlertEventPair       = "pair"
+	AlertEventGraduation = "graduation"
+)
+
+// AlertRule triggers an alert for live events matching all of its conditions.
+// Empty conditions match anything.
+type AlertRule struct {
+	Name              string
+	Event             string
+	Wallets           []string
+	Mints             []string
+	AMMs              []string
+	SwapType          string
+	MinQuoteAmount    float64
+	MinQuoteLiquidity float64
+	// posted to as JSON, alerts are printed to stdout when not set
+	Webhook string
+}
+
+func loadAlertRules(path string) ([]AlertRule, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cant read alert rules")
+	}
+	rules, err := parseAlertRules(string(raw))
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid alert rules %s", path)
+	}
+	return rules, nil
+}
+
+// parseAlertRules parses the subset of YAML rule files use: a list of rules,
+// optionally under a top level "rules:" key, each a map of scalar values.
+// Lists are comma separated or in [brackets]. See the README for an example.
+func parseAlertRules(raw string) ([]AlertRule, error) {
+	rules := []AlertRule{}
+	for i, line := range strings.Split(raw, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") || trimmed == "rules:" || trimmed == "---" {
+			continue
+		}
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok {
+			rules = append(rules, AlertRule{})
+			trimmed = strings.TrimSpace(item)
+		} else if len(rules) == 0 || line == trimmed {
+			return nil, fmt.Errorf("line %d: expected a list of rules starting with \"- \"", i+1)
+		}
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected key: value", i+1)
+		}
+		if err := rules[len(rules)-1].set(strings.TrimSpace(key), yamlScalar(value)); err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+1, err)
+		}
+	}
+	for i, v := range rules {
+		if err := v.validate(); err != nil {
+			return nil, fmt.Errorf("rule %d: %s", i+1, err)
+		}
+	}
+	return rules, nil
+}
+
+// yamlScalar removes quotes and trailing comments from a value
+func yamlScalar(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') {
+		if end := strings.IndexByte(value[1:], value[0]); end != -1 {
+			return value[1 : end+1]
+		}
+	}
+	if i := strings.Index(value, " #"); i != -1 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+func yamlList(value string) []string {
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	list := []string{}
+	for _, v := range splitList(value) {
+		list = append(list, strings.Trim(v, `"'`))
+	}
+	return list
+}
+
+func (o *AlertRule) set(key string, value string) error {
+	var err error
+	switch key {
+	case "name":
+		o.Name = value
+	case "event":
+		o.Event = value
+	case "wallet":
+		o.Wallets = yamlList(value)
+	case "mint":
+		o.Mints = yamlList(value)
+	case "amm":
+		o.AMMs = yamlList(value)
+	case "swapType":
+		o.SwapType = value
+	case "minQuoteAmount":
+		o.MinQuoteAmount, err = strconv.ParseFloat(value, 64)
+	case "minQuoteLiquidity":
+		o.MinQuoteLiquidity, err = strconv.ParseFloat(value, 64)
+	case "webhook":
+		o.Webhook = value
+	default:
+		return fmt.Errorf("unknown key %q", key)
+	}
+	if err != nil {
+		return fmt.Errorf("%s must be a number", key)
+	}
+	return nil
+}
+
+func (o AlertRule) validate() error {
+	if o.Name == "" {
+		return errors.New("name must be specified")
+	}
+	if o.Event != "" && o.Event != AlertEventSwap && o.Event != AlertEventPair && o.Event != AlertEventGraduation {
+		return fmt.Errorf("unknown event %q, must be one of: %s, %s, %s", o.Event, AlertEventSwap, AlertEventPair, AlertEventGraduation)
+	}
+	if o.SwapType != "" && o.SwapType != SwapTypeBuy && o.SwapType != SwapTypeSell {
+		return fmt.Errorf("unknown swapType %q, must be %s or %s", o.SwapType, SwapTypeBuy, SwapTypeSell)
+	}
+	if o.Webhook != "" && !strings.HasPrefix(o.Webhook, "http://") && !strings.HasPrefix(o.Webhook, "https://") {
+		return fmt.Errorf("webhook %q must be an http(s) URL", o.Webhook)
+	}
+	return nil
+}
+
+// Matches reports whether the event meets every condition of the rule
+func (o AlertRule) Matches(event EventRow) bool {
+	eventType := eventField(event, "type")
+	if eventType == "" {
+		return false
+	}
+	if o.Event != "" && o.Event != eventType {
+		return false
+	}
+	if len(o.Wallets) != 0 && !inSlice(o.Wallets, eventField(event, "wallet")) {
+		return false
+	}
+	if len(o.Mints) != 0 && !inSlice(o.Mints, eventField(event, "mint")) {
+		return false
+	}
+	if len(o.AMMs) != 0 && !inSlice(o.AMMs, eventField(event, "amm")) {
+		return false
+	}
+	if o.SwapType != "" && (event.Swap == nil || event.Swap.SwapType != o.SwapType) {
+		return false
+	}
+	if o.MinQuoteAmount != 0 && (event.Swap == nil || event.Swap.QuoteAmount.Float64() < o.MinQuoteAmount) {
+		return false
+	}
+	if o.MinQuoteLiquidity != 0 && (event.Pair == nil || event.Pair.QuoteTokenLiquidityAdded.Float64() < o.MinQuoteLiquidity) {
+		return false
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestParseAlertRules(t *testing.T) {
+	rules, err := parseAlertRules(`# alerts
+rules:
+  - name: whale buys
+    event: swap
+    wallet: "wallet-a, wallet-b" # two wallets
+    swapType: buy
+    webhook: https://example.com/hook
+  - name: 'big pair'
+    event: pair
+    minQuoteLiquidity: 100
+    amm: [amm-a, "amm-b"]
+`)
+	assert.Nil(t, err)
+	assert.Equal(t, []AlertRule{
+		{Name: "whale buys", Event: AlertEventSwap, Wallets: []string{"wallet-a", "wallet-b"}, SwapType: SwapTypeBuy, Webhook: "https://example.com/hook"},
+		{Name: "big pair", Event: AlertEventPair, MinQuoteLiquidity: 100, AMMs: []string{"amm-a", "amm-b"}},
+	}, rules)
+
+	for _, v := range []string{
+		"name: no list",
+		"- name: a\n  colour: red",
+		"- name: a\n  minQuoteAmount: lots",
+		"- event: swap",
+		"- name: a\n  event: transfer",
+		"- name: a\n  webhook: example.com",
+	} {
+		_, err := parseAlertRules(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestAlertRuleMatches(t *testing.T) {
+	buy := EventRow{Swap: &SwapEvent{WalletAccount: "wallet-a", BaseTokenMint: "mint-a", SwapType: SwapTypeBuy, QuoteAmount: "12.5"}}
+	sell := EventRow{Swap: &SwapEvent{WalletAccount: "wallet-a", BaseTokenMint: "mint-b", SwapType: SwapTypeSell, QuoteAmount: "1"}}
+	pair := EventRow{Pair: &PairEvent{AmmAccount: "amm-a", QuoteTokenLiquidityAdded: "150"}}
+
+	whale := AlertRule{Name: "whale", Wallets: []string{"wallet-a"}, SwapType: SwapTypeBuy}
+	assert.True(t, whale.Matches(buy))
+	assert.False(t, whale.Matches(sell))
+	assert.False(t, whale.Matches(pair))
+
+	size := AlertRule{Name: "size", MinQuoteAmount: 10}
+	assert.True(t, size.Matches(buy))
+	assert.False(t, size.Matches(sell))
+
+	bigPair := AlertRule{Name: "pair", Event: AlertEventPair, MinQuoteLiquidity: 100}
+	assert.True(t, bigPair.Matches(pair))
+	assert.False(t, bigPair.Matches(buy))
+	bigPair.MinQuoteLiquidity = 200
+	assert.False(t, bigPair.Matches(pair))
+
+	anything := AlertRule{Name: "any"}
+	assert.True(t, anything.Matches(sell))
+	assert.False(t, anything.Matches(EventRow{}))
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"maps"
+	"math/big"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	wrappedSOLMint = "So11111111111111111111111111111111111111112"
+	usdcMint       = "EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v"
+	usdtMint       = "Es9vMFrzaCERmJfrF4H2FYD4KCoNkY11McCE8BenwNYB"
+)
+
+// knownDecimals are the decimals of common quote mints
+var knownDecimals = map[string]int{
+	wrappedSOLMint: 9,
+	usdcMint:       6,
+	usdtMint:       6,
+}
+
+// pumpDecimals are the decimals of every Pump.fun token
+const pumpDecimals = 6
+
+// amountOptions converts raw base unit amounts to decimal strings with the
+// decimals of their mint for --human-amounts
+type amountOptions struct {
+	human        bool
+	decimalsFile string
+	decimals     map[string]int
+	// mints whose amounts were left raw
+	unknown map[string]struct{}
+}
+
+func (o *amountOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&o.human, "human-amounts", false, "Write amounts as decimal numbers of tokens instead of raw base units, e.g. 1.5 SOL instead of 1500000000")
+	cmd.Flags().StringVar(&o.decimalsFile, "token-decimals", "", "A JSON file of the decimals of each mint e.g. {\"<mint>\": 6}. SOL, USDC, USDT and Pump.fun mints are known")
+}
+
+// Load reads the decimals file. Does nothing unless --human-amounts is set.
+func (o *amountOptions) Load() error {
+	if !o.human {
+		o.unknown = map[string]struct{}{}
+		o.decimals = map[string]int{}
+		return nil
+	}
+	return o.LoadDecimals()
+}
+
+// LoadDecimals reads the decimals file whether or not --human-amounts is set,
+// for commands which always convert amounts to tokens
+func (o *amountOptions) LoadDecimals() error {
+	o.unknown = map[string]struct{}{}
+	o.decimals = map[string]int{}
+	for k, v := range knownDecimals {
+		o.decimals[k] = v
+	}
+	if o.decimalsFile == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(o.decimalsFile)
+	if err != nil {
+		return errors.Wrap(err, "cant read token decimals file")
+	}
+	decimals := map[string]int{}
+	if err := json.Unmarshal(raw, &decimals); err != nil {
+		return errors.Wrap(err, "invalid token decimals file")
+	}
+	for k, v := range decimals {
+		if v < 0 || v > 255 {
+			return errors.Errorf("decimals of %s must be 0 to 255", k)
+		}
+		o.decimals[k] = v
+	}
+	return nil
+}
+
+// Decimals returns the decimals of a mint if known
+func (o *amountOptions) Decimals(mint string) (int, bool) {
+	if v, ok := o.decimals[mint]; ok {
+		return v, true
+	}
+	if strings.HasSuffix(mint, "pump") {
+		return pumpDecimals, true
+	}
+	o.unknown[mint] = struct{}{}
+	return 0, false
+}
+
+// Format returns the amount for output. The raw amount is returned without
+// --human-amounts or when the decimals of the mint are not known.
+func (o *amountOptions) Format(amount Amount, mint string) string {
+	if !o.human {
+		return string(amount)
+	}
+	value, ok := o.Rat(amount, mint)
+	if !ok {
+		return string(amount)
+	}
+	return formatRat(value)
+}
+
+// Rat returns the amount in tokens, exactly. Returns false when the amount is
+// malformed or the decimals of the mint are not known.
+func (o *amountOptions) Rat(amount Amount, mint string) (*big.Rat, bool) {
+	if _, ok := new(big.Rat).SetString(string(amount)); !ok {
+		return nil, false
+	}
+	decimals, ok := o.Decimals(mint)
+	if !ok {
+		return nil, false
+	}
+	return tokenAmount(amount, decimals)
+}
+
+// tokenAmount returns a raw base unit amount in tokens, exactly
+func tokenAmount(amount Amount, decimals int) (*big.Rat, bool) {
+	value, ok := new(big.Rat).SetString(string(amount))
+	if !ok {
+		return nil, false
+	}
+	scale := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)
+	return value.Quo(value, new(big.Rat).SetInt(scale)), true
+}
+
+// Report warns about the mints without known decimals
+func (o *amountOptions) Report() {
+	if len(o.unknown) == 0 {
+		return
+	}
+	mints := slices.Sorted(maps.Keys(o.unknown))
+	if len(mints) > 10 {
+		mints = append(mints[:10], "...")
+	}
+	logrus.Warnf("%d mints have no known decimals, add them to --token-decimals: %s", len(o.unknown), strings.Join(mints, ", "))
+}
+
+// formatRat writes a decimal without an exponent or trailing zeros. Amounts
+// in tokens always have a finite decimal expansion.
+func formatRat(value *big.Rat) string {
+	// a denominator of 10^n needs at most n digits, bounded by its bit length
+	text := value.FloatString(value.Denom().BitLen())
+	if strings.Contains(text, ".") {
+		text = strings.TrimRight(strings.TrimRight(text, "0"), ".")
+	}
+	return text
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestHumanAmounts(t *testing.T) {
+	decimalsFile := filepath.Join(t.TempDir(), "decimals.json")
+	assert.Nil(t, os.WriteFile(decimalsFile, []byte(`{"m1": 2, "m0": 0}`), 0644))
+	amounts := amountOptions{human: true, decimalsFile: decimalsFile}
+	assert.Nil(t, amounts.Load())
+
+	sol := "So11111111111111111111111111111111111111112"
+	assert.Equal(t, "1.5", amounts.Format("1500000000", sol))
+	// more digits than a float64 holds
+	assert.Equal(t, "123456789012.345678901", amounts.Format("123456789012345678901", sol))
+	assert.Equal(t, "0.000000001", amounts.Format("1", sol))
+	assert.Equal(t, "0", amounts.Format("0", sol))
+	assert.Equal(t, "12.34", amounts.Format("1234", "m1"))
+	assert.Equal(t, "1234", amounts.Format("1234", "m0"))
+	assert.Equal(t, "0.5", amounts.Format("500000", "F58xDnQ5JGCLmRM7vg5EfGrow4LuLv8M1e9UCGb8pump"))
+	// left raw when the decimals are not known
+	assert.Equal(t, "1234", amounts.Format("1234", "unknown"))
+	assert.Equal(t, "", amounts.Format("", sol))
+	assert.Len(t, amounts.unknown, 1)
+
+	raw := amountOptions{}
+	assert.Nil(t, raw.Load())
+	assert.Equal(t, "1500000000", raw.Format("1500000000", sol))
+
+	assert.Nil(t, os.WriteFile(decimalsFile, []byte(`{"m1": -1}`), 0644))
+	assert.NotNil(t, amounts.Load())
+}
+
+func TestVolumeHumanAmounts(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"blockTime":1714910400,"swap":{"quoteTokenMint":"So11111111111111111111111111111111111111112","swapType":"buy","quoteAmount":"100000000000000000001"}}
+{"slot":2,"blockTime":1714910401,"swap":{"quoteTokenMint":"So11111111111111111111111111111111111111112","swapType":"sell","quoteAmount":"2"}}
+{"slot":3,"blockTime":1714910402,"swap":{"quoteTokenMint":"unknown","swapType":"sell","quoteAmount":"7"}}
+`,
+	})
+	task := NewVolumeTask()
+	task.params.dataDir = dataDir
+	task.params.interval = "5m"
+	task.params.format = ReportFormatCSV
+	task.params.output = filepath.Join(t.TempDir(), "volume.csv")
+	task.amounts.human = true
+	assert.Nil(t, task.Execute(context.Background()))
+	raw, err := os.ReadFile(task.params.output)
+	assert.Nil(t, err)
+	assert.Equal(t, `interval_start,group,quote_mint,swaps,buys,sells,quote_volume
+2024-05-05T12:00:00Z,all,So11111111111111111111111111111111111111112,2,1,1,100000000000.000000003
+2024-05-05T12:00:00Z,all,unknown,1,0,1,
+`, string(raw))
+}
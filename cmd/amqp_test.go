@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/test-go/testify/assert"
+)
+
+// AMQP 0-9-1 frame types and method classes, for fakeAmqpBroker
+const (
+	amqpFrameMethod     = 1
+	amqpFrameHeader     = 2
+	amqpFrameBody       = 3
+	amqpFrameEnd        = 0xCE
+	amqpClassConnection = 10
+	amqpClassChannel    = 20
+	amqpClassBasic      = 60
+	amqpClassConfirm    = 85
+)
+
+// amqpMethod is a decoded method frame
+type amqpMethod struct {
+	class  uint16
+	method uint16
+	args   *amqpReader
+}
+
+func readAmqpFrame(r *bufio.Reader) (byte, uint16, []byte, error) {
+	header := make([]byte, 7)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return 0, 0, nil, err
+	}
+	payload := make([]byte, binary.BigEndian.Uint32(header[3:])+1)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return 0, 0, nil, err
+	}
+	if payload[len(payload)-1] != amqpFrameEnd {
+		return 0, 0, nil, errors.New("invalid AMQP frame")
+	}
+	return header[0], binary.BigEndian.Uint16(header[1:]), payload[:len(payload)-1], nil
+}
+
+func parseAmqpMethod(payload []byte) amqpMethod {
+	args := &amqpReader{data: payload}
+	return amqpMethod{class: args.Short(), method: args.Short(), args: args}
+}
+
+func writeAmqpFrame(w *bufio.Writer, frameType byte, channel uint16, payload []byte) {
+	w.WriteByte(frameType)
+	w.Write(binary.BigEndian.AppendUint16(nil, channel))
+	w.Write(binary.BigEndian.AppendUint32(nil, uint32(len(payload))))
+	w.Write(payload)
+	w.WriteByte(amqpFrameEnd)
+}
+
+func writeAmqpMethod(w *bufio.Writer, channel uint16, class uint16, method uint16, args amqpWriter) {
+	payload := amqpWriter{}
+	payload.Short(class)
+	payload.Short(method)
+	payload.buf.Write(args.Bytes())
+	writeAmqpFrame(w, amqpFrameMethod, channel, payload.Bytes())
+}
+
+// amqpWriter encodes AMQP method arguments
+type amqpWriter struct {
+	buf bytes.Buffer
+}
+
+func (o *amqpWriter) Octet(v byte) {
+	o.buf.WriteByte(v)
+}
+
+func (o *amqpWriter) Short(v uint16) {
+	o.buf.Write(binary.BigEndian.AppendUint16(nil, v))
+}
+
+func (o *amqpWriter) Long(v uint32) {
+	o.buf.Write(binary.BigEndian.AppendUint32(nil, v))
+}
+
+func (o *amqpWriter) LongLong(v uint64) {
+	o.buf.Write(binary.BigEndian.AppendUint64(nil, v))
+}
+
+func (o *amqpWriter) ShortString(v string) {
+	o.buf.WriteByte(byte(len(v)))
+	o.buf.WriteString(v)
+}
+
+func (o *amqpWriter) LongString(v string) {
+	o.Long(uint32(len(v)))
+	o.buf.WriteString(v)
+}
+
+func (o *amqpWriter) Bytes() []byte {
+	return o.buf.Bytes()
+}
+
+// amqpReader decodes AMQP method arguments. Reading past the end returns
+// zero values.
+type amqpReader struct {
+	data []byte
+}
+
+func (o *amqpReader) next(n int) []byte {
+	if len(o.data) < n {
+		o.data = nil
+		return make([]byte, n)
+	}
+	v := o.data[:n]
+	o.data = o.data[n:]
+	return v
+}
+
+func (o *amqpReader) Octet() byte {
+	return o.next(1)[0]
+}
+
+func (o *amqpReader) Short() uint16 {
+	return binary.BigEndian.Uint16(o.next(2))
+}
+
+func (o *amqpReader) Long() uint32 {
+	return binary.BigEndian.Uint32(o.next(4))
+}
+
+func (o *amqpReader) LongLong() uint64 {
+	return binary.BigEndian.Uint64(o.next(8))
+}
+
+func (o *amqpReader) ShortString() string {
+	return string(o.next(int(o.Octet())))
+}
+
+// amqpPublish is a message received by fakeAmqpBroker
+type amqpPublish struct {
+	exchange     string
+	routingKey   string
+	contentType  string
+	deliveryMode byte
+	messageID    string
+	body         string
+}
+
+// fakeAmqpBroker confirms publishes with a routing key starting with prefix
+// and returns the rest as unroutable. Only guest:guest can log in.
+type fakeAmqpBroker struct {
+	listener net.Listener
+	prefix   string
+	mu       sync.Mutex
+	received []amqpPublish
+}
+
+func newFakeAmqpBroker(t *testing.T, prefix string) *fakeAmqpBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	broker := &fakeAmqpBroker{listener: listener, prefix: prefix}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go broker.serve(conn)
+		}
+	}()
+	return broker
+}
+
+func (o *fakeAmqpBroker) URL(user string) string {
+	return "amqp://" + user + "@" + o.listener.Addr().String() + "/"
+}
+
+func (o *fakeAmqpBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	send := func(channel uint16, class uint16, method uint16, args amqpWriter) {
+		writeAmqpMethod(w, channel, class, method, args)
+		w.Flush()
+	}
+	protocol := make([]byte, 8)
+	if _, err := io.ReadFull(r, protocol); err != nil || string(protocol) != "AMQP\x00\x00\x09\x01" {
+		return
+	}
+	start := amqpWriter{}
+	start.Octet(0)
+	start.Octet(9)
+	start.Long(0)
+	start.LongString("PLAIN")
+	start.LongString("en_US")
+	send(0, amqpClassConnection, 10, start)
+
+	tag := uint64(0)
+	for {
+		frameType, channel, payload, err := readAmqpFrame(r)
+		if err != nil {
+			return
+		}
+		if frameType != amqpFrameMethod {
+			// heartbeats
+			continue
+		}
+		m := parseAmqpMethod(payload)
+		switch {
+		case m.class == amqpClassConnection && m.method == 11:
+			m.args.next(int(m.args.Long()))
+			m.args.ShortString()
+			response := string(m.args.next(int(m.args.Long())))
+			if response != "\x00guest\x00guest" {
+				refused := amqpWriter{}
+				refused.Short(403)
+				refused.ShortString("ACCESS_REFUSED - Login was refused")
+				refused.Short(amqpClassConnection)
+				refused.Short(11)
+				send(0, amqpClassConnection, 50, refused)
+				return
+			}
+			tune := amqpWriter{}
+			tune.Short(0)
+			tune.Long(4096)
+			tune.Short(0)
+			send(0, amqpClassConnection, 30, tune)
+		case m.class == amqpClassConnection && m.method == 40:
+			openOk := amqpWriter{}
+			openOk.ShortString("")
+			send(0, amqpClassConnection, 41, openOk)
+		case m.class == amqpClassChannel && m.method == 10:
+			openOk := amqpWriter{}
+			openOk.LongString("")
+			send(channel, amqpClassChannel, 11, openOk)
+		case m.class == amqpClassConfirm && m.method == 10:
+			send(channel, amqpClassConfirm, 11, amqpWriter{})
+		case m.class == amqpClassBasic && m.method == 40:
+			m.args.Short()
+			msg := amqpPublish{exchange: m.args.ShortString(), routingKey: m.args.ShortString()}
+			mandatory := m.args.Octet()&1 == 1
+			_, _, payload, err := readAmqpFrame(r)
+			if err != nil {
+				return
+			}
+			header := &amqpReader{data: payload}
+			header.Short()
+			header.Short()
+			size := header.LongLong()
+			flags := header.Short()
+			msg.contentType = header.ShortString()
+			msg.deliveryMode = header.Octet()
+			if flags&0x0080 != 0 {
+				msg.messageID = header.ShortString()
+			}
+			for uint64(len(msg.body)) < size {
+				_, _, payload, err := readAmqpFrame(r)
+				if err != nil {
+					return
+				}
+				msg.body += string(payload)
+			}
+			tag++
+			if mandatory && !strings.HasPrefix(msg.routingKey, o.prefix) {
+				returned := amqpWriter{}
+				returned.Short(312)
+				returned.ShortString("NO_ROUTE")
+				returned.ShortString(msg.exchange)
+				returned.ShortString(msg.routingKey)
+				writeAmqpMethod(w, channel, amqpClassBasic, 50, returned)
+				// a returned message is sent back with its content
+				header := amqpWriter{}
+				header.Short(amqpClassBasic)
+				header.Short(0)
+				header.LongLong(uint64(len(msg.body)))
+				header.Short(0)
+				writeAmqpFrame(w, amqpFrameHeader, channel, header.Bytes())
+				writeAmqpFrame(w, amqpFrameBody, channel, []byte(msg.body))
+			} else {
+				o.mu.Lock()
+				o.received = append(o.received, msg)
+				o.mu.Unlock()
+			}
+			ack := amqpWriter{}
+			ack.LongLong(tag)
+			ack.Octet(0)
+			send(channel, amqpClassBasic, 80, ack)
+		case m.class == amqpClassConnection && m.method == 50:
+			send(0, amqpClassConnection, 51, amqpWriter{})
+			return
+		}
+	}
+}
+
+func (o *fakeAmqpBroker) Received() []amqpPublish {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]amqpPublish{}, o.received...)
+}
+
+func TestReplayAmqp(t *testing.T) {
+	broker := newFakeAmqpBroker(t, "swaps.")
+	dataDir := t.TempDir()
+	// larger than a frame so bodies are split
+	wallet := strings.Repeat("w", 5000)
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{\"sourceExchange\":\"raydium\",\"walletAccount\":\"" + wallet + "\"}}\n{\"slot\":2,\"swap\":{\"sourceExchange\":\"pumpfun\"}}\n",
+	})
+
+	task := NewReplayAmqpTask()
+	task.replay.dataDir = dataDir
+	task.replay.rate = "0"
+	task.replay.concurrency = 1
+	task.amqp.url = broker.URL("guest:guest")
+	task.amqp.exchange = "events"
+	task.amqp.routingKey = "swaps.{exchange}"
+	task.amqp.mandatory = true
+	task.amqp.ackTimeout = 5 * time.Second
+	assert.Nil(t, task.Execute(context.Background()))
+
+	received := broker.Received()
+	assert.Len(t, received, 2)
+	assert.Equal(t, "events", received[0].exchange)
+	assert.Equal(t, "swaps.raydium", received[0].routingKey)
+	assert.Equal(t, "swaps.pumpfun", received[1].routingKey)
+	assert.Equal(t, "application/json", received[0].contentType)
+	assert.Equal(t, byte(2), received[0].deliveryMode)
+	assert.Equal(t, "20240505-120000.zip:1", received[1].messageID)
+	assert.Contains(t, received[0].body, wallet)
+}
+
+func TestAmqpSinkErrors(t *testing.T) {
+	broker := newFakeAmqpBroker(t, "swaps.")
+	options := amqpOptions{url: broker.URL("guest:wrong"), routingKey: "swaps.{type}", mandatory: true, ackTimeout: 5 * time.Second}
+	sink, err := options.NewSink()
+	assert.Nil(t, err)
+	err = sink.Open(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "username or password not allowed")
+
+	options.url = broker.URL("guest:guest")
+	options.routingKey = "pairs.{type}"
+	sink, err = options.NewSink()
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Open(context.Background()))
+	defer sink.Close()
+	err = sink.Publish(context.Background(), SinkMessage{Data: []byte("{}")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "NO_ROUTE")
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	AnomalyLargestSwap = "largest_swap"
+	AnomalyBusiestSlot = "busiest_slot"
+	AnomalyMintSpike   = "mint_spike"
+)
+
+type AnomaliesTask struct {
+	spikeWindow time.Duration
+	amounts     amountOptions
+	usd         usdPriceOptions
+	swaps       topAnomalies
+	// swaps left out of the largest swaps as their value is not known
+	unvalued uint64
+	slots    topAnomalies
+	// events in the slot being counted
+	slot       uint64
+	slotTime   int64
+	slotEvents uint64
+	mints      map[string]*mintActivity
+	// the block times of the first and last events in the range
+	first, last int64
+	params      struct {
+		dataDir        string
+		fromSlot       uint64
+		toSlot         uint64
+		top            int
+		spikeWindow    string
+		minSpikeTrades uint64
+		format         string
+		output         string
+	}
+}
+
+// anomaly is a row of the report
+type anomaly struct {
+	kind      string
+	value     float64
+	slot      uint64
+	blockTime int64
+	mint      string
+	quoteMint string
+	wallet    string
+	signature string
+}
+
+// topAnomalies keeps the k anomalies with the highest values, highest first
+type topAnomalies struct {
+	k     int
+	items []anomaly
+}
+
+func (o *topAnomalies) Add(v anomaly) {
+	if len(o.items) == o.k && v.value <= o.items[len(o.items)-1].value {
+		return
+	}
+	i := sort.Search(len(o.items), func(i int) bool { return o.items[i].value < v.value })
+	o.items = append(o.items, anomaly{})
+	copy(o.items[i+1:], o.items[i:])
+	o.items[i] = v
+	if len(o.items) > o.k {
+		o.items = o.items[:o.k]
+	}
+}
+
+// mintActivity tracks the busiest spike window of a mint. Events arrive in
+// slot order so only the current window needs counting.
+type mintActivity struct {
+	trades       uint64
+	windowStart  int64
+	windowSlot   uint64
+	windowTrades uint64
+	peakStart    int64
+	peakSlot     uint64
+	peakTrades   uint64
+}
+
+func (o *mintActivity) add(start int64, slot uint64) {
+	o.trades++
+	if start != o.windowStart || o.windowTrades == 0 {
+		o.windowStart = start
+		o.windowSlot = slot
+		o.windowTrades = 0
+	}
+	o.windowTrades++
+	if o.windowTrades > o.peakTrades {
+		o.peakStart = o.windowStart
+		o.peakSlot = o.windowSlot
+		o.peakTrades = o.windowTrades
+	}
+}
+
+func NewAnomaliesTask() *AnomaliesTask {
+	return &AnomaliesTask{
+		mints: map[string]*mintActivity{},
+	}
+}
+
+func (o *AnomaliesTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir to get the archive data from")
+	cmd.Flags().Uint64Var(&o.params.fromSlot, "from-slot", 0, "Only look at events from this slot. 0 means from the start")
+	cmd.Flags().Uint64Var(&o.params.toSlot, "to-slot", 0, "Only look at events up to and including this slot. 0 means to the end")
+	cmd.Flags().IntVarP(&o.params.top, "top", "k", 10, "How many of each kind of anomaly to report")
+	cmd.Flags().StringVar(&o.params.spikeWindow, "spike-window", "1m", "The window mint activity spikes are measured over")
+	cmd.Flags().Uint64Var(&o.params.minSpikeTrades, "min-spike-trades", 20, "Ignore mint spikes with fewer swaps than this in their busiest window")
+	cmd.Flags().StringVar(&o.amounts.decimalsFile, "token-decimals", "", "A JSON file of the decimals of each quote mint e.g. {\"<mint>\": 6}. SOL, USDC, USDT and Pump.fun mints are known")
+	o.usd.SetupParameters(cmd)
+	cmd.Flags().StringVarP(&o.params.format, "format", "f", ReportFormatCSV, "Output format: csv, json or arrow")
+	cmd.Flags().StringVarP(&o.params.output, "output", "o", "", "File to write the report to. Defaults to stdout")
+}
+
+func (o *AnomaliesTask) GetMeta() Meta {
+	return Meta{
+		Name:        "AnomaliesTask",
+		Use:         "anomalies",
+		Description: "Report the largest swaps, the slots with the most events and the mints with the sharpest activity spikes, for checking data quality and finding interesting periods to replay.",
+	}
+}
+
+func (o *AnomaliesTask) Execute(ctx context.Context) error {
+	if err := o.validateParams(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	// swaps are ranked in tokens of their quote mint, or in USD
+	if err := o.amounts.LoadDecimals(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	if err := o.usd.Load(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+
+	for i, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logrus.Infof("scanning file (%d of %d) %s", i+1, len(files), v)
+		err := readArchiveEvents(o.params.dataDir+"/"+v, nil, func(event EventRow) error {
+			if event.Slot < o.params.fromSlot || (o.params.toSlot != 0 && event.Slot > o.params.toSlot) {
+				return nil
+			}
+			o.add(event)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	o.endSlot()
+	return o.writeReport()
+}
+
+func (o *AnomaliesTask) add(event EventRow) {
+	if event.Slot != o.slot {
+		o.endSlot()
+		o.slot = event.Slot
+		o.slotTime = event.BlockTime
+	}
+	o.slotEvents++
+	if event.BlockTime != 0 {
+		if o.first == 0 {
+			o.first = event.BlockTime
+		}
+		o.last = event.BlockTime
+	}
+
+	if event.Swap == nil {
+		return
+	}
+	if value, ok := o.swapValue(event); ok {
+		o.swaps.Add(anomaly{
+			kind:      AnomalyLargestSwap,
+			value:     value,
+			slot:      event.Slot,
+			blockTime: event.BlockTime,
+			mint:      event.Swap.BaseTokenMint,
+			quoteMint: event.Swap.QuoteTokenMint,
+			wallet:    event.Swap.WalletAccount,
+			signature: event.Sig,
+		})
+	} else {
+		o.unvalued++
+	}
+	if event.BlockTime == 0 || event.Swap.BaseTokenMint == "" {
+		return
+	}
+	activity, ok := o.mints[event.Swap.BaseTokenMint]
+	if !ok {
+		activity = &mintActivity{}
+		o.mints[event.Swap.BaseTokenMint] = activity
+	}
+	window := int64(o.spikeWindow / time.Second)
+	activity.add(event.BlockTime-event.BlockTime%window, event.Slot)
+}
+
+// swapValue returns the quote amount of a swap in tokens, or in USD with
+// --usd-prices. Raw amounts are not comparable as quote mints differ in
+// decimals.
+func (o *AnomaliesTask) swapValue(event EventRow) (float64, bool) {
+	var value *big.Rat
+	var ok bool
+	if o.usd.Enabled() {
+		value, ok = o.usd.USD(event.Swap, event.Slot, event.BlockTime)
+	} else {
+		value, ok = o.amounts.Rat(event.Swap.QuoteAmount, event.Swap.QuoteTokenMint)
+	}
+	if !ok {
+		return 0, false
+	}
+	f, _ := value.Float64()
+	return f, true
+}
+
+func (o *AnomaliesTask) endSlot() {
+	if o.slotEvents == 0 {
+		return
+	}
+	o.slots.Add(anomaly{kind: AnomalyBusiestSlot, value: float64(o.slotEvents), slot: o.slot, blockTime: o.slotTime})
+	o.slotEvents = 0
+}
+
+// spikes scores each mint by the swaps in its busiest window over its average
+// swaps per window across the whole range
+func (o *AnomaliesTask) spikes() topAnomalies {
+	window := int64(o.spikeWindow / time.Second)
+	windows := float64((o.last-o.first)/window + 1)
+	spikes := []anomaly{}
+	for mint, v := range o.mints {
+		if v.peakTrades < o.params.minSpikeTrades {
+			continue
+		}
+		spikes = append(spikes, anomaly{
+			kind:      AnomalyMintSpike,
+			value:     float64(v.peakTrades) / (float64(v.trades) / windows),
+			slot:      v.peakSlot,
+			blockTime: v.peakStart,
+			mint:      mint,
+		})
+	}
+	// ties are broken by mint so runs are repeatable
+	sort.Slice(spikes, func(i, j int) bool {
+		if spikes[i].value != spikes[j].value {
+			return spikes[i].value > spikes[j].value
+		}
+		return spikes[i].mint < spikes[j].mint
+	})
+	return topAnomalies{k: o.params.top, items: spikes[:min(len(spikes), o.params.top)]}
+}
+
+func (o *AnomaliesTask) writeReport() error {
+	out, err := openOutput(o.params.output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w, err := newRecordWriter(out, o.params.format, []string{"kind", "rank", "value", "slot", "time", "mint", "quote_mint", "wallet", "signature"})
+	if err != nil {
+		return err
+	}
+	spikes := o.spikes()
+	for _, top := range []topAnomalies{o.swaps, o.slots, spikes} {
+		for i, v := range top.items {
+			eventTime := ""
+			if v.blockTime != 0 {
+				eventTime = time.Unix(v.blockTime, 0).UTC().Format(time.RFC3339)
+			}
+			if err := w.Write(v.kind, i+1, v.value, v.slot, eventTime, v.mint, v.quoteMint, v.wallet, v.signature); err != nil {
+				return err
+			}
+		}
+	}
+	logrus.Infof("found %d large swaps, %d busy slots and %d mint spikes", len(o.swaps.items), len(o.slots.items), len(spikes.items))
+	if o.unvalued > 0 {
+		if o.usd.Enabled() {
+			logrus.Warnf("left %d swaps out of the largest swaps as they are not quoted in SOL, USDC or USDT, or are before the first usd price", o.unvalued)
+		} else {
+			logrus.Warnf("left %d swaps out of the largest swaps as the decimals of their quote mint are not known", o.unvalued)
+		}
+	}
+	o.amounts.Report()
+	return w.Flush()
+}
+
+func (o *AnomaliesTask) validateParams() error {
+	if o.params.top < 1 {
+		return errors.New("top must be at least 1")
+	}
+	if o.params.toSlot != 0 && o.params.toSlot < o.params.fromSlot {
+		return errors.New("to-slot must not be before from-slot")
+	}
+	window, err := time.ParseDuration(o.params.spikeWindow)
+	if err != nil {
+		return errors.Wrap(err, "invalid spike-window")
+	}
+	if window < time.Second {
+		return errors.New("spike-window must be at least 1s")
+	}
+	o.spikeWindow = window
+	o.swaps = topAnomalies{k: o.params.top}
+	o.slots = topAnomalies{k: o.params.top}
+	return nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestAnomalies(t *testing.T) {
+	rows := strings.Builder{}
+	// m1 trades steadily once a minute in SOL, m2 bursts in one minute with
+	// a swap quoted in USDC
+	for i := 0; i < 10; i++ {
+		fmt.Fprintf(&rows, `{"slot":%d,"blockTime":%d,"signature":"s%d","swap":{"baseTokenMint":"m1","quoteTokenMint":"%s","walletAccount":"a","quoteAmount":"%d000000000"}}`+"\n", 100+i*10, 1714910400+i*60, i, wrappedSOLMint, i)
+	}
+	burst := strings.Builder{}
+	fmt.Fprintf(&burst, `{"slot":150,"blockTime":1714910700,"swap":{"baseTokenMint":"m2","quoteTokenMint":"%s","walletAccount":"b","quoteAmount":"8500000"}}`+"\n", usdcMint)
+	for i := 0; i < 2; i++ {
+		fmt.Fprintf(&burst, `{"slot":150,"blockTime":1714910700,"swap":{"baseTokenMint":"m2","quoteTokenMint":"unknown","walletAccount":"b","quoteAmount":"1000000000000"}}`+"\n")
+	}
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{"swaps.json": rows.String(), "burst.json": burst.String()})
+
+	task := NewAnomaliesTask()
+	task.params.dataDir = dataDir
+	task.params.toSlot = 180
+	task.params.top = 2
+	task.params.spikeWindow = "1m"
+	task.params.minSpikeTrades = 1
+	task.params.format = ReportFormatCSV
+	task.params.output = t.TempDir() + "/anomalies.csv"
+	assert.Nil(t, task.Execute(context.Background()))
+
+	raw, err := os.ReadFile(task.params.output)
+	assert.Nil(t, err)
+	// ranked in tokens of the quote mint, leaving out mints with unknown
+	// decimals
+	assert.Equal(t, fmt.Sprintf(`kind,rank,value,slot,time,mint,quote_mint,wallet,signature
+largest_swap,1,8.5,150,2024-05-05T12:05:00Z,m2,%s,b,
+largest_swap,2,8,180,2024-05-05T12:08:00Z,m1,%s,a,s8
+busiest_slot,1,4,150,2024-05-05T12:05:00Z,,,,
+busiest_slot,2,1,100,2024-05-05T12:00:00Z,,,,
+mint_spike,1,9,150,2024-05-05T12:05:00Z,m2,,,
+mint_spike,2,1,100,2024-05-05T12:00:00Z,m1,,,
+`, usdcMint, wrappedSOLMint), string(raw))
+
+	// or in USD
+	prices := t.TempDir() + "/prices.csv"
+	assert.Nil(t, os.WriteFile(prices, []byte("time,price\n2024-05-05T12:00:00Z,2\n"), 0644))
+	task = NewAnomaliesTask()
+	task.params.dataDir = dataDir
+	task.params.toSlot = 180
+	task.params.top = 2
+	task.params.spikeWindow = "1m"
+	task.params.format = ReportFormatCSV
+	task.params.output = t.TempDir() + "/anomalies.csv"
+	task.usd.source = prices
+	assert.Nil(t, task.Execute(context.Background()))
+	raw, err = os.ReadFile(task.params.output)
+	assert.Nil(t, err)
+	assert.True(t, strings.HasPrefix(string(raw), fmt.Sprintf(`kind,rank,value,slot,time,mint,quote_mint,wallet,signature
+largest_swap,1,16,180,2024-05-05T12:08:00Z,m1,%[1]s,a,s8
+largest_swap,2,14,170,2024-05-05T12:07:00Z,m1,%[1]s,a,s7
+`, wrappedSOLMint)), string(raw))
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// apiCacheDir holds the order and metadata responses of download under the
+// output dir, so running download again e.g. to retry a few failed files does
+// not need the API
+const apiCacheDir = ".ss-api-cache"
+
+// apiCacheEntry is the cached responses for one order
+type apiCacheEntry struct {
+	Endpoint  string          `json:"endpoint"`
+	SavedAt   time.Time       `json:"savedAt"`
+	Order     *Order          `json:"order,omitempty"`
+	FileSizes map[string]uint `json:"fileSizes"`
+}
+
+// apiCache caches the API responses of an order on disk for ttl. A nil cache
+// caches nothing.
+type apiCache struct {
+	path  string
+	lock  sync.Mutex
+	entry apiCacheEntry
+}
+
+// loadAPICache loads the cached responses of the order. Entries older than ttl
+// or for another endpoint are ignored.
+func loadAPICache(outputDir string, orderID uint, endpoint string, ttl time.Duration) *apiCache {
+	cache := &apiCache{
+		path:  filepath.Join(outputDir, apiCacheDir, fmt.Sprintf("order-%d.json", orderID)),
+		entry: apiCacheEntry{Endpoint: endpoint, SavedAt: time.Now(), FileSizes: map[string]uint{}},
+	}
+	raw, err := os.ReadFile(cache.path)
+	if err != nil {
+		return cache
+	}
+	entry := apiCacheEntry{}
+	if err := json.Unmarshal(raw, &entry); err != nil {
+		logrus.Warnf("ignoring unreadable api cache %s: %s", cache.path, err)
+		return cache
+	}
+	if entry.Endpoint != endpoint || time.Since(entry.SavedAt) > ttl {
+		return cache
+	}
+	if entry.FileSizes == nil {
+		entry.FileSizes = map[string]uint{}
+	}
+	cache.entry = entry
+	return cache
+}
+
+// Order returns the cached order
+func (o *apiCache) Order() (Order, bool) {
+	if o == nil || o.entry.Order == nil {
+		return Order{}, false
+	}
+	return *o.entry.Order, true
+}
+
+func (o *apiCache) SetOrder(order Order) {
+	if o == nil {
+		return
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.entry.Order = &order
+	o.save()
+}
+
+// FileSizes returns the cached sizes of the files and the files not cached
+func (o *apiCache) FileSizes(files []string) (map[string]uint, []string) {
+	if o == nil {
+		return map[string]uint{}, files
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	sizes := map[string]uint{}
+	missing := []string{}
+	for _, v := range files {
+		if size, ok := o.entry.FileSizes[v]; ok {
+			sizes[v] = size
+		} else {
+			missing = append(missing, v)
+		}
+	}
+	return sizes, missing
+}
+
+func (o *apiCache) SetFileSizes(sizes map[string]uint) {
+	if o == nil {
+		return
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for k, v := range sizes {
+		o.entry.FileSizes[k] = v
+	}
+	o.save()
+}
+
+// save writes the cache. Failing to is only logged as the cache is optional.
+func (o *apiCache) save() {
+	raw, err := json.Marshal(o.entry)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(o.path), 0755)
+	}
+	if err == nil {
+		// holds the download token
+		err = os.WriteFile(o.path, raw, 0600)
+	}
+	if err != nil {
+		logrus.Warnf("could not save the api cache: %s", err)
+	}
+}
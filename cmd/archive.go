@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// maxRowSize is the largest single event row the archive readers accept
+const maxRowSize = 4 * 1024 * 1024
+
+// listArchiveFiles returns the names of the zip archives in dir, oldest first.
+// Files are ordered by the time in their name (see archiveFileTime). Files
+// with no time in their name come after, in name order. The dir "-" is stdin,
+// listed as a single file.
+func listArchiveFiles(dir string) ([]string, error) {
+	if dir == pipeName {
+		return []string{pipeName}, nil
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	filtered := []string{}
+	for _, v := range files {
+		if v.IsDir() {
+			continue
+		}
+		// check extension
+		if len(v.Name()) < 4 || v.Name()[len(v.Name())-4:] != ".zip" {
+			continue
+		}
+		filtered = append(filtered, v.Name())
+	}
+	sortArchiveFiles(filtered)
+	return filtered, nil
+}
+
+func sortArchiveFiles(files []string) {
+	sort.SliceStable(files, func(i, j int) bool {
+		ti, iok := archiveFileTime(files[i])
+		tj, jok := archiveFileTime(files[j])
+		switch {
+		case iok && jok:
+			if !ti.Equal(tj) {
+				return ti.Before(tj)
+			}
+			return files[i] < files[j]
+		case iok != jok:
+			return iok
+		default:
+			return files[i] < files[j]
+		}
+	})
+}
+
+// readArchiveRows streams every row of every file inside the zip archive to fn
+// without extracting anything to disk. When the archive holds several files
+// their rows are merged in slot order. The row slice is only valid for the
+// duration of the call. Rows are read from stdin when path is "-".
+func readArchiveRows(path string, fn func(row []byte) error) error {
+	return readArchiveRowSources(path, func(row []byte, source rowSource) error {
+		return fn(row)
+	})
+}
+
+// rowSource is where a row is in its archive
+type rowSource struct {
+	// the file in the archive, "-" for stdin
+	File string
+	// counted from 1, including empty lines
+	Line int
+}
+
+// readArchiveRowSources is readArchiveRows passing where each row is too
+func readArchiveRowSources(path string, fn func(row []byte, source rowSource) error) error {
+	if isPipe(path) {
+		return readPipeRows(fn)
+	}
+	r, closer, err := openArchive(path)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	scanners := make([]*bufio.Scanner, 0, len(r.File))
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+		scanner := bufio.NewScanner(rc)
+		scanner.Buffer(make([]byte, 64*1024), maxRowSize)
+		scanners = append(scanners, scanner)
+	}
+
+	// the next unconsumed row of each file, nil once the file is done
+	heads := make([][]byte, len(scanners))
+	slots := make([]uint64, len(scanners))
+	sources := make([]rowSource, len(scanners))
+	for i, f := range r.File {
+		sources[i].File = f.Name
+	}
+	advance := func(i int) error {
+		for scanners[i].Scan() {
+			sources[i].Line++
+			if len(scanners[i].Bytes()) == 0 {
+				continue
+			}
+			heads[i] = scanners[i].Bytes()
+			slots[i] = rowSlot(heads[i])
+			return nil
+		}
+		heads[i] = nil
+		if err := scanners[i].Err(); err != nil {
+			return errors.Wrapf(archiveReadError(err), "cant read %s in %s", r.File[i].Name, path)
+		}
+		return nil
+	}
+	for i := range scanners {
+		if err := advance(i); err != nil {
+			return err
+		}
+	}
+
+	for {
+		next := -1
+		for i, head := range heads {
+			if head != nil && (next == -1 || slots[i] < slots[next]) {
+				next = i
+			}
+		}
+		if next == -1 {
+			return nil
+		}
+		watchdog.Progress(1)
+		if err := fn(heads[next], sources[next]); err != nil {
+			return err
+		}
+		if err := advance(next); err != nil {
+			return err
+		}
+	}
+}
+
+// rowSlot extracts the top level slot from a raw event row without fully
+// decoding it. Returns 0 if the row has no slot.
+func rowSlot(row []byte) uint64 {
+	return rowUint(row, "slot")
+}
+
+// rowBlockTime extracts the block time from a raw event row the same way.
+// Returns 0 if the row has no block time.
+func rowBlockTime(row []byte) int64 {
+	return int64(rowUint(row, "blockTime"))
+}
+
+// rowUint extracts the first unsigned number field with this name from a raw
+// event row
+func rowUint(row []byte, field string) uint64 {
+	key := []byte(`"` + field + `":`)
+	i := bytes.Index(row, key)
+	if i == -1 {
+		return 0
+	}
+	v := uint64(0)
+	for _, c := range bytes.TrimLeft(row[i+len(key):], " ") {
+		if c < '0' || c > '9' {
+			break
+		}
+		v = v*10 + uint64(c-'0')
+	}
+	return v
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"archive/zip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/test-go/testify/assert"
+)
+
+func writeTestArchive(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	assert.Nil(t, err)
+	w := zip.NewWriter(f)
+	for name, contents := range files {
+		fw, err := w.Create(name)
+		assert.Nil(t, err)
+		_, err = fw.Write([]byte(contents))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, w.Close())
+	assert.Nil(t, f.Close())
+}
+
+func TestReadArchiveRowsMergesBySlot(t *testing.T) {
+	path := t.TempDir() + "/20240505-120000.zip"
+	writeTestArchive(t, path, map[string]string{
+		"pairs.json": "{\"slot\":2,\"pair\":{}}\n{\"slot\":5,\"pair\":{}}\n",
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n\n{\"slot\": 3,\"swap\":{}}\n{\"slot\":6,\"swap\":{}}\n",
+	})
+
+	slots := []uint64{}
+	err := readArchiveRows(path, func(row []byte) error {
+		slots = append(slots, rowSlot(row))
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2, 3, 5, 6}, slots)
+}
+
+func TestReadArchiveEventsCache(t *testing.T) {
+	eventCache = t.TempDir()
+	defer func() { eventCache = "" }()
+	path := t.TempDir() + "/20240505-120000.zip"
+	writeTestArchive(t, path, map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{\"walletAccount\":\"a\"}}\n{\"slot\":2,\"pair\":{}}\n",
+	})
+	read := func() []uint64 {
+		slots := []uint64{}
+		err := readArchiveEvents(path, []byte(`"swap"`), func(event EventRow) error {
+			slots = append(slots, event.Slot)
+			return nil
+		})
+		assert.Nil(t, err)
+		return slots
+	}
+
+	// the cache has every event, not only those matching the prefilter
+	assert.Equal(t, []uint64{1, 2}, read())
+	source, err := filepath.Abs(path)
+	assert.Nil(t, err)
+	_, err = os.Stat(eventCachePath(source))
+	assert.Nil(t, err)
+
+	// an archive of the same name in another dir has its own cache
+	other := t.TempDir() + "/20240505-120000.zip"
+	writeTestArchive(t, other, map[string]string{
+		"swaps.json": "{\"slot\":7,\"swap\":{\"walletAccount\":\"a\"}}\n",
+	})
+	for i := 0; i < 2; i++ {
+		slots := []uint64{}
+		assert.Nil(t, readArchiveEvents(other, nil, func(event EventRow) error {
+			slots = append(slots, event.Slot)
+			return nil
+		}))
+		assert.Equal(t, []uint64{7}, slots)
+	}
+	otherSource, err := filepath.Abs(other)
+	assert.Nil(t, err)
+	for _, v := range []string{source, otherSource} {
+		_, err = os.Stat(eventCachePath(v))
+		assert.Nil(t, err)
+	}
+	assert.Equal(t, []uint64{1, 2}, read())
+
+	// an archive with the same size and time is read from the cache
+	mtime := time.Now().Add(-time.Hour)
+	assert.Nil(t, os.Chtimes(path, mtime, mtime))
+	assert.Equal(t, []uint64{1, 2}, read())
+	writeTestArchive(t, path, map[string]string{
+		"swaps.json": "{\"slot\":3,\"swap\":{\"walletAccount\":\"a\"}}\n{\"slot\":4,\"pair\":{}}\n",
+	})
+	assert.Nil(t, os.Chtimes(path, mtime, mtime))
+	assert.Equal(t, []uint64{1, 2}, read())
+
+	// changing the archive rebuilds it
+	assert.Nil(t, os.Chtimes(path, time.Now(), time.Now()))
+	assert.Equal(t, []uint64{3, 4}, read())
+	assert.Equal(t, []uint64{3, 4}, read())
+}
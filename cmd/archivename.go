@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// defaultArchiveNameFormat is how the API names archive files
+const defaultArchiveNameFormat = "{" + archiveZipFileTimeFormat + "}.zip"
+
+// apiArchiveNames is the scheme archive files are downloaded with
+var apiArchiveNames = archiveNameScheme{layout: archiveZipFileTimeFormat, suffix: ".zip"}
+
+// archiveNames is the scheme local archive files are named with. Set with
+// --archive-name-format.
+var archiveNames = apiArchiveNames
+
+// archiveNameScheme is a file name with a Go time layout in braces e.g.
+// "swaps-{2006-01-02T15}.zip"
+type archiveNameScheme struct {
+	prefix string
+	layout string
+	suffix string
+}
+
+func parseArchiveNameScheme(format string) (archiveNameScheme, error) {
+	prefix, rest, ok := strings.Cut(format, "{")
+	if !ok {
+		return archiveNameScheme{}, fmt.Errorf("archive name format %q has no {time layout}", format)
+	}
+	layout, suffix, ok := strings.Cut(rest, "}")
+	if !ok || layout == "" {
+		return archiveNameScheme{}, fmt.Errorf("archive name format %q has no {time layout}", format)
+	}
+	if strings.ContainsAny(suffix, "{}") {
+		return archiveNameScheme{}, fmt.Errorf("archive name format %q can only have one {time layout}", format)
+	}
+	if !strings.HasSuffix(suffix, ".zip") {
+		return archiveNameScheme{}, fmt.Errorf("archive name format %q must end with .zip", format)
+	}
+	return archiveNameScheme{prefix: prefix, layout: layout, suffix: suffix}, nil
+}
+
+// Time returns the UTC hour a file name is for. Returns false if the name does
+// not follow the scheme.
+func (o archiveNameScheme) Time(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, o.prefix) || !strings.HasSuffix(name, o.suffix) || len(name) < len(o.prefix)+len(o.suffix) {
+		return time.Time{}, false
+	}
+	t, err := time.Parse(o.layout, name[len(o.prefix):len(name)-len(o.suffix)])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// archiveFileTime returns the hour of an archive file named with archiveNames
+// or, so directories mixing renamed and downloaded files still replay in
+// order, the API scheme. The dataset of split orders is ignored.
+func archiveFileTime(name string) (time.Time, bool) {
+	name, _ = splitDataset(name)
+	if t, ok := archiveNames.Time(name); ok {
+		return t, true
+	}
+	return apiArchiveNames.Time(name)
+}
+
+// Name returns the file name for the hour t
+func (o archiveNameScheme) Name(t time.Time) string {
+	return o.prefix + t.UTC().Format(o.layout) + o.suffix
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestArchiveNameScheme(t *testing.T) {
+	scheme, err := parseArchiveNameScheme("swaps-{2006-01-02T15}.zip")
+	assert.Nil(t, err)
+	hour := time.Date(2024, 5, 5, 13, 0, 0, 0, time.UTC)
+	assert.Equal(t, "swaps-2024-05-05T13.zip", scheme.Name(hour))
+	parsed, ok := scheme.Time("swaps-2024-05-05T13.zip")
+	assert.True(t, ok)
+	assert.Equal(t, hour, parsed)
+	_, ok = scheme.Time("20240505-130000.zip")
+	assert.False(t, ok)
+	_, ok = scheme.Time("swaps-.zip")
+	assert.False(t, ok)
+
+	for _, v := range []string{"swaps.zip", "swaps-{}.zip", "{20060102}-{15}.zip", "{20060102}.json"} {
+		_, err := parseArchiveNameScheme(v)
+		assert.NotNil(t, err, v)
+	}
+	scheme, err = parseArchiveNameScheme(defaultArchiveNameFormat)
+	assert.Nil(t, err)
+	assert.Equal(t, archiveNames, scheme)
+}
+
+func TestListArchiveFilesByNameScheme(t *testing.T) {
+	scheme, err := parseArchiveNameScheme("{02-01-2006_15}.zip")
+	assert.Nil(t, err)
+	defaultNames := archiveNames
+	archiveNames = scheme
+	defer func() { archiveNames = defaultNames }()
+
+	dir := t.TempDir()
+	// lexicographic order differs from time order
+	for _, v := range []string{"06-05-2024_00.zip", "05-05-2024_23.zip", "05-05-2024_09.zip", "notes.zip"} {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, v), nil, 0644))
+	}
+	files, err := listArchiveFiles(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"05-05-2024_09.zip", "05-05-2024_23.zip", "06-05-2024_00.zip", "notes.zip"}, files)
+}
+
+func TestListArchiveFilesMixedSchemes(t *testing.T) {
+	scheme, err := parseArchiveNameScheme("swaps-{2006-01-02T15}.zip")
+	assert.Nil(t, err)
+	defaultNames := archiveNames
+	archiveNames = scheme
+	defer func() { archiveNames = defaultNames }()
+
+	dir := t.TempDir()
+	for _, v := range []string{"20240505-140000.zip", "swaps-2024-05-05T15.zip", "a.zip", "swaps-2024-05-05T12.zip", "20240505-130000.zip"} {
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, v), nil, 0644))
+	}
+	expected := []string{"swaps-2024-05-05T12.zip", "20240505-130000.zip", "20240505-140000.zip", "swaps-2024-05-05T15.zip", "a.zip"}
+	files, err := listArchiveFiles(dir)
+	assert.Nil(t, err)
+	assert.Equal(t, expected, files)
+
+	st := NewSimulateTask()
+	st.params.dataDir = dir
+	files, err = st.getDataFiles()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, files)
+
+	rt := NewReduceTask()
+	rt.params.dataInDir = dir
+	files, err = rt.getDataFiles()
+	assert.Nil(t, err)
+	assert.Equal(t, expected, files)
+}
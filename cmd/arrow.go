@@ -0,0 +1,291 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+)
+
+// arrowBatchRows is the most rows buffered before writing a record batch
+const arrowBatchRows = 64 * 1024
+
+// Arrow IPC flatbuffer enums, see Schema.fbs and Message.fbs in the Arrow format
+const (
+	arrowMetadataV5      = 4
+	arrowHeaderSchema    = 1
+	arrowHeaderBatch     = 3
+	arrowTypeInt         = 2
+	arrowTypeFloat       = 3
+	arrowTypeUtf8        = 5
+	arrowTypeBool        = 6
+	arrowPrecisionDouble = 2
+)
+
+// arrowColumn is the type of a column, taken from its values in the first
+// batch
+type arrowColumn int
+
+const (
+	arrowUtf8 arrowColumn = iota
+	arrowInt64
+	arrowUint64
+	arrowFloat64
+	arrowBool
+)
+
+func arrowColumnOf(v any) (arrowColumn, bool) {
+	switch v.(type) {
+	case nil:
+		return 0, false
+	case int, int32, int64:
+		return arrowInt64, true
+	case uint, uint32, uint64:
+		return arrowUint64, true
+	case float32, float64:
+		return arrowFloat64, true
+	case bool:
+		return arrowBool, true
+	default:
+		return arrowUtf8, true
+	}
+}
+
+func (o arrowColumn) String() string {
+	return [...]string{"utf8", "int64", "uint64", "float64", "bool"}[o]
+}
+
+// arrowWriter writes records as an Arrow IPC stream, which pyarrow and
+// polars load without parsing. Rows are buffered into record batches, and the
+// schema is written with the first batch with each column typed by its first
+// value. Columns without a value in the first batch are strings.
+type arrowWriter struct {
+	out     io.Writer
+	header  []string
+	columns []arrowColumn
+	rows    [][]any
+	ended   bool
+}
+
+func newArrowWriter(out io.Writer, header []string) *arrowWriter {
+	return &arrowWriter{out: out, header: header}
+}
+
+func (o *arrowWriter) Write(values []any) error {
+	if o.ended {
+		return fmt.Errorf("arrow stream already ended")
+	}
+	o.rows = append(o.rows, values)
+	if len(o.rows) < arrowBatchRows {
+		return nil
+	}
+	return o.writeBatch()
+}
+
+// Flush writes the buffered rows and ends the stream
+func (o *arrowWriter) Flush() error {
+	if o.ended {
+		return nil
+	}
+	if err := o.writeBatch(); err != nil {
+		return err
+	}
+	o.ended = true
+	// the end of stream marker
+	_, err := o.out.Write([]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0})
+	return err
+}
+
+func (o *arrowWriter) writeBatch() error {
+	if o.columns == nil {
+		o.columns = make([]arrowColumn, len(o.header))
+		for i := range o.header {
+			for _, row := range o.rows {
+				if column, ok := arrowColumnOf(row[i]); ok {
+					o.columns[i] = column
+					break
+				}
+			}
+		}
+		if err := writeArrowMessage(o.out, arrowHeaderSchema, o.schema(), nil); err != nil {
+			return err
+		}
+	}
+	if len(o.rows) == 0 {
+		return nil
+	}
+
+	nodes, buffers, body := []byte{}, []byte{}, []byte{}
+	addBuffer := func(raw []byte) {
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(body)))
+		buffers = binary.LittleEndian.AppendUint64(buffers, uint64(len(raw)))
+		body = append(body, raw...)
+		body = append(body, make([]byte, pad8(len(raw)))...)
+	}
+	for i := range o.header {
+		validity, nulls, data, offsets, err := o.encodeColumn(i)
+		if err != nil {
+			return err
+		}
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(len(o.rows)))
+		nodes = binary.LittleEndian.AppendUint64(nodes, uint64(nulls))
+		if nulls == 0 {
+			validity = nil
+		}
+		addBuffer(validity)
+		if offsets != nil {
+			addBuffer(offsets)
+		}
+		addBuffer(data)
+	}
+	length := len(o.rows)
+	batch := func(b *fbBuilder) int {
+		return b.table(
+			fbInt64(int64(length)),
+			fbRef(func(b *fbBuilder) int { return b.structVector(nodes) }),
+			fbRef(func(b *fbBuilder) int { return b.structVector(buffers) }),
+		)
+	}
+	o.rows = o.rows[:0]
+	return writeArrowMessage(o.out, arrowHeaderBatch, batch, body)
+}
+
+// encodeColumn returns the validity bitmap, null count and data of a column
+// of the buffered rows, and the offsets of a string column
+func (o *arrowWriter) encodeColumn(i int) ([]byte, int, []byte, []byte, error) {
+	column := o.columns[i]
+	validity := make([]byte, (len(o.rows)+7)/8)
+	nulls := 0
+	data := []byte{}
+	var offsets []byte
+	if column == arrowUtf8 {
+		offsets = binary.LittleEndian.AppendUint32(nil, 0)
+	}
+	if column == arrowBool {
+		data = make([]byte, len(validity))
+	}
+	for r, row := range o.rows {
+		v := row[i]
+		if v == nil {
+			nulls++
+		} else {
+			validity[r/8] |= 1 << (r % 8)
+			if valueColumn, _ := arrowColumnOf(v); column != arrowUtf8 && valueColumn != column {
+				return nil, 0, nil, nil, fmt.Errorf("column %s is %s but got %T %v", o.header[i], column, v, v)
+			}
+		}
+		switch column {
+		case arrowUtf8:
+			if v != nil {
+				data = append(data, formatValue(v)...)
+			}
+			if len(data) > math.MaxInt32 {
+				return nil, 0, nil, nil, fmt.Errorf("column %s has more than 2GB of text in a batch", o.header[i])
+			}
+			offsets = binary.LittleEndian.AppendUint32(offsets, uint32(len(data)))
+		case arrowInt64:
+			n := int64(0)
+			switch t := v.(type) {
+			case int:
+				n = int64(t)
+			case int32:
+				n = int64(t)
+			case int64:
+				n = t
+			}
+			data = binary.LittleEndian.AppendUint64(data, uint64(n))
+		case arrowUint64:
+			n := uint64(0)
+			switch t := v.(type) {
+			case uint:
+				n = uint64(t)
+			case uint32:
+				n = uint64(t)
+			case uint64:
+				n = t
+			}
+			data = binary.LittleEndian.AppendUint64(data, n)
+		case arrowFloat64:
+			f := 0.0
+			switch t := v.(type) {
+			case float32:
+				f = float64(t)
+			case float64:
+				f = t
+			}
+			data = binary.LittleEndian.AppendUint64(data, math.Float64bits(f))
+		case arrowBool:
+			if t, _ := v.(bool); t {
+				data[r/8] |= 1 << (r % 8)
+			}
+		}
+	}
+	return validity, nulls, data, offsets, nil
+}
+
+func (o *arrowWriter) schema() func(b *fbBuilder) int {
+	return func(b *fbBuilder) int {
+		fields := []func(b *fbBuilder) int{}
+		for i, name := range o.header {
+			column := o.columns[i]
+			fields = append(fields, func(b *fbBuilder) int {
+				typeID, typ := arrowType(column)
+				return b.table(
+					fbRef(func(b *fbBuilder) int { return b.string(name) }),
+					fbBool(true),
+					fbUint8(typeID),
+					fbRef(typ),
+					fbAbsent(),
+					// readers require the children even when empty
+					fbRef(func(b *fbBuilder) int { return b.tableVector(nil) }),
+				)
+			})
+		}
+		return b.table(
+			fbInt16(0), // little endian
+			fbRef(func(b *fbBuilder) int { return b.tableVector(fields) }),
+		)
+	}
+}
+
+func arrowType(column arrowColumn) (uint8, func(b *fbBuilder) int) {
+	switch column {
+	case arrowInt64:
+		return arrowTypeInt, func(b *fbBuilder) int { return b.table(fbInt32(64), fbBool(true)) }
+	case arrowUint64:
+		return arrowTypeInt, func(b *fbBuilder) int { return b.table(fbInt32(64), fbBool(false)) }
+	case arrowFloat64:
+		return arrowTypeFloat, func(b *fbBuilder) int { return b.table(fbInt16(arrowPrecisionDouble)) }
+	case arrowBool:
+		return arrowTypeBool, func(b *fbBuilder) int { return b.table() }
+	default:
+		return arrowTypeUtf8, func(b *fbBuilder) int { return b.table() }
+	}
+}
+
+// writeArrowMessage writes an encapsulated IPC message: the continuation
+// marker, the length of the metadata, the Message flatbuffer padded to 8
+// bytes and the body
+func writeArrowMessage(out io.Writer, headerType uint8, header func(b *fbBuilder) int, body []byte) error {
+	b := &fbBuilder{}
+	b.root(func(b *fbBuilder) int {
+		return b.table(
+			fbInt16(arrowMetadataV5),
+			fbUint8(headerType),
+			fbRef(header),
+			fbInt64(int64(len(body))),
+		)
+	})
+	metadata := append(b.buf, make([]byte, pad8(len(b.buf)))...)
+	prefix := binary.LittleEndian.AppendUint32([]byte{0xff, 0xff, 0xff, 0xff}, uint32(len(metadata)))
+	for _, v := range [][]byte{prefix, metadata, body} {
+		if _, err := out.Write(v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pad8(n int) int {
+	return (8 - n%8) % 8
+}
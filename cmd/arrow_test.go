@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/test-go/testify/assert"
+)
+
+// fbTable reads a flatbuffers table by following its vtable
+type fbTable struct {
+	buf []byte
+	pos int
+}
+
+func (t fbTable) field(i int) int {
+	vtable := t.pos - int(int32(binary.LittleEndian.Uint32(t.buf[t.pos:])))
+	if 4+2*i >= int(binary.LittleEndian.Uint16(t.buf[vtable:])) {
+		return 0
+	}
+	offset := int(binary.LittleEndian.Uint16(t.buf[vtable+4+2*i:]))
+	if offset == 0 {
+		return 0
+	}
+	return t.pos + offset
+}
+
+func (t fbTable) ref(i int) int {
+	pos := t.field(i)
+	return pos + int(binary.LittleEndian.Uint32(t.buf[pos:]))
+}
+
+func (t fbTable) table(i int) fbTable {
+	return fbTable{t.buf, t.ref(i)}
+}
+
+func (t fbTable) uint8(i int) uint8 {
+	return t.buf[t.field(i)]
+}
+
+func (t fbTable) int64(i int) int64 {
+	return int64(binary.LittleEndian.Uint64(t.buf[t.field(i):]))
+}
+
+func (t fbTable) vector(i int) (int, int) {
+	pos := t.ref(i)
+	return pos + 4, int(binary.LittleEndian.Uint32(t.buf[pos:]))
+}
+
+func (t fbTable) string(i int) string {
+	start, n := t.vector(i)
+	return string(t.buf[start : start+n])
+}
+
+type arrowField struct {
+	name     string
+	typeID   uint8
+	signed   bool
+	bitWidth int
+}
+
+// readArrowStream decodes an Arrow IPC stream of the types arrowWriter
+// writes, independently of it, to the fields and the rows of all batches
+func readArrowStream(t *testing.T, raw []byte) ([]arrowField, [][]any) {
+	t.Helper()
+	fields := []arrowField{}
+	rows := [][]any{}
+	for {
+		if !assert.True(t, len(raw) >= 8) || !assert.Equal(t, uint32(0xffffffff), binary.LittleEndian.Uint32(raw)) {
+			return nil, nil
+		}
+		size := int(binary.LittleEndian.Uint32(raw[4:]))
+		if size == 0 {
+			assert.Equal(t, 8, len(raw), "data after the end of stream")
+			return fields, rows
+		}
+		assert.Equal(t, 0, (8+size)%8)
+		metadata := raw[8 : 8+size]
+		message := fbTable{metadata, int(binary.LittleEndian.Uint32(metadata))}
+		assert.Equal(t, int16(arrowMetadataV5), int16(binary.LittleEndian.Uint16(metadata[message.field(0):])))
+		bodyLength := int(message.int64(3))
+		body := raw[8+size : 8+size+bodyLength]
+		raw = raw[8+size+bodyLength:]
+		header := message.table(2)
+
+		switch message.uint8(1) {
+		case arrowHeaderSchema:
+			assert.Equal(t, 0, bodyLength)
+			start, n := header.vector(1)
+			for i := 0; i < n; i++ {
+				pos := start + 4*i
+				field := fbTable{metadata, pos + int(binary.LittleEndian.Uint32(metadata[pos:]))}
+				_, children := field.vector(5)
+				assert.Equal(t, 0, children)
+				v := arrowField{name: field.string(0), typeID: field.uint8(2)}
+				if v.typeID == arrowTypeInt {
+					typ := field.table(3)
+					v.bitWidth = int(binary.LittleEndian.Uint32(metadata[typ.field(0):]))
+					v.signed = typ.uint8(1) == 1
+				}
+				fields = append(fields, v)
+			}
+		case arrowHeaderBatch:
+			length := int(header.int64(0))
+			nodes, _ := header.vector(1)
+			buffers, _ := header.vector(2)
+			assert.Equal(t, 0, nodes%8)
+			buffer := func() []byte {
+				offset := binary.LittleEndian.Uint64(metadata[buffers:])
+				n := binary.LittleEndian.Uint64(metadata[buffers+8:])
+				buffers += 16
+				assert.Equal(t, uint64(0), offset%8)
+				return body[offset : offset+n]
+			}
+			batch := make([][]any, length)
+			for r := range batch {
+				batch[r] = make([]any, len(fields))
+			}
+			for c, field := range fields {
+				assert.Equal(t, uint64(length), binary.LittleEndian.Uint64(metadata[nodes+16*c:]))
+				validity := buffer()
+				var offsets []byte
+				if field.typeID == arrowTypeUtf8 {
+					offsets = buffer()
+				}
+				data := buffer()
+				for r := range batch {
+					if len(validity) != 0 && validity[r/8]&(1<<(r%8)) == 0 {
+						continue
+					}
+					switch field.typeID {
+					case arrowTypeUtf8:
+						batch[r][c] = string(data[binary.LittleEndian.Uint32(offsets[4*r:]):binary.LittleEndian.Uint32(offsets[4*r+4:])])
+					case arrowTypeInt:
+						batch[r][c] = binary.LittleEndian.Uint64(data[8*r:])
+						if field.signed {
+							batch[r][c] = int64(binary.LittleEndian.Uint64(data[8*r:]))
+						}
+					case arrowTypeFloat:
+						batch[r][c] = math.Float64frombits(binary.LittleEndian.Uint64(data[8*r:]))
+					case arrowTypeBool:
+						batch[r][c] = data[r/8]&(1<<(r%8)) != 0
+					}
+				}
+			}
+			rows = append(rows, batch...)
+		default:
+			t.Fatalf("unexpected message header %d", message.uint8(1))
+		}
+	}
+}
+
+func TestArrowWriter(t *testing.T) {
+	out := bytes.Buffer{}
+	w, err := newRecordWriter(&out, ReportFormatArrow, []string{"time", "swaps", "rank", "price", "sniped", "note"})
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write("2024-05-05T12:00:00Z", uint64(3), 1, 0.5, true, nil))
+	assert.Nil(t, w.Write("2024-05-05T12:05:00Z", uint64(18446744073709551615), -2, nil, false, nil))
+	assert.Nil(t, w.Write(nil, nil, nil, 1.25, nil, nil))
+	assert.Nil(t, w.Flush())
+
+	fields, rows := readArrowStream(t, out.Bytes())
+	assert.Equal(t, []arrowField{
+		{name: "time", typeID: arrowTypeUtf8},
+		{name: "swaps", typeID: arrowTypeInt, bitWidth: 64},
+		{name: "rank", typeID: arrowTypeInt, bitWidth: 64, signed: true},
+		{name: "price", typeID: arrowTypeFloat},
+		{name: "sniped", typeID: arrowTypeBool},
+		// without a value in the first batch
+		{name: "note", typeID: arrowTypeUtf8},
+	}, fields)
+	assert.Equal(t, [][]any{
+		{"2024-05-05T12:00:00Z", uint64(3), int64(1), 0.5, true, nil},
+		{"2024-05-05T12:05:00Z", uint64(18446744073709551615), int64(-2), nil, false, nil},
+		{nil, nil, nil, 1.25, nil, nil},
+	}, rows)
+	assert.NotNil(t, w.Write("2024-05-05T12:10:00Z", uint64(1), 1, 0.5, true, nil))
+}
+
+// TestArrowWriterArrowGo reads the stream with the Arrow project's own Go
+// implementation, so the writer and readArrowStream can not share a mistake
+func TestArrowWriterArrowGo(t *testing.T) {
+	out := bytes.Buffer{}
+	w, err := newRecordWriter(&out, ReportFormatArrow, []string{"time", "swaps", "rank", "price", "sniped", "note"})
+	assert.Nil(t, err)
+	assert.Nil(t, w.Write("2024-05-05T12:00:00Z", uint64(3), 1, 0.5, true, nil))
+	assert.Nil(t, w.Write("2024-05-05T12:05:00Z", uint64(18446744073709551615), -2, nil, false, nil))
+	// the note column is typed as a string by the first batch
+	for i := 0; i < arrowBatchRows; i++ {
+		var note any
+		if i == arrowBatchRows-1 {
+			note = i
+		}
+		assert.Nil(t, w.Write(nil, uint64(i), nil, 1.25, nil, note))
+	}
+	assert.Nil(t, w.Flush())
+
+	reader, err := ipc.NewReader(bytes.NewReader(out.Bytes()))
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer reader.Release()
+	types := []arrow.Type{}
+	for _, field := range reader.Schema().Fields() {
+		assert.True(t, field.Nullable, field.Name)
+		types = append(types, field.Type.ID())
+	}
+	assert.Equal(t, []arrow.Type{arrow.STRING, arrow.UINT64, arrow.INT64, arrow.FLOAT64, arrow.BOOL, arrow.STRING}, types)
+
+	rows := [][]any{}
+	batches := 0
+	for reader.Next() {
+		record := reader.Record()
+		for r := 0; r < int(record.NumRows()); r++ {
+			row := []any{}
+			for c := 0; c < int(record.NumCols()); c++ {
+				row = append(row, record.Column(c).GetOneForMarshal(r))
+			}
+			rows = append(rows, row)
+		}
+		batches++
+	}
+	assert.Nil(t, reader.Err())
+	assert.Equal(t, 2, batches)
+	assert.Equal(t, arrowBatchRows+2, len(rows))
+	assert.Equal(t, []any{"2024-05-05T12:00:00Z", uint64(3), int64(1), 0.5, true, nil}, rows[0])
+	assert.Equal(t, []any{"2024-05-05T12:05:00Z", uint64(18446744073709551615), int64(-2), nil, false, nil}, rows[1])
+	assert.Equal(t, []any{nil, uint64(arrowBatchRows - 1), nil, 1.25, nil, fmt.Sprint(arrowBatchRows - 1)}, rows[arrowBatchRows+1])
+}
+
+func TestArrowWriterBatches(t *testing.T) {
+	out := bytes.Buffer{}
+	w, err := newRecordWriter(&out, ReportFormatArrow, []string{"slot", "note"})
+	assert.Nil(t, err)
+	for i := 0; i < arrowBatchRows+1; i++ {
+		assert.Nil(t, w.Write(uint64(i), nil))
+	}
+	// a column typed as a string by the first batch takes any value
+	assert.Nil(t, w.Write(uint64(0), 7))
+	assert.Nil(t, w.Flush())
+	_, rows := readArrowStream(t, out.Bytes())
+	assert.Equal(t, arrowBatchRows+2, len(rows))
+	assert.Equal(t, []any{uint64(arrowBatchRows), nil}, rows[arrowBatchRows])
+	assert.Equal(t, []any{uint64(0), "7"}, rows[arrowBatchRows+1])
+
+	// a numeric column can not take a string later on
+	w, err = newRecordWriter(&bytes.Buffer{}, ReportFormatArrow, []string{"slot"})
+	assert.Nil(t, err)
+	for i := 0; i < arrowBatchRows; i++ {
+		assert.Nil(t, w.Write(uint64(i)))
+	}
+	assert.Nil(t, w.Write("x"))
+	assert.NotNil(t, w.Flush())
+
+	// an empty report is a schema of strings
+	out.Reset()
+	w, err = newRecordWriter(&out, ReportFormatArrow, []string{"slot"})
+	assert.Nil(t, err)
+	assert.Nil(t, w.Flush())
+	fields, rows := readArrowStream(t, out.Bytes())
+	assert.Equal(t, []arrowField{{name: "slot", typeID: arrowTypeUtf8}}, fields)
+	assert.Equal(t, 0, len(rows))
+}
@@ -0,0 +1,140 @@
+package main
+
+import "encoding/binary"
+
+// fbBuilder writes the part of the flatbuffers format the Arrow IPC
+// metadata needs. Unlike the flatbuffers library it builds front to back:
+// each table is written with its vtable right before it and the tables,
+// vectors and strings it refers to after it, so every offset points forward.
+type fbBuilder struct {
+	buf []byte
+}
+
+// fbField is a field of a table, an inline scalar or a reference to an
+// object written by ref
+type fbField struct {
+	scalar []byte
+	ref    func(b *fbBuilder) int
+}
+
+func fbAbsent() fbField {
+	return fbField{}
+}
+
+func fbBool(v bool) fbField {
+	if v {
+		return fbUint8(1)
+	}
+	return fbUint8(0)
+}
+
+func fbUint8(v uint8) fbField {
+	return fbField{scalar: []byte{v}}
+}
+
+func fbInt16(v int16) fbField {
+	return fbField{scalar: binary.LittleEndian.AppendUint16(nil, uint16(v))}
+}
+
+func fbInt32(v int32) fbField {
+	return fbField{scalar: binary.LittleEndian.AppendUint32(nil, uint32(v))}
+}
+
+func fbInt64(v int64) fbField {
+	return fbField{scalar: binary.LittleEndian.AppendUint64(nil, uint64(v))}
+}
+
+func fbRef(ref func(b *fbBuilder) int) fbField {
+	return fbField{ref: ref}
+}
+
+// root writes the root table of the buffer
+func (b *fbBuilder) root(table func(b *fbBuilder) int) {
+	b.buf = append(b.buf, 0, 0, 0, 0)
+	b.patch(0, table(b))
+}
+
+// table writes a table and returns its position
+func (b *fbBuilder) table(fields ...fbField) int {
+	// lay out the fields after the offset to the vtable, each aligned to its
+	// size, which keeps them aligned in the buffer as the table is 8 aligned
+	inline := 4
+	offsets := make([]int, len(fields))
+	for i, f := range fields {
+		size := len(f.scalar)
+		if f.ref != nil {
+			size = 4
+		}
+		if size == 0 {
+			continue
+		}
+		inline += (size - inline%size) % size
+		offsets[i] = inline
+		inline += size
+	}
+
+	vtableSize := 4 + 2*len(fields)
+	b.align(8, vtableSize)
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(vtableSize))
+	b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(inline))
+	for _, v := range offsets {
+		b.buf = binary.LittleEndian.AppendUint16(b.buf, uint16(v))
+	}
+
+	pos := len(b.buf)
+	b.buf = append(b.buf, make([]byte, inline)...)
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(vtableSize))
+	for i, f := range fields {
+		copy(b.buf[pos+offsets[i]:], f.scalar)
+	}
+	for i, f := range fields {
+		if f.ref != nil {
+			b.patch(pos+offsets[i], f.ref(b))
+		}
+	}
+	return pos
+}
+
+// tableVector writes a vector of tables and returns its position
+func (b *fbBuilder) tableVector(tables []func(b *fbBuilder) int) int {
+	b.align(4, 0)
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(tables)))
+	b.buf = append(b.buf, make([]byte, 4*len(tables))...)
+	for i, v := range tables {
+		b.patch(pos+4+4*i, v(b))
+	}
+	return pos
+}
+
+// structVector writes a vector of structs of 16 bytes, the FieldNode and
+// Buffer structs of a record batch, 8 aligned
+func (b *fbBuilder) structVector(raw []byte) int {
+	b.align(8, 4)
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(raw)/16))
+	b.buf = append(b.buf, raw...)
+	return pos
+}
+
+func (b *fbBuilder) string(s string) int {
+	b.align(4, 0)
+	pos := len(b.buf)
+	b.buf = binary.LittleEndian.AppendUint32(b.buf, uint32(len(s)))
+	b.buf = append(b.buf, s...)
+	b.buf = append(b.buf, 0)
+	return pos
+}
+
+// align pads the buffer so the object written after the next prefix bytes
+// is aligned
+func (b *fbBuilder) align(alignment int, prefix int) {
+	for (len(b.buf)+prefix)%alignment != 0 {
+		b.buf = append(b.buf, 0)
+	}
+}
+
+// patch sets the offset at pos to point at target
+func (b *fbBuilder) patch(pos int, target int) {
+	binary.LittleEndian.PutUint32(b.buf[pos:], uint32(target-pos))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type BenchTask struct {
+	out    io.Writer
+	params struct {
+		dataDir     string
+		files       int
+		concurrency int
+	}
+}
+
+type benchResult struct {
+	stage    string
+	events   uint64
+	bytes    uint64
+	duration time.Duration
+}
+
+func (r benchResult) eventsPerSecond() float64 {
+	return float64(r.events) / r.duration.Seconds()
+}
+
+func NewBenchTask() *BenchTask {
+	return &BenchTask{out: os.Stdout}
+}
+
+func (o *BenchTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir containing the reference archive files")
+	cmd.Flags().IntVarP(&o.params.files, "files", "n", 1, "How many archive files from the data dir to benchmark with. Use the same number when comparing scores")
+	cmd.Flags().IntVarP(&o.params.concurrency, "concurrency", "c", 10, "The concurrency to run reduce with")
+}
+
+func (o *BenchTask) GetMeta() Meta {
+	return Meta{
+		Name:        "BenchTask",
+		Use:         "bench",
+		Description: "Measure the throughput of reading, parsing, reducing and replaying local archive files on this machine and print a comparable score.",
+	}
+}
+
+func (o *BenchTask) Execute(ctx context.Context) error {
+	if o.params.files < 1 {
+		return errors.New("files must be at least 1")
+	}
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no archive files found in %s", o.params.dataDir)
+	}
+	if len(files) > o.params.files {
+		files = files[:o.params.files]
+	}
+
+	// reduce and simulate write interim files next to the archives so work on a copy
+	workDir, err := os.MkdirTemp("", "ss-cli-bench-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(workDir)
+	dataDir := filepath.Join(workDir, "data")
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return err
+	}
+	for _, v := range files {
+		if err := linkOrCopy(filepath.Join(o.params.dataDir, v), filepath.Join(dataDir, v)); err != nil {
+			return err
+		}
+	}
+
+	stages := []func(context.Context, string, []string) (benchResult, error){
+		o.benchRead,
+		o.benchParse,
+		o.benchReduce,
+		o.benchReplay,
+	}
+	results := []benchResult{}
+	for _, stage := range stages {
+		result, err := stage(ctx, dataDir, files)
+		if err != nil {
+			return errors.Wrapf(err, "bench %s", result.stage)
+		}
+		logrus.Infof("bench %s finished in %s", result.stage, result.duration)
+		results = append(results, result)
+	}
+
+	// score is the geometric mean of each stage's throughput in thousands of events per second
+	logSum := 0.0
+	fmt.Fprintf(o.out, "%-8s %12s %14s %10s\n", "stage", "events", "events/s", "MB/s")
+	for _, v := range results {
+		mbs := float64(v.bytes) / 1000000 / v.duration.Seconds()
+		fmt.Fprintf(o.out, "%-8s %12d %14.0f %10.2f\n", v.stage, v.events, v.eventsPerSecond(), mbs)
+		logSum += math.Log(v.eventsPerSecond() / 1000)
+	}
+	fmt.Fprintf(o.out, "files: %d, cpus: %d, go: %s\n", len(files), runtime.NumCPU(), runtime.Version())
+	fmt.Fprintf(o.out, "score: %.1f\n", math.Exp(logSum/float64(len(results))))
+	return nil
+}
+
+func (o *BenchTask) benchRead(ctx context.Context, dataDir string, files []string) (benchResult, error) {
+	result := benchResult{stage: "read"}
+	start := time.Now()
+	for _, v := range files {
+		err := readArchiveRows(filepath.Join(dataDir, v), func(row []byte) error {
+			result.events++
+			result.bytes += uint64(len(row))
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	result.duration = time.Since(start)
+	return result, nil
+}
+
+func (o *BenchTask) benchParse(ctx context.Context, dataDir string, files []string) (benchResult, error) {
+	result := benchResult{stage: "parse"}
+	start := time.Now()
+	for _, v := range files {
+		err := readArchiveRows(filepath.Join(dataDir, v), func(row []byte) error {
+			event := EventRow{}
+			if err := unmarshalEvent(row, &event); err != nil {
+				return err
+			}
+			result.events++
+			result.bytes += uint64(len(row))
+			return nil
+		})
+		if err != nil {
+			return result, err
+		}
+	}
+	result.duration = time.Since(start)
+	return result, nil
+}
+
+func (o *BenchTask) benchReduce(ctx context.Context, dataDir string, files []string) (benchResult, error) {
+	// reuse the read stage counts as reduce processes every row
+	result, err := o.benchRead(ctx, dataDir, files)
+	result.stage = "reduce"
+	if err != nil {
+		return result, err
+	}
+
+	reduce := NewReduceTask()
+	reduce.params.dataInDir = dataDir
+	reduce.params.dataOutDir = filepath.Join(filepath.Dir(dataDir), "reduced")
+	reduce.params.concurrency = o.params.concurrency
+	reduce.params.mintSuffixes = "pump"
+	start := time.Now()
+	// every row is still filtered when none match, e.g. data without Pump.fun
+	if err := reduce.Execute(ctx); err != nil && !errors.Is(err, ErrNoRows) {
+		return result, err
+	}
+	result.duration = time.Since(start)
+	return result, nil
+}
+
+func (o *BenchTask) benchReplay(ctx context.Context, dataDir string, files []string) (benchResult, error) {
+	result := benchResult{stage: "replay"}
+	simulate := NewSimulateTask()
+	simulate.params.dataDir = dataDir
+	for _, feed := range simulatorFeeds {
+		simulate.subscribe(feed.SubscribeMethod())
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for v := range simulate.outputFeed {
+			result.events++
+			result.bytes += uint64(len(v.Params))
+		}
+	}()
+	start := time.Now()
+	err := simulate.RunSimulation(ctx, 0)
+	close(simulate.outputFeed)
+	<-drained
+	result.duration = time.Since(start)
+	return result, err
+}
+
+// linkOrCopy hard links src to dst, falling back to a copy across filesystems
+func linkOrCopy(src, dst string) error {
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestBench(t *testing.T) {
+	dataDir := copyFixtures(t)
+	files, err := listArchiveFiles(dataDir)
+	assert.Nil(t, err)
+	before, err := os.ReadDir(dataDir)
+	assert.Nil(t, err)
+	rows := uint64(0)
+	for _, v := range files[:2] {
+		assert.Nil(t, readArchiveRows(filepath.Join(dataDir, v), func(row []byte) error {
+			rows++
+			return nil
+		}))
+	}
+
+	out := &bytes.Buffer{}
+	task := NewBenchTask()
+	task.out = out
+	task.params.dataDir = dataDir
+	task.params.files = 2
+	task.params.concurrency = 2
+	assert.Nil(t, task.Execute(context.Background()))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 7)
+	assert.Equal(t, []string{"stage", "events", "events/s", "MB/s"}, strings.Fields(lines[0]))
+	events := map[string]uint64{}
+	for i, stage := range []string{"read", "parse", "reduce", "replay"} {
+		fields := strings.Fields(lines[i+1])
+		if !assert.Len(t, fields, 4, lines[i+1]) {
+			continue
+		}
+		assert.Equal(t, stage, fields[0])
+		events[stage], err = strconv.ParseUint(fields[1], 10, 64)
+		assert.Nil(t, err, lines[i+1])
+		perSecond, err := strconv.ParseFloat(fields[2], 64)
+		assert.Nil(t, err, lines[i+1])
+		assert.True(t, perSecond > 0, lines[i+1])
+	}
+	// every stage but replay handles every row of the files benchmarked
+	assert.Equal(t, rows, events["read"])
+	assert.Equal(t, rows, events["parse"])
+	assert.Equal(t, rows, events["reduce"])
+	assert.True(t, events["replay"] > 0)
+	assert.True(t, strings.HasPrefix(lines[5], "files: 2, cpus: "), lines[5])
+	assert.True(t, strings.HasPrefix(lines[6], "score: "), lines[6])
+	score, err := strconv.ParseFloat(strings.TrimPrefix(lines[6], "score: "), 64)
+	assert.Nil(t, err)
+	assert.True(t, score > 0)
+
+	// the archives are benchmarked from a copy, so nothing is left next to them
+	after, err := os.ReadDir(dataDir)
+	assert.Nil(t, err)
+	assert.Equal(t, len(before), len(after))
+
+	task.params.files = 0
+	assert.NotNil(t, task.Execute(context.Background()))
+	task.params.files = 1
+	task.params.dataDir = t.TempDir()
+	assert.NotNil(t, task.Execute(context.Background()))
+
+	// data without any Pump.fun mints for the reduce stage to keep
+	task.params.dataDir = t.TempDir()
+	writeTestArchive(t, task.params.dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"blockTime":1714910400,"swap":{"baseTokenMint":"` + fixtureKey("mint", "") + `"}}` + "\n",
+	})
+	out.Reset()
+	assert.Nil(t, task.Execute(context.Background()))
+	assert.True(t, strings.Contains(out.String(), "score: "), out.String())
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const defaultLiveURL = "wss://api.solanastreaming.com"
+
+// how long to wait for the live server to confirm the subscriptions
+const liveSubscribeTimeout = 30 * time.Second
+
+// clientSubscription is a subscription a client made to the simulator, kept
+// so it can be made again on the live feed in catch up mode
+type clientSubscription struct {
+	Method         string
+	Params         json.RawMessage
+	SubscriptionID uint
+}
+
+// liveSession is the production websocket a client is switched to once the
+// archive replay has finished
+type liveSession struct {
+	conn *websocket.Conn
+	// subscription id on the live server -> id the simulator gave the client
+	subIDs map[uint]uint
+	// notifications received while subscribing
+	pending [][]byte
+}
+
+// dialLive connects to the live websocket feed
+func dialLive(ctx context.Context, options *httpOptions, url string, apiKey string) (*websocket.Conn, error) {
+	dialer, err := options.NewWebsocketDialer()
+	if err != nil {
+		return nil, err
+	}
+	header := http.Header{}
+	header.Set("X-API-KEY", apiKey)
+	header.Set("User-Agent", userAgent())
+	conn, _, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "cant connect to live feed")
+	}
+	return conn, nil
+}
+
+// connectLive dials the live feed and repeats the client's subscriptions
+func (o *SimulateTask) connectLive(ctx context.Context, subscriptions []clientSubscription) (*liveSession, error) {
+	conn, err := dialLive(ctx, &o.http, o.params.liveURL, o.params.apiKey)
+	if err != nil {
+		return nil, err
+	}
+	session := &liveSession{
+		conn:   conn,
+		subIDs: map[uint]uint{},
+	}
+	if err := session.subscribe(subscriptions); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return session, nil
+}
+
+func (o *liveSession) subscribe(subscriptions []clientSubscription) error {
+	// our own request ids so responses can be matched to subscriptions
+	for i, v := range subscriptions {
+		raw, err := json.Marshal(map[string]any{
+			"id":     i + 1,
+			"method": v.Method,
+			"params": v.Params,
+		})
+		if err != nil {
+			return err
+		}
+		if err := o.conn.WriteMessage(websocket.TextMessage, raw); err != nil {
+			return errors.Wrap(err, "cant subscribe to live feed")
+		}
+	}
+	o.conn.SetReadDeadline(time.Now().Add(liveSubscribeTimeout))
+	defer o.conn.SetReadDeadline(time.Time{})
+	for confirmed := 0; confirmed < len(subscriptions); {
+		_, raw, err := o.conn.ReadMessage()
+		if err != nil {
+			return errors.Wrap(err, "cant subscribe to live feed")
+		}
+		response := struct {
+			ID     int `json:"id"`
+			Result *struct {
+				SubscriptionID uint `json:"subscription_id"`
+			} `json:"result"`
+			Error json.RawMessage `json:"error"`
+		}{}
+		if err := json.Unmarshal(raw, &response); err != nil {
+			return errors.Wrap(err, "cant unmarshal live message")
+		}
+		if response.ID < 1 || response.ID > len(subscriptions) {
+			o.pending = append(o.pending, raw)
+			continue
+		}
+		sub := subscriptions[response.ID-1]
+		if response.Error != nil || response.Result == nil {
+			return fmt.Errorf("live feed rejected %s: %s", sub.Method, string(response.Error))
+		}
+		o.subIDs[response.Result.SubscriptionID] = sub.SubscriptionID
+		confirmed++
+	}
+	return nil
+}
+
+// Forward sends live messages to out with subscription ids rewritten to the
+// ones the client already has. out is closed when the live connection ends.
+func (o *liveSession) Forward(out chan<- []byte) {
+	defer close(out)
+	for _, v := range o.pending {
+		out <- o.rewrite(v)
+	}
+	o.pending = nil
+	for {
+		_, raw, err := o.conn.ReadMessage()
+		if err != nil {
+			logrus.Errorf("live read: %s", err.Error())
+			return
+		}
+		out <- o.rewrite(raw)
+	}
+}
+
+func (o *liveSession) rewrite(raw []byte) []byte {
+	fields := struct {
+		SubscriptionID *uint `json:"subscription_id"`
+	}{}
+	if err := json.Unmarshal(raw, &fields); err != nil || fields.SubscriptionID == nil {
+		return raw
+	}
+	clientID, ok := o.subIDs[*fields.SubscriptionID]
+	if !ok {
+		return raw
+	}
+	// the rest of the message is forwarded as the live feed framed it
+	rewritten, ok := setJSONField(raw, "subscription_id", []byte(strconv.FormatUint(uint64(clientID), 10)))
+	if !ok {
+		return raw
+	}
+	return rewritten
+}
+
+func (o *liveSession) Close() error {
+	return o.conn.Close()
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type CoTradingTask struct {
+	// recent swaps per mint within the slot window
+	windows map[string][]windowTrade
+	// distinct mints traded per wallet
+	walletMints map[walletMint]struct{}
+	mintCounts  map[string]uint
+	// distinct mints co-traded per wallet pair
+	pairMints map[walletPairMint]struct{}
+	pairs     map[walletPair]*walletPairStats
+	params    struct {
+		dataDir         string
+		windowSlots     uint64
+		minSharedMints  uint
+		minScore        float64
+		maxWindowTrades int
+		format          string
+		output          string
+	}
+}
+
+type windowTrade struct {
+	slot   uint64
+	wallet string
+}
+
+type walletMint struct {
+	wallet string
+	mint   string
+}
+
+// walletPair is always stored with a < b so each pair has a single key
+type walletPair struct {
+	a string
+	b string
+}
+
+type walletPairMint struct {
+	pair walletPair
+	mint string
+}
+
+type walletPairStats struct {
+	coTrades    uint
+	sharedMints uint
+}
+
+func NewCoTradingTask() *CoTradingTask {
+	return &CoTradingTask{
+		windows:     map[string][]windowTrade{},
+		walletMints: map[walletMint]struct{}{},
+		mintCounts:  map[string]uint{},
+		pairMints:   map[walletPairMint]struct{}{},
+		pairs:       map[walletPair]*walletPairStats{},
+	}
+}
+
+func (o *CoTradingTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir to get the archive data from")
+	cmd.Flags().Uint64VarP(&o.params.windowSlots, "window-slots", "n", 2, "Swaps on the same mint within this many slots of each other count as co-trades")
+	cmd.Flags().UintVar(&o.params.minSharedMints, "min-shared-mints", 3, "Minimum number of distinct mints a wallet pair must have co-traded to be reported")
+	cmd.Flags().Float64Var(&o.params.minScore, "min-score", 0.5, "Minimum pair score (shared mints / mints traded by the less active wallet) to be reported")
+	cmd.Flags().IntVar(&o.params.maxWindowTrades, "max-window-trades", 50, "Ignore mints with more swaps than this inside one window. Very busy mints make every wallet look related")
+	cmd.Flags().StringVarP(&o.params.format, "format", "f", ReportFormatCSV, "Output format: csv, json or arrow")
+	cmd.Flags().StringVarP(&o.params.output, "output", "o", "", "File to write the report to. Defaults to stdout")
+}
+
+func (o *CoTradingTask) GetMeta() Meta {
+	return Meta{
+		Name:        "CoTradingTask",
+		Use:         "cotrading",
+		Description: "Find wallets that frequently trade the same mints within a few slots of each other and report them as cluster candidates with scores.",
+	}
+}
+
+func (o *CoTradingTask) Execute(ctx context.Context) error {
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+
+	rows := 0
+	for i, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logrus.Infof("scanning file (%d of %d) %s", i+1, len(files), v)
+		err := readArchiveEvents(o.params.dataDir+"/"+v, []byte(`"swap"`), func(event EventRow) error {
+			if event.Swap == nil || event.Swap.WalletAccount == "" {
+				return nil
+			}
+			o.add(event.Slot, event.Swap.BaseTokenMint, event.Swap.WalletAccount)
+			rows++
+			if rows%100000 == 0 {
+				o.pruneWindows(event.Slot)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return o.writeReport()
+}
+
+func (o *CoTradingTask) add(slot uint64, mint string, wallet string) {
+	key := walletMint{wallet: wallet, mint: mint}
+	if _, ok := o.walletMints[key]; !ok {
+		o.walletMints[key] = struct{}{}
+		o.mintCounts[wallet]++
+	}
+
+	// drop trades that have fallen out of the window
+	window := o.windows[mint]
+	start := 0
+	for start < len(window) && window[start].slot+o.params.windowSlots < slot {
+		start++
+	}
+	window = window[start:]
+
+	if len(window) < o.params.maxWindowTrades {
+		for _, v := range window {
+			if v.wallet == wallet {
+				continue
+			}
+			pair := walletPair{a: v.wallet, b: wallet}
+			if pair.b < pair.a {
+				pair.a, pair.b = pair.b, pair.a
+			}
+			stats, ok := o.pairs[pair]
+			if !ok {
+				stats = &walletPairStats{}
+				o.pairs[pair] = stats
+			}
+			stats.coTrades++
+			pairMint := walletPairMint{pair: pair, mint: mint}
+			if _, ok := o.pairMints[pairMint]; !ok {
+				o.pairMints[pairMint] = struct{}{}
+				stats.sharedMints++
+			}
+		}
+	}
+	o.windows[mint] = append(window, windowTrade{slot: slot, wallet: wallet})
+}
+
+// pruneWindows forgets mints that have not traded within the window to keep
+// memory bounded to the currently active mints
+func (o *CoTradingTask) pruneWindows(slot uint64) {
+	for mint, window := range o.windows {
+		if len(window) == 0 || window[len(window)-1].slot+o.params.windowSlots < slot {
+			delete(o.windows, mint)
+		}
+	}
+}
+
+// score is the overlap coefficient of the two wallets' traded mints
+func (o *CoTradingTask) score(pair walletPair, stats *walletPairStats) float64 {
+	least := min(o.mintCounts[pair.a], o.mintCounts[pair.b])
+	if least == 0 {
+		return 0
+	}
+	return float64(stats.sharedMints) / float64(least)
+}
+
+type walletCluster struct {
+	wallets        []string
+	pairs          uint
+	coTrades       uint
+	maxSharedMints uint
+	totalScore     float64
+}
+
+func (o *CoTradingTask) writeReport() error {
+	// union find over the qualifying pairs to group them into clusters
+	parent := map[string]string{}
+	var find func(string) string
+	find = func(v string) string {
+		if parent[v] == v {
+			return v
+		}
+		parent[v] = find(parent[v])
+		return parent[v]
+	}
+	qualifying := []walletPair{}
+	for pair, stats := range o.pairs {
+		if stats.sharedMints < o.params.minSharedMints || o.score(pair, stats) < o.params.minScore {
+			continue
+		}
+		qualifying = append(qualifying, pair)
+		for _, v := range []string{pair.a, pair.b} {
+			if _, ok := parent[v]; !ok {
+				parent[v] = v
+			}
+		}
+		parent[find(pair.a)] = find(pair.b)
+	}
+
+	clusters := map[string]*walletCluster{}
+	for wallet := range parent {
+		root := find(wallet)
+		if _, ok := clusters[root]; !ok {
+			clusters[root] = &walletCluster{}
+		}
+		clusters[root].wallets = append(clusters[root].wallets, wallet)
+	}
+	for _, pair := range qualifying {
+		stats := o.pairs[pair]
+		cluster := clusters[find(pair.a)]
+		cluster.pairs++
+		cluster.coTrades += stats.coTrades
+		cluster.maxSharedMints = max(cluster.maxSharedMints, stats.sharedMints)
+		cluster.totalScore += o.score(pair, stats)
+	}
+
+	sorted := []*walletCluster{}
+	for _, v := range clusters {
+		sort.Strings(v.wallets)
+		sorted = append(sorted, v)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		si, sj := sorted[i].totalScore/float64(sorted[i].pairs), sorted[j].totalScore/float64(sorted[j].pairs)
+		if si != sj {
+			return si > sj
+		}
+		return sorted[i].wallets[0] < sorted[j].wallets[0]
+	})
+
+	out, err := openOutput(o.params.output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w, err := newRecordWriter(out, o.params.format, []string{"cluster", "score", "wallets", "size", "pairs", "co_trades", "max_shared_mints"})
+	if err != nil {
+		return err
+	}
+	for i, v := range sorted {
+		err := w.Write(i+1, v.totalScore/float64(v.pairs), strings.Join(v.wallets, " "), len(v.wallets), v.pairs, v.coTrades, v.maxSharedMints)
+		if err != nil {
+			return err
+		}
+	}
+	logrus.Infof("found %d cluster candidates from %d wallet pairs", len(sorted), len(qualifying))
+	return w.Flush()
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestCoTradingPairs(t *testing.T) {
+	task := NewCoTradingTask()
+	task.params.windowSlots = 2
+	task.params.maxWindowTrades = 50
+
+	// a and b trade 3 mints together, c trades the first mint too late
+	for i, mint := range []string{"mint1", "mint2", "mint3"} {
+		slot := uint64(i * 100)
+		task.add(slot, mint, "a")
+		task.add(slot+1, mint, "b")
+	}
+	task.add(10, "mint1", "c")
+
+	stats := task.pairs[walletPair{a: "a", b: "b"}]
+	assert.NotNil(t, stats)
+	assert.Equal(t, uint(3), stats.sharedMints)
+	assert.Equal(t, 1.0, task.score(walletPair{a: "a", b: "b"}, stats))
+	assert.Nil(t, task.pairs[walletPair{a: "a", b: "c"}])
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// Orders can be split into a file series per dataset, named with the dataset
+// before the extension e.g. 20240505-120000.swaps.zip. Files without a
+// dataset in their name have the events of every dataset.
+const (
+	DatasetSwaps = "swaps"
+	DatasetPairs = "pairs"
+)
+
+// datasetFeeds are the subscribe methods of the events in each dataset
+var datasetFeeds = map[string][]string{
+	DatasetSwaps: {MethodSwapSubscribe},
+	DatasetPairs: {MethodNewPairSubscribe, MethodPairLiquidityUpdatesSubscribe},
+}
+
+// splitDataset returns an archive file name without its dataset, and the
+// dataset e.g. "20240505-120000.swaps.zip" is "20240505-120000.zip" and
+// "swaps". The dataset is empty for files with every dataset.
+func splitDataset(name string) (string, string) {
+	for dataset := range datasetFeeds {
+		qualifier := "." + dataset + ".zip"
+		if strings.HasSuffix(name, qualifier) {
+			return strings.TrimSuffix(name, qualifier) + ".zip", dataset
+		}
+	}
+	return name, ""
+}
+
+// orderArchiveFiles returns the names, without .zip, of the files of an order
+// covering from to to. Split orders have a file per hour for each dataset.
+func orderArchiveFiles(from, to time.Time, datasets []string) []string {
+	hours := generateListOfArchiveFiles(from, to)
+	if len(datasets) == 0 {
+		return hours
+	}
+	files := []string{}
+	for _, hour := range hours {
+		for _, dataset := range datasets {
+			files = append(files, hour+"."+dataset)
+		}
+	}
+	return files
+}
+
+// datasetOptions selects the datasets of split orders with --datasets
+type datasetOptions struct {
+	list     string
+	datasets []string
+}
+
+func (o *datasetOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.list, "datasets", "", "Only use these datasets of orders split into a file series per dataset: swaps, pairs. Files with every dataset are always used. (Comma separated list)")
+}
+
+// Parse validates --datasets
+func (o *datasetOptions) Parse() error {
+	o.datasets = splitList(o.list)
+	for _, v := range o.datasets {
+		if _, ok := datasetFeeds[v]; !ok {
+			return fmt.Errorf("unknown dataset %q, must be one of: %s, %s", v, DatasetSwaps, DatasetPairs)
+		}
+	}
+	return nil
+}
+
+// Selected returns true if the dataset is selected. Every dataset is selected
+// when none are given.
+func (o *datasetOptions) Selected(dataset string) bool {
+	return dataset == "" || len(o.datasets) == 0 || slices.Contains(o.datasets, dataset)
+}
+
+// Select drops the archive files of datasets which are not selected
+func (o *datasetOptions) Select(files []string) []string {
+	selected := []string{}
+	for _, v := range files {
+		if _, dataset := splitDataset(v); o.Selected(dataset) {
+			selected = append(selected, v)
+		}
+	}
+	return selected
+}
+
+// groupArchiveHours groups consecutive files for the same hour, e.g. the
+// swaps and pairs files of a split order, so they can be replayed together
+func groupArchiveHours(files []string) [][]string {
+	groups := [][]string{}
+	for i, v := range files {
+		if i > 0 {
+			prev, _ := splitDataset(files[i-1])
+			base, _ := splitDataset(v)
+			if base == prev {
+				groups[len(groups)-1] = append(groups[len(groups)-1], v)
+				continue
+			}
+		}
+		groups = append(groups, []string{v})
+	}
+	return groups
+}
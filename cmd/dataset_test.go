@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestSplitDataset(t *testing.T) {
+	name, dataset := splitDataset("20240505-120000.swaps.zip")
+	assert.Equal(t, "20240505-120000.zip", name)
+	assert.Equal(t, DatasetSwaps, dataset)
+	name, dataset = splitDataset("20240505-120000.zip")
+	assert.Equal(t, "20240505-120000.zip", name)
+	assert.Equal(t, "", dataset)
+
+	hour, ok := archiveFileTime("20240505-120000.pairs.zip")
+	assert.True(t, ok)
+	assert.Equal(t, 12, hour.Hour())
+	assert.Equal(t, "20240505-120000.pairs", apiFileName("20240505-120000.pairs.zip"))
+
+	groups := groupArchiveHours([]string{"20240505-120000.pairs.zip", "20240505-120000.swaps.zip", "20240505-130000.zip"})
+	assert.Equal(t, [][]string{{"20240505-120000.pairs.zip", "20240505-120000.swaps.zip"}, {"20240505-130000.zip"}}, groups)
+
+	selection := datasetOptions{list: "swaps"}
+	assert.Nil(t, selection.Parse())
+	assert.Equal(t, []string{"20240505-120000.swaps.zip", "20240505-130000.zip"}, selection.Select([]string{"20240505-120000.pairs.zip", "20240505-120000.swaps.zip", "20240505-130000.zip"}))
+	assert.NotNil(t, (&datasetOptions{list: "trades"}).Parse())
+
+	assert.True(t, distinctDatasets([]string{"20240505-120000.pairs.zip", "20240505-120000.swaps.zip"}))
+	assert.False(t, distinctDatasets([]string{"20240505-120000.zip", "20240505-120000.swaps.zip"}))
+}
+
+func TestDownloadSplitOrder(t *testing.T) {
+	apiDir := t.TempDir()
+	for _, hour := range []string{"20240505-120000", "20240505-130000"} {
+		writeTestArchive(t, apiDir+"/"+hour+".swaps.zip", map[string]string{"swaps.json": "{\"slot\":1,\"swap\":{}}\n"})
+		writeTestArchive(t, apiDir+"/"+hour+".pairs.zip", map[string]string{"pairs.json": "{\"slot\":1,\"pair\":{}}\n"})
+	}
+	server := httptest.NewServer(NewMockAPI(apiDir))
+	defer server.Close()
+
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	task.datasets.list = "swaps"
+	assert.Nil(t, task.Execute(context.Background()))
+	files, err := listArchiveFiles(task.params.outputDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20240505-120000.swaps.zip", "20240505-130000.swaps.zip"}, files)
+
+	// the other dataset is downloaded next to it
+	task.datasets.list = ""
+	assert.Nil(t, task.Execute(context.Background()))
+	files, err = listArchiveFiles(task.params.outputDir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 4)
+}
+
+func TestSimulateSplitDatasets(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.swaps.zip", map[string]string{"swaps.json": "{\"slot\":1,\"swap\":{}}\n{\"slot\":3,\"swap\":{}}\n"})
+	writeTestArchive(t, dataDir+"/20240505-120000.pairs.zip", map[string]string{"pairs.json": "{\"slot\":2,\"pair\":{}}\n"})
+	run := func(methods ...string) []string {
+		st := NewSimulateTask()
+		st.params.dataDir = dataDir
+		for _, v := range methods {
+			st.subscribe(v)
+		}
+		events := []string{}
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			for v := range st.outputFeed {
+				events = append(events, string(v.Params))
+			}
+		}()
+		assert.Nil(t, st.RunSimulation(context.Background(), 1))
+		close(st.outputFeed)
+		<-drained
+		return events
+	}
+	// the datasets of an hour are merged in slot order
+	assert.Equal(t, []string{`{"slot":1,"swap":{}}`, `{"slot":2,"pair":{}}`, `{"slot":3,"swap":{}}`}, run(MethodSwapSubscribe, MethodNewPairSubscribe))
+	assert.Equal(t, []string{`{"slot":2,"pair":{}}`}, run(MethodNewPairSubscribe))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var ErrLocked = errors.New("dir is in use by another run")
+
+// dirLockFileName is created in a dir while a command is writing to it, so
+// two runs on the same dir do not remove or overwrite each other's files
+const dirLockFileName = ".ss-cli.lock"
+
+// DirLock is the content of a lock file, describing the run holding it
+type DirLock struct {
+	// tells apart runs which share a pid and host, e.g. in containers
+	InstanceID string    `json:"instanceId,omitempty"`
+	PID        int       `json:"pid"`
+	Hostname   string    `json:"hostname"`
+	Command    string    `json:"command"`
+	StartedAt  time.Time `json:"startedAt"`
+}
+
+func (o DirLock) String() string {
+	return fmt.Sprintf("%s (pid %d on %s, started %s)", o.Command, o.PID, o.Hostname, o.StartedAt.Local().Format(time.RFC3339))
+}
+
+// dirLockOptions locks the dirs a command writes to, with --force to take
+// over a lock
+type dirLockOptions struct {
+	force bool
+}
+
+func (o *dirLockOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&o.force, "force", false, "Run even if another run is using the same dir. Only use this if you are sure the other run has stopped")
+}
+
+// Lock takes the lock of dir for command and returns the func to release it.
+// Locks left behind by runs on this machine which are no longer running are
+// taken over.
+func (o *dirLockOptions) Lock(dir string, command string) (func(), error) {
+	if dir == pipeName {
+		return func() {}, nil
+	}
+	lock := newDirLock(command)
+	err := takeDirLock(dir, lock, func(held DirLock) error {
+		if !o.force {
+			return withKind(ErrLocked, fmt.Errorf("%s is in use by %s. Wait for it to finish, or pass --force if it has stopped", dir, held))
+		}
+		logrus.Warnf("%s is in use by %s, running anyway as --force is set", dir, held)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, dirLockFileName)
+	return func() { releaseDirLock(path, lock) }, nil
+}
+
+func newDirLock(command string) DirLock {
+	hostname, _ := os.Hostname()
+	return DirLock{InstanceID: newRequestID(), PID: os.Getpid(), Hostname: hostname, Command: command, StartedAt: time.Now().UTC()}
+}
+
+// takeDirLock creates the lock file of dir. A lock held by a run which may
+// still be running is passed to takeOver, which returns an error to leave it.
+func takeDirLock(dir string, lock DirLock, takeOver func(held DirLock) error) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	raw, err := json.Marshal(lock)
+	if err != nil {
+		return err
+	}
+	// the lock is written to a temp file and linked into place, so other runs
+	// never see it half written
+	tmp, err := os.CreateTemp(dir, dirLockFileName+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(raw)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(dir, dirLockFileName)
+	for {
+		err := os.Link(tmp.Name(), path)
+		if err == nil {
+			return nil
+		}
+		if !os.IsExist(err) {
+			return err
+		}
+
+		held, err := readDirLock(path)
+		switch {
+		case os.IsNotExist(err):
+			// released since
+			continue
+		case err != nil:
+			// locks are written whole, so this one is corrupt
+			logrus.Warnf("removing unreadable lock %s: %s", path, err)
+		case held.Hostname == lock.Hostname && !processAlive(held.PID):
+			logrus.Warnf("removing stale lock on %s left by %s which is no longer running", dir, held)
+		default:
+			if err := takeOver(held); err != nil {
+				return err
+			}
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+}
+
+func readDirLock(path string) (DirLock, error) {
+	lock := DirLock{}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return lock, err
+	}
+	return lock, json.Unmarshal(raw, &lock)
+}
+
+// releaseDirLock removes the lock unless another run has taken it over with
+// --force or --takeover since
+func releaseDirLock(path string, lock DirLock) {
+	held, err := readDirLock(path)
+	if err != nil || held.InstanceID != lock.InstanceID {
+		return
+	}
+	if err := os.Remove(path); err != nil {
+		logrus.Warnf("could not remove lock %s: %s", path, err)
+	}
+}
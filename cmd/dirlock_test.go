@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/test-go/testify/assert"
+)
+
+func TestDirLock(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, dirLockFileName)
+	lock := dirLockOptions{}
+
+	unlock, err := lock.Lock(dir, "reduce")
+	assert.Nil(t, err)
+	held, err := readDirLock(path)
+	assert.Nil(t, err)
+	assert.Equal(t, os.Getpid(), held.PID)
+	assert.Equal(t, "reduce", held.Command)
+
+	// held by a running process
+	_, err = lock.Lock(dir, "simulate")
+	assert.True(t, errors.Is(err, ErrLocked))
+	assert.Equal(t, ExitLocked, classifyError(err).Code)
+	unlock()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+
+	// left behind by a process which is no longer running
+	hostname, _ := os.Hostname()
+	writeLock := func(v DirLock) {
+		raw, err := json.Marshal(v)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(path, raw, 0644))
+	}
+	writeLock(DirLock{PID: 1 << 30, Hostname: hostname, Command: "download", StartedAt: time.Now()})
+	unlock, err = lock.Lock(dir, "simulate")
+	assert.Nil(t, err)
+	unlock()
+
+	// running elsewhere can not be checked
+	writeLock(DirLock{PID: 1 << 30, Hostname: hostname + "-other", Command: "download", StartedAt: time.Now()})
+	_, err = lock.Lock(dir, "simulate")
+	assert.True(t, errors.Is(err, ErrLocked))
+
+	lock.force = true
+	unlock, err = lock.Lock(dir, "simulate")
+	assert.Nil(t, err)
+	// the forced lock is not removed by the run it took over from
+	releaseDirLock(path, DirLock{PID: 1 << 30, StartedAt: time.Now()})
+	_, err = os.Stat(path)
+	assert.Nil(t, err)
+	unlock()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDirLockConcurrent(t *testing.T) {
+	const runs = 8
+	for i := 0; i < 200; i++ {
+		dir := t.TempDir()
+		errs := make(chan error, runs)
+		for j := 0; j < runs; j++ {
+			go func() {
+				errs <- takeDirLock(dir, newDirLock("reduce"), func(held DirLock) error {
+					return withKind(ErrLocked, errors.Errorf("in use by %s", held))
+				})
+			}()
+		}
+		locked := 0
+		for j := 0; j < runs; j++ {
+			if err := <-errs; err != nil {
+				assert.True(t, errors.Is(err, ErrLocked), err)
+				locked++
+			}
+		}
+		// exactly one run gets the lock, and it is never seen half written
+		assert.Equal(t, runs-1, locked)
+		_, err := readDirLock(filepath.Join(dir, dirLockFileName))
+		assert.Nil(t, err)
+		entries, err := os.ReadDir(dir)
+		assert.Nil(t, err)
+		assert.Len(t, entries, 1)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+)
+
+var ErrDiskBudget = errors.New("disk budget exceeded")
+
+// diskUsage tracks the bytes the running task writes to disk against the
+// --max-disk budget
+var diskUsage = &diskBudget{}
+
+type diskBudget struct {
+	limit int64 // 0 means no limit
+	used  atomic.Int64
+}
+
+// Reserve accounts for n bytes about to be written. It fails without
+// reserving anything when the budget would be exceeded.
+func (o *diskBudget) Reserve(n int64) error {
+	used := o.used.Add(n)
+	if o.limit > 0 && used > o.limit {
+		o.used.Add(-n)
+		return errors.Wrapf(ErrDiskBudget, "writing %s more would exceed the --max-disk budget of %s", formatBytes(n), formatBytes(o.limit))
+	}
+	return nil
+}
+
+// Release returns the space of files that have been removed
+func (o *diskBudget) Release(n int64) {
+	o.used.Add(-n)
+}
+
+func (o *diskBudget) Used() int64 {
+	return o.used.Load()
+}
+
+// budgetWriter reserves every write against the disk budget so a write that
+// would exceed it fails before anything is written
+type budgetWriter struct {
+	io.WriteCloser
+	budget *diskBudget
+}
+
+func (o budgetWriter) Write(p []byte) (int, error) {
+	if err := o.budget.Reserve(int64(len(p))); err != nil {
+		return 0, err
+	}
+	n, err := o.WriteCloser.Write(p)
+	o.budget.Release(int64(len(p) - n))
+	watchdog.Progress(n)
+	return n, err
+}
+
+var byteSizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TIB", 1 << 40}, {"GIB", 1 << 30}, {"MIB", 1 << 20}, {"KIB", 1 << 10},
+	{"TB", 1e12}, {"GB", 1e9}, {"MB", 1e6}, {"KB", 1e3}, {"B", 1},
+}
+
+// parseByteSize parses sizes like 500MB, 1.5GB or 2GiB. A plain number is bytes.
+func parseByteSize(s string) (int64, error) {
+	value := strings.ToUpper(strings.TrimSpace(s))
+	multiplier := int64(1)
+	for _, v := range byteSizeUnits {
+		if strings.HasSuffix(value, v.suffix) {
+			value = strings.TrimSpace(strings.TrimSuffix(value, v.suffix))
+			multiplier = v.size
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q, use e.g. 500MB or 10GB", s)
+	}
+	return int64(n * float64(multiplier)), nil
+}
+
+func formatBytes(n int64) string {
+	for _, v := range byteSizeUnits[4:] {
+		if n >= v.size && v.size > 1 {
+			return fmt.Sprintf("%.2f%s", float64(n)/float64(v.size), v.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", n)
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/test-go/testify/assert"
+)
+
+func TestParseByteSize(t *testing.T) {
+	for input, expected := range map[string]int64{
+		"1024":   1024,
+		"500MB":  500000000,
+		"1.5gb":  1500000000,
+		"2GiB":   2 << 30,
+		"10 KB":  10000,
+		"0":      0,
+		"3TB":    3000000000000,
+		"512kib": 512 << 10,
+	} {
+		actual, err := parseByteSize(input)
+		assert.Nil(t, err, input)
+		assert.Equal(t, expected, actual, input)
+	}
+	for _, v := range []string{"", "GB", "ten", "-1MB"} {
+		_, err := parseByteSize(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestDiskBudget(t *testing.T) {
+	budget := &diskBudget{limit: 100}
+	assert.Nil(t, budget.Reserve(60))
+	err := budget.Reserve(60)
+	assert.True(t, errors.Is(err, ErrDiskBudget))
+	assert.Equal(t, int64(60), budget.Used())
+	budget.Release(60)
+	assert.Nil(t, budget.Reserve(100))
+	assert.Equal(t, "1.50MB", formatBytes(1500000))
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package main
+
+// diskFree is not supported on this platform
+func diskFree(path string) (int64, bool) {
+	return 0, false
+}
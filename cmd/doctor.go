@@ -0,0 +1,242 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	DoctorOK   = "ok"
+	DoctorWarn = "warn"
+	DoctorFail = "fail"
+)
+
+// maxClockSkew is how far the local clock can be from the API's before it is
+// reported. The Date header only has whole seconds.
+const maxClockSkew = 5 * time.Second
+
+// DoctorCheck is the result of one check with how to fix it
+type DoctorCheck struct {
+	Name   string
+	Status string
+	Detail string
+	Fix    string
+}
+
+type DoctorTask struct {
+	http   httpOptions
+	params struct {
+		apiKey      string
+		apiEndpoint string
+		liveURL     string
+		dirs        []string
+		minFree     string
+		timeout     time.Duration
+	}
+}
+
+func NewDoctorTask() *DoctorTask {
+	return &DoctorTask{}
+}
+
+func (o *DoctorTask) SetupParameters(cmd *cobra.Command) {
+	o.http.SetupParameters(cmd)
+	cmd.Flags().StringVarP(&o.params.apiKey, "key", "k", "", "Your API key")
+	cmd.Flags().StringVar(&o.params.apiEndpoint, "api-endpoint", defaultAPIEndpoint, "The API to check")
+	cmd.Flags().StringVar(&o.params.liveURL, "live-url", defaultLiveURL, "The live websocket to check")
+	cmd.Flags().StringSliceVar(&o.params.dirs, "dir", []string{"out"}, "The dirs you download to and read archives from, checked for write permission and free space. Can be repeated")
+	cmd.Flags().StringVar(&o.params.minFree, "min-free-disk", "10GB", "Warn when a dir has less free disk space than this")
+	cmd.Flags().DurationVar(&o.params.timeout, "timeout", 10*time.Second, "How long to wait for the API and websocket")
+}
+
+func (o *DoctorTask) GetMeta() Meta {
+	return Meta{
+		Name:        "DoctorTask",
+		Use:         "doctor",
+		Description: "Check connectivity to the API and websocket, the API key, disk space and write permissions of your dirs and clock skew, and print how to fix any problems. Include the output when contacting support.",
+	}
+}
+
+func (o *DoctorTask) Execute(ctx context.Context) error {
+	minFree, err := parseByteSize(o.params.minFree)
+	if err != nil {
+		return withKind(ErrUsage, errors.Wrap(err, "invalid min-free-disk"))
+	}
+	checks := o.Run(ctx, minFree)
+	failed := printDoctorChecks(os.Stdout, checks)
+	if failed != 0 {
+		return fmt.Errorf("%d checks failed", failed)
+	}
+	return nil
+}
+
+// Run runs every check
+func (o *DoctorTask) Run(ctx context.Context, minFree int64) []DoctorCheck {
+	checks := o.checkAPI(ctx)
+	checks = append(checks, o.checkLive(ctx))
+	for _, v := range o.params.dirs {
+		checks = append(checks, checkDir(v, minFree)...)
+	}
+	return checks
+}
+
+// checkAPI checks the API can be reached, the key is accepted and the clock
+// against the API's Date header
+func (o *DoctorTask) checkAPI(ctx context.Context) []DoctorCheck {
+	api := DoctorCheck{Name: "api"}
+	transport, err := o.http.NewTransport()
+	if err != nil {
+		api.Status, api.Detail, api.Fix = DoctorFail, err.Error(), "Fix the --proxy or --resolve flags"
+		return []DoctorCheck{api}
+	}
+	ctx, cancel := context.WithTimeout(ctx, o.params.timeout)
+	defer cancel()
+	// order 0 never exists, only the status matters
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.params.apiEndpoint+"/order/0", nil)
+	if err != nil {
+		api.Status, api.Detail, api.Fix = DoctorFail, err.Error(), "Check --api-endpoint"
+		return []DoctorCheck{api}
+	}
+	if o.params.apiKey != "" {
+		req.Header.Add("X-API-KEY", o.params.apiKey)
+	}
+	start := time.Now()
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		api.Status, api.Detail = DoctorFail, err.Error()
+		api.Fix = "Check your network allows HTTPS out to " + o.params.apiEndpoint + ". Behind a proxy use --proxy, with broken IPv6 use --dial-ipv4-only and with split DNS use --resolve"
+		return []DoctorCheck{api}
+	}
+	took := time.Since(start)
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	api.Status, api.Detail = DoctorOK, fmt.Sprintf("reached %s in %s", o.params.apiEndpoint, took.Round(time.Millisecond))
+	if resp.StatusCode >= 500 {
+		api.Status, api.Detail = DoctorWarn, fmt.Sprintf("%s returned status %d", o.params.apiEndpoint, resp.StatusCode)
+		api.Fix = "The API may be having problems, try again in a few minutes"
+	}
+
+	key := DoctorCheck{Name: "api key", Status: DoctorOK, Detail: "accepted"}
+	switch {
+	case o.params.apiKey == "":
+		key.Status, key.Detail, key.Fix = DoctorFail, "not given", "Pass your API key with --key. It is on the dashboard"
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		key.Status, key.Detail = DoctorFail, fmt.Sprintf("rejected with status %d", resp.StatusCode)
+		key.Fix = "Check the key matches the one on the dashboard, with no spaces or quotes, and has not been revoked"
+	}
+	return []DoctorCheck{api, key, checkClock(resp.Header.Get("Date"), start, took)}
+}
+
+// checkClock compares the local clock to the Date of a response received took
+// after start
+func checkClock(date string, start time.Time, took time.Duration) DoctorCheck {
+	check := DoctorCheck{Name: "clock"}
+	serverTime, err := http.ParseTime(date)
+	if err != nil {
+		check.Status, check.Detail = DoctorWarn, "the API sent no Date to compare with"
+		return check
+	}
+	// the Date is truncated to the second it was sent
+	skew := start.Add(took / 2).Sub(serverTime.Add(500 * time.Millisecond))
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+	}
+	check.Status, check.Detail = DoctorOK, fmt.Sprintf("%s %s the API", skew.Abs().Round(time.Second), direction)
+	if skew.Abs() > maxClockSkew {
+		check.Status = DoctorWarn
+		check.Fix = "Sync the clock with NTP e.g. enable systemd-timesyncd or chrony. Latency measured against block time is off by the skew"
+	}
+	return check
+}
+
+// checkLive checks the websocket accepts a connection
+func (o *DoctorTask) checkLive(ctx context.Context) DoctorCheck {
+	check := DoctorCheck{Name: "websocket"}
+	ctx, cancel := context.WithTimeout(ctx, o.params.timeout)
+	defer cancel()
+	start := time.Now()
+	conn, err := dialLive(ctx, &o.http, o.params.liveURL, o.params.apiKey)
+	if err != nil {
+		check.Status, check.Detail = DoctorFail, err.Error()
+		check.Fix = "Check your network allows websockets out to " + o.params.liveURL + ". Some proxies and firewalls block the upgrade even when HTTPS works. A bad handshake can also mean the API key was rejected"
+		return check
+	}
+	conn.Close()
+	check.Status, check.Detail = DoctorOK, fmt.Sprintf("connected to %s in %s", o.params.liveURL, time.Since(start).Round(time.Millisecond))
+	return check
+}
+
+// checkDir checks a dir, or the dir it would be created in, can be written to
+// and has minFree disk space
+func checkDir(dir string, minFree int64) []DoctorCheck {
+	name := "dir " + dir
+	// dirs are created on first use so check the nearest one that exists
+	existing := dir
+	for {
+		if info, err := os.Stat(existing); err == nil && info.IsDir() {
+			break
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			break
+		}
+		existing = parent
+	}
+	detail := "writable"
+	if existing != dir {
+		detail = fmt.Sprintf("does not exist yet, %s is writable", existing)
+	}
+	f, err := os.CreateTemp(existing, ".ss-cli-doctor-*")
+	if err != nil {
+		return []DoctorCheck{{
+			Name:   name,
+			Status: DoctorFail,
+			Detail: "not writable: " + err.Error(),
+			Fix:    "Fix the permissions of " + existing + " or use another dir",
+		}}
+	}
+	f.Close()
+	os.Remove(f.Name())
+	checks := []DoctorCheck{{Name: name, Status: DoctorOK, Detail: detail}}
+
+	free, ok := diskFree(existing)
+	switch {
+	case !ok:
+		checks = append(checks, DoctorCheck{Name: "disk " + dir, Status: DoctorWarn, Detail: "free space can not be checked on this platform"})
+	case free < minFree:
+		checks = append(checks, DoctorCheck{
+			Name:   "disk " + dir,
+			Status: DoctorWarn,
+			Detail: formatBytes(free) + " free",
+			Fix:    "Free up space or use another dir. --max-disk stops downloads gracefully before the disk fills",
+		})
+	default:
+		checks = append(checks, DoctorCheck{Name: "disk " + dir, Status: DoctorOK, Detail: formatBytes(free) + " free"})
+	}
+	return checks
+}
+
+// printDoctorChecks prints the checks and returns how many failed
+func printDoctorChecks(w io.Writer, checks []DoctorCheck) int {
+	failed := 0
+	for _, v := range checks {
+		fmt.Fprintf(w, "%-5s %-20s %s\n", strings.ToUpper(v.Status), v.Name, v.Detail)
+		if v.Fix != "" {
+			fmt.Fprintf(w, "%-5s %-20s fix: %s\n", "", "", v.Fix)
+		}
+		if v.Status == DoctorFail {
+			failed++
+		}
+	}
+	return failed
+}
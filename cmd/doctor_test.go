@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/test-go/testify/assert"
+)
+
+func TestDoctor(t *testing.T) {
+	api := NewMockAPI(fixturesDir)
+	api.RequireAPIKey("right-key")
+	apiServer := httptest.NewServer(api)
+	defer apiServer.Close()
+	liveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err == nil {
+			c.Close()
+		}
+	}))
+	defer liveServer.Close()
+
+	task := NewDoctorTask()
+	task.params.apiKey = "right-key"
+	task.params.apiEndpoint = apiServer.URL
+	task.params.liveURL = "ws" + strings.TrimPrefix(liveServer.URL, "http")
+	task.params.dirs = []string{t.TempDir(), filepath.Join(t.TempDir(), "new", "out")}
+	task.params.timeout = 5 * time.Second
+	checks := task.Run(context.Background(), 0)
+	statuses := map[string]string{}
+	for _, v := range checks {
+		statuses[v.Name] = v.Status
+		assert.Equal(t, DoctorOK, v.Status, "%s: %s", v.Name, v.Detail)
+	}
+	assert.Len(t, checks, 8)
+	assert.Equal(t, DoctorOK, statuses["api key"])
+
+	// a wrong key and an unreachable websocket fail with a fix
+	task.params.apiKey = "wrong-key"
+	task.params.liveURL = "ws://127.0.0.1:1"
+	task.params.dirs = nil
+	checks = task.Run(context.Background(), 0)
+	out := bytes.Buffer{}
+	assert.Equal(t, 2, printDoctorChecks(&out, checks))
+	assert.Contains(t, out.String(), "FAIL  api key              rejected with status 401")
+	assert.Contains(t, out.String(), "fix: Check the key matches")
+}
+
+func TestCheckClock(t *testing.T) {
+	now := time.Now()
+	check := checkClock(now.UTC().Format(http.TimeFormat), now, 0)
+	assert.Equal(t, DoctorOK, check.Status)
+
+	check = checkClock(now.Add(-time.Minute).UTC().Format(http.TimeFormat), now, 0)
+	assert.Equal(t, DoctorWarn, check.Status)
+	assert.Contains(t, check.Detail, "ahead of the API")
+	assert.NotEmpty(t, check.Fix)
+
+	check = checkClock("", now, 0)
+	assert.Equal(t, DoctorWarn, check.Status)
+}
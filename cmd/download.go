@@ -5,9 +5,15 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"math/rand"
 	"net/http"
 	"os"
+	"os/exec"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -15,28 +21,63 @@ import (
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	"golang.org/x/sync/semaphore"
 )
 
 type DownloadTask struct {
 	manifest   DownloadManifest
 	order      Order
 	httpClient *http.Client
-	grabber    *grab.Client
-	params     struct {
+	// nil with --no-cache
+	cache   *apiCache
+	grabber *grab.Client
+	http    httpOptions
+	// reducer filters each file as soon as it is downloaded when --reduce-filter is set
+	reducer    *ReduceTask
+	filterFunc func(EventRow) bool
+	report     *downloadReport
+	datasets   datasetOptions
+	lock       dirLockOptions
+	throttle   *downloadThrottle
+	retryWait  time.Duration // before the first retry after a 5xx
+	// of the full archives, from the entitlement of an earlier run
+	checksums map[string]string
+	params    struct {
 		apiKey          string
 		apiEndpoint     string
 		orderID         uint
 		fileName        string
 		concurrency     uint
+		processWorkers  uint
 		outputDir       string
 		isLocalEndpoint bool
+		fileOrder       string
+		onFileComplete  string
+		reduceFilter    string
+		noCache         bool
+		stagger         time.Duration
+		backoffCooldown time.Duration
+		cacheTTL        time.Duration
+		reportFile      string
+		repair          bool
+		saveEntitlement bool
 	}
 }
 
 const manifestFileName = ".ss-archive-manifest.json"
+
+const defaultAPIEndpoint = "https://api.solanastreaming.com"
+
+// full archives are downloaded here when reducing so only the reduced files
+// end up in the output dir. Left in place on failure so grab can resume them.
+const downloadReduceDir = ".ss-download-full"
 const archiveZipFileTimeFormat = "20060102-150405"
 
+const (
+	FileOrderOldestFirst = "oldest-first"
+	FileOrderNewestFirst = "newest-first"
+	FileOrderRandom      = "random"
+)
+
 type DownloadManifest struct {
 	Lock  *sync.Mutex           `json:"-"`
 	Files map[string]FileStatus `json:"files"`
@@ -52,6 +93,8 @@ type Order struct {
 	DownloadToken   string    `json:"download_token"`
 	ArchiveDataTo   time.Time `json:"archive_data_to"`
 	ArchiveDataFrom time.Time `json:"archive_data_from"`
+	// set when the order is split into a file series per dataset
+	Datasets []string `json:"datasets,omitempty"`
 }
 
 type fileProgress struct {
@@ -66,16 +109,34 @@ func NewDownloadTask() *DownloadTask {
 	return &DownloadTask{
 		httpClient: &http.Client{}, // no timesout because of downlaoding files
 		grabber:    grab.NewClient(),
+		retryWait:  downloadRetryWait,
 	}
 }
 
 func (o *DownloadTask) SetupParameters(cmd *cobra.Command) {
+	o.http.SetupParameters(cmd)
+	o.datasets.SetupParameters(cmd)
+	o.lock.SetupParameters(cmd)
 	cmd.Flags().StringVarP(&o.params.apiKey, "key", "k", "", "Your API key")
 	cmd.Flags().UintVarP(&o.params.orderID, "order-id", "r", 0, "the order id for all the files you want to download")
 	// cmd.Flags().StringVarP(&o.params.fileName, "file-name", "n", "", "an individial archive file to download")
 	cmd.Flags().StringVarP(&o.params.outputDir, "output-dir", "o", "out", "output directory")
-	cmd.Flags().UintVarP(&o.params.concurrency, "concurrency", "c", 1, "How many files to download concurrently. Tweak this depending on your network speed. Limit is currently 10")
+	cmd.Flags().UintVarP(&o.params.concurrency, "download-concurrency", "c", 1, "How many files to download concurrently. Tweak this depending on your network speed. Limit is currently 10")
+	cmd.Flags().UintVar(&o.params.concurrency, "concurrency", 1, "Same as --download-concurrency")
+	cmd.Flags().MarkDeprecated("concurrency", "use --download-concurrency instead")
+	cmd.Flags().UintVar(&o.params.processWorkers, "process-concurrency", uint(runtime.NumCPU()), "How many downloaded files to reduce and run --on-file-complete for at once. Files queue up for these workers so slow processing does not hold up downloads")
 	cmd.Flags().BoolVarP(&o.params.isLocalEndpoint, "isLocal", "l", false, "(used for internal testing)")
+	cmd.Flags().StringVar(&o.params.apiEndpoint, "api-endpoint", "", "Override the API endpoint e.g. to test against ss-cli dev mock-api")
+	cmd.Flags().DurationVar(&o.params.stagger, "stagger", 0, "The least time between starting file downloads e.g. 2s, so a high concurrency does not trip the API burst protection with the first batch")
+	cmd.Flags().DurationVar(&o.params.backoffCooldown, "backoff-cooldown", 30*time.Second, "When the API returns server errors fewer files are downloaded at once. One more is downloaded at once after each cool-down, back up to the download-concurrency")
+	cmd.Flags().StringVar(&o.params.fileOrder, "order", FileOrderOldestFirst, "The order to download files in: oldest-first, newest-first or random. Use newest-first to start working with the most recent data straight away")
+	cmd.Flags().StringVar(&o.params.reduceFilter, "reduce-filter", "", "Reduce each file with the filters in this reduce params file as soon as it has downloaded and discard the full file. See reduce --params-file")
+	cmd.Flags().BoolVar(&o.params.noCache, "no-cache", false, "Always get the order and file metadata from the API instead of the responses cached in the output dir by earlier runs")
+	cmd.Flags().DurationVar(&o.params.cacheTTL, "cache-ttl", time.Hour, "How long cached order and file metadata responses are used for")
+	cmd.Flags().BoolVar(&o.params.saveEntitlement, "save-entitlement", entitlementPublicKey != "", "Save the signed entitlement of the order to the output dir when the download completes, for --verify-entitlement. On by default in builds with an entitlement key")
+	cmd.Flags().BoolVar(&o.params.repair, "repair", false, "Check every local archive against the order's checksums, or read it back when there are none, and download the invalid and missing files again")
+	cmd.Flags().StringVar(&o.params.reportFile, "report-file", "", "Where to write the JSON report of each file's outcome, size, speed and checksum. Defaults to download-report.json in the output dir")
+	cmd.Flags().StringVar(&o.params.onFileComplete, "on-file-complete", "", "A command to run for each file once it has downloaded and been checked. {file} is replaced with the path of the downloaded archive, which is also in $SS_FILE. e.g. \"hdfs dfs -put {file} /archive\"")
 }
 
 func (o *DownloadTask) GetMeta() Meta {
@@ -87,9 +148,51 @@ func (o *DownloadTask) GetMeta() Meta {
 
 func (o *DownloadTask) Execute(ctx context.Context) error {
 	if err := o.validateParams(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	unlock, err := o.lock.Lock(o.params.outputDir, "download")
+	if err != nil {
 		return err
 	}
-	os.MkdirAll(o.params.outputDir, 0755)
+	defer unlock()
+	o.report = newDownloadReport(o.params.orderID)
+	err = o.download(ctx)
+	reportFile := o.params.reportFile
+	if reportFile == "" {
+		reportFile = o.params.outputDir + "/" + downloadReportFileName
+	}
+	if err := o.report.Write(reportFile, err); err != nil {
+		logrus.Warnf("could not write the download report: %s", err)
+	}
+	return err
+}
+
+// Metrics returns the counters of the last run for --push-metrics
+func (o *DownloadTask) Metrics() []Metric {
+	if o.report == nil {
+		return nil
+	}
+	return o.report.Metrics()
+}
+
+func (o *DownloadTask) download(ctx context.Context) error {
+	transport, err := o.http.NewTransport()
+	if err != nil {
+		return err
+	}
+	o.httpClient.Transport = transport
+	o.grabber.HTTPClient = &http.Client{Transport: transport}
+	o.grabber.UserAgent = userAgent()
+	os.MkdirAll(o.downloadDir(), 0755)
+	o.cache = nil
+	if !o.params.noCache && o.params.cacheTTL > 0 {
+		o.cache = loadAPICache(o.params.outputDir, o.params.orderID, o.params.apiEndpoint, o.params.cacheTTL)
+	}
+	if o.params.repair {
+		if err := o.repairFiles(ctx); err != nil {
+			return err
+		}
+	}
 	// // load manifest
 	currentFiles, err := o.getCurrentFiles(ctx)
 	if err != nil {
@@ -105,16 +208,43 @@ func (o *DownloadTask) Execute(ctx context.Context) error {
 
 	// get list of files to download
 	logrus.Infof("generating archive file list for download...")
-	files := generateListOfArchiveFiles(o.order.ArchiveDataFrom, o.order.ArchiveDataTo)
+	datasets := []string{}
+	for _, v := range o.order.Datasets {
+		if o.datasets.Selected(v) {
+			datasets = append(datasets, v)
+		}
+	}
+	if len(o.order.Datasets) == 0 && len(o.datasets.datasets) != 0 {
+		logrus.Warnf("order %d is not split into datasets, downloading files with every dataset", o.params.orderID)
+	} else if len(o.order.Datasets) != 0 && len(datasets) == 0 {
+		return withKind(ErrUsage, fmt.Errorf("order %d has none of the datasets selected, it has: %s", o.params.orderID, strings.Join(o.order.Datasets, ", ")))
+	}
+	files := orderArchiveFiles(o.order.ArchiveDataFrom, o.order.ArchiveDataTo, datasets)
 
 	// remove already downloaded files
 	filesToDownload := []string{}
 	for _, file := range files {
-		if inSlice(currentFiles, file) {
+		// a file with every dataset has the events of the split files too
+		hour, _, _ := strings.Cut(file, ".")
+		if inSlice(currentFiles, file) || inSlice(currentFiles, hour) {
 			continue
 		}
 		filesToDownload = append(filesToDownload, file)
 	}
+	quarantined, err := listQuarantine(o.params.outputDir)
+	if err != nil {
+		return err
+	}
+	// quarantined archives by hour, removed once downloaded again
+	quarantinedHours := map[string]string{}
+	for _, v := range quarantined {
+		hour := apiFileName(v.File)
+		if inSlice(filesToDownload, hour) {
+			logrus.Infof("downloading quarantined %s again", v.File)
+			quarantinedHours[hour] = v.File
+		}
+	}
+	orderFiles(filesToDownload, o.params.fileOrder)
 	if len(filesToDownload) == 0 {
 		logrus.Infof("all files already downloaded")
 		return nil
@@ -122,15 +252,21 @@ func (o *DownloadTask) Execute(ctx context.Context) error {
 	logrus.Infof("downloading total of %d files...", len(filesToDownload))
 
 	// get filesizes so we can calculate progress
-	totalBytesToDownload, err := o.getMetadata(ctx, filesToDownload)
+	totalBytesToDownload, fileSizes, err := o.getMetadata(ctx, filesToDownload)
 	if err != nil {
 		return err
 	}
+	o.report.Plan(len(files)-len(filesToDownload), filesToDownload, fileSizes)
+
+	// downloaded files are checked before they are reduced
+	o.checksums = o.entitlementChecksums(true)
 
-	// add one for ui thread
-	concurrency := semaphore.NewWeighted(int64(o.params.concurrency))
+	throttle := newDownloadThrottle(int(o.params.concurrency), o.params.backoffCooldown)
+	o.throttle = throttle
 
-	individualProgress := []fileProgress{}
+	// written by the downloads while the progress report reads it
+	individualProgress := make([]fileProgress, len(filesToDownload))
+	var progressLock sync.Mutex
 	finishReporting := make(chan struct{})
 	startedAt := time.Now()
 	go func() {
@@ -144,56 +280,200 @@ func (o *DownloadTask) Execute(ctx context.Context) error {
 			time.Sleep(time.Second)
 			totalBytesDownloaded := int64(0)
 			speed := float64(0)
+			progressLock.Lock()
 			for _, v := range individualProgress {
 				totalBytesDownloaded += v.Downloaded
 				speed += v.Speed
 			}
+			progressLock.Unlock()
 
 			progress := (float64(totalBytesDownloaded) / float64(totalBytesToDownload)) * 100
 			since := time.Since(startedAt)
 			eta := time.Duration((float64(since) / progress) * (100 - progress))
-			fmt.Printf("\rTotal Progress... %.2f%% complete. Current Speed: %.2f MB/s (%.2fMB/%.2fMB) ETA: %s", progress, speed, float64(totalBytesDownloaded)/1000000, float64(totalBytesToDownload)/1000000, eta)
+			backoff := ""
+			if limit, max := throttle.Limit(); limit < max {
+				backoff = fmt.Sprintf(" Backing off: %d/%d files at once", limit, max)
+			}
+			fmt.Printf("\rTotal Progress... %.2f%% complete. Current Speed: %.2f MB/s (%.2fMB/%.2fMB) ETA: %s%s", progress, speed, float64(totalBytesDownloaded)/1000000, float64(totalBytesToDownload)/1000000, eta, backoff)
 
 			// logrus.Infof("downloading %s: %.2f%% speed: %.2f KB/s", file, progress.Percent, progress.Speed)
 		}
 	}()
 
-	// download files
+	// downloaded files are queued for the process workers so downloads are
+	// not held up by reducing and hooks, and the other way round
 	var cmdErr error
-	for i, file := range filesToDownload {
-		concurrency.Acquire(ctx, 1)
-		individualProgress = append(individualProgress, fileProgress{})
+	var errLock sync.Mutex
+	fail := func(err error) {
+		errLock.Lock()
+		defer errLock.Unlock()
+		cmdErr = err // propagate to fail at the end
+	}
+	processQueue := make(chan string, len(filesToDownload))
+	processing := sync.WaitGroup{}
+	for range o.params.processWorkers {
+		processing.Add(1)
 		go func() {
-			defer concurrency.Release(1)
+			defer processing.Done()
+			for file := range processQueue {
+				// hashed before reducing replaces the full file
+				sum, err := fileSHA256(o.downloadDir() + "/" + file + ".zip")
+				if err == nil {
+					err = o.processFile(ctx, file, quarantinedHours)
+				}
+				o.report.Processed(file, sum, err)
+				if err != nil {
+					fail(err)
+				}
+			}
+		}()
+	}
 
+	// download files
+	budgetReached := 0
+	lastStart := time.Time{}
+	downloads := sync.WaitGroup{}
+	for i, file := range filesToDownload {
+		generation, err := throttle.Acquire(ctx)
+		if err != nil {
+			fail(err)
+			break
+		}
+		if wait := o.params.stagger - time.Since(lastStart); wait > 0 {
+			select {
+			case <-ctx.Done():
+			case <-time.After(wait):
+			}
+		}
+		lastStart = time.Now()
+		// stop before starting a file that would not fit so no file is left half written
+		if err := diskUsage.Reserve(int64(fileSizes[i])); err != nil {
+			throttle.Release()
+			logrus.Errorf("not downloading %s: %s", file, err)
+			budgetReached = len(filesToDownload) - i
+			fail(err)
+			break
+		}
+		downloads.Add(1)
+		go func() {
+			defer downloads.Done()
 			logrus.Debugf("downloading %d of %d files...", i+1, len(filesToDownload))
-			err = o.downloadFile(ctx, file, func(progress fileProgress) {
+			err := o.downloadWithBackoff(ctx, file, generation, func(progress fileProgress) {
+				progressLock.Lock()
 				individualProgress[i] = progress
+				progressLock.Unlock()
 				// logrus.Infof("downloading %s: %.2f%% speed: %.2f KB/s", file, progress.Percent, progress.Speed)
 			})
 			if err != nil {
 				logrus.Errorf("error downloading file %s: %s", file, err)
-				cmdErr = err // propagate to fail at the end
+				fail(err)
 				return
 			}
-
+			processQueue <- file
 		}()
 	}
 
-	// wait for all routines to release
-	concurrency.Acquire(ctx, int64(o.params.concurrency))
+	// wait for all routines to finish
+	downloads.Wait()
+	close(processQueue)
+	processing.Wait()
 	finishReporting <- struct{}{}
 
+	if budgetReached != 0 {
+		logrus.Errorf("Stopped with %d files left to download. Free up disk space or raise --max-disk and run again to download the rest.", budgetReached)
+		return withKind(ErrPartialDownload, cmdErr)
+	}
 	if cmdErr != nil {
 		logrus.Error("Completed with error. Please run again to retry failed files.")
-		return cmdErr
+		return withKind(ErrPartialDownload, cmdErr)
+	}
+
+	if o.reducer != nil {
+		// the entitlement covers the full files which are not kept
+		if err := o.reducer.writeSummary(); err != nil {
+			return err
+		}
+		os.Remove(o.downloadDir())
+	} else if o.params.saveEntitlement {
+		if err := o.saveEntitlement(ctx); err != nil {
+			logrus.Warnf("could not save the entitlement file for offline verification: %s", err)
+		} else if expected, err := readEntitlementFiles(o.params.outputDir); err == nil {
+			o.report.Checksums(expected)
+		}
 	}
 
 	logrus.Infof("Completed. Downloaded %d files", len(files))
 	return nil
 }
 
+// processFile checks a downloaded file, reduces it, clears its quarantined
+// copy and runs the on-file-complete hook for it. An invalid file is
+// quarantined so the hook only sees complete archives.
+func (o *DownloadTask) processFile(ctx context.Context, file string, quarantinedHours map[string]string) error {
+	if reason := checkArchive(o.downloadDir()+"/"+file+".zip", o.checksums[file+".zip"]); reason != nil {
+		if err := quarantineFileFrom(o.downloadDir(), o.params.outputDir, file+".zip", reason); err != nil {
+			return err
+		}
+		return withKind(ErrDataCorruption, errors.Wrapf(reason, "downloaded %s is invalid and was quarantined", file))
+	}
+
+	if o.reducer != nil {
+		if err := o.reduceFile(file); err != nil {
+			logrus.Errorf("error reducing file %s: %s", file, err)
+			return err
+		}
+	}
+
+	if name, ok := quarantinedHours[file]; ok {
+		if err := removeQuarantined(o.params.outputDir, name); err != nil {
+			logrus.Warnf("could not remove quarantined %s: %s", name, err)
+		}
+	}
+
+	if o.params.onFileComplete != "" {
+		err := runFileCompleteHook(ctx, o.params.onFileComplete, o.params.outputDir+"/"+file+".zip")
+		if err != nil {
+			logrus.Errorf("error running on-file-complete command for file %s: %s", file, err)
+			return err
+		}
+	}
+	return nil
+}
+
+// saveEntitlement saves the signed entitlement for the order next to the
+// archives so they can be verified offline with --verify-entitlement
+func (o *DownloadTask) saveEntitlement(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.params.apiEndpoint+"/order/"+strconv.Itoa(int(o.params.orderID))+"/entitlement", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Add("X-API-KEY", o.params.apiKey)
+
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return statusError(resp.StatusCode)
+	}
+	// saved as is so the signed bytes are unchanged
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(o.params.outputDir+"/"+entitlementFileName, raw, 0644)
+}
+
 func (o *DownloadTask) getOrder(ctx context.Context, orderID uint) error {
+	if order, ok := o.cache.Order(); ok {
+		logrus.Infof("using cached order %d, run with --no-cache to get it again", orderID)
+		o.order = order
+		return nil
+	}
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, o.params.apiEndpoint+"/order/"+strconv.Itoa(int(orderID)), nil)
@@ -209,13 +489,43 @@ func (o *DownloadTask) getOrder(ctx context.Context, orderID uint) error {
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return statusError(resp.StatusCode)
 	}
 
-	return json.NewDecoder(resp.Body).Decode(&o.order)
+	if err := json.NewDecoder(resp.Body).Decode(&o.order); err != nil {
+		return err
+	}
+	o.cache.SetOrder(o.order)
+	return nil
 }
 
-func (o *DownloadTask) getMetadata(ctx context.Context, files []string) (uint, error) {
+// getMetadata returns the total size of the files and the size of each file
+func (o *DownloadTask) getMetadata(ctx context.Context, files []string) (uint, []uint, error) {
+	cached, missing := o.cache.FileSizes(files)
+	if len(missing) != 0 {
+		fetched, err := o.fetchMetadata(ctx, missing)
+		if err != nil {
+			return 0, nil, err
+		}
+		o.cache.SetFileSizes(fetched)
+		for k, v := range fetched {
+			cached[k] = v
+		}
+	} else {
+		logrus.Infof("using cached metadata for %d files", len(files))
+	}
+
+	total := uint(0)
+	sizes := make([]uint, len(files))
+	for i, v := range files {
+		total += cached[v]
+		sizes[i] = cached[v]
+	}
+	return total, sizes, nil
+}
+
+// fetchMetadata gets the size of each file from the API
+func (o *DownloadTask) fetchMetadata(ctx context.Context, files []string) (map[string]uint, error) {
 	ctx, cancel := context.WithTimeout(ctx, 2*time.Second)
 	defer cancel()
 	request := map[string]interface{}{
@@ -223,22 +533,22 @@ func (o *DownloadTask) getMetadata(ctx context.Context, files []string) (uint, e
 	}
 	body, err := json.Marshal(request)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.params.apiEndpoint+"/archive/metadata", bytes.NewBuffer(body))
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	req.Header.Add("X-API-KEY", o.params.apiKey)
 
 	resp, err := o.httpClient.Do(req)
 	if err != nil {
-		return 0, err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		return nil, statusError(resp.StatusCode)
 	}
 
 	response := []struct {
@@ -247,21 +557,61 @@ func (o *DownloadTask) getMetadata(ctx context.Context, files []string) (uint, e
 		Filesize uint `json:"size"`
 	}{}
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
-		return 0, err
+		return nil, err
 	}
 
-	total := uint(0)
-	for _, v := range response {
-		total += v.Filesize
+	sizes := map[string]uint{}
+	for i, v := range response {
+		if i < len(files) {
+			sizes[files[i]] = v.Filesize
+		}
 	}
+	return sizes, nil
+}
 
-	return total, nil
+// downloadWithBackoff downloads the file in the slot taken from the throttle
+// and releases it. Server errors back the throttle off and the file is tried
+// again once there is a free slot.
+func (o *DownloadTask) downloadWithBackoff(ctx context.Context, file string, generation int, reportProgress func(fileProgress)) error {
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		err := o.downloadFile(ctx, file, reportProgress)
+		size := int64(0)
+		if info, statErr := os.Stat(o.downloadDir() + "/" + file + ".zip"); statErr == nil {
+			size = info.Size()
+		}
+		o.report.Downloaded(file, size, time.Since(started), err)
+		if err == nil {
+			o.throttle.Succeeded()
+			o.throttle.Release()
+			return nil
+		}
+		if !isServerError(err) || attempt == downloadServerErrorAttempts {
+			o.throttle.Release()
+			return err
+		}
+		o.throttle.Failed(generation)
+		o.throttle.Release()
+		wait := retryWait(o.retryWait, attempt)
+		logrus.Warnf("retrying %s in %s after %s", file, wait.Round(time.Millisecond), err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		if generation, err = o.throttle.Acquire(ctx); err != nil {
+			return err
+		}
+	}
 }
 
 func (o *DownloadTask) downloadFile(ctx context.Context, fileName string, reportProgress func(fileProgress)) error {
 
 	fullfilename := fmt.Sprintf(o.params.apiEndpoint+"/archive/download/%s?token=%s", fileName, o.order.DownloadToken)
-	req, err := grab.NewRequest(o.params.outputDir+"/"+fileName+".zip", fullfilename)
+	// written under another name until complete so a failed download is not
+	// taken as downloaded by the next run, which resumes it instead
+	path := o.downloadDir() + "/" + fileName + ".zip"
+	req, err := grab.NewRequest(path+".partial", fullfilename)
 	if err != nil {
 		return err
 	}
@@ -270,13 +620,15 @@ func (o *DownloadTask) downloadFile(ctx context.Context, fileName string, report
 	if resp == nil {
 		return fmt.Errorf("failed to start download")
 	}
-	if resp.HTTPResponse.StatusCode != http.StatusOK {
+	// partial content when resuming
+	if resp.HTTPResponse.StatusCode != http.StatusOK && resp.HTTPResponse.StatusCode != http.StatusPartialContent {
 		if resp.HTTPResponse.StatusCode == http.StatusPaymentRequired {
-			return fmt.Errorf("payment required or order expired")
+			return ErrPaymentRequired
 		}
-		return fmt.Errorf("unexpected status code: %d", resp.HTTPResponse.StatusCode)
+		return statusError(resp.HTTPResponse.StatusCode)
 	}
 
+	downloaded := int64(0)
 Loop:
 	for {
 		select {
@@ -285,6 +637,10 @@ Loop:
 		default:
 		}
 		time.Sleep(time.Second)
+		if complete := resp.BytesComplete(); complete > downloaded {
+			watchdog.Progress(int(complete - downloaded))
+			downloaded = complete
+		}
 		reportProgress(fileProgress{
 			TotalBytes: (resp.Size()),
 			Downloaded: (resp.BytesComplete()),
@@ -297,12 +653,72 @@ Loop:
 	if err := resp.Err(); err != nil {
 		return err
 	}
+	if err := os.Rename(path+".partial", path); err != nil {
+		return err
+	}
 
 	logrus.Debugf("downloaded successfully %s", fileName)
 
 	return nil
 }
 
+func (o *DownloadTask) downloadDir() string {
+	if o.reducer != nil {
+		return o.params.outputDir + "/" + downloadReduceDir
+	}
+	return o.params.outputDir
+}
+
+// reduceFile reduces a downloaded file into the output dir and removes the full file
+func (o *DownloadTask) reduceFile(file string) error {
+	if err := o.reducer.processFile(file+".zip", o.filterFunc); err != nil {
+		return err
+	}
+	path := o.downloadDir() + "/" + file + ".zip"
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	diskUsage.Release(info.Size())
+	return nil
+}
+
+// runFileCompleteHook runs the user supplied command through the system shell
+// for the downloaded archive. The path is passed to the shell as an argument
+// and in SS_FILE rather than spliced into the command, so a path can never
+// run as shell syntax, and {file} is replaced with a quoted reference to it.
+func runFileCompleteHook(ctx context.Context, command string, filePath string) error {
+	cmd := fileHookCommand(ctx, command, filePath)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	logrus.Debugf("running on-file-complete command for %s: %s", filePath, command)
+	return cmd.Run()
+}
+
+func fileHookCommand(ctx context.Context, command string, filePath string) *exec.Cmd {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		// windows paths can not contain a quote to end the quoting early
+		cmd = exec.CommandContext(ctx, "cmd", "/C", strings.ReplaceAll(command, "{file}", `"%SS_FILE%"`))
+	} else {
+		// the path is $1, after the name the shell gives $0
+		cmd = exec.CommandContext(ctx, "sh", "-c", strings.ReplaceAll(command, "{file}", `"$1"`), "ss-cli", filePath)
+	}
+	cmd.Env = append(os.Environ(), "SS_FILE="+filePath)
+	return cmd
+}
+
+// shellCommand runs a user supplied command through the system shell
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
+
 func inSlice(slice []string, item string) bool {
 	for _, v := range slice {
 		if v == item {
@@ -320,6 +736,19 @@ func generateListOfArchiveFiles(from, to time.Time) []string {
 	return files
 }
 
+// orderFiles sorts the archive file names (oldest first as generated) in place
+// according to the requested download order
+func orderFiles(files []string, order string) {
+	switch order {
+	case FileOrderNewestFirst:
+		slices.Reverse(files)
+	case FileOrderRandom:
+		rand.Shuffle(len(files), func(i, j int) {
+			files[i], files[j] = files[j], files[i]
+		})
+	}
+}
+
 func (o *DownloadTask) getCurrentFiles(ctx context.Context) ([]string, error) {
 	files, err := os.ReadDir(o.params.outputDir)
 	if err != nil {
@@ -334,11 +763,25 @@ func (o *DownloadTask) getCurrentFiles(ctx context.Context) ([]string, error) {
 		if len(v.Name()) < 4 || v.Name()[len(v.Name())-4:] != ".zip" {
 			continue
 		}
-		alreadyDownloaded = append(alreadyDownloaded, v.Name()[0:len(v.Name())-4])
+		alreadyDownloaded = append(alreadyDownloaded, apiFileName(v.Name()))
 	}
 	return alreadyDownloaded, nil
 }
 
+// apiFileName returns the name the API has, without .zip, for a local archive
+// file. Files renamed with --archive-name-format are matched by their time.
+func apiFileName(name string) string {
+	base, dataset := splitDataset(name)
+	file := strings.TrimSuffix(base, ".zip")
+	if t, ok := archiveNames.Time(base); ok {
+		file = t.Format(archiveZipFileTimeFormat)
+	}
+	if dataset != "" {
+		file += "." + dataset
+	}
+	return file
+}
+
 func (o *DownloadTask) validateParams() error {
 	if o.params.apiKey == "" {
 		return errors.New("missing API key")
@@ -349,15 +792,50 @@ func (o *DownloadTask) validateParams() error {
 	if o.params.outputDir == "" {
 		o.params.outputDir = "."
 	}
-	o.params.apiEndpoint = "https://api.solanastreaming.com"
-	if o.params.isLocalEndpoint {
-		o.params.apiEndpoint = "http://localhost:8000"
+	if o.params.apiEndpoint == "" {
+		o.params.apiEndpoint = defaultAPIEndpoint
+		if o.params.isLocalEndpoint {
+			o.params.apiEndpoint = "http://localhost:8000"
+		}
 	}
 	if o.params.concurrency == 0 {
 		o.params.concurrency = 1
 	}
+	if err := o.datasets.Parse(); err != nil {
+		return err
+	}
+	if o.params.stagger < 0 {
+		return errors.New("stagger must not be negative")
+	}
+	if o.params.backoffCooldown < 0 {
+		return errors.New("backoff-cooldown must not be negative")
+	}
 	if o.params.concurrency > 10 {
 		return errors.New("concurrency limit is 10")
 	}
+	if o.params.processWorkers == 0 {
+		o.params.processWorkers = 1
+	}
+	if o.params.reduceFilter != "" {
+		o.reducer = NewReduceTask()
+		o.reducer.params.paramsFile = o.params.reduceFilter
+		o.reducer.params.dataInDir = o.params.outputDir + "/" + downloadReduceDir
+		o.reducer.params.dataOutDir = o.params.outputDir
+		if err := o.reducer.processParams(); err != nil {
+			return errors.Wrap(err, "invalid reduce-filter")
+		}
+		filterFunc, err := o.reducer.makeFilterFunc()
+		if err != nil {
+			return errors.Wrap(err, "invalid reduce-filter")
+		}
+		o.filterFunc = filterFunc
+	}
+	switch o.params.fileOrder {
+	case "":
+		o.params.fileOrder = FileOrderOldestFirst
+	case FileOrderOldestFirst, FileOrderNewestFirst, FileOrderRandom:
+	default:
+		return fmt.Errorf("unknown order %q, must be one of: %s, %s, %s", o.params.fileOrder, FileOrderOldestFirst, FileOrderNewestFirst, FileOrderRandom)
+	}
 	return nil
 }
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/test-go/testify/assert"
+)
+
+func TestFileCompleteHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.txt")
+	ctx := context.Background()
+	for _, name := range []string{"20240505-120000.zip", "a b; touch pwned; c.zip", "$(touch pwned).zip", "`touch pwned`.zip", "it's \"quoted\".zip"} {
+		path := filepath.Join(dir, name)
+		assert.Nil(t, runFileCompleteHook(ctx, "printf %s {file} > "+out, path), name)
+		raw, err := os.ReadFile(out)
+		assert.Nil(t, err)
+		assert.Equal(t, path, string(raw), name)
+
+		assert.Nil(t, runFileCompleteHook(ctx, `printf %s "$SS_FILE" > `+out, path), name)
+		raw, err = os.ReadFile(out)
+		assert.Nil(t, err)
+		assert.Equal(t, path, string(raw), name)
+	}
+	// nothing in a path ran
+	_, err := os.Stat("pwned")
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "pwned"))
+	assert.True(t, os.IsNotExist(err))
+
+	assert.NotNil(t, runFileCompleteHook(ctx, "exit 3", filepath.Join(dir, "a.zip")))
+}
+
+func TestFileCompleteHookSkipsInvalidFiles(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses sh")
+	}
+	task := NewDownloadTask()
+	task.params.outputDir = t.TempDir()
+	out := filepath.Join(t.TempDir(), "out.txt")
+	task.params.onFileComplete = "echo {file} >> " + out
+	writeTestArchive(t, filepath.Join(task.params.outputDir, "20240505-120000.zip"), map[string]string{"swaps.json": "{}\n"})
+	assert.Nil(t, os.WriteFile(filepath.Join(task.params.outputDir, "20240505-130000.zip"), []byte("PK truncated"), 0644))
+
+	ctx := context.Background()
+	assert.Nil(t, task.processFile(ctx, "20240505-120000", nil))
+	err := task.processFile(ctx, "20240505-130000", nil)
+	assert.True(t, errors.Is(err, ErrDataCorruption), err)
+
+	// the hook only ran for the valid file, and the invalid one is quarantined
+	raw, err := os.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(task.params.outputDir, "20240505-120000.zip")+"\n", string(raw))
+	reasons, err := listQuarantine(task.params.outputDir)
+	assert.Nil(t, err)
+	assert.Len(t, reasons, 1)
+	assert.Equal(t, "20240505-130000.zip", reasons[0].File)
+
+	// and a file which does not match the entitlement checksum
+	writeTestArchive(t, filepath.Join(task.params.outputDir, "20240505-140000.zip"), map[string]string{"swaps.json": "{}\n"})
+	task.checksums = map[string]string{"20240505-140000.zip": "0000"}
+	err = task.processFile(ctx, "20240505-140000", nil)
+	assert.True(t, errors.Is(err, ErrDataCorruption), err)
+	reasons, err = listQuarantine(task.params.outputDir)
+	assert.Nil(t, err)
+	assert.Len(t, reasons, 2)
+}
+
+func TestOrderFiles(t *testing.T) {
+	generated := generateListOfArchiveFiles(time.Date(2024, 5, 5, 12, 0, 0, 0, time.UTC), time.Date(2024, 5, 5, 20, 0, 0, 0, time.UTC))
+	assert.Len(t, generated, 8)
+	for _, test := range []struct {
+		order string
+		// nil when the order is not fixed
+		expected []string
+		invalid  bool
+	}{
+		{order: "", expected: generated},
+		{order: FileOrderOldestFirst, expected: generated},
+		{order: FileOrderNewestFirst, expected: []string{"20240505-190000", "20240505-180000", "20240505-170000", "20240505-160000", "20240505-150000", "20240505-140000", "20240505-130000", "20240505-120000"}},
+		{order: FileOrderRandom},
+		{order: "newest", invalid: true},
+	} {
+		task := NewDownloadTask()
+		task.params.apiKey = "test-key"
+		task.params.orderID = 1
+		task.params.fileOrder = test.order
+		err := task.validateParams()
+		if test.invalid {
+			assert.NotNil(t, err, test.order)
+			continue
+		}
+		assert.Nil(t, err, test.order)
+
+		files := slices.Clone(generated)
+		orderFiles(files, task.params.fileOrder)
+		if test.expected != nil {
+			assert.Equal(t, test.expected, files, test.order)
+			continue
+		}
+		// random is a permutation of every file
+		slices.Sort(files)
+		assert.Equal(t, generated, files, test.order)
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/errgroup"
+)
+
+// repairFiles checks every archive in the output dir and quarantines those
+// which are invalid, e.g. partly written by an interrupted run, so they are
+// downloaded again like any other missing file. Archives covered by the
+// order's entitlement must match its sha256, others must read back without a
+// checksum error.
+func (o *DownloadTask) repairFiles(ctx context.Context) error {
+	files, err := listArchiveFiles(o.params.outputDir)
+	if err != nil {
+		return err
+	}
+	expected := o.entitlementChecksums(o.reducer == nil)
+
+	logrus.Infof("repair: checking %d local files...", len(files))
+	invalid := atomic.Int64{}
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(int(o.params.processWorkers))
+	for _, v := range files {
+		group.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			reason := checkArchive(filepath.Join(o.params.outputDir, v), expected[v])
+			if reason == nil {
+				return nil
+			}
+			invalid.Add(1)
+			return quarantineFile(o.params.outputDir, v, reason)
+		})
+	}
+	if err := group.Wait(); err != nil {
+		return err
+	}
+	logrus.Infof("repair: %d of %d local files are invalid and will be downloaded again", invalid.Load(), len(files))
+	return nil
+}
+
+// entitlementChecksums returns the sha256 of each archive in the entitlement
+// saved for this order. None are returned unless full is set, as reduced
+// archives are not covered by the entitlement of the full files.
+func (o *DownloadTask) entitlementChecksums(full bool) map[string]string {
+	entitlement, err := readEntitlement(o.params.outputDir)
+	if err != nil || !full || entitlement.OrderID != o.params.orderID {
+		return map[string]string{}
+	}
+	return entitlement.Files
+}
+
+// checkArchive returns why the archive is invalid, or nil if it is valid. An
+// empty sha256 reads every entry back instead, which checks their crc.
+func checkArchive(path string, sha256 string) error {
+	if sha256 != "" {
+		actual, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		if actual != sha256 {
+			return errors.New("does not match the entitlement checksum")
+		}
+		return nil
+	}
+	r, closer, err := openArchive(path)
+	if err != nil {
+		return errors.Wrap(err, "cant open archive")
+	}
+	defer closer.Close()
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return errors.Wrapf(err, "cant open %s", f.Name)
+		}
+		_, err = io.Copy(io.Discard, rc)
+		rc.Close()
+		if err != nil {
+			return errors.Wrapf(err, "cant read %s", f.Name)
+		}
+	}
+	return nil
+}
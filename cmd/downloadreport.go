@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// downloadReportFileName is written to the output dir at the end of every
+// download, to attach to support tickets or keep for audits
+const downloadReportFileName = "download-report.json"
+
+const (
+	FileOutcomeNotStarted = "not_started"
+	FileOutcomeDownloaded = "downloaded"
+	FileOutcomeFailed     = "failed"
+)
+
+const (
+	ChecksumOK         = "ok"
+	ChecksumMismatch   = "mismatch"
+	ChecksumNotChecked = "not_checked"
+)
+
+// DownloadReport is the outcome of a download run
+type DownloadReport struct {
+	CLIVersion string    `json:"cliVersion"`
+	OrderID    uint      `json:"orderId"`
+	StartedAt  time.Time `json:"startedAt"`
+	FinishedAt time.Time `json:"finishedAt"`
+	DurationMs int64     `json:"durationMs"`
+	// the exit code type as in --error-format json, empty on success
+	Error   string `json:"error,omitempty"`
+	Message string `json:"message,omitempty"`
+	// files of the order that were already in the output dir
+	AlreadyPresent  int                   `json:"alreadyPresent"`
+	Downloaded      int                   `json:"downloaded"`
+	Failed          int                   `json:"failed"`
+	Bytes           int64                 `json:"bytes"`
+	AverageSpeedMBs float64               `json:"averageSpeedMBs"`
+	Files           []*DownloadFileReport `json:"files"`
+}
+
+// DownloadFileReport is the outcome of one file
+type DownloadFileReport struct {
+	File          string  `json:"file"`
+	Outcome       string  `json:"outcome"`
+	ExpectedBytes uint    `json:"expectedBytes"`
+	Bytes         int64   `json:"bytes"`
+	DurationMs    int64   `json:"durationMs"`
+	SpeedMBs      float64 `json:"speedMBs"`
+	Attempts      int     `json:"attempts"`
+	SHA256        string  `json:"sha256,omitempty"`
+	// the sha256 compared to the entitlement of the order
+	Checksum string `json:"checksum"`
+	Error    string `json:"error,omitempty"`
+}
+
+// downloadReport collects the report of a download run from the download and
+// process workers
+type downloadReport struct {
+	lock   sync.Mutex
+	report DownloadReport
+	files  map[string]*DownloadFileReport
+}
+
+func newDownloadReport(orderID uint) *downloadReport {
+	return &downloadReport{
+		report: DownloadReport{
+			CLIVersion: version,
+			OrderID:    orderID,
+			StartedAt:  time.Now().UTC(),
+			Files:      []*DownloadFileReport{},
+		},
+		files: map[string]*DownloadFileReport{},
+	}
+}
+
+// Plan adds the files about to be downloaded with their expected sizes
+func (o *downloadReport) Plan(alreadyPresent int, files []string, sizes []uint) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.report.AlreadyPresent = alreadyPresent
+	for i, v := range files {
+		file := &DownloadFileReport{File: v, Outcome: FileOutcomeNotStarted, ExpectedBytes: sizes[i], Checksum: ChecksumNotChecked}
+		o.files[v] = file
+		o.report.Files = append(o.report.Files, file)
+	}
+}
+
+// Downloaded records one attempt at downloading a file
+func (o *downloadReport) Downloaded(file string, bytes int64, took time.Duration, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	v, ok := o.files[file]
+	if !ok {
+		return
+	}
+	v.Attempts++
+	v.Bytes = bytes
+	v.DurationMs = took.Milliseconds()
+	if took > 0 {
+		v.SpeedMBs = float64(bytes) / took.Seconds() / 1000000
+	}
+	v.Outcome = FileOutcomeDownloaded
+	v.Error = ""
+	if err != nil {
+		v.Outcome = FileOutcomeFailed
+		v.Error = err.Error()
+	}
+}
+
+// Processed records the sha256 of a downloaded file, and the error if
+// processing it failed
+func (o *downloadReport) Processed(file string, sha256 string, err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	v, ok := o.files[file]
+	if !ok {
+		return
+	}
+	v.SHA256 = sha256
+	if err != nil {
+		v.Outcome = FileOutcomeFailed
+		v.Error = err.Error()
+	}
+}
+
+// Checksums compares the sha256 of the downloaded files with the entitlement
+func (o *downloadReport) Checksums(expected map[string]string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	for _, v := range o.report.Files {
+		want, ok := expected[v.File+".zip"]
+		if v.SHA256 == "" || !ok {
+			continue
+		}
+		v.Checksum = ChecksumOK
+		if want != v.SHA256 {
+			v.Checksum = ChecksumMismatch
+		}
+	}
+}
+
+// Metrics returns the counters of the run so far to push with --push-metrics
+func (o *downloadReport) Metrics() []Metric {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	downloaded, failed, notStarted, mismatches := 0, 0, 0, 0
+	bytes := int64(0)
+	for _, v := range o.report.Files {
+		switch v.Outcome {
+		case FileOutcomeDownloaded:
+			downloaded++
+			bytes += v.Bytes
+		case FileOutcomeFailed:
+			failed++
+		case FileOutcomeNotStarted:
+			notStarted++
+		}
+		if v.Checksum == ChecksumMismatch {
+			mismatches++
+		}
+	}
+	took := time.Since(o.report.StartedAt).Seconds()
+	speed := 0.0
+	if took > 0 {
+		speed = float64(bytes) / took
+	}
+	return []Metric{
+		{Name: "ss_cli_download_files_already_present", Help: "Files of the order already in the output dir", Value: float64(o.report.AlreadyPresent)},
+		{Name: "ss_cli_download_files_downloaded", Help: "Files downloaded by the run", Value: float64(downloaded)},
+		{Name: "ss_cli_download_files_failed", Help: "Files which failed to download or process", Value: float64(failed)},
+		{Name: "ss_cli_download_files_not_started", Help: "Files not downloaded, e.g. when the disk budget ran out", Value: float64(notStarted)},
+		{Name: "ss_cli_download_bytes", Help: "Bytes of the files downloaded", Value: float64(bytes)},
+		{Name: "ss_cli_download_speed_bytes_per_second", Help: "Average download speed of the run", Value: speed},
+		{Name: "ss_cli_download_checksum_mismatches", Help: "Downloaded files which do not match the entitlement of the order", Value: float64(mismatches)},
+	}
+}
+
+// Write finishes the report with the error the run ended with and writes it
+func (o *downloadReport) Write(path string, runErr error) error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	report := &o.report
+	report.FinishedAt = time.Now().UTC()
+	took := report.FinishedAt.Sub(report.StartedAt)
+	report.DurationMs = took.Milliseconds()
+	report.Downloaded, report.Failed, report.Bytes = 0, 0, 0
+	for _, v := range report.Files {
+		switch v.Outcome {
+		case FileOutcomeDownloaded:
+			report.Downloaded++
+		case FileOutcomeFailed:
+			report.Failed++
+		}
+		report.Bytes += v.Bytes
+	}
+	if took > 0 {
+		report.AverageSpeedMBs = float64(report.Bytes) / took.Seconds() / 1000000
+	}
+	if runErr != nil {
+		report.Error = classifyError(runErr).Type
+		report.Message = runErr.Error()
+	}
+	raw, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0644)
+}
+
+// readEntitlementFiles returns the sha256 of each file in the entitlement
+// saved in dataDir. The signature is not checked, see --verify-entitlement.
+func readEntitlementFiles(dataDir string) (map[string]string, error) {
+	entitlement, err := readEntitlement(dataDir)
+	if err != nil {
+		return nil, err
+	}
+	return entitlement.Files, nil
+}
+
+// readEntitlement returns the entitlement saved in dataDir without checking
+// its signature
+func readEntitlement(dataDir string) (*Entitlement, error) {
+	raw, err := os.ReadFile(filepath.Join(dataDir, entitlementFileName))
+	if err != nil {
+		return nil, err
+	}
+	signed := SignedEntitlement{}
+	if err := json.Unmarshal(raw, &signed); err != nil {
+		return nil, err
+	}
+	entitlement := &Entitlement{}
+	if err := json.Unmarshal(signed.Entitlement, entitlement); err != nil {
+		return nil, err
+	}
+	return entitlement, nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// downloadServerErrorAttempts is how many times a file is tried while the
+// API keeps returning 5xx for it
+const downloadServerErrorAttempts = 3
+
+// downloadRetryWait is how long to wait before the first retry of a file
+// after a 5xx, doubled for each retry after
+const downloadRetryWait = 2 * time.Second
+
+// retryWait returns how long to wait before the attempt after a 5xx, between
+// half and all of the doubled wait at random so the files which failed
+// together are not retried together
+func retryWait(base time.Duration, attempt int) time.Duration {
+	wait := base << (attempt - 1)
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// downloadThrottle limits how many files download at once. When the API
+// returns 5xx, usually as it is overloaded, the limit is halved, and raised
+// again by one each cool-down after that while downloads succeed.
+type downloadThrottle struct {
+	lock     sync.Mutex
+	max      int
+	limit    int
+	active   int
+	cooldown time.Duration
+	// when the limit last changed
+	changedAt time.Time
+	// counts decreases, so the failures of downloads started before the last
+	// decrease do not decrease it again
+	generation int
+	// closed and replaced when a slot may have become free
+	freed chan struct{}
+}
+
+func newDownloadThrottle(max int, cooldown time.Duration) *downloadThrottle {
+	return &downloadThrottle{max: max, limit: max, cooldown: cooldown, freed: make(chan struct{})}
+}
+
+// Acquire waits for a free slot and returns the generation to pass to Failed
+func (o *downloadThrottle) Acquire(ctx context.Context) (int, error) {
+	for {
+		o.lock.Lock()
+		if o.active < o.limit {
+			o.active++
+			generation := o.generation
+			o.lock.Unlock()
+			return generation, nil
+		}
+		freed := o.freed
+		o.lock.Unlock()
+		select {
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		case <-freed:
+		}
+	}
+}
+
+func (o *downloadThrottle) Release() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.active--
+	o.notify()
+}
+
+// Failed halves the limit after a 5xx, once for the downloads started at
+// the same limit
+func (o *downloadThrottle) Failed(generation int) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if generation != o.generation || o.limit == 1 {
+		return
+	}
+	o.limit = max(1, o.limit/2)
+	o.generation++
+	o.changedAt = time.Now()
+	logrus.Warnf("the API is returning server errors, downloading %d files at once for at least %s", o.limit, o.cooldown)
+}
+
+// Succeeded raises the limit by one when it has not changed for the
+// cool-down
+func (o *downloadThrottle) Succeeded() {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.limit == o.max || time.Since(o.changedAt) < o.cooldown {
+		return
+	}
+	o.limit++
+	o.changedAt = time.Now()
+	o.notify()
+	logrus.Infof("downloading %d files at once", o.limit)
+}
+
+// Limit returns how many files can download at once, and the most that can
+func (o *downloadThrottle) Limit() (int, int) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.limit, o.max
+}
+
+func (o *downloadThrottle) notify() {
+	close(o.freed)
+	o.freed = make(chan struct{})
+}
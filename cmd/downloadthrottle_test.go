@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestDownloadThrottle(t *testing.T) {
+	ctx := context.Background()
+	throttle := newDownloadThrottle(4, time.Hour)
+	generations := []int{}
+	for range 4 {
+		generation, err := throttle.Acquire(ctx)
+		assert.Nil(t, err)
+		generations = append(generations, generation)
+	}
+	// the downloads started together back off once
+	throttle.Failed(generations[0])
+	throttle.Failed(generations[1])
+	limit, max := throttle.Limit()
+	assert.Equal(t, 2, limit)
+	assert.Equal(t, 4, max)
+
+	// no slot is free until enough downloads finish
+	throttle.Release()
+	throttle.Release()
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err := throttle.Acquire(short)
+	assert.NotNil(t, err)
+	throttle.Release()
+	generation, err := throttle.Acquire(ctx)
+	assert.Nil(t, err)
+	throttle.Failed(generation)
+	limit, _ = throttle.Limit()
+	assert.Equal(t, 1, limit)
+
+	// ramps back up after the cool-down
+	throttle.cooldown = 0
+	throttle.Succeeded()
+	throttle.Succeeded()
+	throttle.Succeeded()
+	throttle.Succeeded()
+	limit, _ = throttle.Limit()
+	assert.Equal(t, 4, limit)
+
+	// retries wait between half and all of the doubled wait
+	for attempt := 1; attempt <= 3; attempt++ {
+		wait := retryWait(time.Second, attempt)
+		assert.True(t, wait >= time.Second<<(attempt-1)/2 && wait <= time.Second<<(attempt-1), wait)
+	}
+}
+
+func TestDownloadBacksOffServerErrors(t *testing.T) {
+	api := NewMockAPI(fixturesDir)
+	failures := atomic.Int32{}
+	requested := sync.Map{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/archive/download/") {
+			// the first two downloads are refused as if overloaded
+			if failures.Add(1) <= 2 {
+				requested.Store(r.URL.Path, time.Now())
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			// retried only after waiting
+			if failed, ok := requested.Load(r.URL.Path); ok {
+				assert.True(t, time.Since(failed.(time.Time)) >= 100*time.Millisecond, r.URL.Path)
+			}
+		}
+		api.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.concurrency = 3
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	task.params.backoffCooldown = time.Hour
+	task.retryWait = 200 * time.Millisecond
+	assert.Nil(t, task.Execute(context.Background()))
+	limit, _ := task.throttle.Limit()
+	assert.Equal(t, 1, limit)
+
+	raw, err := os.ReadFile(filepath.Join(task.params.outputDir, downloadReportFileName))
+	assert.Nil(t, err)
+	report := DownloadReport{}
+	assert.Nil(t, json.Unmarshal(raw, &report))
+	assert.Equal(t, 3, report.Downloaded)
+	attempts := 0
+	for _, v := range report.Files {
+		assert.Equal(t, FileOutcomeDownloaded, v.Outcome)
+		attempts += v.Attempts
+	}
+	assert.Equal(t, 5, attempts)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// schemaDrift collects the fields in archive rows that EventRow does not
+// know about, when --strict-schema is set, so they can be reported at the end
+// of a command instead of being ignored silently
+var schemaDrift = &driftCollector{}
+
+type driftCollector struct {
+	enabled bool
+	mu      sync.Mutex
+	// rows seen with each unknown field by dotted path e.g. swap.priorityFee
+	fields map[string]uint64
+}
+
+// unmarshalEvent parses an archive row, noting any unknown fields
+func unmarshalEvent(row []byte, event *EventRow) error {
+	if err := json.Unmarshal(row, event); err != nil {
+		return err
+	}
+	if schemaDrift.enabled {
+		schemaDrift.Check(row)
+	}
+	return nil
+}
+
+// Check records the unknown fields of a row
+func (o *driftCollector) Check(row []byte) {
+	unknown := []string{}
+	collectUnknownFields(row, reflect.TypeOf(EventRow{}), "", &unknown)
+	if len(unknown) == 0 {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.fields == nil {
+		o.fields = map[string]uint64{}
+	}
+	for _, v := range unknown {
+		o.fields[v]++
+	}
+}
+
+// Fields returns the unknown field paths, most common first
+func (o *driftCollector) Fields() []string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	fields := []string{}
+	for k := range o.fields {
+		fields = append(fields, k)
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		if o.fields[fields[i]] != o.fields[fields[j]] {
+			return o.fields[fields[i]] > o.fields[fields[j]]
+		}
+		return fields[i] < fields[j]
+	})
+	return fields
+}
+
+// Report logs the drift report if any unknown fields were seen
+func (o *driftCollector) Report() {
+	fields := o.Fields()
+	if len(fields) == 0 {
+		return
+	}
+	logrus.Warnf("schema drift: the archive data has %d fields this CLI (%s) does not know about and ignored. Your ss-cli may be outdated, check for a newer release", len(fields), version)
+	for _, v := range fields {
+		logrus.Warnf("  %s (%d rows)", v, o.fields[v])
+	}
+}
+
+// collectUnknownFields appends the paths of the fields of the JSON object raw
+// which have no matching field in the struct t. Matching is case insensitive
+// like encoding/json.
+func collectUnknownFields(raw []byte, t reflect.Type, prefix string, unknown *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	object := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &object); err != nil {
+		// not an object e.g. null
+		return
+	}
+	for name, value := range object {
+		field, ok := jsonField(t, name)
+		if !ok {
+			*unknown = append(*unknown, prefix+name)
+			continue
+		}
+		collectUnknownFields(value, field.Type, prefix+name+".", unknown)
+	}
+}
+
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if tag == "-" {
+			continue
+		}
+		if tag == "" {
+			tag = field.Name
+		}
+		if strings.EqualFold(tag, name) {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
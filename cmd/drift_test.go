@@ -0,0 +1,19 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestSchemaDrift(t *testing.T) {
+	drift := &driftCollector{}
+	drift.Check([]byte(`{"slot":1,"signature":"a","swap":{"ammAccount":"b","priorityFee":5,"launchpad":{"name":"pump","mayhem":true}}}`))
+	drift.Check([]byte(`{"slot":2,"version":2,"pair":{"BaseToken":{"account":"c","decimals":6}},"swap":null}`))
+	drift.Check([]byte(`{"slot":3,"swap":{"priorityFee":1}}`))
+	assert.Equal(t, []string{"swap.priorityFee", "pair.BaseToken.decimals", "swap.launchpad.mayhem", "version"}, drift.Fields())
+
+	known := &driftCollector{}
+	known.Check([]byte(`{"slot":1,"blockTime":2,"graduation":{"creator":"a"}}`))
+	assert.Empty(t, known.Fields())
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Encrypted archives keep their .zip name and are detected by this header.
+// The format is: magic | 16 byte IV | AES-256-CTR ciphertext of the zip | HMAC-SHA256 tag.
+// CTR allows decrypting any offset so zip readers can seek without the
+// plaintext ever being written to disk.
+const encryptedArchiveMagic = "SSENC01\n"
+
+const (
+	encryptedHeaderSize = len(encryptedArchiveMagic) + aes.BlockSize
+	encryptedTagSize    = sha256.Size
+)
+
+// archiveKey is loaded from --encryption-key-file. When set archives written
+// by reduce are encrypted and encrypted archives can be read by every command.
+var archiveKey []byte
+
+// loadArchiveKey reads a 32 byte key file, either raw or hex encoded
+// e.g. created with: openssl rand -hex 32 > archive.key
+func loadArchiveKey(path string) error {
+	if path == "" {
+		return nil
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "cant read encryption key file")
+	}
+	if decoded, err := hex.DecodeString(strings.TrimSpace(string(raw))); err == nil {
+		raw = decoded
+	}
+	if len(raw) != 32 {
+		return fmt.Errorf("encryption key must be 32 bytes (or 64 hex characters), got %d bytes", len(raw))
+	}
+	archiveKey = raw
+	return nil
+}
+
+// archiveKeys derives separate encryption and authentication keys
+func archiveKeys(key []byte) (cipher.Block, hash.Hash, error) {
+	derive := func(label string) []byte {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(label))
+		return mac.Sum(nil)
+	}
+	block, err := aes.NewCipher(derive("ss-cli archive encryption"))
+	if err != nil {
+		return nil, nil, err
+	}
+	return block, hmac.New(sha256.New, derive("ss-cli archive authentication")), nil
+}
+
+// ctrStream returns the keystream positioned at offset bytes into the plaintext
+func ctrStream(block cipher.Block, iv []byte, offset int64) cipher.Stream {
+	counter := make([]byte, aes.BlockSize)
+	copy(counter, iv)
+	lo := binary.BigEndian.Uint64(counter[8:])
+	hi := binary.BigEndian.Uint64(counter[:8])
+	next := lo + uint64(offset/aes.BlockSize)
+	if next < lo {
+		hi++
+	}
+	binary.BigEndian.PutUint64(counter[8:], next)
+	binary.BigEndian.PutUint64(counter[:8], hi)
+	stream := cipher.NewCTR(block, counter)
+	if skip := offset % aes.BlockSize; skip != 0 {
+		discard := make([]byte, skip)
+		stream.XORKeyStream(discard, discard)
+	}
+	return stream
+}
+
+// openArchive opens a zip archive, transparently decrypting it if it was
+// written encrypted
+func openArchive(path string) (*zip.Reader, io.Closer, error) {
+	r, _, closer, err := openArchiveAt(path)
+	return r, closer, err
+}
+
+// openArchiveAt is openArchive but also returns the reader the zip was opened
+// from, for random access to entries
+func openArchiveAt(path string) (*zip.Reader, io.ReaderAt, io.Closer, error) {
+	reader, size, closer, err := openArchiveFile(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	r, err := zip.NewReader(reader, size)
+	if err != nil {
+		closer.Close()
+		return nil, nil, nil, errors.Wrapf(err, "cant open %s", path)
+	}
+	return r, reader, closer, nil
+}
+
+// openArchiveFile opens any file written by createArchive, transparently
+// decrypting it if it was written encrypted
+func openArchiveFile(path string) (io.ReaderAt, int64, io.Closer, error) {
+	if isPipe(path) {
+		return nil, 0, nil, errPipeArchive()
+	}
+	var f *os.File
+	var info os.FileInfo
+	err := ioRetry.Do(path, func() error {
+		var err error
+		if f, err = os.Open(path); err != nil {
+			return err
+		}
+		if info, err = f.Stat(); err != nil {
+			f.Close()
+		}
+		return err
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	// reads are retried as archives may be on a network filesystem
+	r := &retryingReaderAt{r: f, path: path}
+	magic := make([]byte, len(encryptedArchiveMagic))
+	if _, err := r.ReadAt(magic, 0); err != nil || string(magic) != encryptedArchiveMagic {
+		if isTransientIOError(err) {
+			f.Close()
+			return nil, 0, nil, err
+		}
+		return r, info.Size(), f, nil
+	}
+
+	reader, err := newDecryptingReader(r, info.Size())
+	if err != nil {
+		f.Close()
+		return nil, 0, nil, errors.Wrapf(err, "cant decrypt %s", path)
+	}
+	return reader, reader.size, f, nil
+}
+
+type decryptingReader struct {
+	f     io.ReaderAt
+	block cipher.Block
+	iv    []byte
+	size  int64
+}
+
+// newDecryptingReader authenticates the whole file before returning a reader
+// so corrupt or tampered archives are never parsed
+func newDecryptingReader(f io.ReaderAt, fileSize int64) (*decryptingReader, error) {
+	if archiveKey == nil {
+		return nil, errors.New("archive is encrypted, pass --encryption-key-file")
+	}
+	if fileSize < int64(encryptedHeaderSize+encryptedTagSize) {
+		return nil, withKind(ErrDataCorruption, errors.New("encrypted archive is truncated"))
+	}
+	block, mac, err := archiveKeys(archiveKey)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(mac, io.NewSectionReader(f, 0, fileSize-encryptedTagSize)); err != nil {
+		return nil, err
+	}
+	tag := make([]byte, encryptedTagSize)
+	if _, err := f.ReadAt(tag, fileSize-encryptedTagSize); err != nil {
+		return nil, err
+	}
+	if !hmac.Equal(tag, mac.Sum(nil)) {
+		return nil, withKind(ErrDataCorruption, errors.New("archive is corrupt or the encryption key is wrong"))
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := f.ReadAt(iv, int64(len(encryptedArchiveMagic))); err != nil {
+		return nil, err
+	}
+	return &decryptingReader{
+		f:     f,
+		block: block,
+		iv:    iv,
+		size:  fileSize - int64(encryptedHeaderSize+encryptedTagSize),
+	}, nil
+}
+
+func (o *decryptingReader) ReadAt(p []byte, off int64) (int, error) {
+	if off >= o.size {
+		return 0, io.EOF
+	}
+	eof := false
+	if remaining := o.size - off; int64(len(p)) > remaining {
+		p = p[:remaining]
+		eof = true
+	}
+	n, err := o.f.ReadAt(p, int64(encryptedHeaderSize)+off)
+	ctrStream(o.block, o.iv, off).XORKeyStream(p[:n], p[:n])
+	if err == nil && eof {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// createArchive creates an archive file for writing, encrypted when a key
+// has been loaded
+func createArchive(path string) (io.WriteCloser, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	f := budgetWriter{file, diskUsage}
+	if archiveKey == nil {
+		return f, nil
+	}
+	block, mac, err := archiveKeys(archiveKey)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := rand.Read(iv); err != nil {
+		f.Close()
+		return nil, err
+	}
+	header := append([]byte(encryptedArchiveMagic), iv...)
+	mac.Write(header)
+	if _, err := f.Write(header); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &encryptingWriter{
+		f:      f,
+		stream: ctrStream(block, iv, 0),
+		mac:    mac,
+	}, nil
+}
+
+type encryptingWriter struct {
+	f      io.WriteCloser
+	stream cipher.Stream
+	mac    hash.Hash
+	buf    bytes.Buffer
+}
+
+func (o *encryptingWriter) Write(p []byte) (int, error) {
+	o.buf.Reset()
+	o.buf.Grow(len(p))
+	out := o.buf.Bytes()[:len(p)]
+	o.stream.XORKeyStream(out, p)
+	o.mac.Write(out)
+	return o.f.Write(out)
+}
+
+// Close writes the authentication tag. Safe to call more than once.
+func (o *encryptingWriter) Close() error {
+	if o.f == nil {
+		return nil
+	}
+	f := o.f
+	o.f = nil
+	if _, err := f.Write(o.mac.Sum(nil)); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// entitlementFileName is saved next to the archives by download so the data
+// can be verified later without any API calls
+const entitlementFileName = ".ss-entitlement.json"
+
+// entitlementPublicKey is the base58 ed25519 key SolanaStreaming signs
+// entitlements with. It is compiled in by release builds with
+// -ldflags "-X main.entitlementPublicKey=..." and cannot be changed at run time,
+// so a modified entitlement cannot be signed with a key of the caller's choosing.
+// Tests set it directly.
+var entitlementPublicKey = ""
+
+// Entitlement records what an order covers and the sha256 of every archive file
+type Entitlement struct {
+	OrderID         uint              `json:"order_id"`
+	ArchiveDataFrom time.Time         `json:"archive_data_from"`
+	ArchiveDataTo   time.Time         `json:"archive_data_to"`
+	Files           map[string]string `json:"files"`
+	IssuedAt        time.Time         `json:"issued_at"`
+}
+
+// SignedEntitlement is the entitlement file format. The signature is a base58
+// ed25519 signature over the raw entitlement bytes.
+type SignedEntitlement struct {
+	Entitlement json.RawMessage `json:"entitlement"`
+	Signature   string          `json:"signature"`
+}
+
+func signEntitlement(entitlement Entitlement, key ed25519.PrivateKey) (SignedEntitlement, error) {
+	raw, err := json.Marshal(entitlement)
+	if err != nil {
+		return SignedEntitlement{}, err
+	}
+	return SignedEntitlement{
+		Entitlement: raw,
+		Signature:   solana.SignatureFromBytes(ed25519.Sign(key, raw)).String(),
+	}, nil
+}
+
+// entitlementOptions are the flags shared by commands that read archive files
+type entitlementOptions struct {
+	verify bool
+}
+
+func (o *entitlementOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&o.verify, "verify-entitlement", false, "Verify the archive files against the signed entitlement file saved by download before using them. Works offline")
+}
+
+// Verify checks the entitlement signature and that every file is covered by it
+// with a matching sha256. Does nothing unless --verify-entitlement is set.
+// Files are only read, mismatches are reported for download --repair to fix.
+func (o *entitlementOptions) Verify(dataDir string, files []string) error {
+	if !o.verify {
+		return nil
+	}
+	if entitlementPublicKey == "" {
+		return errors.New("this build has no entitlement key, use a release build or build with make build ENTITLEMENT_KEY=<key>")
+	}
+	publicKey, err := solana.PublicKeyFromBase58(entitlementPublicKey)
+	if err != nil {
+		return errors.Wrap(err, "this build has an invalid entitlement key")
+	}
+
+	raw, err := os.ReadFile(filepath.Join(dataDir, entitlementFileName))
+	if err != nil {
+		return errors.Wrap(err, "cant read entitlement file")
+	}
+	signed := SignedEntitlement{}
+	if err := json.Unmarshal(raw, &signed); err != nil {
+		return errors.Wrap(err, "invalid entitlement file")
+	}
+	signature, err := solana.SignatureFromBase58(signed.Signature)
+	if err != nil {
+		return errors.Wrap(err, "invalid entitlement signature")
+	}
+	if !ed25519.Verify(ed25519.PublicKey(publicKey[:]), signed.Entitlement, signature[:]) {
+		return withKind(ErrDataCorruption, errors.New("entitlement signature does not match, the file has been modified or was not issued by SolanaStreaming"))
+	}
+	entitlement := Entitlement{}
+	if err := json.Unmarshal(signed.Entitlement, &entitlement); err != nil {
+		return errors.Wrap(err, "invalid entitlement")
+	}
+
+	// every file is checked so one run finds all the bad files
+	mismatched := []string{}
+	for _, v := range files {
+		expected, ok := entitlement.Files[v]
+		if !ok {
+			return fmt.Errorf("%s is not covered by the entitlement for order %d", v, entitlement.OrderID)
+		}
+		actual, err := fileSHA256(filepath.Join(dataDir, v))
+		if err != nil {
+			return err
+		}
+		if actual != expected {
+			mismatched = append(mismatched, v)
+		}
+	}
+	if len(mismatched) != 0 {
+		return withKind(ErrDataCorruption, fmt.Errorf("%d files do not match the entitlement for order %d: %s. Run download with --repair to fetch them again", len(mismatched), entitlement.OrderID, strings.Join(mismatched, ", ")))
+	}
+	logrus.Infof("verified %d files against the entitlement for order %d", len(files), entitlement.OrderID)
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.Wrapf(err, "cant read %s", path)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
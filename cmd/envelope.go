@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	EnvelopeMethod         = "{{method}}"
+	EnvelopeSubscriptionID = "{{subscription_id}}"
+	EnvelopeParams         = "{{params}}"
+)
+
+// defaultEnvelopeTemplate is the notification framing of the production
+// websocket
+const defaultEnvelopeTemplate = `{"subscription_id":{{subscription_id}},"method":"{{method}}","params":{{params}}}`
+
+// defaultEnvelope renders notifications with the production envelope
+var defaultEnvelope = mustParseEnvelope(defaultEnvelopeTemplate)
+
+// envelopeOptions sets how notifications are framed on the websocket, for
+// client parsers which depend on the exact bytes
+type envelopeOptions struct {
+	template string
+	strict   bool
+}
+
+func (o *envelopeOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.template, "envelope-template", "", "A file with the notification envelope to send, with {{subscription_id}}, {{method}} and {{params}} in place of the values. Defaults to the production envelope")
+	cmd.Flags().BoolVar(&o.strict, "strict-envelope", false, "Send the params of each notification byte for byte as the archived event instead of re-encoding it")
+}
+
+// Load returns the envelope to render notifications with
+func (o *envelopeOptions) Load() (*notificationEnvelope, error) {
+	template := defaultEnvelopeTemplate
+	if o.template != "" {
+		raw, err := os.ReadFile(o.template)
+		if err != nil {
+			return nil, errors.Wrap(err, "cant read envelope-template")
+		}
+		template = strings.TrimSpace(string(raw))
+	}
+	envelope, err := parseEnvelope(template)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid envelope-template")
+	}
+	envelope.strict = o.strict
+	return envelope, nil
+}
+
+// notificationEnvelope renders notifications from a template
+type notificationEnvelope struct {
+	// the template around the placeholders, one more than placeholders
+	parts        [][]byte
+	placeholders []string
+	strict       bool
+}
+
+// parseEnvelope splits the template around its placeholders. Each of them
+// must be in it once, and it must render valid JSON.
+func parseEnvelope(template string) (*notificationEnvelope, error) {
+	envelope := &notificationEnvelope{}
+	for _, v := range []string{EnvelopeMethod, EnvelopeSubscriptionID, EnvelopeParams} {
+		if count := strings.Count(template, v); count != 1 {
+			return nil, fmt.Errorf("%s must be in the template once, not %d times", v, count)
+		}
+	}
+	for rest := template; ; {
+		start, end, placeholder := -1, 0, ""
+		for _, v := range []string{EnvelopeMethod, EnvelopeSubscriptionID, EnvelopeParams} {
+			if i := strings.Index(rest, v); i != -1 && (start == -1 || i < start) {
+				start, end, placeholder = i, i+len(v), v
+			}
+		}
+		if start == -1 {
+			envelope.parts = append(envelope.parts, []byte(rest))
+			break
+		}
+		envelope.parts = append(envelope.parts, []byte(rest[:start]))
+		envelope.placeholders = append(envelope.placeholders, placeholder)
+		rest = rest[end:]
+	}
+	sample, err := envelope.Render(JSONRPC{SubscriptionID: 1, Method: "swapNotification", Params: json.RawMessage(`{"slot":1}`)})
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(sample) {
+		return nil, fmt.Errorf("the template does not render valid JSON, e.g. %s", sample)
+	}
+	return envelope, nil
+}
+
+func mustParseEnvelope(template string) *notificationEnvelope {
+	envelope, err := parseEnvelope(template)
+	if err != nil {
+		panic(err)
+	}
+	return envelope
+}
+
+// Render returns the notification framed by the envelope. The params are
+// compacted as json.Marshal does unless strict.
+func (o *notificationEnvelope) Render(v JSONRPC) ([]byte, error) {
+	params := []byte(v.Params)
+	if !o.strict {
+		var err error
+		if params, err = json.Marshal(v.Params); err != nil {
+			return nil, err
+		}
+	}
+	out := bytes.Buffer{}
+	for i, part := range o.parts {
+		out.Write(part)
+		if i == len(o.placeholders) {
+			break
+		}
+		switch o.placeholders[i] {
+		case EnvelopeMethod:
+			out.WriteString(v.Method)
+		case EnvelopeSubscriptionID:
+			out.WriteString(strconv.FormatUint(uint64(v.SubscriptionID), 10))
+		case EnvelopeParams:
+			out.Write(params)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// setJSONField replaces the value of a top level field of a JSON object
+// without re-encoding the rest of it, so the field order and formatting are
+// kept. It returns false when the object has no such field.
+func setJSONField(raw []byte, field string, value []byte) ([]byte, bool) {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	if token, err := dec.Token(); err != nil || token != json.Delim('{') {
+		return nil, false
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return nil, false
+		}
+		existing := json.RawMessage{}
+		if err := dec.Decode(&existing); err != nil {
+			return nil, false
+		}
+		if key != field {
+			continue
+		}
+		end := int(dec.InputOffset())
+		start := end - len(existing)
+		out := make([]byte, 0, len(raw)-len(existing)+len(value))
+		out = append(out, raw[:start]...)
+		out = append(out, value...)
+		return append(out, raw[end:]...), true
+	}
+	return nil, false
+}
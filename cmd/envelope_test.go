@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/test-go/testify/assert"
+)
+
+// TestEnvelopeGolden checks the bytes of the notifications sent over the
+// websocket against testdata/envelope, as client parsers depend on them
+func TestEnvelopeGolden(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"events.json": `{"swap":{"quoteAmount":"1", "name":"A&B"},"slot":1}` + "\n" +
+			`{"slot":2,"pair":{"baseTokenMint":"m"}}` + "\n",
+	})
+	template := t.TempDir() + "/envelope.json"
+	assert.Nil(t, os.WriteFile(template, []byte(`{"jsonrpc":"2.0","method":"{{method}}","params":{"subscription":{{subscription_id}},"result":{{params}}}}`+"\n"), 0644))
+
+	for _, test := range []struct {
+		golden   string
+		template string
+		strict   bool
+	}{
+		{golden: "default"},
+		{golden: "strict", strict: true},
+		{golden: "template", template: template, strict: true},
+	} {
+		st := NewSimulateTask()
+		st.params.dataDir = dataDir
+		st.envelope.template = test.template
+		st.envelope.strict = test.strict
+		notifications, err := st.envelope.Load()
+		assert.Nil(t, err)
+		st.notifications = notifications
+		server := httptest.NewServer(st.websocketHandler(context.Background()))
+
+		c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+		assert.Nil(t, err)
+		c.SetReadDeadline(time.Now().Add(10 * time.Second))
+		for _, v := range []string{`{"id":1,"method":"swapSubscribe"}`, `{"id":2,"method":"newPairSubscribe"}`} {
+			assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(v)))
+			_, _, err := c.ReadMessage()
+			assert.Nil(t, err)
+		}
+		assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(`{"id":3,"method":"startSimulation"}`)))
+		messages := []string{}
+		for range 2 {
+			_, raw, err := c.ReadMessage()
+			assert.Nil(t, err)
+			messages = append(messages, string(raw))
+		}
+		c.Close()
+		server.Close()
+
+		assertGolden(t, "testdata/envelope/"+test.golden+".golden", strings.Join(messages, "\n")+"\n")
+	}
+}
+
+func TestParseEnvelope(t *testing.T) {
+	for _, invalid := range []string{
+		`{"method":"{{method}}","params":{{params}}}`,
+		`{"method":"{{method}}","params":{{params}},"subscription_id":{{subscription_id}},"id":{{subscription_id}}}`,
+		`{"method":{{method}},"params":{{params}},"subscription_id":{{subscription_id}}}`,
+	} {
+		_, err := parseEnvelope(invalid)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestSetJSONField(t *testing.T) {
+	raw := []byte(`{"method":"swapNotification", "subscription_id": 77,"params":{"subscription_id":1}}`)
+	replaced, ok := setJSONField(raw, "subscription_id", []byte("3"))
+	assert.True(t, ok)
+	assert.Equal(t, `{"method":"swapNotification", "subscription_id": 3,"params":{"subscription_id":1}}`, string(replaced))
+	_, ok = setJSONField(raw, "id", []byte("3"))
+	assert.False(t, ok)
+	_, ok = setJSONField([]byte(`[1]`), "id", []byte("3"))
+	assert.False(t, ok)
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// archiveSchemaVersion is the newest version of the archive event format this
+// CLI understands
+const archiveSchemaVersion = 1
+
+// EventRow is a single row of archive data. Each row holds one of pair, swap or
+// graduation depending on the event type.
+type EventRow struct {
+	Slot       uint64           `json:"slot"`
+	Sig        string           `json:"signature"`
+	BlockTime  int64            `json:"blockTime"` // unix seconds
+	Pair       *PairEvent       `json:"pair"`
+	Swap       *SwapEvent       `json:"swap"`
+	Graduation *GraduationEvent `json:"graduation"`
+}
+
+type PairEvent struct {
+	SourceExchange string `json:"sourceExchange"`
+	AmmAccount     string `json:"ammAccount"`
+	BaseToken      struct {
+		Account string `json:"account"`
+	}
+	BaseTokenLiquidityAdded  Amount         `json:"baseTokenLiquidityAdded"`
+	QuoteTokenLiquidityAdded Amount         `json:"quoteTokenLiquidityAdded"`
+	Launchpad                *LaunchpadInfo `json:"launchpad"`
+}
+
+type SwapEvent struct {
+	SourceExchange string         `json:"sourceExchange"`
+	AmmAccount     string         `json:"ammAccount"`
+	BaseTokenMint  string         `json:"baseTokenMint"`
+	QuoteTokenMint string         `json:"quoteTokenMint"`
+	WalletAccount  string         `json:"walletAccount"`
+	SwapType       string         `json:"swapType"` // buy or sell of the base token
+	BaseAmount     Amount         `json:"baseAmount"`
+	QuoteAmount    Amount         `json:"quoteAmount"`
+	BaseReserve    Amount         `json:"baseReserve"`  // pool reserve after the swap, if known
+	QuoteReserve   Amount         `json:"quoteReserve"` // pool reserve after the swap, if known
+	Launchpad      *LaunchpadInfo `json:"launchpad"`
+}
+
+const (
+	SwapTypeBuy  = "buy"
+	SwapTypeSell = "sell"
+)
+
+// Time returns the block time of the event or the zero time if the row has none
+func (e EventRow) Time() time.Time {
+	if e.BlockTime == 0 {
+		return time.Time{}
+	}
+	return time.Unix(e.BlockTime, 0).UTC()
+}
+
+// Amount is a token amount which may be encoded as a JSON number or string
+type Amount string
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		*a = ""
+		return nil
+	}
+	*a = Amount(strings.Trim(string(data), `"`))
+	return nil
+}
+
+// Float64 converts the amount to a float, treating missing or malformed
+// amounts as zero
+func (a Amount) Float64() float64 {
+	f, err := strconv.ParseFloat(string(a), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
+
+// GraduationEvent is emitted when a launchpad token completes its bonding
+// curve and migrates to an AMM
+type GraduationEvent struct {
+	Launchpad     string `json:"launchpad"`
+	BaseTokenMint string `json:"baseTokenMint"`
+	BondingCurve  string `json:"bondingCurve"`
+	AmmAccount    string `json:"ammAccount"`
+	Creator       string `json:"creator"`
+}
+
+// LaunchpadInfo is present on pairs and swaps from launchpads such as Pump.fun
+// while the token is trading on (or has graduated from) a bonding curve
+type LaunchpadInfo struct {
+	Name                 string  `json:"name"`
+	BondingCurve         string  `json:"bondingCurve"`
+	BondingCurveProgress float64 `json:"bondingCurveProgress"` // percent complete
+	Creator              string  `json:"creator"`
+	Graduated            bool    `json:"graduated"`
+}
+
+const (
+	LaunchStageBonding    = "bonding"
+	LaunchStageGraduation = "graduation"
+	LaunchStageGraduated  = "graduated"
+)
+
+// LaunchStage returns the launchpad stage of the event or an empty string if
+// the event is not related to a launchpad
+func (e EventRow) LaunchStage() string {
+	if e.Graduation != nil {
+		return LaunchStageGraduation
+	}
+	info := e.launchpad()
+	if info == nil {
+		return ""
+	}
+	if info.Graduated {
+		return LaunchStageGraduated
+	}
+	return LaunchStageBonding
+}
+
+// Creator returns the launchpad creator of the token if known
+func (e EventRow) Creator() string {
+	if e.Graduation != nil {
+		return e.Graduation.Creator
+	}
+	if info := e.launchpad(); info != nil {
+		return info.Creator
+	}
+	return ""
+}
+
+func (e EventRow) launchpad() *LaunchpadInfo {
+	if e.Pair != nil {
+		return e.Pair.Launchpad
+	}
+	if e.Swap != nil {
+		return e.Swap.Launchpad
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// eventCacheVersion is bumped whenever EventRow or the cache layout changes
+// so caches written by older versions are rebuilt instead of misread
+const eventCacheVersion = 1
+
+// eventCache is the --event-cache directory, empty when caching is off
+var eventCache = ""
+
+// eventCacheHeader is the first value in a cache file. A cache is only used
+// when it was built by this cache version from the same source archive.
+type eventCacheHeader struct {
+	Version int
+	Source  string
+	Size    int64
+	ModTime int64
+}
+
+// readArchiveEvents streams the parsed events of an archive to fn in the
+// order of readArchiveRows. When --event-cache is set, events are read from a
+// pre-parsed cache of the archive, which is built on the first read and
+// rebuilt whenever the archive changes. Without a cache, rows that do not
+// contain prefilter are skipped without being parsed, pass nil to parse all.
+// stdin is never cached.
+func readArchiveEvents(path string, prefilter []byte, fn func(event EventRow) error) error {
+	if eventCache == "" || isPipe(path) {
+		return readArchiveRows(path, func(row []byte) error {
+			if prefilter != nil && !bytes.Contains(row, prefilter) {
+				return nil
+			}
+			event := EventRow{}
+			if err := unmarshalEvent(row, &event); err != nil {
+				return errors.Wrap(err, "cant unmarshal event")
+			}
+			return fn(event)
+		})
+	}
+
+	header, err := newEventCacheHeader(path)
+	if err != nil {
+		return err
+	}
+	cachePath := eventCachePath(header.Source)
+	ok, err := readEventCache(cachePath, header, fn)
+	if ok || err != nil {
+		return err
+	}
+	logrus.Debugf("building event cache for %s", path)
+	return writeEventCache(cachePath, header, path, fn)
+}
+
+// eventCachePath is the cache file of the archive at the absolute path source.
+// Archives in different dirs often share a name, so the path is hashed into it.
+func eventCachePath(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return filepath.Join(eventCache, fmt.Sprintf("%s-%x.events", filepath.Base(source), sum[:8]))
+}
+
+func newEventCacheHeader(path string) (eventCacheHeader, error) {
+	source, err := filepath.Abs(path)
+	if err != nil {
+		return eventCacheHeader{}, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return eventCacheHeader{}, err
+	}
+	return eventCacheHeader{Version: eventCacheVersion, Source: source, Size: info.Size(), ModTime: info.ModTime().UnixNano()}, nil
+}
+
+// readEventCache streams a cache file to fn. It returns false without error
+// when there is no usable cache for header.
+func readEventCache(cachePath string, header eventCacheHeader, fn func(event EventRow) error) (bool, error) {
+	reader, size, closer, err := openArchiveFile(cachePath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer closer.Close()
+	zr, err := zstd.NewReader(io.NewSectionReader(reader, 0, size))
+	if err != nil {
+		return false, nil
+	}
+	defer zr.Close()
+
+	decoder := gob.NewDecoder(zr)
+	cached := eventCacheHeader{}
+	if err := decoder.Decode(&cached); err != nil || cached != header {
+		logrus.Debugf("event cache %s is stale", cachePath)
+		return false, nil
+	}
+	for {
+		event := EventRow{}
+		err := decoder.Decode(&event)
+		if err == io.EOF {
+			return true, nil
+		}
+		if err != nil {
+			return true, errors.Wrapf(err, "corrupt event cache %s, delete it to rebuild", cachePath)
+		}
+		watchdog.Progress(1)
+		if err := fn(event); err != nil {
+			return true, err
+		}
+	}
+}
+
+// writeEventCache parses the archive, passing each event to fn while writing
+// the cache. The cache is written to a temporary file and only moved into
+// place once the whole archive has been read.
+func writeEventCache(cachePath string, header eventCacheHeader, path string, fn func(event EventRow) error) error {
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return errors.Wrap(err, "cant create event cache dir")
+	}
+	tmpPath := cachePath + ".tmp"
+	f, err := createArchive(tmpPath)
+	if err != nil {
+		return errors.Wrap(err, "cant create event cache")
+	}
+	written := false
+	defer func() {
+		if !written {
+			f.Close()
+			removeEventCache(tmpPath)
+		}
+	}()
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return err
+	}
+	encoder := gob.NewEncoder(zw)
+	if err := encoder.Encode(header); err != nil {
+		return errors.Wrap(err, "cant write event cache")
+	}
+	err = readArchiveRows(path, func(row []byte) error {
+		event := EventRow{}
+		if err := unmarshalEvent(row, &event); err != nil {
+			return errors.Wrap(err, "cant unmarshal event")
+		}
+		if err := encoder.Encode(event); err != nil {
+			return errors.Wrap(err, "cant write event cache")
+		}
+		return fn(event)
+	})
+	if err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return errors.Wrap(err, "cant write event cache")
+	}
+	written = true
+	if err := f.Close(); err != nil {
+		removeEventCache(tmpPath)
+		return errors.Wrap(err, "cant write event cache")
+	}
+	return os.Rename(tmpPath, cachePath)
+}
+
+// removeEventCache removes a partly written cache, returning its space to the
+// disk budget
+func removeEventCache(path string) {
+	if info, err := os.Stat(path); err == nil {
+		diskUsage.Release(info.Size())
+	}
+	os.Remove(path)
+}
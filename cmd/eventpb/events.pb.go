@@ -0,0 +1,636 @@
+// The protobuf encoding of archive events, sent by the replay commands with
+// --encoding proto. Generate consumers with e.g.
+// protoc --python_out=. events.proto
+//
+// Fields are only ever added, so consumers built from an older copy keep
+// working. Amounts are raw token amounts as decimal strings, as they can
+// exceed 64 bits.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.6
+// 	protoc        (unknown)
+// source: events.proto
+
+package eventpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+// Event is one archive event, holding one of swap, pair or graduation
+type Event struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Slot      uint64                 `protobuf:"varint,1,opt,name=slot,proto3" json:"slot,omitempty"`
+	Signature string                 `protobuf:"bytes,2,opt,name=signature,proto3" json:"signature,omitempty"`
+	// unix seconds, 0 when unknown
+	BlockTime int64 `protobuf:"varint,3,opt,name=block_time,json=blockTime,proto3" json:"block_time,omitempty"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*Event_Swap
+	//	*Event_Pair
+	//	*Event_Graduation
+	Event         isEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Event) Reset() {
+	*x = Event{}
+	mi := &file_events_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Event) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Event) ProtoMessage() {}
+
+func (x *Event) ProtoReflect() protoreflect.Message {
+	mi := &file_events_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Event.ProtoReflect.Descriptor instead.
+func (*Event) Descriptor() ([]byte, []int) {
+	return file_events_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Event) GetSlot() uint64 {
+	if x != nil {
+		return x.Slot
+	}
+	return 0
+}
+
+func (x *Event) GetSignature() string {
+	if x != nil {
+		return x.Signature
+	}
+	return ""
+}
+
+func (x *Event) GetBlockTime() int64 {
+	if x != nil {
+		return x.BlockTime
+	}
+	return 0
+}
+
+func (x *Event) GetEvent() isEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *Event) GetSwap() *SwapEvent {
+	if x != nil {
+		if x, ok := x.Event.(*Event_Swap); ok {
+			return x.Swap
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetPair() *PairEvent {
+	if x != nil {
+		if x, ok := x.Event.(*Event_Pair); ok {
+			return x.Pair
+		}
+	}
+	return nil
+}
+
+func (x *Event) GetGraduation() *GraduationEvent {
+	if x != nil {
+		if x, ok := x.Event.(*Event_Graduation); ok {
+			return x.Graduation
+		}
+	}
+	return nil
+}
+
+type isEvent_Event interface {
+	isEvent_Event()
+}
+
+type Event_Swap struct {
+	Swap *SwapEvent `protobuf:"bytes,4,opt,name=swap,proto3,oneof"`
+}
+
+type Event_Pair struct {
+	Pair *PairEvent `protobuf:"bytes,5,opt,name=pair,proto3,oneof"`
+}
+
+type Event_Graduation struct {
+	Graduation *GraduationEvent `protobuf:"bytes,6,opt,name=graduation,proto3,oneof"`
+}
+
+func (*Event_Swap) isEvent_Event() {}
+
+func (*Event_Pair) isEvent_Event() {}
+
+func (*Event_Graduation) isEvent_Event() {}
+
+type SwapEvent struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	SourceExchange string                 `protobuf:"bytes,1,opt,name=source_exchange,json=sourceExchange,proto3" json:"source_exchange,omitempty"`
+	AmmAccount     string                 `protobuf:"bytes,2,opt,name=amm_account,json=ammAccount,proto3" json:"amm_account,omitempty"`
+	BaseTokenMint  string                 `protobuf:"bytes,3,opt,name=base_token_mint,json=baseTokenMint,proto3" json:"base_token_mint,omitempty"`
+	QuoteTokenMint string                 `protobuf:"bytes,4,opt,name=quote_token_mint,json=quoteTokenMint,proto3" json:"quote_token_mint,omitempty"`
+	WalletAccount  string                 `protobuf:"bytes,5,opt,name=wallet_account,json=walletAccount,proto3" json:"wallet_account,omitempty"`
+	// buy or sell of the base token
+	SwapType    string `protobuf:"bytes,6,opt,name=swap_type,json=swapType,proto3" json:"swap_type,omitempty"`
+	BaseAmount  string `protobuf:"bytes,7,opt,name=base_amount,json=baseAmount,proto3" json:"base_amount,omitempty"`
+	QuoteAmount string `protobuf:"bytes,8,opt,name=quote_amount,json=quoteAmount,proto3" json:"quote_amount,omitempty"`
+	// pool reserves after the swap, empty when unknown
+	BaseReserve   string     `protobuf:"bytes,9,opt,name=base_reserve,json=baseReserve,proto3" json:"base_reserve,omitempty"`
+	QuoteReserve  string     `protobuf:"bytes,10,opt,name=quote_reserve,json=quoteReserve,proto3" json:"quote_reserve,omitempty"`
+	Launchpad     *Launchpad `protobuf:"bytes,11,opt,name=launchpad,proto3" json:"launchpad,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SwapEvent) Reset() {
+	*x = SwapEvent{}
+	mi := &file_events_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SwapEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SwapEvent) ProtoMessage() {}
+
+func (x *SwapEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_events_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SwapEvent.ProtoReflect.Descriptor instead.
+func (*SwapEvent) Descriptor() ([]byte, []int) {
+	return file_events_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *SwapEvent) GetSourceExchange() string {
+	if x != nil {
+		return x.SourceExchange
+	}
+	return ""
+}
+
+func (x *SwapEvent) GetAmmAccount() string {
+	if x != nil {
+		return x.AmmAccount
+	}
+	return ""
+}
+
+func (x *SwapEvent) GetBaseTokenMint() string {
+	if x != nil {
+		return x.BaseTokenMint
+	}
+	return ""
+}
+
+func (x *SwapEvent) GetQuoteTokenMint() string {
+	if x != nil {
+		return x.QuoteTokenMint
+	}
+	return ""
+}
+
+func (x *SwapEvent) GetWalletAccount() string {
+	if x != nil {
+		return x.WalletAccount
+	}
+	return ""
+}
+
+func (x *SwapEvent) GetSwapType() string {
+	if x != nil {
+		return x.SwapType
+	}
+	return ""
+}
+
+func (x *SwapEvent) GetBaseAmount() string {
+	if x != nil {
+		return x.BaseAmount
+	}
+	return ""
+}
+
+func (x *SwapEvent) GetQuoteAmount() string {
+	if x != nil {
+		return x.QuoteAmount
+	}
+	return ""
+}
+
+func (x *SwapEvent) GetBaseReserve() string {
+	if x != nil {
+		return x.BaseReserve
+	}
+	return ""
+}
+
+func (x *SwapEvent) GetQuoteReserve() string {
+	if x != nil {
+		return x.QuoteReserve
+	}
+	return ""
+}
+
+func (x *SwapEvent) GetLaunchpad() *Launchpad {
+	if x != nil {
+		return x.Launchpad
+	}
+	return nil
+}
+
+type PairEvent struct {
+	state                    protoimpl.MessageState `protogen:"open.v1"`
+	SourceExchange           string                 `protobuf:"bytes,1,opt,name=source_exchange,json=sourceExchange,proto3" json:"source_exchange,omitempty"`
+	AmmAccount               string                 `protobuf:"bytes,2,opt,name=amm_account,json=ammAccount,proto3" json:"amm_account,omitempty"`
+	BaseTokenMint            string                 `protobuf:"bytes,3,opt,name=base_token_mint,json=baseTokenMint,proto3" json:"base_token_mint,omitempty"`
+	BaseTokenLiquidityAdded  string                 `protobuf:"bytes,4,opt,name=base_token_liquidity_added,json=baseTokenLiquidityAdded,proto3" json:"base_token_liquidity_added,omitempty"`
+	QuoteTokenLiquidityAdded string                 `protobuf:"bytes,5,opt,name=quote_token_liquidity_added,json=quoteTokenLiquidityAdded,proto3" json:"quote_token_liquidity_added,omitempty"`
+	Launchpad                *Launchpad             `protobuf:"bytes,6,opt,name=launchpad,proto3" json:"launchpad,omitempty"`
+	unknownFields            protoimpl.UnknownFields
+	sizeCache                protoimpl.SizeCache
+}
+
+func (x *PairEvent) Reset() {
+	*x = PairEvent{}
+	mi := &file_events_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PairEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PairEvent) ProtoMessage() {}
+
+func (x *PairEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_events_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PairEvent.ProtoReflect.Descriptor instead.
+func (*PairEvent) Descriptor() ([]byte, []int) {
+	return file_events_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *PairEvent) GetSourceExchange() string {
+	if x != nil {
+		return x.SourceExchange
+	}
+	return ""
+}
+
+func (x *PairEvent) GetAmmAccount() string {
+	if x != nil {
+		return x.AmmAccount
+	}
+	return ""
+}
+
+func (x *PairEvent) GetBaseTokenMint() string {
+	if x != nil {
+		return x.BaseTokenMint
+	}
+	return ""
+}
+
+func (x *PairEvent) GetBaseTokenLiquidityAdded() string {
+	if x != nil {
+		return x.BaseTokenLiquidityAdded
+	}
+	return ""
+}
+
+func (x *PairEvent) GetQuoteTokenLiquidityAdded() string {
+	if x != nil {
+		return x.QuoteTokenLiquidityAdded
+	}
+	return ""
+}
+
+func (x *PairEvent) GetLaunchpad() *Launchpad {
+	if x != nil {
+		return x.Launchpad
+	}
+	return nil
+}
+
+// GraduationEvent is a launchpad token completing its bonding curve and
+// migrating to an AMM
+type GraduationEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Launchpad     string                 `protobuf:"bytes,1,opt,name=launchpad,proto3" json:"launchpad,omitempty"`
+	BaseTokenMint string                 `protobuf:"bytes,2,opt,name=base_token_mint,json=baseTokenMint,proto3" json:"base_token_mint,omitempty"`
+	BondingCurve  string                 `protobuf:"bytes,3,opt,name=bonding_curve,json=bondingCurve,proto3" json:"bonding_curve,omitempty"`
+	AmmAccount    string                 `protobuf:"bytes,4,opt,name=amm_account,json=ammAccount,proto3" json:"amm_account,omitempty"`
+	Creator       string                 `protobuf:"bytes,5,opt,name=creator,proto3" json:"creator,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GraduationEvent) Reset() {
+	*x = GraduationEvent{}
+	mi := &file_events_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GraduationEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GraduationEvent) ProtoMessage() {}
+
+func (x *GraduationEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_events_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GraduationEvent.ProtoReflect.Descriptor instead.
+func (*GraduationEvent) Descriptor() ([]byte, []int) {
+	return file_events_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *GraduationEvent) GetLaunchpad() string {
+	if x != nil {
+		return x.Launchpad
+	}
+	return ""
+}
+
+func (x *GraduationEvent) GetBaseTokenMint() string {
+	if x != nil {
+		return x.BaseTokenMint
+	}
+	return ""
+}
+
+func (x *GraduationEvent) GetBondingCurve() string {
+	if x != nil {
+		return x.BondingCurve
+	}
+	return ""
+}
+
+func (x *GraduationEvent) GetAmmAccount() string {
+	if x != nil {
+		return x.AmmAccount
+	}
+	return ""
+}
+
+func (x *GraduationEvent) GetCreator() string {
+	if x != nil {
+		return x.Creator
+	}
+	return ""
+}
+
+// Launchpad is set on pairs and swaps of tokens from launchpads such as
+// Pump.fun
+type Launchpad struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	Name         string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	BondingCurve string                 `protobuf:"bytes,2,opt,name=bonding_curve,json=bondingCurve,proto3" json:"bonding_curve,omitempty"`
+	// percent complete
+	BondingCurveProgress float64 `protobuf:"fixed64,3,opt,name=bonding_curve_progress,json=bondingCurveProgress,proto3" json:"bonding_curve_progress,omitempty"`
+	Creator              string  `protobuf:"bytes,4,opt,name=creator,proto3" json:"creator,omitempty"`
+	Graduated            bool    `protobuf:"varint,5,opt,name=graduated,proto3" json:"graduated,omitempty"`
+	unknownFields        protoimpl.UnknownFields
+	sizeCache            protoimpl.SizeCache
+}
+
+func (x *Launchpad) Reset() {
+	*x = Launchpad{}
+	mi := &file_events_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Launchpad) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Launchpad) ProtoMessage() {}
+
+func (x *Launchpad) ProtoReflect() protoreflect.Message {
+	mi := &file_events_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Launchpad.ProtoReflect.Descriptor instead.
+func (*Launchpad) Descriptor() ([]byte, []int) {
+	return file_events_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Launchpad) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Launchpad) GetBondingCurve() string {
+	if x != nil {
+		return x.BondingCurve
+	}
+	return ""
+}
+
+func (x *Launchpad) GetBondingCurveProgress() float64 {
+	if x != nil {
+		return x.BondingCurveProgress
+	}
+	return 0
+}
+
+func (x *Launchpad) GetCreator() string {
+	if x != nil {
+		return x.Creator
+	}
+	return ""
+}
+
+func (x *Launchpad) GetGraduated() bool {
+	if x != nil {
+		return x.Graduated
+	}
+	return false
+}
+
+var File_events_proto protoreflect.FileDescriptor
+
+const file_events_proto_rawDesc = "" +
+	"\n" +
+	"\fevents.proto\x12\x12solanastreaming.v1\"\x92\x02\n" +
+	"\x05Event\x12\x12\n" +
+	"\x04slot\x18\x01 \x01(\x04R\x04slot\x12\x1c\n" +
+	"\tsignature\x18\x02 \x01(\tR\tsignature\x12\x1d\n" +
+	"\n" +
+	"block_time\x18\x03 \x01(\x03R\tblockTime\x123\n" +
+	"\x04swap\x18\x04 \x01(\v2\x1d.solanastreaming.v1.SwapEventH\x00R\x04swap\x123\n" +
+	"\x04pair\x18\x05 \x01(\v2\x1d.solanastreaming.v1.PairEventH\x00R\x04pair\x12E\n" +
+	"\n" +
+	"graduation\x18\x06 \x01(\v2#.solanastreaming.v1.GraduationEventH\x00R\n" +
+	"graduationB\a\n" +
+	"\x05event\"\xb4\x03\n" +
+	"\tSwapEvent\x12'\n" +
+	"\x0fsource_exchange\x18\x01 \x01(\tR\x0esourceExchange\x12\x1f\n" +
+	"\vamm_account\x18\x02 \x01(\tR\n" +
+	"ammAccount\x12&\n" +
+	"\x0fbase_token_mint\x18\x03 \x01(\tR\rbaseTokenMint\x12(\n" +
+	"\x10quote_token_mint\x18\x04 \x01(\tR\x0equoteTokenMint\x12%\n" +
+	"\x0ewallet_account\x18\x05 \x01(\tR\rwalletAccount\x12\x1b\n" +
+	"\tswap_type\x18\x06 \x01(\tR\bswapType\x12\x1f\n" +
+	"\vbase_amount\x18\a \x01(\tR\n" +
+	"baseAmount\x12!\n" +
+	"\fquote_amount\x18\b \x01(\tR\vquoteAmount\x12!\n" +
+	"\fbase_reserve\x18\t \x01(\tR\vbaseReserve\x12#\n" +
+	"\rquote_reserve\x18\n" +
+	" \x01(\tR\fquoteReserve\x12;\n" +
+	"\tlaunchpad\x18\v \x01(\v2\x1d.solanastreaming.v1.LaunchpadR\tlaunchpad\"\xb6\x02\n" +
+	"\tPairEvent\x12'\n" +
+	"\x0fsource_exchange\x18\x01 \x01(\tR\x0esourceExchange\x12\x1f\n" +
+	"\vamm_account\x18\x02 \x01(\tR\n" +
+	"ammAccount\x12&\n" +
+	"\x0fbase_token_mint\x18\x03 \x01(\tR\rbaseTokenMint\x12;\n" +
+	"\x1abase_token_liquidity_added\x18\x04 \x01(\tR\x17baseTokenLiquidityAdded\x12=\n" +
+	"\x1bquote_token_liquidity_added\x18\x05 \x01(\tR\x18quoteTokenLiquidityAdded\x12;\n" +
+	"\tlaunchpad\x18\x06 \x01(\v2\x1d.solanastreaming.v1.LaunchpadR\tlaunchpad\"\xb7\x01\n" +
+	"\x0fGraduationEvent\x12\x1c\n" +
+	"\tlaunchpad\x18\x01 \x01(\tR\tlaunchpad\x12&\n" +
+	"\x0fbase_token_mint\x18\x02 \x01(\tR\rbaseTokenMint\x12#\n" +
+	"\rbonding_curve\x18\x03 \x01(\tR\fbondingCurve\x12\x1f\n" +
+	"\vamm_account\x18\x04 \x01(\tR\n" +
+	"ammAccount\x12\x18\n" +
+	"\acreator\x18\x05 \x01(\tR\acreator\"\xb2\x01\n" +
+	"\tLaunchpad\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12#\n" +
+	"\rbonding_curve\x18\x02 \x01(\tR\fbondingCurve\x124\n" +
+	"\x16bonding_curve_progress\x18\x03 \x01(\x01R\x14bondingCurveProgress\x12\x18\n" +
+	"\acreator\x18\x04 \x01(\tR\acreator\x12\x1c\n" +
+	"\tgraduated\x18\x05 \x01(\bR\tgraduatedB<Z:github.com/solanastreaming/solanastreaming-cli/cmd/eventpbb\x06proto3"
+
+var (
+	file_events_proto_rawDescOnce sync.Once
+	file_events_proto_rawDescData []byte
+)
+
+func file_events_proto_rawDescGZIP() []byte {
+	file_events_proto_rawDescOnce.Do(func() {
+		file_events_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_events_proto_rawDesc), len(file_events_proto_rawDesc)))
+	})
+	return file_events_proto_rawDescData
+}
+
+var file_events_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_events_proto_goTypes = []any{
+	(*Event)(nil),           // 0: solanastreaming.v1.Event
+	(*SwapEvent)(nil),       // 1: solanastreaming.v1.SwapEvent
+	(*PairEvent)(nil),       // 2: solanastreaming.v1.PairEvent
+	(*GraduationEvent)(nil), // 3: solanastreaming.v1.GraduationEvent
+	(*Launchpad)(nil),       // 4: solanastreaming.v1.Launchpad
+}
+var file_events_proto_depIdxs = []int32{
+	1, // 0: solanastreaming.v1.Event.swap:type_name -> solanastreaming.v1.SwapEvent
+	2, // 1: solanastreaming.v1.Event.pair:type_name -> solanastreaming.v1.PairEvent
+	3, // 2: solanastreaming.v1.Event.graduation:type_name -> solanastreaming.v1.GraduationEvent
+	4, // 3: solanastreaming.v1.SwapEvent.launchpad:type_name -> solanastreaming.v1.Launchpad
+	4, // 4: solanastreaming.v1.PairEvent.launchpad:type_name -> solanastreaming.v1.Launchpad
+	5, // [5:5] is the sub-list for method output_type
+	5, // [5:5] is the sub-list for method input_type
+	5, // [5:5] is the sub-list for extension type_name
+	5, // [5:5] is the sub-list for extension extendee
+	0, // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_events_proto_init() }
+func file_events_proto_init() {
+	if File_events_proto != nil {
+		return
+	}
+	file_events_proto_msgTypes[0].OneofWrappers = []any{
+		(*Event_Swap)(nil),
+		(*Event_Pair)(nil),
+		(*Event_Graduation)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_events_proto_rawDesc), len(file_events_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   5,
+			NumExtensions: 0,
+			NumServices:   0,
+		},
+		GoTypes:           file_events_proto_goTypes,
+		DependencyIndexes: file_events_proto_depIdxs,
+		MessageInfos:      file_events_proto_msgTypes,
+	}.Build()
+	File_events_proto = out.File
+	file_events_proto_goTypes = nil
+	file_events_proto_depIdxs = nil
+}
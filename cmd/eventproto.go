@@ -0,0 +1,69 @@
+package main
+
+import (
+	"github.com/solanastreaming/solanastreaming-cli/cmd/eventpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// How events are encoded for sinks
+const (
+	EncodingJSON  = "json"
+	EncodingProto = "proto"
+)
+
+//go:generate protoc --go_out=eventpb --go_opt=paths=source_relative events.proto
+
+// marshalEventProto encodes the event as the Event message of events.proto
+func marshalEventProto(event EventRow) ([]byte, error) {
+	msg := &eventpb.Event{Slot: event.Slot, Signature: event.Sig, BlockTime: event.BlockTime}
+	switch {
+	case event.Swap != nil:
+		v := event.Swap
+		msg.Event = &eventpb.Event_Swap{Swap: &eventpb.SwapEvent{
+			SourceExchange: v.SourceExchange,
+			AmmAccount:     v.AmmAccount,
+			BaseTokenMint:  v.BaseTokenMint,
+			QuoteTokenMint: v.QuoteTokenMint,
+			WalletAccount:  v.WalletAccount,
+			SwapType:       v.SwapType,
+			BaseAmount:     string(v.BaseAmount),
+			QuoteAmount:    string(v.QuoteAmount),
+			BaseReserve:    string(v.BaseReserve),
+			QuoteReserve:   string(v.QuoteReserve),
+			Launchpad:      launchpadProto(v.Launchpad),
+		}}
+	case event.Pair != nil:
+		v := event.Pair
+		msg.Event = &eventpb.Event_Pair{Pair: &eventpb.PairEvent{
+			SourceExchange:           v.SourceExchange,
+			AmmAccount:               v.AmmAccount,
+			BaseTokenMint:            v.BaseToken.Account,
+			BaseTokenLiquidityAdded:  string(v.BaseTokenLiquidityAdded),
+			QuoteTokenLiquidityAdded: string(v.QuoteTokenLiquidityAdded),
+			Launchpad:                launchpadProto(v.Launchpad),
+		}}
+	case event.Graduation != nil:
+		v := event.Graduation
+		msg.Event = &eventpb.Event_Graduation{Graduation: &eventpb.GraduationEvent{
+			Launchpad:     v.Launchpad,
+			BaseTokenMint: v.BaseTokenMint,
+			BondingCurve:  v.BondingCurve,
+			AmmAccount:    v.AmmAccount,
+			Creator:       v.Creator,
+		}}
+	}
+	return proto.Marshal(msg)
+}
+
+func launchpadProto(v *LaunchpadInfo) *eventpb.Launchpad {
+	if v == nil {
+		return nil
+	}
+	return &eventpb.Launchpad{
+		Name:                 v.Name,
+		BondingCurve:         v.BondingCurve,
+		BondingCurveProgress: v.BondingCurveProgress,
+		Creator:              v.Creator,
+		Graduated:            v.Graduated,
+	}
+}
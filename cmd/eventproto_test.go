@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/solanastreaming/solanastreaming-cli/cmd/eventpb"
+	"github.com/test-go/testify/assert"
+	"google.golang.org/protobuf/proto"
+)
+
+// decodeEventProto decodes a message with the types generated from
+// events.proto
+func decodeEventProto(t *testing.T, raw []byte) *eventpb.Event {
+	t.Helper()
+	msg := &eventpb.Event{}
+	assert.Nil(t, proto.Unmarshal(raw, msg))
+	return msg
+}
+
+// assertProto compares messages with proto.Equal, as their internal state
+// differs
+func assertProto(t *testing.T, expected proto.Message, actual proto.Message) {
+	t.Helper()
+	assert.True(t, proto.Equal(expected, actual), "expected %v, got %v", expected, actual)
+}
+
+func TestMarshalEventProto(t *testing.T) {
+	event := EventRow{}
+	assert.Nil(t, unmarshalEvent([]byte(`{"slot":300,"signature":"sig","blockTime":1714910400,"swap":{"sourceExchange":"pumpfun","ammAccount":"amm","baseTokenMint":"mint","quoteTokenMint":"sol","walletAccount":"wallet","swapType":"buy","baseAmount":"100000000000000000001","quoteAmount":2,"launchpad":{"name":"pump","bondingCurveProgress":12.5,"graduated":true}}}`), &event))
+	raw, err := marshalEventProto(event)
+	assert.Nil(t, err)
+	assertProto(t, &eventpb.Event{
+		Slot:      300,
+		Signature: "sig",
+		BlockTime: 1714910400,
+		Event: &eventpb.Event_Swap{Swap: &eventpb.SwapEvent{
+			SourceExchange: "pumpfun",
+			AmmAccount:     "amm",
+			BaseTokenMint:  "mint",
+			QuoteTokenMint: "sol",
+			WalletAccount:  "wallet",
+			SwapType:       "buy",
+			BaseAmount:     "100000000000000000001",
+			QuoteAmount:    "2",
+			Launchpad:      &eventpb.Launchpad{Name: "pump", BondingCurveProgress: 12.5, Graduated: true},
+		}},
+	}, decodeEventProto(t, raw))
+
+	event = EventRow{}
+	assert.Nil(t, unmarshalEvent([]byte(`{"slot":2,"pair":{"ammAccount":"amm","baseToken":{"account":"mint"},"quoteTokenLiquidityAdded":"5"}}`), &event))
+	raw, err = marshalEventProto(event)
+	assert.Nil(t, err)
+	assertProto(t, &eventpb.Event{
+		Slot:  2,
+		Event: &eventpb.Event_Pair{Pair: &eventpb.PairEvent{AmmAccount: "amm", BaseTokenMint: "mint", QuoteTokenLiquidityAdded: "5"}},
+	}, decodeEventProto(t, raw))
+
+	// an empty event is still sent as the field of its type
+	raw, err = marshalEventProto(EventRow{Graduation: &GraduationEvent{}})
+	assert.Nil(t, err)
+	assert.NotNil(t, decodeEventProto(t, raw).GetGraduation())
+}
+
+func TestReplayWebhookProto(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{\"swapType\":\"buy\"}}\n{\"slot\":3,\"swap\":{\"swapType\":\"sell\"}}\n",
+	})
+	mu := sync.Mutex{}
+	received := []*eventpb.Event{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.Equal(t, ContentTypeProto, r.Header.Get("Content-Type"))
+		raw, _ := io.ReadAll(r.Body)
+		received = append(received, decodeEventProto(t, raw))
+	}))
+	defer server.Close()
+
+	task := NewReplayWebhookTask()
+	task.replay.dataDir = dataDir
+	task.replay.rate = "0"
+	task.replay.concurrency = 1
+	task.replay.encoding = EncodingProto
+	// fields changed by the transform are encoded
+	task.replay.transform.expression = `.swap.swapType |= "x" + .`
+	task.params.url = server.URL
+	task.params.timeout = time.Second
+	assert.Nil(t, task.Execute(context.Background()))
+	assert.Len(t, received, 2)
+	assertProto(t, &eventpb.Event{Slot: 1, Event: &eventpb.Event_Swap{Swap: &eventpb.SwapEvent{SwapType: "xbuy"}}}, received[0])
+	assertProto(t, &eventpb.Event{Slot: 3, Event: &eventpb.Event_Swap{Swap: &eventpb.SwapEvent{SwapType: "xsell"}}}, received[1])
+
+	task.replay.encoding = "avro"
+	assert.NotNil(t, task.Execute(context.Background()))
+	exec := NewReplayExecTask()
+	exec.replay.dataDir = dataDir
+	exec.replay.rate = "0"
+	exec.replay.concurrency = 1
+	exec.replay.encoding = EncodingProto
+	exec.exec.command = "cat"
+	assert.NotNil(t, exec.Execute(context.Background()))
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// Errors are classified into kinds so wrapper scripts can branch on the exit
+// code, or the type in --error-format json output, instead of the message.
+// Kinds are dotted, the part before the dot is the category.
+var (
+	ErrUsage           = errors.New("invalid usage")
+	ErrAuth            = errors.New("authentication failed")
+	ErrPaymentRequired = errors.New("payment required or order expired")
+	ErrPartialDownload = errors.New("download incomplete")
+	ErrDataCorruption  = errors.New("data is corrupt")
+	ErrNoRows          = errors.New("no rows matched")
+)
+
+const (
+	ExitOK              = 0
+	ExitError           = 1
+	ExitUsage           = 2
+	ExitAuth            = 3
+	ExitPaymentRequired = 4
+	ExitPartialDownload = 5
+	ExitDataCorruption  = 6
+	ExitNoRows          = 7
+	ExitDiskBudget      = 8
+	ExitTimeout         = 9
+	ExitLocked          = 10
+	ExitTransientIO     = 11
+	ExitSchemaVersion   = 12
+)
+
+const (
+	ErrorFormatText = "text"
+	ErrorFormatJSON = "json"
+)
+
+type errorKind struct {
+	err  error
+	Type string
+	Code int
+}
+
+// errorKinds in the order they are matched, the first kind in an error's
+// chain wins e.g. a partial download caused by an expired order is reported
+// as payment required
+var errorKinds = []errorKind{
+	{ErrUsage, "usage", ExitUsage},
+	{ErrAuth, "api.auth", ExitAuth},
+	{ErrPaymentRequired, "api.payment_required", ExitPaymentRequired},
+	{ErrDiskBudget, "disk.budget", ExitDiskBudget},
+	{ErrDataCorruption, "data.corrupt", ExitDataCorruption},
+	{zip.ErrFormat, "data.corrupt", ExitDataCorruption},
+	{zip.ErrChecksum, "data.corrupt", ExitDataCorruption},
+	{ErrTransientIO, "data.io", ExitTransientIO},
+	{ErrSchemaVersion, "data.schema", ExitSchemaVersion},
+	{ErrPartialDownload, "download.partial", ExitPartialDownload},
+	{ErrNoRows, "result.empty", ExitNoRows},
+	{ErrTimeout, "task.timeout", ExitTimeout},
+	{ErrStalled, "task.stalled", ExitTimeout},
+	{ErrLocked, "dir.locked", ExitLocked},
+}
+
+// kindError is an error of a kind which keeps the original error's chain
+type kindError struct {
+	kind error
+	err  error
+}
+
+// withKind marks err as being of kind
+func withKind(kind error, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &kindError{kind: kind, err: err}
+}
+
+func (o *kindError) Error() string {
+	return o.err.Error()
+}
+
+func (o *kindError) Unwrap() []error {
+	return []error{o.kind, o.err}
+}
+
+// classifyError returns the kind of err
+func classifyError(err error) errorKind {
+	for _, v := range errorKinds {
+		if errors.Is(err, v.err) {
+			return v
+		}
+	}
+	return errorKind{Type: "error", Code: ExitError}
+}
+
+// statusCodeError is an unexpected API response status
+type statusCodeError int
+
+func (o statusCodeError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", int(o))
+}
+
+// isServerError returns whether err is a 5xx API response
+func isServerError(err error) bool {
+	var status statusCodeError
+	return errors.As(err, &status) && status >= 500
+}
+
+// statusError returns the error for an unexpected API response status
+func statusError(status int) error {
+	err := error(statusCodeError(status))
+	switch status {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return withKind(ErrAuth, errors.Wrap(err, "check your API key"))
+	case http.StatusPaymentRequired:
+		return withKind(ErrPaymentRequired, err)
+	}
+	return err
+}
+
+// reportError writes err in the format and returns the exit code for it
+func reportError(w io.Writer, err error, format string) int {
+	kind := classifyError(err)
+	if format == ErrorFormatJSON {
+		raw, _ := json.Marshal(map[string]any{
+			"error": map[string]any{
+				"type":      kind.Type,
+				"exit_code": kind.Code,
+				"message":   err.Error(),
+			},
+		})
+		fmt.Fprintln(w, string(raw))
+	} else {
+		fmt.Fprintln(w, err)
+	}
+	return kind.Code
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/test-go/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	assert.Equal(t, ExitAuth, classifyError(statusError(http.StatusUnauthorized)).Code)
+	assert.Equal(t, ExitPaymentRequired, classifyError(statusError(http.StatusPaymentRequired)).Code)
+	assert.Equal(t, ExitError, classifyError(statusError(http.StatusInternalServerError)).Code)
+	assert.Equal(t, ExitError, classifyError(errors.New("boom")).Code)
+	assert.Equal(t, ExitDiskBudget, classifyError((&diskBudget{limit: 1}).Reserve(2)).Code)
+
+	// wrapping keeps the kind and the cause
+	err := errors.Wrap(withKind(ErrPartialDownload, ErrPaymentRequired), "downloading")
+	assert.Equal(t, "api.payment_required", classifyError(err).Type)
+	err = withKind(ErrPartialDownload, errors.New("timeout"))
+	assert.Equal(t, ExitPartialDownload, classifyError(err).Code)
+	assert.Equal(t, "timeout", err.Error())
+	assert.Nil(t, withKind(ErrUsage, nil))
+}
+
+func TestReportErrorJSON(t *testing.T) {
+	out := bytes.Buffer{}
+	code := reportError(&out, withKind(ErrNoRows, fmt.Errorf("nothing")), ErrorFormatJSON)
+	assert.Equal(t, ExitNoRows, code)
+	report := struct {
+		Error struct {
+			Type     string `json:"type"`
+			ExitCode int    `json:"exit_code"`
+			Message  string `json:"message"`
+		} `json:"error"`
+	}{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), &report))
+	assert.Equal(t, "result.empty", report.Error.Type)
+	assert.Equal(t, ExitNoRows, report.Error.ExitCode)
+	assert.Equal(t, "nothing", report.Error.Message)
+}
+
+func TestReduceNoRows(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": fmt.Sprintf(`{"slot":1,"swap":{"walletAccount":"%s"}}`+"\n", fixtureKey("wallet-a", "")),
+	})
+	task := NewReduceTask()
+	task.params.dataInDir = dataDir
+	task.params.dataOutDir = t.TempDir()
+	task.params.concurrency = 1
+	task.params.wallets = fixtureKey("wallet-b", "")
+	err := task.Execute(context.Background())
+	assert.Equal(t, ExitNoRows, classifyError(err).Code)
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"encoding/binary"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// defaultSortMemory is used when --max-memory is not set
+const defaultSortMemory = 512 * 1000 * 1000
+
+// sortMemory is how many bytes of rows a sort holds in memory before spilling
+// a sorted run to disk. Set with --max-memory.
+var sortMemory int64 = defaultSortMemory
+
+// approximate per row overhead of the in memory buffer
+const sortRowOverhead = 64
+
+type sortItem struct {
+	key []byte
+	row []byte
+}
+
+// rowSorter sorts rows by a key in bounded memory. Rows are buffered until
+// the memory limit, then sorted and spilled to a run file in tmpDir. The runs
+// are merged when read back. Rows with equal keys keep the order they were
+// added in.
+type rowSorter struct {
+	key    func(row []byte) []byte
+	tmpDir string
+	limit  int64
+	items  []sortItem
+	size   int64
+	added  uint64
+	runs   []string
+}
+
+func newRowSorter(tmpDir string, key func(row []byte) []byte) *rowSorter {
+	return &rowSorter{
+		key:    key,
+		tmpDir: tmpDir,
+		limit:  sortMemory,
+	}
+}
+
+// slotSortKey orders rows by slot
+func slotSortKey(row []byte) []byte {
+	return binary.BigEndian.AppendUint64(nil, rowSlot(row))
+}
+
+func (o *rowSorter) Add(row []byte) error {
+	// the insertion order makes the sort stable
+	key := binary.BigEndian.AppendUint64(o.key(row), o.added)
+	o.added++
+	o.items = append(o.items, sortItem{key: key, row: bytes.Clone(row)})
+	o.size += int64(len(key) + len(row) + sortRowOverhead)
+	if o.size >= o.limit {
+		return o.spill()
+	}
+	return nil
+}
+
+func (o *rowSorter) sortItems() {
+	slices.SortFunc(o.items, func(a, b sortItem) int {
+		return bytes.Compare(a.key, b.key)
+	})
+}
+
+// spill writes the buffered rows to a sorted run. Runs are written with
+// createArchive so they are encrypted and count towards --max-disk like
+// everything else written.
+func (o *rowSorter) spill() error {
+	o.sortItems()
+	f, err := os.CreateTemp(o.tmpDir, "ss-cli-sort-*.run")
+	if err != nil {
+		return errors.Wrap(err, "cant create sort run")
+	}
+	path := f.Name()
+	f.Close()
+	o.runs = append(o.runs, path)
+	out, err := createArchive(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(out)
+	for _, v := range o.items {
+		w.Write(binary.AppendUvarint(nil, uint64(len(v.key))))
+		w.Write(v.key)
+		w.Write(binary.AppendUvarint(nil, uint64(len(v.row))))
+		if _, err := w.Write(v.row); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	logrus.Debugf("spilled %d rows to sort run %s", len(o.items), path)
+	o.items = nil
+	o.size = 0
+	return nil
+}
+
+// Each calls fn with every row in key order and removes the runs
+func (o *rowSorter) Each(fn func(row []byte) error) error {
+	defer o.Close()
+	if len(o.runs) == 0 {
+		o.sortItems()
+		for _, v := range o.items {
+			if err := fn(v.row); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if len(o.items) != 0 {
+		if err := o.spill(); err != nil {
+			return err
+		}
+	}
+
+	runs := &sortRuns{}
+	for _, path := range o.runs {
+		reader, size, closer, err := openArchiveFile(path)
+		if err != nil {
+			return err
+		}
+		defer closer.Close()
+		run := &sortRun{r: bufio.NewReader(io.NewSectionReader(reader, 0, size))}
+		if ok, err := run.next(); err != nil {
+			return err
+		} else if ok {
+			heap.Push(runs, run)
+		}
+	}
+	for runs.Len() != 0 {
+		run := (*runs)[0]
+		if err := fn(run.row); err != nil {
+			return err
+		}
+		ok, err := run.next()
+		if err != nil {
+			return err
+		}
+		if ok {
+			heap.Fix(runs, 0)
+		} else {
+			heap.Pop(runs)
+		}
+	}
+	return nil
+}
+
+// Close removes any runs
+func (o *rowSorter) Close() {
+	for _, v := range o.runs {
+		if info, err := os.Stat(v); err == nil {
+			diskUsage.Release(info.Size())
+		}
+		os.Remove(v)
+	}
+	o.runs = nil
+	o.items = nil
+}
+
+// sortRun reads back a spilled run
+type sortRun struct {
+	r   *bufio.Reader
+	key []byte
+	row []byte
+}
+
+func (o *sortRun) next() (bool, error) {
+	read := func() ([]byte, error) {
+		n, err := binary.ReadUvarint(o.r)
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, n)
+		_, err = io.ReadFull(o.r, buf)
+		return buf, err
+	}
+	key, err := read()
+	if err == io.EOF {
+		return false, nil
+	}
+	if err != nil {
+		return false, errors.Wrap(err, "cant read sort run")
+	}
+	row, err := read()
+	if err != nil {
+		return false, errors.Wrap(err, "cant read sort run")
+	}
+	o.key = key
+	o.row = row
+	return true, nil
+}
+
+// sortRuns is a heap of runs by their next key
+type sortRuns []*sortRun
+
+func (o sortRuns) Len() int           { return len(o) }
+func (o sortRuns) Less(i, j int) bool { return bytes.Compare(o[i].key, o[j].key) < 0 }
+func (o sortRuns) Swap(i, j int)      { o[i], o[j] = o[j], o[i] }
+func (o *sortRuns) Push(x any)        { *o = append(*o, x.(*sortRun)) }
+func (o *sortRuns) Pop() any {
+	old := *o
+	v := old[len(old)-1]
+	*o = old[:len(old)-1]
+	return v
+}
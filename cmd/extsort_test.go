@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestRowSorterSpills(t *testing.T) {
+	for _, encrypted := range []bool{false, true} {
+		if encrypted {
+			archiveKey = make([]byte, 32)
+		}
+		tmpDir := t.TempDir()
+		sorter := newRowSorter(tmpDir, slotSortKey)
+		sorter.limit = 2000
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < 500; i++ {
+			assert.Nil(t, sorter.Add([]byte(fmt.Sprintf(`{"slot":%d,"n":%d}`, rng.Intn(50), i))))
+		}
+		assert.True(t, len(sorter.runs) > 1)
+
+		last := uint64(0)
+		lastN := -1
+		count := 0
+		err := sorter.Each(func(row []byte) error {
+			slot := rowSlot(row)
+			n := 0
+			fmt.Sscanf(string(row), `{"slot":%d,"n":%d}`, new(int), &n)
+			assert.True(t, slot >= last)
+			// equal slots keep the order they were added in
+			if slot == last {
+				assert.True(t, n > lastN)
+			}
+			last, lastN = slot, n
+			count++
+			return nil
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, 500, count)
+		// the runs are removed
+		runs, _ := filepath.Glob(filepath.Join(tmpDir, "*"))
+		assert.Empty(t, runs)
+		archiveKey = nil
+	}
+}
+
+func TestSortTask(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":3,\"swap\":{}}\n{\"slot\":1,\"swap\":{}}\n\n{\"slot\":2,\"swap\":{}}\n",
+	})
+	sortMemory = 100
+	defer func() { sortMemory = defaultSortMemory }()
+
+	task := NewSortTask()
+	task.params.dataDir = dataDir
+	task.params.tmpDir = t.TempDir()
+	assert.Nil(t, task.Execute(context.Background()))
+
+	slots := []uint64{}
+	assert.Nil(t, readArchiveRows(dataDir+"/20240505-120000.zip", func(row []byte) error {
+		slots = append(slots, rowSlot(row))
+		return nil
+	}))
+	assert.Equal(t, []uint64{1, 2, 3}, slots)
+	_, err := os.Stat(dataDir + "/20240505-120000.zip.partial")
+	assert.True(t, os.IsNotExist(err))
+}
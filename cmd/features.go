@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	FeatureTrades      = "trades"
+	FeatureBuys        = "buys"
+	FeatureSells       = "sells"
+	FeatureVolume      = "volume"
+	FeatureBuyers      = "buyers"
+	FeatureSellers     = "sellers"
+	FeatureWallets     = "wallets"
+	FeaturePrice       = "price"
+	FeaturePriceChange = "price_change"
+)
+
+// allFeatures is every feature in the order of the output columns
+var allFeatures = []string{FeatureTrades, FeatureBuys, FeatureSells, FeatureVolume, FeatureBuyers, FeatureSellers, FeatureWallets, FeaturePrice, FeaturePriceChange}
+
+type FeaturesTask struct {
+	layout   layoutOptions
+	window   time.Duration
+	features []string
+	mints    []string
+	windows  map[volumeKey]*featureWindow
+	// windows starting before this have been written and can no longer change
+	flushedUpTo time.Time
+	params      struct {
+		dataDir  string
+		window   string
+		features string
+		mints    string
+		format   string
+		output   string
+	}
+}
+
+// featureWindow accumulates the swaps of a mint in a window
+type featureWindow struct {
+	trades     uint64
+	buys       uint64
+	sells      uint64
+	volume     float64
+	buyers     map[string]struct{}
+	sellers    map[string]struct{}
+	wallets    map[string]struct{}
+	firstPrice float64
+	lastPrice  float64
+}
+
+func NewFeaturesTask() *FeaturesTask {
+	return &FeaturesTask{
+		windows: map[volumeKey]*featureWindow{},
+	}
+}
+
+func (o *FeaturesTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir to get the archive data from")
+	cmd.Flags().StringVarP(&o.params.window, "window", "w", "5m", "The size of each window e.g. 1m, 5m, 1h")
+	cmd.Flags().StringVar(&o.params.features, "features", strings.Join(allFeatures, ","), "The features to compute for each mint and window, any of: "+strings.Join(allFeatures, ", ")+". (Comma separated list)")
+	cmd.Flags().StringVar(&o.params.mints, "mints", "", "Only compute features for these base token mints. Defaults to all. (Comma separated list)")
+	cmd.Flags().StringVarP(&o.params.format, "format", "f", ReportFormatCSV, "Output format: csv, json or arrow")
+	cmd.Flags().StringVarP(&o.params.output, "output", "o", "", "File to write the feature matrix to, or the dir with --layout hive. Defaults to stdout")
+	o.layout.SetupParameters(cmd)
+}
+
+func (o *FeaturesTask) GetMeta() Meta {
+	return Meta{
+		Name:        "FeaturesTask",
+		Use:         "features",
+		Description: "Compute a feature matrix of swap activity per mint per time window from local archive files, e.g. for training models.",
+	}
+}
+
+func (o *FeaturesTask) Execute(ctx context.Context) error {
+	if err := o.validateParams(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+
+	w, out, err := o.layout.Open(o.params.output, o.params.format, append([]string{"window_start", "mint"}, o.features...), "window_start")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var missingTime, late uint64
+	for i, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logrus.Infof("computing features from file (%d of %d) %s", i+1, len(files), v)
+		var latest time.Time
+		err := readArchiveEvents(o.params.dataDir+"/"+v, []byte(`"swap"`), func(event EventRow) error {
+			if event.Swap == nil || (len(o.mints) != 0 && !inSlice(o.mints, event.Swap.BaseTokenMint)) {
+				return nil
+			}
+			if event.BlockTime == 0 {
+				missingTime++
+				return nil
+			}
+			eventTime := event.Time()
+			if eventTime.After(latest) {
+				latest = eventTime
+			}
+			start := eventTime.Truncate(o.window)
+			if start.Before(o.flushedUpTo) {
+				late++
+				return nil
+			}
+			o.add(volumeKey{start: start, group: event.Swap.BaseTokenMint}, event.Swap)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// as for volume, windows a full window before the latest event in
+		// this file are complete
+		if !latest.IsZero() {
+			if err := o.flush(w, latest.Add(-o.window).Truncate(o.window)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := o.flush(w, time.Time{}); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if missingTime > 0 {
+		logrus.Warnf("skipped %d swaps without a blockTime", missingTime)
+	}
+	if late > 0 {
+		logrus.Warnf("skipped %d swaps that arrived after their window was written. Check your archive files are consecutive", late)
+	}
+	return nil
+}
+
+func (o *FeaturesTask) add(key volumeKey, swap *SwapEvent) {
+	window, ok := o.windows[key]
+	if !ok {
+		window = &featureWindow{
+			buyers:  map[string]struct{}{},
+			sellers: map[string]struct{}{},
+			wallets: map[string]struct{}{},
+		}
+		o.windows[key] = window
+	}
+	window.trades++
+	window.volume += swap.QuoteAmount.Float64()
+	switch swap.SwapType {
+	case SwapTypeBuy:
+		window.buys++
+		window.buyers[swap.WalletAccount] = struct{}{}
+	case SwapTypeSell:
+		window.sells++
+		window.sellers[swap.WalletAccount] = struct{}{}
+	}
+	window.wallets[swap.WalletAccount] = struct{}{}
+	if base := swap.BaseAmount.Float64(); base > 0 {
+		if price := swap.QuoteAmount.Float64() / base; price > 0 {
+			if window.firstPrice == 0 {
+				window.firstPrice = price
+			}
+			window.lastPrice = price
+		}
+	}
+}
+
+// value returns a feature of the window. Price features of windows without
+// a priced swap are nil.
+func (o *featureWindow) value(feature string) any {
+	switch feature {
+	case FeatureTrades:
+		return o.trades
+	case FeatureBuys:
+		return o.buys
+	case FeatureSells:
+		return o.sells
+	case FeatureVolume:
+		return o.volume
+	case FeatureBuyers:
+		return len(o.buyers)
+	case FeatureSellers:
+		return len(o.sellers)
+	case FeatureWallets:
+		return len(o.wallets)
+	case FeaturePrice:
+		if o.lastPrice == 0 {
+			return nil
+		}
+		return o.lastPrice
+	case FeaturePriceChange:
+		if o.firstPrice == 0 {
+			return nil
+		}
+		return o.lastPrice/o.firstPrice - 1
+	}
+	return nil
+}
+
+// flush writes and forgets all windows starting before the given time, or all
+// windows if before is zero
+func (o *FeaturesTask) flush(w *recordWriter, before time.Time) error {
+	keys := []volumeKey{}
+	for k := range o.windows {
+		if before.IsZero() || k.start.Before(before) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].start.Equal(keys[j].start) {
+			return keys[i].start.Before(keys[j].start)
+		}
+		return keys[i].group < keys[j].group
+	})
+	for _, k := range keys {
+		window := o.windows[k]
+		values := []any{k.start.Format(time.RFC3339), k.group}
+		for _, v := range o.features {
+			values = append(values, window.value(v))
+		}
+		if err := w.Write(values...); err != nil {
+			return err
+		}
+		delete(o.windows, k)
+	}
+	if before.After(o.flushedUpTo) {
+		o.flushedUpTo = before
+	}
+	return nil
+}
+
+func (o *FeaturesTask) validateParams() error {
+	window, err := time.ParseDuration(o.params.window)
+	if err != nil {
+		return errors.Wrap(err, "invalid window")
+	}
+	if window < time.Second {
+		return errors.New("window must be at least 1s")
+	}
+	o.window = window
+	o.features = splitList(o.params.features)
+	if len(o.features) == 0 {
+		return errors.New("features must not be empty")
+	}
+	for _, v := range o.features {
+		if !inSlice(allFeatures, v) {
+			return fmt.Errorf("unknown feature %q, must be one of: %s", v, strings.Join(allFeatures, ", "))
+		}
+	}
+	o.mints = splitList(o.params.mints)
+	return o.layout.Validate(o.params.output)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestFeatures(t *testing.T) {
+	dataDir := t.TempDir()
+	// 1714910400 is 2024-05-05T12:00:00Z
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"blockTime":1714910400,"swap":{"baseTokenMint":"m1","walletAccount":"a","swapType":"buy","baseAmount":"10","quoteAmount":"20"}}
+{"slot":2,"blockTime":1714910410,"swap":{"baseTokenMint":"m1","walletAccount":"b","swapType":"buy","baseAmount":"10","quoteAmount":"30"}}
+{"slot":3,"blockTime":1714910420,"swap":{"baseTokenMint":"m1","walletAccount":"a","swapType":"sell","baseAmount":"5","quoteAmount":"15"}}
+{"slot":4,"blockTime":1714910430,"pair":{}}
+{"slot":5,"blockTime":1714910440,"swap":{"baseTokenMint":"m2","walletAccount":"c","swapType":"buy","baseAmount":"0","quoteAmount":"1"}}
+{"slot":6,"blockTime":1714910700,"swap":{"baseTokenMint":"m1","walletAccount":"c","swapType":"buy","baseAmount":"1","quoteAmount":"4"}}
+`,
+	})
+	task := NewFeaturesTask()
+	task.params.dataDir = dataDir
+	task.params.window = "5m"
+	task.params.features = "trades,volume,buyers,sellers,wallets,price,price_change"
+	task.params.format = ReportFormatCSV
+	task.params.output = t.TempDir() + "/features.csv"
+	assert.Nil(t, task.Execute(context.Background()))
+
+	raw, err := os.ReadFile(task.params.output)
+	assert.Nil(t, err)
+	assert.Equal(t, `window_start,mint,trades,volume,buyers,sellers,wallets,price,price_change
+2024-05-05T12:00:00Z,m1,3,65,2,1,2,3,0.5
+2024-05-05T12:00:00Z,m2,1,1,1,0,1,,
+2024-05-05T12:05:00Z,m1,1,4,1,0,1,4,0
+`, string(raw))
+
+	task.params.features = "trades,rsi"
+	assert.NotNil(t, task.Execute(context.Background()))
+}
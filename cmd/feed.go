@@ -0,0 +1,51 @@
+package main
+
+// Feed is a subscription channel the simulator replays from archive rows. To
+// support a new notification type implement Feed and add it to simulatorFeeds.
+type Feed interface {
+	// SubscribeMethod is the JSON RPC method clients subscribe with
+	SubscribeMethod() string
+	// NotificationMethod is the method notifications are sent with
+	NotificationMethod() string
+	// Matches reports whether an archive row belongs to this feed
+	Matches(row DataFormat) bool
+}
+
+const (
+	MethodPairLiquidityUpdatesSubscribe = "pairLiquidityUpdatesSubscribe"
+)
+
+// simulatorFeeds are all the feeds the simulator supports
+var simulatorFeeds = []Feed{
+	archiveFeed{MethodNewPairSubscribe, "newPairNotification", func(row DataFormat) bool { return row.Pair != nil }},
+	archiveFeed{MethodSwapSubscribe, "swapNotification", func(row DataFormat) bool { return row.Swap != nil }},
+	archiveFeed{MethodPairLiquidityUpdatesSubscribe, "pairLiquidityUpdatesNotification", func(row DataFormat) bool { return row.LiquidityUpdate != nil }},
+}
+
+// archiveFeed sends every row matching a predicate
+type archiveFeed struct {
+	subscribeMethod    string
+	notificationMethod string
+	matches            func(row DataFormat) bool
+}
+
+func (o archiveFeed) SubscribeMethod() string {
+	return o.subscribeMethod
+}
+
+func (o archiveFeed) NotificationMethod() string {
+	return o.notificationMethod
+}
+
+func (o archiveFeed) Matches(row DataFormat) bool {
+	return o.matches(row)
+}
+
+func findFeed(subscribeMethod string) Feed {
+	for _, v := range simulatorFeeds {
+		if v.SubscribeMethod() == subscribeMethod {
+			return v
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"sort"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type FirstBuyersTask struct {
+	// pairs still collecting buyers by amm account
+	launches   map[string]*launchBuyers
+	reported   uint
+	provenance provenanceOptions
+	params     struct {
+		dataDir  string
+		buyers   int
+		maxSlots uint64
+		format   string
+		output   string
+	}
+}
+
+type launchBuyers struct {
+	slot   uint64
+	amm    string
+	mint   string
+	seen   map[string]struct{}
+	buyers []firstBuyer
+}
+
+type firstBuyer struct {
+	wallet      string
+	slot        uint64
+	signature   string
+	baseAmount  Amount
+	quoteAmount Amount
+	// with --with-provenance
+	provenance []any
+}
+
+func NewFirstBuyersTask() *FirstBuyersTask {
+	return &FirstBuyersTask{
+		launches: map[string]*launchBuyers{},
+	}
+}
+
+func (o *FirstBuyersTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir to get the archive data from")
+	cmd.Flags().IntVarP(&o.params.buyers, "buyers", "n", 10, "How many distinct buyer wallets to list per new pair")
+	cmd.Flags().Uint64Var(&o.params.maxSlots, "max-slots", 0, "Stop collecting buyers for a pair this many slots after it was created. 0 means no limit")
+	cmd.Flags().StringVarP(&o.params.format, "format", "f", ReportFormatCSV, "Output format: csv, json or arrow")
+	cmd.Flags().StringVarP(&o.params.output, "output", "o", "", "File to write the report to. Defaults to stdout")
+	o.provenance.SetupParameters(cmd)
+}
+
+func (o *FirstBuyersTask) GetMeta() Meta {
+	return Meta{
+		Name:        "FirstBuyersTask",
+		Use:         "first-buyers",
+		Description: "List the first N buyer wallets and their amounts for each new pair.",
+	}
+}
+
+func (o *FirstBuyersTask) Execute(ctx context.Context) error {
+	if o.params.buyers < 1 {
+		return errors.New("buyers must be at least 1")
+	}
+
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+
+	out, err := openOutput(o.params.output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w, err := newRecordWriter(out, o.params.format, o.provenance.Columns([]string{"pair_slot", "amm", "mint", "rank", "wallet", "slot", "slots_after_launch", "base_amount", "quote_amount", "signature"}))
+	if err != nil {
+		return err
+	}
+
+	for i, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logrus.Infof("scanning file (%d of %d) %s", i+1, len(files), v)
+		err := o.provenance.ReadEvents(o.params.dataDir+"/"+v, nil, func(event EventRow, provenance []any) error {
+			return o.add(w, event, provenance)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// pairs that never reached N buyers are written with what they have
+	remaining := []*launchBuyers{}
+	for _, v := range o.launches {
+		remaining = append(remaining, v)
+	}
+	sort.Slice(remaining, func(i, j int) bool {
+		if remaining[i].slot != remaining[j].slot {
+			return remaining[i].slot < remaining[j].slot
+		}
+		return remaining[i].amm < remaining[j].amm
+	})
+	for _, v := range remaining {
+		if err := o.write(w, v); err != nil {
+			return err
+		}
+	}
+
+	logrus.Infof("reported first buyers for %d pairs", o.reported)
+	return w.Flush()
+}
+
+func (o *FirstBuyersTask) add(w *recordWriter, event EventRow, provenance []any) error {
+	if event.Pair != nil {
+		o.launches[event.Pair.AmmAccount] = &launchBuyers{
+			slot: event.Slot,
+			amm:  event.Pair.AmmAccount,
+			mint: event.Pair.BaseToken.Account,
+			seen: map[string]struct{}{},
+		}
+		return nil
+	}
+	if event.Swap == nil || event.Swap.SwapType != SwapTypeBuy {
+		return nil
+	}
+	launch, ok := o.launches[event.Swap.AmmAccount]
+	if !ok {
+		return nil
+	}
+	if o.params.maxSlots != 0 && event.Slot > launch.slot+o.params.maxSlots {
+		delete(o.launches, launch.amm)
+		return o.write(w, launch)
+	}
+	if _, ok := launch.seen[event.Swap.WalletAccount]; ok {
+		return nil
+	}
+	launch.seen[event.Swap.WalletAccount] = struct{}{}
+	launch.buyers = append(launch.buyers, firstBuyer{
+		wallet:      event.Swap.WalletAccount,
+		slot:        event.Slot,
+		signature:   event.Sig,
+		baseAmount:  event.Swap.BaseAmount,
+		quoteAmount: event.Swap.QuoteAmount,
+		provenance:  provenance,
+	})
+	if len(launch.buyers) < o.params.buyers {
+		return nil
+	}
+	delete(o.launches, launch.amm)
+	return o.write(w, launch)
+}
+
+func (o *FirstBuyersTask) write(w *recordWriter, launch *launchBuyers) error {
+	for i, v := range launch.buyers {
+		err := w.Write(append([]any{launch.slot, launch.amm, launch.mint, i + 1, v.wallet, v.slot, v.slot - launch.slot, string(v.baseAmount), string(v.quoteAmount), v.signature}, v.provenance...)...)
+		if err != nil {
+			return err
+		}
+	}
+	if len(launch.buyers) > 0 {
+		o.reported++
+	}
+	return nil
+}
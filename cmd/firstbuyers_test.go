@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestFirstBuyers(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"pairs.json": `{"slot":10,"pair":{"ammAccount":"A","baseToken":{"account":"a"}}}
+{"slot":10,"pair":{"ammAccount":"B","baseToken":{"account":"b"}}}
+`,
+		"swaps.json": `{"slot":9,"signature":"s1","swap":{"ammAccount":"A","walletAccount":"early","swapType":"buy"}}
+{"slot":11,"signature":"s2","swap":{"ammAccount":"A","walletAccount":"w1","swapType":"buy","baseAmount":"5","quoteAmount":"1"}}
+{"slot":12,"signature":"s3","swap":{"ammAccount":"A","walletAccount":"w2","swapType":"sell"}}
+{"slot":12,"signature":"s4","swap":{"ammAccount":"A","walletAccount":"w1","swapType":"buy"}}
+{"slot":13,"signature":"s5","swap":{"ammAccount":"B","walletAccount":"w1","swapType":"buy"}}
+{"slot":14,"signature":"s6","swap":{"ammAccount":"A","walletAccount":"w3","swapType":"buy","baseAmount":"7","quoteAmount":"2"}}
+{"slot":15,"signature":"s7","swap":{"ammAccount":"A","walletAccount":"w4","swapType":"buy"}}
+{"slot":40,"signature":"s8","swap":{"ammAccount":"B","walletAccount":"w5","swapType":"buy"}}
+`,
+	})
+
+	task := NewFirstBuyersTask()
+	task.params.dataDir = dataDir
+	task.params.buyers = 2
+	task.params.maxSlots = 20
+	task.params.format = ReportFormatCSV
+	task.params.output = filepath.Join(t.TempDir(), "buyers.csv")
+	assert.Nil(t, task.Execute(context.Background()))
+	raw, err := os.ReadFile(task.params.output)
+	assert.Nil(t, err)
+	// swaps before the pair, sells and repeat buyers are not counted, and B
+	// stops collecting after 20 slots with one buyer
+	assert.Equal(t, `pair_slot,amm,mint,rank,wallet,slot,slots_after_launch,base_amount,quote_amount,signature
+10,A,a,1,w1,11,1,5,1,s2
+10,A,a,2,w3,14,4,7,2,s6
+10,B,b,1,w1,13,3,,,s5
+`, string(raw))
+
+	task.params.buyers = 0
+	assert.NotNil(t, task.Execute(context.Background()))
+}
+
+// TestFirstBuyersFixtures lists the first buyers of each pair in the fixture
+// archives, checks them against the archives and compares the output to
+// testdata/first-buyers
+func TestFirstBuyersFixtures(t *testing.T) {
+	dataDir := copyFixtures(t)
+	// the first distinct buy wallets of each pair, and the swaps by signature
+	expected := map[string][]string{}
+	buys := map[string]SwapEvent{}
+	files, err := listArchiveFiles(dataDir)
+	assert.Nil(t, err)
+	for _, v := range files {
+		assert.Nil(t, readArchiveEvents(filepath.Join(dataDir, v), nil, func(event EventRow) error {
+			if event.Pair != nil {
+				expected[event.Pair.AmmAccount] = []string{}
+			}
+			if event.Swap == nil || event.Swap.SwapType != SwapTypeBuy {
+				return nil
+			}
+			buys[event.Sig] = *event.Swap
+			wallets, ok := expected[event.Swap.AmmAccount]
+			if ok && len(wallets) < 3 && !inSlice(wallets, event.Swap.WalletAccount) {
+				expected[event.Swap.AmmAccount] = append(wallets, event.Swap.WalletAccount)
+			}
+			return nil
+		}))
+	}
+
+	task := NewFirstBuyersTask()
+	task.params.dataDir = dataDir
+	task.params.buyers = 3
+	task.params.format = ReportFormatJSON
+	task.params.output = filepath.Join(t.TempDir(), "buyers.json")
+	assert.Nil(t, task.Execute(context.Background()))
+	raw, err := os.ReadFile(task.params.output)
+	assert.Nil(t, err)
+
+	listed := map[string][]string{}
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		row := struct {
+			Amm       string `json:"amm"`
+			Mint      string `json:"mint"`
+			Rank      int    `json:"rank"`
+			Wallet    string `json:"wallet"`
+			Signature string `json:"signature"`
+		}{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &row))
+		assert.Equal(t, len(listed[row.Amm])+1, row.Rank, line)
+		listed[row.Amm] = append(listed[row.Amm], row.Wallet)
+		swap, ok := buys[row.Signature]
+		assert.True(t, ok, line)
+		assert.Equal(t, row.Amm, swap.AmmAccount)
+		assert.Equal(t, row.Mint, swap.BaseTokenMint)
+		assert.Equal(t, row.Wallet, swap.WalletAccount)
+	}
+	for amm, wallets := range expected {
+		if len(wallets) == 0 {
+			delete(expected, amm)
+		}
+	}
+	assert.Equal(t, expected, listed)
+	assertGolden(t, "testdata/first-buyers/fixtures.golden", string(raw))
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// fixtureBundleVersion is bumped whenever the layout of a fixture bundle
+// changes, so SDK test suites can check they understand a bundle
+const fixtureBundleVersion = 1
+
+const (
+	FixtureFromClient = "client"
+	FixtureFromServer = "server"
+)
+
+var errFixturesComplete = errors.New("fixtures complete")
+
+// subscribeRequest is a client's request to subscribe to a feed
+func subscribeRequest(id int, method string) []byte {
+	return []byte(fmt.Sprintf(`{"id":%d,"method":"%s"}`, id, method))
+}
+
+// FixtureBundle is a set of websocket transcripts for testing client SDKs
+// without a connection, written by fixtures export
+type FixtureBundle struct {
+	Version    int       `json:"version"`
+	CLIVersion string    `json:"cliVersion"`
+	CreatedAt  time.Time `json:"createdAt"`
+	// the archive files the notifications were sampled from
+	Source      []string            `json:"source"`
+	Anonymized  []string            `json:"anonymized,omitempty"`
+	Transcripts []FixtureTranscript `json:"transcripts"`
+}
+
+// FixtureTranscript is one conversation with the server, in the order the
+// messages are sent
+type FixtureTranscript struct {
+	Name     string           `json:"name"`
+	Messages []FixtureMessage `json:"messages"`
+}
+
+// FixtureMessage is a message as it is sent over the websocket
+type FixtureMessage struct {
+	From    string          `json:"from"`
+	Message json.RawMessage `json:"message"`
+}
+
+type FixturesExportTask struct {
+	params struct {
+		dataDir       string
+		out           string
+		count         int
+		anonymize     string
+		anonymizeSalt string
+	}
+}
+
+func NewFixturesExportTask() *FixturesExportTask {
+	return &FixturesExportTask{}
+}
+
+func (o *FixturesExportTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir of archive files to sample notifications from")
+	cmd.Flags().StringVarP(&o.params.out, "out", "o", "fixtures.json", "The fixture bundle to write. - is stdout")
+	cmd.Flags().IntVar(&o.params.count, "count", 100, "How many notifications to sample for each subscription")
+	cmd.Flags().StringVar(&o.params.anonymize, "anonymize", "", "Replace these values in the notifications with stable salted hashes: wallets, signatures. (Comma separated list)")
+	cmd.Flags().StringVar(&o.params.anonymizeSalt, "anonymize-salt", "", "The salt for --anonymize. Use the same salt to get the same hashes across runs. Random when not set")
+}
+
+func (o *FixturesExportTask) GetMeta() Meta {
+	return Meta{
+		Name:        "FixturesExportTask",
+		Use:         "export",
+		Description: "Export websocket transcripts with notifications sampled from archive data as a versioned JSON bundle for client SDK test suites.",
+	}
+}
+
+func (o *FixturesExportTask) Execute(ctx context.Context) error {
+	if o.params.count < 1 {
+		return withKind(ErrUsage, errors.New("count must be at least 1"))
+	}
+	var anon *anonymizer
+	fields := splitList(o.params.anonymize)
+	if len(fields) != 0 {
+		var err error
+		if anon, err = newAnonymizer(fields, o.params.anonymizeSalt); err != nil {
+			return withKind(ErrUsage, err)
+		}
+	}
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return withKind(ErrUsage, fmt.Errorf("no archive files found in %s", o.params.dataDir))
+	}
+
+	bundle, err := o.export(ctx, files, anon)
+	if err != nil {
+		return err
+	}
+	bundle.Anonymized = fields
+	raw, err := json.Marshal(bundle)
+	if err != nil {
+		return err
+	}
+	out, err := openOutput(o.params.out)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if _, err := out.Write(append(raw, '\n')); err != nil {
+		return err
+	}
+	logrus.Infof("exported %d transcripts sampled from %d files to %s", len(bundle.Transcripts), len(bundle.Source), o.params.out)
+	return out.Close()
+}
+
+// export builds a transcript for each feed, subscribing and then receiving
+// the first count notifications of the feed in the archives
+func (o *FixturesExportTask) export(ctx context.Context, files []string, anon *anonymizer) (*FixtureBundle, error) {
+	bundle := &FixtureBundle{
+		Version:     fixtureBundleVersion,
+		CLIVersion:  version,
+		CreatedAt:   time.Now().UTC(),
+		Source:      []string{},
+		Transcripts: []FixtureTranscript{},
+	}
+	transcripts := make([]FixtureTranscript, len(simulatorFeeds))
+	sampled := make([]int, len(simulatorFeeds))
+	for i, feed := range simulatorFeeds {
+		transcripts[i] = FixtureTranscript{
+			Name: feed.SubscribeMethod(),
+			Messages: []FixtureMessage{
+				{From: FixtureFromClient, Message: subscribeRequest(1, feed.SubscribeMethod())},
+				{From: FixtureFromServer, Message: subscribeResult(1, 1)},
+			},
+		}
+	}
+
+	complete := func() bool {
+		for _, v := range sampled {
+			if v < o.params.count {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		bundle.Source = append(bundle.Source, v)
+		err := readArchiveRows(o.params.dataDir+"/"+v, func(row []byte) error {
+			data := DataFormat{}
+			if err := json.Unmarshal(row, &data); err != nil {
+				return errors.Wrap(err, "cant unmarshal event")
+			}
+			for i, feed := range simulatorFeeds {
+				if sampled[i] == o.params.count || !feed.Matches(data) {
+					continue
+				}
+				params := row
+				if anon != nil {
+					event := EventRow{}
+					if err := unmarshalEvent(row, &event); err != nil {
+						return errors.Wrap(err, "cant unmarshal event")
+					}
+					params = anon.Apply(event, row)
+				}
+				notification, err := json.Marshal(JSONRPC{SubscriptionID: 1, Method: feed.NotificationMethod(), Params: params})
+				if err != nil {
+					return err
+				}
+				transcripts[i].Messages = append(transcripts[i].Messages, FixtureMessage{From: FixtureFromServer, Message: notification})
+				sampled[i]++
+			}
+			if complete() {
+				return errFixturesComplete
+			}
+			return nil
+		})
+		if errors.Is(err, errFixturesComplete) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for i, feed := range simulatorFeeds {
+		if sampled[i] < o.params.count {
+			logrus.Warnf("only found %d of %d %s notifications", sampled[i], o.params.count, feed.NotificationMethod())
+		}
+		bundle.Transcripts = append(bundle.Transcripts, transcripts[i])
+	}
+	// a second subscription over a limit of one
+	limit, err := rpcError(2, ErrCodeLimitExceeded, subscriptionLimitMessage(1))
+	if err != nil {
+		return nil, err
+	}
+	bundle.Transcripts = append(bundle.Transcripts, FixtureTranscript{
+		Name: "subscriptionLimitExceeded",
+		Messages: []FixtureMessage{
+			{From: FixtureFromClient, Message: subscribeRequest(1, MethodSwapSubscribe)},
+			{From: FixtureFromServer, Message: subscribeResult(1, 1)},
+			{From: FixtureFromClient, Message: subscribeRequest(2, MethodNewPairSubscribe)},
+			{From: FixtureFromServer, Message: limit},
+		},
+	})
+	return bundle, nil
+}
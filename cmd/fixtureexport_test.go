@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestFixturesExport(t *testing.T) {
+	export := func(anonymize string) FixtureBundle {
+		task := NewFixturesExportTask()
+		task.params.dataDir = fixturesDir
+		task.params.out = t.TempDir() + "/fixtures.json"
+		task.params.count = 3
+		task.params.anonymize = anonymize
+		task.params.anonymizeSalt = "salt"
+		assert.Nil(t, task.Execute(context.Background()))
+		raw, err := os.ReadFile(task.params.out)
+		assert.Nil(t, err)
+		bundle := FixtureBundle{}
+		assert.Nil(t, json.Unmarshal(raw, &bundle))
+		return bundle
+	}
+
+	bundle := export("")
+	assert.Equal(t, fixtureBundleVersion, bundle.Version)
+	// every file is read looking for liquidity updates, which the fixtures have none of
+	assert.Len(t, bundle.Source, 3)
+	assert.Len(t, bundle.Transcripts[2].Messages, 2)
+	assert.Len(t, bundle.Transcripts, len(simulatorFeeds)+1)
+	swaps := bundle.Transcripts[1]
+	assert.Equal(t, MethodSwapSubscribe, swaps.Name)
+	assert.Len(t, swaps.Messages, 2+3)
+	assert.Equal(t, FixtureMessage{From: FixtureFromClient, Message: subscribeRequest(1, MethodSwapSubscribe)}, swaps.Messages[0])
+	assert.Equal(t, FixtureFromServer, swaps.Messages[1].From)
+	assert.JSONEq(t, `{"id":1,"result":{"subscription_id":1}}`, string(swaps.Messages[1].Message))
+	notification := JSONRPC{}
+	assert.Nil(t, json.Unmarshal(swaps.Messages[2].Message, &notification))
+	assert.Equal(t, "swapNotification", notification.Method)
+	assert.Equal(t, uint(1), notification.SubscriptionID)
+	event := EventRow{}
+	assert.Nil(t, json.Unmarshal(notification.Params, &event))
+	assert.NotNil(t, event.Swap)
+	assert.Equal(t, "subscriptionLimitExceeded", bundle.Transcripts[len(bundle.Transcripts)-1].Name)
+
+	anonymized := export("wallets")
+	assert.Equal(t, []string{AnonymizeWallets}, anonymized.Anonymized)
+	assert.Nil(t, json.Unmarshal(anonymized.Transcripts[1].Messages[2].Message, &notification))
+	assert.False(t, strings.Contains(string(notification.Params), event.Swap.WalletAccount))
+	assert.Equal(t, len(swaps.Messages), len(anonymized.Transcripts[1].Messages))
+}
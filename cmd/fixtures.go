@@ -0,0 +1,245 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// fixture archives always start at the same slot and time so generated files
+// are identical between runs
+const (
+	fixtureStartSlot = 266000000
+	fixtureStartTime = "20240505-120000"
+	// slots are roughly 400ms
+	fixtureSlotsPerHour = 9000
+)
+
+type GenFixturesTask struct {
+	params struct {
+		outputDir string
+		config    fixtureConfig
+	}
+}
+
+func NewGenFixturesTask() *GenFixturesTask {
+	return &GenFixturesTask{}
+}
+
+func (o *GenFixturesTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.outputDir, "output-dir", "o", "fixtures", "The dir to write the generated archive files to")
+	cmd.Flags().IntVar(&o.params.config.hours, "hours", defaultFixtureConfig.hours, "How many hourly archive files to generate")
+	cmd.Flags().IntVar(&o.params.config.swapsPerHour, "swaps", defaultFixtureConfig.swapsPerHour, "How many swaps to generate per hour")
+	cmd.Flags().IntVar(&o.params.config.pairsPerHour, "pairs", defaultFixtureConfig.pairsPerHour, "How many new pairs to generate per hour")
+	cmd.Flags().IntVar(&o.params.config.wallets, "wallets", defaultFixtureConfig.wallets, "How many distinct wallets trade")
+	cmd.Flags().Int64Var(&o.params.config.seed, "seed", defaultFixtureConfig.seed, "Random seed. The same seed always generates identical files")
+}
+
+func (o *GenFixturesTask) GetMeta() Meta {
+	return Meta{
+		Name:        "GenFixturesTask",
+		Use:         "gen-fixtures",
+		Description: "Generate small deterministic archive files in the same format as real archive data for testing.",
+	}
+}
+
+func (o *GenFixturesTask) Execute(ctx context.Context) error {
+	if o.params.config.hours < 1 || o.params.config.pairsPerHour < 1 || o.params.config.wallets < 1 {
+		return errors.New("hours, pairs and wallets must be at least 1")
+	}
+	files, err := generateFixtureArchives(o.params.outputDir, o.params.config)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("generated %d archive files in %s", len(files), o.params.outputDir)
+	return nil
+}
+
+type fixtureConfig struct {
+	hours        int
+	swapsPerHour int
+	pairsPerHour int
+	wallets      int
+	seed         int64
+}
+
+var defaultFixtureConfig = fixtureConfig{
+	hours:        3,
+	swapsPerHour: 60,
+	pairsPerHour: 4,
+	wallets:      6,
+	seed:         1,
+}
+
+// fixtureKey derives a valid base58 public key from a name. When suffix is set
+// the key is ground until its base58 form ends with it.
+func fixtureKey(name string, suffix string) string {
+	for i := 0; ; i++ {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("%s/%d", name, i)))
+		key := solana.PublicKeyFromBytes(sum[:]).String()
+		if suffix == "" {
+			return key
+		}
+		candidate := key[:len(key)-len(suffix)] + suffix
+		if _, err := solana.PublicKeyFromBase58(candidate); err == nil {
+			return candidate
+		}
+	}
+}
+
+// fixtureSignature derives a valid base58 transaction signature from a name
+func fixtureSignature(name string) string {
+	sum := sha512.Sum512([]byte(name))
+	return solana.SignatureFromBytes(sum[:]).String()
+}
+
+// generateFixtureArchives writes hourly archives with a pairs.json and a
+// swaps.json file each and returns the archive names
+func generateFixtureArchives(dir string, config fixtureConfig) ([]string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	startTime, err := time.Parse(archiveZipFileTimeFormat, fixtureStartTime)
+	if err != nil {
+		return nil, err
+	}
+	random := rand.New(rand.NewSource(config.seed))
+	quoteMint := "So11111111111111111111111111111111111111112"
+	wallets := []string{}
+	for i := 0; i < config.wallets; i++ {
+		wallets = append(wallets, fixtureKey(fmt.Sprintf("wallet-%d", i), ""))
+	}
+
+	type fixturePair struct {
+		amm  string
+		mint string
+	}
+	pairs := []fixturePair{}
+	files := []string{}
+	for hour := 0; hour < config.hours; hour++ {
+		hourSlot := uint64(fixtureStartSlot + hour*fixtureSlotsPerHour)
+		hourTime := startTime.Add(time.Duration(hour) * time.Hour)
+		timeOf := func(slot uint64) int64 {
+			return hourTime.Unix() + int64(slot-hourSlot)*int64(time.Hour/time.Second)/fixtureSlotsPerHour
+		}
+
+		pairRows := []any{}
+		for i := 0; i < config.pairsPerHour; i++ {
+			n := len(pairs)
+			suffix := ""
+			if n%2 == 0 {
+				suffix = "pump"
+			}
+			pair := fixturePair{
+				amm:  fixtureKey(fmt.Sprintf("amm-%d", n), ""),
+				mint: fixtureKey(fmt.Sprintf("mint-%d", n), suffix),
+			}
+			pairs = append(pairs, pair)
+			slot := hourSlot + uint64(i*fixtureSlotsPerHour/config.pairsPerHour)
+			pairRows = append(pairRows, map[string]any{
+				"slot":      slot,
+				"signature": fixtureSignature(fmt.Sprintf("pair-%d", n)),
+				"blockTime": timeOf(slot),
+				"pair": map[string]any{
+					"sourceExchange":           "raydium",
+					"ammAccount":               pair.amm,
+					"baseToken":                map[string]any{"account": pair.mint},
+					"quoteToken":               map[string]any{"account": quoteMint},
+					"baseTokenLiquidityAdded":  "1000000000",
+					"quoteTokenLiquidityAdded": "50000000000",
+				},
+			})
+		}
+
+		swapRows := []any{}
+		for i := 0; i < config.swapsPerHour; i++ {
+			slot := hourSlot + uint64(i*fixtureSlotsPerHour/config.swapsPerHour) + 1
+			// only trade pairs which exist at this slot
+			available := len(pairs) - config.pairsPerHour
+			for j := 0; j < config.pairsPerHour; j++ {
+				if hourSlot+uint64(j*fixtureSlotsPerHour/config.pairsPerHour) <= slot {
+					available++
+				}
+			}
+			if available == 0 {
+				continue
+			}
+			pair := pairs[random.Intn(available)]
+			swapType := SwapTypeBuy
+			if random.Intn(3) == 0 {
+				swapType = SwapTypeSell
+			}
+			swapRows = append(swapRows, map[string]any{
+				"slot":      slot,
+				"signature": fixtureSignature(fmt.Sprintf("swap-%d-%d", hour, i)),
+				"blockTime": timeOf(slot),
+				"swap": map[string]any{
+					"sourceExchange": "raydium",
+					"ammAccount":     pair.amm,
+					"baseTokenMint":  pair.mint,
+					"quoteTokenMint": quoteMint,
+					"walletAccount":  wallets[random.Intn(len(wallets))],
+					"swapType":       swapType,
+					"baseAmount":     fmt.Sprint(1000000 + random.Intn(9000000)),
+					"quoteAmount":    fmt.Sprint(10000000 + random.Intn(90000000)),
+				},
+			})
+		}
+
+		name := hourTime.Format(archiveZipFileTimeFormat) + ".zip"
+		err := writeFixtureArchive(filepath.Join(dir, name), map[string][]any{
+			"pairs.json": pairRows,
+			"swaps.json": swapRows,
+		})
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, name)
+	}
+	return files, nil
+}
+
+func writeFixtureArchive(path string, files map[string][]any) error {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := zip.NewWriter(f)
+	// fixed order and timestamps so the archive bytes are reproducible
+	for _, name := range []string{"pairs.json", "swaps.json"} {
+		fw, err := w.CreateHeader(&zip.FileHeader{
+			Name:     name,
+			Method:   zip.Deflate,
+			Modified: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		})
+		if err != nil {
+			return err
+		}
+		for _, row := range files[name] {
+			raw, err := json.Marshal(row)
+			if err != nil {
+				return err
+			}
+			if _, err := fw.Write(append(raw, '\n')); err != nil {
+				return errors.Wrapf(err, "cant write %s", path)
+			}
+		}
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return f.Close()
+}
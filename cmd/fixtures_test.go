@@ -0,0 +1,39 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+const fixturesDir = "testdata/archives"
+
+// copyFixtures copies the checked in fixture archives to a temp dir as the
+// commands write interim files next to their input
+func copyFixtures(t *testing.T) string {
+	dir := t.TempDir()
+	files, err := listArchiveFiles(fixturesDir)
+	assert.Nil(t, err)
+	for _, v := range files {
+		raw, err := os.ReadFile(filepath.Join(fixturesDir, v))
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(filepath.Join(dir, v), raw, 0666))
+	}
+	return dir
+}
+
+func TestFixturesUpToDate(t *testing.T) {
+	// regenerate with: go run ./cmd dev gen-fixtures -o cmd/testdata/archives
+	dir := t.TempDir()
+	files, err := generateFixtureArchives(dir, defaultFixtureConfig)
+	assert.Nil(t, err)
+	for _, v := range files {
+		generated, err := os.ReadFile(filepath.Join(dir, v))
+		assert.Nil(t, err)
+		checkedIn, err := os.ReadFile(filepath.Join(fixturesDir, v))
+		assert.Nil(t, err)
+		assert.Equal(t, checkedIn, generated, "fixture %s is out of date", v)
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// fromDateLayouts are the formats --from-date accepts. Dates without an
+// offset are UTC.
+var fromDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+func parseFromDate(v string) (time.Time, error) {
+	for _, layout := range fromDateLayouts {
+		if t, err := time.Parse(layout, v); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, errors.Errorf("invalid date %q, use e.g. '2024-05-05 14:30'", v)
+}
+
+// resolveFromDate returns the slot of the first event with a block time at or
+// after t. The hour in a file name is only roughly when its events are from,
+// the writer's clock may be skewed and files may not start on the hour, so
+// the file is picked by the block time of its first event and then searched,
+// using the frame index of seekable entries to skip most of it. Returns 0 if
+// no event is at or after t.
+func resolveFromDate(dir string, files []string, t time.Time) (uint64, error) {
+	target := t.Unix()
+	var searchErr error
+	// the first file starting after t, so t is in the file before it
+	i := sort.Search(len(files), func(i int) bool {
+		first, err := archiveFirstBlockTime(dir + "/" + files[i])
+		if err != nil && searchErr == nil {
+			searchErr = err
+		}
+		return first > target
+	})
+	if searchErr != nil {
+		return 0, searchErr
+	}
+	for _, v := range files[max(0, i-1):] {
+		slot, err := archiveSlotAt(dir+"/"+v, target)
+		if err != nil || slot != 0 {
+			return slot, err
+		}
+	}
+	return 0, nil
+}
+
+// archiveFirstBlockTime returns the earliest block time at the start of the
+// entries of an archive. Returns 0 if no row has a block time.
+func archiveFirstBlockTime(path string) (int64, error) {
+	r, closer, err := openArchive(path)
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+	first := int64(0)
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			return 0, err
+		}
+		blockTime, _, err := scanBlockTime(rc, 0)
+		rc.Close()
+		if err != nil {
+			return 0, errors.Wrapf(err, "cant read %s in %s", f.Name, path)
+		}
+		if blockTime != 0 && (first == 0 || blockTime < first) {
+			first = blockTime
+		}
+	}
+	return first, nil
+}
+
+// archiveSlotAt returns the slot of the first event in an archive with a
+// block time at or after target, or 0 if there is none
+func archiveSlotAt(path string, target int64) (uint64, error) {
+	r, ra, closer, err := openArchiveAt(path)
+	if err != nil {
+		return 0, err
+	}
+	defer closer.Close()
+	found := uint64(0)
+	for _, f := range r.File {
+		rc, err := openEntryAtTime(ra, f, target)
+		if err != nil {
+			return 0, errors.Wrapf(err, "cant read %s in %s", f.Name, path)
+		}
+		_, slot, err := scanBlockTime(rc, target)
+		rc.Close()
+		if err != nil {
+			return 0, errors.Wrapf(err, "cant read %s in %s", f.Name, path)
+		}
+		if slot != 0 && (found == 0 || slot < found) {
+			found = slot
+		}
+	}
+	return found, nil
+}
+
+// openEntryAtTime opens an archive entry. Seekable entries start at the last
+// frame beginning before target.
+func openEntryAtTime(ra io.ReaderAt, f *zip.File, target int64) (io.ReadCloser, error) {
+	entry, err := openSeekableEntry(ra, f)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil {
+		return f.Open()
+	}
+	var searchErr error
+	i := sort.Search(len(entry.offsets), func(i int) bool {
+		row, err := entry.firstRow(i)
+		if err != nil && searchErr == nil {
+			searchErr = err
+		}
+		return rowBlockTime(row) >= target
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+	if len(entry.offsets) == 0 {
+		return f.Open()
+	}
+	return entry.readFrom(max(0, i-1))
+}
+
+// scanBlockTime returns the block time and slot of the first row with a
+// block time at or after target. Rows without a block time are skipped.
+func scanBlockTime(r io.Reader, target int64) (int64, uint64, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRowSize)
+	for scanner.Scan() {
+		blockTime := rowBlockTime(scanner.Bytes())
+		if blockTime != 0 && blockTime >= target {
+			return blockTime, rowSlot(scanner.Bytes()), nil
+		}
+	}
+	return 0, 0, scanner.Err()
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestResolveFromDate(t *testing.T) {
+	defer func(size int) { seekableFrameSize = size }(seekableFrameSize)
+	seekableFrameSize = 256
+
+	// a row every 10s from 12:00 to 12:57 then the next file starts at 12:58,
+	// two minutes before the hour its name says
+	blockTimeRows := func(from, to, slot int) string {
+		rows := strings.Builder{}
+		for v := from; v < to; v += 10 {
+			fmt.Fprintf(&rows, `{"slot":%d,"blockTime":%d,"swap":{}}`+"\n", slot, v)
+			slot++
+		}
+		return rows.String()
+	}
+	start := 1714910400 // 2024-05-05T12:00:00Z
+	dataDir := t.TempDir()
+	writeSeekableArchive(t, dataDir+"/20240505-120000.zip", map[string]string{"swaps.json": blockTimeRows(start, start+58*60, 1000)})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": blockTimeRows(start+58*60, start+70*60, 2000),
+		"pairs.json": `{"slot":1999,"pair":{}}` + "\n",
+	})
+	files, err := listArchiveFiles(dataDir)
+	assert.Nil(t, err)
+
+	for date, slot := range map[string]uint64{
+		"2024-05-05":                1000,
+		"2024-05-05 12:30":          1180,
+		"2024-05-05 12:30:05":       1181,
+		"2024-05-05T14:30:00+02:00": 1180,
+		"2024-05-05 12:58:30":       2003,
+		"2024-05-05 13:05":          2042,
+		"2024-05-05 14:00":          0,
+	} {
+		from, err := parseFromDate(date)
+		assert.Nil(t, err)
+		got, err := resolveFromDate(dataDir, files, from)
+		assert.Nil(t, err)
+		assert.Equal(t, slot, got, date)
+	}
+
+	_, err = parseFromDate("05/05/2024")
+	assert.NotNil(t, err)
+}
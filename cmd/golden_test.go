@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+// regenerate the golden files after an intended change of output with:
+// go test ./cmd -run Golden -update
+var updateGolden = flag.Bool("update", false, "Rewrite the golden files in testdata with the current output")
+
+// assertGolden compares actual to the checked in golden file, or rewrites it
+// with -update
+func assertGolden(t *testing.T, path string, actual string) {
+	t.Helper()
+	if *updateGolden {
+		assert.Nil(t, os.MkdirAll(filepath.Dir(path), 0755))
+		assert.Nil(t, os.WriteFile(path, []byte(actual), 0644))
+		return
+	}
+	golden, err := os.ReadFile(path)
+	if !assert.Nil(t, err, "run with -update to create %s", path) {
+		return
+	}
+	assert.Equal(t, string(golden), actual, "%s differs, run with -update if the change is intended", path)
+}
+
+// TestReplayGolden replays the fixture archives and compares every message
+// sent, in order, to testdata/replay so changes to the replay engine can not
+// silently change what clients receive
+func TestReplayGolden(t *testing.T) {
+	dataDir := copyFixtures(t)
+	for _, test := range []struct {
+		golden string
+		// the feeds subscribed to, all of them when empty
+		subscribe []string
+		setup     func(st *SimulateTask)
+	}{
+		{golden: "forward"},
+		{golden: "reverse", setup: func(st *SimulateTask) { st.params.direction = DirectionReverse }},
+		{golden: "swaps", subscribe: []string{MethodSwapSubscribe}},
+		{golden: "only-pairs", setup: func(st *SimulateTask) { st.params.only = "pairs" }},
+		{golden: "slot-order-index", setup: func(st *SimulateTask) { st.params.slotOrder = SlotOrderIndex }},
+		{golden: "slot-order-shuffle", setup: func(st *SimulateTask) {
+			st.params.slotOrder = SlotOrderShuffle
+			st.params.shuffleSeed = 7
+		}},
+		{golden: "remap-slots", setup: func(st *SimulateTask) { st.params.remapSlotsFrom = 1000 }},
+		{golden: "limit-events", setup: func(st *SimulateTask) { st.params.limitEvents = 25 }},
+	} {
+		t.Run(test.golden, func(t *testing.T) {
+			st := NewSimulateTask()
+			st.params.dataDir = dataDir
+			if test.setup != nil {
+				test.setup(st)
+			}
+			subscribe := test.subscribe
+			if len(subscribe) == 0 {
+				for _, v := range simulatorFeeds {
+					subscribe = append(subscribe, v.SubscribeMethod())
+				}
+			}
+			for _, v := range subscribe {
+				st.subscribe(v)
+			}
+
+			messages := strings.Builder{}
+			drained := make(chan struct{})
+			go func() {
+				defer close(drained)
+				for v := range st.outputFeed {
+					raw, err := st.notifications.Render(v)
+					assert.Nil(t, err)
+					messages.Write(raw)
+					messages.WriteByte('\n')
+				}
+			}()
+			err := st.RunSimulation(context.Background(), 1)
+			close(st.outputFeed)
+			<-drained
+			assert.Nil(t, err)
+			assertGolden(t, "testdata/replay/"+test.golden+".golden", messages.String())
+		})
+	}
+}
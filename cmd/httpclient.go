@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// version is set at build time with -ldflags "-X main.version=..."
+var version = "dev"
+
+func userAgent() string {
+	return "ss-cli/" + version
+}
+
+// httpOptions are the flags shared by commands that call the SolanaStreaming API
+type httpOptions struct {
+	traceRequests bool
+	traceFile     string
+	proxy         string
+	ipv4Only      bool
+	resolve       []string
+}
+
+func (o *httpOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&o.traceRequests, "trace-requests", false, "Log the request id, timing and response headers of every API call. Useful when contacting support")
+	cmd.Flags().StringVar(&o.traceFile, "trace-file", "", "Also dump the HTTP exchanges (headers only for downloads) to this file. Implies --trace-requests")
+	cmd.Flags().StringVar(&o.proxy, "proxy", "", "Proxy all network connections through this proxy e.g. socks5://localhost:1080 or http://proxy:3128. Defaults to the HTTP_PROXY / HTTPS_PROXY env vars")
+	cmd.Flags().BoolVar(&o.ipv4Only, "dial-ipv4-only", false, "Only connect over IPv4. Use on networks with broken IPv6")
+	cmd.Flags().StringSliceVar(&o.resolve, "resolve", nil, "Override DNS for a host with host:ip e.g. api.solanastreaming.com:10.0.0.5. Can be repeated")
+}
+
+// dialContext returns a dialer applying the ipv4 only and resolve overrides
+func (o *httpOptions) dialContext() (func(ctx context.Context, network, addr string) (net.Conn, error), error) {
+	overrides := map[string]string{}
+	for _, v := range o.resolve {
+		// hostnames never contain a colon but ipv6 addresses do
+		host, ip, ok := strings.Cut(v, ":")
+		ip = strings.Trim(ip, "[]")
+		if !ok || host == "" || net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid resolve %q, must be host:ip", v)
+		}
+		overrides[strings.ToLower(host)] = ip
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+	}
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if o.ipv4Only && network == "tcp" {
+			network = "tcp4"
+		}
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		if ip, ok := overrides[strings.ToLower(host)]; ok {
+			logrus.Debugf("resolving %s to %s", host, ip)
+			addr = net.JoinHostPort(ip, port)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}, nil
+}
+
+// proxyFunc returns the proxy to use for a request. An explicit --proxy wins
+// over the environment.
+func (o *httpOptions) proxyFunc() (func(*http.Request) (*url.URL, error), error) {
+	if o.proxy == "" {
+		return http.ProxyFromEnvironment, nil
+	}
+	proxyURL, err := url.Parse(o.proxy)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid proxy")
+	}
+	switch proxyURL.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, must be one of: http, https, socks5", proxyURL.Scheme)
+	}
+	return http.ProxyURL(proxyURL), nil
+}
+
+// NewWebsocketDialer returns a websocket dialer using the same proxy settings
+// as the HTTP transport
+func (o *httpOptions) NewWebsocketDialer() (*websocket.Dialer, error) {
+	proxy, err := o.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	dial, err := o.dialContext()
+	if err != nil {
+		return nil, err
+	}
+	dialer := *websocket.DefaultDialer
+	dialer.Proxy = proxy
+	dialer.NetDialContext = dial
+	return &dialer, nil
+}
+
+// NewTransport returns a round tripper which sets the user agent and traces
+// requests when enabled
+func (o *httpOptions) NewTransport() (http.RoundTripper, error) {
+	proxy, err := o.proxyFunc()
+	if err != nil {
+		return nil, err
+	}
+	dial, err := o.dialContext()
+	if err != nil {
+		return nil, err
+	}
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.Proxy = proxy
+	base.DialContext = dial
+	transport := &tracingTransport{
+		next:  base,
+		trace: o.traceRequests || o.traceFile != "",
+	}
+	if o.traceFile != "" {
+		f, err := os.OpenFile(o.traceFile, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, errors.Wrap(err, "cant open trace file")
+		}
+		transport.dump = f
+	}
+	return transport, nil
+}
+
+type tracingTransport struct {
+	next  http.RoundTripper
+	trace bool
+	dump  *os.File
+	lock  sync.Mutex
+}
+
+// secrets are redacted from logs and dumps so they can be shared with support
+var redactTokenRegex = regexp.MustCompile(`(token=)[^&\s]+`)
+var redactAPIKeyRegex = regexp.MustCompile(`(?i)(X-Api-Key: )\S+`)
+
+func redact(s string) string {
+	s = redactTokenRegex.ReplaceAllString(s, "${1}REDACTED")
+	return redactAPIKeyRegex.ReplaceAllString(s, "${1}REDACTED")
+}
+
+func (o *tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Header.Set("User-Agent", userAgent())
+	if !o.trace {
+		return o.next.RoundTrip(req)
+	}
+
+	requestID := newRequestID()
+	req.Header.Set("X-Request-ID", requestID)
+	if o.dump != nil {
+		// only api calls have small bodies worth dumping
+		raw, err := httputil.DumpRequestOut(req, req.Method == http.MethodPost)
+		if err == nil {
+			o.writeDump(requestID, "request", raw)
+		}
+	}
+
+	start := time.Now()
+	resp, err := o.next.RoundTrip(req)
+	took := time.Since(start)
+	url := redact(req.URL.String())
+	if err != nil {
+		logrus.Infof("trace %s %s %s failed after %s: %s", requestID, req.Method, url, took, err)
+		return resp, err
+	}
+	if serverID := resp.Header.Get("X-Request-Id"); serverID != "" && serverID != requestID {
+		requestID = requestID + "/" + serverID
+	}
+	logrus.Infof("trace %s %s %s %d in %s headers: %v", requestID, req.Method, url, resp.StatusCode, took, resp.Header)
+	if o.dump != nil {
+		raw, err := httputil.DumpResponse(resp, false)
+		if err == nil {
+			o.writeDump(requestID, fmt.Sprintf("response in %s", took), raw)
+		}
+	}
+	return resp, nil
+}
+
+func (o *tracingTransport) writeDump(requestID string, label string, raw []byte) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	fmt.Fprintf(o.dump, "### %s %s %s\n%s\n\n", time.Now().UTC().Format(time.RFC3339Nano), requestID, label, redact(string(raw)))
+}
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Injection is a synthetic event for simulate to emit at a slot, either a
+// whole event or a copy of the first archive event of a type in that slot
+// with some fields changed
+type Injection struct {
+	Slot uint64 `json:"slot"`
+	// the event row, its slot is set to Slot
+	Event json.RawMessage `json:"event"`
+	// the type of archive event to copy instead: swap, pair or liquidityUpdate
+	Copy string `json:"copy"`
+	// merged into the copy, objects are merged and anything else replaced
+	Set json.RawMessage `json:"set"`
+}
+
+func loadInjections(path string) ([]Injection, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "cant read injections")
+	}
+	injections := []Injection{}
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&injections); err != nil {
+		return nil, errors.Wrapf(err, "invalid injections %s", path)
+	}
+	for i, v := range injections {
+		if err := v.validate(); err != nil {
+			return nil, fmt.Errorf("invalid injections %s: injection %d: %s", path, i+1, err)
+		}
+	}
+	return injections, nil
+}
+
+func (o Injection) validate() error {
+	if o.Slot == 0 {
+		return errors.New("slot is required")
+	}
+	if (o.Event == nil) == (o.Copy == "") {
+		return errors.New("must have one of event or copy")
+	}
+	if o.Event != nil && o.Set != nil {
+		return errors.New("set can only be used with copy")
+	}
+	switch o.Copy {
+	case "", "swap", "pair", "liquidityUpdate":
+	default:
+		return fmt.Errorf("copy must be swap, pair or liquidityUpdate not %q", o.Copy)
+	}
+	if o.Event != nil && !isJSONObject(o.Event) {
+		return errors.New("event must be an object")
+	}
+	if o.Set != nil && !isJSONObject(o.Set) {
+		return errors.New("set must be an object")
+	}
+	return nil
+}
+
+// Row returns the event row to emit, copying from the archive rows of the
+// slot. It returns false when there is no archive event of the type to copy.
+func (o Injection) Row(batch []slotRow) ([]byte, bool) {
+	row := o.Event
+	if o.Copy != "" {
+		row = nil
+		for _, v := range batch {
+			if slotRowHas(v.data, o.Copy) {
+				row = mergeJSON(v.row, o.Set)
+				break
+			}
+		}
+		if row == nil {
+			return nil, false
+		}
+	}
+	return mergeJSON(row, json.RawMessage(`{"slot":`+strconv.FormatUint(o.Slot, 10)+`}`)), true
+}
+
+func slotRowHas(data DataFormat, eventType string) bool {
+	switch eventType {
+	case "swap":
+		return data.Swap != nil
+	case "pair":
+		return data.Pair != nil
+	case "liquidityUpdate":
+		return data.LiquidityUpdate != nil
+	}
+	return false
+}
+
+// injector holds the injections still to be emitted in a simulation run
+type injector struct {
+	pending map[uint64][]Injection
+}
+
+func newInjector(injections []Injection) *injector {
+	pending := map[uint64][]Injection{}
+	for _, v := range injections {
+		pending[v.Slot] = append(pending[v.Slot], v)
+	}
+	return &injector{pending: pending}
+}
+
+// Inject appends the injections for slot to its archive rows. Copies are
+// retried on later rows of the slot, e.g. from the next archive file, when
+// the slot has no event to copy yet.
+func (o *injector) Inject(slot uint64, batch []slotRow) ([]slotRow, error) {
+	injections := o.pending[slot]
+	if len(injections) == 0 {
+		return batch, nil
+	}
+	archived := batch
+	remaining := []Injection{}
+	for _, v := range injections {
+		row, ok := v.Row(archived)
+		if !ok {
+			remaining = append(remaining, v)
+			continue
+		}
+		data := DataFormat{}
+		if err := json.Unmarshal(row, &data); err != nil {
+			return nil, errors.Wrapf(err, "invalid injection at slot %d", slot)
+		}
+		batch = append(batch, slotRow{data: data, row: row})
+	}
+	if len(remaining) == 0 {
+		delete(o.pending, slot)
+	} else {
+		o.pending[slot] = remaining
+	}
+	return batch, nil
+}
+
+// Next returns the nearest slot after slot, or before it in reverse, with
+// injections still to be emitted
+func (o *injector) Next(slot uint64, reverse bool) (uint64, bool) {
+	next, found := uint64(0), false
+	for v := range o.pending {
+		if (!reverse && v > slot && (!found || v < next)) || (reverse && v < slot && (!found || v > next)) {
+			next, found = v, true
+		}
+	}
+	return next, found
+}
+
+// Pending returns the number of injections not emitted
+func (o *injector) Pending() int {
+	count := 0
+	for _, v := range o.pending {
+		count += len(v)
+	}
+	return count
+}
+
+func isJSONObject(raw json.RawMessage) bool {
+	var fields map[string]json.RawMessage
+	return json.Unmarshal(raw, &fields) == nil && fields != nil
+}
+
+// mergeJSON merges patch into the object base. Fields that are objects in
+// both are merged, others are replaced by patch.
+func mergeJSON(base json.RawMessage, patch json.RawMessage) json.RawMessage {
+	if patch == nil {
+		return base
+	}
+	var baseFields, patchFields map[string]json.RawMessage
+	if json.Unmarshal(base, &baseFields) != nil || json.Unmarshal(patch, &patchFields) != nil || baseFields == nil || patchFields == nil {
+		return patch
+	}
+	for k, v := range patchFields {
+		if existing, ok := baseFields[k]; ok {
+			baseFields[k] = mergeJSON(existing, v)
+		} else {
+			baseFields[k] = v
+		}
+	}
+	merged, err := json.Marshal(baseFields)
+	if err != nil {
+		return patch
+	}
+	return merged
+}
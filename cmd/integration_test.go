@@ -0,0 +1,579 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/test-go/testify/assert"
+)
+
+func TestDownloadFromMockAPI(t *testing.T) {
+	server := httptest.NewServer(NewMockAPI(fixturesDir))
+	defer server.Close()
+
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.concurrency = 3
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	assert.Nil(t, task.Execute(context.Background()))
+
+	files, err := listArchiveFiles(fixturesDir)
+	assert.Nil(t, err)
+	for _, v := range files {
+		expected, err := os.ReadFile(filepath.Join(fixturesDir, v))
+		assert.Nil(t, err)
+		downloaded, err := os.ReadFile(filepath.Join(task.params.outputDir, v))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, downloaded, "downloaded %s does not match", v)
+	}
+	// the entitlement is only saved with --save-entitlement
+	_, err = os.Stat(filepath.Join(task.params.outputDir, entitlementFileName))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadReport(t *testing.T) {
+	api := NewMockAPI(fixturesDir)
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.concurrency = 2
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	task.params.saveEntitlement = true
+	assert.Nil(t, task.Execute(context.Background()))
+
+	raw, err := os.ReadFile(filepath.Join(task.params.outputDir, downloadReportFileName))
+	assert.Nil(t, err)
+	report := DownloadReport{}
+	assert.Nil(t, json.Unmarshal(raw, &report))
+	assert.Equal(t, uint(1), report.OrderID)
+	assert.Equal(t, 3, report.Downloaded)
+	assert.Equal(t, 0, report.Failed)
+	assert.Empty(t, report.Error)
+	assert.Len(t, report.Files, 3)
+	for _, v := range report.Files {
+		assert.Equal(t, FileOutcomeDownloaded, v.Outcome)
+		assert.Equal(t, 1, v.Attempts)
+		assert.Equal(t, int64(v.ExpectedBytes), v.Bytes)
+		assert.Equal(t, ChecksumOK, v.Checksum, v.File)
+	}
+
+	// a failed run is reported too
+	task.params.reportFile = filepath.Join(t.TempDir(), "report.json")
+	task.params.outputDir = t.TempDir()
+	api.RequireAPIKey("right-key")
+	assert.NotNil(t, task.Execute(context.Background()))
+	raw, err = os.ReadFile(task.params.reportFile)
+	assert.Nil(t, err)
+	report = DownloadReport{}
+	assert.Nil(t, json.Unmarshal(raw, &report))
+	assert.NotEmpty(t, report.Error)
+}
+
+func TestDownloadMissingToken(t *testing.T) {
+	server := httptest.NewServer(NewMockAPI(fixturesDir))
+	defer server.Close()
+
+	task := NewDownloadTask()
+	task.params.orderID = 1
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	assert.NotNil(t, task.Execute(context.Background()))
+}
+
+func TestDownloadTraceFile(t *testing.T) {
+	server := httptest.NewServer(NewMockAPI(fixturesDir))
+	defer server.Close()
+
+	task := NewDownloadTask()
+	task.params.apiKey = "secret-key"
+	task.params.orderID = 1
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	task.http.traceFile = filepath.Join(t.TempDir(), "trace.log")
+	assert.Nil(t, task.Execute(context.Background()))
+
+	raw, err := os.ReadFile(task.http.traceFile)
+	assert.Nil(t, err)
+	trace := string(raw)
+	assert.Contains(t, trace, "User-Agent: "+userAgent())
+	assert.Contains(t, trace, "X-Request-Id: ")
+	assert.Contains(t, trace, "token=REDACTED")
+	assert.NotContains(t, trace, "secret-key")
+	assert.NotContains(t, trace, mockDownloadToken(1))
+}
+
+func TestDownloadThroughProxy(t *testing.T) {
+	api := NewMockAPI(fixturesDir)
+	proxied := atomic.Int32{}
+	// the mock api doubles as the http proxy, requests arrive with absolute urls
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxied.Add(1)
+		api.ServeHTTP(w, r)
+	}))
+	defer proxy.Close()
+
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = "http://archive.invalid"
+	task.http.proxy = proxy.URL
+	assert.Nil(t, task.Execute(context.Background()))
+	assert.True(t, proxied.Load() > 2, "requests did not go through the proxy")
+
+	task.http.proxy = "ftp://proxy"
+	assert.NotNil(t, task.Execute(context.Background()))
+}
+
+func TestDownloadResolveOverride(t *testing.T) {
+	server := httptest.NewServer(NewMockAPI(fixturesDir))
+	defer server.Close()
+	serverURL, err := url.Parse(server.URL)
+	assert.Nil(t, err)
+
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = "http://api.solanastreaming.invalid:" + serverURL.Port()
+	task.http.ipv4Only = true
+	task.http.resolve = []string{"api.solanastreaming.invalid:127.0.0.1"}
+	assert.Nil(t, task.Execute(context.Background()))
+
+	task.http.resolve = []string{"api.solanastreaming.invalid"}
+	assert.NotNil(t, task.Execute(context.Background()))
+}
+
+// useEntitlementKey stands in for the key release builds compile in
+func useEntitlementKey(t *testing.T, key string) {
+	previous := entitlementPublicKey
+	entitlementPublicKey = key
+	t.Cleanup(func() { entitlementPublicKey = previous })
+}
+
+func TestEntitlementVerifiesOffline(t *testing.T) {
+	useEntitlementKey(t, mockEntitlementPublicKey())
+	server := httptest.NewServer(NewMockAPI(fixturesDir))
+	download := NewDownloadTask()
+	download.params.apiKey = "test-key"
+	download.params.orderID = 1
+	download.params.outputDir = t.TempDir()
+	download.params.apiEndpoint = server.URL
+	download.params.saveEntitlement = true
+	assert.Nil(t, download.Execute(context.Background()))
+	// verification must not need the api
+	server.Close()
+
+	reduce := NewReduceTask()
+	reduce.params.dataInDir = download.params.outputDir
+	reduce.params.dataOutDir = t.TempDir()
+	reduce.params.concurrency = 1
+	reduce.params.wallets = fixtureKey("wallet-0", "")
+	reduce.entitlement.verify = true
+	assert.Nil(t, reduce.Execute(context.Background()))
+
+	files, err := listArchiveFiles(download.params.outputDir)
+	assert.Nil(t, err)
+	f, err := os.OpenFile(filepath.Join(download.params.outputDir, files[0]), os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	f.Write([]byte("tampered"))
+	f.Close()
+	assert.NotNil(t, reduce.Execute(context.Background()))
+
+	// entitlements signed by anyone else are rejected
+	useEntitlementKey(t, fixtureKey("other", ""))
+	assert.NotNil(t, reduce.Execute(context.Background()))
+}
+
+func TestDownloadWithReduceFilter(t *testing.T) {
+	server := httptest.NewServer(NewMockAPI(fixturesDir))
+	defer server.Close()
+	filterFile := filepath.Join(t.TempDir(), "filter.json")
+	assert.Nil(t, os.WriteFile(filterFile, []byte(`{"mint-suffix": ["pump"]}`), 0644))
+
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.concurrency = 2
+	task.params.processWorkers = 3
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	task.params.reduceFilter = filterFile
+	assert.Nil(t, task.Execute(context.Background()))
+
+	files, err := listArchiveFiles(task.params.outputDir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 3)
+	for _, v := range files {
+		assert.Nil(t, readArchiveRows(filepath.Join(task.params.outputDir, v), func(row []byte) error {
+			assert.Contains(t, string(row), "pump")
+			return nil
+		}))
+	}
+	_, err = os.Stat(filepath.Join(task.params.outputDir, downloadReduceDir))
+	assert.True(t, os.IsNotExist(err), "full files were not discarded")
+	_, err = os.Stat(filepath.Join(task.params.outputDir, reduceSummaryFileName))
+	assert.Nil(t, err)
+}
+
+func TestDownloadStopsAtDiskBudget(t *testing.T) {
+	t.Cleanup(func() { diskUsage = &diskBudget{} })
+	server := httptest.NewServer(NewMockAPI(fixturesDir))
+	defer server.Close()
+
+	// room for the first two fixture files only
+	diskUsage = &diskBudget{limit: 16000}
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	err := task.Execute(context.Background())
+	assert.True(t, errors.Is(err, ErrDiskBudget), "unexpected error %v", err)
+	files, err := listArchiveFiles(task.params.outputDir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 2)
+
+	// running again with more space resumes
+	diskUsage = &diskBudget{}
+	assert.Nil(t, task.Execute(context.Background()))
+	files, err = listArchiveFiles(task.params.outputDir)
+	assert.Nil(t, err)
+	assert.Len(t, files, 3)
+}
+
+func TestReduceThenSimulate(t *testing.T) {
+	dataDir := copyFixtures(t)
+	reducedDir := t.TempDir()
+
+	reduce := NewReduceTask()
+	reduce.params.dataInDir = dataDir
+	reduce.params.dataOutDir = reducedDir
+	reduce.params.concurrency = 2
+	reduce.params.mintSuffixes = "pump"
+	assert.Nil(t, reduce.Execute(context.Background()))
+
+	simulate := NewSimulateTask()
+	simulate.params.dataDir = reducedDir
+	simulate.subscribe(MethodNewPairSubscribe)
+	simulate.subscribe(MethodSwapSubscribe)
+
+	events := []EventRow{}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for v := range simulate.outputFeed {
+			event := EventRow{}
+			assert.Nil(t, json.Unmarshal(v.Params, &event))
+			events = append(events, event)
+		}
+	}()
+	err := simulate.RunSimulation(context.Background(), 1)
+	close(simulate.outputFeed)
+	<-drained
+	assert.Nil(t, err)
+
+	assert.NotEmpty(t, events)
+	lastSlot := uint64(0)
+	for _, v := range events {
+		mint := ""
+		if v.Pair != nil {
+			mint = v.Pair.BaseToken.Account
+		} else if v.Swap != nil {
+			mint = v.Swap.BaseTokenMint
+		}
+		assert.True(t, strings.HasSuffix(mint, "pump"), "unexpected mint %s", mint)
+		assert.True(t, v.Slot >= lastSlot, "events out of order")
+		lastSlot = v.Slot
+	}
+}
+
+func TestDownloadExpiredOrder(t *testing.T) {
+	dataDir := copyFixtures(t)
+	orders := `[{"id":7,"from":"2024-05-05T12:00:00Z","to":"2024-05-05T14:00:00Z","expired":true}]`
+	assert.Nil(t, os.WriteFile(filepath.Join(dataDir, mockOrdersFileName), []byte(orders), 0666))
+	server := httptest.NewServer(NewMockAPI(dataDir))
+	defer server.Close()
+
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 7
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	err := task.Execute(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "payment required")
+
+	// unknown orders are not found
+	task.params.orderID = 8
+	assert.NotNil(t, task.Execute(context.Background()))
+}
+
+func TestDownloadWrongAPIKey(t *testing.T) {
+	api := NewMockAPI(fixturesDir)
+	api.RequireAPIKey("right-key")
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	task := NewDownloadTask()
+	task.params.apiKey = "wrong-key"
+	task.params.orderID = 1
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	err := task.Execute(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "401")
+}
+
+func TestDownloadCachesAPIResponses(t *testing.T) {
+	api := NewMockAPI(fixturesDir)
+	apiCalls := atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, "/archive/download/") {
+			apiCalls.Add(1)
+		}
+		api.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	outputDir := t.TempDir()
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.outputDir = outputDir
+	task.params.apiEndpoint = server.URL
+	task.params.saveEntitlement = true
+	task.params.cacheTTL = time.Hour
+	assert.Nil(t, task.Execute(context.Background()))
+	calls := apiCalls.Load()
+
+	// retrying a failed file needs neither the order nor its size from the api
+	files, err := listArchiveFiles(task.params.outputDir)
+	assert.Nil(t, err)
+	assert.Nil(t, os.Remove(filepath.Join(task.params.outputDir, files[1])))
+	task = NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.outputDir = outputDir
+	task.params.apiEndpoint = server.URL
+	task.params.saveEntitlement = true
+	task.params.cacheTTL = time.Hour
+	assert.Nil(t, task.Execute(context.Background()))
+	// only the entitlement is fetched again
+	assert.Equal(t, calls+1, apiCalls.Load())
+	_, err = os.Stat(filepath.Join(task.params.outputDir, files[1]))
+	assert.Nil(t, err)
+
+	assert.Nil(t, os.Remove(filepath.Join(task.params.outputDir, files[1])))
+	calls = apiCalls.Load()
+	task.params.noCache = true
+	assert.Nil(t, task.Execute(context.Background()))
+	assert.Equal(t, calls+3, apiCalls.Load())
+}
+
+func TestDownloadStagger(t *testing.T) {
+	api := NewMockAPI(fixturesDir)
+	lock := sync.Mutex{}
+	started := map[string]time.Time{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/archive/download/") {
+			lock.Lock()
+			if _, ok := started[r.URL.Path]; !ok {
+				started[r.URL.Path] = time.Now()
+			}
+			lock.Unlock()
+		}
+		api.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.concurrency = 3
+	task.params.stagger = 300 * time.Millisecond
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	assert.Nil(t, task.Execute(context.Background()))
+
+	starts := []time.Time{}
+	for _, v := range started {
+		starts = append(starts, v)
+	}
+	slices.SortFunc(starts, func(a, b time.Time) int { return a.Compare(b) })
+	assert.Len(t, starts, 3)
+	for i := 1; i < len(starts); i++ {
+		assert.True(t, starts[i].Sub(starts[i-1]) >= 250*time.Millisecond, "downloads started %s apart", starts[i].Sub(starts[i-1]))
+	}
+}
+
+func TestQuarantineAndRefetch(t *testing.T) {
+	useEntitlementKey(t, mockEntitlementPublicKey())
+	server := httptest.NewServer(NewMockAPI(fixturesDir))
+	defer server.Close()
+	download := NewDownloadTask()
+	download.params.apiKey = "test-key"
+	download.params.orderID = 1
+	download.params.outputDir = t.TempDir()
+	download.params.apiEndpoint = server.URL
+	download.params.saveEntitlement = true
+	assert.Nil(t, download.Execute(context.Background()))
+
+	files, err := listArchiveFiles(download.params.outputDir)
+	assert.Nil(t, err)
+	f, err := os.OpenFile(filepath.Join(download.params.outputDir, files[0]), os.O_APPEND|os.O_WRONLY, 0)
+	assert.Nil(t, err)
+	f.Write([]byte("tampered"))
+	f.Close()
+	verify := entitlementOptions{verify: true}
+	err = verify.Verify(download.params.outputDir, files)
+	assert.True(t, errors.Is(err, ErrDataCorruption), "unexpected error %v", err)
+	assert.True(t, strings.Contains(err.Error(), files[0]))
+
+	// verifying only reports the bad file
+	_, err = os.Stat(filepath.Join(download.params.outputDir, files[0]))
+	assert.Nil(t, err)
+	_, err = os.Stat(filepath.Join(download.params.outputDir, quarantineDir))
+	assert.True(t, os.IsNotExist(err))
+
+	// which is moved aside with the reason
+	assert.Nil(t, quarantineFile(download.params.outputDir, files[0], errors.Errorf("%s does not match the entitlement", files[0])))
+	reasons, err := listQuarantine(download.params.outputDir)
+	assert.Nil(t, err)
+	assert.Len(t, reasons, 1)
+	assert.Equal(t, files[0], reasons[0].File)
+	assert.True(t, strings.Contains(reasons[0].Reason, "does not match the entitlement"))
+	_, err = os.Stat(filepath.Join(download.params.outputDir, files[0]))
+	assert.True(t, os.IsNotExist(err))
+
+	// and can be put back
+	restore := NewQuarantineTask(QuarantineRestore)
+	restore.params.dataDir = download.params.outputDir
+	assert.NotNil(t, restore.Execute(context.Background()))
+	restore.params.all = true
+	assert.Nil(t, restore.Execute(context.Background()))
+	reasons, err = listQuarantine(download.params.outputDir)
+	assert.Nil(t, err)
+	assert.Len(t, reasons, 0)
+
+	// and repairing the download fetches it again
+	assert.NotNil(t, verify.Verify(download.params.outputDir, files))
+	download.params.repair = true
+	assert.Nil(t, download.Execute(context.Background()))
+	assert.Nil(t, verify.Verify(download.params.outputDir, files))
+	_, err = os.Stat(filepath.Join(download.params.outputDir, quarantineDir))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestDownloadRepair(t *testing.T) {
+	server := httptest.NewServer(NewMockAPI(fixturesDir))
+	defer server.Close()
+
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.concurrency = 3
+	task.params.processWorkers = 2
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	task.params.saveEntitlement = true
+	assert.Nil(t, task.Execute(context.Background()))
+	files, err := listArchiveFiles(fixturesDir)
+	assert.Nil(t, err)
+	matchesFixtures := func() {
+		for _, v := range files {
+			expected, err := os.ReadFile(filepath.Join(fixturesDir, v))
+			assert.Nil(t, err)
+			downloaded, err := os.ReadFile(filepath.Join(task.params.outputDir, v))
+			assert.Nil(t, err)
+			assert.Equal(t, expected, downloaded, "downloaded %s does not match", v)
+		}
+		_, err = os.Stat(filepath.Join(task.params.outputDir, quarantineDir))
+		assert.True(t, os.IsNotExist(err))
+	}
+	damage := func() {
+		// partly written, modified and missing
+		raw, err := os.ReadFile(filepath.Join(fixturesDir, files[0]))
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(filepath.Join(task.params.outputDir, files[0]), raw[:len(raw)/2], 0644))
+		raw, err = os.ReadFile(filepath.Join(fixturesDir, files[1]))
+		assert.Nil(t, err)
+		raw[len(raw)/3] ^= 0xff
+		assert.Nil(t, os.WriteFile(filepath.Join(task.params.outputDir, files[1]), raw, 0644))
+		assert.Nil(t, os.Remove(filepath.Join(task.params.outputDir, files[2])))
+	}
+
+	// without repair only the missing file is downloaded
+	damage()
+	assert.Nil(t, task.Execute(context.Background()))
+	_, err = os.Stat(filepath.Join(task.params.outputDir, files[2]))
+	assert.Nil(t, err)
+
+	task.params.repair = true
+	assert.Nil(t, task.Execute(context.Background()))
+	matchesFixtures()
+
+	// without an entitlement the archives are read back
+	damage()
+	assert.Nil(t, os.Remove(filepath.Join(task.params.outputDir, entitlementFileName)))
+	assert.Nil(t, task.Execute(context.Background()))
+	matchesFixtures()
+}
+
+func TestDownloadSimulatedFailures(t *testing.T) {
+	api := NewMockAPI(fixturesDir)
+	server := httptest.NewServer(api)
+	defer server.Close()
+	files, err := listArchiveFiles(fixturesDir)
+	assert.Nil(t, err)
+
+	for _, mode := range []string{MockFailureError, MockFailureTruncate, MockFailureCorrupt} {
+		task := NewDownloadTask()
+		task.params.apiKey = "test-key"
+		task.params.orderID = 1
+		task.params.concurrency = 3
+		task.params.processWorkers = 2
+		task.params.outputDir = t.TempDir()
+		task.params.apiEndpoint = server.URL
+		failures, err := parseMockFailures(mode+"=100", 1)
+		assert.Nil(t, err)
+		api.SimulateFailures(failures)
+		err = task.Execute(context.Background())
+		if mode == MockFailureCorrupt {
+			// reading it back shows a corrupt file of the right size, which
+			// is quarantined
+			assert.True(t, errors.Is(err, ErrDataCorruption), "%s: %v", mode, err)
+		} else {
+			assert.True(t, errors.Is(err, ErrPartialDownload), mode)
+		}
+
+		// a run against a healthy API gets every file right
+		api.SimulateFailures(nil)
+		assert.Nil(t, task.Execute(context.Background()), mode)
+		for _, v := range files {
+			expected, err := os.ReadFile(filepath.Join(fixturesDir, v))
+			assert.Nil(t, err)
+			downloaded, err := os.ReadFile(filepath.Join(task.params.outputDir, v))
+			assert.Nil(t, err)
+			assert.Equal(t, expected, downloaded, "%s: downloaded %s does not match", mode, v)
+		}
+	}
+}
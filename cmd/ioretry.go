@@ -0,0 +1,88 @@
+package main
+
+import (
+	"compress/flate"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ErrTransientIO is a read which kept failing with an error a network
+// filesystem returns while it is unavailable, rather than bad data
+var ErrTransientIO = errors.New("i/o error")
+
+const (
+	defaultIORetries      = 3
+	defaultIORetryBackoff = 500 * time.Millisecond
+)
+
+var ioRetry = &ioRetryPolicy{retries: defaultIORetries, backoff: defaultIORetryBackoff}
+
+// ioRetryPolicy retries archive reads which fail with transient errors, as
+// NFS and SMB mounts return while the server or network recovers
+type ioRetryPolicy struct {
+	retries int
+	// doubled after each retry
+	backoff time.Duration
+}
+
+func (o *ioRetryPolicy) Validate() error {
+	if o.retries < 0 || o.backoff < 0 {
+		return errors.New("io-retries and io-retry-backoff can not be negative")
+	}
+	return nil
+}
+
+// Do runs fn, running it again while it fails with a transient error up to
+// the retry limit
+func (o *ioRetryPolicy) Do(path string, fn func() error) error {
+	delay := o.backoff
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil || !isTransientIOError(err) {
+			return err
+		}
+		if attempt >= o.retries {
+			return withKind(ErrTransientIO, errors.Wrapf(err, "cant read %s after %d retries, check the network filesystem it is on. The archive itself is not corrupt", path, o.retries))
+		}
+		logrus.Warnf("i/o error reading %s, retrying in %s (%d/%d): %s", path, delay, attempt+1, o.retries, err)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isTransientIOError returns whether err is an error network filesystems
+// return while unavailable, which a later read may not
+func isTransientIOError(err error) bool {
+	return errors.Is(err, syscall.EIO) || errors.Is(err, syscall.ESTALE) || errors.Is(err, syscall.ETIMEDOUT)
+}
+
+// retryingReaderAt retries the reads of an archive file with ioRetry
+type retryingReaderAt struct {
+	r    io.ReaderAt
+	path string
+}
+
+func (o *retryingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	err := ioRetry.Do(o.path, func() error {
+		var err error
+		n, err = o.r.ReadAt(p, off)
+		return err
+	})
+	return n, err
+}
+
+// archiveReadError classifies an error reading the rows of an archive as
+// corruption when the data itself is bad. Transient i/o errors are already
+// classified by ioRetry.
+func archiveReadError(err error) error {
+	var corrupt flate.CorruptInputError
+	if errors.As(err, &corrupt) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return withKind(ErrDataCorruption, errors.Wrap(err, "archive is corrupt or truncated, download it again"))
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/test-go/testify/assert"
+)
+
+// flakyReaderAt fails the first failures reads with err
+type flakyReaderAt struct {
+	r        io.ReaderAt
+	failures int
+	err      error
+	reads    int
+}
+
+func (o *flakyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	o.reads++
+	if o.reads <= o.failures {
+		return 0, o.err
+	}
+	return o.r.ReadAt(p, off)
+}
+
+func TestRetryingReaderAt(t *testing.T) {
+	defer func(policy ioRetryPolicy) { *ioRetry = policy }(*ioRetry)
+	ioRetry.retries = 2
+	ioRetry.backoff = time.Millisecond
+
+	flaky := &flakyReaderAt{r: strings.NewReader("hello"), failures: 2, err: &os.PathError{Op: "read", Path: "a.zip", Err: syscall.EIO}}
+	p := make([]byte, 5)
+	n, err := (&retryingReaderAt{r: flaky, path: "a.zip"}).ReadAt(p, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "hello", string(p[:n]))
+	assert.Equal(t, 3, flaky.reads)
+
+	// still failing after the retries
+	flaky = &flakyReaderAt{r: strings.NewReader("hello"), failures: 3, err: syscall.ESTALE}
+	_, err = (&retryingReaderAt{r: flaky, path: "a.zip"}).ReadAt(p, 0)
+	assert.True(t, errors.Is(err, ErrTransientIO))
+	assert.Equal(t, ExitTransientIO, classifyError(errors.Wrap(err, "cant read swaps.json")).Code)
+	assert.Equal(t, 3, flaky.reads)
+
+	// other errors are not retried
+	flaky = &flakyReaderAt{r: strings.NewReader("hello"), failures: 1, err: syscall.EACCES}
+	_, err = (&retryingReaderAt{r: flaky, path: "a.zip"}).ReadAt(p, 0)
+	assert.False(t, errors.Is(err, ErrTransientIO))
+	assert.Equal(t, 1, flaky.reads)
+}
+
+func TestReadArchiveRowsCorrupt(t *testing.T) {
+	path := t.TempDir() + "/20240505-120000.zip"
+	rows := strings.Builder{}
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&rows, "{\"slot\":%d,\"swap\":{\"swapType\":\"buy\"}}\n", i)
+	}
+	writeTestArchive(t, path, map[string]string{"swaps.json": rows.String()})
+	raw, err := os.ReadFile(path)
+	assert.Nil(t, err)
+	// damage the compressed data after the local file header
+	for i := 100; i < 140; i++ {
+		raw[i] = 0xff
+	}
+	assert.Nil(t, os.WriteFile(path, raw, 0666))
+
+	err = readArchiveRows(path, func(row []byte) error { return nil })
+	assert.NotNil(t, err)
+	assert.Equal(t, ExitDataCorruption, classifyError(err).Code)
+}
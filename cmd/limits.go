@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// ErrCodeLimitExceeded is the JSON RPC error code returned when a connection
+// exceeds its subscription or message rate limit
+const ErrCodeLimitExceeded = -32005
+
+// connectionLimits emulates the per connection limits of the production
+// server. Zero limits are unlimited.
+type connectionLimits struct {
+	maxSubscriptions  int
+	maxMessagesPerSec int
+
+	subscriptions  int
+	windowStart    time.Time
+	windowMessages int
+}
+
+// AllowMessage counts a message received from the client and reports whether
+// it is within the rate limit
+func (o *connectionLimits) AllowMessage(now time.Time) bool {
+	if o.maxMessagesPerSec == 0 {
+		return true
+	}
+	if now.Sub(o.windowStart) >= time.Second {
+		o.windowStart = now
+		o.windowMessages = 0
+	}
+	o.windowMessages++
+	return o.windowMessages <= o.maxMessagesPerSec
+}
+
+// AllowSubscription counts a new subscription and reports whether it is within
+// the subscription limit
+func (o *connectionLimits) AllowSubscription() bool {
+	if o.maxSubscriptions != 0 && o.subscriptions >= o.maxSubscriptions {
+		return false
+	}
+	o.subscriptions++
+	return true
+}
+
+func subscriptionLimitMessage(maxSubscriptions int) string {
+	return fmt.Sprintf("subscription limit exceeded, max %d subscriptions per connection", maxSubscriptions)
+}
+
+// rpcError is the JSON RPC error response to the request with this id
+func rpcError(id int, code int, message string) ([]byte, error) {
+	return json.Marshal(map[string]any{
+		"id": id,
+		"error": map[string]any{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+func writeRPCError(c *websocket.Conn, id int, code int, message string) error {
+	raw, err := rpcError(id, code, message)
+	if err != nil {
+		return err
+	}
+	return c.WriteMessage(websocket.TextMessage, raw)
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestConnectionLimits(t *testing.T) {
+	limits := connectionLimits{maxSubscriptions: 2, maxMessagesPerSec: 3}
+	assert.True(t, limits.AllowSubscription())
+	assert.True(t, limits.AllowSubscription())
+	assert.False(t, limits.AllowSubscription())
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.True(t, limits.AllowMessage(now))
+	}
+	assert.False(t, limits.AllowMessage(now.Add(500*time.Millisecond)))
+	assert.True(t, limits.AllowMessage(now.Add(time.Second)))
+
+	unlimited := connectionLimits{}
+	for i := 0; i < 100; i++ {
+		assert.True(t, unlimited.AllowSubscription())
+		assert.True(t, unlimited.AllowMessage(now))
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+)
+
+// lineIndex holds the offset of every line in a file so lines can be read in
+// any order, e.g. newest first, without loading the file into memory
+type lineIndex struct {
+	f *os.File
+	// start of each line followed by the end of the file
+	offsets []int64
+}
+
+func newLineIndex(path string) (*lineIndex, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	offsets := []int64{}
+	pos := int64(0)
+	lineStart := true
+	r := bufio.NewReader(f)
+	for {
+		chunk, err := r.ReadSlice('\n')
+		if len(chunk) > 0 && lineStart {
+			offsets = append(offsets, pos)
+		}
+		pos += int64(len(chunk))
+		// long lines are returned in several chunks
+		lineStart = err == nil
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != bufio.ErrBufferFull {
+			f.Close()
+			return nil, err
+		}
+	}
+	return &lineIndex{
+		f:       f,
+		offsets: append(offsets, pos),
+	}, nil
+}
+
+// Len returns the number of lines
+func (o *lineIndex) Len() int {
+	return len(o.offsets) - 1
+}
+
+// Line returns line i without its line ending
+func (o *lineIndex) Line(i int) ([]byte, error) {
+	buf := make([]byte, o.offsets[i+1]-o.offsets[i])
+	if _, err := o.f.ReadAt(buf, o.offsets[i]); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf, "\r\n"), nil
+}
+
+func (o *lineIndex) Close() error {
+	return o.f.Close()
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type LiquidityTask struct {
+	layout     layoutOptions
+	provenance provenanceOptions
+	interval   time.Duration
+	amms       []string
+	// latest snapshot per pair for the current interval, only used when an interval is set
+	pending map[string]*liquiditySnapshot
+	params  struct {
+		dataDir  string
+		interval string
+		amms     string
+		format   string
+		output   string
+	}
+}
+
+const (
+	PriceSourceReserves = "reserves"
+	PriceSourceImplied  = "implied"
+)
+
+type liquiditySnapshot struct {
+	time         time.Time
+	slot         uint64
+	amm          string
+	mint         string
+	price        float64
+	priceSource  string
+	priceImpact  float64
+	baseReserve  float64
+	quoteReserve float64
+	swaps        uint64
+	// of the last swap, with --with-provenance
+	provenance []any
+}
+
+func NewLiquidityTask() *LiquidityTask {
+	return &LiquidityTask{
+		pending: map[string]*liquiditySnapshot{},
+	}
+}
+
+func (o *LiquidityTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir to get the archive data from")
+	cmd.Flags().StringVar(&o.params.interval, "interval", "0", "Write the last snapshot of each pair per interval e.g. 1m. 0 writes a snapshot for every swap")
+	cmd.Flags().StringVarP(&o.params.amms, "amm", "a", "", "Only include these AMMs. (Comma separated list)")
+	cmd.Flags().StringVarP(&o.params.format, "format", "f", ReportFormatCSV, "Output format: csv, json or arrow")
+	cmd.Flags().StringVarP(&o.params.output, "output", "o", "", "File to write the snapshots to, or the dir with --layout hive. Defaults to stdout")
+	o.layout.SetupParameters(cmd)
+	o.provenance.SetupParameters(cmd)
+}
+
+func (o *LiquidityTask) GetMeta() Meta {
+	return Meta{
+		Name:        "LiquidityTask",
+		Use:         "liquidity",
+		Description: "Extract per pair price and liquidity snapshots over time from local archive files for slippage modelling. Uses pool reserves when present in the data, otherwise the price implied by each swap.",
+	}
+}
+
+func (o *LiquidityTask) Execute(ctx context.Context) error {
+	if err := o.validateParams(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+
+	w, out, err := o.layout.Open(o.params.output, o.params.format, o.provenance.Columns([]string{"time", "slot", "amm", "mint", "price", "price_source", "price_impact", "base_reserve", "quote_reserve", "swaps"}), "time")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	for i, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logrus.Infof("extracting snapshots from file (%d of %d) %s", i+1, len(files), v)
+		err := o.provenance.ReadEvents(o.params.dataDir+"/"+v, nil, func(event EventRow, provenance []any) error {
+			snapshot := snapshotFromEvent(event)
+			if snapshot == nil {
+				return nil
+			}
+			snapshot.provenance = provenance
+			if len(o.amms) != 0 && !inSlice(o.amms, snapshot.amm) {
+				return nil
+			}
+			return o.add(w, snapshot)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// write any remaining partial intervals
+	remaining := []*liquiditySnapshot{}
+	for _, v := range o.pending {
+		remaining = append(remaining, v)
+	}
+	sort.Slice(remaining, func(i, j int) bool {
+		if !remaining[i].time.Equal(remaining[j].time) {
+			return remaining[i].time.Before(remaining[j].time)
+		}
+		return remaining[i].amm < remaining[j].amm
+	})
+	for _, v := range remaining {
+		if err := o.write(w, v); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// add writes the snapshot straight away or, when aggregating by interval,
+// keeps it as the latest for its pair until the pair moves into a new interval
+func (o *LiquidityTask) add(w *recordWriter, snapshot *liquiditySnapshot) error {
+	if o.interval == 0 {
+		return o.write(w, snapshot)
+	}
+	previous, ok := o.pending[snapshot.amm]
+	if ok && previous.time.Truncate(o.interval).Equal(snapshot.time.Truncate(o.interval)) {
+		snapshot.swaps += previous.swaps
+		o.pending[snapshot.amm] = snapshot
+		return nil
+	}
+	if ok {
+		if err := o.write(w, previous); err != nil {
+			return err
+		}
+	}
+	o.pending[snapshot.amm] = snapshot
+	return nil
+}
+
+func (o *LiquidityTask) write(w *recordWriter, v *liquiditySnapshot) error {
+	t := v.time
+	if o.interval != 0 {
+		t = t.Truncate(o.interval)
+	}
+	return w.Write(append([]any{t.Format(time.RFC3339), v.slot, v.amm, v.mint, v.price, v.priceSource, v.priceImpact, v.baseReserve, v.quoteReserve, v.swaps}, v.provenance...)...)
+}
+
+// snapshotFromEvent returns the pair state after the event or nil if the event
+// has nothing to price. Prices are quote per base in raw token units.
+func snapshotFromEvent(event EventRow) *liquiditySnapshot {
+	if event.Pair != nil {
+		base := event.Pair.BaseTokenLiquidityAdded.Float64()
+		quote := event.Pair.QuoteTokenLiquidityAdded.Float64()
+		if base == 0 || quote == 0 {
+			return nil
+		}
+		return &liquiditySnapshot{
+			time:         event.Time(),
+			slot:         event.Slot,
+			amm:          event.Pair.AmmAccount,
+			mint:         event.Pair.BaseToken.Account,
+			price:        quote / base,
+			priceSource:  PriceSourceReserves,
+			baseReserve:  base,
+			quoteReserve: quote,
+		}
+	}
+	if event.Swap == nil {
+		return nil
+	}
+
+	swap := event.Swap
+	baseAmount := swap.BaseAmount.Float64()
+	quoteAmount := swap.QuoteAmount.Float64()
+	snapshot := &liquiditySnapshot{
+		time:  event.Time(),
+		slot:  event.Slot,
+		amm:   swap.AmmAccount,
+		mint:  swap.BaseTokenMint,
+		swaps: 1,
+	}
+
+	baseReserve := swap.BaseReserve.Float64()
+	quoteReserve := swap.QuoteReserve.Float64()
+	if baseReserve != 0 && quoteReserve != 0 {
+		snapshot.price = quoteReserve / baseReserve
+		snapshot.priceSource = PriceSourceReserves
+		snapshot.baseReserve = baseReserve
+		snapshot.quoteReserve = quoteReserve
+
+		// undo the swap to get the reserves before it
+		preBase, preQuote := baseReserve+baseAmount, quoteReserve-quoteAmount
+		if swap.SwapType == SwapTypeSell {
+			preBase, preQuote = baseReserve-baseAmount, quoteReserve+quoteAmount
+		}
+		if preBase > 0 && preQuote > 0 {
+			prePrice := preQuote / preBase
+			snapshot.priceImpact = (snapshot.price - prePrice) / prePrice
+		}
+		return snapshot
+	}
+
+	if baseAmount == 0 || quoteAmount == 0 {
+		return nil
+	}
+	snapshot.price = quoteAmount / baseAmount
+	snapshot.priceSource = PriceSourceImplied
+	return snapshot
+}
+
+func (o *LiquidityTask) validateParams() error {
+	interval, err := time.ParseDuration(o.params.interval)
+	if err != nil {
+		return errors.Wrap(err, "invalid interval")
+	}
+	if interval < 0 {
+		return errors.New("interval can not be negative")
+	}
+	o.interval = interval
+	o.amms = splitList(o.params.amms)
+	return o.layout.Validate(o.params.output)
+}
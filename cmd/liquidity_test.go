@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestLiquidity(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"pairs.json": `{"slot":1,"blockTime":1714910400,"pair":{"ammAccount":"A","baseToken":{"account":"a"},"baseTokenLiquidityAdded":"1000","quoteTokenLiquidityAdded":"50000"}}
+`,
+		"swaps.json": `{"slot":2,"blockTime":1714910410,"swap":{"ammAccount":"A","baseTokenMint":"a","swapType":"buy","baseAmount":"100","quoteAmount":"6000","baseReserve":"900","quoteReserve":"56000"}}
+{"slot":3,"blockTime":1714910420,"swap":{"ammAccount":"B","baseTokenMint":"b","swapType":"sell","baseAmount":"10","quoteAmount":"5"}}
+{"slot":4,"blockTime":1714910430,"swap":{"ammAccount":"B","baseTokenMint":"b","swapType":"sell","baseAmount":"0","quoteAmount":"5"}}
+{"slot":5,"blockTime":1714910470,"swap":{"ammAccount":"A","baseTokenMint":"a","swapType":"sell","baseAmount":"100","quoteAmount":"5000","baseReserve":"1000","quoteReserve":"51000"}}
+`,
+	})
+
+	for _, test := range []struct {
+		interval string
+		amms     string
+		expected string
+	}{
+		// a snapshot per pair and swap with a price, from reserves when known
+		{interval: "0", expected: `time,slot,amm,mint,price,price_source,price_impact,base_reserve,quote_reserve,swaps
+2024-05-05T12:00:00Z,1,A,a,50,reserves,0,1000,50000,0
+2024-05-05T12:00:10Z,2,A,a,62.22222222222222,reserves,0.24444444444444444,900,56000,1
+2024-05-05T12:00:20Z,3,B,b,0.5,implied,0,0,0,1
+2024-05-05T12:01:10Z,5,A,a,51,reserves,-0.18035714285714285,1000,51000,1
+`},
+		// the last snapshot of each interval with the swaps in it
+		{interval: "1m", amms: "A", expected: `time,slot,amm,mint,price,price_source,price_impact,base_reserve,quote_reserve,swaps
+2024-05-05T12:00:00Z,2,A,a,62.22222222222222,reserves,0.24444444444444444,900,56000,1
+2024-05-05T12:01:00Z,5,A,a,51,reserves,-0.18035714285714285,1000,51000,1
+`},
+	} {
+		task := NewLiquidityTask()
+		task.params.dataDir = dataDir
+		task.params.interval = test.interval
+		task.params.amms = test.amms
+		task.params.format = ReportFormatCSV
+		task.params.output = filepath.Join(t.TempDir(), "liquidity.csv")
+		assert.Nil(t, task.Execute(context.Background()))
+		raw, err := os.ReadFile(task.params.output)
+		assert.Nil(t, err)
+		assert.Equal(t, test.expected, string(raw), test.interval)
+	}
+
+	task := NewLiquidityTask()
+	task.params.dataDir = dataDir
+	task.params.interval = "-1m"
+	task.params.format = ReportFormatCSV
+	assert.NotNil(t, task.Execute(context.Background()))
+}
+
+// TestLiquidityFixtures snapshots the fixture archives hourly, checks the
+// snapshots against the archives and compares the output to
+// testdata/liquidity
+func TestLiquidityFixtures(t *testing.T) {
+	dataDir := copyFixtures(t)
+	swaps := map[string]uint64{}
+	files, err := listArchiveFiles(dataDir)
+	assert.Nil(t, err)
+	for _, v := range files {
+		assert.Nil(t, readArchiveEvents(filepath.Join(dataDir, v), nil, func(event EventRow) error {
+			if event.Swap != nil {
+				swaps[event.Swap.AmmAccount]++
+			}
+			return nil
+		}))
+	}
+
+	task := NewLiquidityTask()
+	task.params.dataDir = dataDir
+	task.params.interval = "1h"
+	task.params.format = ReportFormatJSON
+	task.params.output = filepath.Join(t.TempDir(), "liquidity.json")
+	assert.Nil(t, task.Execute(context.Background()))
+	raw, err := os.ReadFile(task.params.output)
+	assert.Nil(t, err)
+
+	counted := map[string]uint64{}
+	for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+		row := struct {
+			Time        string  `json:"time"`
+			Amm         string  `json:"amm"`
+			Price       float64 `json:"price"`
+			PriceSource string  `json:"price_source"`
+			Swaps       uint64  `json:"swaps"`
+		}{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &row))
+		assert.True(t, row.Price > 0, line)
+		assert.True(t, row.PriceSource == PriceSourceReserves || row.PriceSource == PriceSourceImplied, line)
+		assert.True(t, strings.HasSuffix(row.Time, ":00:00Z"), line)
+		counted[row.Amm] += row.Swaps
+	}
+	assert.Equal(t, swaps, counted)
+	assertGolden(t, "testdata/liquidity/hourly.golden", string(raw))
+}
@@ -3,7 +3,8 @@ package main
 import (
 	"context"
 	"errors"
-	"log"
+	"fmt"
+	"os"
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -17,20 +18,128 @@ func main() {
 		NewDownloadTask(),
 		NewSimulateTask(),
 		NewReduceTask(),
+		NewSuggestFiltersTask(),
+		NewVolumeTask(),
+		NewFeaturesTask(),
+		NewLiquidityTask(),
+		NewBenchTask(),
+		NewPackageTask(),
+		NewUnpackTask(),
+		NewProxyTask(),
+		NewPingTask(),
+		NewDoctorTask(),
+		NewSortTask(),
+		NewRecompressTask(),
+		NewSplitDatasetTask(),
+		NewTailTask(),
+		NewWalletTimelineTask(),
+		NewSlotAtTask(),
+		NewPeekTask(),
 	}
 	rootCmd := &cobra.Command{
-		Use:   "ss-cli",
-		Short: "run solanastreaming commands",
+		Use:     "ss-cli",
+		Short:   "run solanastreaming commands",
+		Version: version,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return errors.New("please select command")
+			return withKind(ErrUsage, errors.New("please select command"))
 		},
+		SilenceErrors: true,
+	}
+	rootCmd.SetVersionTemplate(fmt.Sprintf("ss-cli version {{.Version}}\nreads archive schema versions up to %d\n", archiveSchemaVersion))
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return withKind(ErrUsage, err)
+	})
+	encryptionKeyFile := ""
+	maxDisk := ""
+	maxMemory := ""
+	archiveNameFormat := ""
+	errorFormat := ErrorFormatText
+	rootCmd.PersistentFlags().StringVar(&maxDisk, "max-disk", "", "Stop gracefully before writing more than this much to disk e.g. 50GB. Run again after freeing space to resume")
+	rootCmd.PersistentFlags().StringVar(&maxMemory, "max-memory", "", "How much memory sorts can use before spilling to temporary files on disk e.g. 2GB. Defaults to 512MB")
+	rootCmd.PersistentFlags().StringVar(&encryptionKeyFile, "encryption-key-file", "", "A file with a 32 byte (or 64 hex character) key. Encrypted archives are decrypted when read and archives written by reduce are encrypted")
+	rootCmd.PersistentFlags().StringVar(&archiveNameFormat, "archive-name-format", defaultArchiveNameFormat, "How local archive files are named, with a Go time layout in braces e.g. \"swaps-{2006-01-02T15}.zip\". Used to order and select files by date")
+	rootCmd.PersistentFlags().BoolVar(&schemaDrift.enabled, "strict-schema", false, "Collect the fields in archive rows this CLI does not know about and report them at the end, a sign your ss-cli may be outdated. Slower as rows are parsed twice")
+	rootCmd.PersistentFlags().StringVar(&eventCache, "event-cache", "", "A directory to cache parsed archive events in, so repeated volume, liquidity and analyze runs skip parsing JSON. Rebuilt automatically when an archive changes")
+	rootCmd.PersistentFlags().DurationVar(&watchdog.timeout, "timeout", 0, "Fail the command if it has not finished after this long e.g. 6h. 0 means no limit. doctor and replay webhook have their own --timeout")
+	rootCmd.PersistentFlags().DurationVar(&watchdog.stallTimeout, "stall-timeout", 0, "Fail the command if no bytes are downloaded or written and no rows are read for this long e.g. 15m, and log a goroutine dump. 0 means never")
+	rootCmd.PersistentFlags().StringVar(&watchdog.onStall, "on-stall", StallFail, "What to do when the command stalls: fail, or retry it up to 3 times")
+	rootCmd.PersistentFlags().IntVar(&ioRetry.retries, "io-retries", defaultIORetries, "How many times to retry reading an archive after a transient i/o error, as network filesystems such as NFS and SMB return while recovering")
+	rootCmd.PersistentFlags().DurationVar(&ioRetry.backoff, "io-retry-backoff", defaultIORetryBackoff, "How long to wait before the first i/o retry, doubled after each retry")
+	rootCmd.PersistentFlags().StringVar(&metricsPush.url, "push-metrics", "", "A Prometheus pushgateway url to push the final counters of the run to, e.g. http://pushgateway:9091/metrics/job/ss-cli")
+	rootCmd.PersistentFlags().StringVar(&errorFormat, "error-format", ErrorFormatText, "How a failure is printed: text or json. json prints the error type and exit code for wrapper scripts")
+	rootCmd.PersistentPreRunE = func(cmd *cobra.Command, args []string) error {
+		if errorFormat != ErrorFormatText && errorFormat != ErrorFormatJSON {
+			return withKind(ErrUsage, fmt.Errorf("error-format must be '%s' or '%s'", ErrorFormatText, ErrorFormatJSON))
+		}
+		if watchdog.onStall != StallFail && watchdog.onStall != StallRetry {
+			return withKind(ErrUsage, fmt.Errorf("on-stall must be '%s' or '%s'", StallFail, StallRetry))
+		}
+		if watchdog.timeout < 0 || watchdog.stallTimeout < 0 {
+			return withKind(ErrUsage, errors.New("timeout and stall-timeout can not be negative"))
+		}
+		if err := ioRetry.Validate(); err != nil {
+			return withKind(ErrUsage, err)
+		}
+		if err := metricsPush.Validate(); err != nil {
+			return withKind(ErrUsage, err)
+		}
+		names, err := parseArchiveNameScheme(archiveNameFormat)
+		if err != nil {
+			return withKind(ErrUsage, err)
+		}
+		archiveNames = names
+		if maxDisk != "" {
+			limit, err := parseByteSize(maxDisk)
+			if err != nil {
+				return withKind(ErrUsage, err)
+			}
+			diskUsage.limit = limit
+		}
+		if maxMemory != "" {
+			limit, err := parseByteSize(maxMemory)
+			if err != nil {
+				return withKind(ErrUsage, err)
+			}
+			sortMemory = limit
+		}
+		return withKind(ErrUsage, loadArchiveKey(encryptionKeyFile))
 	}
 	for _, v := range tasks {
 		rootCmd.AddCommand(tm.GetCommand(v))
 	}
+	rootCmd.AddCommand(tm.GetGroupCommand("analyze", "run analysis reports over local archive files",
+		NewCoTradingTask(),
+		NewSnipersTask(),
+		NewFirstBuyersTask(),
+		NewAnomaliesTask(),
+	))
+	rootCmd.AddCommand(tm.GetGroupCommand("replay", "replay archive data into your own systems",
+		NewReplayWebhookTask(),
+		NewReplayNatsTask(),
+		NewReplayRedisTask(),
+		NewReplayAmqpTask(),
+		NewReplayExecTask(),
+		NewReplayPluginTask(),
+	))
+	rootCmd.AddCommand(tm.GetGroupCommand("quarantine", "list or restore archives which failed verification",
+		NewQuarantineTask(QuarantineList),
+		NewQuarantineTask(QuarantineRestore),
+	))
+	rootCmd.AddCommand(tm.GetGroupCommand("telemetry", "opt in to or out of anonymous usage telemetry",
+		NewTelemetryTask(TelemetryStatus),
+		NewTelemetryTask(TelemetryEnable),
+		NewTelemetryTask(TelemetryDisable),
+	))
+	rootCmd.AddCommand(tm.GetGroupCommand("fixtures", "export test fixtures for client SDKs from archive data",
+		NewFixturesExportTask(),
+	))
+	rootCmd.AddCommand(tm.GetGroupCommand("dev", "tools for testing your integration offline",
+		NewMockAPITask(),
+		NewGenFixturesTask(),
+	))
 
 	err := rootCmd.ExecuteContext(context.Background())
 	if err != nil {
-		log.Fatal(err)
+		os.Exit(reportError(os.Stderr, err, errorFormat))
 	}
 }
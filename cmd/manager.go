@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
@@ -26,8 +27,35 @@ func (o *TaskManager) GetCommand(tsk Task) *cobra.Command {
 	return cmd
 }
 
+// GetGroupCommand returns a parent command which runs each of the tasks as a
+// subcommand e.g. ss-cli analyze snipers
+func (o *TaskManager) GetGroupCommand(use string, description string, tasks ...Task) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   use,
+		Short: description,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withKind(ErrUsage, ErrNoOp)
+		},
+	}
+	for _, v := range tasks {
+		cmd.AddCommand(o.GetCommand(v))
+	}
+	return cmd
+}
+
 func (o *TaskManager) ExecuteTask(ctx context.Context, tsk Task) error {
 	meta := tsk.GetMeta()
 	log.Infof("Running: " + meta.Name)
-	return tsk.Execute(ctx)
+	start := time.Now()
+	err := watchdog.Run(ctx, meta.Name, tsk.Execute)
+	took := time.Since(start)
+	if _, ok := tsk.(*TelemetryTask); !ok {
+		reportTelemetry(ctx, meta.Name, took, err)
+	}
+	metricsPush.Push(ctx, tsk, took, err)
+	if used := diskUsage.Used(); used > 0 {
+		log.Infof("%s wrote %s to disk", meta.Name, formatBytes(used))
+	}
+	schemaDrift.Report()
+	return err
 }
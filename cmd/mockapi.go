@@ -0,0 +1,334 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// mockOrdersFileName optionally defines the orders the mock API knows about.
+// Without it every order id returns an order covering all archives.
+const mockOrdersFileName = "orders.json"
+
+// MockOrder is an order definition in the mock API orders file
+type MockOrder struct {
+	ID      uint      `json:"id"`
+	From    time.Time `json:"from"`
+	To      time.Time `json:"to"`
+	Expired bool      `json:"expired"` // downloads return 402 payment required
+	// split into a file series per dataset e.g. 20240505-120000.swaps.zip
+	Datasets []string `json:"datasets"`
+}
+
+// MockAPI serves the order and archive endpoints used by the download command
+// from archive files in a local dir
+type MockAPI struct {
+	dataDir  string
+	apiKey   string
+	failures *mockFailures
+}
+
+func NewMockAPI(dataDir string) *MockAPI {
+	return &MockAPI{
+		dataDir: dataDir,
+	}
+}
+
+// RequireAPIKey makes the order and metadata endpoints reject any other key
+func (o *MockAPI) RequireAPIKey(apiKey string) {
+	o.apiKey = apiKey
+}
+
+// SimulateFailures fails a share of the file downloads, or none when nil
+func (o *MockAPI) SimulateFailures(failures *mockFailures) {
+	o.failures = failures
+}
+
+func (o *MockAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	logrus.Debugf("mock api: %s %s", r.Method, r.URL.Path)
+	switch {
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/order/") && strings.HasSuffix(r.URL.Path, "/entitlement"):
+		o.handleEntitlement(w, r)
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/order/"):
+		o.handleOrder(w, r)
+	case r.Method == http.MethodPost && r.URL.Path == "/archive/metadata":
+		o.handleMetadata(w, r)
+	case (r.Method == http.MethodGet || r.Method == http.MethodHead) && strings.HasPrefix(r.URL.Path, "/archive/download/"):
+		o.handleDownload(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (o *MockAPI) handleOrder(w http.ResponseWriter, r *http.Request) {
+	if !o.authorized(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/order/"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+	order, err := o.getOrder(uint(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if order == nil {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, Order{
+		DownloadToken:   mockDownloadToken(order.ID),
+		ArchiveDataFrom: order.From,
+		ArchiveDataTo:   order.To,
+		Datasets:        order.Datasets,
+	})
+}
+
+// getOrder returns the order from the orders file or, without one, an order
+// covering every hour from the first to the last archive, split by dataset if
+// the archives are. Returns nil if the order does not exist.
+func (o *MockAPI) getOrder(id uint) (*MockOrder, error) {
+	raw, err := os.ReadFile(filepath.Join(o.dataDir, mockOrdersFileName))
+	if err == nil {
+		orders := []MockOrder{}
+		if err := json.Unmarshal(raw, &orders); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s", mockOrdersFileName)
+		}
+		for _, v := range orders {
+			if v.ID == id {
+				return &v, nil
+			}
+		}
+		return nil, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	files, err := listArchiveFiles(o.dataDir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+	first, _ := splitDataset(files[0])
+	from, ok := apiArchiveNames.Time(first)
+	if !ok {
+		return nil, fmt.Errorf("%s is not named like an API archive", files[0])
+	}
+	last, _ := splitDataset(files[len(files)-1])
+	to, ok := apiArchiveNames.Time(last)
+	if !ok {
+		return nil, fmt.Errorf("%s is not named like an API archive", files[len(files)-1])
+	}
+	datasets := []string{}
+	for _, v := range files {
+		if _, dataset := splitDataset(v); dataset != "" && !slices.Contains(datasets, dataset) {
+			datasets = append(datasets, dataset)
+		}
+	}
+	slices.Sort(datasets)
+	return &MockOrder{ID: id, From: from, To: to.Add(time.Hour), Datasets: datasets}, nil
+}
+
+// mockEntitlementKey is a fixed dev key so mock entitlements can be verified
+// by builds with their entitlement key set to mockEntitlementPublicKey()
+func mockEntitlementKey() ed25519.PrivateKey {
+	seed := sha256.Sum256([]byte("ss-cli mock api entitlement key"))
+	return ed25519.NewKeyFromSeed(seed[:])
+}
+
+func mockEntitlementPublicKey() string {
+	return solana.PublicKeyFromBytes(mockEntitlementKey().Public().(ed25519.PublicKey)).String()
+}
+
+func (o *MockAPI) handleEntitlement(w http.ResponseWriter, r *http.Request) {
+	if !o.authorized(w, r) {
+		return
+	}
+	id, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/order/"), "/entitlement"))
+	if err != nil {
+		http.Error(w, "invalid order id", http.StatusBadRequest)
+		return
+	}
+	order, err := o.getOrder(uint(id))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if order == nil {
+		http.NotFound(w, r)
+		return
+	}
+	entitlement := Entitlement{
+		OrderID:         order.ID,
+		ArchiveDataFrom: order.From,
+		ArchiveDataTo:   order.To,
+		Files:           map[string]string{},
+		IssuedAt:        time.Now().UTC(),
+	}
+	for _, v := range orderArchiveFiles(order.From, order.To, order.Datasets) {
+		sum, err := fileSHA256(o.archivePath(v))
+		if err != nil {
+			continue
+		}
+		entitlement.Files[v+".zip"] = sum
+	}
+	signed, err := signEntitlement(entitlement, mockEntitlementKey())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, signed)
+}
+
+func (o *MockAPI) authorized(w http.ResponseWriter, r *http.Request) bool {
+	apiKey := r.Header.Get("X-API-KEY")
+	if apiKey == "" || (o.apiKey != "" && apiKey != o.apiKey) {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+		return false
+	}
+	return true
+}
+
+func mockDownloadToken(orderID uint) string {
+	return fmt.Sprintf("mock-download-token-%d", orderID)
+}
+
+func (o *MockAPI) handleMetadata(w http.ResponseWriter, r *http.Request) {
+	if !o.authorized(w, r) {
+		return
+	}
+	request := struct {
+		Files []string `json:"files"`
+	}{}
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	type metadata struct {
+		Filesize uint `json:"size"`
+	}
+	response := []metadata{}
+	for _, v := range request.Files {
+		info, err := os.Stat(o.archivePath(v))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("unknown file %s", v), http.StatusNotFound)
+			return
+		}
+		response = append(response, metadata{Filesize: uint(info.Size())})
+	}
+	writeJSON(w, response)
+}
+
+func (o *MockAPI) handleDownload(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.Atoi(strings.TrimPrefix(r.URL.Query().Get("token"), "mock-download-token-"))
+	if err != nil {
+		http.Error(w, "invalid download token", http.StatusPaymentRequired)
+		return
+	}
+	order, err := o.getOrder(uint(orderID))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if order == nil || order.Expired || r.URL.Query().Get("token") != mockDownloadToken(order.ID) {
+		http.Error(w, "payment required or order expired", http.StatusPaymentRequired)
+		return
+	}
+	path := o.archivePath(strings.TrimPrefix(r.URL.Path, "/archive/download/"))
+	if _, err := os.Stat(path); err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if o.failures != nil && r.Method == http.MethodGet {
+		if mode := o.failures.Pick(); mode != "" {
+			serveFailure(w, r, path, mode)
+			return
+		}
+	}
+	http.ServeFile(w, r, path)
+}
+
+func (o *MockAPI) archivePath(fileName string) string {
+	// base only so requests can not escape the data dir
+	return filepath.Join(o.dataDir, filepath.Base(fileName)+".zip")
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logrus.Errorf("write: %s", err.Error())
+	}
+}
+
+type MockAPITask struct {
+	params struct {
+		dataDir          string
+		port             uint
+		apiKey           string
+		simulateFailures string
+		failureSeed      int64
+	}
+}
+
+func NewMockAPITask() *MockAPITask {
+	return &MockAPITask{}
+}
+
+func (o *MockAPITask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "fixtures", "The dir containing the archive files to serve")
+	cmd.Flags().UintVarP(&o.params.port, "port", "p", 8000, "The port the API server will bind to on localhost")
+	cmd.Flags().StringVarP(&o.params.apiKey, "key", "k", "", "Only accept this API key. By default any key is accepted")
+	cmd.Flags().StringVar(&o.params.simulateFailures, "simulate-failures", "", "Fail this percent of file downloads by mode: error (503), truncate (connection dropped half way) or corrupt (a byte changed), e.g. error=10,corrupt=5. (Comma separated list)")
+	cmd.Flags().Int64Var(&o.params.failureSeed, "failure-seed", 0, "Random seed picking the downloads to fail. The same seed fails the same requests in the same order. Defaults to a random seed")
+}
+
+func (o *MockAPITask) GetMeta() Meta {
+	return Meta{
+		Name:        "MockAPITask",
+		Use:         "mock-api",
+		Description: "Run a local stand in for the SolanaStreaming order and archive download API serving archive files from a local dir. Point download at it with --api-endpoint.",
+	}
+}
+
+func (o *MockAPITask) Execute(ctx context.Context) error {
+	if _, err := os.Stat(o.params.dataDir); err != nil {
+		return errors.Wrap(err, "invalid data-dir")
+	}
+	addr := fmt.Sprintf("localhost:%d", o.params.port)
+	logrus.Infof("Mock API listening on http://%s serving archives in dir: %s", addr, o.params.dataDir)
+	logrus.Infof("Mock entitlements are signed with key: %s", mockEntitlementPublicKey())
+	api := NewMockAPI(o.params.dataDir)
+	api.RequireAPIKey(o.params.apiKey)
+	if o.params.simulateFailures != "" {
+		seed := o.params.failureSeed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		failures, err := parseMockFailures(o.params.simulateFailures, seed)
+		if err != nil {
+			return withKind(ErrUsage, errors.Wrap(err, "invalid simulate-failures"))
+		}
+		api.SimulateFailures(failures)
+		logrus.Infof("Simulating download failures: %s, rerun with --failure-seed %d to fail the same requests", o.params.simulateFailures, seed)
+	}
+	return http.ListenAndServe(addr, api)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// The ways the mock API can fail a file download
+const (
+	// responds 503 service unavailable
+	MockFailureError = "error"
+	// drops the connection half way through the file
+	MockFailureTruncate = "truncate"
+	// serves the file with a byte changed, at the right size
+	MockFailureCorrupt = "corrupt"
+)
+
+var mockFailureModes = []string{MockFailureError, MockFailureTruncate, MockFailureCorrupt}
+
+// mockFailures fails a share of the file downloads from the mock API, so the
+// way download copes with an unreliable API can be tested
+type mockFailures struct {
+	// percent of downloads by mode
+	rates  map[string]float64
+	lock   sync.Mutex
+	random *rand.Rand
+}
+
+// parseMockFailures parses --simulate-failures, e.g. error=10,corrupt=5
+func parseMockFailures(list string, seed int64) (*mockFailures, error) {
+	failures := &mockFailures{rates: map[string]float64{}, random: rand.New(rand.NewSource(seed))}
+	total := 0.0
+	for _, v := range strings.Split(list, ",") {
+		mode, value, ok := strings.Cut(strings.TrimSpace(v), "=")
+		if !ok {
+			return nil, fmt.Errorf("%q must be mode=percent", v)
+		}
+		if !inSlice(mockFailureModes, mode) {
+			return nil, fmt.Errorf("mode must be one of %s not %q", strings.Join(mockFailureModes, ", "), mode)
+		}
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percent < 0 || percent > 100 {
+			return nil, fmt.Errorf("percent of %s must be 0-100 not %q", mode, value)
+		}
+		failures.rates[mode] = percent
+		total += percent
+	}
+	if total > 100 {
+		return nil, fmt.Errorf("the percents add up to %g, more than 100", total)
+	}
+	return failures, nil
+}
+
+// Pick returns how to fail the next download, or "" to serve it
+func (o *mockFailures) Pick() string {
+	o.lock.Lock()
+	roll := o.random.Float64() * 100
+	o.lock.Unlock()
+	for _, v := range mockFailureModes {
+		if roll < o.rates[v] {
+			return v
+		}
+		roll -= o.rates[v]
+	}
+	return ""
+}
+
+// serveFailure fails the download of the file at path in the mode
+func serveFailure(w http.ResponseWriter, r *http.Request, path string, mode string) {
+	logrus.Infof("mock api: simulating %s failure of %s", mode, r.URL.Path)
+	if mode == MockFailureError {
+		http.Error(w, "simulated failure", http.StatusServiceUnavailable)
+		return
+	}
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if mode == MockFailureCorrupt {
+		raw[len(raw)/2] ^= 0xff
+		http.ServeContent(w, r, path, time.Time{}, bytes.NewReader(raw))
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(raw)))
+	w.Header().Set("Content-Type", "application/zip")
+	w.WriteHeader(http.StatusOK)
+	w.Write(raw[:len(raw)/2])
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	// drops the connection without completing the response
+	panic(http.ErrAbortHandler)
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestParseMockFailures(t *testing.T) {
+	failures, err := parseMockFailures("error=10, corrupt=2.5%", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]float64{MockFailureError: 10, MockFailureCorrupt: 2.5}, failures.rates)
+	for _, v := range []string{"10", "error", "drop=10", "error=x", "error=101", "error=-1", "error=60,truncate=50"} {
+		_, err := parseMockFailures(v, 1)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestMockFailuresPick(t *testing.T) {
+	failures, err := parseMockFailures("error=20,truncate=30,corrupt=10", 1)
+	assert.Nil(t, err)
+	counts := map[string]int{}
+	for range 10000 {
+		counts[failures.Pick()]++
+	}
+	assert.InDelta(t, 2000, counts[MockFailureError], 200)
+	assert.InDelta(t, 3000, counts[MockFailureTruncate], 200)
+	assert.InDelta(t, 1000, counts[MockFailureCorrupt], 200)
+	assert.InDelta(t, 4000, counts[""], 200)
+
+	// the same seed fails the same requests
+	again, err := parseMockFailures("error=20,truncate=30,corrupt=10", 1)
+	assert.Nil(t, err)
+	failures, err = parseMockFailures("error=20,truncate=30,corrupt=10", 1)
+	assert.Nil(t, err)
+	for range 100 {
+		assert.Equal(t, failures.Pick(), again.Pick())
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/test-go/testify/assert"
+)
+
+// natsPublish is a message received by fakeJetStream
+type natsPublish struct {
+	subject string
+	headers string
+	data    string
+}
+
+// fakeJetStream acks publishes to subjects starting with prefix and replies
+// no responders to the rest
+type fakeJetStream struct {
+	listener net.Listener
+	prefix   string
+	mu       sync.Mutex
+	received []natsPublish
+}
+
+func newFakeJetStream(t *testing.T, prefix string) *fakeJetStream {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	server := &fakeJetStream{listener: listener, prefix: prefix}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return server
+}
+
+func (o *fakeJetStream) URL() string {
+	return "nats://" + o.listener.Addr().String()
+}
+
+func (o *fakeJetStream) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprintf(conn, "INFO {\"headers\":true,\"max_payload\":1048576}\r\n")
+	// replies are delivered to the client's inbox subscription
+	sid := "1"
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		switch fields[0] {
+		case "PING":
+			fmt.Fprintf(conn, "PONG\r\n")
+		case "SUB":
+			sid = fields[len(fields)-1]
+		case "PUB", "HPUB":
+			size, _ := strconv.Atoi(fields[len(fields)-1])
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			msg := natsPublish{subject: fields[1], data: string(payload[:size])}
+			if fields[0] == "HPUB" {
+				headerSize, _ := strconv.Atoi(fields[3])
+				msg.headers, msg.data = msg.data[:headerSize], msg.data[headerSize:]
+			}
+			reply := fields[2]
+			if !strings.HasPrefix(msg.subject, o.prefix) {
+				status := "NATS/1.0 503\r\n\r\n"
+				fmt.Fprintf(conn, "HMSG %s %s %d %d\r\n%s\r\n", reply, sid, len(status), len(status), status)
+				continue
+			}
+			o.mu.Lock()
+			o.received = append(o.received, msg)
+			ack := fmt.Sprintf(`{"stream":"EVENTS","seq":%d}`, len(o.received))
+			o.mu.Unlock()
+			fmt.Fprintf(conn, "MSG %s %s %d\r\n%s\r\n", reply, sid, len(ack), ack)
+		}
+	}
+}
+
+func (o *fakeJetStream) Received() []natsPublish {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return append([]natsPublish{}, o.received...)
+}
+
+func TestReplayNats(t *testing.T) {
+	server := newFakeJetStream(t, "swaps.")
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{\"sourceExchange\":\"raydium\",\"baseTokenMint\":\"mint-a\"}}\n{\"slot\":2,\"swap\":{\"sourceExchange\":\"pumpfun\",\"baseTokenMint\":\"mint-b\"}}\n",
+	})
+
+	task := NewReplayNatsTask()
+	task.replay.dataDir = dataDir
+	task.replay.rate = "0"
+	task.replay.concurrency = 1
+	task.replay.stateFile = t.TempDir() + "/state.json"
+	task.nats.url = server.URL()
+	task.nats.subject = "swaps.{exchange}.{mint}"
+	task.nats.ackTimeout = 5 * time.Second
+	assert.Nil(t, task.Execute(context.Background()))
+
+	received := server.Received()
+	assert.Len(t, received, 2)
+	assert.Equal(t, "swaps.raydium.mint-a", received[0].subject)
+	assert.Equal(t, "swaps.pumpfun.mint-b", received[1].subject)
+	assert.Contains(t, received[0].headers, "Nats-Msg-Id: 20240505-120000.zip:0")
+	assert.Contains(t, received[1].data, "mint-b")
+
+	position, err := task.replay.loadState()
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), position.Events)
+}
+
+func TestNatsSinkNoStream(t *testing.T) {
+	server := newFakeJetStream(t, "swaps.")
+	options := natsOptions{url: server.URL(), subject: "pairs.{mint}", ackTimeout: 5 * time.Second}
+	sink, err := options.NewSink()
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Open(context.Background()))
+	defer sink.Close()
+
+	err = sink.Publish(context.Background(), SinkMessage{Data: []byte("{}")})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "no JetStream stream")
+	assert.Len(t, server.Received(), 0)
+}
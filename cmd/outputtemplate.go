@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Placeholders of an output file name template
+const (
+	TemplateName      = "{name}"
+	TemplateDate      = "{date}"
+	TemplateHour      = "{hour}"
+	TemplateDataset   = "{dataset}"
+	TemplateFirstSlot = "{firstSlot}"
+	TemplateLastSlot  = "{lastSlot}"
+	TemplateExt       = "{ext}"
+)
+
+var templatePlaceholders = []string{TemplateName, TemplateDate, TemplateHour, TemplateDataset, TemplateFirstSlot, TemplateLastSlot, TemplateExt}
+
+var templatePlaceholderPattern = regexp.MustCompile(`\{[^{}]*\}`)
+
+// outputTemplate names output archives from their input archive and the slots
+// they hold, e.g. "{date}-{firstSlot}-{lastSlot}.{ext}" for loaders which
+// partition by slot range
+type outputTemplate struct {
+	template string
+}
+
+func parseOutputTemplate(template string) (*outputTemplate, error) {
+	for _, v := range templatePlaceholderPattern.FindAllString(template, -1) {
+		if !inSlice(templatePlaceholders, v) {
+			return nil, fmt.Errorf("unknown placeholder %s, use %s", v, strings.Join(templatePlaceholders, ", "))
+		}
+	}
+	if strings.ContainsAny(templatePlaceholderPattern.ReplaceAllString(template, ""), "{}") {
+		return nil, fmt.Errorf("template %q has an unclosed {", template)
+	}
+	if strings.ContainsAny(template, `/\`) {
+		return nil, fmt.Errorf("template %q can not contain a path separator", template)
+	}
+	if !strings.HasSuffix(template, ".zip") && !strings.HasSuffix(template, "."+TemplateExt) {
+		return nil, fmt.Errorf("template %q must end with .zip or .%s so the files are read as archives", template, TemplateExt)
+	}
+	return &outputTemplate{template: template}, nil
+}
+
+// NeedsSlots reports whether the name depends on the slots in the archive
+func (o *outputTemplate) NeedsSlots() bool {
+	return strings.Contains(o.template, TemplateFirstSlot) || strings.Contains(o.template, TemplateLastSlot)
+}
+
+// Name returns the name of the output of the input archive, holding the
+// events of the summary
+func (o *outputTemplate) Name(inFile string, summary ArchiveFileSummary) (string, error) {
+	base, dataset := splitDataset(inFile)
+	replacements := []string{
+		TemplateName, strings.TrimSuffix(inFile, ".zip"),
+		TemplateDataset, dataset,
+		TemplateFirstSlot, strconv.FormatUint(summary.FirstSlot, 10),
+		TemplateLastSlot, strconv.FormatUint(summary.LastSlot, 10),
+		TemplateExt, "zip",
+	}
+	if strings.Contains(o.template, TemplateDate) || strings.Contains(o.template, TemplateHour) {
+		t, ok := archiveFileTime(base)
+		if !ok {
+			return "", fmt.Errorf("cant get the hour of %s for %s or %s, check --archive-name-format", inFile, TemplateDate, TemplateHour)
+		}
+		replacements = append(replacements, TemplateDate, t.Format("2006-01-02"), TemplateHour, t.Format("15"))
+	}
+	return strings.NewReplacer(replacements...).Replace(o.template), nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestParseOutputTemplate(t *testing.T) {
+	for _, v := range []string{"{date}-{firstSlot}-{lastSlot}.{ext}", "{name}.zip", "archive.zip"} {
+		_, err := parseOutputTemplate(v)
+		assert.Nil(t, err, v)
+	}
+	for _, v := range []string{"{date}-{slot}.zip", "{date.zip", "date}.zip", "{date}/{hour}.zip", "{date}.json", "{date}"} {
+		_, err := parseOutputTemplate(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestOutputTemplateName(t *testing.T) {
+	template, err := parseOutputTemplate("{date}T{hour}-{dataset}-{firstSlot}-{lastSlot}-{name}.{ext}")
+	assert.Nil(t, err)
+	assert.True(t, template.NeedsSlots())
+	name, err := template.Name("20240505-130000.swaps.zip", ArchiveFileSummary{FirstSlot: 5, LastSlot: 9})
+	assert.Nil(t, err)
+	assert.Equal(t, "2024-05-05T13-swaps-5-9-20240505-130000.swaps.zip", name)
+
+	// the hour can not be read from files named otherwise
+	_, err = template.Name("custom.zip", ArchiveFileSummary{})
+	assert.NotNil(t, err)
+	template, err = parseOutputTemplate("{name}-reduced.zip")
+	assert.Nil(t, err)
+	assert.False(t, template.NeedsSlots())
+	name, err = template.Name("custom.zip", ArchiveFileSummary{})
+	assert.Nil(t, err)
+	assert.Equal(t, "custom-reduced.zip", name)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reducedArchiveComment is the zip comment of archives written by reduce, so
+// they can be told apart from the originals they were made from
+const reducedArchiveComment = "ss-cli reduce"
+
+const (
+	PreferReduced  = "reduced"
+	PreferOriginal = "original"
+)
+
+// resolveOverlaps finds files in dir that cover the same hour, e.g. an
+// original archive and a reduced copy of it, which would otherwise replay the
+// same events twice. The files of each dataset of a split order do not
+// overlap. Each hour keeps the files of the kind prefer selects. An empty
+// prefer fails on the first overlap.
+func resolveOverlaps(dir string, files []string, prefer string) ([]string, error) {
+	byHour := map[time.Time][]string{}
+	for _, v := range files {
+		if t, ok := archiveFileTime(v); ok {
+			byHour[t] = append(byHour[t], v)
+		}
+	}
+
+	dropped := map[string]bool{}
+	for _, v := range files {
+		t, ok := archiveFileTime(v)
+		if !ok || distinctDatasets(byHour[t]) {
+			continue
+		}
+		overlapping := byHour[t]
+		delete(byHour, t)
+		if prefer == "" {
+			return nil, withKind(ErrUsage, fmt.Errorf("%s all cover %s. Remove all but one or pass --prefer %s or --prefer %s", strings.Join(overlapping, ", "), t.Format(time.RFC3339), PreferReduced, PreferOriginal))
+		}
+		keep := []string{}
+		for _, name := range overlapping {
+			reduced, err := isReducedArchive(filepath.Join(dir, name))
+			if err != nil {
+				return nil, err
+			}
+			if reduced == (prefer == PreferReduced) {
+				keep = append(keep, name)
+			} else {
+				dropped[name] = true
+			}
+		}
+		if len(keep) == 0 || !distinctDatasets(keep) {
+			return nil, withKind(ErrUsage, fmt.Errorf("%s all cover %s and --prefer %s cant choose between them as %d are %s. Remove all but one", strings.Join(overlapping, ", "), t.Format(time.RFC3339), prefer, len(keep), prefer))
+		}
+		for _, name := range overlapping {
+			if dropped[name] {
+				logrus.Infof("Skipping %s as %s covers the same hour", name, keep[0])
+			}
+		}
+	}
+
+	resolved := make([]string, 0, len(files))
+	for _, v := range files {
+		if !dropped[v] {
+			resolved = append(resolved, v)
+		}
+	}
+	return resolved, nil
+}
+
+// distinctDatasets reports whether files of the same hour do not overlap, i.e.
+// there is one file or one per dataset of a split order
+func distinctDatasets(files []string) bool {
+	seen := map[string]bool{}
+	for _, v := range files {
+		_, dataset := splitDataset(v)
+		if (dataset == "" && len(files) > 1) || seen[dataset] {
+			return false
+		}
+		seen[dataset] = true
+	}
+	return true
+}
+
+func isReducedArchive(path string) (bool, error) {
+	r, closer, err := openArchive(path)
+	if err != nil {
+		return false, err
+	}
+	defer closer.Close()
+	return r.Comment == reducedArchiveComment, nil
+}
@@ -0,0 +1,379 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	datasetManifestName = "dataset.json"
+	datasetReadmeName   = "README.md"
+	datasetArchivesDir  = "archives/"
+	datasetFormat       = "ss-dataset"
+	// unpacked manifests are saved under this name next to the archives
+	datasetManifestFileName = ".ss-dataset.json"
+)
+
+// DatasetManifest is the first entry in a dataset bundle and lists every
+// archive in it with its sha256
+type DatasetManifest struct {
+	Format        string            `json:"format"`
+	SchemaVersion int               `json:"schema_version"`
+	CLIVersion    string            `json:"cli_version"`
+	MinCLIVersion string            `json:"min_cli_version,omitempty"` // the oldest ss-cli which reads SchemaVersion, set by releases that bump it
+	CreatedAt     time.Time         `json:"created_at"`
+	Filters       map[string]string `json:"filters,omitempty"`
+	Split         *DatasetSplit     `json:"split,omitempty"`
+	Files         []DatasetFile     `json:"files"`
+}
+
+type DatasetFile struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+type PackageTask struct {
+	params struct {
+		dataDir string
+		files   string
+		out     string
+	}
+}
+
+func NewPackageTask() *PackageTask {
+	return &PackageTask{}
+}
+
+func (o *PackageTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir containing the archive files to package")
+	cmd.Flags().StringVar(&o.params.files, "files", "", "Only package archive files matching these glob patterns e.g. 20240505-*. (Comma separated list)")
+	cmd.Flags().StringVarP(&o.params.out, "out", "o", "dataset.tar.zst", "The bundle file to write")
+}
+
+func (o *PackageTask) GetMeta() Meta {
+	return Meta{
+		Name:        "PackageTask",
+		Use:         "package",
+		Description: "Bundle archive files with a manifest of their hashes and a README of the filters they were reduced with into a single file to share with other teams. Use unpack to verify and extract it.",
+	}
+}
+
+func (o *PackageTask) Execute(ctx context.Context) error {
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+	if patterns := splitList(o.params.files); len(patterns) != 0 {
+		selected := []string{}
+		for _, v := range files {
+			for _, pattern := range patterns {
+				matched, err := filepath.Match(pattern, v)
+				if err != nil {
+					return errors.Wrap(err, "invalid files pattern")
+				}
+				if matched {
+					selected = append(selected, v)
+					break
+				}
+			}
+		}
+		files = selected
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no archive files to package in %s", o.params.dataDir)
+	}
+
+	manifest := DatasetManifest{
+		Format:        datasetFormat,
+		SchemaVersion: archiveSchemaVersion,
+		CLIVersion:    version,
+		CreatedAt:     time.Now().UTC(),
+	}
+	raw, err := os.ReadFile(filepath.Join(o.params.dataDir, reduceSummaryFileName))
+	if err == nil {
+		summary := ReduceSummary{}
+		if err := json.Unmarshal(raw, &summary); err != nil {
+			return errors.Wrapf(err, "invalid %s", reduceSummaryFileName)
+		}
+		manifest.Filters = summary.Filters
+	}
+	// hashed up front so the manifest can be the first entry in the bundle
+	for _, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(o.params.dataDir, v)
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, DatasetFile{Name: v, Size: info.Size(), SHA256: sum})
+	}
+
+	out, err := os.OpenFile(o.params.out, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	zw, err := zstd.NewWriter(budgetWriter{out, diskUsage})
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(zw)
+
+	manifestRaw, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeTarFile(tw, datasetManifestName, manifest.CreatedAt, bytes.NewReader(manifestRaw), int64(len(manifestRaw))); err != nil {
+		return err
+	}
+	readme := datasetReadme(manifest)
+	if err := writeTarFile(tw, datasetReadmeName, manifest.CreatedAt, strings.NewReader(readme), int64(len(readme))); err != nil {
+		return err
+	}
+	for i, v := range manifest.Files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logrus.Infof("packaging file (%d of %d) %s", i+1, len(manifest.Files), v.Name)
+		f, err := os.Open(filepath.Join(o.params.dataDir, v.Name))
+		if err != nil {
+			return err
+		}
+		err = writeTarFile(tw, datasetArchivesDir+v.Name, manifest.CreatedAt, f, v.Size)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	logrus.Infof("packaged %d archive files into %s", len(manifest.Files), o.params.out)
+	return nil
+}
+
+func writeTarFile(tw *tar.Writer, name string, modTime time.Time, r io.Reader, size int64) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    size,
+		ModTime: modTime,
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return errors.Wrapf(err, "cant write %s", name)
+	}
+	return nil
+}
+
+// datasetReadme describes the bundle for whoever receives it
+func datasetReadme(manifest DatasetManifest) string {
+	b := &strings.Builder{}
+	fmt.Fprintf(b, "# SolanaStreaming archive dataset\n\n")
+	fmt.Fprintf(b, "Packaged %s with ss-cli %s. Archive schema version %d.\n\n", manifest.CreatedAt.Format(time.RFC3339), manifest.CLIVersion, manifest.SchemaVersion)
+	if len(manifest.Files) > 0 {
+		fmt.Fprintf(b, "%d hourly archive files from %s to %s.\n\n", len(manifest.Files), manifest.Files[0].Name, manifest.Files[len(manifest.Files)-1].Name)
+	}
+	fmt.Fprintf(b, "## Filters\n\n")
+	if len(manifest.Filters) == 0 {
+		fmt.Fprintf(b, "None. These are the full archive files.\n\n")
+	} else {
+		fmt.Fprintf(b, "The archives were created with `ss-cli reduce` using:\n\n")
+		names := []string{}
+		for k := range manifest.Filters {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, v := range names {
+			fmt.Fprintf(b, "- `--%s %s`\n", v, manifest.Filters[v])
+		}
+		fmt.Fprintf(b, "\n")
+	}
+	fmt.Fprintf(b, "## Unpacking\n\n")
+	fmt.Fprintf(b, "```\nss-cli unpack --in <this file> --output-dir out\n```\n\n")
+	fmt.Fprintf(b, "Every archive is checked against the sha256 in %s while it is extracted.\n", datasetManifestName)
+	return b.String()
+}
+
+type UnpackTask struct {
+	params struct {
+		in         string
+		outputDir  string
+		verifyOnly bool
+	}
+}
+
+func NewUnpackTask() *UnpackTask {
+	return &UnpackTask{}
+}
+
+func (o *UnpackTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.in, "in", "i", "dataset.tar.zst", "The bundle file created by package")
+	cmd.Flags().StringVarP(&o.params.outputDir, "output-dir", "o", "out", "The dir to extract the archive files to")
+	cmd.Flags().BoolVar(&o.params.verifyOnly, "verify-only", false, "Only verify the bundle, do not extract anything")
+}
+
+func (o *UnpackTask) GetMeta() Meta {
+	return Meta{
+		Name:        "UnpackTask",
+		Use:         "unpack",
+		Description: "Verify and extract a dataset bundle created by package.",
+	}
+}
+
+func (o *UnpackTask) Execute(ctx context.Context) error {
+	in, err := os.Open(o.params.in)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	zr, err := zstd.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer zr.Close()
+	tr := tar.NewReader(zr)
+
+	header, err := tr.Next()
+	if err != nil {
+		return errors.Wrap(err, "cant read bundle")
+	}
+	if header.Name != datasetManifestName {
+		return fmt.Errorf("not a dataset bundle, the first entry is %s", header.Name)
+	}
+	manifestRaw, err := io.ReadAll(tr)
+	if err != nil {
+		return err
+	}
+	manifest := DatasetManifest{}
+	if err := json.Unmarshal(manifestRaw, &manifest); err != nil || manifest.Format != datasetFormat {
+		return fmt.Errorf("not a dataset bundle, invalid %s", datasetManifestName)
+	}
+	if err := checkSchemaVersion(manifest); err != nil {
+		return err
+	}
+	expected := map[string]DatasetFile{}
+	for _, v := range manifest.Files {
+		expected[v.Name] = v
+	}
+
+	if !o.params.verifyOnly {
+		if err := os.MkdirAll(o.params.outputDir, 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(o.params.outputDir, datasetManifestFileName), manifestRaw, 0644); err != nil {
+			return err
+		}
+	}
+
+	verified := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return errors.Wrap(err, "cant read bundle")
+		}
+		if header.Name == datasetReadmeName || header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// base only so entries can not escape the output dir
+		name := filepath.Base(strings.TrimPrefix(header.Name, datasetArchivesDir))
+		file, ok := expected[name]
+		if !ok || !strings.HasPrefix(header.Name, datasetArchivesDir) {
+			return fmt.Errorf("bundle contains %s which is not in its manifest", header.Name)
+		}
+		if err := o.extractFile(tr, file); err != nil {
+			return err
+		}
+		delete(expected, name)
+		verified++
+	}
+	if len(expected) != 0 {
+		missing := []string{}
+		for k := range expected {
+			missing = append(missing, k)
+		}
+		sort.Strings(missing)
+		return fmt.Errorf("bundle is missing %d files listed in its manifest: %s", len(missing), strings.Join(missing, ", "))
+	}
+
+	if o.params.verifyOnly {
+		logrus.Infof("verified %d archive files in %s", verified, o.params.in)
+		return nil
+	}
+	logrus.Infof("verified and extracted %d archive files to %s", verified, o.params.outputDir)
+	return nil
+}
+
+// extractFile writes the entry to a temp file and only moves it into place
+// once its hash matches the manifest
+func (o *UnpackTask) extractFile(r io.Reader, file DatasetFile) error {
+	h := sha256.New()
+	if o.params.verifyOnly {
+		if _, err := io.Copy(h, r); err != nil {
+			return err
+		}
+		if hex.EncodeToString(h.Sum(nil)) != file.SHA256 {
+			return fmt.Errorf("%s does not match the sha256 in the manifest", file.Name)
+		}
+		return nil
+	}
+
+	if err := diskUsage.Reserve(file.Size); err != nil {
+		return err
+	}
+	path := filepath.Join(o.params.outputDir, file.Name)
+	tmp, err := os.CreateTemp(o.params.outputDir, file.Name+".*.partial")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(io.MultiWriter(tmp, h), r); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "cant extract %s", file.Name)
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if hex.EncodeToString(h.Sum(nil)) != file.SHA256 {
+		return fmt.Errorf("%s does not match the sha256 in the manifest", file.Name)
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestPackageUnpack(t *testing.T) {
+	reduce := NewReduceTask()
+	reduce.params.dataInDir = copyFixtures(t)
+	reduce.params.dataOutDir = t.TempDir()
+	reduce.params.concurrency = 2
+	reduce.params.mintSuffixes = "pump"
+	assert.Nil(t, reduce.Execute(context.Background()))
+
+	bundle := filepath.Join(t.TempDir(), "dataset.tar.zst")
+	pkg := NewPackageTask()
+	pkg.params.dataDir = reduce.params.dataOutDir
+	pkg.params.files = "20240505-12*,20240505-13*"
+	pkg.params.out = bundle
+	assert.Nil(t, pkg.Execute(context.Background()))
+
+	unpack := NewUnpackTask()
+	unpack.params.in = bundle
+	unpack.params.outputDir = t.TempDir()
+	assert.Nil(t, unpack.Execute(context.Background()))
+
+	files, err := listArchiveFiles(unpack.params.outputDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20240505-120000.zip", "20240505-130000.zip"}, files)
+	for _, v := range files {
+		expected, err := os.ReadFile(filepath.Join(reduce.params.dataOutDir, v))
+		assert.Nil(t, err)
+		actual, err := os.ReadFile(filepath.Join(unpack.params.outputDir, v))
+		assert.Nil(t, err)
+		assert.Equal(t, expected, actual)
+	}
+	_, err = os.Stat(filepath.Join(unpack.params.outputDir, datasetManifestFileName))
+	assert.Nil(t, err)
+
+	// a corrupt bundle fails verification
+	raw, err := os.ReadFile(bundle)
+	assert.Nil(t, err)
+	raw[len(raw)/2] ^= 0xff
+	assert.Nil(t, os.WriteFile(bundle, raw, 0644))
+	unpack.params.verifyOnly = true
+	assert.NotNil(t, unpack.Execute(context.Background()))
+}
+
+func TestDatasetReadmeListsFilters(t *testing.T) {
+	readme := datasetReadme(DatasetManifest{
+		SchemaVersion: archiveSchemaVersion,
+		Filters:       map[string]string{"mint-suffix": "pump", "anonymize": "wallets"},
+		Files:         []DatasetFile{{Name: "20240505-120000.zip"}},
+	})
+	assert.Contains(t, readme, "- `--anonymize wallets`\n- `--mint-suffix pump`")
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+const (
+	LayoutFile = "file"
+	LayoutHive = "hive"
+)
+
+// hiveSuccessMarker is written to each partition once all of its rows are,
+// as Spark and Hadoop committers do
+const hiveSuccessMarker = "_SUCCESS"
+
+// hiveDefaultPartition holds rows without a time, the name Hive uses for null
+// partition values
+const hiveDefaultPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// layoutOptions sets how a time series report is written, to one file or to
+// a directory of hive partitions for Athena or Spark external tables
+type layoutOptions struct {
+	layout string
+}
+
+func (o *layoutOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.layout, "layout", LayoutFile, "How to write the output: file, or hive to write --output as a directory of dt=YYYY-MM-DD/hour=HH partitions with a _SUCCESS marker in each")
+}
+
+func (o *layoutOptions) Validate(output string) error {
+	switch o.layout {
+	case LayoutFile, "":
+	case LayoutHive:
+		if output == "" || output == "-" {
+			return errors.New("layout hive needs --output set to a directory")
+		}
+	default:
+		return fmt.Errorf("unknown layout %q, must be one of: %s, %s", o.layout, LayoutFile, LayoutHive)
+	}
+	return nil
+}
+
+// Open returns the writer of the report and the output to close once done.
+// With the hive layout rows are partitioned by the hour of the RFC3339 time
+// in timeColumn.
+func (o *layoutOptions) Open(output, format string, header []string, timeColumn string) (*recordWriter, io.Closer, error) {
+	if o.layout == LayoutHive {
+		partitions, err := newHivePartitions(output, format, header, timeColumn)
+		if err != nil {
+			return nil, nil, err
+		}
+		return &recordWriter{format: format, header: header, partitions: partitions}, partitions, nil
+	}
+	out, err := openOutput(output)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := newRecordWriter(out, format, header)
+	if err != nil {
+		out.Close()
+		return nil, nil, err
+	}
+	return w, out, nil
+}
+
+// hivePartitions writes rows to part files under dt=YYYY-MM-DD/hour=HH of
+// dir. A partition written by this run replaces the one already there, the
+// others are kept, so a report can be rerun for just the hours that changed.
+type hivePartitions struct {
+	dir       string
+	format    string
+	header    []string
+	timeIndex int
+	// the partition being written and its part file
+	current string
+	file    io.WriteCloser
+	w       *recordWriter
+	// the part files written to each partition, in the order first written
+	parts   map[string]int
+	written []string
+}
+
+func newHivePartitions(dir, format string, header []string, timeColumn string) (*hivePartitions, error) {
+	if err := checkReportFormat(format); err != nil {
+		return nil, err
+	}
+	timeIndex := -1
+	for i, v := range header {
+		if v == timeColumn {
+			timeIndex = i
+		}
+	}
+	if timeIndex == -1 {
+		return nil, fmt.Errorf("no %s column to partition by", timeColumn)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrap(err, "cant create output dir")
+	}
+	return &hivePartitions{
+		dir:       dir,
+		format:    format,
+		header:    header,
+		timeIndex: timeIndex,
+		parts:     map[string]int{},
+	}, nil
+}
+
+// partition returns the partition dir of the time, relative to the output
+func partition(value any) (string, error) {
+	s, _ := value.(string)
+	if s == "" {
+		return filepath.Join("dt="+hiveDefaultPartition, "hour="+hiveDefaultPartition), nil
+	}
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		return "", errors.Wrap(err, "cant partition by time")
+	}
+	t = t.UTC()
+	return filepath.Join("dt="+t.Format("2006-01-02"), "hour="+t.Format("15")), nil
+}
+
+func (o *hivePartitions) Write(values ...any) error {
+	if len(values) != len(o.header) {
+		return fmt.Errorf("record has %d values, expected %d", len(values), len(o.header))
+	}
+	name, err := partition(values[o.timeIndex])
+	if err != nil {
+		return err
+	}
+	if name != o.current || o.w == nil {
+		if err := o.open(name); err != nil {
+			return err
+		}
+	}
+	return o.w.Write(values...)
+}
+
+// open starts a new part file in the partition, clearing the partition of
+// an earlier run the first time it is written
+func (o *hivePartitions) open(name string) error {
+	if err := o.closePart(); err != nil {
+		return err
+	}
+	dir := filepath.Join(o.dir, name)
+	if _, ok := o.parts[name]; !ok {
+		if err := os.RemoveAll(dir); err != nil {
+			return errors.Wrapf(err, "cant replace partition %s", name)
+		}
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return errors.Wrapf(err, "cant create partition %s", name)
+		}
+		o.written = append(o.written, name)
+	}
+	file, err := openOutput(filepath.Join(dir, fmt.Sprintf("part-%05d.%s", o.parts[name], o.format)))
+	if err != nil {
+		return err
+	}
+	w, err := newRecordWriter(file, o.format, o.header)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	o.parts[name]++
+	o.current, o.file, o.w = name, file, w
+	return nil
+}
+
+func (o *hivePartitions) closePart() error {
+	if o.file == nil {
+		return nil
+	}
+	err := o.w.Flush()
+	if closeErr := o.file.Close(); err == nil {
+		err = closeErr
+	}
+	o.file, o.w = nil, nil
+	return err
+}
+
+// Flush finishes the last part file and marks every partition written as
+// complete, so a run which fails part way leaves no markers behind
+func (o *hivePartitions) Flush() error {
+	if err := o.closePart(); err != nil {
+		return err
+	}
+	for _, v := range o.written {
+		if err := os.WriteFile(filepath.Join(o.dir, v, hiveSuccessMarker), nil, 0644); err != nil {
+			return errors.Wrapf(err, "cant mark partition %s complete", v)
+		}
+	}
+	return nil
+}
+
+func (o *hivePartitions) Close() error {
+	return o.closePart()
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestVolumeHiveLayout(t *testing.T) {
+	dataDir := t.TempDir()
+	// 1714910400 is 2024-05-05T12:00:00Z
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"blockTime":1714910400,"swap":{"quoteTokenMint":"So11111111111111111111111111111111111111112","swapType":"buy","quoteAmount":"2000000000"}}
+{"slot":2,"blockTime":1714910700,"swap":{"quoteTokenMint":"So11111111111111111111111111111111111111112","swapType":"sell","quoteAmount":"3000000000"}}
+{"slot":3,"blockTime":1714914000,"swap":{"quoteTokenMint":"So11111111111111111111111111111111111111112","swapType":"buy","quoteAmount":"5000000000"}}
+`,
+	})
+	outDir := t.TempDir()
+	// a partition of an earlier run is kept unless this run writes it
+	assert.Nil(t, os.MkdirAll(outDir+"/dt=2024-05-04/hour=00", 0755))
+	assert.Nil(t, os.WriteFile(outDir+"/dt=2024-05-04/hour=00/part-00000.csv", []byte("old"), 0644))
+	assert.Nil(t, os.MkdirAll(outDir+"/dt=2024-05-05/hour=12", 0755))
+	assert.Nil(t, os.WriteFile(outDir+"/dt=2024-05-05/hour=12/part-00001.csv", []byte("old"), 0644))
+
+	task := NewVolumeTask()
+	task.params.dataDir = dataDir
+	task.params.interval = "5m"
+	task.params.format = ReportFormatCSV
+	task.params.output = outDir
+	task.layout.layout = LayoutHive
+	assert.Nil(t, task.Execute(context.Background()))
+
+	files := []string{}
+	filepath.Walk(outDir, func(path string, info os.FileInfo, err error) error {
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(outDir, path)
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return err
+	})
+	assert.Equal(t, []string{
+		"dt=2024-05-04/hour=00/part-00000.csv",
+		"dt=2024-05-05/hour=12/_SUCCESS",
+		"dt=2024-05-05/hour=12/part-00000.csv",
+		"dt=2024-05-05/hour=13/_SUCCESS",
+		"dt=2024-05-05/hour=13/part-00000.csv",
+	}, files)
+	raw, err := os.ReadFile(outDir + "/dt=2024-05-05/hour=12/part-00000.csv")
+	assert.Nil(t, err)
+	assert.Equal(t, `interval_start,group,quote_mint,swaps,buys,sells,quote_volume
+2024-05-05T12:00:00Z,all,So11111111111111111111111111111111111111112,1,1,0,2
+2024-05-05T12:05:00Z,all,So11111111111111111111111111111111111111112,1,0,1,3
+`, string(raw))
+	raw, err = os.ReadFile(outDir + "/dt=2024-05-05/hour=13/part-00000.csv")
+	assert.Nil(t, err)
+	assert.Equal(t, `interval_start,group,quote_mint,swaps,buys,sells,quote_volume
+2024-05-05T13:00:00Z,all,So11111111111111111111111111111111111111112,1,1,0,5
+`, string(raw))
+
+	task.params.output = ""
+	assert.NotNil(t, task.Execute(context.Background()))
+	task.params.output = outDir
+	task.layout.layout = "daily"
+	assert.NotNil(t, task.Execute(context.Background()))
+}
+
+func TestHivePartitionsUnflushed(t *testing.T) {
+	outDir := t.TempDir()
+	partitions, err := newHivePartitions(outDir, ReportFormatJSON, []string{"time", "value"}, "time")
+	assert.Nil(t, err)
+	assert.Nil(t, partitions.Write("2024-05-05T12:30:00Z", 1))
+	assert.Nil(t, partitions.Write("", 2))
+	assert.Nil(t, partitions.Write("2024-05-05T14:30:00+02:00", 3))
+	assert.NotNil(t, partitions.Write("yesterday", 4))
+	// a run which fails before flushing leaves no partition marked complete
+	assert.Nil(t, partitions.Close())
+	_, err = os.Stat(outDir + "/dt=2024-05-05/hour=12/_SUCCESS")
+	assert.True(t, os.IsNotExist(err))
+
+	raw, err := os.ReadFile(outDir + "/dt=2024-05-05/hour=12/part-00001.json")
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"time\":\"2024-05-05T14:30:00+02:00\",\"value\":3}\n", string(raw))
+	raw, err = os.ReadFile(outDir + "/dt=__HIVE_DEFAULT_PARTITION__/hour=__HIVE_DEFAULT_PARTITION__/part-00000.json")
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"time\":\"\",\"value\":2}\n", string(raw))
+
+	_, err = newHivePartitions(outDir, ReportFormatJSON, []string{"value"}, "time")
+	assert.NotNil(t, err)
+}
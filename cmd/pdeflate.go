@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"io"
+	"sync"
+)
+
+// parallelDeflateBlockSize is the uncompressed size of the blocks compressed
+// concurrently
+var parallelDeflateBlockSize = 1 << 20
+
+// deflateDictSize is the deflate window, the most of the previous block that
+// can be referenced
+const deflateDictSize = 32 * 1024
+
+// zipDeflateLevel is the level archive/zip compresses with
+const zipDeflateLevel = 5
+
+// parallelDeflateWriter compresses blocks of its input concurrently into a
+// single deflate stream, as pigz does. Each block is primed with the end of
+// the block before it as a dictionary and ends with a sync flush so the
+// compressed blocks can be written one after another.
+type parallelDeflateWriter struct {
+	buf  []byte
+	dict []byte
+	// blocks in the order they are written
+	pending chan *deflateBlock
+	// limits the blocks being compressed at once
+	workers chan struct{}
+	written chan struct{}
+
+	lock sync.Mutex
+	err  error
+}
+
+type deflateBlock struct {
+	data  []byte
+	dict  []byte
+	final bool
+	out   bytes.Buffer
+	err   error
+	// closed once out and err are set
+	ready chan struct{}
+}
+
+func newParallelDeflateWriter(out io.Writer, workers int) *parallelDeflateWriter {
+	w := &parallelDeflateWriter{
+		buf:     make([]byte, 0, parallelDeflateBlockSize),
+		pending: make(chan *deflateBlock, workers),
+		workers: make(chan struct{}, workers),
+		written: make(chan struct{}),
+	}
+	go func() {
+		defer close(w.written)
+		for block := range w.pending {
+			<-block.ready
+			err := block.err
+			if err == nil && w.Err() == nil {
+				_, err = out.Write(block.out.Bytes())
+			}
+			if err != nil {
+				w.setErr(err)
+			}
+		}
+	}()
+	return w
+}
+
+func (o *parallelDeflateWriter) Err() error {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	return o.err
+}
+
+func (o *parallelDeflateWriter) setErr(err error) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if o.err == nil {
+		o.err = err
+	}
+}
+
+func (o *parallelDeflateWriter) Write(p []byte) (int, error) {
+	if err := o.Err(); err != nil {
+		return 0, err
+	}
+	n := len(p)
+	for len(p) > 0 {
+		size := min(len(p), parallelDeflateBlockSize-len(o.buf))
+		o.buf = append(o.buf, p[:size]...)
+		p = p[size:]
+		if len(o.buf) == parallelDeflateBlockSize {
+			o.submit(false)
+		}
+	}
+	return n, nil
+}
+
+// submit starts compressing the buffered block
+func (o *parallelDeflateWriter) submit(final bool) {
+	block := &deflateBlock{data: o.buf, dict: o.dict, final: final, ready: make(chan struct{})}
+	o.dict = o.buf[max(0, len(o.buf)-deflateDictSize):]
+	o.buf = make([]byte, 0, parallelDeflateBlockSize)
+	o.workers <- struct{}{}
+	go func() {
+		defer func() { <-o.workers }()
+		defer close(block.ready)
+		block.err = block.compress()
+	}()
+	o.pending <- block
+}
+
+func (o *deflateBlock) compress() error {
+	fw, err := flate.NewWriterDict(&o.out, zipDeflateLevel, o.dict)
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write(o.data); err != nil {
+		return err
+	}
+	if o.final {
+		return fw.Close()
+	}
+	return fw.Flush()
+}
+
+// Close compresses the rest of the input and ends the stream. It does not
+// close the underlying writer.
+func (o *parallelDeflateWriter) Close() error {
+	o.submit(true)
+	close(o.pending)
+	<-o.written
+	return o.Err()
+}
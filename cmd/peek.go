@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var errPeekComplete = errors.New("peek complete")
+
+type PeekTask struct {
+	// events are written here, stdout unless testing
+	out      io.Writer
+	fromDate time.Time
+	params   struct {
+		dataDir   string
+		file      string
+		n         int
+		eventType string
+		pretty    bool
+		fromSlot  uint64
+		fromDate  string
+	}
+}
+
+func NewPeekTask() *PeekTask {
+	return &PeekTask{out: os.Stdout}
+}
+
+func (o *PeekTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir of archive files to peek at")
+	cmd.Flags().StringVarP(&o.params.file, "file", "f", "", "Only peek at this archive file in data-dir, e.g. 20240505-120000.zip. Defaults to starting at the first file")
+	cmd.Flags().IntVar(&o.params.n, "n", 10, "How many events to print")
+	cmd.Flags().StringVar(&o.params.eventType, "type", "", "Only print events of this type: swap, pair or liquidityUpdate")
+	cmd.Flags().BoolVar(&o.params.pretty, "pretty", false, "Pretty print each event over several lines")
+	cmd.Flags().Uint64Var(&o.params.fromSlot, "from-slot", 0, "Start at the first event at or after this slot")
+	cmd.Flags().StringVar(&o.params.fromDate, "from-date", "", "Start at the first event at or after this time, e.g. '2024-05-05 14:30' (UTC)")
+}
+
+func (o *PeekTask) GetMeta() Meta {
+	return Meta{
+		Name:        "PeekTask",
+		Use:         "peek",
+		Description: "Print the first events in archive files to inspect their fields without unzipping them.",
+	}
+}
+
+func (o *PeekTask) Execute(ctx context.Context) error {
+	if err := o.validateParams(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	files, err := o.getDataFiles()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return withKind(ErrUsage, fmt.Errorf("no archive files found in %s", o.params.dataDir))
+	}
+
+	// only the files from the start are read
+	if o.params.dataDir != pipeName && (o.params.fromSlot != 0 || !o.fromDate.IsZero()) {
+		key, target := slotTimeSlot, int64(o.params.fromSlot)
+		if o.params.fromSlot == 0 {
+			key, target = slotTimeBlockTime, o.fromDate.Unix()
+		}
+		i, err := searchArchiveFiles(o.params.dataDir, files, key, target)
+		if err != nil {
+			return err
+		}
+		files = files[i:]
+	}
+
+	printed := 0
+	// rows are in slot order, so once a row is at or after the start every
+	// row after it is, including any without a block time
+	started := o.params.fromSlot == 0 && o.fromDate.IsZero()
+	for _, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := readArchiveRows(o.params.dataDir+"/"+v, func(row []byte) error {
+			if !started && !o.started(row) {
+				return nil
+			}
+			started = true
+			if !o.matches(row) {
+				return nil
+			}
+			if err := o.print(row); err != nil {
+				return err
+			}
+			printed++
+			if printed == o.params.n {
+				return errPeekComplete
+			}
+			return nil
+		})
+		if errors.Is(err, errPeekComplete) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	logrus.Infof("printed all %d matching events", printed)
+	return nil
+}
+
+func (o *PeekTask) validateParams() error {
+	if o.params.n < 1 {
+		return errors.New("n must be at least 1")
+	}
+	switch o.params.eventType {
+	case "", "swap", "pair", "liquidityUpdate":
+	default:
+		return fmt.Errorf("type must be swap, pair or liquidityUpdate not %q", o.params.eventType)
+	}
+	if o.params.fromDate != "" {
+		if o.params.fromSlot != 0 {
+			return errors.New("only one of from-date and from-slot can be specified")
+		}
+		fromDate, err := parseFromDate(o.params.fromDate)
+		if err != nil {
+			return errors.Wrap(err, "invalid from-date")
+		}
+		o.fromDate = fromDate
+	}
+	return nil
+}
+
+func (o *PeekTask) getDataFiles() ([]string, error) {
+	if o.params.file == "" {
+		return listArchiveFiles(o.params.dataDir)
+	}
+	name := filepath.Base(o.params.file)
+	if _, err := os.Stat(filepath.Join(o.params.dataDir, name)); err != nil {
+		return nil, withKind(ErrUsage, err)
+	}
+	return []string{name}, nil
+}
+
+// started reports whether the row is at or after --from-slot or --from-date
+func (o *PeekTask) started(row []byte) bool {
+	if o.params.fromSlot != 0 {
+		return rowSlot(row) >= o.params.fromSlot
+	}
+	return rowBlockTime(row) >= o.fromDate.Unix()
+}
+
+// matches reports whether the row is of the type asked for
+func (o *PeekTask) matches(row []byte) bool {
+	if o.params.eventType == "" {
+		return true
+	}
+	data := DataFormat{}
+	if err := json.Unmarshal(row, &data); err != nil {
+		return false
+	}
+	return slotRowHas(data, o.params.eventType)
+}
+
+func (o *PeekTask) print(row []byte) error {
+	if !o.params.pretty {
+		_, err := fmt.Fprintf(o.out, "%s\n", row)
+		return err
+	}
+	out := bytes.Buffer{}
+	if err := json.Indent(&out, row, "", "  "); err != nil {
+		return errors.Wrap(err, "cant pretty print event")
+	}
+	out.WriteByte('\n')
+	_, err := o.out.Write(out.Bytes())
+	return err
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestPeek(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"blockTime":1714910400,"swap":{"swapType":"buy"}}
+{"slot":3,"blockTime":1714910401,"swap":{"swapType":"sell"}}
+`,
+		"pairs.json": `{"slot":2,"pair":{}}` + "\n",
+	})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": `{"slot":4,"blockTime":1714914000,"swap":{"swapType":"buy"}}` + "\n",
+	})
+	peek := func(setup func(task *PeekTask)) (string, error) {
+		out := bytes.Buffer{}
+		task := NewPeekTask()
+		task.out = &out
+		task.params.dataDir = dataDir
+		task.params.n = 2
+		setup(task)
+		err := task.Execute(context.Background())
+		return out.String(), err
+	}
+
+	out, err := peek(func(task *PeekTask) {})
+	assert.Nil(t, err)
+	assert.Equal(t, `{"slot":1,"blockTime":1714910400,"swap":{"swapType":"buy"}}
+{"slot":2,"pair":{}}
+`, out)
+
+	out, err = peek(func(task *PeekTask) { task.params.eventType = "swap"; task.params.n = 10 })
+	assert.Nil(t, err)
+	assert.Equal(t, 3, strings.Count(out, "\n"))
+
+	// the range starts part way through the first file
+	out, err = peek(func(task *PeekTask) { task.params.fromSlot = 3 })
+	assert.Nil(t, err)
+	assert.Equal(t, `{"slot":3,"blockTime":1714910401,"swap":{"swapType":"sell"}}
+{"slot":4,"blockTime":1714914000,"swap":{"swapType":"buy"}}
+`, out)
+	out, err = peek(func(task *PeekTask) { task.params.fromDate = "2024-05-05 13:00"; task.params.n = 1 })
+	assert.Nil(t, err)
+	assert.Equal(t, `{"slot":4,"blockTime":1714914000,"swap":{"swapType":"buy"}}`+"\n", out)
+
+	out, err = peek(func(task *PeekTask) {
+		task.params.file = "20240505-130000.zip"
+		task.params.pretty = true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, `{
+  "slot": 4,
+  "blockTime": 1714914000,
+  "swap": {
+    "swapType": "buy"
+  }
+}
+`, out)
+
+	_, err = peek(func(task *PeekTask) { task.params.eventType = "trade" })
+	assert.True(t, errors.Is(err, ErrUsage))
+	_, err = peek(func(task *PeekTask) { task.params.file = "20240505-150000.zip" })
+	assert.True(t, errors.Is(err, ErrUsage))
+}
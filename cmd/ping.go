@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type PingTask struct {
+	http   httpOptions
+	params struct {
+		ws       bool
+		liveURL  string
+		apiKey   string
+		method   string
+		duration time.Duration
+		samples  int
+	}
+}
+
+// PingResult is what ping measured
+type PingResult struct {
+	Connect   time.Duration
+	Subscribe time.Duration
+	// notification receive time minus block time
+	Latencies []time.Duration
+	// notifications without a blockTime
+	Skipped int
+}
+
+func NewPingTask() *PingTask {
+	return &PingTask{}
+}
+
+func (o *PingTask) SetupParameters(cmd *cobra.Command) {
+	o.http.SetupParameters(cmd)
+	cmd.Flags().BoolVar(&o.params.ws, "ws", false, "Measure the websocket feed. Currently the only mode")
+	cmd.Flags().StringVar(&o.params.liveURL, "live-url", defaultLiveURL, "The live websocket to measure")
+	cmd.Flags().StringVarP(&o.params.apiKey, "key", "k", "", "Your API key")
+	cmd.Flags().StringVarP(&o.params.method, "method", "m", MethodSwapSubscribe, "The subscribe method to sample notifications from")
+	cmd.Flags().DurationVar(&o.params.duration, "duration", 30*time.Second, "How long to sample notifications for")
+	cmd.Flags().IntVar(&o.params.samples, "samples", 0, "Stop after this many notifications. 0 means sample for the full duration")
+}
+
+func (o *PingTask) GetMeta() Meta {
+	return Meta{
+		Name:        "PingTask",
+		Use:         "ping",
+		Description: "Connect to the production feed, subscribe and report connection time and notification latency against block time to validate your network placement before going live.",
+	}
+}
+
+func (o *PingTask) Execute(ctx context.Context) error {
+	if !o.params.ws {
+		return errors.New("specify what to measure, e.g. --ws")
+	}
+	if o.params.apiKey == "" {
+		return errors.New("key must be specified")
+	}
+	result, err := o.Ping(ctx)
+	if err != nil {
+		return err
+	}
+	result.Print()
+	return nil
+}
+
+// Ping connects, subscribes and samples notifications
+func (o *PingTask) Ping(ctx context.Context) (PingResult, error) {
+	result := PingResult{}
+	start := time.Now()
+	conn, err := dialLive(ctx, &o.http, o.params.liveURL, o.params.apiKey)
+	if err != nil {
+		return result, err
+	}
+	defer conn.Close()
+	result.Connect = time.Since(start)
+	logrus.Infof("connected to %s in %s", o.params.liveURL, result.Connect)
+
+	start = time.Now()
+	err = conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"id":1,"method":"%s"}`, o.params.method)))
+	if err != nil {
+		return result, err
+	}
+	conn.SetReadDeadline(time.Now().Add(o.params.duration))
+	subscribed := false
+	for o.params.samples == 0 || len(result.Latencies) < o.params.samples {
+		_, raw, err := conn.ReadMessage()
+		received := time.Now()
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return result, err
+		}
+		message := struct {
+			ID     int             `json:"id"`
+			Error  json.RawMessage `json:"error"`
+			Params EventRow        `json:"params"`
+		}{}
+		if err := json.Unmarshal(raw, &message); err != nil {
+			return result, errors.Wrap(err, "cant unmarshal message")
+		}
+		if message.ID == 1 {
+			if message.Error != nil {
+				return result, fmt.Errorf("subscribe failed: %s", string(message.Error))
+			}
+			result.Subscribe = received.Sub(start)
+			subscribed = true
+			logrus.Infof("subscribed to %s in %s, sampling for up to %s...", o.params.method, result.Subscribe, o.params.duration)
+			continue
+		}
+		if message.Params.BlockTime == 0 {
+			result.Skipped++
+			continue
+		}
+		result.Latencies = append(result.Latencies, received.Sub(message.Params.Time()))
+	}
+	if !subscribed {
+		return result, errors.New("no response to the subscription")
+	}
+	return result, nil
+}
+
+// Percentile returns the p'th percentile (0-100) of the latencies using the
+// nearest rank method
+func (o PingResult) Percentile(p float64) time.Duration {
+	if len(o.Latencies) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(o.Latencies)
+	slices.Sort(sorted)
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	rank = max(0, min(rank, len(sorted)-1))
+	return sorted[rank]
+}
+
+func (o PingResult) Print() {
+	fmt.Printf("connect:   %s\n", o.Connect.Round(time.Millisecond))
+	fmt.Printf("subscribe: %s\n", o.Subscribe.Round(time.Millisecond))
+	fmt.Printf("samples:   %d\n", len(o.Latencies))
+	if o.Skipped != 0 {
+		fmt.Printf("skipped:   %d (no blockTime)\n", o.Skipped)
+	}
+	if len(o.Latencies) == 0 {
+		fmt.Println("no notifications received, try a longer --duration or a busier --method")
+		return
+	}
+	for _, p := range []float64{50, 95, 99, 100} {
+		label := fmt.Sprintf("p%.0f", p)
+		if p == 100 {
+			label = "max"
+		}
+		fmt.Printf("%-10s %s\n", label+":", o.Percentile(p).Round(time.Millisecond))
+	}
+}
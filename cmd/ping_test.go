@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/test-go/testify/assert"
+)
+
+func TestPingPercentile(t *testing.T) {
+	result := PingResult{}
+	assert.Equal(t, time.Duration(0), result.Percentile(50))
+	for i := 10; i >= 1; i-- {
+		result.Latencies = append(result.Latencies, time.Duration(i)*time.Millisecond)
+	}
+	assert.Equal(t, 5*time.Millisecond, result.Percentile(50))
+	assert.Equal(t, 10*time.Millisecond, result.Percentile(95))
+	assert.Equal(t, 10*time.Millisecond, result.Percentile(100))
+	assert.Equal(t, 1*time.Millisecond, result.Percentile(0))
+}
+
+func TestPing(t *testing.T) {
+	liveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer c.Close()
+		request := JSONRPC{}
+		assert.Nil(t, c.ReadJSON(&request))
+		assert.Equal(t, MethodSwapSubscribe, request.Method)
+		c.WriteMessage(websocket.TextMessage, []byte(`{"id":1,"result":{"subscription_id":5}}`))
+		c.WriteMessage(websocket.TextMessage, []byte(`{"method":"swapNotification","subscription_id":5,"params":{"slot":1}}`))
+		for i := 0; i < 3; i++ {
+			c.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"method":"swapNotification","subscription_id":5,"params":{"slot":1,"blockTime":%d}}`, time.Now().Add(-2*time.Second).Unix())))
+		}
+		c.ReadMessage()
+	}))
+	defer liveServer.Close()
+
+	pt := NewPingTask()
+	pt.params.liveURL = "ws" + strings.TrimPrefix(liveServer.URL, "http")
+	pt.params.method = MethodSwapSubscribe
+	pt.params.duration = 10 * time.Second
+	pt.params.samples = 3
+	result, err := pt.Ping(context.Background())
+	assert.Nil(t, err)
+	assert.Len(t, result.Latencies, 3)
+	assert.Equal(t, 1, result.Skipped)
+	// block times are whole seconds
+	assert.True(t, result.Percentile(50) >= 2*time.Second && result.Percentile(50) < 4*time.Second)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// pipeName is passed instead of a data dir or output dir to stream event rows
+// through stdin or stdout, so commands can be chained with pipes e.g.
+//
+//	ss-cli tail | ss-cli reduce -i - -o - --mint-suffix pump | ss-cli volume -d -
+//
+// The stream is NDJSON: one event row per line, exactly as archive files hold
+// them and the live feed sends them as params, in slot order. Blank lines are
+// ignored. Logs always go to stderr so they never mix with the rows.
+const pipeName = "-"
+
+// pipeIn and pipeOut are stdin and stdout, swapped out by tests
+var (
+	pipeIn  io.Reader = os.Stdin
+	pipeOut io.Writer = os.Stdout
+)
+
+// isPipe reports whether path is stdin, i.e. the data dir "-" or the single
+// file listArchiveFiles lists in it
+func isPipe(path string) bool {
+	return path == pipeName || path == pipeName+"/"+pipeName
+}
+
+// readPipeRows streams the rows on stdin to fn. stdin can only be read once,
+// so commands which read their input twice can not use it.
+func readPipeRows(fn func(row []byte, source rowSource) error) error {
+	scanner := bufio.NewScanner(pipeIn)
+	scanner.Buffer(make([]byte, 64*1024), maxRowSize)
+	source := rowSource{File: pipeName}
+	for scanner.Scan() {
+		source.Line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		watchdog.Progress(1)
+		if err := fn(scanner.Bytes(), source); err != nil {
+			return err
+		}
+	}
+	return errors.Wrap(scanner.Err(), "cant read stdin")
+}
+
+// errPipeArchive is returned by commands which need archive files when given
+// stdin
+func errPipeArchive() error {
+	return withKind(ErrUsage, errors.New("this command reads archive files and can not read event rows from stdin (-)"))
+}
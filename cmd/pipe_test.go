@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+// pipe runs fn with stdin set to in and returns what it wrote to stdout
+func pipe(t *testing.T, in string, fn func() error) (string, error) {
+	out := bytes.Buffer{}
+	pipeIn, pipeOut = strings.NewReader(in), &out
+	t.Cleanup(func() { pipeIn, pipeOut = os.Stdin, os.Stdout })
+	err := fn()
+	return out.String(), err
+}
+
+func TestPipeline(t *testing.T) {
+	walletA, walletB := fixtureKey("wallet-a", ""), fixtureKey("wallet-b", "")
+	mint := fixtureKey("mint", "pump")
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"signature":"s1","swap":{"walletAccount":"` + walletA + `","baseTokenMint":"` + mint + `","swapType":"buy"}}
+{"slot":3,"signature":"s3","swap":{"walletAccount":"` + walletB + `","baseTokenMint":"` + mint + `","swapType":"buy"}}
+`,
+		"more.json": `{"slot":2,"signature":"s2","swap":{"walletAccount":"` + walletB + `","baseTokenMint":"` + mint + `","swapType":"sell"}}
+`,
+	})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": `{"slot":4,"signature":"s4","swap":{"walletAccount":"` + walletA + `","baseTokenMint":"` + mint + `","swapType":"sell"}}
+`,
+	})
+
+	// ss-cli reduce -i data -o - --mint-suffix pump
+	rows, err := pipe(t, "", func() error {
+		task := NewReduceTask()
+		task.params.dataInDir = dataDir
+		task.params.dataOutDir = pipeName
+		task.params.mintSuffixes = "pump"
+		return task.Execute(context.Background())
+	})
+	assert.Nil(t, err)
+	// the files of each archive are merged in slot order
+	assert.Equal(t, []uint64{1, 2, 3, 4}, pipeSlots(rows))
+
+	// | ss-cli reduce -i - -o - --wallet a
+	rows, err = pipe(t, rows+"\n", func() error {
+		task := NewReduceTask()
+		task.params.dataInDir = pipeName
+		task.params.dataOutDir = pipeName
+		task.params.wallets = walletA
+		return task.Execute(context.Background())
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 4}, pipeSlots(rows))
+
+	// | ss-cli wallet-timeline -d - -w a
+	output := t.TempDir() + "/timeline.csv"
+	_, err = pipe(t, rows, func() error {
+		task := NewWalletTimelineTask()
+		task.params.dataDir = pipeName
+		task.params.wallets = walletA
+		task.params.format = ReportFormatCSV
+		task.params.output = output
+		return task.Execute(context.Background())
+	})
+	assert.Nil(t, err)
+	raw, err := os.ReadFile(output)
+	assert.Nil(t, err)
+	assert.Equal(t, 3, strings.Count(string(raw), "\n"))
+
+	// commands which need archive files say so
+	_, err = pipe(t, rows, func() error {
+		task := NewSortTask()
+		task.params.dataDir = pipeName
+		task.params.outDir = t.TempDir()
+		return task.Execute(context.Background())
+	})
+	assert.True(t, errors.Is(err, ErrUsage))
+
+	task := NewReduceTask()
+	task.params.dataInDir = pipeName
+	task.params.dataOutDir = t.TempDir()
+	assert.True(t, errors.Is(task.Execute(context.Background()), ErrUsage))
+}
+
+func pipeSlots(rows string) []uint64 {
+	slots := []uint64{}
+	for _, v := range strings.Split(strings.TrimSpace(rows), "\n") {
+		slots = append(slots, rowSlot([]byte(v)))
+	}
+	return slots
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// PriceKey* are the first column of a price series, which points are keyed by
+const (
+	PriceKeyTime = "time"
+	PriceKeySlot = "slot"
+)
+
+// pricePoint is the SOL/USD price from a slot or unix time on
+type pricePoint struct {
+	at    int64
+	price *big.Rat
+}
+
+// priceSeries is a SOL/USD price series keyed by slot or by time
+type priceSeries struct {
+	key    string
+	points []pricePoint
+}
+
+// usdPriceOptions converts quote volumes to USD with a SOL/USD price series
+// from a CSV file or URL, for --usd-prices
+type usdPriceOptions struct {
+	source  string
+	refresh bool
+	series  *priceSeries
+}
+
+func (o *usdPriceOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.source, "usd-prices", "", "A CSV file or http(s) URL of SOL/USD prices with a 'time' (RFC3339 or unix seconds) or 'slot' column and a 'price' column, to add USD volumes. URLs are cached locally")
+	cmd.Flags().BoolVar(&o.refresh, "refresh-usd-prices", false, "Download the --usd-prices URL again instead of using the locally cached copy")
+}
+
+// Load reads the price series. Does nothing unless --usd-prices is set.
+func (o *usdPriceOptions) Load() error {
+	if o.source == "" {
+		return nil
+	}
+	path := o.source
+	if strings.HasPrefix(o.source, "http://") || strings.HasPrefix(o.source, "https://") {
+		cached, err := cachePriceSeries(o.source, o.refresh)
+		if err != nil {
+			return err
+		}
+		path = cached
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.Wrap(err, "cant read usd prices")
+	}
+	defer f.Close()
+	series, err := readPriceSeries(f)
+	if err != nil {
+		return errors.Wrapf(err, "invalid usd prices %s", o.source)
+	}
+	logrus.Infof("loaded %d SOL/USD prices by %s", len(series.points), series.key)
+	o.series = series
+	return nil
+}
+
+// Enabled returns true when USD volumes are written
+func (o *usdPriceOptions) Enabled() bool {
+	return o.series != nil
+}
+
+// USD returns the value of a swap's quote amount in USD. Swaps quoted in SOL
+// use the price at their slot or block time, swaps quoted in USDC or USDT are
+// taken at face value. Returns false for other quote mints or when there is no
+// price yet.
+func (o *usdPriceOptions) USD(swap *SwapEvent, slot uint64, blockTime int64) (*big.Rat, bool) {
+	switch swap.QuoteTokenMint {
+	case usdcMint, usdtMint:
+		return tokenAmount(swap.QuoteAmount, knownDecimals[swap.QuoteTokenMint])
+	case wrappedSOLMint:
+	default:
+		return nil, false
+	}
+	at := blockTime
+	if o.series.key == PriceKeySlot {
+		at = int64(slot)
+	}
+	price, ok := o.series.At(at)
+	if !ok {
+		return nil, false
+	}
+	quote, ok := tokenAmount(swap.QuoteAmount, knownDecimals[wrappedSOLMint])
+	if !ok {
+		return nil, false
+	}
+	return quote.Mul(quote, price), true
+}
+
+// At returns the price of the latest point at or before at
+func (o *priceSeries) At(at int64) (*big.Rat, bool) {
+	i := sort.Search(len(o.points), func(i int) bool { return o.points[i].at > at })
+	if i == 0 {
+		return nil, false
+	}
+	return o.points[i-1].price, true
+}
+
+// readPriceSeries reads a CSV price series with a header row. The first
+// column is time or slot and the second is price, e.g. per minute prices:
+//
+//	time,price
+//	2024-05-05T12:00:00Z,143.21
+func readPriceSeries(r io.Reader) (*priceSeries, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) < 2 || len(rows[0]) < 2 {
+		return nil, errors.New("expected a header row and at least one price")
+	}
+	key := strings.ToLower(strings.TrimSpace(rows[0][0]))
+	if key != PriceKeyTime && key != PriceKeySlot {
+		return nil, fmt.Errorf("first column must be '%s' or '%s', not %q", PriceKeyTime, PriceKeySlot, rows[0][0])
+	}
+	series := &priceSeries{key: key}
+	for i, row := range rows[1:] {
+		if len(row) < 2 {
+			return nil, fmt.Errorf("line %d: expected %s and price", i+2, key)
+		}
+		at, err := parsePriceKey(key, strings.TrimSpace(row[0]))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %s", i+2, err)
+		}
+		// parsed as a decimal so no precision is lost to floats
+		price, ok := new(big.Rat).SetString(strings.TrimSpace(row[1]))
+		if !ok || price.Sign() < 0 {
+			return nil, fmt.Errorf("line %d: invalid price %q", i+2, row[1])
+		}
+		series.points = append(series.points, pricePoint{at: at, price: price})
+	}
+	sort.SliceStable(series.points, func(i, j int) bool {
+		return series.points[i].at < series.points[j].at
+	})
+	return series, nil
+}
+
+func parsePriceKey(key string, value string) (int64, error) {
+	if v, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return v, nil
+	}
+	if key == PriceKeySlot {
+		return 0, fmt.Errorf("invalid slot %q", value)
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, must be RFC3339 or unix seconds", value)
+	}
+	return t.Unix(), nil
+}
+
+// cachePriceSeries downloads a price series URL into the user cache dir once
+// and returns the path of the cached copy. Historical prices do not change so
+// the copy is kept until refresh is set.
+func cachePriceSeries(url string, refresh bool) (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256([]byte(url))
+	path := filepath.Join(dir, "ss-cli", "prices", hex.EncodeToString(sum[:8])+".csv")
+	if _, err := os.Stat(path); err == nil && !refresh {
+		logrus.Infof("using cached usd prices %s, run with --refresh-usd-prices to download them again", path)
+		return path, nil
+	}
+	logrus.Infof("downloading usd prices from %s ...", url)
+	client := &http.Client{Timeout: time.Minute}
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, "cant download usd prices")
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("cant download usd prices: unexpected status code: %d", resp.StatusCode)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	// written under a temp name so a failed download is never used
+	tmp, err := os.CreateTemp(filepath.Dir(path), "prices-*.partial")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return "", errors.Wrap(err, "cant download usd prices")
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	return path, os.Rename(tmp.Name(), path)
+}
+
+// formatUSD rounds a USD value to 6 decimals, the precision of USDC
+func formatUSD(value *big.Rat) string {
+	return value.FloatString(6)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestPriceSeries(t *testing.T) {
+	series, err := readPriceSeries(strings.NewReader("time,price\n2024-05-05T12:01:00Z,150\n1714910400,143.21\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, PriceKeyTime, series.key)
+
+	_, ok := series.At(1714910399)
+	assert.False(t, ok)
+	price, ok := series.At(1714910459)
+	assert.True(t, ok)
+	assert.Equal(t, "143.21", price.FloatString(2))
+	price, ok = series.At(1714920000)
+	assert.True(t, ok)
+	assert.Equal(t, "150.00", price.FloatString(2))
+
+	usd := usdPriceOptions{series: series}
+	value, ok := usd.USD(&SwapEvent{QuoteTokenMint: wrappedSOLMint, QuoteAmount: "1500000000"}, 1, 1714910401)
+	assert.True(t, ok)
+	assert.Equal(t, "214.815000", formatUSD(value))
+	value, ok = usd.USD(&SwapEvent{QuoteTokenMint: usdcMint, QuoteAmount: "2500000"}, 1, 0)
+	assert.True(t, ok)
+	assert.Equal(t, "2.500000", formatUSD(value))
+	_, ok = usd.USD(&SwapEvent{QuoteTokenMint: "other", QuoteAmount: "1"}, 1, 1714910401)
+	assert.False(t, ok)
+
+	bySlot, err := readPriceSeries(strings.NewReader("slot,price\n100,10\n"))
+	assert.Nil(t, err)
+	usd = usdPriceOptions{series: bySlot}
+	value, ok = usd.USD(&SwapEvent{QuoteTokenMint: wrappedSOLMint, QuoteAmount: "1000000000"}, 100, 0)
+	assert.True(t, ok)
+	assert.Equal(t, "10.000000", formatUSD(value))
+
+	_, err = readPriceSeries(strings.NewReader("minute,price\n1,1\n"))
+	assert.NotNil(t, err)
+	_, err = readPriceSeries(strings.NewReader("time,price\nyesterday,1\n"))
+	assert.NotNil(t, err)
+}
+
+func TestVolumeUSDPrices(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"blockTime":1714910400,"swap":{"quoteTokenMint":"So11111111111111111111111111111111111111112","swapType":"buy","quoteAmount":"2000000000"}}
+{"slot":2,"blockTime":1714910401,"swap":{"quoteTokenMint":"EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v","swapType":"sell","quoteAmount":"1000000"}}
+{"slot":3,"blockTime":1714910402,"swap":{"quoteTokenMint":"unknown","swapType":"sell","quoteAmount":"7"}}
+`,
+	})
+	prices := filepath.Join(t.TempDir(), "prices.csv")
+	assert.Nil(t, os.WriteFile(prices, []byte("time,price\n2024-05-05T12:00:00Z,143.5\n"), 0644))
+	task := NewVolumeTask()
+	task.params.dataDir = dataDir
+	task.params.interval = "5m"
+	task.params.format = ReportFormatCSV
+	task.params.output = filepath.Join(t.TempDir(), "volume.csv")
+	task.usd.source = prices
+	assert.Nil(t, task.Execute(context.Background()))
+	raw, err := os.ReadFile(task.params.output)
+	assert.Nil(t, err)
+	assert.Equal(t, `interval_start,group,quote_mint,swaps,buys,sells,quote_volume,quote_volume_usd
+2024-05-05T12:00:00Z,all,EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v,1,0,1,1,1.000000
+2024-05-05T12:00:00Z,all,So11111111111111111111111111111111111111112,1,1,0,2,287.000000
+2024-05-05T12:00:00Z,all,unknown,1,0,1,,0.000000
+`, string(raw))
+}
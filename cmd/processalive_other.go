@@ -0,0 +1,9 @@
+//go:build !linux && !darwin
+
+package main
+
+// processAlive can not tell on this platform so assumes the process is
+// running, stale locks need --force
+func processAlive(pid int) bool {
+	return true
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bytes"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// provenanceColumns are added to each record with --with-provenance
+var provenanceColumns = []string{"source_archive", "source_file", "source_line", "archive_sha256"}
+
+// provenanceOptions traces each record of a report back to the archive row
+// it came from, for audits
+type provenanceOptions struct {
+	enabled bool
+	// sha256 by archive path, hashed once per run
+	hashes map[string]string
+}
+
+func (o *provenanceOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&o.enabled, "with-provenance", false, "Add the archive, the file and line in it and the sha256 of the archive each record came from as columns")
+}
+
+// Columns returns the header with the provenance columns when enabled
+func (o *provenanceOptions) Columns(header []string) []string {
+	if !o.enabled {
+		return header
+	}
+	return append(header, provenanceColumns...)
+}
+
+// ReadRows reads the rows of the archive as readArchiveRows does, passing
+// the provenance values of each when enabled, otherwise nil
+func (o *provenanceOptions) ReadRows(path string, fn func(row []byte, provenance []any) error) error {
+	if !o.enabled {
+		return readArchiveRows(path, func(row []byte) error {
+			return fn(row, nil)
+		})
+	}
+	hash, err := o.hash(path)
+	if err != nil {
+		return err
+	}
+	archive := filepath.Base(path)
+	return readArchiveRowSources(path, func(row []byte, source rowSource) error {
+		return fn(row, []any{archive, source.File, source.Line, hash})
+	})
+}
+
+// ReadEvents reads the events of the archive as readArchiveEvents does. The
+// event cache has no line numbers, so it is not used when enabled.
+func (o *provenanceOptions) ReadEvents(path string, prefilter []byte, fn func(event EventRow, provenance []any) error) error {
+	if !o.enabled {
+		return readArchiveEvents(path, prefilter, func(event EventRow) error {
+			return fn(event, nil)
+		})
+	}
+	return o.ReadRows(path, func(row []byte, provenance []any) error {
+		if prefilter != nil && !bytes.Contains(row, prefilter) {
+			return nil
+		}
+		event := EventRow{}
+		if err := unmarshalEvent(row, &event); err != nil {
+			return errors.Wrap(err, "cant unmarshal event")
+		}
+		return fn(event, provenance)
+	})
+}
+
+// hash returns the sha256 of the archive, empty for stdin
+func (o *provenanceOptions) hash(path string) (string, error) {
+	if isPipe(path) {
+		return "", nil
+	}
+	if hash, ok := o.hashes[path]; ok {
+		return hash, nil
+	}
+	hash, err := fileSHA256(path)
+	if err != nil {
+		return "", errors.Wrap(err, "cant hash archive")
+	}
+	if o.hashes == nil {
+		o.hashes = map[string]string{}
+	}
+	o.hashes[path] = hash
+	return hash, nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	ProxyFromClient = "client"
+	ProxyFromServer = "server"
+
+	proxyRecordingEntry = "traffic.json"
+
+	// proxyShutdownTimeout bounds how long connections have to close on exit
+	proxyShutdownTimeout = 10 * time.Second
+)
+
+// RecordedMessage is one websocket message seen by the proxy
+type RecordedMessage struct {
+	Time    time.Time       `json:"time"`
+	From    string          `json:"from"`
+	Message json.RawMessage `json:"message"`
+}
+
+type ProxyTask struct {
+	http        httpOptions
+	connections atomic.Uint64
+	// proxied connections still open, which the http server does not track
+	// once they are upgraded
+	active sync.WaitGroup
+	params struct {
+		listen    string
+		recordDir string
+		liveURL   string
+		apiKey    string
+	}
+}
+
+func NewProxyTask() *ProxyTask {
+	return &ProxyTask{}
+}
+
+func (o *ProxyTask) SetupParameters(cmd *cobra.Command) {
+	o.http.SetupParameters(cmd)
+	cmd.Flags().StringVar(&o.params.listen, "listen", "localhost:9000", "The address to accept client connections on")
+	cmd.Flags().StringVar(&o.params.recordDir, "record", "", "Record the messages of each connection in both directions to a new archive file in this dir")
+	cmd.Flags().StringVar(&o.params.liveURL, "live-url", defaultLiveURL, "The live websocket to proxy to")
+	cmd.Flags().StringVarP(&o.params.apiKey, "key", "k", "", "Your API key. Used for clients that do not send their own X-API-KEY header")
+}
+
+func (o *ProxyTask) GetMeta() Meta {
+	return Meta{
+		Name:        "ProxyTask",
+		Use:         "proxy",
+		Description: "Proxy websocket clients to the live SolanaStreaming feed, optionally recording everything each client sent and received so it can be replayed later.",
+	}
+}
+
+func (o *ProxyTask) Execute(ctx context.Context) error {
+	if o.params.recordDir != "" {
+		if err := os.MkdirAll(o.params.recordDir, 0755); err != nil {
+			return err
+		}
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	listener, err := net.Listen("tcp", o.params.listen)
+	if err != nil {
+		return err
+	}
+	logrus.Infof("Proxying websocket connections on %s to %s", o.params.listen, o.params.liveURL)
+	return o.serve(ctx, listener)
+}
+
+// serve proxies connections until ctx is done, then closes them all and
+// finishes their recordings before returning
+func (o *ProxyTask) serve(ctx context.Context, listener net.Listener) error {
+	server := &http.Server{Handler: o.handler(ctx)}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Serve(listener)
+	}()
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	logrus.Infof("shutting down the proxy")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), proxyShutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(shutdownCtx)
+	// upgraded connections close themselves on ctx
+	o.active.Wait()
+	return err
+}
+
+func (o *ProxyTask) handler(ctx context.Context) http.HandlerFunc {
+	upgrader := websocket.Upgrader{} // use default options
+	return func(w http.ResponseWriter, r *http.Request) {
+		o.active.Add(1)
+		defer o.active.Done()
+		dialer, err := o.http.NewWebsocketDialer()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		header := http.Header{}
+		header.Set("User-Agent", userAgent())
+		header.Set("X-API-KEY", o.params.apiKey)
+		if apiKey := r.Header.Get("X-API-KEY"); apiKey != "" {
+			header.Set("X-API-KEY", apiKey)
+		}
+		server, _, err := dialer.DialContext(ctx, o.params.liveURL, header)
+		if err != nil {
+			logrus.Errorf("proxy dial: %s", err.Error())
+			http.Error(w, "cant connect to live feed", http.StatusBadGateway)
+			return
+		}
+		defer server.Close()
+		client, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			logrus.Errorf("upgrade: %s", err.Error())
+			return
+		}
+		defer client.Close()
+
+		recorder, err := o.newRecorder()
+		if err != nil {
+			logrus.Errorf("proxy record: %s", err.Error())
+			return
+		}
+		defer recorder.Close()
+		logrus.Infof("proxying connection from %s", r.RemoteAddr)
+
+		done := make(chan struct{}, 2)
+		pipe := func(from string, src *websocket.Conn, dst *websocket.Conn) {
+			defer func() { done <- struct{}{} }()
+			for {
+				messageType, message, err := src.ReadMessage()
+				if err != nil {
+					logrus.Debugf("proxy read from %s: %s", from, err.Error())
+					return
+				}
+				recorder.Record(from, message)
+				if err := dst.WriteMessage(messageType, message); err != nil {
+					logrus.Debugf("proxy write from %s: %s", from, err.Error())
+					return
+				}
+			}
+		}
+		go pipe(ProxyFromClient, client, server)
+		go pipe(ProxyFromServer, server, client)
+		// when either side goes away, or the proxy shuts down, close both
+		closed := 0
+		select {
+		case <-done:
+			closed++
+		case <-ctx.Done():
+		}
+		client.Close()
+		server.Close()
+		for ; closed < 2; closed++ {
+			<-done
+		}
+		logrus.Infof("proxied connection from %s closed", r.RemoteAddr)
+	}
+}
+
+func (o *ProxyTask) newRecorder() (*trafficRecorder, error) {
+	if o.params.recordDir == "" {
+		return nil, nil
+	}
+	name := fmt.Sprintf("proxy-%s-%d.zip", time.Now().UTC().Format(archiveZipFileTimeFormat), o.connections.Add(1))
+	path := filepath.Join(o.params.recordDir, name)
+	f, err := createArchive(path)
+	if err != nil {
+		return nil, err
+	}
+	zw := zip.NewWriter(f)
+	entry, err := zw.Create(proxyRecordingEntry)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	logrus.Infof("recording connection to %s", path)
+	return &trafficRecorder{
+		f:   f,
+		zw:  zw,
+		enc: json.NewEncoder(entry),
+	}, nil
+}
+
+// trafficRecorder writes the messages of one proxied connection to an archive.
+// A nil recorder discards everything.
+type trafficRecorder struct {
+	lock sync.Mutex
+	f    io.WriteCloser
+	zw   *zip.Writer
+	enc  *json.Encoder
+}
+
+func (o *trafficRecorder) Record(from string, message []byte) {
+	if o == nil {
+		return
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	raw := json.RawMessage(message)
+	if !json.Valid(message) {
+		raw, _ = json.Marshal(string(message))
+	}
+	err := o.enc.Encode(RecordedMessage{Time: time.Now().UTC(), From: from, Message: raw})
+	if err != nil {
+		logrus.Errorf("proxy record: %s", err.Error())
+	}
+}
+
+func (o *trafficRecorder) Close() error {
+	if o == nil {
+		return nil
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if err := o.zw.Close(); err != nil {
+		o.f.Close()
+		return errors.Wrap(err, "cant finish recording")
+	}
+	return o.f.Close()
+}
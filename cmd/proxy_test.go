@@ -0,0 +1,150 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/test-go/testify/assert"
+)
+
+func TestProxyRecord(t *testing.T) {
+	// echoes every message back
+	liveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "client-key", r.Header.Get("X-API-KEY"))
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer c.Close()
+		for {
+			messageType, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.WriteMessage(messageType, message)
+		}
+	}))
+	defer liveServer.Close()
+
+	recordDir := t.TempDir()
+	pt := NewProxyTask()
+	pt.params.liveURL = "ws" + strings.TrimPrefix(liveServer.URL, "http")
+	pt.params.recordDir = recordDir
+	pt.params.apiKey = "default-key"
+	server := httptest.NewServer(pt.handler(context.Background()))
+	defer server.Close()
+
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), http.Header{"X-Api-Key": {"client-key"}})
+	assert.Nil(t, err)
+	assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(`{"id":1,"method":"swapSubscribe"}`)))
+	_, message, err := c.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, `{"id":1,"method":"swapSubscribe"}`, string(message))
+	c.Close()
+
+	// the recording is finished once the proxy sees the client has gone
+	var recorded []RecordedMessage
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		files, _ := filepath.Glob(filepath.Join(recordDir, "proxy-*.zip"))
+		if len(files) != 1 {
+			continue
+		}
+		r, err := zip.OpenReader(files[0])
+		if err != nil {
+			continue
+		}
+		rc, err := r.File[0].Open()
+		assert.Nil(t, err)
+		scanner := bufio.NewScanner(rc)
+		for scanner.Scan() {
+			v := RecordedMessage{}
+			assert.Nil(t, json.Unmarshal(scanner.Bytes(), &v))
+			recorded = append(recorded, v)
+		}
+		rc.Close()
+		r.Close()
+		break
+	}
+	assert.Len(t, recorded, 2)
+	if len(recorded) == 2 {
+		assert.Equal(t, ProxyFromClient, recorded[0].From)
+		assert.Equal(t, ProxyFromServer, recorded[1].From)
+		assert.JSONEq(t, `{"id":1,"method":"swapSubscribe"}`, string(recorded[1].Message))
+		assert.False(t, recorded[0].Time.IsZero())
+	}
+	_, err = os.Stat(recordDir)
+	assert.Nil(t, err)
+}
+
+func TestProxyShutdown(t *testing.T) {
+	liveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer c.Close()
+		for {
+			messageType, message, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			c.WriteMessage(messageType, message)
+		}
+	}))
+	defer liveServer.Close()
+
+	recordDir := t.TempDir()
+	pt := NewProxyTask()
+	pt.params.liveURL = "ws" + strings.TrimPrefix(liveServer.URL, "http")
+	pt.params.recordDir = recordDir
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- pt.serve(ctx, listener)
+	}()
+
+	c, _, err := websocket.DefaultDialer.Dial("ws://"+listener.Addr().String(), nil)
+	assert.Nil(t, err)
+	defer c.Close()
+	assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(`{"id":1}`)))
+	_, _, err = c.ReadMessage()
+	assert.Nil(t, err)
+
+	// the client is still connected when the proxy stops
+	cancel()
+	select {
+	case err := <-served:
+		assert.Nil(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("proxy did not shut down")
+	}
+
+	// and its recording is a complete archive
+	files, err := filepath.Glob(filepath.Join(recordDir, "proxy-*.zip"))
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+	r, err := zip.OpenReader(files[0])
+	assert.Nil(t, err)
+	defer r.Close()
+	rc, err := r.File[0].Open()
+	assert.Nil(t, err)
+	defer rc.Close()
+	lines := 0
+	for scanner := bufio.NewScanner(rc); scanner.Scan(); {
+		lines++
+	}
+	assert.Equal(t, 2, lines)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const pushMetricsTimeout = 10 * time.Second
+
+// metricsPush publishes the final counters of a command to a Prometheus
+// pushgateway when --push-metrics is set, as batch commands exit before they
+// could be scraped
+var metricsPush = &metricsPusher{}
+
+// Metric is a gauge pushed at the end of a command
+type Metric struct {
+	Name  string
+	Help  string
+	Value float64
+}
+
+// metricsTask is a task with counters of its own to push, read once it has
+// finished
+type metricsTask interface {
+	Metrics() []Metric
+}
+
+type metricsPusher struct {
+	url string
+}
+
+// Validate checks the pushgateway url, e.g. http://pushgateway:9091/job/ss-cli
+func (o *metricsPusher) Validate() error {
+	if o.url == "" {
+		return nil
+	}
+	_, err := o.groupURL("validate")
+	return err
+}
+
+// groupURL returns the url of the metrics group of the command. The command
+// is added to the grouping key so the runs of each command are kept apart,
+// and /metrics is added if the url does not start with it.
+func (o *metricsPusher) groupURL(command string) (string, error) {
+	u, err := url.Parse(o.url)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid push-metrics url")
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("push-metrics must be an http(s) pushgateway url, e.g. http://pushgateway:9091/metrics/job/ss-cli, not %q", o.url)
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	if !strings.HasPrefix(path, "/metrics/") {
+		path = "/metrics" + path
+	}
+	if !strings.HasPrefix(path, "/metrics/job/") {
+		return "", fmt.Errorf("push-metrics must have a job, e.g. http://pushgateway:9091/metrics/job/ss-cli, not %q", o.url)
+	}
+	u.Path = path + "/command/" + url.PathEscape(command)
+	return u.String(), nil
+}
+
+// Push replaces the metrics of the command on the pushgateway with those of
+// this run. A failure to push is logged rather than failing the command.
+func (o *metricsPusher) Push(ctx context.Context, tsk Task, took time.Duration, cmdErr error) {
+	if o.url == "" {
+		return
+	}
+	command := tsk.GetMeta().Use
+	metrics := runMetrics(took, cmdErr)
+	if v, ok := tsk.(metricsTask); ok {
+		metrics = append(metrics, v.Metrics()...)
+	}
+	if err := o.push(ctx, command, metrics); err != nil {
+		logrus.Warnf("could not push metrics: %s", err)
+		return
+	}
+	logrus.Infof("pushed %d metrics for %s", len(metrics), command)
+}
+
+func (o *metricsPusher) push(ctx context.Context, command string, metrics []Metric) error {
+	target, err := o.groupURL(command)
+	if err != nil {
+		return err
+	}
+	// pushed even when the command was cancelled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), pushMetricsTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, bytes.NewReader(formatMetrics(metrics)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("pushgateway responded %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// runMetrics are pushed for every command
+func runMetrics(took time.Duration, cmdErr error) []Metric {
+	success, exitCode := 1.0, 0
+	if cmdErr != nil {
+		success, exitCode = 0, classifyError(cmdErr).Code
+	}
+	return []Metric{
+		{Name: "ss_cli_last_run_timestamp_seconds", Help: "When the run finished", Value: float64(time.Now().Unix())},
+		{Name: "ss_cli_run_duration_seconds", Help: "How long the run took", Value: took.Seconds()},
+		{Name: "ss_cli_run_success", Help: "1 if the run succeeded, otherwise 0", Value: success},
+		{Name: "ss_cli_run_exit_code", Help: "The exit code of the run, see Exit Codes in the README", Value: float64(exitCode)},
+		{Name: "ss_cli_run_stall_retries", Help: "Times the run was retried after stalling, with --on-stall retry", Value: float64(max(0, watchdog.attempts-1))},
+		{Name: "ss_cli_written_bytes", Help: "Bytes written to disk by the run", Value: float64(diskUsage.Used())},
+	}
+}
+
+// formatMetrics writes the metrics as gauges in the Prometheus text format
+func formatMetrics(metrics []Metric) []byte {
+	out := bytes.Buffer{}
+	for _, v := range metrics {
+		fmt.Fprintf(&out, "# HELP %s %s\n# TYPE %s gauge\n%s %g\n", v.Name, v.Help, v.Name, v.Name, v.Value)
+	}
+	return out.Bytes()
+}
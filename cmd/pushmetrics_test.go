@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestPushMetricsGroupURL(t *testing.T) {
+	for url, expected := range map[string]string{
+		"http://pushgateway:9091/metrics/job/ss-cli":               "http://pushgateway:9091/metrics/job/ss-cli/command/download",
+		"http://pushgateway:9091/job/ss-cli/":                      "http://pushgateway:9091/metrics/job/ss-cli/command/download",
+		"https://pushgateway/metrics/job/ss-cli/instance/ci-1?x=1": "https://pushgateway/metrics/job/ss-cli/instance/ci-1/command/download?x=1",
+	} {
+		actual, err := (&metricsPusher{url: url}).groupURL("download")
+		assert.Nil(t, err, url)
+		assert.Equal(t, expected, actual)
+	}
+	for _, v := range []string{"pushgateway:9091/job/ss-cli", "ftp://pushgateway/metrics/job/x", "http://pushgateway:9091", "http://pushgateway:9091/metrics/ss-cli"} {
+		assert.NotNil(t, (&metricsPusher{url: v}).Validate(), v)
+	}
+}
+
+func TestPushMetrics(t *testing.T) {
+	pushed := make(chan string, 1)
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/metrics/job/ss-cli/command/download", r.URL.Path)
+		body, err := io.ReadAll(r.Body)
+		assert.Nil(t, err)
+		pushed <- string(body)
+	}))
+	defer gateway.Close()
+	server := httptest.NewServer(NewMockAPI(fixturesDir))
+	defer server.Close()
+
+	task := NewDownloadTask()
+	task.params.apiKey = "test-key"
+	task.params.orderID = 1
+	task.params.concurrency = 3
+	task.params.processWorkers = 2
+	task.params.outputDir = t.TempDir()
+	task.params.apiEndpoint = server.URL
+	err := task.Execute(context.Background())
+	assert.Nil(t, err)
+	(&metricsPusher{url: gateway.URL + "/job/ss-cli"}).Push(context.Background(), task, 2*time.Second, err)
+
+	body := <-pushed
+	for _, v := range []string{
+		"# TYPE ss_cli_run_success gauge\nss_cli_run_success 1\n",
+		"ss_cli_run_exit_code 0\n",
+		"ss_cli_run_duration_seconds 2\n",
+		"ss_cli_download_files_downloaded 3\n",
+		"ss_cli_download_files_failed 0\n",
+		"ss_cli_download_checksum_mismatches 0\n",
+	} {
+		assert.True(t, strings.Contains(body, v), "%q not in %s", v, body)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	// quarantineDir is where archives which fail verification are moved to in a
+	// data dir. download fetches them again as they are no longer in the dir.
+	quarantineDir          = "quarantine"
+	quarantineReasonSuffix = ".reason.json"
+)
+
+// QuarantineReason is saved next to a quarantined archive
+type QuarantineReason struct {
+	File          string    `json:"file"`
+	Reason        string    `json:"reason"`
+	QuarantinedAt time.Time `json:"quarantinedAt"`
+}
+
+// quarantineFile moves a bad archive in dataDir to its quarantine dir with the
+// reason it failed
+func quarantineFile(dataDir string, file string, reason error) error {
+	return quarantineFileFrom(dataDir, dataDir, file, reason)
+}
+
+// quarantineFileFrom moves a bad archive in srcDir to the quarantine dir of
+// dataDir, e.g. a full file downloaded to be reduced
+func quarantineFileFrom(srcDir string, dataDir string, file string, reason error) error {
+	dir := filepath.Join(dataDir, quarantineDir)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrap(err, "cant create quarantine dir")
+	}
+	raw, err := json.MarshalIndent(QuarantineReason{File: file, Reason: reason.Error(), QuarantinedAt: time.Now().UTC()}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, file+quarantineReasonSuffix), raw, 0644); err != nil {
+		return errors.Wrap(err, "cant write quarantine reason")
+	}
+	if err := os.Rename(filepath.Join(srcDir, file), filepath.Join(dir, file)); err != nil {
+		return errors.Wrapf(err, "cant quarantine %s", file)
+	}
+	logrus.Warnf("quarantined %s: %s", file, reason)
+	return nil
+}
+
+// listQuarantine returns the reasons of the archives quarantined in dataDir
+func listQuarantine(dataDir string) ([]QuarantineReason, error) {
+	dir := filepath.Join(dataDir, quarantineDir)
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	reasons := []QuarantineReason{}
+	for _, v := range entries {
+		if !strings.HasSuffix(v.Name(), quarantineReasonSuffix) {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(dir, v.Name()))
+		if err != nil {
+			return nil, err
+		}
+		reason := QuarantineReason{}
+		if err := json.Unmarshal(raw, &reason); err != nil {
+			return nil, errors.Wrapf(err, "invalid quarantine reason %s", v.Name())
+		}
+		reasons = append(reasons, reason)
+	}
+	slices.SortFunc(reasons, func(a, b QuarantineReason) int {
+		return strings.Compare(a.File, b.File)
+	})
+	return reasons, nil
+}
+
+// removeQuarantined deletes a quarantined archive and its reason, e.g. once it
+// has been downloaded again
+func removeQuarantined(dataDir string, file string) error {
+	dir := filepath.Join(dataDir, quarantineDir)
+	if err := os.Remove(filepath.Join(dir, file)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err := os.Remove(filepath.Join(dir, file+quarantineReasonSuffix)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// only removed once empty
+	os.Remove(dir)
+	return nil
+}
+
+// QuarantineTask lists or restores quarantined archives
+type QuarantineTask struct {
+	action string
+	params struct {
+		dataDir string
+		files   []string
+		all     bool
+	}
+}
+
+const (
+	QuarantineList    = "list"
+	QuarantineRestore = "restore"
+)
+
+func NewQuarantineTask(action string) *QuarantineTask {
+	return &QuarantineTask{action: action}
+}
+
+func (o *QuarantineTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The data dir the archives were quarantined from")
+	if o.action == QuarantineRestore {
+		cmd.Flags().StringSliceVar(&o.params.files, "file", nil, "The archives to move back into the data dir e.g. 20240505-120000.zip. (Comma separated list)")
+		cmd.Flags().BoolVar(&o.params.all, "all", false, "Move every quarantined archive back into the data dir")
+	}
+}
+
+func (o *QuarantineTask) GetMeta() Meta {
+	descriptions := map[string]string{
+		QuarantineList:    "List the archives moved to quarantine because they failed verification, and why.",
+		QuarantineRestore: "Move quarantined archives back into the data dir, e.g. after checking them by hand.",
+	}
+	return Meta{
+		Name:        "QuarantineTask",
+		Use:         o.action,
+		Description: descriptions[o.action],
+	}
+}
+
+func (o *QuarantineTask) Execute(ctx context.Context) error {
+	reasons, err := listQuarantine(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+	if o.action == QuarantineList {
+		if len(reasons) == 0 {
+			fmt.Printf("no archives are quarantined in %s\n", o.params.dataDir)
+			return nil
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "FILE\tQUARANTINED\tREASON")
+		for _, v := range reasons {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", v.File, v.QuarantinedAt.Format(time.RFC3339), v.Reason)
+		}
+		return w.Flush()
+	}
+
+	if o.params.all == (len(o.params.files) != 0) {
+		return withKind(ErrUsage, errors.New("specify either --file or --all"))
+	}
+	files := o.params.files
+	if o.params.all {
+		files = []string{}
+		for _, v := range reasons {
+			files = append(files, v.File)
+		}
+	}
+	for _, file := range files {
+		if !slices.ContainsFunc(reasons, func(v QuarantineReason) bool { return v.File == file }) {
+			return withKind(ErrUsage, fmt.Errorf("%s is not quarantined", file))
+		}
+		target := filepath.Join(o.params.dataDir, file)
+		if _, err := os.Stat(target); err == nil {
+			return fmt.Errorf("%s is in the data dir already, it may have been downloaded again", file)
+		}
+		if err := os.Rename(filepath.Join(o.params.dataDir, quarantineDir, file), target); err != nil {
+			return errors.Wrapf(err, "cant restore %s", file)
+		}
+		if err := removeQuarantined(o.params.dataDir, file); err != nil {
+			return err
+		}
+		fmt.Printf("restored %s\n", file)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"os"
+	"runtime/pprof"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// queueStats samples how full the queues between the archive readers and the
+// emitter are. Mostly empty queues mean the readers are the bottleneck,
+// mostly full ones the emitter or the client.
+type queueStats struct {
+	capacity int
+	reads    uint64
+	depth    uint64
+	// reads which had to wait for a reader
+	empty uint64
+}
+
+// Observe records the depth of a queue about to be read from
+func (o *queueStats) Observe(depth int) {
+	o.reads++
+	o.depth += uint64(depth)
+	if depth == 0 {
+		o.empty++
+	}
+}
+
+func (o *queueStats) Log() {
+	if o.reads == 0 {
+		return
+	}
+	logrus.Infof("reader queues: average depth %.1f of %d, empty on %.1f%% of reads", float64(o.depth)/float64(o.reads), o.capacity, 100*float64(o.empty)/float64(o.reads))
+}
+
+// startCPUProfile profiles the CPU to path until the returned func is called
+func startCPUProfile(path string) (func(), error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(f); err != nil {
+		f.Close()
+		return nil, errors.Wrap(err, "cant start the cpu profile")
+	}
+	return func() {
+		pprof.StopCPUProfile()
+		f.Close()
+		logrus.Infof("wrote cpu profile %s", path)
+	}, nil
+}
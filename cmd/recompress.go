@@ -0,0 +1,207 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+// RecompressZstd is the --to name for zstd seekable entries
+const RecompressZstd = "zstd"
+
+type RecompressTask struct {
+	lock   dirLockOptions
+	before atomic.Int64
+	after  atomic.Int64
+	params struct {
+		dataDir     string
+		to          string
+		level       int
+		concurrency int
+	}
+}
+
+func NewRecompressTask() *RecompressTask {
+	return &RecompressTask{}
+}
+
+func (o *RecompressTask) SetupParameters(cmd *cobra.Command) {
+	o.lock.SetupParameters(cmd)
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir containing the archive files to recompress in place")
+	cmd.Flags().StringVar(&o.params.to, "to", RecompressZstd, "The compression to rewrite the archives with: zstd or deflate")
+	cmd.Flags().IntVar(&o.params.level, "level", 0, "The compression level, 1-22 for zstd and 1-9 for deflate. Defaults to the standard level")
+	cmd.Flags().IntVar(&o.params.concurrency, "concurrency", 1, "How many files to recompress at once")
+}
+
+func (o *RecompressTask) GetMeta() Meta {
+	return Meta{
+		Name:        "RecompressTask",
+		Use:         "recompress",
+		Description: "Rewrite archive files in place with another compression, e.g. zstd to reclaim disk space without downloading them again.",
+	}
+}
+
+func (o *RecompressTask) Execute(ctx context.Context) error {
+	compression, err := o.validateParams()
+	if err != nil {
+		return withKind(ErrUsage, err)
+	}
+	// files are rewritten in place so stdin can not be used
+	if o.params.dataDir == pipeName {
+		return errPipeArchive()
+	}
+	unlock, err := o.lock.Lock(o.params.dataDir, "recompress")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return withKind(ErrUsage, fmt.Errorf("no archive files found in %s", o.params.dataDir))
+	}
+	if _, err := os.Stat(filepath.Join(o.params.dataDir, entitlementFileName)); err == nil {
+		logrus.Warnf("recompressed files no longer match the entitlement in %s, so --verify-entitlement will fail for them", o.params.dataDir)
+	}
+
+	recompressed := atomic.Int64{}
+	group, ctx := errgroup.WithContext(ctx)
+	group.SetLimit(o.params.concurrency)
+	for _, v := range files {
+		group.Go(func() error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			done, err := o.recompressFile(v, compression)
+			if err != nil {
+				return errors.Wrapf(err, "cant recompress %s", v)
+			}
+			if done {
+				recompressed.Add(1)
+			}
+			return nil
+		})
+	}
+	err = group.Wait()
+	before, after := o.before.Load(), o.after.Load()
+	saved := before - after
+	percent := 0.0
+	if before != 0 {
+		percent = float64(saved) / float64(before) * 100
+	}
+	logrus.Infof("recompressed %d of %d files to %s: %s -> %s, saved %s (%.1f%%)", recompressed.Load(), len(files), o.params.to,
+		formatBytes(before), formatBytes(after), formatBytes(saved), percent)
+	return err
+}
+
+// validateParams returns the compression the archives are rewritten with
+func (o *RecompressTask) validateParams() (string, error) {
+	if o.params.concurrency < 1 {
+		return "", errors.New("concurrency must be at least 1")
+	}
+	switch o.params.to {
+	case RecompressZstd, CompressionZstdSeekable:
+		if o.params.level < 0 || o.params.level > 22 {
+			return "", errors.New("level must be 1-22 for zstd")
+		}
+		return CompressionZstdSeekable, nil
+	case CompressionDeflate:
+		if o.params.level < 0 || o.params.level > 9 {
+			return "", errors.New("level must be 1-9 for deflate")
+		}
+		return CompressionDeflate, nil
+	default:
+		return "", fmt.Errorf("to must be %s or %s", RecompressZstd, CompressionDeflate)
+	}
+}
+
+// recompressFile rewrites the archive with compression, replacing it once the
+// new archive is complete so an interrupted run never leaves a partial file.
+// Archives already with compression are skipped, unless a level is set.
+func (o *RecompressTask) recompressFile(fileName string, compression string) (bool, error) {
+	path := filepath.Join(o.params.dataDir, fileName)
+	r, closer, err := openArchive(path)
+	if err != nil {
+		return false, err
+	}
+	defer closer.Close()
+	if o.params.level == 0 && archiveCompressed(r, compression) {
+		logrus.Infof("%s is already %s", fileName, o.params.to)
+		return false, nil
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	out, err := createArchive(path + ".partial")
+	if err != nil {
+		return false, err
+	}
+	w := zip.NewWriter(out)
+	// keeps reduced archives marked as reduced
+	err = w.SetComment(r.Comment)
+	for i := 0; err == nil && i < len(r.File); i++ {
+		err = o.recompressEntry(r.File[i], w, compression)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(path + ".partial")
+		return false, err
+	}
+	// the original is still open, which only matters on windows
+	closer.Close()
+	if err := os.Rename(path+".partial", path); err != nil {
+		return false, err
+	}
+	newInfo, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	o.before.Add(info.Size())
+	o.after.Add(newInfo.Size())
+	logrus.Infof("recompressed %s: %s -> %s", fileName, formatBytes(info.Size()), formatBytes(newInfo.Size()))
+	return true, nil
+}
+
+func (o *RecompressTask) recompressEntry(f *zip.File, w *zip.Writer, compression string) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	aw, err := createEntryLevel(w, f.Name, compression, o.params.level)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(aw, rc)
+	return err
+}
+
+// archiveCompressed reports whether every entry in the archive already has
+// the compression
+func archiveCompressed(r *zip.Reader, compression string) bool {
+	for _, v := range r.File {
+		if v.Method != entryMethod(compression) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/test-go/testify/assert"
+)
+
+func TestRecompress(t *testing.T) {
+	dir := copyFixtures(t)
+	files, err := listArchiveFiles(dir)
+	assert.Nil(t, err)
+	rows := func() []string {
+		all := []string{}
+		for _, v := range files {
+			assert.Nil(t, readArchiveRows(filepath.Join(dir, v), func(row []byte) error {
+				all = append(all, string(row))
+				return nil
+			}))
+		}
+		return all
+	}
+	original := rows()
+
+	task := NewRecompressTask()
+	task.params.dataDir = dir
+	task.params.to = RecompressZstd
+	task.params.level = 10
+	task.params.concurrency = 2
+	assert.Nil(t, task.Execute(context.Background()))
+	assert.Equal(t, original, rows())
+	for _, v := range files {
+		r, closer, err := openArchive(filepath.Join(dir, v))
+		assert.Nil(t, err)
+		assert.Equal(t, uint16(zstd.ZipMethodWinZip), r.File[0].Method)
+		closer.Close()
+		_, err = os.Stat(filepath.Join(dir, v+".partial"))
+		assert.True(t, os.IsNotExist(err))
+	}
+	assert.NotZero(t, task.before.Load())
+
+	// files already in zstd are skipped without a level
+	again := NewRecompressTask()
+	again.params.dataDir = dir
+	again.params.to = RecompressZstd
+	again.params.concurrency = 1
+	assert.Nil(t, again.Execute(context.Background()))
+	assert.Zero(t, again.before.Load())
+
+	back := NewRecompressTask()
+	back.params.dataDir = dir
+	back.params.to = CompressionDeflate
+	back.params.concurrency = 1
+	assert.Nil(t, back.Execute(context.Background()))
+	assert.Equal(t, original, rows())
+
+	back.params.level = 10
+	assert.True(t, errors.Is(back.Execute(context.Background()), ErrUsage))
+}
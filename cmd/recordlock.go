@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// recordLockInterval is how often a recorder checks it still holds the lock
+// of its output dir. A takeover waits for twice this so the run it took over
+// from has stopped and finished its file before it starts writing.
+const recordLockInterval = 5 * time.Second
+
+// recordLockOptions stops two tail runs recording to the same output dir,
+// e.g. on two hosts sharing a network drive, with --takeover to fail over
+// from one to the other
+type recordLockOptions struct {
+	takeover bool
+	interval time.Duration
+}
+
+func (o *recordLockOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&o.takeover, "takeover", false, "Take over the output dir from another tail recording to it. The other run stops within 5s and this one starts writing after 10s")
+}
+
+// Hold locks dir and returns a context which is cancelled with ErrLocked as
+// the cause when another run takes the lock over, and the func to release it
+func (o *recordLockOptions) Hold(ctx context.Context, dir string) (context.Context, func(), error) {
+	lock := newDirLock("tail")
+	tookOver := false
+	err := takeDirLock(dir, lock, func(held DirLock) error {
+		if !o.takeover {
+			return withKind(ErrLocked, fmt.Errorf("%s is being recorded to by %s instance %s. Pass --takeover to take over from it", dir, held, held.InstanceID))
+		}
+		logrus.Warnf("taking over %s from %s instance %s", dir, held, held.InstanceID)
+		tookOver = true
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	path := filepath.Join(dir, dirLockFileName)
+	ctx, cancel := context.WithCancelCause(ctx)
+	unlock := func() {
+		cancel(nil)
+		releaseDirLock(path, lock)
+	}
+	logrus.Infof("recording to %s as instance %s", dir, lock.InstanceID)
+	if tookOver {
+		logrus.Infof("waiting %s for the run taken over from to stop", 2*o.interval)
+		select {
+		case <-ctx.Done():
+			unlock()
+			return nil, nil, ctx.Err()
+		case <-time.After(2 * o.interval):
+		}
+	}
+	go o.watch(ctx, cancel, dir, lock)
+	return ctx, unlock, nil
+}
+
+// watch cancels the run once the lock of dir holds another instance
+func (o *recordLockOptions) watch(ctx context.Context, cancel context.CancelCauseFunc, dir string, lock DirLock) {
+	path := filepath.Join(dir, dirLockFileName)
+	ticker := time.NewTicker(o.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		held, err := readDirLock(path)
+		if os.IsNotExist(err) {
+			// removed by hand or cleaned up, put back unless another run
+			// took it meanwhile
+			err = takeDirLock(dir, lock, func(held DirLock) error {
+				return withKind(ErrLocked, fmt.Errorf("%s was taken over by %s instance %s, stopping", dir, held, held.InstanceID))
+			})
+			if errors.Is(err, ErrLocked) {
+				cancel(err)
+				return
+			}
+			if err != nil {
+				logrus.Warnf("cant restore lock %s: %s", path, err)
+			}
+			continue
+		}
+		if err != nil {
+			// may be being written by a run taking over, checked again next time
+			continue
+		}
+		if held.InstanceID != lock.InstanceID {
+			cancel(withKind(ErrLocked, fmt.Errorf("%s was taken over by %s instance %s, stopping", dir, held, held.InstanceID)))
+			return
+		}
+	}
+}
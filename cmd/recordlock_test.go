@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/test-go/testify/assert"
+)
+
+func TestRecordLockTakeover(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, dirLockFileName)
+	ctx := context.Background()
+	first := recordLockOptions{interval: 10 * time.Millisecond}
+	running, unlock, err := first.Hold(ctx, dir)
+	assert.Nil(t, err)
+	defer unlock()
+
+	// a second recorder is refused while the first is running
+	second := recordLockOptions{interval: 10 * time.Millisecond}
+	_, _, err = second.Hold(ctx, dir)
+	assert.True(t, errors.Is(err, ErrLocked))
+	assert.Contains(t, err.Error(), "--takeover")
+
+	// put back when removed
+	assert.Nil(t, os.Remove(path))
+	time.Sleep(50 * time.Millisecond)
+	_, err = readDirLock(path)
+	assert.Nil(t, err)
+	assert.Nil(t, running.Err())
+
+	// the first recorder stops before the takeover returns
+	second.takeover = true
+	_, unlockSecond, err := second.Hold(ctx, dir)
+	assert.Nil(t, err)
+	assert.NotNil(t, running.Err())
+	cause := context.Cause(running)
+	assert.True(t, errors.Is(cause, ErrLocked))
+	assert.Contains(t, cause.Error(), "was taken over")
+	held, err := readDirLock(path)
+	assert.Nil(t, err)
+
+	// the lock is left to the run which took it over
+	unlock()
+	after, err := readDirLock(path)
+	assert.Nil(t, err)
+	assert.Equal(t, held.InstanceID, after.InstanceID)
+	unlockSecond()
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+}
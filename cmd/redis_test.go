@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/test-go/testify/assert"
+)
+
+func TestReplayRedis(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{\"sourceExchange\":\"raydium\"}}\n{\"slot\":2,\"swap\":{\"sourceExchange\":\"pumpfun\"}}\n",
+		"pairs.json": "{\"slot\":3,\"pair\":{\"sourceExchange\":\"raydium\"}}\n",
+	})
+
+	task := NewReplayRedisTask()
+	task.replay.dataDir = dataDir
+	task.replay.rate = "0"
+	task.replay.concurrency = 4
+	task.redis.url = "redis://:secret@" + server.Addr() + "/2"
+	task.redis.key = "events:{type}:{exchange}"
+	task.redis.maxLen = 1000
+	assert.Nil(t, task.Execute(context.Background()))
+
+	assert.Equal(t, []string{"events:pair:raydium", "events:swap:pumpfun", "events:swap:raydium"}, server.DB(2).Keys())
+	for key, slot := range map[string]string{"events:swap:raydium": "1", "events:swap:pumpfun": "2", "events:pair:raydium": "3"} {
+		entries, err := server.DB(2).Stream(key)
+		assert.Nil(t, err)
+		assert.Len(t, entries, 1)
+		values := entries[0].Values
+		assert.Len(t, values, 4)
+		assert.Equal(t, "data", values[0])
+		assert.Contains(t, values[1], "\"slot\":"+slot)
+		assert.Equal(t, "id", values[2])
+	}
+}
+
+func TestRedisSinkTrims(t *testing.T) {
+	server := miniredis.RunT(t)
+	options := redisOptions{url: "redis://" + server.Addr(), key: "events", maxLen: 2}
+	sink, err := options.NewSink()
+	assert.Nil(t, err)
+	ctx := context.Background()
+	assert.Nil(t, sink.Open(ctx))
+	defer sink.Close()
+	for _, v := range []string{"1", "2", "3"} {
+		assert.Nil(t, sink.Publish(ctx, SinkMessage{Data: []byte(v)}))
+	}
+	entries, err := server.Stream("events")
+	assert.Nil(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, []string{"data", "3"}, entries[1].Values)
+}
+
+func TestRedisSinkAuthFails(t *testing.T) {
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+	options := redisOptions{url: "redis://:wrong@" + server.Addr(), key: "events"}
+	sink, err := options.NewSink()
+	assert.Nil(t, err)
+	err = sink.Open(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "WRONGPASS")
+}
@@ -3,12 +3,19 @@ package main
 import (
 	"archive/zip"
 	"bufio"
-	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/gagliardetto/solana-go"
 	"github.com/pkg/errors"
@@ -21,14 +28,59 @@ type ReduceTask struct {
 	amms           []solana.PublicKey
 	baseTokenMints []solana.PublicKey
 	wallets        []solana.PublicKey
-	params         struct {
+	signatures     map[string]struct{}
+	mintPattern    accountPattern
+	walletPattern  accountPattern
+	launchStages   []string
+	creators       []string
+	entitlement    entitlementOptions
+	anonymizer     *anonymizer
+	transform      transformOptions
+	plugin         wasmPluginOptions
+	datasets       datasetOptions
+	lock           dirLockOptions
+	trash          trashOptions
+	// rows written across all files
+	kept atomic.Uint64
+	// files the filters matched no rows in
+	emptyLock  sync.Mutex
+	emptyFiles []string
+	// files read and written by the run
+	inFiles  int
+	outFiles int
+	// names the outputs with --output-template, nil keeps the input names
+	outputTemplate *outputTemplate
+	// the input file of each output written, to catch templates which give
+	// two inputs the same name
+	outNamesLock sync.Mutex
+	outNames     map[string]string
+	params       struct {
 		amms           string
 		baseTokenMints string
 		wallets        string
+		signaturesFile string
+		mintPrefixes   string
+		mintSuffixes   string
+		mintRegex      string
+		walletPrefixes string
+		walletSuffixes string
+		walletRegex    string
+		launchStages   string
+		creators       string
+		anonymize      string
+		anonymizeSalt  string
 		paramsFile     string
 		dataInDir      string
 		dataOutDir     string
 		concurrency    int
+		fileWorkers    int
+		unordered      bool
+		compression    string
+		deflateWorkers int
+		skipEmpty      bool
+		inPlace        bool
+		deterministic  bool
+		outputTemplate string
 	}
 }
 
@@ -37,13 +89,38 @@ func NewReduceTask() *ReduceTask {
 }
 
 func (o *ReduceTask) SetupParameters(cmd *cobra.Command) {
+	o.entitlement.SetupParameters(cmd)
+	o.lock.SetupParameters(cmd)
+	o.trash.SetupParameters(cmd)
 	cmd.Flags().StringVarP(&o.params.amms, "amm", "a", "", "Include any events with these AMMs. (Comma separated list)")
 	cmd.Flags().StringVarP(&o.params.baseTokenMints, "baseTokenMint", "b", "", "Include any events with these mints. (Comma separated list)")
 	cmd.Flags().StringVarP(&o.params.wallets, "wallet", "w", "", "Include any events with this wallets. (Comma separated list)")
-	// cmd.Flags().StringVarP(&o.params.paramsFile, "params-file", "f", "", "JSON file with input params. See docs for format. Supply as many addresses as you want.")
+	cmd.Flags().StringVar(&o.params.signaturesFile, "signatures-file", "", "Include any events with the transaction signatures listed in this file (One signature per line)")
+	cmd.Flags().StringVar(&o.params.mintPrefixes, "mint-prefix", "", "Include any events where the base token mint starts with one of these strings. (Comma separated list)")
+	cmd.Flags().StringVar(&o.params.mintSuffixes, "mint-suffix", "", "Include any events where the base token mint ends with one of these strings e.g. pump. (Comma separated list)")
+	cmd.Flags().StringVar(&o.params.mintRegex, "mint-regex", "", "Include any events where the base token mint matches this regular expression")
+	cmd.Flags().StringVar(&o.params.walletPrefixes, "wallet-prefix", "", "Include any events where the wallet starts with one of these strings. (Comma separated list)")
+	cmd.Flags().StringVar(&o.params.walletSuffixes, "wallet-suffix", "", "Include any events where the wallet ends with one of these strings. (Comma separated list)")
+	cmd.Flags().StringVar(&o.params.walletRegex, "wallet-regex", "", "Include any events where the wallet matches this regular expression")
+	cmd.Flags().StringVar(&o.params.launchStages, "launch-stage", "", "Include any launchpad events in these stages: bonding, graduation, graduated. (Comma separated list)")
+	cmd.Flags().StringVar(&o.params.creators, "creator", "", "Include any launchpad events for tokens created by these wallets. (Comma separated list)")
+	cmd.Flags().StringVar(&o.params.anonymize, "anonymize", "", "Replace these values in the output with stable salted hashes: wallets, signatures. (Comma separated list)")
+	cmd.Flags().StringVar(&o.params.anonymizeSalt, "anonymize-salt", "", "The salt for --anonymize. Use the same salt to get the same hashes across runs. Random when not set")
+	o.transform.SetupParameters(cmd)
+	o.plugin.SetupParameters(cmd)
+	o.datasets.SetupParameters(cmd)
+	cmd.Flags().StringVarP(&o.params.paramsFile, "params-file", "f", "", "JSON file with input params keyed by flag name. See docs for format. Supply as many addresses as you want.")
 	cmd.Flags().StringVarP(&o.params.dataInDir, "in-data-dir", "i", "out", "The dir to get the data from for streaming")
 	cmd.Flags().StringVarP(&o.params.dataOutDir, "out-data-dir", "o", "out-reduced", "The dir to get the data from for streaming")
 	cmd.Flags().IntVarP(&o.params.concurrency, "concurrency", "c", 10, "How many files to process at once. Adjust this depending on your CPU and memory. Default is 10.")
+	cmd.Flags().IntVar(&o.params.fileWorkers, "file-workers", 1, "How many goroutines filter the rows of each file. Raise this for large files, e.g. with a low concurrency")
+	cmd.Flags().BoolVar(&o.params.unordered, "unordered", false, "With file-workers, write rows as they are filtered instead of in their original order. Faster but the output is no longer sorted by slot")
+	cmd.Flags().StringVar(&o.params.compression, "compression", CompressionDeflate, "How to compress the output archives: deflate or zstd-seekable. zstd-seekable lets simulate --from-slot jump to the middle of a file")
+	cmd.Flags().IntVar(&o.params.deflateWorkers, "deflate-workers", 1, "How many goroutines deflate each output file. Raise this for large files, e.g. with a low concurrency, when compressing is the bottleneck")
+	cmd.Flags().BoolVar(&o.params.skipEmpty, "skip-empty", false, "Do not write archives the filters matched no rows in")
+	cmd.Flags().BoolVar(&o.params.inPlace, "in-place", false, "Replace each archive in in-data-dir with its reduced copy instead of writing to out-data-dir. Pair with --trash-dir to keep the originals")
+	cmd.Flags().StringVar(&o.params.outputTemplate, "output-template", "", "How to name the output archives, e.g. \"{date}-{firstSlot}-{lastSlot}.{ext}\". Placeholders: {name} {date} {hour} {dataset} {firstSlot} {lastSlot} {ext}. Defaults to the input file name")
+	cmd.Flags().BoolVar(&o.params.deterministic, "deterministic", false, "Write byte identical archives for the same input and params whatever the concurrency or machine, so their hashes can be compared")
 }
 
 func (o *ReduceTask) GetMeta() Meta {
@@ -54,25 +131,22 @@ func (o *ReduceTask) GetMeta() Meta {
 	}
 }
 
-type EventRow struct {
-	Slot uint64 `json:"slot"`
-	Sig  string `json:"signature"`
-	Pair *struct {
-		AmmAccount string `json:"ammAccount"`
-		BaseToken  struct {
-			Account string `json:"account"`
-		}
-	} `json:"pair"`
-	Swap *struct {
-		AmmAccount    string `json:"ammAccount"`
-		BaseTokenMint string `json:"baseTokenMint"`
-		WalletAccount string `json:"walletAccount"`
-	} `json:"swap"`
-}
-
 func (o *ReduceTask) Execute(ctx context.Context) error {
 	err := o.processParams()
 	if err != nil {
+		return withKind(ErrUsage, err)
+	}
+	defer o.plugin.Close()
+	// not in processParams, download reduces from a dir inside its output
+	if err := o.checkDirs(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	unlock, err := o.lock.Lock(o.params.dataOutDir, "reduce")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	if err := o.trash.Purge(); err != nil {
 		return err
 	}
 
@@ -80,12 +154,58 @@ func (o *ReduceTask) Execute(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	o.inFiles = len(inFiles)
+	if err := o.entitlement.Verify(o.params.dataInDir, inFiles); err != nil {
+		return err
+	}
 
 	filterFunc, err := o.makeFilterFunc()
 	if err != nil {
 		return err
 	}
 
+	if o.params.dataOutDir == pipeName {
+		err = o.reduceToPipe(ctx, inFiles, filterFunc)
+	} else {
+		err = o.reduceFiles(ctx, inFiles, filterFunc)
+	}
+	if err != nil {
+		return err
+	}
+	if o.kept.Load() == 0 {
+		logrus.Warnf("0 matches: the filters matched no rows in any of the %d files. Check the filters are what you meant", len(inFiles))
+		return withKind(ErrNoRows, fmt.Errorf("the filters matched no rows in %d files", len(inFiles)))
+	}
+
+	if o.params.dataOutDir == pipeName {
+		logrus.Infof("Reduced %d files to %d rows on stdout, %d files with 0 matches", len(inFiles), o.kept.Load(), len(o.emptyFiles))
+		return nil
+	}
+	written := len(inFiles)
+	if o.params.skipEmpty {
+		written -= len(o.emptyFiles)
+	}
+	o.outFiles = written
+	logrus.Infof("Reduced %d files to %d rows, %d files with 0 matches. Wrote %d files to %s", len(inFiles), o.kept.Load(), len(o.emptyFiles), written, o.params.dataOutDir)
+
+	return nil
+}
+
+// Metrics returns the counters of the run for --push-metrics
+func (o *ReduceTask) Metrics() []Metric {
+	o.emptyLock.Lock()
+	empty := len(o.emptyFiles)
+	o.emptyLock.Unlock()
+	return []Metric{
+		{Name: "ss_cli_reduce_files_read", Help: "Archive files reduced", Value: float64(o.inFiles)},
+		{Name: "ss_cli_reduce_files_written", Help: "Reduced archive files written", Value: float64(o.outFiles)},
+		{Name: "ss_cli_reduce_files_empty", Help: "Archive files the filters matched no rows in", Value: float64(empty)},
+		{Name: "ss_cli_reduce_rows_kept", Help: "Rows the filters matched", Value: float64(o.kept.Load())},
+	}
+}
+
+// reduceFiles reduces each file into an archive in the out dir
+func (o *ReduceTask) reduceFiles(ctx context.Context, inFiles []string, filterFunc func(EventRow) bool) error {
 	sem := semaphore.NewWeighted(int64(o.params.concurrency))
 	errs := []error{}
 	for _, v := range inFiles {
@@ -111,148 +231,336 @@ func (o *ReduceTask) Execute(ctx context.Context) error {
 		for _, err := range errs {
 			logrus.Errorf("Error processing file: %s", err.Error())
 		}
-		return errors.New("errors occurred during processing")
+		// keeps the kind of the first failure for the exit code
+		return withKind(errs[0], errors.New("errors occurred during processing"))
 	}
+	return o.writeSummary()
+}
 
-	logrus.Infof("Reduced and copied %d files to %s", len(inFiles), o.params.dataOutDir)
+// reduceToPipe writes the kept rows of every file to stdout, for
+// --out-data-dir -. Files are read one at a time, with the files inside each
+// archive merged, so the rows stay in slot order.
+func (o *ReduceTask) reduceToPipe(ctx context.Context, inFiles []string, filterFunc func(EventRow) bool) error {
+	w := bufio.NewWriter(pipeOut)
+	for _, v := range inFiles {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		kept := uint64(0)
+		err := readArchiveRows(o.params.dataInDir+"/"+v, func(row []byte) error {
+			row, include, err := o.filterRow(row, filterFunc)
+			if err != nil || !include {
+				return err
+			}
+			kept++
+			w.Write(row)
+			return w.WriteByte('\n')
+		})
+		if err != nil {
+			return err
+		}
+		o.kept.Add(kept)
+		if kept == 0 {
+			o.emptyFiles = append(o.emptyFiles, v)
+			logrus.Infof("0 matches in %s", v)
+		}
+	}
+	return w.Flush()
+}
 
-	return nil
+// reduceSummaryFileName records the filters a reduced dir was made with
+const reduceSummaryFileName = ".ss-reduce.json"
+
+type ReduceSummary struct {
+	CLIVersion string            `json:"cli_version"`
+	CreatedAt  time.Time         `json:"created_at"`
+	InDataDir  string            `json:"in_data_dir"`
+	Filters    map[string]string `json:"filters"` // flag name to value
+	Matches    uint64            `json:"matches"`
+	// input files the filters matched no rows in
+	EmptyFiles []string `json:"empty_files,omitempty"`
 }
 
-func (o *ReduceTask) getDataFiles() ([]string, error) {
-	// loop through dir contents
-	files, err := os.ReadDir(o.params.dataInDir)
+// filterParams returns the filter params by flag name. These are the keys of
+// a params file.
+func (o *ReduceTask) filterParams() map[string]*string {
+	return map[string]*string{
+		"amm":             &o.params.amms,
+		"baseTokenMint":   &o.params.baseTokenMints,
+		"wallet":          &o.params.wallets,
+		"signatures-file": &o.params.signaturesFile,
+		"mint-prefix":     &o.params.mintPrefixes,
+		"mint-suffix":     &o.params.mintSuffixes,
+		"mint-regex":      &o.params.mintRegex,
+		"wallet-prefix":   &o.params.walletPrefixes,
+		"wallet-suffix":   &o.params.walletSuffixes,
+		"wallet-regex":    &o.params.walletRegex,
+		"launch-stage":    &o.params.launchStages,
+		"creator":         &o.params.creators,
+		"anonymize":       &o.params.anonymize,
+		"anonymize-salt":  &o.params.anonymizeSalt,
+		"transform":       &o.transform.expression,
+		"plugin":          &o.plugin.path,
+	}
+}
+
+// loadParamsFile sets the filter params from a JSON object keyed by flag name.
+// Values are a string or a list of strings e.g. {"mint-suffix": ["pump"]}
+func (o *ReduceTask) loadParamsFile(path string) error {
+	raw, err := os.ReadFile(path)
 	if err != nil {
-		return nil, err
+		return errors.Wrap(err, "cant read params file")
 	}
-	filtered := []string{}
-	for _, v := range files {
-		if v.IsDir() {
-			continue
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return errors.Wrap(err, "invalid params file")
+	}
+	params := o.filterParams()
+	for name, value := range values {
+		param, ok := params[name]
+		if !ok {
+			return fmt.Errorf("unknown param %q in params file", name)
 		}
-		// check extension
-		if len(v.Name()) < 4 || v.Name()[len(v.Name())-4:] != ".zip" {
-			continue
+		list := []string{}
+		if err := json.Unmarshal(value, &list); err != nil {
+			single := ""
+			if err := json.Unmarshal(value, &single); err != nil {
+				return fmt.Errorf("param %q in params file must be a string or a list of strings", name)
+			}
+			list = []string{single}
 		}
-		filtered = append(filtered, v.Name())
+		*param = strings.Join(list, ",")
 	}
-	// ensure they are ordered by date (oldest first)
-	return filtered, nil
+	return nil
 }
 
-func (o *ReduceTask) processFile(fileName string, filterFunc func(EventRow) bool) error {
-	logrus.Infof("Processing file %s", fileName)
-	r, err := zip.OpenReader(o.params.dataInDir + "/" + fileName)
+func (o *ReduceTask) writeSummary() error {
+	filters := map[string]string{}
+	for name, value := range o.filterParams() {
+		// the salt is left out as it would undo the anonymization
+		if *value != "" && name != "anonymize-salt" {
+			filters[name] = *value
+		}
+	}
+	emptyFiles := slices.Clone(o.emptyFiles)
+	sort.Strings(emptyFiles)
+	raw, err := json.MarshalIndent(ReduceSummary{
+		CLIVersion: version,
+		CreatedAt:  time.Now().UTC(),
+		InDataDir:  o.params.dataInDir,
+		Filters:    filters,
+		Matches:    o.kept.Load(),
+		EmptyFiles: emptyFiles,
+	}, "", "  ")
 	if err != nil {
 		return err
 	}
-	unzippedFiles := []string{}
+	os.MkdirAll(o.params.dataOutDir, 0755)
+	return os.WriteFile(o.params.dataOutDir+"/"+reduceSummaryFileName, raw, 0644)
+}
 
-	// Iterate through the files in the archive and unzip them
-	for _, f := range r.File {
-		rc, err := f.Open()
-		if err != nil {
-			return err
-		}
-		outFile, err := os.OpenFile(o.params.dataInDir+"/"+f.Name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
-		if err != nil {
-			return err
-		}
-		_, err = io.Copy(outFile, rc)
-		if err != nil {
-			return err
-		}
-		rc.Close()
-		outFile.Close()
-		unzippedFiles = append(unzippedFiles, f.Name)
+func (o *ReduceTask) getDataFiles() ([]string, error) {
+	files, err := listArchiveFiles(o.params.dataInDir)
+	if err != nil {
+		return nil, err
+	}
+	return o.datasets.Select(files), nil
+}
+
+func (o *ReduceTask) processFile(fileName string, filterFunc func(EventRow) bool) error {
+	logrus.Infof("Processing file %s", fileName)
+	r, closer, err := openArchive(o.params.dataInDir + "/" + fileName)
+	if err != nil {
+		return err
 	}
-	r.Close()
+	closeInput := sync.OnceValue(closer.Close)
+	defer closeInput()
 
 	// ensure outdir exists no err
 	os.MkdirAll(o.params.dataOutDir, 0755)
 
-	// unzipped all files, and filter rows into new file
-	filteredFiles := []string{}
-	for _, v := range unzippedFiles {
-		inFile, err := os.Open(o.params.dataInDir + "/" + v)
-		if err != nil {
-			return err
+	// written under a temp name and renamed when complete so an interrupted
+	// run never leaves a partial archive behind
+	outPath := o.params.dataOutDir + "/" + fileName
+	out, err := createArchive(outPath + ".partial")
+	if err != nil {
+		return err
+	}
+	kept := atomic.Uint64{}
+	err = o.writeFiltered(r, out, filterFunc, &kept)
+	// closed before the rename, which replaces it with --in-place
+	closeInput()
+	if err != nil {
+		out.Close()
+		os.Remove(outPath + ".partial")
+		return err
+	}
+	o.kept.Add(kept.Load())
+	if kept.Load() == 0 {
+		o.emptyLock.Lock()
+		o.emptyFiles = append(o.emptyFiles, fileName)
+		o.emptyLock.Unlock()
+		if o.params.skipEmpty {
+			logrus.Infof("0 matches in %s, not writing it", fileName)
+			return os.Remove(outPath + ".partial")
 		}
-
-		filteredFile := v
-		outFile, err := os.OpenFile(o.params.dataOutDir+"/"+filteredFile, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		logrus.Infof("0 matches in %s", fileName)
+	}
+	if o.outputTemplate != nil {
+		name, err := o.outputName(fileName, outPath+".partial")
 		if err != nil {
+			os.Remove(outPath + ".partial")
 			return err
 		}
-		filteredFiles = append(filteredFiles, filteredFile)
-
-		// foreach line in old file
-		scanner := bufio.NewScanner(inFile)
-		for scanner.Scan() {
-			row := scanner.Bytes()
-			eventRow := EventRow{}
-			err := json.Unmarshal(row, &eventRow)
-			if err != nil {
-				return errors.Wrap(err, "cant unmarshal event")
-			}
-			// include in new file
-			if filterFunc(eventRow) {
-				io.Copy(outFile, bytes.NewReader(append(row, '\n')))
-			}
-		}
-		if err := scanner.Err(); err != nil {
-			return err
-		}
-		inFile.Close()
-		outFile.Close()
+		return o.replace(outPath+".partial", o.params.dataOutDir+"/"+name)
 	}
+	return o.replace(outPath+".partial", outPath)
+}
 
-	// now compress new archive
-	f, err := os.OpenFile(o.params.dataOutDir+"/"+fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
-	if err != nil {
+// replace renames the written archive to path, moving any file already
+// there to --trash-dir
+func (o *ReduceTask) replace(written string, path string) error {
+	if err := o.trash.Preserve(path); err != nil {
 		return err
 	}
-	w := zip.NewWriter(f)
+	return os.Rename(written, path)
+}
 
-	for _, v := range filteredFiles {
-		aw, err := w.Create(v)
-		if err != nil {
-			return err
+// outputName names the output of fileName, written to path, with the output
+// template
+func (o *ReduceTask) outputName(fileName string, path string) (string, error) {
+	summary := ArchiveFileSummary{}
+	if o.outputTemplate.NeedsSlots() {
+		var err error
+		if summary, err = summarizeArchive(path); err != nil {
+			return "", errors.Wrapf(err, "cant read the slots of the reduced %s", fileName)
 		}
+	}
+	name, err := o.outputTemplate.Name(fileName, summary)
+	if err != nil {
+		return "", withKind(ErrUsage, err)
+	}
+	o.outNamesLock.Lock()
+	defer o.outNamesLock.Unlock()
+	if o.outNames == nil {
+		o.outNames = map[string]string{}
+	}
+	if other, ok := o.outNames[name]; ok {
+		return "", withKind(ErrUsage, fmt.Errorf("output-template names both %s and %s %s, add {name} or {hour} to it", other, fileName, name))
+	}
+	o.outNames[name] = fileName
+	return name, nil
+}
 
-		fr, err := os.Open(o.params.dataOutDir + "/" + v)
-		if err != nil {
+// writeFiltered filters each file in the archive straight into the new archive
+// so nothing is extracted to disk
+func (o *ReduceTask) writeFiltered(r *zip.Reader, out io.WriteCloser, filterFunc func(EventRow) bool, kept *atomic.Uint64) error {
+	w := zip.NewWriter(out)
+	// the blocks deflated in parallel do not depend on the number of workers,
+	// so deterministic archives always use them
+	if o.params.deflateWorkers > 1 || o.params.deterministic {
+		w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return newParallelDeflateWriter(out, max(1, o.params.deflateWorkers)), nil
+		})
+	}
+	for _, f := range r.File {
+		if err := o.filterEntry(f, w, filterFunc, kept); err != nil {
 			return err
 		}
-		io.Copy(aw, fr)
-		fr.Close()
 	}
-	err = w.Close()
+	if err := w.SetComment(reducedArchiveComment); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return out.Close()
+}
+
+func (o *ReduceTask) filterEntry(f *zip.File, w *zip.Writer, filterFunc func(EventRow) bool, kept *atomic.Uint64) error {
+	rc, err := f.Open()
 	if err != nil {
 		return err
 	}
-	f.Close()
+	defer rc.Close()
+	aw, err := createEntry(w, f.Name, o.params.compression)
+	if err != nil {
+		return err
+	}
+	if o.params.fileWorkers > 1 {
+		return o.filterRowsParallel(rc, aw, filterFunc, kept)
+	}
 
-	// remove all intermediate files
-	for _, v := range unzippedFiles {
-		err := os.Remove(o.params.dataInDir + "/" + v)
+	// foreach line in old file
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 64*1024), maxRowSize)
+	for scanner.Scan() {
+		row, include, err := o.filterRow(scanner.Bytes(), filterFunc)
 		if err != nil {
 			return err
 		}
-	}
-	for _, v := range filteredFiles {
-		err := os.Remove(o.params.dataOutDir + "/" + v)
-		if err != nil {
-			return err
+		// include in new file
+		if include {
+			kept.Add(1)
+			if _, err := aw.Write(append(row, '\n')); err != nil {
+				return err
+			}
 		}
 	}
+	return scanner.Err()
+}
 
-	return nil
+// filterRow returns the row as it should be written and whether to include it
+func (o *ReduceTask) filterRow(row []byte, filterFunc func(EventRow) bool) ([]byte, bool, error) {
+	eventRow := EventRow{}
+	err := unmarshalEvent(row, &eventRow)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "cant unmarshal event")
+	}
+	if !filterFunc(eventRow) {
+		return nil, false, nil
+	}
+	if o.anonymizer != nil {
+		row = o.anonymizer.Apply(eventRow, row)
+	}
+	// after anonymizing so plugins and transforms can not copy out the raw
+	// values
+	row, keep, err := o.plugin.Apply(row)
+	if err != nil || !keep {
+		return nil, false, err
+	}
+	return o.transform.Apply(row)
 }
 
 func (o *ReduceTask) makeFilterFunc() (func(EventRow) bool, error) {
+	// a plugin on its own sees every event
+	if o.plugin.plugin != nil && !o.hasFilters() {
+		return func(EventRow) bool { return true }, nil
+	}
 	// make filter function
 	filterFunc := func(row EventRow) bool {
+		// match patterns against the raw base58 strings first, no decoding needed
+		var rawMint, rawWallet string
+		if row.Pair != nil {
+			rawMint = row.Pair.BaseToken.Account
+		} else if row.Swap != nil {
+			rawMint = row.Swap.BaseTokenMint
+			rawWallet = row.Swap.WalletAccount
+		} else if row.Graduation != nil {
+			rawMint = row.Graduation.BaseTokenMint
+		}
+		if o.mintPattern.Match(rawMint) || o.walletPattern.Match(rawWallet) {
+			return true
+		}
+		if len(o.launchStages) != 0 || len(o.creators) != 0 {
+			if stage := row.LaunchStage(); stage != "" && inSlice(o.launchStages, stage) {
+				return true
+			}
+			if creator := row.Creator(); creator != "" && inSlice(o.creators, creator) {
+				return true
+			}
+		}
+
 		var amm, wallet, baseTokenMint solana.PublicKey
 		var err error
 		if row.Pair != nil {
@@ -277,6 +585,15 @@ func (o *ReduceTask) makeFilterFunc() (func(EventRow) bool, error) {
 			if err != nil {
 				logrus.Error(errors.Wrapf(err, "Error parsing WalletAccount (\"%s\") for swap", row.Swap.WalletAccount).Error())
 			}
+		} else if row.Graduation != nil {
+			amm, err = solana.PublicKeyFromBase58(row.Graduation.AmmAccount)
+			if err != nil {
+				logrus.Error(errors.Wrapf(err, "Error parsing AmmAccount (\"%s\") for graduation", row.Graduation.AmmAccount).Error())
+			}
+			baseTokenMint, err = solana.PublicKeyFromBase58(row.Graduation.BaseTokenMint)
+			if err != nil {
+				logrus.Error(errors.Wrapf(err, "Error parsing BaseTokenMint (\"%s\") for graduation", row.Graduation.BaseTokenMint).Error())
+			}
 		}
 
 		if len(o.amms) != 0 {
@@ -303,13 +620,120 @@ func (o *ReduceTask) makeFilterFunc() (func(EventRow) bool, error) {
 				}
 			}
 		}
+		if len(o.signatures) != 0 {
+			if _, ok := o.signatures[row.Sig]; ok {
+				return true
+			}
+		}
 
 		return false
 	}
 	return filterFunc, nil
 }
 
+// hasFilters returns whether any of the event filters are set
+func (o *ReduceTask) hasFilters() bool {
+	return len(o.amms) != 0 || len(o.baseTokenMints) != 0 || len(o.wallets) != 0 || len(o.signatures) != 0 ||
+		len(o.launchStages) != 0 || len(o.creators) != 0 || !o.mintPattern.Empty() || !o.walletPattern.Empty()
+}
+
+// checkDirs stops reduce writing into the dir it reads from, or a dir inside
+// or around it, unless --in-place asks to replace the input archives
+func (o *ReduceTask) checkDirs() error {
+	if o.params.inPlace {
+		if o.params.dataInDir == pipeName {
+			return errors.New("in-place can not be used with --in-data-dir -")
+		}
+		if o.params.skipEmpty || o.params.outputTemplate != "" {
+			// either would leave the unreduced archive next to its copy
+			return errors.New("in-place can not be combined with skip-empty or output-template")
+		}
+		o.params.dataOutDir = o.params.dataInDir
+		return nil
+	}
+	if o.params.dataInDir == pipeName || o.params.dataOutDir == pipeName {
+		return nil
+	}
+	in, err := resolveDir(o.params.dataInDir)
+	if err != nil {
+		return err
+	}
+	out, err := resolveDir(o.params.dataOutDir)
+	if err != nil {
+		return err
+	}
+	if in == out {
+		return fmt.Errorf("in-data-dir and out-data-dir are both %s, so the reduced archives would overwrite the input. Pass a different --out-data-dir, or --in-place to replace the input archives", o.params.dataInDir)
+	}
+	if isSubdir(in, out) || isSubdir(out, in) {
+		return fmt.Errorf("in-data-dir %s and out-data-dir %s are inside one another. Pass dirs next to each other, e.g. out and out-reduced", o.params.dataInDir, o.params.dataOutDir)
+	}
+	return nil
+}
+
+// resolveDir returns the absolute path of dir with symlinks resolved, as far
+// as it exists
+func resolveDir(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		// not created yet, resolve its parent
+		if parent := filepath.Dir(abs); os.IsNotExist(err) && parent != abs {
+			resolvedParent, err := resolveDir(parent)
+			return filepath.Join(resolvedParent, filepath.Base(abs)), err
+		}
+		return "", err
+	}
+	return resolved, nil
+}
+
+// isSubdir returns whether dir is inside parent, both resolved by resolveDir
+func isSubdir(parent string, dir string) bool {
+	rel, err := filepath.Rel(parent, dir)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
 func (o *ReduceTask) processParams() error {
+	if o.params.paramsFile != "" {
+		if err := o.loadParamsFile(o.params.paramsFile); err != nil {
+			return err
+		}
+	}
+
+	if err := validCompression(o.params.compression); err != nil {
+		return err
+	}
+	if err := o.trash.Validate(); err != nil {
+		return err
+	}
+	if err := o.datasets.Parse(); err != nil {
+		return err
+	}
+	if o.params.dataInDir == pipeName && o.params.dataOutDir != pipeName {
+		return errors.New("reading rows from stdin (--in-data-dir -) needs --out-data-dir - to write them to stdout")
+	}
+	if o.params.deflateWorkers > 1 && o.params.compression == CompressionZstdSeekable {
+		return errors.New("deflate-workers only applies to deflate compression")
+	}
+	if o.params.deterministic {
+		if err := o.validateDeterministic(); err != nil {
+			return err
+		}
+	}
+	if o.params.outputTemplate != "" {
+		if o.params.dataOutDir == pipeName {
+			return errors.New("output-template can not be used with --out-data-dir - as no files are written")
+		}
+		template, err := parseOutputTemplate(o.params.outputTemplate)
+		if err != nil {
+			return errors.Wrap(err, "invalid output-template")
+		}
+		o.outputTemplate = template
+	}
+
 	//amms
 	for _, v := range strings.Split(o.params.amms, ",") {
 		if v == "" {
@@ -333,5 +757,157 @@ func (o *ReduceTask) processParams() error {
 		o.wallets = append(o.wallets, solana.MustPublicKeyFromBase58(v))
 	}
 
+	// account patterns
+	var err error
+	o.mintPattern, err = newAccountPattern(o.params.mintPrefixes, o.params.mintSuffixes, o.params.mintRegex)
+	if err != nil {
+		return errors.Wrap(err, "invalid mint-regex")
+	}
+	o.walletPattern, err = newAccountPattern(o.params.walletPrefixes, o.params.walletSuffixes, o.params.walletRegex)
+	if err != nil {
+		return errors.Wrap(err, "invalid wallet-regex")
+	}
+
+	// launchpad
+	o.launchStages = splitList(o.params.launchStages)
+	for _, v := range o.launchStages {
+		if v != LaunchStageBonding && v != LaunchStageGraduation && v != LaunchStageGraduated {
+			return fmt.Errorf("unknown launch-stage %q, must be one of: %s, %s, %s", v, LaunchStageBonding, LaunchStageGraduation, LaunchStageGraduated)
+		}
+	}
+	o.creators = splitList(o.params.creators)
+
+	// transform
+	if err := o.transform.validate(); err != nil {
+		return err
+	}
+	if err := o.plugin.validate(); err != nil {
+		return err
+	}
+
+	// anonymize
+	if o.params.anonymize != "" {
+		o.anonymizer, err = newAnonymizer(splitList(o.params.anonymize), o.params.anonymizeSalt)
+		if err != nil {
+			return err
+		}
+		if o.params.anonymizeSalt == "" {
+			logrus.Infof("anonymizing with random salt %s, pass it with --anonymize-salt to get the same hashes next time", o.anonymizer.salt)
+		}
+	}
+
+	// signatures
+	if o.params.signaturesFile != "" {
+		signatures, err := readSignaturesFile(o.params.signaturesFile)
+		if err != nil {
+			return err
+		}
+		o.signatures = signatures
+		logrus.Infof("loaded %d signatures from %s", len(o.signatures), o.params.signaturesFile)
+	}
+
 	return nil
 }
+
+// validateDeterministic rejects the params which make the output differ
+// between runs
+func (o *ReduceTask) validateDeterministic() error {
+	if o.params.unordered {
+		return errors.New("deterministic output can not be unordered")
+	}
+	if o.params.anonymize != "" && o.params.anonymizeSalt == "" {
+		return errors.New("deterministic output needs --anonymize-salt, as the salt is random otherwise")
+	}
+	// a random IV stops the same archive being encrypted the same way twice
+	if archiveKey != nil {
+		return errors.New("encrypted archives can not be deterministic")
+	}
+	return nil
+}
+
+// accountPattern matches base58 account strings by prefix, suffix or regex
+type accountPattern struct {
+	prefixes []string
+	suffixes []string
+	regex    *regexp.Regexp
+}
+
+func newAccountPattern(prefixes, suffixes, regex string) (accountPattern, error) {
+	pattern := accountPattern{
+		prefixes: splitList(prefixes),
+		suffixes: splitList(suffixes),
+	}
+	if regex != "" {
+		re, err := regexp.Compile(regex)
+		if err != nil {
+			return pattern, err
+		}
+		pattern.regex = re
+	}
+	return pattern, nil
+}
+
+// Empty returns true if no patterns are configured
+func (p accountPattern) Empty() bool {
+	return len(p.prefixes) == 0 && len(p.suffixes) == 0 && p.regex == nil
+}
+
+// Match returns true if the account matches any of the configured patterns
+func (p accountPattern) Match(account string) bool {
+	if account == "" {
+		return false
+	}
+	for _, v := range p.prefixes {
+		if strings.HasPrefix(account, v) {
+			return true
+		}
+	}
+	for _, v := range p.suffixes {
+		if strings.HasSuffix(account, v) {
+			return true
+		}
+	}
+	return p.regex != nil && p.regex.MatchString(account)
+}
+
+// splitList splits a comma separated list dropping empty entries
+func splitList(list string) []string {
+	items := []string{}
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		items = append(items, v)
+	}
+	return items
+}
+
+// readSignaturesFile loads a set of transaction signatures from a file with one
+// signature per line. Blank lines and lines starting with # are ignored.
+// Anything else that is not a base58 signature is an error, so a mistyped
+// signature does not silently match nothing.
+func readSignaturesFile(fileName string) (map[string]struct{}, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrap(err, "cant open signatures file")
+	}
+	defer file.Close()
+
+	signatures := map[string]struct{}{}
+	scanner := bufio.NewScanner(file)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := solana.SignatureFromBase58(line); err != nil {
+			return nil, errors.Wrapf(err, "invalid signature on line %d of the signatures file", n)
+		}
+		signatures[line] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "cant read signatures file")
+	}
+	return signatures, nil
+}
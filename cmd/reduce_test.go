@@ -1,15 +1,460 @@
 package main
 
 import (
+	"archive/zip"
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+
+	"github.com/gagliardetto/solana-go"
+	"github.com/test-go/testify/assert"
 )
 
 func TestReduceTask(t *testing.T) {
 	task := NewReduceTask()
-	task.params.dataInDir = "../out"
-	task.params.dataOutDir = "../out-reduced"
+	task.params.dataInDir = copyFixtures(t)
+	task.params.dataOutDir = t.TempDir()
 	task.params.concurrency = 10
 	task.params.baseTokenMints = "F58xDnQ5JGCLmRM7vg5EfGrow4LuLv8M1e9UCGb8pump"
-	task.Execute(context.Background())
+	// an empty result is an error
+	task.params.wallets = fixtureKey("wallet-0", "")
+	err := task.Execute(context.Background())
+	assert.Nil(t, err)
+}
+
+func TestReduceEmptyMatches(t *testing.T) {
+	wallet := fixtureKey("wallet-a", "")
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"swap":{"walletAccount":"` + wallet + `"}}` + "\n",
+	})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": `{"slot":2,"swap":{}}` + "\n",
+	})
+	reduce := func(wallets string, skipEmpty bool) (*ReduceTask, error) {
+		task := NewReduceTask()
+		task.params.dataInDir = dataDir
+		task.params.dataOutDir = t.TempDir()
+		task.params.concurrency = 2
+		task.params.wallets = wallets
+		task.params.skipEmpty = skipEmpty
+		return task, task.Execute(context.Background())
+	}
+
+	task, err := reduce(wallet, false)
+	assert.Nil(t, err)
+	files, err := listArchiveFiles(task.params.dataOutDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20240505-120000.zip", "20240505-130000.zip"}, files)
+
+	task, err = reduce(wallet, true)
+	assert.Nil(t, err)
+	files, err = listArchiveFiles(task.params.dataOutDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20240505-120000.zip"}, files)
+	raw, err := os.ReadFile(task.params.dataOutDir + "/" + reduceSummaryFileName)
+	assert.Nil(t, err)
+	summary := ReduceSummary{}
+	assert.Nil(t, json.Unmarshal(raw, &summary))
+	assert.Equal(t, uint64(1), summary.Matches)
+	assert.Equal(t, []string{"20240505-130000.zip"}, summary.EmptyFiles)
+
+	// no matches at all exits with its own code
+	task, err = reduce(fixtureKey("wallet-b", ""), true)
+	assert.True(t, errors.Is(err, ErrNoRows))
+	assert.Equal(t, ExitNoRows, classifyError(err).Code)
+	files, err = listArchiveFiles(task.params.dataOutDir)
+	assert.Nil(t, err)
+	assert.Empty(t, files)
+}
+
+func TestAccountPattern(t *testing.T) {
+	pattern, err := newAccountPattern("Ab, F58", "pump", "^So1+")
+	assert.Nil(t, err)
+	assert.True(t, pattern.Match("F58xDnQ5JGCLmRM7vg5EfGrow4LuLv8M1e9UCGb8pump"))
+	assert.True(t, pattern.Match("AbcDnQ5JGCLmRM7vg5EfGrow4LuLv8M1e9UCGb8xxxx"))
+	assert.True(t, pattern.Match("So11111111111111111111111111111111111111112"))
+	assert.False(t, pattern.Match("7xDnQ5JGCLmRM7vg5EfGrow4LuLv8M1e9UCGb8bonk"))
+	assert.False(t, pattern.Match(""))
+
+	_, err = newAccountPattern("", "", "(")
+	assert.NotNil(t, err)
+}
+
+func TestReadSignaturesFile(t *testing.T) {
+	a, b := fixtureSignature("a"), fixtureSignature("b")
+	path := filepath.Join(t.TempDir(), "signatures.txt")
+	assert.Nil(t, os.WriteFile(path, []byte("# trades to investigate\n"+a+"\n\n  "+b+"  \n\t\n#"+fixtureSignature("c")+"\n"+a+"\n"), 0644))
+	signatures, err := readSignaturesFile(path)
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]struct{}{a: {}, b: {}}, signatures)
+
+	// the line of the first invalid signature is reported
+	for _, invalid := range []string{"not-base58!", "0OIl", fixtureKey("wallet", "")} {
+		assert.Nil(t, os.WriteFile(path, []byte(a+"\n\n"+invalid+"\n"), 0644))
+		_, err = readSignaturesFile(path)
+		if assert.NotNil(t, err, invalid) {
+			assert.True(t, strings.Contains(err.Error(), "line 3"), err.Error())
+		}
+	}
+
+	_, err = readSignaturesFile(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.NotNil(t, err)
+}
+
+func TestReduceAnonymize(t *testing.T) {
+	dataDir := copyFixtures(t)
+	reduce := func() []string {
+		task := NewReduceTask()
+		task.params.dataInDir = dataDir
+		task.params.dataOutDir = t.TempDir()
+		task.params.concurrency = 2
+		task.params.walletSuffixes = "1,2,3,4,5,6,7,8,9"
+		task.params.anonymize = "wallets,signatures"
+		task.params.anonymizeSalt = "test-salt"
+		assert.Nil(t, task.Execute(context.Background()))
+
+		rows := []string{}
+		files, err := listArchiveFiles(task.params.dataOutDir)
+		assert.Nil(t, err)
+		for _, v := range files {
+			assert.Nil(t, readArchiveRows(filepath.Join(task.params.dataOutDir, v), func(row []byte) error {
+				rows = append(rows, string(row))
+				return nil
+			}))
+		}
+		return rows
+	}
+
+	rows := reduce()
+	assert.NotEmpty(t, rows)
+	for _, row := range rows {
+		for i := 0; i < defaultFixtureConfig.wallets; i++ {
+			assert.NotContains(t, row, fixtureKey(fmt.Sprintf("wallet-%d", i), ""))
+		}
+		event := EventRow{}
+		assert.Nil(t, json.Unmarshal([]byte(row), &event))
+		_, err := solana.PublicKeyFromBase58(event.Swap.WalletAccount)
+		assert.Nil(t, err)
+	}
+	// the same salt gives the same pseudonyms
+	assert.Equal(t, rows, reduce())
+}
+
+func TestReduceParamsFile(t *testing.T) {
+	paramsFile := filepath.Join(t.TempDir(), "params.json")
+	assert.Nil(t, os.WriteFile(paramsFile, []byte(`{"mint-suffix": ["pump", "bonk"], "wallet-regex": "^A"}`), 0644))
+	task := NewReduceTask()
+	assert.Nil(t, task.loadParamsFile(paramsFile))
+	assert.Equal(t, "pump,bonk", task.params.mintSuffixes)
+	assert.Equal(t, "^A", task.params.walletRegex)
+
+	assert.Nil(t, os.WriteFile(paramsFile, []byte(`{"mints": ["x"]}`), 0644))
+	assert.NotNil(t, task.loadParamsFile(paramsFile))
+}
+
+func TestReduceFileWorkers(t *testing.T) {
+	wallets := []string{fixtureKey("wallet-a", ""), fixtureKey("wallet-b", "")}
+	amm := fixtureKey("amm", "")
+	mint := fixtureKey("mint", "")
+	rows := strings.Builder{}
+	// several batches with a partial one at the end
+	for i := 0; i < 3*reduceBatchSize+10; i++ {
+		fmt.Fprintf(&rows, `{"slot":%d,"swap":{"ammAccount":"%s","baseTokenMint":"%s","walletAccount":"%s"}}`+"\n", i, amm, mint, wallets[i%2])
+	}
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{"swaps.json": rows.String()})
+
+	reduce := func(fileWorkers int, unordered bool) []uint64 {
+		task := NewReduceTask()
+		task.params.dataInDir = dataDir
+		task.params.dataOutDir = t.TempDir()
+		task.params.concurrency = 1
+		task.params.fileWorkers = fileWorkers
+		task.params.unordered = unordered
+		task.params.wallets = wallets[1]
+		assert.Nil(t, task.Execute(context.Background()))
+		slots := []uint64{}
+		assert.Nil(t, readArchiveRows(task.params.dataOutDir+"/20240505-120000.zip", func(row []byte) error {
+			slots = append(slots, rowSlot(row))
+			return nil
+		}))
+		return slots
+	}
+
+	serial := reduce(1, false)
+	assert.Len(t, serial, (3*reduceBatchSize+10)/2)
+	assert.Equal(t, serial, reduce(4, false))
+	unordered := reduce(4, true)
+	slices.Sort(unordered)
+	assert.Equal(t, serial, unordered)
+}
+
+func TestReduceSeekableCompression(t *testing.T) {
+	wallet := fixtureKey("wallet", "")
+	rows := strings.Builder{}
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&rows, `{"slot":%d,"swap":{"walletAccount":"%s"}}`+"\n", i, wallet)
+	}
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{"swaps.json": rows.String()})
+
+	task := NewReduceTask()
+	task.params.dataInDir = dataDir
+	task.params.dataOutDir = t.TempDir()
+	task.params.concurrency = 1
+	task.params.fileWorkers = 1
+	task.params.compression = CompressionZstdSeekable
+	task.params.wallets = wallet
+	assert.Nil(t, task.Execute(context.Background()))
+
+	outPath := task.params.dataOutDir + "/20240505-120000.zip"
+	r, ra, closer, err := openArchiveAt(outPath)
+	assert.Nil(t, err)
+	defer closer.Close()
+	entry, err := openSeekableEntry(ra, r.File[0])
+	assert.Nil(t, err)
+	assert.NotNil(t, entry)
+	count := 0
+	assert.Nil(t, readArchiveRows(outPath, func(row []byte) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 100, count)
+
+	task.params.compression = "lz4"
+	assert.NotNil(t, task.Execute(context.Background()))
+}
+
+func TestReduceParallelDeflate(t *testing.T) {
+	defer func(size int) { parallelDeflateBlockSize = size }(parallelDeflateBlockSize)
+	parallelDeflateBlockSize = 4096
+
+	wallet := fixtureKey("wallet", "")
+	rows := strings.Builder{}
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&rows, `{"slot":%d,"swap":{"walletAccount":"%s","quoteAmount":"%d"}}`+"\n", i, wallet, i*i)
+	}
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{"swaps.json": rows.String()})
+
+	task := NewReduceTask()
+	task.params.dataInDir = dataDir
+	task.params.dataOutDir = t.TempDir()
+	task.params.concurrency = 1
+	task.params.fileWorkers = 1
+	task.params.deflateWorkers = 4
+	task.params.wallets = wallet
+	assert.Nil(t, task.Execute(context.Background()))
+
+	// the zip reader checks the crc of what it inflates
+	r, closer, err := openArchive(task.params.dataOutDir + "/20240505-120000.zip")
+	assert.Nil(t, err)
+	defer closer.Close()
+	assert.Equal(t, zip.Deflate, r.File[0].Method)
+	rc, err := r.File[0].Open()
+	assert.Nil(t, err)
+	raw, err := io.ReadAll(rc)
+	assert.Nil(t, err)
+	assert.Equal(t, rows.String(), string(raw))
+	// blocks share a window so it compresses about as well as one stream
+	assert.True(t, r.File[0].CompressedSize64 < r.File[0].UncompressedSize64/4)
+
+	task.params.compression = CompressionZstdSeekable
+	assert.NotNil(t, task.Execute(context.Background()))
+}
+
+func TestReduceDeterministic(t *testing.T) {
+	defer func(size int) { parallelDeflateBlockSize = size }(parallelDeflateBlockSize)
+	parallelDeflateBlockSize = 4096
+
+	wallet := fixtureKey("wallet", "")
+	rows := strings.Builder{}
+	for i := 0; i < 2000; i++ {
+		fmt.Fprintf(&rows, `{"slot":%d,"swap":{"walletAccount":"%s","quoteAmount":"%d"}}`+"\n", i, wallet, i*i)
+	}
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{"swaps.json": rows.String()})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{"swaps.json": rows.String(), "pairs.json": ""})
+
+	digests := func(concurrency int, fileWorkers int, deflateWorkers int, compression string) map[string]string {
+		task := NewReduceTask()
+		task.params.dataInDir = dataDir
+		task.params.dataOutDir = t.TempDir()
+		task.params.concurrency = concurrency
+		task.params.fileWorkers = fileWorkers
+		task.params.deflateWorkers = deflateWorkers
+		task.params.compression = compression
+		task.params.wallets = wallet
+		task.params.deterministic = true
+		assert.Nil(t, task.Execute(context.Background()))
+		hashes := map[string]string{}
+		for _, v := range []string{"20240505-120000.zip", "20240505-130000.zip"} {
+			hash, err := fileSHA256(filepath.Join(task.params.dataOutDir, v))
+			assert.Nil(t, err)
+			hashes[v] = hash
+		}
+		return hashes
+	}
+
+	expected := digests(1, 1, 1, CompressionDeflate)
+	assert.Equal(t, expected, digests(1, 1, 1, CompressionDeflate))
+	assert.Equal(t, expected, digests(2, 4, 3, CompressionDeflate))
+	assert.NotEqual(t, expected, digests(1, 1, 1, CompressionZstdSeekable))
+	assert.Equal(t, digests(1, 1, 1, CompressionZstdSeekable), digests(2, 4, 1, CompressionZstdSeekable))
+
+	task := NewReduceTask()
+	task.params.dataInDir = dataDir
+	task.params.dataOutDir = t.TempDir()
+	task.params.deterministic = true
+	task.params.unordered = true
+	assert.True(t, errors.Is(task.Execute(context.Background()), ErrUsage))
+}
+
+func TestReduceOutputTemplate(t *testing.T) {
+	wallet := fixtureKey("wallet", "")
+	swap := func(slot int) string {
+		return fmt.Sprintf(`{"slot":%d,"swap":{"walletAccount":"%s"}}`+"\n", slot, wallet)
+	}
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json":  swap(12) + swap(15),
+		"swaps2.json": swap(10),
+	})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": swap(20),
+	})
+	reduce := func(template string) (*ReduceTask, error) {
+		task := NewReduceTask()
+		task.params.dataInDir = dataDir
+		task.params.dataOutDir = t.TempDir()
+		task.params.concurrency = 2
+		task.params.wallets = wallet
+		task.params.outputTemplate = template
+		return task, task.Execute(context.Background())
+	}
+
+	task, err := reduce("{date}-{firstSlot}-{lastSlot}.{ext}")
+	assert.Nil(t, err)
+	files, err := listArchiveFiles(task.params.dataOutDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"2024-05-05-10-15.zip", "2024-05-05-20-20.zip"}, files)
+	rows := 0
+	assert.Nil(t, readArchiveRows(task.params.dataOutDir+"/2024-05-05-10-15.zip", func(row []byte) error {
+		rows++
+		return nil
+	}))
+	assert.Equal(t, 3, rows)
+
+	task, err = reduce("swaps-{date}T{hour}.zip")
+	assert.Nil(t, err)
+	files, err = listArchiveFiles(task.params.dataOutDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"swaps-2024-05-05T12.zip", "swaps-2024-05-05T13.zip"}, files)
+
+	// two inputs can not be written to the same file
+	task, err = reduce("{date}.zip")
+	assert.True(t, errors.Is(err, ErrUsage))
+	_, err = reduce("{date}-{mint}.zip")
+	assert.True(t, errors.Is(err, ErrUsage))
+}
+
+func TestReduceSameDirs(t *testing.T) {
+	wallet := fixtureKey("wallet-a", "")
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"swap":{"walletAccount":"` + wallet + `"}}` + "\n" + `{"slot":2,"swap":{}}` + "\n",
+	})
+	reduce := func(outDir string, inPlace bool) error {
+		task := NewReduceTask()
+		task.params.dataInDir = dataDir
+		task.params.dataOutDir = outDir
+		task.params.concurrency = 1
+		task.params.wallets = wallet
+		task.params.inPlace = inPlace
+		return task.Execute(context.Background())
+	}
+
+	for _, v := range []string{dataDir, dataDir + "/./", dataDir + "/reduced", filepath.Dir(dataDir)} {
+		err := reduce(v, false)
+		assert.NotNil(t, err, v)
+		assert.Equal(t, ExitUsage, classifyError(err).Code)
+	}
+	link := t.TempDir() + "/link"
+	assert.Nil(t, os.Symlink(dataDir, link))
+	assert.NotNil(t, reduce(link, false))
+
+	// the input is replaced with its reduced copy
+	assert.Nil(t, reduce("out-reduced", true))
+	files, err := listArchiveFiles(dataDir)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20240505-120000.zip"}, files)
+	rows := 0
+	assert.Nil(t, readArchiveRows(dataDir+"/20240505-120000.zip", func(row []byte) error {
+		rows++
+		return nil
+	}))
+	assert.Equal(t, 1, rows)
+	_, err = os.Stat("out-reduced")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestReduceLaunchpadFilters(t *testing.T) {
+	creator := func(name string) string { return fixtureKey("creator-"+name, "") }
+	mint := fixtureKey("mint", "pump")
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"swap":{"baseTokenMint":"` + mint + `","launchpad":{"name":"pumpfun","creator":"` + creator("a") + `"}}}
+{"slot":2,"swap":{"baseTokenMint":"` + mint + `","launchpad":{"name":"pumpfun","creator":"` + creator("b") + `","graduated":true}}}
+{"slot":3,"swap":{"baseTokenMint":"` + mint + `"}}
+`,
+		"pairs.json": `{"slot":4,"pair":{"baseToken":{"account":"` + mint + `"},"launchpad":{"name":"pumpfun","creator":"` + creator("c") + `"}}}
+`,
+		"graduations.json": `{"slot":5,"graduation":{"baseTokenMint":"` + mint + `","creator":"` + creator("b") + `"}}
+`,
+	})
+
+	for _, test := range []struct {
+		launchStages string
+		creators     string
+		slots        []int
+	}{
+		{launchStages: LaunchStageBonding, slots: []int{1, 4}},
+		{launchStages: LaunchStageGraduation + "," + LaunchStageGraduated, slots: []int{2, 5}},
+		{creators: creator("b"), slots: []int{2, 5}},
+		// either filter includes an event
+		{launchStages: LaunchStageGraduation, creators: creator("a") + "," + creator("c"), slots: []int{1, 4, 5}},
+	} {
+		task := NewReduceTask()
+		task.params.dataInDir = dataDir
+		task.params.dataOutDir = t.TempDir()
+		task.params.concurrency = 1
+		task.params.launchStages = test.launchStages
+		task.params.creators = test.creators
+		assert.Nil(t, task.Execute(context.Background()))
+		slots := []int{}
+		assert.Nil(t, readArchiveRows(task.params.dataOutDir+"/20240505-120000.zip", func(row []byte) error {
+			event := EventRow{}
+			assert.Nil(t, json.Unmarshal(row, &event))
+			slots = append(slots, int(event.Slot))
+			return nil
+		}))
+		slices.Sort(slots)
+		assert.Equal(t, test.slots, slots, test.launchStages+" "+test.creators)
+	}
+
+	task := NewReduceTask()
+	task.params.dataInDir = dataDir
+	task.params.dataOutDir = t.TempDir()
+	task.params.launchStages = "presale"
+	err := task.Execute(context.Background())
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "unknown launch-stage")
 }
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// reduceBatchSize is how many rows each file worker filters at a time
+const reduceBatchSize = 1024
+
+type reduceBatch struct {
+	rows [][]byte
+	out  []byte
+	err  error
+	// closed once out and err are set
+	filtered chan struct{}
+}
+
+// filterRowsParallel is the row loop of filterEntry spread over
+// --file-workers goroutines. Rows are read in batches and written in their
+// original order unless --unordered is set.
+func (o *ReduceTask) filterRowsParallel(r io.Reader, w io.Writer, filterFunc func(EventRow) bool, kept *atomic.Uint64) error {
+	done := make(chan struct{})
+	defer close(done)
+
+	batches := make(chan *reduceBatch, o.params.fileWorkers)
+	// batches in read order, for ordered output
+	ordered := make(chan *reduceBatch, o.params.fileWorkers*2)
+	// batches as they are filtered, for unordered output
+	unordered := make(chan *reduceBatch, o.params.fileWorkers)
+
+	var readErr error
+	go func() {
+		defer close(batches)
+		defer close(ordered)
+		send := func(batch *reduceBatch) bool {
+			if !o.params.unordered {
+				select {
+				case ordered <- batch:
+				case <-done:
+					return false
+				}
+			}
+			select {
+			case batches <- batch:
+				return true
+			case <-done:
+				return false
+			}
+		}
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), maxRowSize)
+		batch := &reduceBatch{filtered: make(chan struct{})}
+		for scanner.Scan() {
+			batch.rows = append(batch.rows, bytes.Clone(scanner.Bytes()))
+			if len(batch.rows) == reduceBatchSize {
+				if !send(batch) {
+					return
+				}
+				batch = &reduceBatch{filtered: make(chan struct{})}
+			}
+		}
+		readErr = scanner.Err()
+		if len(batch.rows) != 0 {
+			send(batch)
+		}
+	}()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < o.params.fileWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				batch.out, batch.err = o.filterBatch(batch.rows, filterFunc, kept)
+				batch.rows = nil
+				close(batch.filtered)
+				if o.params.unordered {
+					select {
+					case unordered <- batch:
+					case <-done:
+						return
+					}
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(unordered)
+	}()
+
+	write := func(batch *reduceBatch) error {
+		if batch.err != nil {
+			return batch.err
+		}
+		_, err := w.Write(batch.out)
+		return err
+	}
+	if o.params.unordered {
+		for batch := range unordered {
+			if err := write(batch); err != nil {
+				return err
+			}
+		}
+	} else {
+		for batch := range ordered {
+			<-batch.filtered
+			if err := write(batch); err != nil {
+				return err
+			}
+		}
+	}
+	return readErr
+}
+
+// filterBatch returns the included rows of the batch, one per line
+func (o *ReduceTask) filterBatch(rows [][]byte, filterFunc func(EventRow) bool, kept *atomic.Uint64) ([]byte, error) {
+	out := bytes.Buffer{}
+	for _, v := range rows {
+		row, include, err := o.filterRow(v, filterFunc)
+		if err != nil {
+			return nil, err
+		}
+		if include {
+			kept.Add(1)
+			out.Write(row)
+			out.WriteByte('\n')
+		}
+	}
+	return out.Bytes(), nil
+}
@@ -0,0 +1,358 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"golang.org/x/sync/errgroup"
+)
+
+// how often --state-file is saved while replaying
+const replayStateInterval = time.Second
+
+// stops reading rows once --limit-events have been sent
+var errReplayLimit = errors.New("replay limit reached")
+
+// replayOptions are the flags shared by the replay commands
+type replayOptions struct {
+	dataDir     string
+	rate        string
+	concurrency int
+	limitEvents uint
+	stateFile   string
+	encoding    string
+	transform   transformOptions
+	plugin      wasmPluginOptions
+	schema      schemaOptions
+	// between events, 0 means as fast as possible
+	interval time.Duration
+}
+
+func (o *replayOptions) SetupParameters(cmd *cobra.Command, concurrency int) {
+	cmd.Flags().StringVarP(&o.dataDir, "data-dir", "d", "out", "The dir containing the archive files to replay")
+	cmd.Flags().StringVar(&o.rate, "rate", "0", "The most events to send e.g. 200/s or 1000/m. 0 means as fast as the destination accepts them")
+	cmd.Flags().IntVarP(&o.concurrency, "concurrency", "c", concurrency, "How many events to have in flight at once. Use 1 to deliver events strictly in order")
+	cmd.Flags().UintVar(&o.limitEvents, "limit-events", 0, "Stop after this many events. 0 means no limit")
+	cmd.Flags().StringVar(&o.stateFile, "state-file", "", "Save the position delivered up to in this file and resume from it when run again")
+	cmd.Flags().StringVar(&o.encoding, "encoding", EncodingJSON, "How to encode each event: json, or proto for the Event message of events.proto")
+	o.transform.SetupParameters(cmd)
+	o.plugin.SetupParameters(cmd)
+	o.schema.SetupParameters(cmd)
+}
+
+func (o *replayOptions) validate() error {
+	if o.concurrency < 1 {
+		return errors.New("concurrency must be at least 1")
+	}
+	interval, err := parseRate(o.rate)
+	if err != nil {
+		return err
+	}
+	o.interval = interval
+	switch o.encoding {
+	case EncodingJSON, EncodingProto, "":
+	default:
+		return fmt.Errorf("unknown encoding %q, must be one of: %s, %s", o.encoding, EncodingJSON, EncodingProto)
+	}
+	if err := o.transform.validate(); err != nil {
+		return err
+	}
+	return o.plugin.validate()
+}
+
+// parseRate parses a rate such as 200/s or 1000/m into the interval between
+// events. A plain number is per second and 0 means no limit.
+func parseRate(rate string) (time.Duration, error) {
+	count, unit, _ := strings.Cut(rate, "/")
+	n, err := strconv.ParseFloat(count, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid rate %q, use e.g. 200/s or 1000/m", rate)
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	per := time.Second
+	switch unit {
+	case "", "s":
+	case "m":
+		per = time.Minute
+	case "h":
+		per = time.Hour
+	default:
+		return 0, fmt.Errorf("invalid rate %q, use e.g. 200/s or 1000/m", rate)
+	}
+	return time.Duration(float64(per) / n), nil
+}
+
+// replayPosition is how far a replay has been delivered. Every event before
+// it has been accepted by the destination.
+type replayPosition struct {
+	File string `json:"file"`
+	// rows of File delivered
+	Row uint64 `json:"row"`
+	// events delivered across all runs
+	Events uint64 `json:"events"`
+}
+
+type replayRow struct {
+	seq      uint64
+	file     string
+	row      uint64
+	data     []byte
+	position replayPosition
+}
+
+// Replay opens the sink and sends it the rows of the archive files in slot
+// order, resuming from --state-file. The first event the sink fails to
+// deliver stops the replay. Returns how many events were delivered.
+func (o *replayOptions) Replay(ctx context.Context, sink Sink, name string) (uint64, error) {
+	files, err := listArchiveFiles(o.dataDir)
+	if err != nil {
+		return 0, err
+	}
+	if len(files) == 0 {
+		return 0, fmt.Errorf("no archive files found in %s", o.dataDir)
+	}
+	if err := o.schema.Check(o.dataDir); err != nil {
+		return 0, err
+	}
+	start, err := o.loadState()
+	if err != nil {
+		return 0, err
+	}
+	if start.File != "" {
+		i := slices.Index(files, start.File)
+		if i == -1 {
+			return 0, fmt.Errorf("%s in the state file is not in %s", start.File, o.dataDir)
+		}
+		files = files[i:]
+		logrus.Infof("resuming from row %d of %s after %d events", start.Row, start.File, start.Events)
+	}
+	metered := newMeteredSink(sink, name)
+	defer metered.Close()
+	if err := metered.Open(ctx); err != nil {
+		return 0, err
+	}
+	defer metered.Report()
+
+	tracker := newReplayTracker(start)
+	group, ctx := errgroup.WithContext(ctx)
+	rows := make(chan replayRow, o.concurrency)
+	group.Go(func() error {
+		defer close(rows)
+		return o.readRows(ctx, files, start, rows)
+	})
+	for i := 0; i < o.concurrency; i++ {
+		group.Go(func() error {
+			for v := range rows {
+				msg := SinkMessage{ID: fmt.Sprintf("%s:%d", v.file, v.row)}
+				// templates use the event as it was archived
+				if err := unmarshalEvent(v.data, &msg.Event); err != nil {
+					return errors.Wrapf(err, "cant unmarshal row %d of %s", v.row, v.file)
+				}
+				data, keep, err := o.plugin.Apply(v.data)
+				if err == nil && keep {
+					data, keep, err = o.transform.Apply(data)
+				}
+				if err != nil {
+					return errors.Wrapf(err, "row %d of %s", v.row, v.file)
+				}
+				if !keep {
+					tracker.Done(v.seq, v.position)
+					continue
+				}
+				msg.Data = data
+				if o.encoding == EncodingProto {
+					if msg.Data, err = o.encodeProto(data, msg.Event); err != nil {
+						return errors.Wrapf(err, "row %d of %s", v.row, v.file)
+					}
+					msg.ContentType = ContentTypeProto
+				}
+				if err := metered.Publish(ctx, msg); err != nil {
+					return errors.Wrapf(err, "cant deliver row %d of %s", v.row, v.file)
+				}
+				tracker.Done(v.seq, v.position)
+			}
+			return nil
+		})
+	}
+
+	stopSaving := make(chan struct{})
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		ticker := time.NewTicker(replayStateInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				o.saveState(tracker)
+			case <-stopSaving:
+				return
+			}
+		}
+	}()
+	err = group.Wait()
+	close(stopSaving)
+	<-saved
+	o.saveState(tracker)
+	return tracker.Position().Events - start.Events, err
+}
+
+// encodeProto encodes the event for --encoding proto. An event changed by a
+// transform or plugin is parsed again so the changes to fields of the schema
+// are kept.
+func (o *replayOptions) encodeProto(data []byte, event EventRow) ([]byte, error) {
+	if o.transform.transform != nil || o.plugin.plugin != nil {
+		event = EventRow{}
+		if err := unmarshalEvent(data, &event); err != nil {
+			return nil, errors.Wrap(err, "cant encode the transformed event as proto")
+		}
+	}
+	raw, err := marshalEventProto(event)
+	return raw, errors.Wrap(err, "cant encode the event as proto")
+}
+
+// readRows sends the rows from start on, paced by --rate
+func (o *replayOptions) readRows(ctx context.Context, files []string, start replayPosition, rows chan<- replayRow) error {
+	began := time.Now()
+	sent := uint64(0)
+	for i, file := range files {
+		logrus.Infof("replaying file (%d of %d) %s", i+1, len(files), file)
+		row := uint64(0)
+		err := readArchiveRows(filepath.Join(o.dataDir, file), func(data []byte) error {
+			row++
+			if file == start.File && row <= start.Row {
+				return nil
+			}
+			if o.limitEvents != 0 && sent == uint64(o.limitEvents) {
+				return errReplayLimit
+			}
+			if o.interval != 0 {
+				// paced from the start so slow periods are caught up on
+				wait := time.Until(began.Add(time.Duration(sent) * o.interval))
+				if wait > 0 {
+					select {
+					case <-time.After(wait):
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				}
+			}
+			next := replayRow{
+				seq:      sent,
+				file:     file,
+				row:      row - 1,
+				data:     bytes.Clone(data),
+				position: replayPosition{File: file, Row: row, Events: start.Events + sent + 1},
+			}
+			select {
+			case rows <- next:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+			sent++
+			return nil
+		})
+		if err == errReplayLimit {
+			logrus.Infof("event limit reached")
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *replayOptions) loadState() (replayPosition, error) {
+	position := replayPosition{}
+	if o.stateFile == "" {
+		return position, nil
+	}
+	raw, err := os.ReadFile(o.stateFile)
+	if os.IsNotExist(err) {
+		return position, nil
+	}
+	if err != nil {
+		return position, errors.Wrap(err, "cant read state file")
+	}
+	if err := json.Unmarshal(raw, &position); err != nil {
+		return position, errors.Wrap(err, "invalid state file")
+	}
+	return position, nil
+}
+
+func (o *replayOptions) saveState(tracker *replayTracker) {
+	if o.stateFile == "" || !tracker.Changed() {
+		return
+	}
+	raw, err := json.Marshal(tracker.Position())
+	if err != nil {
+		return
+	}
+	// replaced in one step so a crash never leaves a partial file
+	if err := os.WriteFile(o.stateFile+".tmp", raw, 0644); err == nil {
+		err = os.Rename(o.stateFile+".tmp", o.stateFile)
+	}
+	if err != nil {
+		logrus.Warnf("cant save the replay state: %s", err)
+	}
+}
+
+// replayTracker keeps the position every event before has been delivered
+// up to, as concurrent deliveries finish out of order
+type replayTracker struct {
+	mu       sync.Mutex
+	next     uint64
+	done     map[uint64]replayPosition
+	position replayPosition
+	changed  bool
+}
+
+func newReplayTracker(start replayPosition) *replayTracker {
+	return &replayTracker{done: map[uint64]replayPosition{}, position: start}
+}
+
+func (o *replayTracker) Done(seq uint64, position replayPosition) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.done[seq] = position
+	for {
+		position, ok := o.done[o.next]
+		if !ok {
+			return
+		}
+		delete(o.done, o.next)
+		o.position = position
+		o.changed = true
+		o.next++
+	}
+}
+
+func (o *replayTracker) Position() replayPosition {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.position
+}
+
+// Changed reports whether the position moved since the last call
+func (o *replayTracker) Changed() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	changed := o.changed
+	o.changed = false
+	return changed
+}
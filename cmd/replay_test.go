@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestParseRate(t *testing.T) {
+	for rate, expected := range map[string]time.Duration{
+		"0":      0,
+		"200/s":  5 * time.Millisecond,
+		"10":     100 * time.Millisecond,
+		"60/m":   time.Second,
+		"0.5/s":  2 * time.Second,
+		"3600/h": time.Second,
+	} {
+		interval, err := parseRate(rate)
+		assert.Nil(t, err, rate)
+		assert.Equal(t, expected, interval, rate)
+	}
+	for _, v := range []string{"fast", "10/d", "-1/s"} {
+		_, err := parseRate(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+// memorySink keeps what it is sent and fails once after failAfter events
+type memorySink struct {
+	mu        sync.Mutex
+	messages  []SinkMessage
+	failAfter int
+}
+
+func (o *memorySink) Open(ctx context.Context) error {
+	return nil
+}
+
+func (o *memorySink) Publish(ctx context.Context, msg SinkMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.failAfter != 0 && len(o.messages) == o.failAfter {
+		o.failAfter = 0
+		return errors.New("unavailable")
+	}
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+func (o *memorySink) Close() error {
+	return nil
+}
+
+func TestReplayResumes(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n{\"slot\":2,\"swap\":{}}\n{\"slot\":3,\"swap\":{}}\n",
+	})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": "{\"slot\":4,\"swap\":{}}\n{\"slot\":5,\"swap\":{}}\n",
+	})
+	replay := replayOptions{
+		dataDir:     dataDir,
+		rate:        "0",
+		concurrency: 1,
+		stateFile:   t.TempDir() + "/state.json",
+	}
+	assert.Nil(t, replay.validate())
+
+	sink := &memorySink{failAfter: 4}
+	delivered, err := replay.Replay(context.Background(), sink, "memory")
+	assert.NotNil(t, err)
+	assert.Equal(t, uint64(4), delivered)
+	position, err := replay.loadState()
+	assert.Nil(t, err)
+	assert.Equal(t, replayPosition{File: "20240505-130000.zip", Row: 1, Events: 4}, position)
+
+	delivered, err = replay.Replay(context.Background(), sink, "memory")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(1), delivered)
+	slots := []uint64{}
+	for _, v := range sink.messages {
+		slots = append(slots, v.Event.Slot)
+	}
+	assert.Equal(t, []uint64{1, 2, 3, 4, 5}, slots)
+	assert.Equal(t, "20240505-120000.zip:0", sink.messages[0].ID)
+	assert.Equal(t, "20240505-130000.zip:1", sink.messages[4].ID)
+
+	// nothing left to replay
+	delivered, err = replay.Replay(context.Background(), sink, "memory")
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), delivered)
+	assert.Len(t, sink.messages, 5)
+}
+
+func TestReplayTrackerOutOfOrder(t *testing.T) {
+	tracker := newReplayTracker(replayPosition{})
+	position := func(n uint64) replayPosition {
+		return replayPosition{File: "a.zip", Row: n + 1, Events: n + 1}
+	}
+	tracker.Done(1, position(1))
+	tracker.Done(2, position(2))
+	assert.False(t, tracker.Changed())
+	assert.Equal(t, replayPosition{}, tracker.Position())
+	tracker.Done(0, position(0))
+	assert.True(t, tracker.Changed())
+	assert.Equal(t, position(2), tracker.Position())
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type ReplayExecTask struct {
+	replay replayOptions
+	exec   execSinkOptions
+}
+
+func NewReplayExecTask() *ReplayExecTask {
+	return &ReplayExecTask{}
+}
+
+func (o *ReplayExecTask) SetupParameters(cmd *cobra.Command) {
+	o.replay.SetupParameters(cmd, 4)
+	o.exec.SetupParameters(cmd)
+}
+
+func (o *ReplayExecTask) GetMeta() Meta {
+	return Meta{
+		Name:        "ReplayExecTask",
+		Use:         "exec",
+		Description: "Publish archive events in slot order with a command, for destinations written in any language. Each event is piped to the command, which replies once it is published. With --state-file a replay resumes from the last published event.",
+	}
+}
+
+func (o *ReplayExecTask) Execute(ctx context.Context) error {
+	if err := o.replay.validate(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	if o.exec.command == "" {
+		return withKind(ErrUsage, errors.New("sink-exec must be specified"))
+	}
+	if o.replay.encoding == EncodingProto {
+		return withKind(ErrUsage, errors.New("sink-exec commands are sent JSON lines, encoding proto is not supported"))
+	}
+
+	start := time.Now()
+	published, err := o.replay.Replay(ctx, o.exec.NewSink(), "exec")
+	logrus.Infof("published %d events with the sink-exec command in %s", published, time.Since(start).Round(time.Millisecond))
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type ReplayNatsTask struct {
+	replay replayOptions
+	nats   natsOptions
+}
+
+func NewReplayNatsTask() *ReplayNatsTask {
+	return &ReplayNatsTask{}
+}
+
+func (o *ReplayNatsTask) SetupParameters(cmd *cobra.Command) {
+	o.replay.SetupParameters(cmd, 64)
+	o.nats.SetupParameters(cmd, nats.DefaultURL)
+}
+
+func (o *ReplayNatsTask) GetMeta() Meta {
+	return Meta{
+		Name:        "ReplayNatsTask",
+		Use:         "nats",
+		Description: "Publish archive events to NATS JetStream in slot order, waiting for each to be acknowledged. With --state-file a replay resumes from the last acknowledged event.",
+	}
+}
+
+func (o *ReplayNatsTask) Execute(ctx context.Context) error {
+	if err := o.replay.validate(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	sink, err := o.nats.NewSink()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	published, err := o.replay.Replay(ctx, sink, "NATS")
+	logrus.Infof("published %d events to %s in %s", published, o.nats.url, time.Since(start).Round(time.Millisecond))
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type ReplayPluginTask struct {
+	replay replayOptions
+	plugin pluginSinkOptions
+}
+
+func NewReplayPluginTask() *ReplayPluginTask {
+	return &ReplayPluginTask{}
+}
+
+func (o *ReplayPluginTask) SetupParameters(cmd *cobra.Command) {
+	o.replay.SetupParameters(cmd, 4)
+	o.plugin.SetupParameters(cmd)
+}
+
+func (o *ReplayPluginTask) GetMeta() Meta {
+	return Meta{
+		Name:        "ReplayPluginTask",
+		Use:         "plugin",
+		Description: "Publish archive events in slot order with a Go plugin, for proprietary destinations without forking the CLI. With --state-file a replay resumes from the last published event.",
+	}
+}
+
+func (o *ReplayPluginTask) Execute(ctx context.Context) error {
+	if err := o.replay.validate(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	if o.plugin.path == "" {
+		return withKind(ErrUsage, errors.New("sink-plugin must be specified"))
+	}
+
+	start := time.Now()
+	published, err := o.replay.Replay(ctx, o.plugin.NewSink(), "plugin")
+	logrus.Infof("published %d events with the sink plugin in %s", published, time.Since(start).Round(time.Millisecond))
+	return err
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type ReplayRedisTask struct {
+	replay replayOptions
+	redis  redisOptions
+}
+
+func NewReplayRedisTask() *ReplayRedisTask {
+	return &ReplayRedisTask{}
+}
+
+func (o *ReplayRedisTask) SetupParameters(cmd *cobra.Command) {
+	o.replay.SetupParameters(cmd, 64)
+	o.redis.SetupParameters(cmd, "redis://localhost:6379")
+}
+
+func (o *ReplayRedisTask) GetMeta() Meta {
+	return Meta{
+		Name:        "ReplayRedisTask",
+		Use:         "redis",
+		Description: "Add archive events to Redis Streams in slot order with XADD, trimming each stream to --redis-maxlen, so lightweight consumers and dashboards can read them. With --state-file a replay resumes from the last added event.",
+	}
+}
+
+func (o *ReplayRedisTask) Execute(ctx context.Context) error {
+	if err := o.replay.validate(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	sink, err := o.redis.NewSink()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	added, err := o.replay.Replay(ctx, sink, "Redis")
+	logrus.Infof("added %d events to Redis in %s", added, time.Since(start).Round(time.Millisecond))
+	return err
+}
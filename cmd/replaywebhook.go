@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// the longest wait between retries of a failed post
+const maxRetryDelay = 30 * time.Second
+
+type ReplayWebhookTask struct {
+	http   httpOptions
+	replay replayOptions
+	sink   webhookSink
+	params struct {
+		url     string
+		retries int
+		timeout time.Duration
+		headers []string
+	}
+}
+
+func NewReplayWebhookTask() *ReplayWebhookTask {
+	return &ReplayWebhookTask{}
+}
+
+func (o *ReplayWebhookTask) SetupParameters(cmd *cobra.Command) {
+	o.http.SetupParameters(cmd)
+	o.replay.SetupParameters(cmd, 4)
+	cmd.Flags().StringVar(&o.params.url, "url", "", "The endpoint to POST each event to, as JSON unless --encoding proto")
+	cmd.Flags().IntVar(&o.params.retries, "retries", 5, "How many times to retry a post that fails with a network error, 429 or 5xx before stopping")
+	cmd.Flags().DurationVar(&o.params.timeout, "timeout", 10*time.Second, "The timeout of each post")
+	cmd.Flags().StringArrayVarP(&o.params.headers, "header", "H", nil, "A header to send with each post e.g. \"Authorization: Bearer xyz\". Can be repeated")
+}
+
+func (o *ReplayWebhookTask) GetMeta() Meta {
+	return Meta{
+		Name:        "ReplayWebhookTask",
+		Use:         "webhook",
+		Description: "POST archive events as JSON to an HTTP endpoint in slot order, with retries and rate and concurrency control, for HTTP based ingestion.",
+	}
+}
+
+func (o *ReplayWebhookTask) Execute(ctx context.Context) error {
+	if err := o.validateParams(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	transport, err := o.http.NewTransport()
+	if err != nil {
+		return err
+	}
+	o.sink.client.Transport = transport
+	o.sink.client.Timeout = o.params.timeout
+
+	start := time.Now()
+	posted, err := o.replay.Replay(ctx, &o.sink, "webhook")
+	logrus.Infof("posted %d events to %s in %s", posted, o.params.url, time.Since(start).Round(time.Millisecond))
+	return err
+}
+
+func (o *ReplayWebhookTask) validateParams() error {
+	if err := o.replay.validate(); err != nil {
+		return err
+	}
+	if o.params.url == "" {
+		return errors.New("url must be specified")
+	}
+	if !strings.HasPrefix(o.params.url, "http://") && !strings.HasPrefix(o.params.url, "https://") {
+		return errors.New("url must be an http(s) URL")
+	}
+	if o.params.retries < 0 {
+		return errors.New("retries can not be negative")
+	}
+	o.sink.url = o.params.url
+	o.sink.retries = o.params.retries
+	o.sink.headers = http.Header{}
+	for _, v := range o.params.headers {
+		name, value, ok := strings.Cut(v, ":")
+		if !ok {
+			return fmt.Errorf("header %q must be in the form \"Name: value\"", v)
+		}
+		o.sink.headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return nil
+}
+
+// webhookSink POSTs each event as the body
+type webhookSink struct {
+	client  http.Client
+	url     string
+	headers http.Header
+	retries int
+}
+
+// Publish posts the event, retrying failures which may be temporary
+func (o *webhookSink) Publish(ctx context.Context, msg SinkMessage) error {
+	var err error
+	for attempt := 0; attempt <= o.retries; attempt++ {
+		if attempt > 0 {
+			delay := min(500*time.Millisecond<<(attempt-1), maxRetryDelay)
+			logrus.Debugf("retrying post in %s: %s", delay, err)
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		var retry bool
+		retry, err = o.post(ctx, msg)
+		if err == nil || !retry || ctx.Err() != nil {
+			return err
+		}
+	}
+	return errors.Wrapf(err, "post failed after %d retries", o.retries)
+}
+
+func (o *webhookSink) Open(ctx context.Context) error {
+	return nil
+}
+
+func (o *webhookSink) Close() error {
+	return nil
+}
+
+// post sends the event once and reports whether a failure is worth retrying
+func (o *webhookSink) post(ctx context.Context, msg SinkMessage) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, o.url, bytes.NewReader(msg.Data))
+	if err != nil {
+		return false, err
+	}
+	for name, values := range o.headers {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", msg.DataContentType())
+	if msg.ID != "" {
+		// lets the endpoint drop events retried or resent after a resume
+		req.Header.Set("Idempotency-Key", msg.ID)
+	}
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+	retry := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+}
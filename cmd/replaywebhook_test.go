@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestReplayWebhook(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"pairs.json": "{\"slot\":2,\"pair\":{}}\n",
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n{\"slot\":3,\"swap\":{}}\n",
+	})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": "{\"slot\":4,\"swap\":{}}\n",
+	})
+
+	mu := sync.Mutex{}
+	received := []string{}
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer xyz", r.Header.Get("Authorization"))
+		// the second post fails once and is retried
+		if requests == 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.NotEmpty(t, r.Header.Get("Idempotency-Key"))
+		raw, _ := io.ReadAll(r.Body)
+		received = append(received, string(raw))
+	}))
+	defer server.Close()
+
+	task := NewReplayWebhookTask()
+	task.replay.dataDir = dataDir
+	task.params.url = server.URL
+	task.replay.rate = "100/s"
+	task.replay.concurrency = 1
+	task.params.retries = 2
+	task.params.timeout = time.Second
+	task.params.headers = []string{"Authorization: Bearer xyz"}
+	assert.Nil(t, task.Execute(context.Background()))
+	assert.Equal(t, []string{
+		`{"slot":1,"swap":{}}`,
+		`{"slot":2,"pair":{}}`,
+		`{"slot":3,"swap":{}}`,
+		`{"slot":4,"swap":{}}`,
+	}, received)
+
+	task = NewReplayWebhookTask()
+	task.replay.dataDir = dataDir
+	task.params.url = server.URL
+	task.replay.rate = "0"
+	task.replay.concurrency = 2
+	task.params.timeout = time.Second
+	task.params.headers = []string{"Authorization: Bearer xyz"}
+	task.replay.limitEvents = 2
+	assert.Nil(t, task.Execute(context.Background()))
+	assert.Len(t, received, 6)
+}
+
+func TestReplayWebhookGivesUp(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n",
+	})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	task := NewReplayWebhookTask()
+	task.replay.dataDir = dataDir
+	task.params.url = server.URL
+	task.replay.rate = "0"
+	task.replay.concurrency = 1
+	task.params.retries = 3
+	task.params.timeout = time.Second
+	start := time.Now()
+	// a 400 is not retried
+	assert.NotNil(t, task.Execute(context.Background()))
+	assert.True(t, time.Since(start) < 400*time.Millisecond)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+const (
+	ReportFormatCSV   = "csv"
+	ReportFormatJSON  = "json"
+	ReportFormatArrow = "arrow"
+)
+
+// recordWriter writes report rows as either CSV (with a header row),
+// newline delimited JSON objects with the header as keys or an Arrow IPC
+// stream
+type recordWriter struct {
+	format string
+	header []string
+	csv    *csv.Writer
+	arrow  *arrowWriter
+	out    io.Writer
+	// with --layout hive, the rows are written to the partitions instead
+	partitions *hivePartitions
+}
+
+func newRecordWriter(out io.Writer, format string, header []string) (*recordWriter, error) {
+	w := &recordWriter{
+		format: format,
+		header: header,
+		out:    out,
+	}
+	switch format {
+	case ReportFormatCSV:
+		w.csv = csv.NewWriter(out)
+		if err := w.csv.Write(header); err != nil {
+			return nil, err
+		}
+	case ReportFormatJSON:
+	case ReportFormatArrow:
+		w.arrow = newArrowWriter(out, header)
+	default:
+		return nil, checkReportFormat(format)
+	}
+	return w, nil
+}
+
+func checkReportFormat(format string) error {
+	if format != ReportFormatCSV && format != ReportFormatJSON && format != ReportFormatArrow {
+		return fmt.Errorf("unknown format %q, must be one of: %s, %s, %s", format, ReportFormatCSV, ReportFormatJSON, ReportFormatArrow)
+	}
+	return nil
+}
+
+// Write writes a single record. values must be in the same order as the header.
+func (w *recordWriter) Write(values ...any) error {
+	if w.partitions != nil {
+		return w.partitions.Write(values...)
+	}
+	if len(values) != len(w.header) {
+		return fmt.Errorf("record has %d values, expected %d", len(values), len(w.header))
+	}
+	if w.csv != nil {
+		row := make([]string, len(values))
+		for i, v := range values {
+			row[i] = formatValue(v)
+		}
+		return w.csv.Write(row)
+	}
+	if w.arrow != nil {
+		return w.arrow.Write(values)
+	}
+
+	// build the object by hand to keep the header order
+	buf := bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, v := range values {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(w.header[i])
+		buf.Write(key)
+		buf.WriteByte(':')
+		raw, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		buf.Write(raw)
+	}
+	buf.WriteString("}\n")
+	_, err := w.out.Write(buf.Bytes())
+	return err
+}
+
+func (w *recordWriter) Flush() error {
+	if w.partitions != nil {
+		return w.partitions.Flush()
+	}
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	if w.arrow != nil {
+		return w.arrow.Flush()
+	}
+	return nil
+}
+
+func formatValue(v any) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// openOutput returns a writer for the output file or stdout if fileName is
+// empty or "-"
+func openOutput(fileName string) (io.WriteCloser, error) {
+	if fileName == "" || fileName == "-" {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return budgetWriter{f, diskUsage}, nil
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	CompressNone = "none"
+	CompressZstd = "zstd"
+
+	FsyncNone   = "none"
+	FsyncRotate = "rotate"
+	FsyncAlways = "always"
+)
+
+// rotatedFileTimeFormat is the start time added to the names of rotated files
+const rotatedFileTimeFormat = "20060102T150405Z"
+
+// fileSinkOptions are the flags of the rotating NDJSON file sink
+type fileSinkOptions struct {
+	path           string
+	rotateSize     string
+	rotateInterval time.Duration
+	compress       string
+	fsync          string
+}
+
+func (o *fileSinkOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.path, "output", "o", "", "A file to write events to, one JSON event per line, instead of stdout")
+	cmd.Flags().StringVar(&o.rotateSize, "rotate-size", "", "Start a new output file once it is this large e.g. 500MB. The finished file is renamed with the time it was started")
+	cmd.Flags().DurationVar(&o.rotateInterval, "rotate-interval", 0, "Start a new output file once it has been written for this long e.g. 1h")
+	cmd.Flags().StringVar(&o.compress, "compress", CompressNone, "Compress output files: none or zstd")
+	cmd.Flags().StringVar(&o.fsync, "fsync", FsyncRotate, "When output files are synced to disk: 'rotate' when a file is finished, 'always' after every event or 'none' to leave it to the OS")
+}
+
+func (o *fileSinkOptions) NewSink() (*fileSink, error) {
+	sink := &fileSink{path: o.path, rotateInterval: o.rotateInterval, compress: o.compress, fsync: o.fsync}
+	if o.rotateSize != "" {
+		size, err := parseByteSize(o.rotateSize)
+		if err != nil {
+			return nil, withKind(ErrUsage, errors.Wrap(err, "invalid rotate-size"))
+		}
+		sink.rotateSize = size
+	}
+	if o.compress != CompressNone && o.compress != CompressZstd {
+		return nil, withKind(ErrUsage, fmt.Errorf("compress must be '%s' or '%s'", CompressNone, CompressZstd))
+	}
+	if o.fsync != FsyncNone && o.fsync != FsyncRotate && o.fsync != FsyncAlways {
+		return nil, withKind(ErrUsage, fmt.Errorf("fsync must be '%s', '%s' or '%s'", FsyncNone, FsyncRotate, FsyncAlways))
+	}
+	if o.compress == CompressZstd && !strings.HasSuffix(sink.path, ".zst") {
+		sink.path += ".zst"
+	}
+	return sink, nil
+}
+
+// fileSink writes events to a file, rotating it by size or age. The current
+// file is always at path so it can be followed, finished files are renamed
+// next to it with the time they were started e.g. events-20240505T120000Z.ndjson
+type fileSink struct {
+	path           string
+	rotateSize     int64
+	rotateInterval time.Duration
+	compress       string
+	fsync          string
+
+	mu      sync.Mutex
+	file    *os.File
+	zw      *zstd.Encoder
+	w       io.Writer
+	size    int64
+	started time.Time
+}
+
+func (o *fileSink) Open(ctx context.Context) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if err := os.MkdirAll(filepath.Dir(o.path), 0755); err != nil {
+		return err
+	}
+	// a file left by a previous run is finished first so it is not appended to
+	if info, err := os.Stat(o.path); err == nil {
+		if err := o.rename(info.ModTime()); err != nil {
+			return err
+		}
+	}
+	return o.create()
+}
+
+func (o *fileSink) create() error {
+	f, err := os.OpenFile(o.path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return errors.Wrap(err, "cant create output file")
+	}
+	o.file = f
+	o.size = 0
+	o.started = time.Now()
+	o.w = countingWriter{budgetWriter{f, diskUsage}, &o.size}
+	if o.compress == CompressZstd {
+		o.zw, err = zstd.NewWriter(o.w)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		o.w = o.zw
+	}
+	return nil
+}
+
+func (o *fileSink) Publish(ctx context.Context, msg SinkMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.file == nil {
+		return errors.New("output file is closed")
+	}
+	if (o.rotateSize > 0 && o.size >= o.rotateSize) || (o.rotateInterval > 0 && time.Since(o.started) >= o.rotateInterval) {
+		if err := o.finish(); err != nil {
+			return err
+		}
+		if err := o.create(); err != nil {
+			return err
+		}
+	}
+	if _, err := o.w.Write(append(msg.Data, '\n')); err != nil {
+		return errors.Wrap(err, "cant write to output file")
+	}
+	if o.fsync == FsyncAlways {
+		return o.sync()
+	}
+	return nil
+}
+
+// sync flushes the compressor and the file to disk
+func (o *fileSink) sync() error {
+	if o.zw != nil {
+		if err := o.zw.Flush(); err != nil {
+			return err
+		}
+	}
+	return o.file.Sync()
+}
+
+// finish closes the current file and renames it with its start time
+func (o *fileSink) finish() error {
+	if o.zw != nil {
+		if err := o.zw.Close(); err != nil {
+			o.file.Close()
+			return errors.Wrap(err, "cant write to output file")
+		}
+		o.zw = nil
+	}
+	if o.fsync != FsyncNone {
+		if err := o.file.Sync(); err != nil {
+			o.file.Close()
+			return err
+		}
+	}
+	err := o.file.Close()
+	o.file = nil
+	if err != nil {
+		return err
+	}
+	return o.rename(o.started)
+}
+
+// rename moves the file at path to its finished name, which it is never
+// written to again
+func (o *fileSink) rename(started time.Time) error {
+	dir, name := filepath.Split(o.path)
+	base, ext, _ := strings.Cut(name, ".")
+	if ext != "" {
+		ext = "." + ext
+	}
+	stamp := started.UTC().Format(rotatedFileTimeFormat)
+	finished := filepath.Join(dir, base+"-"+stamp+ext)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(finished); os.IsNotExist(err) {
+			break
+		}
+		finished = filepath.Join(dir, fmt.Sprintf("%s-%s-%d%s", base, stamp, i, ext))
+	}
+	if err := os.Rename(o.path, finished); err != nil {
+		return errors.Wrap(err, "cant rotate output file")
+	}
+	logrus.Infof("finished output file %s", finished)
+	if o.fsync != FsyncNone {
+		// the rename is only durable once the dir is synced
+		if d, err := os.Open(filepath.Clean(dir + "/.")); err == nil {
+			d.Sync()
+			d.Close()
+		}
+	}
+	return nil
+}
+
+func (o *fileSink) Close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.file == nil {
+		return nil
+	}
+	return o.finish()
+}
+
+// countingWriter adds the bytes written to n
+type countingWriter struct {
+	io.Writer
+	n *int64
+}
+
+func (o countingWriter) Write(p []byte) (int, error) {
+	n, err := o.Writer.Write(p)
+	*o.n += int64(n)
+	return n, err
+}
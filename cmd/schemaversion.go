@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var ErrSchemaVersion = errors.New("archive schema version not supported")
+
+// checkSchemaVersion returns an error naming the ss-cli release to upgrade to
+// when the manifest's archives are a newer schema version than this CLI reads
+func checkSchemaVersion(manifest DatasetManifest) error {
+	if manifest.SchemaVersion <= archiveSchemaVersion {
+		return nil
+	}
+	required := manifest.MinCLIVersion
+	if required == "" {
+		// written before manifests recorded it, the release which wrote it
+		// reads it
+		required = manifest.CLIVersion
+	}
+	return withKind(ErrSchemaVersion, fmt.Errorf("the archives are schema version %d but ss-cli %s only reads up to version %d. Upgrade to ss-cli %s or newer", manifest.SchemaVersion, version, archiveSchemaVersion, required))
+}
+
+// loadDirManifest reads the dataset manifest unpack or split-dataset left in
+// dir, nil when there is none
+func loadDirManifest(dir string) (*DatasetManifest, error) {
+	for _, name := range []string{datasetManifestFileName, datasetManifestName} {
+		raw, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifest := DatasetManifest{}
+		if err := json.Unmarshal(raw, &manifest); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s in %s", name, dir)
+		}
+		return &manifest, nil
+	}
+	return nil, nil
+}
+
+// schemaOptions checks a data dir holds archives of a schema version this CLI
+// reads before replaying it, so newer archives are not replayed with fields
+// missing or misread
+type schemaOptions struct {
+	allowNewer bool
+}
+
+func (o *schemaOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&o.allowNewer, "allow-newer-schema", false, "Replay archives of a newer schema version than this ss-cli reads anyway, with a warning. Fields added since are dropped or passed through unchecked")
+}
+
+// Check returns an error when the manifest in dir is a newer schema version
+// than this CLI reads. Dirs without a manifest are not checked.
+func (o *schemaOptions) Check(dir string) error {
+	if dir == pipeName {
+		return nil
+	}
+	manifest, err := loadDirManifest(dir)
+	if err != nil || manifest == nil {
+		return err
+	}
+	err = checkSchemaVersion(*manifest)
+	if err == nil || !o.allowNewer {
+		return err
+	}
+	logrus.Warnf("%s. Replaying anyway as --allow-newer-schema is set, events may be missing fields added since", err)
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/test-go/testify/assert"
+)
+
+func TestReplaySchemaVersion(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n",
+	})
+	writeManifest := func(manifest DatasetManifest) {
+		raw, err := json.Marshal(manifest)
+		assert.Nil(t, err)
+		assert.Nil(t, os.WriteFile(filepath.Join(dataDir, datasetManifestFileName), raw, 0644))
+	}
+	received := atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received.Add(1)
+	}))
+	defer server.Close()
+	replay := func(allowNewer bool) error {
+		task := NewReplayWebhookTask()
+		task.replay.dataDir = dataDir
+		task.replay.rate = "0"
+		task.replay.concurrency = 1
+		task.replay.schema.allowNewer = allowNewer
+		task.params.url = server.URL
+		task.params.timeout = time.Second
+		return task.Execute(context.Background())
+	}
+
+	writeManifest(DatasetManifest{Format: datasetFormat, SchemaVersion: archiveSchemaVersion, CLIVersion: "v1.0.0"})
+	assert.Nil(t, replay(false))
+	assert.Equal(t, int32(1), received.Load())
+
+	writeManifest(DatasetManifest{Format: datasetFormat, SchemaVersion: archiveSchemaVersion + 1, CLIVersion: "v3.1.0", MinCLIVersion: "v3.0.0"})
+	err := replay(false)
+	assert.True(t, errors.Is(err, ErrSchemaVersion))
+	assert.Equal(t, ExitSchemaVersion, classifyError(err).Code)
+	assert.Contains(t, err.Error(), "Upgrade to ss-cli v3.0.0 or newer")
+	assert.Equal(t, int32(1), received.Load())
+
+	// manifests without the minimum name the release which wrote them
+	writeManifest(DatasetManifest{Format: datasetFormat, SchemaVersion: archiveSchemaVersion + 1, CLIVersion: "v3.1.0"})
+	assert.Contains(t, replay(false).Error(), "Upgrade to ss-cli v3.1.0 or newer")
+
+	assert.Nil(t, replay(true))
+	assert.Equal(t, int32(2), received.Load())
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+)
+
+const (
+	CompressionDeflate      = "deflate"
+	CompressionZstdSeekable = "zstd-seekable"
+)
+
+// Archive entries can be written in the zstd seekable format: independent
+// zstd frames, each holding whole rows, followed by a skippable frame with an
+// index of the frames. Any zstd decoder can read the entry as normal and the
+// index lets readers start at any frame without decompressing those before it.
+// See https://github.com/facebook/zstd/blob/dev/contrib/seekable_format/zstd_seekable_compression_format.md
+const (
+	seekTableSkippableMagic = 0x184D2A5E
+	seekableMagic           = 0x8F92EAB1
+	seekTableFooterSize     = 9
+	seekTableEntrySize      = 8
+)
+
+// seekableFrameSize is the uncompressed size at which a new frame is started
+var seekableFrameSize = 1 << 20
+
+func init() {
+	// so zstd entries can be read by every command
+	zip.RegisterDecompressor(zstd.ZipMethodWinZip, zstd.ZipDecompressor())
+}
+
+func validCompression(compression string) error {
+	switch compression {
+	case "", CompressionDeflate, CompressionZstdSeekable:
+		return nil
+	default:
+		return fmt.Errorf("compression must be '%s' or '%s'", CompressionDeflate, CompressionZstdSeekable)
+	}
+}
+
+// createEntry adds a file to the archive with the compression
+func createEntry(w *zip.Writer, name string, compression string) (io.Writer, error) {
+	return createEntryLevel(w, name, compression, 0)
+}
+
+// createEntryLevel adds a file to the archive with the compression at level,
+// 1-9 for deflate and 1-22 for zstd. 0 is the default level.
+func createEntryLevel(w *zip.Writer, name string, compression string, level int) (io.Writer, error) {
+	if compression != CompressionZstdSeekable {
+		if level == 0 {
+			return w.Create(name)
+		}
+		w.RegisterCompressor(zip.Deflate, func(out io.Writer) (io.WriteCloser, error) {
+			return flate.NewWriter(out, level)
+		})
+		return w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate})
+	}
+	opts := []zstd.EOption{}
+	if level != 0 {
+		opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+	}
+	w.RegisterCompressor(zstd.ZipMethodWinZip, func(out io.Writer) (io.WriteCloser, error) {
+		return newSeekableWriter(out, opts...)
+	})
+	return w.CreateHeader(&zip.FileHeader{Name: name, Method: zstd.ZipMethodWinZip})
+}
+
+// entryMethod is the zip method entries are compressed with
+func entryMethod(compression string) uint16 {
+	if compression == CompressionZstdSeekable {
+		return zstd.ZipMethodWinZip
+	}
+	return zip.Deflate
+}
+
+type seekFrame struct {
+	compressed   uint32
+	decompressed uint32
+}
+
+// seekableWriter compresses rows into frames, cutting frames at line ends
+type seekableWriter struct {
+	out    io.Writer
+	enc    *zstd.Encoder
+	buf    []byte
+	frames []seekFrame
+}
+
+func newSeekableWriter(out io.Writer, opts ...zstd.EOption) (*seekableWriter, error) {
+	enc, err := zstd.NewWriter(nil, append([]zstd.EOption{zstd.WithEncoderConcurrency(1)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &seekableWriter{out: out, enc: enc}, nil
+}
+
+func (o *seekableWriter) Write(p []byte) (int, error) {
+	o.buf = append(o.buf, p...)
+	for len(o.buf) >= seekableFrameSize {
+		end := bytes.LastIndexByte(o.buf[:seekableFrameSize], '\n') + 1
+		if end == 0 {
+			// a single row larger than a frame
+			end = bytes.IndexByte(o.buf, '\n') + 1
+			if end == 0 {
+				break
+			}
+		}
+		if err := o.writeFrame(o.buf[:end]); err != nil {
+			return 0, err
+		}
+		o.buf = append(o.buf[:0], o.buf[end:]...)
+	}
+	return len(p), nil
+}
+
+func (o *seekableWriter) writeFrame(data []byte) error {
+	frame := o.enc.EncodeAll(data, nil)
+	if _, err := o.out.Write(frame); err != nil {
+		return err
+	}
+	o.frames = append(o.frames, seekFrame{compressed: uint32(len(frame)), decompressed: uint32(len(data))})
+	return nil
+}
+
+// Close writes the last frame and the seek table
+func (o *seekableWriter) Close() error {
+	if len(o.buf) != 0 {
+		if err := o.writeFrame(o.buf); err != nil {
+			return err
+		}
+		o.buf = nil
+	}
+	table := binary.LittleEndian.AppendUint32(nil, seekTableSkippableMagic)
+	table = binary.LittleEndian.AppendUint32(table, uint32(len(o.frames)*seekTableEntrySize+seekTableFooterSize))
+	for _, v := range o.frames {
+		table = binary.LittleEndian.AppendUint32(table, v.compressed)
+		table = binary.LittleEndian.AppendUint32(table, v.decompressed)
+	}
+	table = binary.LittleEndian.AppendUint32(table, uint32(len(o.frames)))
+	// descriptor, no checksums
+	table = append(table, 0)
+	table = binary.LittleEndian.AppendUint32(table, seekableMagic)
+	_, err := o.out.Write(table)
+	return err
+}
+
+// seekableEntry is a seekable zstd archive entry
+type seekableEntry struct {
+	data *io.SectionReader
+	// offset of each frame in data
+	offsets []int64
+}
+
+// openSeekableEntry reads the seek table of an archive entry. ra must be the
+// reader the archive was opened from. Returns nil if the entry is not in the
+// seekable format.
+func openSeekableEntry(ra io.ReaderAt, f *zip.File) (*seekableEntry, error) {
+	if f.Method != zstd.ZipMethodWinZip || f.CompressedSize64 < seekTableFooterSize {
+		return nil, nil
+	}
+	start, err := f.DataOffset()
+	if err != nil {
+		return nil, err
+	}
+	size := int64(f.CompressedSize64)
+	footer := make([]byte, seekTableFooterSize)
+	if _, err := ra.ReadAt(footer, start+size-seekTableFooterSize); err != nil {
+		return nil, err
+	}
+	if binary.LittleEndian.Uint32(footer[5:]) != seekableMagic {
+		return nil, nil
+	}
+	if footer[4]&0x80 != 0 {
+		return nil, errors.New("seek tables with checksums are not supported")
+	}
+	frames := int64(binary.LittleEndian.Uint32(footer[:4]))
+	tableSize := frames*seekTableEntrySize + seekTableFooterSize + 8
+	if tableSize > size {
+		return nil, errors.New("invalid seek table")
+	}
+	table := make([]byte, frames*seekTableEntrySize)
+	if _, err := ra.ReadAt(table, start+size-tableSize+8); err != nil {
+		return nil, err
+	}
+	entry := &seekableEntry{data: io.NewSectionReader(ra, start, size)}
+	offset := int64(0)
+	for i := int64(0); i < frames; i++ {
+		entry.offsets = append(entry.offsets, offset)
+		offset += int64(binary.LittleEndian.Uint32(table[i*seekTableEntrySize:]))
+	}
+	if offset != size-tableSize {
+		return nil, errors.New("seek table does not match the entry")
+	}
+	return entry, nil
+}
+
+// readFrom decompresses the entry from frame i to the end
+func (o *seekableEntry) readFrom(i int) (io.ReadCloser, error) {
+	zr, err := zstd.NewReader(io.NewSectionReader(o.data, o.offsets[i], o.data.Size()-o.offsets[i]), zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return zr.IOReadCloser(), nil
+}
+
+// firstRow returns the first row in frame i
+func (o *seekableEntry) firstRow(i int) ([]byte, error) {
+	rc, err := o.readFrom(i)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 64*1024), maxRowSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) != 0 {
+			return scanner.Bytes(), nil
+		}
+	}
+	return nil, scanner.Err()
+}
+
+// firstSlot returns the slot of the first row in frame i
+func (o *seekableEntry) firstSlot(i int) (uint64, error) {
+	row, err := o.firstRow(i)
+	return rowSlot(row), err
+}
+
+// ReadFromSlot returns the rows from the last frame starting before slot so
+// no rows at or after slot are missed. Callers still skip the earlier rows of
+// that frame.
+func (o *seekableEntry) ReadFromSlot(slot uint64) (io.ReadCloser, error) {
+	var searchErr error
+	// first frame starting at or after slot
+	i := sort.Search(len(o.offsets), func(i int) bool {
+		first, err := o.firstSlot(i)
+		if err != nil {
+			searchErr = err
+		}
+		return first >= slot
+	})
+	if searchErr != nil {
+		return nil, searchErr
+	}
+	if len(o.offsets) == 0 {
+		return io.NopCloser(bytes.NewReader(nil)), nil
+	}
+	return o.readFrom(max(0, i-1))
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func writeSeekableArchive(t *testing.T, path string, files map[string]string) {
+	f, err := os.Create(path)
+	assert.Nil(t, err)
+	w := zip.NewWriter(f)
+	for name, contents := range files {
+		fw, err := createEntry(w, name, CompressionZstdSeekable)
+		assert.Nil(t, err)
+		_, err = fw.Write([]byte(contents))
+		assert.Nil(t, err)
+	}
+	assert.Nil(t, w.Close())
+	assert.Nil(t, f.Close())
+}
+
+func seekableTestRows(from, to int) string {
+	rows := strings.Builder{}
+	for i := from; i < to; i++ {
+		fmt.Fprintf(&rows, `{"slot":%d,"swap":{}}`+"\n", i)
+	}
+	return rows.String()
+}
+
+func TestSeekableArchive(t *testing.T) {
+	defer func(size int) { seekableFrameSize = size }(seekableFrameSize)
+	seekableFrameSize = 256
+
+	path := t.TempDir() + "/20240505-120000.zip"
+	writeSeekableArchive(t, path, map[string]string{"swaps.json": seekableTestRows(0, 1000)})
+
+	// readable as a normal archive
+	slots := []uint64{}
+	assert.Nil(t, readArchiveRows(path, func(row []byte) error {
+		slots = append(slots, rowSlot(row))
+		return nil
+	}))
+	assert.Len(t, slots, 1000)
+	assert.Equal(t, uint64(999), slots[999])
+
+	r, ra, closer, err := openArchiveAt(path)
+	assert.Nil(t, err)
+	defer closer.Close()
+	entry, err := openSeekableEntry(ra, r.File[0])
+	assert.Nil(t, err)
+	assert.NotNil(t, entry)
+	assert.True(t, len(entry.offsets) > 10)
+
+	first := func(slot uint64) uint64 {
+		rc, err := entry.ReadFromSlot(slot)
+		assert.Nil(t, err)
+		defer rc.Close()
+		scanner := bufio.NewScanner(rc)
+		assert.True(t, scanner.Scan())
+		return rowSlot(scanner.Bytes())
+	}
+	assert.Equal(t, uint64(0), first(0))
+	// starts in the frame holding the slot, not at the beginning
+	assert.True(t, first(500) <= 500)
+	assert.True(t, first(500) > 450)
+	assert.True(t, first(999) <= 999)
+	assert.True(t, first(999) > 950)
+	assert.True(t, first(5000) > 950)
+}
+
+func TestSeekableEntryPlainArchive(t *testing.T) {
+	path := t.TempDir() + "/20240505-120000.zip"
+	writeTestArchive(t, path, map[string]string{"swaps.json": seekableTestRows(0, 10)})
+	r, ra, closer, err := openArchiveAt(path)
+	assert.Nil(t, err)
+	defer closer.Close()
+	entry, err := openSeekableEntry(ra, r.File[0])
+	assert.Nil(t, err)
+	assert.Nil(t, entry)
+}
+
+func TestSimulateFromSlot(t *testing.T) {
+	defer func(size int) { seekableFrameSize = size }(seekableFrameSize)
+	seekableFrameSize = 256
+
+	dataDir := t.TempDir()
+	writeSeekableArchive(t, dataDir+"/20240505-120000.zip", map[string]string{"swaps.json": seekableTestRows(0, 100)})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{"swaps.json": seekableTestRows(100, 200)})
+	writeSeekableArchive(t, dataDir+"/20240505-140000.zip", map[string]string{"swaps.json": seekableTestRows(200, 300)})
+
+	run := func(fromSlot uint) []uint64 {
+		st := NewSimulateTask()
+		st.params.dataDir = dataDir
+		st.params.fromSlot = fromSlot
+		st.subscribe(MethodSwapSubscribe)
+		slots := []uint64{}
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			for v := range st.outputFeed {
+				data := DataFormat{}
+				assert.Nil(t, json.Unmarshal(v.Params, &data))
+				slots = append(slots, data.Slot)
+			}
+		}()
+		err := st.RunSimulation(context.Background(), 1)
+		close(st.outputFeed)
+		<-drained
+		assert.Nil(t, err)
+		return slots
+	}
+	for _, fromSlot := range []uint{1, 50, 150, 250} {
+		slots := run(fromSlot)
+		assert.Len(t, slots, 300-int(fromSlot))
+		assert.Equal(t, uint64(fromSlot), slots[0])
+		assert.Equal(t, uint64(299), slots[len(slots)-1])
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	SessionEventConnect         = "connect"
+	SessionEventMethod          = "method"
+	SessionEventSubscribe       = "subscribe"
+	SessionEventSimulationStart = "simulation_start"
+	SessionEventSimulationEnd   = "simulation_end"
+	SessionEventLive            = "live"
+	SessionEventDisconnect      = "disconnect"
+)
+
+// SessionEvent is one line of the simulator session log
+type SessionEvent struct {
+	Time           time.Time         `json:"time"`
+	Event          string            `json:"event"`
+	Remote         string            `json:"remote,omitempty"`
+	Method         string            `json:"method,omitempty"`
+	SubscriptionID uint              `json:"subscription_id,omitempty"`
+	Params         json.RawMessage   `json:"params,omitempty"` // subscribe params, for suggest-filters
+	SimulationID   int               `json:"simulation_id,omitempty"`
+	Delivered      map[string]uint64 `json:"delivered,omitempty"` // notifications sent by method
+	Reason         string            `json:"reason,omitempty"`
+}
+
+// sessionLog writes simulator activity as one JSON object per line so it can
+// be kept as a CI artifact. A nil log discards everything.
+type sessionLog struct {
+	lock      sync.Mutex
+	f         *os.File
+	enc       *json.Encoder
+	delivered map[string]uint64
+}
+
+// newSessionLog creates a new log file for this run in dir. Returns nil if dir
+// is empty.
+func newSessionLog(dir string) (*sessionLog, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, "simulate-session-"+time.Now().UTC().Format(archiveZipFileTimeFormat)+".json")
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, errors.Wrap(err, "cant create session log")
+	}
+	logrus.Infof("writing session log to %s", path)
+	return &sessionLog{
+		f:         f,
+		enc:       json.NewEncoder(f),
+		delivered: map[string]uint64{},
+	}, nil
+}
+
+func (o *sessionLog) Log(event SessionEvent) {
+	if o == nil {
+		return
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	event.Time = time.Now().UTC()
+	if err := o.enc.Encode(event); err != nil {
+		logrus.Errorf("session log: %s", err.Error())
+	}
+}
+
+// Delivered counts a notification sent to a client
+func (o *sessionLog) Delivered(method string) {
+	if o == nil {
+		return
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.delivered[method]++
+}
+
+// TakeDelivered returns the notifications counted since the last call
+func (o *sessionLog) TakeDelivered() map[string]uint64 {
+	if o == nil {
+		return nil
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	delivered := o.delivered
+	o.delivered = map[string]uint64{}
+	return delivered
+}
+
+func (o *sessionLog) Close() error {
+	if o == nil {
+		return nil
+	}
+	return o.f.Close()
+}
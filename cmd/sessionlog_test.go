@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestSessionLog(t *testing.T) {
+	dir := t.TempDir()
+	log, err := newSessionLog(dir)
+	assert.Nil(t, err)
+	log.Log(SessionEvent{Event: SessionEventConnect, Remote: "127.0.0.1:1234"})
+	log.Delivered("swapNotification")
+	log.Delivered("swapNotification")
+	log.Log(SessionEvent{Event: SessionEventSimulationEnd, Delivered: log.TakeDelivered()})
+	assert.Nil(t, log.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "simulate-session-*.json"))
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+	f, err := os.Open(files[0])
+	assert.Nil(t, err)
+	defer f.Close()
+	events := []SessionEvent{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		event := SessionEvent{}
+		assert.Nil(t, json.Unmarshal(scanner.Bytes(), &event))
+		events = append(events, event)
+	}
+	assert.Len(t, events, 2)
+	assert.Equal(t, SessionEventConnect, events[0].Event)
+	assert.Equal(t, uint64(2), events[1].Delivered["swapNotification"])
+	assert.Empty(t, log.TakeDelivered())
+
+	// a nil log discards everything
+	var disabled *sessionLog
+	disabled.Log(SessionEvent{Event: SessionEventConnect})
+	assert.Nil(t, disabled.Close())
+}
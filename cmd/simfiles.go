@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// ArchiveFileSummary is an archive in the GET /files listing
+type ArchiveFileSummary struct {
+	Name      string `json:"name"`
+	Size      int64  `json:"size"`
+	FirstSlot uint64 `json:"firstSlot"`
+	LastSlot  uint64 `json:"lastSlot"`
+	Events    uint64 `json:"events"`
+	// events by the subscribe method they are sent to
+	Counts  map[string]uint64 `json:"counts"`
+	modTime time.Time
+}
+
+// FilesResponse is the body of GET /files
+type FilesResponse struct {
+	DataDir   string               `json:"dataDir"`
+	FirstSlot uint64               `json:"firstSlot"`
+	LastSlot  uint64               `json:"lastSlot"`
+	Events    uint64               `json:"events"`
+	Files     []ArchiveFileSummary `json:"files"`
+}
+
+// fileSummaries caches the summaries of the archives in the data dir. An
+// archive is only read again once it changes.
+type fileSummaries struct {
+	lock  sync.Mutex
+	files map[string]ArchiveFileSummary
+}
+
+// filesHandler serves the archives the simulation replays, in order, so test
+// harnesses can pick a from-slot and know how many events to expect
+func (o *SimulateTask) filesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	response, err := o.listFiles()
+	if err != nil {
+		logrus.Errorf("list files: %s", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+func (o *SimulateTask) listFiles() (FilesResponse, error) {
+	response := FilesResponse{DataDir: o.params.dataDir, Files: []ArchiveFileSummary{}}
+	files, err := o.getDataFiles()
+	if err != nil {
+		return response, err
+	}
+	o.summaries.lock.Lock()
+	defer o.summaries.lock.Unlock()
+	if o.summaries.files == nil {
+		o.summaries.files = map[string]ArchiveFileSummary{}
+	}
+	for _, v := range files {
+		path := o.params.dataDir + "/" + v
+		info, err := os.Stat(path)
+		if err != nil {
+			return response, err
+		}
+		summary, ok := o.summaries.files[v]
+		if !ok || summary.Size != info.Size() || !summary.modTime.Equal(info.ModTime()) {
+			summary, err = summarizeArchive(path)
+			if err != nil {
+				return response, err
+			}
+			summary.Name, summary.Size, summary.modTime = v, info.Size(), info.ModTime()
+			o.summaries.files[v] = summary
+		}
+		response.Files = append(response.Files, summary)
+		if summary.Events == 0 {
+			continue
+		}
+		if response.Events == 0 || summary.FirstSlot < response.FirstSlot {
+			response.FirstSlot = summary.FirstSlot
+		}
+		response.LastSlot = max(response.LastSlot, summary.LastSlot)
+		response.Events += summary.Events
+	}
+	return response, nil
+}
+
+// summarizeArchive counts the events of an archive by feed
+func summarizeArchive(path string) (ArchiveFileSummary, error) {
+	summary := ArchiveFileSummary{Counts: map[string]uint64{}}
+	for _, feed := range simulatorFeeds {
+		summary.Counts[feed.SubscribeMethod()] = 0
+	}
+	err := readArchiveRows(path, func(row []byte) error {
+		data := DataFormat{}
+		if err := json.Unmarshal(row, &data); err != nil {
+			return errors.Wrap(err, "cant unmarshal event")
+		}
+		if summary.Events == 0 || data.Slot < summary.FirstSlot {
+			summary.FirstSlot = data.Slot
+		}
+		summary.LastSlot = max(summary.LastSlot, data.Slot)
+		summary.Events++
+		for _, feed := range simulatorFeeds {
+			if feed.Matches(data) {
+				summary.Counts[feed.SubscribeMethod()]++
+			}
+		}
+		return nil
+	})
+	return summary, err
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+// simTenantHeader selects the dataset of a client which connects to / rather
+// than /<key>
+const simTenantHeader = "X-API-KEY"
+
+// simTenant is a data dir served to the clients of its key, so test suites
+// sharing one simulator each replay their own archives
+type simTenant struct {
+	key     string
+	dataDir string
+}
+
+// parseTenants parses --dataset, e.g. suite-a=out-a,suite-b=out-b
+func parseTenants(list string) ([]simTenant, error) {
+	tenants := []simTenant{}
+	if list == "" {
+		return tenants, nil
+	}
+	keys := map[string]bool{}
+	for _, v := range strings.Split(list, ",") {
+		key, dataDir, ok := strings.Cut(strings.TrimSpace(v), "=")
+		if !ok || key == "" || dataDir == "" {
+			return nil, fmt.Errorf("%q must be key=dir", v)
+		}
+		if strings.Contains(key, "/") {
+			return nil, fmt.Errorf("key %q can not contain /", key)
+		}
+		if dataDir == pipeName {
+			return nil, fmt.Errorf("dir of %s can not be stdin", key)
+		}
+		if keys[key] {
+			return nil, fmt.Errorf("key %s is used more than once", key)
+		}
+		keys[key] = true
+		tenants = append(tenants, simTenant{key: key, dataDir: dataDir})
+	}
+	return tenants, nil
+}
+
+// tenant returns a simulator of dataDir with the same params as o. Each has
+// its own subscriptions and UI state.
+func (o *SimulateTask) tenant(dataDir string) *SimulateTask {
+	tenant := NewSimulateTask()
+	tenant.params = o.params
+	tenant.params.dataDir = dataDir
+	tenant.entitlement = o.entitlement
+	tenant.http = o.http
+	tenant.datasets = o.datasets
+	tenant.lock = o.lock
+	tenant.trash = o.trash
+	tenant.schema = o.schema
+	tenant.envelope = o.envelope
+	tenant.notifications = o.notifications
+	tenant.fromDate = o.fromDate
+	tenant.sessionLog = o.sessionLog
+	return tenant
+}
+
+// tenantHandler routes each request to the simulator of its key, taken from
+// the start of the path or else the X-API-KEY header
+func tenantHandler(tenants map[string]http.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, _, found := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		if handler, ok := tenants[key]; ok {
+			if !found {
+				// the UI fetches its state relative to the page
+				if !websocket.IsWebSocketUpgrade(r) {
+					http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+					return
+				}
+				r = r.Clone(r.Context())
+				r.URL.Path += "/"
+				r.URL.RawPath = ""
+			}
+			http.StripPrefix("/"+key, handler).ServeHTTP(w, r)
+			return
+		}
+		if handler, ok := tenants[r.Header.Get(simTenantHeader)]; ok {
+			handler.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, fmt.Sprintf("unknown dataset, connect to /<key> or send the key in the %s header", simTenantHeader), http.StatusNotFound)
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+)
+
+//go:embed simui.html
+var simulatorUIPage []byte
+
+// uiTraceSize is how many of the latest events the UI shows
+const uiTraceSize = 50
+
+// simulatorUI holds what the web UI at / shows and the speed it sets
+type simulatorUI struct {
+	lock       sync.Mutex
+	nextClient int
+	clients    map[int]*UIClient
+	running    bool
+	slot       uint64
+	events     uint64
+	// newest last
+	trace []UITraceEvent
+	// speed controls
+	paused   bool
+	rate     string
+	interval time.Duration
+	next     time.Time
+}
+
+// UIClient is a connected websocket client
+type UIClient struct {
+	ID            int       `json:"id"`
+	Remote        string    `json:"remote"`
+	ConnectedAt   time.Time `json:"connectedAt"`
+	Subscriptions []string  `json:"subscriptions"`
+	Simulating    bool      `json:"simulating"`
+}
+
+// UITraceEvent is an event sent to a client
+type UITraceEvent struct {
+	Time           time.Time `json:"time"`
+	Method         string    `json:"method"`
+	SubscriptionID uint      `json:"subscriptionId"`
+	Slot           uint64    `json:"slot"`
+	Signature      string    `json:"signature,omitempty"`
+}
+
+// UIState is the body of GET /ui/state
+type UIState struct {
+	Running bool           `json:"running"`
+	Slot    uint64         `json:"slot"`
+	Events  uint64         `json:"events"`
+	Paused  bool           `json:"paused"`
+	Rate    string         `json:"rate"`
+	Clients []UIClient     `json:"clients"`
+	Trace   []UITraceEvent `json:"trace"`
+}
+
+// UIControl is the body of POST /ui/control. Fields left out are unchanged.
+type UIControl struct {
+	Paused *bool   `json:"paused"`
+	Rate   *string `json:"rate"`
+}
+
+func newSimulatorUI() *simulatorUI {
+	return &simulatorUI{clients: map[int]*UIClient{}, rate: "0"}
+}
+
+func (o *simulatorUI) Connect(remote string) int {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.nextClient++
+	o.clients[o.nextClient] = &UIClient{ID: o.nextClient, Remote: remote, ConnectedAt: time.Now(), Subscriptions: []string{}}
+	return o.nextClient
+}
+
+func (o *simulatorUI) Disconnect(id int) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	delete(o.clients, id)
+}
+
+func (o *simulatorUI) Subscribed(id int, method string) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if client, ok := o.clients[id]; ok {
+		client.Subscriptions = append(client.Subscriptions, method)
+	}
+}
+
+// Simulating marks a client's simulation as started or finished
+func (o *simulatorUI) Simulating(id int, simulating bool) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if client, ok := o.clients[id]; ok {
+		client.Simulating = simulating
+	}
+	o.running = false
+	for _, v := range o.clients {
+		o.running = o.running || v.Simulating
+	}
+}
+
+func (o *simulatorUI) SetSlot(slot uint64) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.slot = slot
+}
+
+// Emitted records an event sent to the clients
+func (o *simulatorUI) Emitted(v JSONRPC, data DataFormat) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.events++
+	if len(o.trace) == uiTraceSize {
+		o.trace = o.trace[1:]
+	}
+	o.trace = append(o.trace, UITraceEvent{
+		Time:           time.Now(),
+		Method:         v.Method,
+		SubscriptionID: v.SubscriptionID,
+		Slot:           data.Slot,
+		Signature:      data.Signature,
+	})
+}
+
+// Wait blocks while the simulation is paused and paces events to the rate
+func (o *simulatorUI) Wait(ctx context.Context) error {
+	for {
+		o.lock.Lock()
+		paused, interval, next := o.paused, o.interval, o.next
+		if !paused && (interval == 0 || !time.Now().Before(next)) {
+			o.next = time.Now().Add(interval)
+			o.lock.Unlock()
+			return nil
+		}
+		o.lock.Unlock()
+		// paused is polled so resuming needs no signalling
+		wait := 100 * time.Millisecond
+		if !paused {
+			wait = min(wait, time.Until(next))
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (o *simulatorUI) SetControl(control UIControl) error {
+	interval := time.Duration(0)
+	if control.Rate != nil {
+		var err error
+		interval, err = parseRate(*control.Rate)
+		if err != nil {
+			return err
+		}
+	}
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	if control.Paused != nil {
+		o.paused = *control.Paused
+	}
+	if control.Rate != nil {
+		o.rate = *control.Rate
+		o.interval = interval
+		o.next = time.Time{}
+	}
+	return nil
+}
+
+func (o *simulatorUI) State() UIState {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	state := UIState{
+		Running: o.running,
+		Slot:    o.slot,
+		Events:  o.events,
+		Paused:  o.paused,
+		Rate:    o.rate,
+		Clients: []UIClient{},
+		Trace:   append([]UITraceEvent{}, o.trace...),
+	}
+	for i := 1; i <= o.nextClient; i++ {
+		if client, ok := o.clients[i]; ok {
+			client := *client
+			client.Subscriptions = append([]string{}, client.Subscriptions...)
+			state.Clients = append(state.Clients, client)
+		}
+	}
+	return state
+}
+
+// uiHandler serves the UI page for requests to / which are not websocket
+// upgrades
+func (o *SimulateTask) uiHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" || r.Method != http.MethodGet {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(simulatorUIPage)
+}
+
+func (o *SimulateTask) uiStateHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(o.ui.State())
+}
+
+func (o *SimulateTask) uiControlHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	control := UIControl{}
+	if err := json.NewDecoder(r.Body).Decode(&control); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := o.ui.SetControl(control); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	o.uiStateHandler(w, r)
+}
@@ -3,12 +3,17 @@ package main
 import (
 	"archive/zip"
 	"bufio"
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"math/rand"
@@ -22,13 +27,51 @@ import (
 type SimulateTask struct {
 	nextSubID  uint
 	outputFeed chan JSONRPC
-	pairsSubID uint
-	swapsSubID uint
-	params     struct {
-		fromDate string
-		fromSlot uint
-		dataDir  string
-		port     uint
+	// subscription id by feed subscribe method
+	subscriptions map[string]uint
+	entitlement   entitlementOptions
+	http          httpOptions
+	sessionLog    *sessionLog
+	injections    []Injection
+	summaries     fileSummaries
+	datasets      datasetOptions
+	lock          dirLockOptions
+	trash         trashOptions
+	schema        schemaOptions
+	envelope      envelopeOptions
+	// renders the notifications sent to clients
+	notifications *notificationEnvelope
+	ui            *simulatorUI
+	fromDate      time.Time
+	tenants       []simTenant
+	params        struct {
+		fromDate      string
+		fromSlot      uint
+		dataDir       string
+		tenants       string
+		prefer        string
+		port          uint
+		sessionLogDir string
+		inject        string
+		buffer        int
+		cpuProfile    string
+		// production limits to emulate per connection
+		maxSubscriptions  int
+		maxMessagesPerSec int
+		// stop early for quick smoke tests
+		limitEvents uint
+		limitSlots  uint64
+		direction   string
+		only        string
+		// how events within a slot are ordered
+		slotOrder   string
+		shuffleSeed int64
+		// replay with slots starting from this value
+		remapSlotsFrom uint64
+		// switch clients to the live feed after the replay
+		catchUp bool
+		liveURL string
+		apiKey  string
 	}
 }
 
@@ -39,18 +82,58 @@ const (
 	tmpDir                 = "tmp"
 )
 
+const (
+	DirectionForward = "forward"
+	DirectionReverse = "reverse"
+)
+
+// onlyRowFields are the archive row fields of the event types --only selects
+var onlyRowFields = map[string]string{
+	"swaps":     "swap",
+	"pairs":     "pair",
+	"liquidity": "liquidityUpdate",
+}
+
 func NewSimulateTask() *SimulateTask {
 	return &SimulateTask{
-		nextSubID:  1,
-		outputFeed: make(chan JSONRPC, 1),
+		nextSubID:     1,
+		outputFeed:    make(chan JSONRPC, 1),
+		subscriptions: map[string]uint{},
+		ui:            newSimulatorUI(),
+		notifications: defaultEnvelope,
 	}
 }
 
 func (o *SimulateTask) SetupParameters(cmd *cobra.Command) {
-	// cmd.Flags().StringVarP(&o.params.fromDate, "from-date", "f", "", "Specify when to start the simulation from. Format: YYYY-MM-DD. If none specified, it will run with all the consecutive files in the data dir.")
-	// cmd.Flags().UintVarP(&o.params.fromSlot, "from-slot", "s", 0, "Specify the slot to start the simulation from. The from-date param must also be provided")
+	o.entitlement.SetupParameters(cmd)
+	o.http.SetupParameters(cmd)
+	o.datasets.SetupParameters(cmd)
+	o.lock.SetupParameters(cmd)
+	o.trash.SetupParameters(cmd)
+	o.schema.SetupParameters(cmd)
+	o.envelope.SetupParameters(cmd)
+	cmd.Flags().StringVarP(&o.params.fromDate, "from-date", "f", "", "Specify when to start the simulation from e.g. '2024-05-05 14:30' in UTC. It is resolved to the first slot with a block time at or after it")
+	cmd.Flags().UintVarP(&o.params.fromSlot, "from-slot", "s", 0, "Specify the slot to start the simulation from. Archives written with --compression zstd-seekable jump straight to it, others are read up to it")
 	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir to get the data from for streaming")
+	cmd.Flags().StringVar(&o.params.tenants, "dataset", "", "Serve a different data dir to each client by key, e.g. suite-a=out-a,suite-b=out-b. Clients connect to /<key> or send the key in the X-API-KEY header. Replaces data-dir. (Comma separated list)")
+	cmd.Flags().StringVar(&o.params.prefer, "prefer", "", "When both an original archive and a reduced copy of it cover the same hour in data-dir, replay the 'reduced' or 'original' one. By default overlapping archives are an error as their events would be replayed twice")
 	cmd.Flags().UintVarP(&o.params.port, "port", "p", 8000, "The port the websocket server will bind to on localhost")
+	cmd.Flags().IntVar(&o.params.maxSubscriptions, "max-subscriptions", 0, "Reject subscriptions over this many per connection with the production limit error. 0 means no limit")
+	cmd.Flags().IntVar(&o.params.maxMessagesPerSec, "max-messages-per-sec", 0, "Reject client messages over this rate per connection with the production rate limit error. 0 means no limit")
+	cmd.Flags().StringVar(&o.params.direction, "direction", DirectionForward, "The order to emit events in. 'forward' is oldest first. 'reverse' is newest first")
+	cmd.Flags().StringVar(&o.params.only, "only", "", "Only replay one type of event: swaps, pairs or liquidity. Other rows are skipped before they are parsed, much faster when testing pair discovery")
+	cmd.Flags().StringVar(&o.params.slotOrder, "slot-order", SlotOrderFile, "The order to emit events within a slot. 'file' is the order of the rows in the archive. 'index' is by transaction index where rows have one, otherwise by signature. 'shuffle' is a random order from --shuffle-seed")
+	cmd.Flags().Int64Var(&o.params.shuffleSeed, "shuffle-seed", 1, "The seed of --slot-order shuffle. The same seed gives the same order every run")
+	cmd.Flags().Uint64Var(&o.params.remapSlotsFrom, "remap-slots-from", 0, "Rewrite event slots so they increase from this slot, e.g. the current slot, for systems that validate slot recency. Gaps between slots are kept. 0 means the archived slots are sent")
+	cmd.Flags().UintVar(&o.params.limitEvents, "limit-events", 0, "Stop the simulation after this many events. 0 means no limit")
+	cmd.Flags().Uint64Var(&o.params.limitSlots, "limit-slots", 0, "Stop the simulation after this many slots from the starting slot. 0 means no limit")
+	cmd.Flags().BoolVar(&o.params.catchUp, "catch-up", false, "After replaying the archives, switch clients to the live feed with the same subscriptions instead of disconnecting them")
+	cmd.Flags().StringVar(&o.params.liveURL, "live-url", defaultLiveURL, "The live websocket to switch to in catch up mode")
+	cmd.Flags().StringVarP(&o.params.apiKey, "key", "k", "", "Your API key for the live feed in catch up mode")
+	cmd.Flags().StringVar(&o.params.inject, "inject", "", "A JSON file of synthetic events to emit at chosen slots along with the archive events, e.g. a huge swap to test circuit breakers. See docs")
+	cmd.Flags().IntVar(&o.params.buffer, "buffer", 1024, "How many rows to read ahead from each archive file. Small buffers make the readers and the emitter wait on each other")
+	cmd.Flags().StringVar(&o.params.cpuProfile, "cpu-profile", "", "Write a Go CPU profile of each simulation run to this file, for go tool pprof")
+	cmd.Flags().StringVar(&o.params.sessionLogDir, "session-log-dir", "", "Write a JSON log of connections, subscriptions, methods received, events delivered and disconnect reasons to a new file in this dir for each run. Useful as a CI artifact")
 }
 
 func (o *SimulateTask) GetMeta() Meta {
@@ -68,87 +151,303 @@ type JSONRPC struct {
 	Params         json.RawMessage `json:"params"`
 }
 
+// subscribeResult is the response to a subscribe request
+func subscribeResult(id int, subID uint) []byte {
+	return []byte(fmt.Sprintf(`{"id":%d,"result":{"subscription_id":%d}}`, id, subID))
+}
+
 func (o *SimulateTask) Execute(ctx context.Context) error {
 	if err := o.validateParams(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	sessionLog, err := newSessionLog(o.params.sessionLogDir)
+	if err != nil {
+		return err
+	}
+	defer sessionLog.Close()
+	o.sessionLog = sessionLog
+	handler, release, err := o.handler(ctx)
+	defer release()
+	if err != nil {
 		return err
 	}
+
+	logrus.Infof("To start a simulation, connect to the websocket, subscribe to the desired feed, then send the startSimulation method. Your subscriptions will then receive events")
+	if len(o.tenants) == 0 {
+		logrus.Infof("Websocket server listening on localhost:%d configured with data in dir: %s", o.params.port, o.params.dataDir)
+	}
+	for _, v := range o.tenants {
+		logrus.Infof("Websocket server listening on localhost:%d/%s configured with data in dir: %s", o.params.port, v.key, v.dataDir)
+	}
+	logrus.Infof("Open http://localhost:%d in a browser to watch and control simulations", o.params.port)
+	return http.ListenAndServe(fmt.Sprintf("localhost:%d", o.params.port), handler)
+}
+
+// handler serves the simulator, or one for each --dataset. release unlocks
+// the data dirs, and is set even on error.
+func (o *SimulateTask) handler(ctx context.Context) (http.Handler, func(), error) {
+	if len(o.tenants) == 0 {
+		release, err := o.prepare()
+		return o.serveMux(ctx), release, err
+	}
+	releases := []func(){}
+	release := func() {
+		for _, v := range releases {
+			v()
+		}
+	}
+	handlers := map[string]http.Handler{}
+	for _, v := range o.tenants {
+		tenant := o.tenant(v.dataDir)
+		tenantRelease, err := tenant.prepare()
+		releases = append(releases, tenantRelease)
+		if err != nil {
+			return nil, release, errors.Wrapf(err, "dataset %s", v.key)
+		}
+		handlers[v.key] = tenant.serveMux(ctx)
+	}
+	return tenantHandler(handlers), release, nil
+}
+
+// prepare locks data-dir, verifies it and resolves the params that depend
+// on it. release unlocks it, and is set even on error.
+func (o *SimulateTask) prepare() (func(), error) {
+	// the tmp dir in data-dir is cleared at the start of each simulation
+	unlock, err := o.lock.Lock(o.params.dataDir, "simulate")
+	if err != nil {
+		return func() {}, err
+	}
+	if err := o.trash.Purge(); err != nil {
+		return unlock, err
+	}
+	if err := o.schema.Check(o.params.dataDir); err != nil {
+		return unlock, err
+	}
+	return unlock, o.verify()
+}
+
+func (o *SimulateTask) verify() error {
+	if o.entitlement.verify {
+		files, err := o.getDataFiles()
+		if err != nil {
+			return err
+		}
+		if err := o.entitlement.Verify(o.params.dataDir, files); err != nil {
+			return err
+		}
+	}
+	if o.params.fromDate != "" {
+		if err := o.resolveFromDate(); err != nil {
+			return err
+		}
+	}
+	if o.params.inject != "" {
+		injections, err := loadInjections(o.params.inject)
+		if err != nil {
+			return withKind(ErrUsage, err)
+		}
+		o.injections = injections
+	}
+	return nil
+}
+
+func (o *SimulateTask) serveMux(ctx context.Context) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", o.websocketHandler(ctx))
+	mux.HandleFunc("/files", o.filesHandler)
+	mux.HandleFunc("/ui/state", o.uiStateHandler)
+	mux.HandleFunc("/ui/control", o.uiControlHandler)
+	return mux
+}
+
+// websocketHandler serves one client connection, or the web UI to requests
+// which are not websocket upgrades
+func (o *SimulateTask) websocketHandler(ctx context.Context) http.HandlerFunc {
 	upgrader := websocket.Upgrader{} // use default options
-	websocket := func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !websocket.IsWebSocketUpgrade(r) {
+			o.uiHandler(w, r)
+			return
+		}
 		c, err := upgrader.Upgrade(w, r, nil)
 		if err != nil {
 			logrus.Errorf("upgrade: %s", err.Error())
 			return
 		}
 		logrus.Infof("websocket connection established")
+		o.sessionLog.Log(SessionEvent{Event: SessionEventConnect, Remote: r.RemoteAddr})
+		clientID := o.ui.Connect(r.RemoteAddr)
+		defer o.ui.Disconnect(clientID)
+		disconnectReason := ""
+		limits := connectionLimits{
+			maxSubscriptions:  o.params.maxSubscriptions,
+			maxMessagesPerSec: o.params.maxMessagesPerSec,
+		}
 		defer func() {
 			logrus.Infof("websocket connection closed")
+			o.sessionLog.Log(SessionEvent{Event: SessionEventDisconnect, Remote: r.RemoteAddr, Reason: disconnectReason})
 		}()
 		defer c.Close()
+		subscriptions := []clientSubscription{}
+		// set once switched to the live feed in catch up mode
+		var live *liveSession
+		liveFeed := make(chan []byte, 1)
 		for {
 			_, message, err := c.ReadMessage()
 			if err != nil {
 				logrus.Errorf("read: %s", err.Error())
+				disconnectReason = "read: " + err.Error()
 				break
 			}
+			if live != nil {
+				if err := live.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+					logrus.Errorf("live write: %s", err.Error())
+					disconnectReason = "live write: " + err.Error()
+					break
+				}
+				continue
+			}
 			jsonrpc := JSONRPC{}
 			err = json.Unmarshal(message, &jsonrpc)
 			if err != nil {
 				logrus.Errorf("unmarshal: %s", err.Error())
+				disconnectReason = "unmarshal: " + err.Error()
 				break
 			}
+			o.sessionLog.Log(SessionEvent{Event: SessionEventMethod, Remote: r.RemoteAddr, Method: jsonrpc.Method})
+			if !limits.AllowMessage(time.Now()) {
+				err := writeRPCError(c, jsonrpc.ID, ErrCodeLimitExceeded, fmt.Sprintf("rate limit exceeded, max %d messages per second", limits.maxMessagesPerSec))
+				if err != nil {
+					logrus.Errorf("write: %s", err.Error())
+				}
+				continue
+			}
 			switch jsonrpc.Method {
 			case MethodStartSimulation:
+				// closed when the simulation ends, the writer then sends the
+				// events still queued and closes flushed
+				ended, flushed := make(chan struct{}), make(chan struct{})
 				go func() {
-					for {
-						v, open := <-o.outputFeed
-						if !open {
-							return
-						}
-						raw, err := json.Marshal(v)
+					defer close(flushed)
+					write := func(v JSONRPC) bool {
+						raw, err := o.notifications.Render(v)
 						if err != nil {
 							logrus.Errorf("write: %s", err.Error())
-							break
+							return false
 						}
 						err = c.WriteMessage(websocket.TextMessage, raw)
 						if err != nil {
 							logrus.Errorf("write: %s", err.Error())
-							break
+							return false
+						}
+						o.sessionLog.Delivered(v.Method)
+						return true
+					}
+					flush := func() bool {
+						for {
+							select {
+							case v := <-o.outputFeed:
+								if !write(v) {
+									return false
+								}
+							default:
+								return true
+							}
+						}
+					}
+					for {
+						select {
+						case v, open := <-o.outputFeed:
+							if !open || !write(v) {
+								return
+							}
+						case raw, open := <-liveFeed:
+							if !open {
+								// live feed ended so end the client connection too
+								c.Close()
+								return
+							}
+							// send any replayed events still queued first
+							if !flush() {
+								return
+							}
+							if err := c.WriteMessage(websocket.TextMessage, raw); err != nil {
+								logrus.Errorf("write: %s", err.Error())
+								return
+							}
+						case <-ended:
+							flush()
+							return
 						}
 					}
 				}()
 
-				err = o.RunSimulation(ctx, rand.Intn(100000))
+				simID := rand.Intn(100000)
+				o.sessionLog.Log(SessionEvent{Event: SessionEventSimulationStart, Remote: r.RemoteAddr, SimulationID: simID})
+				o.ui.Simulating(clientID, true)
+				err = o.RunSimulation(ctx, simID)
+				o.ui.Simulating(clientID, false)
+				end := SessionEvent{Event: SessionEventSimulationEnd, Remote: r.RemoteAddr, SimulationID: simID, Delivered: o.sessionLog.TakeDelivered()}
+				disconnectReason = "simulation finished"
 				if err != nil {
 					logrus.Errorf("run simulation: %s", err.Error())
+					end.Reason = err.Error()
+					disconnectReason = "simulation failed"
 				}
-				logrus.Infof("simulation finished, disconnecting clients...")
-				return
-			case MethodNewPairSubscribe:
-				o.pairsSubID = o.nextSubID
-				err := c.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"id":%d,"result":{"subscription_id":%d}}`, jsonrpc.ID, o.pairsSubID)))
+				o.sessionLog.Log(end)
+				if err != nil || !o.params.catchUp {
+					close(ended)
+					<-flushed
+					logrus.Infof("simulation finished, disconnecting clients...")
+					return
+				}
+				logrus.Infof("simulation finished, switching client to the live feed...")
+				live, err = o.connectLive(ctx, subscriptions)
 				if err != nil {
-					logrus.Errorf("read: %s", err.Error())
+					logrus.Errorf("catch up: %s", err.Error())
+					disconnectReason = "catch up: " + err.Error()
+					return
+				}
+				defer live.Close()
+				o.sessionLog.Log(SessionEvent{Event: SessionEventLive, Remote: r.RemoteAddr})
+				disconnectReason = ""
+				go live.Forward(liveFeed)
+			default:
+				if findFeed(jsonrpc.Method) == nil {
+					logrus.Errorf("unknown method: %s", jsonrpc.Method)
+					break
+				}
+				if !limits.AllowSubscription() {
+					err := writeRPCError(c, jsonrpc.ID, ErrCodeLimitExceeded, subscriptionLimitMessage(limits.maxSubscriptions))
+					if err != nil {
+						logrus.Errorf("write: %s", err.Error())
+					}
 					break
 				}
-				o.nextSubID++
-			case MethodSwapSubscribe:
-				o.swapsSubID = o.nextSubID
-				err := c.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"id":%d,"result":{"subscription_id":%d}}`, jsonrpc.ID, o.swapsSubID)))
+				subID, _ := o.subscribe(jsonrpc.Method)
+				o.ui.Subscribed(clientID, jsonrpc.Method)
+				subscriptions = append(subscriptions, clientSubscription{Method: jsonrpc.Method, Params: jsonrpc.Params, SubscriptionID: subID})
+				o.sessionLog.Log(SessionEvent{Event: SessionEventSubscribe, Remote: r.RemoteAddr, Method: jsonrpc.Method, SubscriptionID: subID, Params: jsonrpc.Params})
+				err := c.WriteMessage(websocket.TextMessage, subscribeResult(jsonrpc.ID, subID))
 				if err != nil {
 					logrus.Errorf("read: %s", err.Error())
 					break
 				}
-				o.nextSubID++
-			default:
-				logrus.Errorf("unknown method: %s", jsonrpc.Method)
 			}
 		}
 	}
+}
 
-	logrus.Infof("To start a simulation, connect to the websocket, subscribe to the desired feed, then send the startSimulation method. Your subscriptions will then receive events")
-	logrus.Infof("Websocket server listening on localhost:%d configured with data in dir: %s", o.params.port, o.params.dataDir)
-	http.HandleFunc("/", websocket)
-	return http.ListenAndServe(fmt.Sprintf("localhost:%d", o.params.port), nil)
+// subscribe registers a subscription to the feed with this subscribe method and
+// returns its id. Returns false if there is no such feed.
+func (o *SimulateTask) subscribe(method string) (uint, bool) {
+	if findFeed(method) == nil {
+		return 0, false
+	}
+	subID := o.nextSubID
+	o.subscriptions[method] = subID
+	o.nextSubID++
+	return subID, true
 }
 
 func (o *SimulateTask) RunSimulation(ctx context.Context, simID int) error {
@@ -156,66 +455,102 @@ func (o *SimulateTask) RunSimulation(ctx context.Context, simID int) error {
 	if err != nil {
 		return err
 	}
-	slot := uint64(0)
-	events := 0
-	os.RemoveAll(o.params.dataDir + "/" + tmpDir)
-	os.MkdirAll(o.params.dataDir+"/"+tmpDir, 0755)
-	for dataFileNum, v := range dataFiles {
-		logrus.Infof("running sim data from file (%d of %d) %s", dataFileNum+1, len(dataFiles), v)
-		// unzip file and write to disk to keep mem usage low
-		r, err := zip.OpenReader(o.params.dataDir + "/" + v)
+	if o.params.cpuProfile != "" {
+		stopProfile, err := startCPUProfile(o.params.cpuProfile)
 		if err != nil {
 			return err
 		}
+		defer stopProfile()
+	}
+	queues := queueStats{capacity: o.params.buffer}
+	slot := uint64(0)
+	startingSlot := uint64(0)
+	events := uint(0)
+	limited := false
+	reverse := o.params.direction == DirectionReverse
+	if reverse {
+		slices.Reverse(dataFiles)
+	}
+	order := newSlotOrder(o.params.slotOrder, o.params.shuffleSeed, reverse)
+	injector := newInjector(o.injections)
+	var onlyField []byte
+	if o.params.only != "" {
+		onlyField = []byte(`"` + onlyRowFields[o.params.only] + `"`)
+	}
+	// slots streamed so far, for --limit-slots
+	slotsSent := func() uint64 {
+		if reverse {
+			return startingSlot - slot
+		}
+		return slot - startingSlot
+	}
+	if err := o.trash.Remove(o.params.dataDir + "/" + tmpDir); err != nil {
+		return err
+	}
+	os.MkdirAll(o.params.dataDir+"/"+tmpDir, 0755)
+	// the files of each dataset of an hour are replayed together
+	groups := groupArchiveHours(o.subscribedFiles(dataFiles))
+	for groupNum, group := range groups {
+		v := strings.Join(group, ", ")
+		logrus.Infof("running sim data from file (%d of %d) %s", groupNum+1, len(groups), v)
+		// unzip file and write to disk to keep mem usage low
 		unzippedFiles := []string{}
-		// Iterate through the files in the archive,
 		logrus.Debugf("unzipping files %s", v)
 		start := time.Now()
-		for _, f := range r.File {
-			rc, err := f.Open()
-			if err != nil {
-				return err
-			}
-			tmpFile := fmt.Sprintf("%s/%s.%d", tmpDir, f.Name, simID)
-			outFile, err := os.OpenFile(fmt.Sprintf("%s/%s", o.params.dataDir, tmpFile), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		for archiveNum, archive := range group {
+			unzipped, err := o.unzipArchive(archive, fmt.Sprintf("%d.%d", simID, archiveNum))
 			if err != nil {
 				return err
 			}
-			_, err = io.Copy(outFile, rc)
-			if err != nil {
-				return err
-			}
-			rc.Close()
-			outFile.Close()
-			unzippedFiles = append(unzippedFiles, tmpFile)
+			unzippedFiles = append(unzippedFiles, unzipped...)
 		}
 		logrus.Debugf("unzipped %s in %s", v, time.Since(start))
 		start = time.Now()
-		r.Close()
 
 		// get the starting slot
-		if dataFileNum == 0 {
-			slot, err = o.getStartingSlot(unzippedFiles)
+		if slot == 0 {
+			slot, err = o.getStartingSlot(unzippedFiles, reverse)
 			if err != nil {
 				return err
 			}
+			if slot == 0 {
+				// nothing from from-slot on in this file
+				for _, v := range unzippedFiles {
+					o.removeInterimFile(v)
+				}
+				continue
+			}
+			startingSlot = slot
 			logrus.Infof("starting slot: %d", slot)
 			logrus.Debugf("got starting slot in %s", time.Since(start))
 		}
 
 		// go through data files
+		stop := make(chan struct{})
+		// the streams have deleted their files once done, so the next run
+		// can unzip to the same names
+		streams := sync.WaitGroup{}
 		dataChans := make([]chan []byte, len(unzippedFiles))
 		for i, v := range unzippedFiles {
-			dataChans[i] = make(chan []byte, 1)
-			err := o.streamFromFile(v, dataChans[i])
+			dataChans[i] = make(chan []byte, o.params.buffer)
+			if reverse {
+				err = o.streamFromFileReverse(v, dataChans[i], stop, &streams)
+			} else {
+				err = o.streamFromFile(v, dataChans[i], stop, &streams)
+			}
 			if err != nil {
 				return err
 			}
 		}
 
 		buffers := make([][]byte, len(dataChans))
+		// the slots of the buffered rows
+		bufferSlots := make([]uint64, len(dataChans))
 		dones := make([]bool, len(dataChans))
+	rows:
 		for {
+			// the rows of the current slot from every file, in file order
+			batch := []slotRow{}
 			for i, dataChan := range dataChans {
 				for {
 					// used buffered row before checking the channel
@@ -223,42 +558,76 @@ func (o *SimulateTask) RunSimulation(ctx context.Context, simID int) error {
 					if len(buffers[i]) != 0 {
 						dataRow = buffers[i]
 					} else {
+						queues.Observe(len(dataChan))
 						dataRow = <-dataChan
 					}
 					if len(dataRow) == 0 {
 						dones[i] = true
 						break
 					}
+					// cheap check to skip other event types without parsing them
+					if onlyField != nil && !bytes.Contains(dataRow, onlyField) {
+						buffers[i] = []byte{}
+						continue
+					}
 					data := DataFormat{}
 					err := json.Unmarshal(dataRow, &data)
 					if err != nil {
 						return errors.Wrap(err, "cant unmarshal event")
 					}
+					if onlyField != nil && !slotRowHas(data, onlyRowFields[o.params.only]) {
+						buffers[i] = []byte{}
+						continue
+					}
 
 					// if we are in the future, save the row for later and continue
-					if data.Slot > slot {
+					if (!reverse && data.Slot > slot) || (reverse && data.Slot < slot) {
 						buffers[i] = dataRow
+						bufferSlots[i] = data.Slot
 						break
 					} else {
 						buffers[i] = []byte{}
 					}
+					batch = append(batch, slotRow{data: data, row: dataRow})
+				}
+			}
 
-					// at this point we should be in order so post
-					// fmt.Println(string(dataRow))
-					ev := JSONRPC{}
-					if o.pairsSubID != 0 && data.Pair != nil {
-						ev.Method = "newPairNotification"
-						ev.Params = dataRow
-						ev.SubscriptionID = (o.pairsSubID)
-						o.outputFeed <- ev
+			// at this point we should be in order so post
+			order.Sort(batch)
+			batch, err = injector.Inject(slot, batch)
+			if err != nil {
+				return err
+			}
+			o.ui.SetSlot(slot)
+			for _, v := range batch {
+				// paused or slowed down from the web UI
+				if err := o.ui.Wait(ctx); err != nil {
+					return err
+				}
+				dataRow := v.row
+				if o.params.remapSlotsFrom != 0 {
+					dataRow, err = remapSlot(dataRow, o.params.remapSlotsFrom+slotsSent())
+					if err != nil {
+						return err
+					}
+				}
+				for _, feed := range simulatorFeeds {
+					subID, ok := o.subscriptions[feed.SubscribeMethod()]
+					if !ok || !feed.Matches(v.data) {
+						continue
 					}
-					if o.swapsSubID != 0 && data.Swap != nil {
-						ev.Method = "swapNotification"
-						ev.Params = dataRow
-						ev.SubscriptionID = (o.swapsSubID)
-						o.outputFeed <- ev
+					notification := JSONRPC{
+						Method:         feed.NotificationMethod(),
+						Params:         dataRow,
+						SubscriptionID: subID,
 					}
-					events++
+					o.outputFeed <- notification
+					o.ui.Emitted(notification, v.data)
+				}
+				events++
+				if o.limitReached(events, slotsSent()) {
+					limited = true
+					break rows
 				}
 			}
 			// fmt.Println("events, ", events)
@@ -270,51 +639,273 @@ func (o *SimulateTask) RunSimulation(ctx context.Context, simID int) error {
 			if done {
 				break
 			}
-			slot++
+			slot = o.nextSlot(slot, startingSlot, bufferSlots, buffers, injector, reverse)
+			if o.limitReached(events, slotsSent()) {
+				limited = true
+				break
+			}
+		}
+		close(stop)
+		streams.Wait()
+		if limited {
+			logrus.Infof("simulation limit reached")
+			break
 		}
 	}
 	logrus.Infof("simulated events: %d", events)
-	logrus.Infof("ending slot: %d", slot-1)
+	queues.Log()
+	if pending := injector.Pending(); pending != 0 && !limited {
+		logrus.Warnf("%d injections were not emitted as their slots were not replayed or had no event to copy", pending)
+	}
+	if reverse {
+		logrus.Infof("ending slot: %d", slot+1)
+	} else {
+		logrus.Infof("ending slot: %d", slot-1)
+	}
 
 	return nil
 }
 
+// unzipArchive writes each file in the archive to the tmp dir, with the suffix
+// added to its name, and returns their paths in the data dir
+func (o *SimulateTask) unzipArchive(archive string, suffix string) ([]string, error) {
+	r, ra, closer, err := openArchiveAt(o.params.dataDir + "/" + archive)
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	unzippedFiles := []string{}
+	for _, f := range r.File {
+		rc, err := o.openEntry(ra, f)
+		if err != nil {
+			return nil, err
+		}
+		tmpFile := fmt.Sprintf("%s/%s.%s", tmpDir, f.Name, suffix)
+		outFile, err := os.OpenFile(fmt.Sprintf("%s/%s", o.params.dataDir, tmpFile), os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+		if err != nil {
+			return nil, err
+		}
+		if o.params.fromSlot != 0 {
+			err = copyFromSlot(outFile, rc, uint64(o.params.fromSlot))
+		} else {
+			_, err = io.Copy(outFile, rc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		rc.Close()
+		outFile.Close()
+		unzippedFiles = append(unzippedFiles, tmpFile)
+	}
+	return unzippedFiles, nil
+}
+
+// subscribedFiles drops the files of split orders whose dataset has no
+// subscriptions, so e.g. swaps are not read for a client only watching pairs
+func (o *SimulateTask) subscribedFiles(files []string) []string {
+	subscribed := []string{}
+	for _, v := range files {
+		_, dataset := splitDataset(v)
+		if dataset == "" || slices.ContainsFunc(datasetFeeds[dataset], func(method string) bool {
+			_, ok := o.subscriptions[method]
+			return ok
+		}) {
+			subscribed = append(subscribed, v)
+		}
+	}
+	return subscribed
+}
+
 type DataFormat struct {
-	Slot uint64    `json:"slot"`
-	Pair *struct{} `json:"pair"`
-	Swap *struct{} `json:"swap"`
+	Slot            uint64    `json:"slot"`
+	Signature       string    `json:"signature"`
+	TxIndex         *uint64   `json:"transactionIndex"`
+	Pair            *struct{} `json:"pair"`
+	Swap            *struct{} `json:"swap"`
+	LiquidityUpdate *struct{} `json:"liquidityUpdate"`
 }
 
 func (o *SimulateTask) validateParams() error {
-	if o.params.fromSlot != 0 && o.params.fromDate == "" {
-		return errors.New("from-date must be specified when from-slot is set")
+	if o.params.fromSlot != 0 && o.params.direction == DirectionReverse {
+		return errors.New("from-slot can only be used when replaying forward")
+	}
+	if o.params.fromDate != "" {
+		if o.params.fromSlot != 0 {
+			return errors.New("only one of from-date and from-slot can be specified")
+		}
+		if o.params.direction == DirectionReverse {
+			return errors.New("from-date can only be used when replaying forward")
+		}
+		fromDate, err := parseFromDate(o.params.fromDate)
+		if err != nil {
+			return errors.Wrap(err, "invalid from-date")
+		}
+		o.fromDate = fromDate
+	}
+	if o.params.direction != DirectionForward && o.params.direction != DirectionReverse {
+		return fmt.Errorf("direction must be '%s' or '%s'", DirectionForward, DirectionReverse)
+	}
+	if _, ok := onlyRowFields[o.params.only]; o.params.only != "" && !ok {
+		return errors.New("only must be 'swaps', 'pairs' or 'liquidity'")
+	}
+	if o.params.slotOrder != SlotOrderFile && o.params.slotOrder != SlotOrderIndex && o.params.slotOrder != SlotOrderShuffle {
+		return fmt.Errorf("slot-order must be '%s', '%s' or '%s'", SlotOrderFile, SlotOrderIndex, SlotOrderShuffle)
 	}
+	if o.params.prefer != "" && o.params.prefer != PreferReduced && o.params.prefer != PreferOriginal {
+		return fmt.Errorf("prefer must be '%s' or '%s'", PreferReduced, PreferOriginal)
+	}
+	if o.params.buffer < 0 {
+		return errors.New("buffer must not be negative")
+	}
+	if err := o.trash.Validate(); err != nil {
+		return err
+	}
+	if err := o.datasets.Parse(); err != nil {
+		return err
+	}
+	if o.params.catchUp && o.params.apiKey == "" {
+		return errors.New("key must be specified in catch up mode")
+	}
+	if o.params.catchUp && o.params.direction == DirectionReverse {
+		return errors.New("catch up mode can only replay forward")
+	}
+	notifications, err := o.envelope.Load()
+	if err != nil {
+		return err
+	}
+	o.notifications = notifications
+	tenants, err := parseTenants(o.params.tenants)
+	if err != nil {
+		return errors.Wrap(err, "invalid dataset")
+	}
+	o.tenants = tenants
 	return nil
 }
 
 func (o *SimulateTask) getDataFiles() ([]string, error) {
-	// loop through dir contents
-	files, err := os.ReadDir(o.params.dataDir)
+	files, err := listArchiveFiles(o.params.dataDir)
 	if err != nil {
 		return nil, err
 	}
-	filtered := []string{}
-	for _, v := range files {
-		if v.IsDir() {
-			continue
+	return resolveOverlaps(o.params.dataDir, o.datasets.Select(files), o.params.prefer)
+}
+
+// resolveFromDate sets from-slot to the first slot at or after from-date
+func (o *SimulateTask) resolveFromDate() error {
+	files, err := o.getDataFiles()
+	if err != nil {
+		return err
+	}
+	slot, err := resolveFromDate(o.params.dataDir, files, o.fromDate)
+	if err != nil {
+		return err
+	}
+	if slot == 0 {
+		return withKind(ErrNoRows, fmt.Errorf("no events at or after %s in %s", o.fromDate.UTC().Format(time.RFC3339), o.params.dataDir))
+	}
+	logrus.Infof("from-date %s resolved to slot %d", o.fromDate.UTC().Format(time.RFC3339), slot)
+	o.params.fromSlot = uint(slot)
+	return nil
+}
+
+// remapSlot replaces the slot of an event row, keeping the rest of the row as
+// it is
+func remapSlot(row []byte, slot uint64) ([]byte, error) {
+	if remapped, ok := setJSONField(row, "slot", []byte(strconv.FormatUint(slot, 10))); ok {
+		return remapped, nil
+	}
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(row, &fields); err != nil {
+		return nil, errors.Wrap(err, "cant unmarshal event")
+	}
+	fields["slot"] = json.RawMessage(strconv.FormatUint(slot, 10))
+	return json.Marshal(fields)
+}
+
+// openEntry opens an archive entry, starting near from-slot if the entry is
+// seekable
+func (o *SimulateTask) openEntry(ra io.ReaderAt, f *zip.File) (io.ReadCloser, error) {
+	if o.params.fromSlot != 0 {
+		entry, err := openSeekableEntry(ra, f)
+		if err != nil {
+			return nil, err
 		}
-		// check extension
-		if len(v.Name()) < 4 || v.Name()[len(v.Name())-4:] != ".zip" {
+		if entry != nil {
+			return entry.ReadFromSlot(uint64(o.params.fromSlot))
+		}
+	}
+	return f.Open()
+}
+
+// copyFromSlot copies the rows at or after slot
+func copyFromSlot(w io.Writer, r io.Reader, slot uint64) error {
+	bw := bufio.NewWriter(w)
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxRowSize)
+	for scanner.Scan() {
+		row := scanner.Bytes()
+		if len(row) == 0 || rowSlot(row) < slot {
 			continue
 		}
-		filtered = append(filtered, v.Name())
+		bw.Write(row)
+		bw.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// nextSlot returns the next slot with an event or injection to replay after
+// slot, jumping over the empty slots between them which reduced archives have
+// millions of. Events are paced as they are emitted so the empty slots took no
+// time anyway. The jump stops at --limit-slots so the simulation ends there.
+func (o *SimulateTask) nextSlot(slot uint64, startingSlot uint64, bufferSlots []uint64, buffers [][]byte, injector *injector, reverse bool) uint64 {
+	next, found := uint64(0), false
+	consider := func(v uint64) {
+		if !found || (!reverse && v < next) || (reverse && v > next) {
+			next, found = v, true
+		}
+	}
+	for i, v := range buffers {
+		if len(v) != 0 {
+			consider(bufferSlots[i])
+		}
+	}
+	if v, ok := injector.Next(slot, reverse); ok {
+		consider(v)
+	}
+	if o.params.limitSlots != 0 {
+		if !reverse {
+			consider(startingSlot + o.params.limitSlots)
+		} else if startingSlot >= o.params.limitSlots {
+			consider(startingSlot - o.params.limitSlots)
+		}
+	}
+	if found {
+		return next
+	}
+	if reverse {
+		return slot - 1
 	}
-	// ensure they are ordered by date (oldest first)
-	return filtered, nil
+	return slot + 1
 }
 
-func (o *SimulateTask) streamFromFile(fileName string, rows chan []byte) error {
+// limitReached reports whether --limit-events or --limit-slots has been hit
+func (o *SimulateTask) limitReached(events uint, slots uint64) bool {
+	if o.params.limitEvents != 0 && events >= o.params.limitEvents {
+		return true
+	}
+	return o.params.limitSlots != 0 && slots >= o.params.limitSlots
+}
+
+// streamFromFile sends each row of the file to rows then closes it. Closing
+// stop ends streaming early. The file is deleted either way, before streams
+// is done.
+func (o *SimulateTask) streamFromFile(fileName string, rows chan []byte, stop <-chan struct{}, streams *sync.WaitGroup) error {
+	streams.Add(1)
 	go func() {
+		defer streams.Done()
 
 		file, err := os.Open(o.params.dataDir + "/" + fileName)
 		if err != nil {
@@ -329,25 +920,99 @@ func (o *SimulateTask) streamFromFile(fileName string, rows chan []byte) error {
 			// make a copy otherwise row buf is overwritten by goroutines before being used down the line
 			buf := make([]byte, len(row))
 			copy(buf, row)
-			rows <- buf
+			select {
+			case rows <- buf:
+			case <-stop:
+				o.removeInterimFile(fileName)
+				return
+			}
 		}
 
 		if err := scanner.Err(); err != nil {
 			logrus.Fatal(err)
 		}
-		// delete file
-		err = os.Remove(o.params.dataDir + "/" + fileName)
-		if err != nil {
-			logrus.Warnf("could not delete interrim file (your disk space may be used up quickly) %s: %s", fileName, err.Error())
+		o.removeInterimFile(fileName)
+		close(rows)
+	}()
+	return nil
+}
+
+// streamFromFileReverse is streamFromFile but sends the rows last first
+func (o *SimulateTask) streamFromFileReverse(fileName string, rows chan []byte, stop <-chan struct{}, streams *sync.WaitGroup) error {
+	index, err := newLineIndex(o.params.dataDir + "/" + fileName)
+	if err != nil {
+		return err
+	}
+	streams.Add(1)
+	go func() {
+		defer streams.Done()
+		defer o.removeInterimFile(fileName)
+		defer index.Close()
+		for i := index.Len() - 1; i >= 0; i-- {
+			row, err := index.Line(i)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			if len(row) == 0 {
+				continue
+			}
+			select {
+			case rows <- row:
+			case <-stop:
+				return
+			}
 		}
 		close(rows)
 	}()
 	return nil
 }
 
-func (o *SimulateTask) getStartingSlot(unzippedFiles []string) (uint64, error) {
+// getLastSlot returns the slot of the last row in the file
+func (o *SimulateTask) getLastSlot(fileName string) (uint64, error) {
+	index, err := newLineIndex(o.params.dataDir + "/" + fileName)
+	if err != nil {
+		return 0, err
+	}
+	defer index.Close()
+	for i := index.Len() - 1; i >= 0; i-- {
+		row, err := index.Line(i)
+		if err != nil {
+			return 0, err
+		}
+		if len(row) == 0 {
+			continue
+		}
+		data := DataFormat{}
+		if err := json.Unmarshal(row, &data); err != nil {
+			return 0, errors.Wrap(err, "cant unmarshal event")
+		}
+		return data.Slot, nil
+	}
+	return 0, nil
+}
+
+func (o *SimulateTask) removeInterimFile(fileName string) {
+	err := o.trash.Remove(o.params.dataDir + "/" + fileName)
+	if err != nil {
+		logrus.Warnf("could not delete interrim file (your disk space may be used up quickly) %s: %s", fileName, err.Error())
+	}
+}
+
+// getStartingSlot returns the earliest first slot of the files, or the latest
+// last slot when replaying in reverse
+func (o *SimulateTask) getStartingSlot(unzippedFiles []string, reverse bool) (uint64, error) {
 	var startingSlot uint64
 	for _, v := range unzippedFiles {
+		if reverse {
+			slot, err := o.getLastSlot(v)
+			if err != nil {
+				return 0, err
+			}
+			if slot > startingSlot {
+				startingSlot = slot
+			}
+			continue
+		}
 		file, err := os.Open(o.params.dataDir + "/" + v)
 		if err != nil {
 			return 0, err
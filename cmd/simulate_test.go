@@ -2,14 +2,632 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/test-go/testify/assert"
 )
 
 func TestSimulateTask(t *testing.T) {
 	st := NewSimulateTask()
-	st.params.dataDir = "../out"
+	st.params.dataDir = copyFixtures(t)
 	err := st.RunSimulation(context.Background(), 1)
 	assert.Nil(t, err)
 }
+
+func TestSimulateFeeds(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"pairs.json":     "{\"slot\":1,\"pair\":{}}\n",
+		"swaps.json":     "{\"slot\":2,\"swap\":{}}\n",
+		"liquidity.json": "{\"slot\":3,\"liquidityUpdate\":{}}\n",
+	})
+	st := NewSimulateTask()
+	st.params.dataDir = dataDir
+	_, ok := st.subscribe("unknownSubscribe")
+	assert.False(t, ok)
+	swapsSubID, ok := st.subscribe(MethodSwapSubscribe)
+	assert.True(t, ok)
+	liquiditySubID, ok := st.subscribe(MethodPairLiquidityUpdatesSubscribe)
+	assert.True(t, ok)
+
+	events := []JSONRPC{}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for v := range st.outputFeed {
+			events = append(events, v)
+		}
+	}()
+	err := st.RunSimulation(context.Background(), 1)
+	close(st.outputFeed)
+	<-drained
+	assert.Nil(t, err)
+
+	// pairs were not subscribed to
+	assert.Len(t, events, 2)
+	assert.Equal(t, "swapNotification", events[0].Method)
+	assert.Equal(t, swapsSubID, events[0].SubscriptionID)
+	assert.Equal(t, "pairLiquidityUpdatesNotification", events[1].Method)
+	assert.Equal(t, liquiditySubID, events[1].SubscriptionID)
+}
+
+func TestSimulateLimits(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n{\"slot\":2,\"swap\":{}}\n{\"slot\":3,\"swap\":{}}\n{\"slot\":4,\"swap\":{}}\n{\"slot\":5,\"swap\":{}}\n",
+	})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": "{\"slot\":6,\"swap\":{}}\n",
+	})
+	run := func(limitEvents uint, limitSlots uint64) int {
+		st := NewSimulateTask()
+		st.params.dataDir = dataDir
+		st.params.limitEvents = limitEvents
+		st.params.limitSlots = limitSlots
+		st.subscribe(MethodSwapSubscribe)
+		events := 0
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			for range st.outputFeed {
+				events++
+			}
+		}()
+		err := st.RunSimulation(context.Background(), 1)
+		close(st.outputFeed)
+		<-drained
+		assert.Nil(t, err)
+		return events
+	}
+	assert.Equal(t, 6, run(0, 0))
+	assert.Equal(t, 2, run(2, 0))
+	assert.Equal(t, 3, run(0, 3))
+	assert.Equal(t, 2, run(2, 3))
+}
+
+func TestSimulateSparseSlots(t *testing.T) {
+	dataDir := t.TempDir()
+	// billions of empty slots, which would take minutes to step through
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n{\"slot\":2000000000,\"swap\":{}}\n{\"slot\":4000000000,\"swap\":{}}\n",
+	})
+	run := func(reverse bool, limitSlots uint64, injections []Injection) []uint64 {
+		st := NewSimulateTask()
+		st.params.dataDir = dataDir
+		st.params.limitSlots = limitSlots
+		st.injections = injections
+		if reverse {
+			st.params.direction = DirectionReverse
+		}
+		st.subscribe(MethodSwapSubscribe)
+		slots := []uint64{}
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			for v := range st.outputFeed {
+				slots = append(slots, rowSlot(v.Params))
+			}
+		}()
+		err := st.RunSimulation(context.Background(), 1)
+		close(st.outputFeed)
+		<-drained
+		assert.Nil(t, err)
+		return slots
+	}
+	assert.Equal(t, []uint64{1, 2000000000, 4000000000}, run(false, 0, nil))
+	assert.Equal(t, []uint64{4000000000, 2000000000, 1}, run(true, 0, nil))
+	assert.Equal(t, []uint64{1}, run(false, 2000000000-1, nil))
+	assert.Equal(t, []uint64{1, 2000000000}, run(false, 2000000000, nil))
+	// injections in empty slots are still emitted
+	injected := []Injection{{Slot: 3000000000, Event: json.RawMessage(`{"swap":{}}`)}}
+	assert.Equal(t, []uint64{1, 2000000000, 3000000000, 4000000000}, run(false, 0, injected))
+}
+
+func TestSimulateReverse(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"pairs.json": "{\"slot\":1,\"pair\":{}}\n{\"slot\":3,\"pair\":{}}\n",
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n{\"slot\":2,\"swap\":{}}\n{\"slot\":4,\"swap\":{}}",
+	})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": "{\"slot\":5,\"swap\":{}}\n{\"slot\":6,\"swap\":{}}\n",
+	})
+	run := func(limitSlots uint64) []uint64 {
+		st := NewSimulateTask()
+		st.params.dataDir = dataDir
+		st.params.direction = DirectionReverse
+		st.params.limitSlots = limitSlots
+		st.subscribe(MethodSwapSubscribe)
+		st.subscribe(MethodNewPairSubscribe)
+		slots := []uint64{}
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			for v := range st.outputFeed {
+				data := DataFormat{}
+				assert.Nil(t, json.Unmarshal(v.Params, &data))
+				slots = append(slots, data.Slot)
+			}
+		}()
+		err := st.RunSimulation(context.Background(), 1)
+		close(st.outputFeed)
+		<-drained
+		assert.Nil(t, err)
+		return slots
+	}
+	assert.Equal(t, []uint64{6, 5, 4, 3, 2, 1, 1}, run(0))
+	assert.Equal(t, []uint64{6, 5, 4}, run(3))
+}
+
+func TestSimulateRemapSlots(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":10,\"swap\":{\"slot\":10}}\n{\"slot\":10,\"swap\":{}}\n{\"slot\":13,\"swap\":{}}\n",
+	})
+	for _, direction := range []string{DirectionForward, DirectionReverse} {
+		st := NewSimulateTask()
+		st.params.dataDir = dataDir
+		st.params.direction = direction
+		st.params.remapSlotsFrom = 1000
+		st.subscribe(MethodSwapSubscribe)
+		rows := []string{}
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			for v := range st.outputFeed {
+				rows = append(rows, string(v.Params))
+			}
+		}()
+		err := st.RunSimulation(context.Background(), 1)
+		close(st.outputFeed)
+		<-drained
+		assert.Nil(t, err)
+		if direction == DirectionForward {
+			assert.Equal(t, []string{
+				`{"slot":1000,"swap":{"slot":10}}`,
+				`{"slot":1000,"swap":{}}`,
+				`{"slot":1003,"swap":{}}`,
+			}, rows)
+		} else {
+			assert.Equal(t, []string{
+				`{"slot":1000,"swap":{}}`,
+				`{"slot":1003,"swap":{}}`,
+				`{"slot":1003,"swap":{"slot":10}}`,
+			}, rows)
+		}
+	}
+}
+
+func TestSimulateCatchUp(t *testing.T) {
+	liveServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "test-key", r.Header.Get("X-API-KEY"))
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer c.Close()
+		request := JSONRPC{}
+		assert.Nil(t, c.ReadJSON(&request))
+		assert.Equal(t, MethodSwapSubscribe, request.Method)
+		assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"id":%d,"result":{"subscription_id":77}}`, request.ID))))
+		assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(`{"method":"swapNotification","subscription_id":77,"params":{"slot":99}}`)))
+		// wait for the client to go away
+		c.ReadMessage()
+	}))
+	defer liveServer.Close()
+
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n",
+	})
+	st := NewSimulateTask()
+	st.params.dataDir = dataDir
+	st.params.catchUp = true
+	st.params.liveURL = "ws" + strings.TrimPrefix(liveServer.URL, "http")
+	st.params.apiKey = "test-key"
+	server := httptest.NewServer(st.websocketHandler(context.Background()))
+	defer server.Close()
+
+	c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	assert.Nil(t, err)
+	defer c.Close()
+	assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(`{"id":1,"method":"swapSubscribe"}`)))
+	response := struct {
+		Result struct {
+			SubscriptionID uint `json:"subscription_id"`
+		} `json:"result"`
+	}{}
+	assert.Nil(t, c.ReadJSON(&response))
+	assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(`{"id":2,"method":"startSimulation"}`)))
+
+	c.SetReadDeadline(time.Now().Add(10 * time.Second))
+	replayed := JSONRPC{}
+	assert.Nil(t, c.ReadJSON(&replayed))
+	assert.JSONEq(t, `{"slot":1,"swap":{}}`, string(replayed.Params))
+	// the live notification arrives with the id the simulator gave the client,
+	// framed as the live feed sent it
+	_, live, err := c.ReadMessage()
+	assert.Nil(t, err)
+	assert.Equal(t, fmt.Sprintf(`{"method":"swapNotification","subscription_id":%d,"params":{"slot":99}}`, response.Result.SubscriptionID), string(live))
+}
+
+func TestSimulateTenants(t *testing.T) {
+	dirA, dirB := t.TempDir(), t.TempDir()
+	writeTestArchive(t, dirA+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n",
+	})
+	writeTestArchive(t, dirB+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":7,\"swap\":{}}\n",
+	})
+	st := NewSimulateTask()
+	tenants, err := parseTenants("suite-a=" + dirA + ",suite-b=" + dirB)
+	assert.Nil(t, err)
+	st.tenants = tenants
+	handler, release, err := st.handler(context.Background())
+	defer release()
+	assert.Nil(t, err)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// websocket clients are routed by path or header
+	subscribe := func(path string, header http.Header) {
+		c, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+path, header)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer c.Close()
+		assert.Nil(t, c.WriteMessage(websocket.TextMessage, []byte(`{"id":1,"method":"swapSubscribe"}`)))
+		c.SetReadDeadline(time.Now().Add(10 * time.Second))
+		_, response, err := c.ReadMessage()
+		assert.Nil(t, err)
+		assert.Equal(t, string(subscribeResult(1, 1)), string(response))
+	}
+	subscribe("/suite-a", nil)
+	subscribe("/", http.Header{"X-API-KEY": []string{"suite-b"}})
+
+	// each key is served its own data dir
+	files := func(path string, key string) FilesResponse {
+		request := httptest.NewRequest(http.MethodGet, path, nil)
+		request.Header.Set("X-API-KEY", key)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := FilesResponse{}
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		return response
+	}
+	assert.Equal(t, dirA, files("/suite-a/files", "").DataDir)
+	assert.Equal(t, uint64(1), files("/suite-a/files", "").FirstSlot)
+	assert.Equal(t, dirB, files("/files", "suite-b").DataDir)
+	assert.Equal(t, uint64(7), files("/suite-b/files", "").FirstSlot)
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/suite-a", nil))
+	assert.Equal(t, http.StatusMovedPermanently, recorder.Code)
+	assert.Equal(t, "/suite-a/", recorder.Header().Get("Location"))
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/suite-c/", nil))
+	assert.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestParseTenants(t *testing.T) {
+	tenants, err := parseTenants(" a=out-a, b=out-b")
+	assert.Nil(t, err)
+	assert.Equal(t, []simTenant{{key: "a", dataDir: "out-a"}, {key: "b", dataDir: "out-b"}}, tenants)
+	for _, v := range []string{"a", "=out", "a=", "a/b=out", "a=-", "a=out,a=out2"} {
+		_, err := parseTenants(v)
+		assert.NotNil(t, err, v)
+	}
+}
+
+func TestSimulateOrdersFilesByTime(t *testing.T) {
+	scheme, err := parseArchiveNameScheme("swaps-{2006-01-02T15}.zip")
+	assert.Nil(t, err)
+	defaultNames := archiveNames
+	archiveNames = scheme
+	defer func() { archiveNames = defaultNames }()
+
+	// listed by name the downloaded file would come first
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": "{\"slot\":2,\"swap\":{}}\n",
+	})
+	writeTestArchive(t, dataDir+"/swaps-2024-05-05T12.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n",
+	})
+	st := NewSimulateTask()
+	st.params.dataDir = dataDir
+	st.subscribe(MethodSwapSubscribe)
+	slots := []uint64{}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for v := range st.outputFeed {
+			data := DataFormat{}
+			assert.Nil(t, json.Unmarshal(v.Params, &data))
+			slots = append(slots, data.Slot)
+		}
+	}()
+	err = st.RunSimulation(context.Background(), 1)
+	close(st.outputFeed)
+	<-drained
+	assert.Nil(t, err)
+	assert.Equal(t, []uint64{1, 2}, slots)
+}
+
+func TestSimulateOverlappingHours(t *testing.T) {
+	scheme, err := parseArchiveNameScheme("reduced-{2006-01-02T15}.zip")
+	assert.Nil(t, err)
+	defaultNames := archiveNames
+	archiveNames = scheme
+	defer func() { archiveNames = defaultNames }()
+
+	wallet := fixtureKey("wallet-a", "")
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{\"walletAccount\":\"" + wallet + "\"}}\n{\"slot\":2,\"swap\":{}}\n",
+	})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": "{\"slot\":3,\"swap\":{}}\n",
+	})
+	reduce := NewReduceTask()
+	reduce.params.dataInDir = dataDir
+	reduce.params.dataOutDir = t.TempDir()
+	reduce.params.concurrency = 1
+	reduce.params.wallets = wallet
+	assert.Nil(t, reduce.Execute(context.Background()))
+	raw, err := os.ReadFile(reduce.params.dataOutDir + "/20240505-120000.zip")
+	assert.Nil(t, err)
+	assert.Nil(t, os.WriteFile(dataDir+"/reduced-2024-05-05T12.zip", raw, 0644))
+
+	st := NewSimulateTask()
+	st.params.dataDir = dataDir
+	_, err = st.getDataFiles()
+	assert.True(t, errors.Is(err, ErrUsage))
+	assert.Contains(t, err.Error(), "--prefer")
+
+	st.params.prefer = PreferReduced
+	files, err := st.getDataFiles()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"reduced-2024-05-05T12.zip", "20240505-130000.zip"}, files)
+
+	st.params.prefer = PreferOriginal
+	files, err = st.getDataFiles()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20240505-120000.zip", "20240505-130000.zip"}, files)
+}
+
+func TestSimulateSlotOrder(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"events.json": "{\"slot\":1,\"signature\":\"c\",\"transactionIndex\":5,\"pair\":{}}\n{\"slot\":1,\"signature\":\"b\",\"swap\":{}}\n{\"slot\":1,\"signature\":\"d\",\"transactionIndex\":2,\"swap\":{}}\n{\"slot\":1,\"signature\":\"a\",\"swap\":{}}\n{\"slot\":2,\"signature\":\"e\",\"swap\":{}}\n",
+	})
+	run := func(order string, seed int64, direction string) []string {
+		st := NewSimulateTask()
+		st.params.dataDir = dataDir
+		st.params.slotOrder = order
+		st.params.shuffleSeed = seed
+		st.params.direction = direction
+		st.subscribe(MethodSwapSubscribe)
+		st.subscribe(MethodNewPairSubscribe)
+		signatures := []string{}
+		drained := make(chan struct{})
+		go func() {
+			defer close(drained)
+			for v := range st.outputFeed {
+				data := DataFormat{}
+				assert.Nil(t, json.Unmarshal(v.Params, &data))
+				signatures = append(signatures, data.Signature)
+			}
+		}()
+		err := st.RunSimulation(context.Background(), 1)
+		close(st.outputFeed)
+		<-drained
+		assert.Nil(t, err)
+		return signatures
+	}
+	assert.Equal(t, []string{"c", "b", "d", "a", "e"}, run(SlotOrderFile, 0, DirectionForward))
+	assert.Equal(t, []string{"d", "c", "a", "b", "e"}, run(SlotOrderIndex, 0, DirectionForward))
+	assert.Equal(t, []string{"e", "b", "a", "c", "d"}, run(SlotOrderIndex, 0, DirectionReverse))
+
+	shuffled := run(SlotOrderShuffle, 7, DirectionForward)
+	assert.Equal(t, shuffled, run(SlotOrderShuffle, 7, DirectionForward))
+	assert.Equal(t, "e", shuffled[4])
+	slices.Sort(shuffled)
+	assert.Equal(t, []string{"a", "b", "c", "d", "e"}, shuffled)
+}
+
+func TestSimulateInject(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{\"quoteAmount\":\"1\"}}\n{\"slot\":3,\"signature\":\"a\",\"swap\":{\"walletAccount\":\"w\",\"quoteAmount\":\"3\"}}\n",
+	})
+	path := t.TempDir() + "/injections.json"
+	assert.Nil(t, os.WriteFile(path, []byte(`[
+		{"slot": 2, "event": {"signature": "big", "swap": {"quoteAmount": "999999"}}},
+		{"slot": 3, "copy": "swap", "set": {"signature": "copy", "swap": {"quoteAmount": "5"}}},
+		{"slot": 3, "copy": "pair"}
+	]`), 0644))
+	injections, err := loadInjections(path)
+	assert.Nil(t, err)
+
+	st := NewSimulateTask()
+	st.params.dataDir = dataDir
+	st.injections = injections
+	st.subscribe(MethodSwapSubscribe)
+	rows := []string{}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for v := range st.outputFeed {
+			rows = append(rows, string(v.Params))
+		}
+	}()
+	err = st.RunSimulation(context.Background(), 1)
+	close(st.outputFeed)
+	<-drained
+	assert.Nil(t, err)
+	assert.Equal(t, []string{
+		`{"slot":1,"swap":{"quoteAmount":"1"}}`,
+		`{"signature":"big","slot":2,"swap":{"quoteAmount":"999999"}}`,
+		`{"slot":3,"signature":"a","swap":{"walletAccount":"w","quoteAmount":"3"}}`,
+		`{"signature":"copy","slot":3,"swap":{"quoteAmount":"5","walletAccount":"w"}}`,
+	}, rows)
+
+	for _, invalid := range []string{
+		`{"slot": 1}`,
+		`[{"event": {}}]`,
+		`[{"slot": 1, "copy": "swap", "event": {}}]`,
+		`[{"slot": 1, "copy": "block"}]`,
+		`[{"slot": 1, "event": {}, "set": {}}]`,
+		`[{"slot": 1, "event": [1]}]`,
+		`[{"slot": 1, "copy": "swap", "sett": {}}]`,
+	} {
+		assert.Nil(t, os.WriteFile(path, []byte(invalid), 0644))
+		_, err := loadInjections(path)
+		assert.NotNil(t, err, invalid)
+	}
+}
+
+func TestSimulateOnly(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"events.json": "{\"slot\":1,\"pair\":{}}\n{\"slot\":1,\"swap\":{\"swapType\":\"buy\"}}\n{\"slot\":2,\"swap\":{},\"note\":\"\\\"pair\\\"\"}\n{\"slot\":3,\"pair\":{}}\n",
+	})
+	st := NewSimulateTask()
+	st.params.dataDir = dataDir
+	st.params.only = "pairs"
+	st.subscribe(MethodSwapSubscribe)
+	st.subscribe(MethodNewPairSubscribe)
+	events := []JSONRPC{}
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		for v := range st.outputFeed {
+			events = append(events, v)
+		}
+	}()
+	err := st.RunSimulation(context.Background(), 1)
+	close(st.outputFeed)
+	<-drained
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+	for _, v := range events {
+		assert.Equal(t, "newPairNotification", v.Method)
+	}
+
+	st.params.direction = DirectionForward
+	st.params.slotOrder = SlotOrderFile
+	assert.Nil(t, st.validateParams())
+	st.params.only = "blocks"
+	assert.NotNil(t, st.validateParams())
+}
+
+func TestSimulateFilesEndpoint(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": "{\"slot\":20,\"swap\":{}}\n{\"slot\":25,\"swap\":{}}\n",
+	})
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"pairs.json": "{\"slot\":2,\"pair\":{}}\n",
+		"swaps.json": "{\"slot\":1,\"swap\":{}}\n{\"slot\":3,\"swap\":{}}\n",
+	})
+	st := NewSimulateTask()
+	st.params.dataDir = dataDir
+	get := func() FilesResponse {
+		recorder := httptest.NewRecorder()
+		st.filesHandler(recorder, httptest.NewRequest(http.MethodGet, "/files", nil))
+		assert.Equal(t, http.StatusOK, recorder.Code)
+		response := FilesResponse{}
+		assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+		return response
+	}
+
+	response := get()
+	assert.Equal(t, uint64(1), response.FirstSlot)
+	assert.Equal(t, uint64(25), response.LastSlot)
+	assert.Equal(t, uint64(5), response.Events)
+	assert.Len(t, response.Files, 2)
+	first := response.Files[0]
+	assert.Equal(t, "20240505-120000.zip", first.Name)
+	assert.Equal(t, uint64(1), first.FirstSlot)
+	assert.Equal(t, uint64(3), first.LastSlot)
+	assert.Equal(t, map[string]uint64{MethodSwapSubscribe: 2, MethodNewPairSubscribe: 1, MethodPairLiquidityUpdatesSubscribe: 0}, first.Counts)
+
+	// changed archives are read again
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": "{\"slot\":30,\"swap\":{}}\n",
+	})
+	response = get()
+	assert.Equal(t, uint64(30), response.LastSlot)
+	assert.Equal(t, uint64(4), response.Events)
+
+	recorder := httptest.NewRecorder()
+	st.filesHandler(recorder, httptest.NewRequest(http.MethodPost, "/files", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, recorder.Code)
+}
+
+func TestSimulateUI(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"signature\":\"a\",\"swap\":{}}\n{\"slot\":2,\"signature\":\"b\",\"swap\":{}}\n",
+	})
+	st := NewSimulateTask()
+	st.params.dataDir = dataDir
+	swapsSubID, _ := st.subscribe(MethodSwapSubscribe)
+	control := func(body string) (int, UIState) {
+		recorder := httptest.NewRecorder()
+		st.uiControlHandler(recorder, httptest.NewRequest(http.MethodPost, "/ui/control", strings.NewReader(body)))
+		state := UIState{}
+		if recorder.Code == http.StatusOK {
+			assert.Nil(t, json.Unmarshal(recorder.Body.Bytes(), &state))
+		}
+		return recorder.Code, state
+	}
+
+	// the page is served to requests which are not websocket upgrades
+	recorder := httptest.NewRecorder()
+	st.websocketHandler(context.Background())(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.True(t, strings.Contains(recorder.Body.String(), `fetch("ui/state")`))
+
+	code, _ := control(`{"rate":"fast"}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, state := control(`{"paused":true,"rate":"100/s"}`)
+	assert.Equal(t, http.StatusOK, code)
+	assert.True(t, state.Paused)
+	assert.Equal(t, "100/s", state.Rate)
+
+	done := make(chan error)
+	go func() {
+		done <- st.RunSimulation(context.Background(), 1)
+	}()
+	events := []JSONRPC{}
+	select {
+	case v := <-st.outputFeed:
+		t.Fatalf("event sent while paused: %v", v)
+	case <-time.After(300 * time.Millisecond):
+	}
+	control(`{"paused":false}`)
+	for range 2 {
+		events = append(events, <-st.outputFeed)
+	}
+	assert.Nil(t, <-done)
+	assert.Len(t, events, 2)
+
+	state = st.ui.State()
+	assert.Equal(t, uint64(2), state.Events)
+	assert.Equal(t, uint64(2), state.Slot)
+	assert.Len(t, state.Trace, 2)
+	assert.Equal(t, UITraceEvent{Time: state.Trace[1].Time, Method: "swapNotification", SubscriptionID: swapsSubID, Slot: 2, Signature: "b"}, state.Trace[1])
+}
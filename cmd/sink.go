@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Sink is a destination events are published to, such as stdout, a webhook or
+// a message bus. To add a destination implement Sink and add its flags to
+// sinkOptions, or load one without forking with --sink-exec or --sink-plugin.
+//
+// Open is called once before the first Publish and Close once after the last,
+// even when Open fails. Publish returns once the destination has accepted the
+// message, so callers know what has been delivered, and may be called
+// concurrently. A slow Publish is the backpressure: no more events are read
+// until it returns.
+type Sink interface {
+	Open(ctx context.Context) error
+	Publish(ctx context.Context, msg SinkMessage) error
+	Close() error
+}
+
+// SinkMessage is an event to publish
+type SinkMessage struct {
+	// stable across runs so destinations can drop duplicates after a resume,
+	// empty when there is no stable id e.g. live events
+	ID   string
+	Data []byte
+	// of Data, JSON when empty
+	ContentType string
+	// the parsed event, for templates
+	Event EventRow
+}
+
+const (
+	ContentTypeJSON  = "application/json"
+	ContentTypeProto = "application/x-protobuf"
+)
+
+// DataContentType returns the media type of the data
+func (o SinkMessage) DataContentType() string {
+	if o.ContentType == "" {
+		return ContentTypeJSON
+	}
+	return o.ContentType
+}
+
+// sinkOptions are the flags of commands which can publish to any of the
+// destinations. At most one can be used at a time.
+type sinkOptions struct {
+	nats   natsOptions
+	redis  redisOptions
+	amqp   amqpOptions
+	exec   execSinkOptions
+	plugin pluginSinkOptions
+	file   fileSinkOptions
+}
+
+func (o *sinkOptions) SetupParameters(cmd *cobra.Command) {
+	o.nats.SetupParameters(cmd, "")
+	o.redis.SetupParameters(cmd, "")
+	o.amqp.SetupParameters(cmd, "")
+	o.exec.SetupParameters(cmd)
+	o.plugin.SetupParameters(cmd)
+	o.file.SetupParameters(cmd)
+}
+
+// NewSink returns the destination picked by the flags, or nil when there is
+// none
+func (o *sinkOptions) NewSink() (Sink, string, error) {
+	set := map[string]bool{
+		"nats-url":    o.nats.url != "",
+		"redis-url":   o.redis.url != "",
+		"amqp-url":    o.amqp.url != "",
+		"sink-exec":   o.exec.command != "",
+		"sink-plugin": o.plugin.path != "",
+		"output":      o.file.path != "",
+	}
+	names := []string{}
+	for name, ok := range set {
+		if ok {
+			names = append(names, name)
+		}
+	}
+	switch {
+	case len(names) > 1:
+		return nil, "", withKind(ErrUsage, errors.New("only one of nats-url, redis-url, amqp-url, sink-exec, sink-plugin and output can be specified"))
+	case set["nats-url"]:
+		sink, err := o.nats.NewSink()
+		return sink, "NATS", err
+	case set["redis-url"]:
+		sink, err := o.redis.NewSink()
+		return sink, "Redis", err
+	case set["amqp-url"]:
+		sink, err := o.amqp.NewSink()
+		return sink, "AMQP", err
+	case set["sink-exec"]:
+		return o.exec.NewSink(), "exec", nil
+	case set["sink-plugin"]:
+		return o.plugin.NewSink(), "plugin", nil
+	case set["output"]:
+		sink, err := o.file.NewSink()
+		return sink, "file", err
+	}
+	return nil, "", nil
+}
+
+// writerSink writes each event as a line, for stdout
+type writerSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (o *writerSink) Open(ctx context.Context) error {
+	return nil
+}
+
+func (o *writerSink) Publish(ctx context.Context, msg SinkMessage) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	_, err := fmt.Fprintln(o.w, string(msg.Data))
+	return err
+}
+
+func (o *writerSink) Close() error {
+	return nil
+}
+
+// meteredSink counts what is published to a sink and how long it takes, for
+// the summary logged by Report
+type meteredSink struct {
+	Sink
+	name      string
+	published atomic.Uint64
+	failed    atomic.Uint64
+	// in nanoseconds
+	latency    atomic.Int64
+	maxLatency atomic.Int64
+}
+
+func newMeteredSink(sink Sink, name string) *meteredSink {
+	return &meteredSink{Sink: sink, name: name}
+}
+
+func (o *meteredSink) Publish(ctx context.Context, msg SinkMessage) error {
+	start := time.Now()
+	err := o.Sink.Publish(ctx, msg)
+	if err != nil {
+		o.failed.Add(1)
+		return err
+	}
+	latency := int64(time.Since(start))
+	o.published.Add(1)
+	o.latency.Add(latency)
+	for {
+		current := o.maxLatency.Load()
+		if latency <= current || o.maxLatency.CompareAndSwap(current, latency) {
+			break
+		}
+	}
+	return nil
+}
+
+// Report logs the counts and latency of publishes so far
+func (o *meteredSink) Report() {
+	published := o.published.Load()
+	average := time.Duration(0)
+	if published > 0 {
+		average = time.Duration(o.latency.Load() / int64(published))
+	}
+	logrus.Infof("%s sink: published %d, failed %d, average latency %s, max latency %s", o.name, published, o.failed.Load(), average.Round(time.Microsecond), time.Duration(o.maxLatency.Load()).Round(time.Microsecond))
+}
+
+// eventTemplate renders names such as NATS subjects from the fields of an
+// event e.g. "swaps.{exchange}.{mint}"
+type eventTemplate struct {
+	// literal text and field names alternate, starting with literal text
+	parts []string
+}
+
+// eventTemplateFields are the fields templates can use
+var eventTemplateFields = []string{"type", "exchange", "mint", "amm", "wallet", "slot"}
+
+// missing fields are rendered as this so names keep the same shape
+const eventTemplateMissing = "unknown"
+
+func parseEventTemplate(template string) (eventTemplate, error) {
+	parsed := eventTemplate{}
+	rest := template
+	for {
+		literal, after, ok := strings.Cut(rest, "{")
+		parsed.parts = append(parsed.parts, literal)
+		if !ok {
+			return parsed, nil
+		}
+		field, after, ok := strings.Cut(after, "}")
+		if !ok {
+			return eventTemplate{}, fmt.Errorf("template %q has an unclosed {", template)
+		}
+		if !inSlice(eventTemplateFields, field) {
+			return eventTemplate{}, fmt.Errorf("template %q has unknown field {%s}, must be one of: %s", template, field, strings.Join(eventTemplateFields, ", "))
+		}
+		parsed.parts = append(parsed.parts, field)
+		rest = after
+	}
+}
+
+func (o eventTemplate) Render(event EventRow) string {
+	b := strings.Builder{}
+	for i, v := range o.parts {
+		if i%2 == 0 {
+			b.WriteString(v)
+			continue
+		}
+		value := eventField(event, v)
+		if value == "" {
+			value = eventTemplateMissing
+		}
+		b.WriteString(value)
+	}
+	return b.String()
+}
+
+// eventField returns a template field of the event
+func eventField(event EventRow, field string) string {
+	switch field {
+	case "slot":
+		return strconv.FormatUint(event.Slot, 10)
+	case "type":
+		switch {
+		case event.Swap != nil:
+			return AlertEventSwap
+		case event.Pair != nil:
+			return AlertEventPair
+		case event.Graduation != nil:
+			return AlertEventGraduation
+		}
+	case "exchange":
+		switch {
+		case event.Swap != nil:
+			return event.Swap.SourceExchange
+		case event.Pair != nil:
+			return event.Pair.SourceExchange
+		case event.Graduation != nil:
+			return event.Graduation.Launchpad
+		}
+	case "mint":
+		switch {
+		case event.Swap != nil:
+			return event.Swap.BaseTokenMint
+		case event.Pair != nil:
+			return event.Pair.BaseToken.Account
+		case event.Graduation != nil:
+			return event.Graduation.BaseTokenMint
+		}
+	case "amm":
+		switch {
+		case event.Swap != nil:
+			return event.Swap.AmmAccount
+		case event.Pair != nil:
+			return event.Pair.AmmAccount
+		case event.Graduation != nil:
+			return event.Graduation.AmmAccount
+		}
+	case "wallet":
+		if event.Swap != nil {
+			return event.Swap.WalletAccount
+		}
+	}
+	return ""
+}
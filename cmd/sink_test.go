@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/test-go/testify/assert"
+)
+
+func TestEventTemplate(t *testing.T) {
+	template, err := parseEventTemplate("swaps.{exchange}.{mint}")
+	assert.Nil(t, err)
+	swap := EventRow{Slot: 7, Swap: &SwapEvent{SourceExchange: "raydium", BaseTokenMint: "mint-a"}}
+	assert.Equal(t, "swaps.raydium.mint-a", template.Render(swap))
+	pair := EventRow{Pair: &PairEvent{}}
+	assert.Equal(t, "swaps.unknown.unknown", template.Render(pair))
+
+	template, err = parseEventTemplate("{type}:{slot}")
+	assert.Nil(t, err)
+	assert.Equal(t, "swap:7", template.Render(swap))
+
+	template, err = parseEventTemplate("events")
+	assert.Nil(t, err)
+	assert.Equal(t, "events", template.Render(swap))
+
+	_, err = parseEventTemplate("swaps.{colour}")
+	assert.NotNil(t, err)
+	_, err = parseEventTemplate("swaps.{mint")
+	assert.NotNil(t, err)
+}
+
+func TestSinkOptions(t *testing.T) {
+	options := sinkOptions{}
+	sink, _, err := options.NewSink()
+	assert.Nil(t, err)
+	assert.Nil(t, sink)
+
+	options.redis.url = "redis://localhost"
+	options.redis.key = "events"
+	sink, name, err := options.NewSink()
+	assert.Nil(t, err)
+	assert.Equal(t, "Redis", name)
+	assert.NotNil(t, sink)
+
+	options.exec.command = "cat"
+	_, _, err = options.NewSink()
+	assert.True(t, errors.Is(err, ErrUsage))
+}
+
+func TestExecSink(t *testing.T) {
+	out := t.TempDir() + "/events"
+	// fails the event with an id of bad
+	options := execSinkOptions{command: `while read line; do case "$line" in *'"id":"bad"'*) echo "rejected";; *) echo "$line" >> ` + out + `; echo ok;; esac; done`}
+	sink := newMeteredSink(options.NewSink(), "exec")
+	assert.Nil(t, sink.Open(context.Background()))
+
+	assert.Nil(t, sink.Publish(context.Background(), SinkMessage{ID: "a:0", Data: []byte(`{"slot":1}`)}))
+	err := sink.Publish(context.Background(), SinkMessage{ID: "bad", Data: []byte(`{"slot":2}`)})
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "rejected")
+	assert.Nil(t, sink.Publish(context.Background(), SinkMessage{Data: []byte(`{"slot":3}`)}))
+	assert.Nil(t, sink.Close())
+
+	raw, err := os.ReadFile(out)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"id\":\"a:0\",\"event\":{\"slot\":1}}\n{\"event\":{\"slot\":3}}\n", string(raw))
+	assert.Equal(t, uint64(2), sink.published.Load())
+	assert.Equal(t, uint64(1), sink.failed.Load())
+}
+
+func TestExecSinkExits(t *testing.T) {
+	sink := (&execSinkOptions{command: "exit 3"}).NewSink()
+	assert.Nil(t, sink.Open(context.Background()))
+	assert.NotNil(t, sink.Publish(context.Background(), SinkMessage{Data: []byte(`{}`)}))
+	assert.NotNil(t, sink.Close())
+}
+
+func TestPluginSinkMissing(t *testing.T) {
+	sink := (&pluginSinkOptions{path: t.TempDir() + "/missing.so"}).NewSink()
+	assert.NotNil(t, sink.Open(context.Background()))
+	assert.Nil(t, sink.Close())
+}
+
+func TestFileSinkRotates(t *testing.T) {
+	dir := t.TempDir()
+	// left by a previous run
+	assert.Nil(t, os.WriteFile(dir+"/events.ndjson", []byte("{\"slot\":0}\n"), 0644))
+
+	options := fileSinkOptions{path: dir + "/events.ndjson", rotateSize: "20", compress: CompressNone, fsync: FsyncAlways}
+	sink, err := options.NewSink()
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Open(context.Background()))
+	for i := 1; i <= 3; i++ {
+		assert.Nil(t, sink.Publish(context.Background(), SinkMessage{Data: []byte(fmt.Sprintf(`{"slot":%d}`, i))}))
+	}
+	// the current file is readable while it is written
+	raw, err := os.ReadFile(dir + "/events.ndjson")
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"slot\":3}\n", string(raw))
+	assert.Nil(t, sink.Close())
+
+	files, err := filepath.Glob(dir + "/events-*.ndjson")
+	assert.Nil(t, err)
+	contents := []string{}
+	for _, v := range files {
+		raw, err := os.ReadFile(v)
+		assert.Nil(t, err)
+		contents = append(contents, string(raw))
+	}
+	slices.Sort(contents)
+	assert.Equal(t, []string{"{\"slot\":0}\n", "{\"slot\":1}\n{\"slot\":2}\n", "{\"slot\":3}\n"}, contents)
+	_, err = os.Stat(dir + "/events.ndjson")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestFileSinkCompresses(t *testing.T) {
+	dir := t.TempDir()
+	options := fileSinkOptions{path: dir + "/events.ndjson", compress: CompressZstd, fsync: FsyncRotate}
+	sink, err := options.NewSink()
+	assert.Nil(t, err)
+	assert.Nil(t, sink.Open(context.Background()))
+	assert.Nil(t, sink.Publish(context.Background(), SinkMessage{Data: []byte(`{"slot":1}`)}))
+	assert.Nil(t, sink.Close())
+
+	files, err := filepath.Glob(dir + "/events-*.ndjson.zst")
+	assert.Nil(t, err)
+	assert.Len(t, files, 1)
+	f, err := os.Open(files[0])
+	assert.Nil(t, err)
+	defer f.Close()
+	zr, err := zstd.NewReader(f)
+	assert.Nil(t, err)
+	defer zr.Close()
+	raw, err := io.ReadAll(zr)
+	assert.Nil(t, err)
+	assert.Equal(t, "{\"slot\":1}\n", string(raw))
+
+	options.fsync = "sometimes"
+	_, err = options.NewSink()
+	assert.True(t, errors.Is(err, ErrUsage))
+}
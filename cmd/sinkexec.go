@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// execSinkOptions are the flags of the exec sink adapter
+type execSinkOptions struct {
+	command string
+}
+
+func (o *execSinkOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.command, "sink-exec", "", "A command to publish events with, run through the system shell. Each event is written to its stdin as a JSON line and it must reply with a line of \"ok\" or an error for each, in order. See docs")
+}
+
+func (o *execSinkOptions) NewSink() *execSink {
+	return &execSink{command: o.command}
+}
+
+// execSinkLine is what the exec sink writes for each event
+type execSinkLine struct {
+	ID    string          `json:"id,omitempty"`
+	Event json.RawMessage `json:"event"`
+}
+
+// execSink is an adapter for destinations written in any language. The
+// command runs for the life of the sink and is piped the events, replying to
+// each so it can apply backpressure and report failures.
+type execSink struct {
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	// writes are serialised so the replies keep the order of the events
+	wmu sync.Mutex
+
+	mu      sync.Mutex
+	pending []chan error
+	err     error
+	exited  chan struct{}
+}
+
+func (o *execSink) Open(ctx context.Context) error {
+	o.cmd = shellCommand(context.WithoutCancel(ctx), o.command)
+	o.cmd.Stderr = os.Stderr
+	stdin, err := o.cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := o.cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := o.cmd.Start(); err != nil {
+		return errors.Wrap(err, "cant start the sink-exec command")
+	}
+	o.stdin = stdin
+	o.exited = make(chan struct{})
+	go o.read(stdout)
+	return nil
+}
+
+func (o *execSink) Publish(ctx context.Context, msg SinkMessage) error {
+	raw, err := json.Marshal(execSinkLine{ID: msg.ID, Event: msg.Data})
+	if err != nil {
+		return err
+	}
+	reply := make(chan error, 1)
+	o.wmu.Lock()
+	o.mu.Lock()
+	if o.err != nil {
+		o.mu.Unlock()
+		o.wmu.Unlock()
+		return o.err
+	}
+	o.pending = append(o.pending, reply)
+	o.mu.Unlock()
+	_, err = o.stdin.Write(append(raw, '\n'))
+	o.wmu.Unlock()
+	if err != nil {
+		return errors.Wrap(err, "cant write to the sink-exec command")
+	}
+
+	select {
+	case err := <-reply:
+		return err
+	case <-o.exited:
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		return o.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// read hands each reply to the oldest event waiting until the command exits
+func (o *execSink) read(stdout io.Reader) {
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		var result error
+		if line != "ok" {
+			result = errors.Errorf("sink-exec command failed to publish: %s", line)
+		}
+		o.mu.Lock()
+		if len(o.pending) == 0 {
+			o.mu.Unlock()
+			continue
+		}
+		next := o.pending[0]
+		o.pending = o.pending[1:]
+		o.mu.Unlock()
+		next <- result
+	}
+	o.mu.Lock()
+	if o.err == nil {
+		o.err = errors.New("the sink-exec command exited")
+	}
+	o.mu.Unlock()
+	close(o.exited)
+}
+
+// Close closes stdin so the command can finish and waits for it to exit
+func (o *execSink) Close() error {
+	if o.cmd == nil || o.cmd.Process == nil {
+		return nil
+	}
+	o.wmu.Lock()
+	o.stdin.Close()
+	o.wmu.Unlock()
+	<-o.exited
+	if err := o.cmd.Wait(); err != nil {
+		return errors.Wrap(err, "sink-exec command failed")
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"plugin"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// pluginSinkOptions are the flags of the Go plugin sink adapter
+type pluginSinkOptions struct {
+	path   string
+	config string
+}
+
+func (o *pluginSinkOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.path, "sink-plugin", "", "A Go plugin (.so) to publish events with. It must export Publish and may export Open and Close. See docs")
+	cmd.Flags().StringVar(&o.config, "sink-plugin-config", "", "Passed to the plugin's Open")
+}
+
+func (o *pluginSinkOptions) NewSink() *pluginSink {
+	return &pluginSink{path: o.path, config: o.config}
+}
+
+// pluginSink is an adapter for destinations built as Go plugins. The symbols
+// only use standard library types so plugins do not import this module:
+//
+//	func Open(ctx context.Context, config string) error
+//	func Publish(ctx context.Context, id string, event []byte) error
+//	func Close() error
+type pluginSink struct {
+	path    string
+	config  string
+	publish func(ctx context.Context, id string, event []byte) error
+	close   func() error
+}
+
+func (o *pluginSink) Open(ctx context.Context) error {
+	p, err := plugin.Open(o.path)
+	if err != nil {
+		return errors.Wrap(err, "cant load the sink plugin")
+	}
+	publish, err := p.Lookup("Publish")
+	if err != nil {
+		return errors.Wrap(err, "invalid sink plugin")
+	}
+	var ok bool
+	o.publish, ok = publish.(func(context.Context, string, []byte) error)
+	if !ok {
+		return fmt.Errorf("invalid sink plugin, Publish is a %T not a func(context.Context, string, []byte) error", publish)
+	}
+	if v, err := p.Lookup("Close"); err == nil {
+		o.close, ok = v.(func() error)
+		if !ok {
+			return fmt.Errorf("invalid sink plugin, Close is a %T not a func() error", v)
+		}
+	}
+	if v, err := p.Lookup("Open"); err == nil {
+		open, ok := v.(func(context.Context, string) error)
+		if !ok {
+			return fmt.Errorf("invalid sink plugin, Open is a %T not a func(context.Context, string) error", v)
+		}
+		return open(ctx, o.config)
+	}
+	return nil
+}
+
+func (o *pluginSink) Publish(ctx context.Context, msg SinkMessage) error {
+	return o.publish(ctx, msg.ID, msg.Data)
+}
+
+func (o *pluginSink) Close() error {
+	if o.close == nil {
+		return nil
+	}
+	return o.close()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var errSlotTimeFound = errors.New("found")
+
+// slotTime is the block time of a slot, as seen in an archive row
+type slotTime struct {
+	slot      uint64
+	blockTime int64
+}
+
+func slotTimeSlot(v slotTime) int64 {
+	return int64(v.slot)
+}
+
+func slotTimeBlockTime(v slotTime) int64 {
+	return v.blockTime
+}
+
+type SlotAtTask struct {
+	// the slot or time is written here, stdout unless testing
+	out    io.Writer
+	params struct {
+		dataDir string
+		time    string
+		slot    uint64
+	}
+}
+
+func NewSlotAtTask() *SlotAtTask {
+	return &SlotAtTask{out: os.Stdout}
+}
+
+func (o *SlotAtTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir of archive files to look up block times in")
+	cmd.Flags().StringVar(&o.params.time, "time", "", "Print the slot at this time, e.g. 2024-05-05T12:00:00Z or '2024-05-05 12:00' (UTC)")
+	cmd.Flags().Uint64Var(&o.params.slot, "slot", 0, "Print the block time of this slot")
+}
+
+func (o *SlotAtTask) GetMeta() Meta {
+	return Meta{
+		Name:        "SlotAtTask",
+		Use:         "slot-at",
+		Description: "Look up the slot at a time, or the time of a slot, from the block times in archive files.",
+	}
+}
+
+func (o *SlotAtTask) Execute(ctx context.Context) error {
+	if (o.params.time == "") == (o.params.slot == 0) {
+		return withKind(ErrUsage, errors.New("pass one of --time or --slot"))
+	}
+	// files are searched so stdin can not be used
+	if o.params.dataDir == pipeName {
+		return errPipeArchive()
+	}
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return withKind(ErrUsage, fmt.Errorf("no archive files found in %s", o.params.dataDir))
+	}
+
+	if o.params.slot != 0 {
+		blockTime, err := timeAtSlot(o.params.dataDir, files, o.params.slot)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(o.out, time.Unix(blockTime, 0).UTC().Format(time.RFC3339))
+		return err
+	}
+	t, err := parseFromDate(o.params.time)
+	if err != nil {
+		return withKind(ErrUsage, err)
+	}
+	slot, err := slotAtTime(o.params.dataDir, files, t)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(o.out, slot)
+	return err
+}
+
+// slotAtTime returns the first slot with a block time of t. When the archives
+// have no events at t, e.g. over a gap in the data, the slot is interpolated
+// from the events either side.
+func slotAtTime(dir string, files []string, t time.Time) (uint64, error) {
+	before, after, err := findSlotTimes(dir, files, slotTimeBlockTime, t.Unix())
+	if err != nil {
+		return 0, err
+	}
+	at := t.UTC().Format(time.RFC3339)
+	switch {
+	case after == nil:
+		return 0, withKind(ErrNoRows, fmt.Errorf("%s is after the last event in %s", at, dir))
+	case after.blockTime == t.Unix():
+		return after.slot, nil
+	case before == nil:
+		return 0, withKind(ErrNoRows, fmt.Errorf("%s is before the first event in %s", at, dir))
+	}
+	slot := uint64(interpolate(before.blockTime, int64(before.slot), after.blockTime, int64(after.slot), t.Unix()))
+	logrus.Infof("no events at %s, slot %d is interpolated between slot %d at %s and slot %d at %s", at, slot,
+		before.slot, time.Unix(before.blockTime, 0).UTC().Format(time.RFC3339), after.slot, time.Unix(after.blockTime, 0).UTC().Format(time.RFC3339))
+	return slot, nil
+}
+
+// timeAtSlot returns the block time of a slot in unix seconds. When the
+// archives have no events in the slot the time is interpolated from the
+// events either side.
+func timeAtSlot(dir string, files []string, slot uint64) (int64, error) {
+	before, after, err := findSlotTimes(dir, files, slotTimeSlot, int64(slot))
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case after == nil:
+		return 0, withKind(ErrNoRows, fmt.Errorf("slot %d is after the last event in %s", slot, dir))
+	case after.slot == slot:
+		return after.blockTime, nil
+	case before == nil:
+		return 0, withKind(ErrNoRows, fmt.Errorf("slot %d is before the first event in %s", slot, dir))
+	}
+	blockTime := interpolate(int64(before.slot), before.blockTime, int64(after.slot), after.blockTime, int64(slot))
+	logrus.Infof("no events in slot %d, its time is interpolated between slot %d and slot %d", slot, before.slot, after.slot)
+	return blockTime, nil
+}
+
+// findSlotTimes returns the last event before target and the first at or
+// after it, by key. Only the files which can hold them are read: the file is
+// picked by its first event, as with resolveFromDate. Rows without a block
+// time are skipped.
+func findSlotTimes(dir string, files []string, key func(slotTime) int64, target int64) (*slotTime, *slotTime, error) {
+	i, err := searchArchiveFiles(dir, files, key, target)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var before, after *slotTime
+	for _, v := range files[i:] {
+		err := readArchiveRows(dir+"/"+v, func(row []byte) error {
+			point := slotTime{slot: rowSlot(row), blockTime: rowBlockTime(row)}
+			if point.blockTime == 0 {
+				return nil
+			}
+			if key(point) >= target {
+				after = &point
+				return errSlotTimeFound
+			}
+			before = &point
+			return nil
+		})
+		if errors.Is(err, errSlotTimeFound) {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return before, after, nil
+}
+
+// searchArchiveFiles returns the index of the file target, a slot or block
+// time by key, is in. That is the file before the first file starting after
+// target, going by the first event of each file.
+func searchArchiveFiles(dir string, files []string, key func(slotTime) int64, target int64) (int, error) {
+	var searchErr error
+	i := sort.Search(len(files), func(i int) bool {
+		first, err := archiveFirstSlotTime(dir + "/" + files[i])
+		if err != nil && searchErr == nil {
+			searchErr = err
+		}
+		return first != nil && key(*first) > target
+	})
+	return max(0, i-1), searchErr
+}
+
+// archiveFirstSlotTime returns the first event in an archive with a block
+// time, or nil if there is none
+func archiveFirstSlotTime(path string) (*slotTime, error) {
+	var first *slotTime
+	err := readArchiveRows(path, func(row []byte) error {
+		if blockTime := rowBlockTime(row); blockTime != 0 {
+			first = &slotTime{slot: rowSlot(row), blockTime: blockTime}
+			return errSlotTimeFound
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errSlotTimeFound) {
+		return nil, err
+	}
+	return first, nil
+}
+
+// interpolate returns the y at x on the line from (x0, y0) to (x1, y1),
+// rounded to the nearest whole number
+func interpolate(x0, y0, x1, y1, x int64) int64 {
+	if x1 == x0 {
+		return y0
+	}
+	return y0 + int64(math.Round(float64(x-x0)*float64(y1-y0)/float64(x1-x0)))
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestSlotAt(t *testing.T) {
+	// a slot every 10s from 12:00 to 12:30, then a gap in the data until
+	// 13:00 when the next file starts
+	rows := func(from, to, slot int) string {
+		out := strings.Builder{}
+		for v := from; v < to; v += 10 {
+			fmt.Fprintf(&out, `{"slot":%d,"blockTime":%d,"swap":{}}`+"\n", slot, v)
+			slot += 25
+		}
+		return out.String()
+	}
+	start := 1714910400 // 2024-05-05T12:00:00Z
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": rows(start, start+30*60, 1000),
+		"pairs.json": `{"slot":999,"pair":{}}` + "\n",
+	})
+	// 12:30 is slot 5500, 13:00 is slot 10000
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{"swaps.json": rows(start+60*60, start+70*60, 10000)})
+
+	slotAt := func(at string) (string, error) {
+		out := bytes.Buffer{}
+		task := NewSlotAtTask()
+		task.out = &out
+		task.params.dataDir = dataDir
+		task.params.time = at
+		err := task.Execute(context.Background())
+		return strings.TrimSpace(out.String()), err
+	}
+	timeAt := func(slot uint64) (string, error) {
+		out := bytes.Buffer{}
+		task := NewSlotAtTask()
+		task.out = &out
+		task.params.dataDir = dataDir
+		task.params.slot = slot
+		err := task.Execute(context.Background())
+		return strings.TrimSpace(out.String()), err
+	}
+
+	for at, slot := range map[string]string{
+		"2024-05-05T12:00:00Z": "1000",
+		"2024-05-05 12:10":     "2500",
+		// between events
+		"2024-05-05 12:10:05": "2513",
+		// interpolated across the gap
+		"2024-05-05 12:45": "7750",
+		"2024-05-05 13:05": "10750",
+	} {
+		got, err := slotAt(at)
+		assert.Nil(t, err, at)
+		assert.Equal(t, slot, got, at)
+	}
+	for slot, at := range map[uint64]string{
+		1000:  "2024-05-05T12:00:00Z",
+		2500:  "2024-05-05T12:10:00Z",
+		2510:  "2024-05-05T12:10:04Z",
+		7750:  "2024-05-05T12:45:00Z",
+		10025: "2024-05-05T13:00:10Z",
+	} {
+		got, err := timeAt(slot)
+		assert.Nil(t, err, slot)
+		assert.Equal(t, at, got, slot)
+	}
+
+	_, err := slotAt("2024-05-05 11:00")
+	assert.True(t, errors.Is(err, ErrNoRows))
+	_, err = timeAt(20000)
+	assert.True(t, errors.Is(err, ErrNoRows))
+	_, err = slotAt("")
+	assert.True(t, errors.Is(err, ErrUsage))
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"math/rand"
+	"sort"
+)
+
+const (
+	SlotOrderFile    = "file"
+	SlotOrderIndex   = "index"
+	SlotOrderShuffle = "shuffle"
+)
+
+// slotRow is an archive row waiting to be emitted with the rest of its slot
+type slotRow struct {
+	data DataFormat
+	row  []byte
+}
+
+// slotOrder orders the events of a slot before simulate emits them, so
+// clients can be tested against the orders production may deliver them in
+type slotOrder struct {
+	mode    string
+	random  *rand.Rand
+	reverse bool
+}
+
+func newSlotOrder(mode string, seed int64, reverse bool) *slotOrder {
+	return &slotOrder{mode: mode, random: rand.New(rand.NewSource(seed)), reverse: reverse}
+}
+
+// Sort orders rows, which are all from the same slot and in file order
+func (o *slotOrder) Sort(rows []slotRow) {
+	if len(rows) < 2 {
+		return
+	}
+	switch o.mode {
+	case SlotOrderIndex:
+		sort.SliceStable(rows, func(i, j int) bool {
+			if o.reverse {
+				i, j = j, i
+			}
+			return slotRowLess(rows[i].data, rows[j].data)
+		})
+	case SlotOrderShuffle:
+		o.random.Shuffle(len(rows), func(i, j int) {
+			rows[i], rows[j] = rows[j], rows[i]
+		})
+	}
+}
+
+// slotRowLess orders by transaction index, then signature. Rows with an index
+// come before those without.
+func slotRowLess(a, b DataFormat) bool {
+	if a.TxIndex != nil && b.TxIndex != nil && *a.TxIndex != *b.TxIndex {
+		return *a.TxIndex < *b.TxIndex
+	}
+	if (a.TxIndex == nil) != (b.TxIndex == nil) {
+		return a.TxIndex != nil
+	}
+	return a.Signature < b.Signature
+}
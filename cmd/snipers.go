@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"math/big"
+	"sort"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type SnipersTask struct {
+	// slot each recent new pair was created in, by amm account
+	launches      map[string]uint64
+	totalLaunches uint
+	wallets       map[string]*sniperStats
+	amounts       amountOptions
+	params        struct {
+		dataDir     string
+		windowSlots uint64
+		minLaunches uint
+		format      string
+		output      string
+	}
+}
+
+type sniperStats struct {
+	buys   uint
+	snipes uint
+	// by quote mint, as quote mints differ in decimals
+	quotes map[string]*snipeQuotes
+	// amms already counted so multiple buys into one launch count once
+	launches map[string]struct{}
+}
+
+// snipeQuotes are the snipes of a wallet in one quote mint
+type snipeQuotes struct {
+	snipes uint
+	// in quote tokens, nil if the decimals of the mint are not known
+	tokens *big.Rat
+}
+
+func NewSnipersTask() *SnipersTask {
+	return &SnipersTask{
+		launches: map[string]uint64{},
+		wallets:  map[string]*sniperStats{},
+	}
+}
+
+func (o *SnipersTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir to get the archive data from")
+	cmd.Flags().Uint64VarP(&o.params.windowSlots, "window-slots", "k", 5, "Buys within this many slots of the new pair event count as snipes")
+	cmd.Flags().UintVar(&o.params.minLaunches, "min-launches", 3, "Minimum number of distinct launches a wallet must have sniped to be reported")
+	cmd.Flags().StringVar(&o.amounts.decimalsFile, "token-decimals", "", "A JSON file of the decimals of each quote mint e.g. {\"<mint>\": 6}. SOL, USDC, USDT and Pump.fun mints are known")
+	cmd.Flags().StringVarP(&o.params.format, "format", "f", ReportFormatCSV, "Output format: csv, json or arrow")
+	cmd.Flags().StringVarP(&o.params.output, "output", "o", "", "File to write the report to. Defaults to stdout")
+}
+
+func (o *SnipersTask) GetMeta() Meta {
+	return Meta{
+		Name:        "SnipersTask",
+		Use:         "snipers",
+		Description: "Flag wallets that buy within a few slots of new pair events across many launches and report their hit rates and sizes.",
+	}
+}
+
+func (o *SnipersTask) Execute(ctx context.Context) error {
+	if err := o.amounts.LoadDecimals(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+
+	rows := 0
+	for i, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logrus.Infof("scanning file (%d of %d) %s", i+1, len(files), v)
+		err := readArchiveEvents(o.params.dataDir+"/"+v, nil, func(event EventRow) error {
+			o.add(event)
+			rows++
+			if rows%100000 == 0 {
+				o.pruneLaunches(event.Slot)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return o.writeReport()
+}
+
+func (o *SnipersTask) add(event EventRow) {
+	if event.Pair != nil {
+		o.launches[event.Pair.AmmAccount] = event.Slot
+		o.totalLaunches++
+		return
+	}
+	if event.Swap == nil || event.Swap.SwapType != SwapTypeBuy || event.Swap.WalletAccount == "" {
+		return
+	}
+
+	stats, ok := o.wallets[event.Swap.WalletAccount]
+	if !ok {
+		stats = &sniperStats{}
+		o.wallets[event.Swap.WalletAccount] = stats
+	}
+	stats.buys++
+
+	launchSlot, ok := o.launches[event.Swap.AmmAccount]
+	if !ok || event.Slot < launchSlot || event.Slot > launchSlot+o.params.windowSlots {
+		return
+	}
+	stats.snipes++
+	if stats.launches == nil {
+		stats.launches = map[string]struct{}{}
+		stats.quotes = map[string]*snipeQuotes{}
+	}
+	quotes, ok := stats.quotes[event.Swap.QuoteTokenMint]
+	if !ok {
+		quotes = &snipeQuotes{tokens: new(big.Rat)}
+		stats.quotes[event.Swap.QuoteTokenMint] = quotes
+	}
+	quotes.snipes++
+	if tokens, ok := o.amounts.Rat(event.Swap.QuoteAmount, event.Swap.QuoteTokenMint); ok && quotes.tokens != nil {
+		quotes.tokens.Add(quotes.tokens, tokens)
+	} else {
+		quotes.tokens = nil
+	}
+	stats.launches[event.Swap.AmmAccount] = struct{}{}
+}
+
+// pruneLaunches forgets launches that are too old to be sniped
+func (o *SnipersTask) pruneLaunches(slot uint64) {
+	for amm, launchSlot := range o.launches {
+		if launchSlot+o.params.windowSlots < slot {
+			delete(o.launches, amm)
+		}
+	}
+}
+
+func (o *SnipersTask) writeReport() error {
+	type sniper struct {
+		wallet string
+		stats  *sniperStats
+	}
+	snipers := []sniper{}
+	for wallet, stats := range o.wallets {
+		if uint(len(stats.launches)) < o.params.minLaunches || len(stats.launches) == 0 {
+			continue
+		}
+		snipers = append(snipers, sniper{wallet: wallet, stats: stats})
+	}
+	sort.Slice(snipers, func(i, j int) bool {
+		if len(snipers[i].stats.launches) != len(snipers[j].stats.launches) {
+			return len(snipers[i].stats.launches) > len(snipers[j].stats.launches)
+		}
+		return snipers[i].wallet < snipers[j].wallet
+	})
+
+	out, err := openOutput(o.params.output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w, err := newRecordWriter(out, o.params.format, []string{"wallet", "launches_sniped", "launch_hit_rate", "snipes", "buys", "snipe_ratio", "quote_mint", "avg_snipe_quote", "total_snipe_quote"})
+	if err != nil {
+		return err
+	}
+	// a row for each quote mint a wallet sniped with
+	for _, v := range snipers {
+		launchesSniped := len(v.stats.launches)
+		mints := make([]string, 0, len(v.stats.quotes))
+		for mint := range v.stats.quotes {
+			mints = append(mints, mint)
+		}
+		sort.Strings(mints)
+		for _, mint := range mints {
+			quotes := v.stats.quotes[mint]
+			// empty when the decimals of the quote mint are not known
+			var avg, total any
+			if quotes.tokens != nil {
+				total, _ = quotes.tokens.Float64()
+				avg, _ = new(big.Rat).Quo(quotes.tokens, new(big.Rat).SetInt64(int64(quotes.snipes))).Float64()
+			}
+			err := w.Write(
+				v.wallet,
+				launchesSniped,
+				float64(launchesSniped)/float64(o.totalLaunches),
+				v.stats.snipes,
+				v.stats.buys,
+				float64(v.stats.snipes)/float64(v.stats.buys),
+				mint,
+				avg,
+				total,
+			)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	logrus.Infof("found %d sniper wallets across %d launches", len(snipers), o.totalLaunches)
+	o.amounts.Report()
+	return w.Flush()
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestSnipers(t *testing.T) {
+	rows := strings.Builder{}
+	for i := 0; i < 3; i++ {
+		amm := fmt.Sprintf("amm%d", i)
+		fmt.Fprintf(&rows, `{"slot":%d,"pair":{"ammAccount":"%s"}}`+"\n", 100+i*100, amm)
+		// a snipes every launch in SOL, and one in USDC too
+		fmt.Fprintf(&rows, `{"slot":%d,"swap":{"swapType":"buy","ammAccount":"%s","walletAccount":"a","quoteTokenMint":"%s","quoteAmount":"%d000000000"}}`+"\n", 101+i*100, amm, wrappedSOLMint, i+1)
+		if i == 0 {
+			fmt.Fprintf(&rows, `{"slot":102,"swap":{"swapType":"buy","ammAccount":"%s","walletAccount":"a","quoteTokenMint":"%s","quoteAmount":"500000000"}}`+"\n", amm, usdcMint)
+		}
+		// b buys too late to count and snipes one launch in an unknown mint
+		fmt.Fprintf(&rows, `{"slot":%d,"swap":{"swapType":"buy","ammAccount":"%s","walletAccount":"b","quoteTokenMint":"unknown","quoteAmount":"7"}}`+"\n", 150+i*100, amm)
+		if i == 0 {
+			fmt.Fprintf(&rows, `{"slot":103,"swap":{"swapType":"buy","ammAccount":"%s","walletAccount":"b","quoteTokenMint":"unknown","quoteAmount":"7"}}`+"\n", amm)
+		}
+	}
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{"swaps.json": rows.String()})
+
+	task := NewSnipersTask()
+	task.params.dataDir = dataDir
+	task.params.windowSlots = 5
+	task.params.minLaunches = 1
+	task.params.format = ReportFormatCSV
+	task.params.output = t.TempDir() + "/snipers.csv"
+	assert.Nil(t, task.Execute(context.Background()))
+
+	raw, err := os.ReadFile(task.params.output)
+	assert.Nil(t, err)
+	// quote sizes are in tokens of each quote mint, never summed across them
+	assert.Equal(t, fmt.Sprintf(`wallet,launches_sniped,launch_hit_rate,snipes,buys,snipe_ratio,quote_mint,avg_snipe_quote,total_snipe_quote
+a,3,1,4,4,1,%s,500,500
+a,3,1,4,4,1,%s,2,6
+b,1,0.3333333333333333,1,4,0.25,unknown,,
+`, usdcMint, wrappedSOLMint), string(raw))
+}
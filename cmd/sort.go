@@ -0,0 +1,143 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type SortTask struct {
+	params struct {
+		dataDir     string
+		outDir      string
+		tmpDir      string
+		compression string
+	}
+}
+
+func NewSortTask() *SortTask {
+	return &SortTask{}
+}
+
+func (o *SortTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir containing the archive files to sort")
+	cmd.Flags().StringVarP(&o.params.outDir, "out-data-dir", "o", "", "The dir to write the sorted archives to. Defaults to replacing the files in data-dir")
+	cmd.Flags().StringVar(&o.params.tmpDir, "tmp-dir", os.TempDir(), "The dir to spill sorted runs to when a file does not fit in --max-memory")
+	cmd.Flags().StringVar(&o.params.compression, "compression", CompressionDeflate, "How to compress the sorted archives: deflate or zstd-seekable")
+}
+
+func (o *SortTask) GetMeta() Meta {
+	return Meta{
+		Name:        "SortTask",
+		Use:         "sort",
+		Description: "Sort the rows of archive files by slot, e.g. after reduce --unordered. Files larger than --max-memory are sorted on disk.",
+	}
+}
+
+func (o *SortTask) Execute(ctx context.Context) error {
+	if err := validCompression(o.params.compression); err != nil {
+		return err
+	}
+	if o.params.outDir == "" {
+		o.params.outDir = o.params.dataDir
+	}
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no archive files found in %s", o.params.dataDir)
+	}
+	if err := os.MkdirAll(o.params.outDir, 0755); err != nil {
+		return err
+	}
+	for _, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := o.sortFile(v); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("sorted %d files to %s", len(files), o.params.outDir)
+	return nil
+}
+
+// sortFile sorts each file in the archive into a new archive which replaces
+// the output file once complete
+func (o *SortTask) sortFile(fileName string) error {
+	logrus.Infof("sorting file %s", fileName)
+	r, closer, err := openArchive(filepath.Join(o.params.dataDir, fileName))
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	outPath := filepath.Join(o.params.outDir, fileName)
+	out, err := createArchive(outPath + ".partial")
+	if err != nil {
+		return err
+	}
+	w := zip.NewWriter(out)
+	// keeps reduced archives marked as reduced
+	err = w.SetComment(r.Comment)
+	for i := 0; err == nil && i < len(r.File); i++ {
+		err = o.sortEntry(r.File[i], w)
+	}
+	if err == nil {
+		err = w.Close()
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		out.Close()
+		os.Remove(outPath + ".partial")
+		return err
+	}
+	return os.Rename(outPath+".partial", outPath)
+}
+
+func (o *SortTask) sortEntry(f *zip.File, w *zip.Writer) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	sorter := newRowSorter(o.params.tmpDir, slotSortKey)
+	defer sorter.Close()
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 64*1024), maxRowSize)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := sorter.Add(scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	aw, err := createEntry(w, f.Name, o.params.compression)
+	if err != nil {
+		return err
+	}
+	bw := bufio.NewWriter(aw)
+	err = sorter.Each(func(row []byte) error {
+		bw.Write(row)
+		return bw.WriteByte('\n')
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+const (
+	SplitByTime   = "time"
+	SplitByWallet = "wallet"
+
+	SplitTrain      = "train"
+	SplitValidation = "validation"
+)
+
+// DatasetSplit records how a split-dataset dir was made
+type DatasetSplit struct {
+	Set   string  `json:"set"`
+	By    string  `json:"by"`
+	Train float64 `json:"train"`
+	Salt  string  `json:"salt,omitempty"`
+}
+
+type SplitDatasetTask struct {
+	params struct {
+		dataDir string
+		outDir  string
+		train   float64
+		by      string
+		salt    string
+	}
+}
+
+func NewSplitDatasetTask() *SplitDatasetTask {
+	return &SplitDatasetTask{}
+}
+
+func (o *SplitDatasetTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir containing the archive files to split")
+	cmd.Flags().StringVarP(&o.params.outDir, "out-data-dir", "o", "out-split", "The dir to write the train and validation dirs to")
+	cmd.Flags().Float64Var(&o.params.train, "train", 0.8, "The fraction of the data for the train set, the rest is the validation set")
+	cmd.Flags().StringVar(&o.params.by, "by", SplitByTime, "How to split: 'time' puts the earliest archive hours in the train set and the latest in the validation set. 'wallet' puts each wallet's swaps in one set by a hash of the wallet")
+	cmd.Flags().StringVar(&o.params.salt, "salt", "", "Changes which wallets are in each set with --by wallet. The same salt gives the same split every run")
+}
+
+func (o *SplitDatasetTask) GetMeta() Meta {
+	return Meta{
+		Name:        "SplitDatasetTask",
+		Use:         "split-dataset",
+		Description: "Split archive files into train and validation sets, chronologically or by wallet, each in its own dir with a manifest. For building models on swap data.",
+	}
+}
+
+func (o *SplitDatasetTask) Execute(ctx context.Context) error {
+	if o.params.train <= 0 || o.params.train >= 1 {
+		return withKind(ErrUsage, errors.New("train must be between 0 and 1"))
+	}
+	if o.params.by != SplitByTime && o.params.by != SplitByWallet {
+		return withKind(ErrUsage, fmt.Errorf("by must be '%s' or '%s'", SplitByTime, SplitByWallet))
+	}
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no archive files found in %s", o.params.dataDir)
+	}
+	for _, set := range []string{SplitTrain, SplitValidation} {
+		if err := os.MkdirAll(filepath.Join(o.params.outDir, set), 0755); err != nil {
+			return err
+		}
+	}
+
+	if o.params.by == SplitByTime {
+		err = o.splitByTime(ctx, files)
+	} else {
+		err = o.splitByWallet(ctx, files)
+	}
+	if err != nil {
+		return err
+	}
+	for _, set := range []string{SplitTrain, SplitValidation} {
+		if err := o.writeManifest(ctx, set); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("split %d files into %s", len(files), o.params.outDir)
+	return nil
+}
+
+// splitByTime puts whole archive files in each set so no hour is in both
+func (o *SplitDatasetTask) splitByTime(ctx context.Context, files []string) error {
+	if len(files) < 2 {
+		return fmt.Errorf("splitting by time needs at least 2 archive files, %s has %d", o.params.dataDir, len(files))
+	}
+	train := int(math.Round(o.params.train * float64(len(files))))
+	train = min(max(train, 1), len(files)-1)
+	for i, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		set := SplitTrain
+		if i >= train {
+			set = SplitValidation
+		}
+		if err := linkOrCopyFile(filepath.Join(o.params.dataDir, v), filepath.Join(o.params.outDir, set, v)); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("%d files in the train set, from %s. %d files in the validation set, from %s", train, files[0], len(files)-train, files[train])
+	return nil
+}
+
+// splitByWallet writes each archive to both sets, with the swaps of each
+// wallet in one of them. Rows without a wallet, such as new pairs, are in
+// both so each set has the context its swaps need.
+func (o *SplitDatasetTask) splitByWallet(ctx context.Context, files []string) error {
+	counts := map[string]uint64{}
+	for _, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logrus.Infof("splitting file %s", v)
+		if err := o.splitFile(v, counts); err != nil {
+			return err
+		}
+	}
+	logrus.Infof("%d swaps in the train set, %d swaps in the validation set", counts[SplitTrain], counts[SplitValidation])
+	return nil
+}
+
+func (o *SplitDatasetTask) splitFile(fileName string, counts map[string]uint64) error {
+	r, closer, err := openArchive(filepath.Join(o.params.dataDir, fileName))
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	outs := map[string]io.WriteCloser{}
+	writers := map[string]*zip.Writer{}
+	paths := map[string]string{}
+	defer func() {
+		for set, out := range outs {
+			out.Close()
+			os.Remove(paths[set])
+		}
+	}()
+	for _, set := range []string{SplitTrain, SplitValidation} {
+		paths[set] = filepath.Join(o.params.outDir, set, fileName) + ".partial"
+		out, err := createArchive(paths[set])
+		if err != nil {
+			return err
+		}
+		outs[set] = out
+		writers[set] = zip.NewWriter(out)
+	}
+
+	for _, f := range r.File {
+		if err := o.splitEntry(f, writers, counts); err != nil {
+			return err
+		}
+	}
+	for _, set := range []string{SplitTrain, SplitValidation} {
+		if err := writers[set].Close(); err != nil {
+			return err
+		}
+		out := outs[set]
+		delete(outs, set)
+		if err := out.Close(); err != nil {
+			os.Remove(paths[set])
+			return err
+		}
+		if err := os.Rename(paths[set], filepath.Join(o.params.outDir, set, fileName)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *SplitDatasetTask) splitEntry(f *zip.File, writers map[string]*zip.Writer, counts map[string]uint64) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	entries := map[string]io.Writer{}
+	for set, w := range writers {
+		entries[set], err = w.Create(f.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	scanner := bufio.NewScanner(rc)
+	scanner.Buffer(make([]byte, 64*1024), maxRowSize)
+	for scanner.Scan() {
+		row := scanner.Bytes()
+		if len(row) == 0 {
+			continue
+		}
+		event := EventRow{}
+		if err := unmarshalEvent(row, &event); err != nil {
+			return errors.Wrap(err, "cant unmarshal event")
+		}
+		line := append(row, '\n')
+		if event.Swap == nil || event.Swap.WalletAccount == "" {
+			for _, w := range entries {
+				if _, err := w.Write(line); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		set := o.walletSet(event.Swap.WalletAccount)
+		counts[set]++
+		if _, err := entries[set].Write(line); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// walletSet hashes the wallet to a number in [0, 1) so each wallet is always
+// in the same set for a salt
+func (o *SplitDatasetTask) walletSet(wallet string) string {
+	h := fnv.New64a()
+	h.Write([]byte(o.params.salt))
+	h.Write([]byte(wallet))
+	if float64(h.Sum64())/math.MaxUint64 < o.params.train {
+		return SplitTrain
+	}
+	return SplitValidation
+}
+
+// writeManifest writes a dataset manifest of the files in a set, as package
+// does, with how the set was split
+func (o *SplitDatasetTask) writeManifest(ctx context.Context, set string) error {
+	dir := filepath.Join(o.params.outDir, set)
+	files, err := listArchiveFiles(dir)
+	if err != nil {
+		return err
+	}
+	manifest := DatasetManifest{
+		Format:        datasetFormat,
+		SchemaVersion: archiveSchemaVersion,
+		CLIVersion:    version,
+		CreatedAt:     time.Now().UTC(),
+		Split:         &DatasetSplit{Set: set, By: o.params.by, Train: o.params.train, Salt: o.params.salt},
+	}
+	raw, err := os.ReadFile(filepath.Join(o.params.dataDir, reduceSummaryFileName))
+	if err == nil {
+		summary := ReduceSummary{}
+		if err := json.Unmarshal(raw, &summary); err != nil {
+			return errors.Wrapf(err, "invalid %s", reduceSummaryFileName)
+		}
+		manifest.Filters = summary.Filters
+	}
+	for _, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		path := filepath.Join(dir, v)
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		sum, err := fileSHA256(path)
+		if err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, DatasetFile{Name: v, Size: info.Size(), SHA256: sum})
+	}
+	raw, err = json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, datasetManifestName), raw, 0644)
+}
+
+// linkOrCopyFile hard links src to dst, copying it when they are on different
+// file systems
+func linkOrCopyFile(src string, dst string) error {
+	os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst+".partial", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(budgetWriter{out, diskUsage}, in); err != nil {
+		out.Close()
+		os.Remove(dst + ".partial")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(dst + ".partial")
+		return err
+	}
+	return os.Rename(dst+".partial", dst)
+}
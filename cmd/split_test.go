@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestSplitDatasetByTime(t *testing.T) {
+	dataDir := t.TempDir()
+	for _, v := range []string{"20240505-120000.zip", "20240505-130000.zip", "20240505-140000.zip", "20240505-150000.zip", "20240505-160000.zip"} {
+		writeTestArchive(t, filepath.Join(dataDir, v), map[string]string{"swaps.json": "{\"slot\":1,\"swap\":{}}\n"})
+	}
+	task := NewSplitDatasetTask()
+	task.params.dataDir = dataDir
+	task.params.outDir = t.TempDir()
+	task.params.train = 0.7
+	task.params.by = SplitByTime
+	assert.Nil(t, task.Execute(context.Background()))
+
+	train, err := listArchiveFiles(filepath.Join(task.params.outDir, SplitTrain))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20240505-120000.zip", "20240505-130000.zip", "20240505-140000.zip", "20240505-150000.zip"}, train)
+	validation, err := listArchiveFiles(filepath.Join(task.params.outDir, SplitValidation))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"20240505-160000.zip"}, validation)
+
+	raw, err := os.ReadFile(filepath.Join(task.params.outDir, SplitValidation, datasetManifestName))
+	assert.Nil(t, err)
+	manifest := DatasetManifest{}
+	assert.Nil(t, json.Unmarshal(raw, &manifest))
+	assert.Equal(t, &DatasetSplit{Set: SplitValidation, By: SplitByTime, Train: 0.7}, manifest.Split)
+	assert.Len(t, manifest.Files, 1)
+	assert.Equal(t, "20240505-160000.zip", manifest.Files[0].Name)
+}
+
+func TestSplitDatasetByWallet(t *testing.T) {
+	rows := strings.Builder{}
+	rows.WriteString("{\"slot\":1,\"pair\":{}}\n")
+	wallets := []string{}
+	for i := 0; i < 200; i++ {
+		wallet := fixtureKey(fmt.Sprintf("wallet-%d", i), "")
+		wallets = append(wallets, wallet)
+		rows.WriteString("{\"slot\":2,\"swap\":{\"walletAccount\":\"" + wallet + "\"}}\n")
+	}
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{"swaps.json": rows.String()})
+
+	task := NewSplitDatasetTask()
+	task.params.dataDir = dataDir
+	task.params.outDir = t.TempDir()
+	task.params.train = 0.8
+	task.params.by = SplitByWallet
+	assert.Nil(t, task.Execute(context.Background()))
+
+	read := func(set string) (int, map[string]bool) {
+		pairs := 0
+		seen := map[string]bool{}
+		err := readArchiveRows(filepath.Join(task.params.outDir, set, "20240505-120000.zip"), func(row []byte) error {
+			event := EventRow{}
+			assert.Nil(t, json.Unmarshal(row, &event))
+			if event.Pair != nil {
+				pairs++
+			} else {
+				seen[event.Swap.WalletAccount] = true
+			}
+			return nil
+		})
+		assert.Nil(t, err)
+		return pairs, seen
+	}
+	trainPairs, train := read(SplitTrain)
+	validationPairs, validation := read(SplitValidation)
+	assert.Equal(t, 1, trainPairs)
+	assert.Equal(t, 1, validationPairs)
+	assert.Equal(t, len(wallets), len(train)+len(validation))
+	for _, v := range wallets {
+		assert.True(t, train[v] != validation[v], v)
+		assert.Equal(t, train[v], task.walletSet(v) == SplitTrain)
+	}
+	// roughly the train fraction
+	assert.True(t, len(train) > 130 && len(train) < 190, len(train))
+
+	task.params.salt = "other"
+	changed := 0
+	for _, v := range wallets {
+		if train[v] != (task.walletSet(v) == SplitTrain) {
+			changed++
+		}
+	}
+	assert.NotEqual(t, 0, changed)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// subscribeFilterParams maps the include fields of live subscribe params to
+// the reduce params which keep the same events
+var subscribeFilterParams = map[string]string{
+	"baseTokenMint": "baseTokenMint",
+	"ammAccount":    "amm",
+	"walletAccount": "wallet",
+}
+
+type SuggestFiltersTask struct {
+	params struct {
+		in              []string
+		out             string
+		allowUnfiltered bool
+	}
+}
+
+// FilterUsage is what clients subscribed with across the logs read
+type FilterUsage struct {
+	// subscriptions by subscribe method
+	Subscriptions map[string]int
+	// subscriptions without filters, which use every event, by subscribe method
+	Unfiltered map[string]int
+	// values by reduce param
+	Filters map[string][]string
+}
+
+func NewSuggestFiltersTask() *SuggestFiltersTask {
+	return &SuggestFiltersTask{}
+}
+
+func (o *SuggestFiltersTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVarP(&o.params.in, "in", "i", nil, "Simulate session logs (--session-log-dir) and proxy recordings (--record) to read. Dirs are searched for both")
+	cmd.Flags().StringVarP(&o.params.out, "out", "o", "-", "Write the reduce params file here. - is stdout")
+	cmd.Flags().BoolVar(&o.params.allowUnfiltered, "allow-unfiltered", false, "Suggest filters even when some clients subscribed without filters. Reducing with them drops events those clients receive")
+}
+
+func (o *SuggestFiltersTask) GetMeta() Meta {
+	return Meta{
+		Name:        "SuggestFiltersTask",
+		Use:         "suggest-filters",
+		Description: "Read the subscriptions clients made through the simulator or proxy and write a reduce params file that keeps only the events they use.",
+	}
+}
+
+func (o *SuggestFiltersTask) Execute(ctx context.Context) error {
+	if len(o.params.in) == 0 {
+		return withKind(ErrUsage, errors.New("in must be specified"))
+	}
+	files, err := suggestFiltersFiles(o.params.in)
+	if err != nil {
+		return err
+	}
+	usage := newFilterUsage()
+	for _, v := range files {
+		if err := usage.Read(v); err != nil {
+			return errors.Wrapf(err, "cant read %s", v)
+		}
+	}
+	usage.Print(len(files))
+	total := 0
+	for _, v := range usage.Subscriptions {
+		total += v
+	}
+	if total == 0 {
+		return withKind(ErrNoRows, fmt.Errorf("no subscriptions in %d files", len(files)))
+	}
+	if len(usage.Unfiltered) != 0 && !o.params.allowUnfiltered {
+		return errors.New("some clients subscribed without filters so they use every event. Use --allow-unfiltered to suggest filters anyway")
+	}
+	if len(usage.Filters) == 0 {
+		return errors.New("no subscriptions had filters")
+	}
+
+	for _, v := range usage.Filters {
+		slices.Sort(v)
+	}
+	out, err := openOutput(o.params.out)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	raw, err := json.MarshalIndent(usage.Filters, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(raw))
+	return err
+}
+
+// suggestFiltersFiles expands dirs to the session logs and proxy recordings in
+// them
+func suggestFiltersFiles(in []string) ([]string, error) {
+	files := []string{}
+	for _, v := range in {
+		info, err := os.Stat(v)
+		if err != nil {
+			return nil, withKind(ErrUsage, err)
+		}
+		if !info.IsDir() {
+			files = append(files, v)
+			continue
+		}
+		for _, pattern := range []string{"simulate-session-*.json", "proxy-*.zip"} {
+			matches, err := filepath.Glob(filepath.Join(v, pattern))
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, matches...)
+		}
+	}
+	return files, nil
+}
+
+func newFilterUsage() *FilterUsage {
+	return &FilterUsage{
+		Subscriptions: map[string]int{},
+		Unfiltered:    map[string]int{},
+		Filters:       map[string][]string{},
+	}
+}
+
+// Read adds the subscriptions in a simulate session log or proxy recording
+func (o *FilterUsage) Read(path string) error {
+	if strings.HasSuffix(path, ".zip") {
+		return readArchiveRows(path, func(row []byte) error {
+			message := RecordedMessage{}
+			if err := json.Unmarshal(row, &message); err != nil {
+				return errors.Wrap(err, "invalid recording")
+			}
+			if message.From != ProxyFromClient {
+				return nil
+			}
+			request := JSONRPC{}
+			if err := json.Unmarshal(message.Message, &request); err != nil {
+				// not every client message has to be JSON RPC
+				return nil
+			}
+			return o.Add(request.Method, request.Params)
+		})
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		event := SessionEvent{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return errors.Wrap(err, "invalid session log")
+		}
+		if event.Event != SessionEventSubscribe {
+			continue
+		}
+		if err := o.Add(event.Method, event.Params); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// Add counts a subscription and its filters. Anything which is not a subscribe
+// method is ignored.
+func (o *FilterUsage) Add(method string, params json.RawMessage) error {
+	if !strings.HasSuffix(method, "Subscribe") {
+		return nil
+	}
+	o.Subscriptions[method]++
+	include := map[string]json.RawMessage{}
+	if len(params) != 0 && string(params) != "null" {
+		body := struct {
+			Include map[string]json.RawMessage `json:"include"`
+		}{}
+		if err := json.Unmarshal(params, &body); err != nil {
+			return errors.Wrapf(err, "invalid %s params", method)
+		}
+		include = body.Include
+	}
+	filtered := false
+	for field, value := range include {
+		param, ok := subscribeFilterParams[field]
+		if !ok {
+			logrus.Warnf("%s filter %q has no reduce param, ignoring it", method, field)
+			continue
+		}
+		values := []string{}
+		if err := json.Unmarshal(value, &values); err != nil {
+			single := ""
+			if err := json.Unmarshal(value, &single); err != nil {
+				return fmt.Errorf("%s filter %q must be a string or a list of strings", method, field)
+			}
+			values = []string{single}
+		}
+		for _, v := range values {
+			if v == "" {
+				continue
+			}
+			filtered = true
+			if !slices.Contains(o.Filters[param], v) {
+				o.Filters[param] = append(o.Filters[param], v)
+			}
+		}
+	}
+	if !filtered {
+		o.Unfiltered[method]++
+	}
+	return nil
+}
+
+func (o *FilterUsage) Print(files int) {
+	logrus.Infof("read %d files", files)
+	methods := []string{}
+	for method := range o.Subscriptions {
+		methods = append(methods, method)
+	}
+	slices.Sort(methods)
+	for _, method := range methods {
+		logrus.Infof("%s: %d subscriptions, %d without filters", method, o.Subscriptions[method], o.Unfiltered[method])
+	}
+	params := []string{}
+	for param := range o.Filters {
+		params = append(params, param)
+	}
+	slices.Sort(params)
+	for _, param := range params {
+		logrus.Infof("%s: %d values", param, len(o.Filters[param]))
+	}
+}
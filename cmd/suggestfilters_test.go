@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestSuggestFilters(t *testing.T) {
+	dir := t.TempDir()
+	sessionLog, err := newSessionLog(dir)
+	assert.Nil(t, err)
+	sessionLog.Log(SessionEvent{Event: SessionEventConnect})
+	sessionLog.Log(SessionEvent{Event: SessionEventSubscribe, Method: MethodSwapSubscribe, Params: json.RawMessage(`{"include":{"baseTokenMint":["mint-b","mint-a"]}}`)})
+	sessionLog.Log(SessionEvent{Event: SessionEventSubscribe, Method: MethodNewPairSubscribe, Params: json.RawMessage(`{"include":{"ammAccount":"amm-a"}}`)})
+	assert.Nil(t, sessionLog.Close())
+	writeTestArchive(t, filepath.Join(dir, "proxy-20240505-120000-1.zip"), map[string]string{
+		proxyRecordingEntry: `{"from":"client","message":{"id":1,"method":"swapSubscribe","params":{"include":{"walletAccount":["wallet-a"],"baseTokenMint":["mint-a"]}}}}
+{"from":"server","message":{"id":1,"result":{"subscription_id":1}}}
+{"from":"client","message":"not json rpc"}
+`,
+	})
+
+	out := filepath.Join(t.TempDir(), "filters.json")
+	task := NewSuggestFiltersTask()
+	task.params.in = []string{dir}
+	task.params.out = out
+	assert.Nil(t, task.Execute(context.Background()))
+	raw, err := os.ReadFile(out)
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"amm":["amm-a"],"baseTokenMint":["mint-a","mint-b"],"wallet":["wallet-a"]}`, string(raw))
+
+	// the suggestion loads as a reduce params file
+	reducer := NewReduceTask()
+	assert.Nil(t, reducer.loadParamsFile(out))
+	assert.Equal(t, "mint-a,mint-b", reducer.params.baseTokenMints)
+
+	// a client using every event stops the suggestion unless allowed
+	writeTestArchive(t, filepath.Join(dir, "proxy-20240505-120000-2.zip"), map[string]string{
+		proxyRecordingEntry: `{"from":"client","message":{"id":1,"method":"swapSubscribe"}}` + "\n",
+	})
+	err = task.Execute(context.Background())
+	assert.NotNil(t, err)
+	task.params.allowUnfiltered = true
+	assert.Nil(t, task.Execute(context.Background()))
+
+	task.params.in = []string{t.TempDir()}
+	err = task.Execute(context.Background())
+	assert.True(t, errors.Is(err, ErrNoRows))
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// alerts waiting to be posted before new ones are dropped
+const webhookQueueSize = 100
+
+const webhookTimeout = 10 * time.Second
+
+type TailTask struct {
+	http      httpOptions
+	sinks     sinkOptions
+	transform transformOptions
+	record    recordLockOptions
+	// events and alerts without a webhook are published here, stdout unless
+	// a destination is specified
+	sink       Sink
+	httpClient http.Client
+	out        io.Writer
+	rules      []AlertRule
+	webhooks   chan tailWebhook
+	// nil without --position-file
+	position *tailPositionFile
+	// set after the first disconnect, when connect failures are retried
+	reconnecting bool
+	params       struct {
+		liveURL      string
+		apiKey       string
+		methods      string
+		alertRules   string
+		positionFile string
+	}
+}
+
+// Alert is written to stdout or posted to the rule's webhook when a live event
+// matches an alert rule
+type Alert struct {
+	Rule        string          `json:"rule"`
+	Method      string          `json:"method"`
+	TriggeredAt time.Time       `json:"triggeredAt"`
+	Event       json.RawMessage `json:"event"`
+}
+
+type tailWebhook struct {
+	url  string
+	body []byte
+}
+
+func NewTailTask() *TailTask {
+	return &TailTask{out: os.Stdout, record: recordLockOptions{interval: recordLockInterval}}
+}
+
+func (o *TailTask) SetupParameters(cmd *cobra.Command) {
+	o.http.SetupParameters(cmd)
+	cmd.Flags().StringVar(&o.params.liveURL, "live-url", defaultLiveURL, "The live websocket to tail")
+	cmd.Flags().StringVarP(&o.params.apiKey, "key", "k", "", "Your API key")
+	cmd.Flags().StringVarP(&o.params.methods, "method", "m", MethodSwapSubscribe+","+MethodNewPairSubscribe, "The subscribe methods to tail. (Comma separated list)")
+	cmd.Flags().StringVar(&o.params.alertRules, "alert-rules", "", "A YAML file of alert rules. Only events matching a rule are output, as alerts to stdout or the rule's webhook. See docs for format")
+	cmd.Flags().StringVar(&o.params.positionFile, "position-file", "", "Save the slot events have been delivered up to in this file, reconnect when the feed disconnects and drop events sent again just after. Events missed while disconnected are not replayed, they are recorded in the file as gaps to backfill from the archives")
+	o.sinks.SetupParameters(cmd)
+	o.transform.SetupParameters(cmd)
+	o.record.SetupParameters(cmd)
+}
+
+func (o *TailTask) GetMeta() Meta {
+	return Meta{
+		Name:        "TailTask",
+		Use:         "tail",
+		Description: "Stream live events to stdout, one JSON event per line. With --alert-rules only events matching a rule are output, as alerts, turning the CLI into a lightweight monitoring agent.",
+	}
+}
+
+func (o *TailTask) Execute(ctx context.Context) error {
+	if o.params.apiKey == "" {
+		return withKind(ErrUsage, errors.New("key must be specified"))
+	}
+	if err := o.transform.validate(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	sink, name, err := o.sinks.NewSink()
+	if err != nil {
+		return err
+	}
+	if sink == nil {
+		sink, name = &writerSink{w: o.out}, "stdout"
+	}
+	if o.params.alertRules != "" {
+		rules, err := loadAlertRules(o.params.alertRules)
+		if err != nil {
+			return withKind(ErrUsage, err)
+		}
+		o.rules = rules
+		logrus.Infof("loaded %d alert rules", len(rules))
+	}
+	transport, err := o.http.NewTransport()
+	if err != nil {
+		return err
+	}
+	o.httpClient.Transport = transport
+	if output := o.sinks.file.path; output != "" && output != pipeName {
+		held, unlock, err := o.record.Hold(ctx, filepath.Dir(output))
+		if err != nil {
+			return err
+		}
+		defer unlock()
+		err = o.run(held, sink, name)
+		if cause := context.Cause(held); errors.Is(cause, ErrLocked) {
+			return cause
+		}
+		return err
+	}
+	return o.run(ctx, sink, name)
+}
+
+// run publishes the feed to sink until ctx is done
+func (o *TailTask) run(ctx context.Context, sink Sink, name string) error {
+	metered := newMeteredSink(sink, name)
+	defer metered.Close()
+	if err := metered.Open(ctx); err != nil {
+		return err
+	}
+	defer metered.Report()
+	o.sink = metered
+	o.webhooks = make(chan tailWebhook, webhookQueueSize)
+	defer close(o.webhooks)
+	go o.postWebhooks(ctx)
+	if o.params.positionFile == "" {
+		return o.Tail(ctx)
+	}
+	position, err := loadTailPositionFile(o.params.positionFile)
+	if err != nil {
+		return err
+	}
+	o.position = position
+	return o.TailReconnecting(ctx)
+}
+
+// TailReconnecting tails, reconnecting with a backoff whenever the feed
+// disconnects, and saves the position every second and on exit
+func (o *TailTask) TailReconnecting(ctx context.Context) error {
+	defer o.position.Save()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				o.position.Save()
+			}
+		}
+	}()
+
+	backoff := tailReconnectMin
+	for {
+		connected := time.Now()
+		err := o.Tail(ctx)
+		if err == nil || !errors.Is(err, errLiveDisconnected) {
+			return err
+		}
+		o.position.Disconnected()
+		o.position.Save()
+		if time.Since(connected) > tailReconnectMax {
+			// it was connected for a while, this is a new disconnection
+			backoff = tailReconnectMin
+		}
+		logrus.Warnf("%s, reconnecting in %s", err, backoff)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, tailReconnectMax)
+		o.reconnecting = true
+	}
+}
+
+// Tail subscribes to the live feed and outputs events until ctx is done or
+// the connection fails
+func (o *TailTask) Tail(ctx context.Context) error {
+	conn, err := dialLive(ctx, &o.http, o.params.liveURL, o.params.apiKey)
+	if err != nil {
+		if o.reconnecting && ctx.Err() == nil {
+			return fmt.Errorf("%w: %w", errLiveDisconnected, err)
+		}
+		return err
+	}
+	defer conn.Close()
+	if o.sink == nil {
+		o.sink = &writerSink{w: o.out}
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+
+	methods := splitList(o.params.methods)
+	for i, v := range methods {
+		err := conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"id":%d,"method":"%s"}`, i+1, v)))
+		if err != nil {
+			return err
+		}
+	}
+	logrus.Infof("tailing %s from %s", o.params.methods, o.params.liveURL)
+
+	for {
+		_, raw, err := conn.ReadMessage()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("%w: %w", errLiveDisconnected, err)
+		}
+		message := struct {
+			ID     int             `json:"id"`
+			Error  json.RawMessage `json:"error"`
+			Method string          `json:"method"`
+			Params json.RawMessage `json:"params"`
+		}{}
+		if err := json.Unmarshal(raw, &message); err != nil {
+			return errors.Wrap(err, "cant unmarshal message")
+		}
+		if message.ID != 0 {
+			if message.Error != nil {
+				return fmt.Errorf("subscribe to %s failed: %s", methods[min(message.ID, len(methods))-1], string(message.Error))
+			}
+			continue
+		}
+		if message.Params == nil {
+			continue
+		}
+		if err := o.output(ctx, message.Method, message.Params); err != nil {
+			return err
+		}
+	}
+}
+
+// output writes the event, or the alerts it triggers when there are rules.
+// With --position-file events sent again after a reconnect are dropped.
+func (o *TailTask) output(ctx context.Context, method string, params json.RawMessage) error {
+	event := EventRow{}
+	if err := unmarshalEvent(params, &event); err != nil {
+		return errors.Wrap(err, "cant unmarshal event")
+	}
+	if o.position == nil {
+		return o.publish(ctx, method, params, event)
+	}
+	key := tailEventKey(event, params)
+	if o.position.Seen(key) {
+		return nil
+	}
+	if err := o.publish(ctx, method, params, event); err != nil {
+		return err
+	}
+	o.position.Delivered(event, key)
+	return nil
+}
+
+func (o *TailTask) publish(ctx context.Context, method string, params json.RawMessage, event EventRow) error {
+	// rules and templates use the event as it was sent
+	params, keep, err := o.transform.Apply(params)
+	if err != nil || !keep {
+		return err
+	}
+	if o.rules == nil {
+		return o.sink.Publish(ctx, SinkMessage{Data: params, Event: event})
+	}
+	for _, rule := range o.rules {
+		if !rule.Matches(event) {
+			continue
+		}
+		raw, err := json.Marshal(Alert{
+			Rule:        rule.Name,
+			Method:      method,
+			TriggeredAt: time.Now().UTC(),
+			Event:       params,
+		})
+		if err != nil {
+			return err
+		}
+		if rule.Webhook == "" {
+			if err := o.sink.Publish(ctx, SinkMessage{Data: raw, Event: event}); err != nil {
+				return err
+			}
+			continue
+		}
+		// posted in the background so a slow webhook cannot hold up the feed
+		select {
+		case o.webhooks <- tailWebhook{url: rule.Webhook, body: raw}:
+		default:
+			logrus.Warnf("dropped alert %q, the webhook queue is full", rule.Name)
+		}
+	}
+	return nil
+}
+
+func (o *TailTask) postWebhooks(ctx context.Context) {
+	for v := range o.webhooks {
+		if err := o.postWebhook(ctx, v); err != nil {
+			logrus.Warnf("cant post alert to %s: %s", v.url, err)
+		}
+	}
+}
+
+func (o *TailTask) postWebhook(ctx context.Context, webhook tailWebhook) error {
+	ctx, cancel := context.WithTimeout(ctx, webhookTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.url, bytes.NewReader(webhook.body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := o.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
+	return nil
+}
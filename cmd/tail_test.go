@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/test-go/testify/assert"
+)
+
+func newTailTestServer(t *testing.T) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer c.Close()
+		for i := 1; i <= 2; i++ {
+			request := JSONRPC{}
+			assert.Nil(t, c.ReadJSON(&request))
+		}
+		c.WriteMessage(websocket.TextMessage, []byte(`{"id":1,"result":{"subscription_id":1}}`))
+		c.WriteMessage(websocket.TextMessage, []byte(`{"id":2,"result":{"subscription_id":2}}`))
+		c.WriteMessage(websocket.TextMessage, []byte(`{"method":"swapNotification","subscription_id":1,"params":{"slot":1,"swap":{"walletAccount":"wallet-a","swapType":"buy"}}}`))
+		c.WriteMessage(websocket.TextMessage, []byte(`{"method":"swapNotification","subscription_id":1,"params":{"slot":2,"swap":{"walletAccount":"wallet-b","swapType":"buy"}}}`))
+		c.WriteMessage(websocket.TextMessage, []byte(`{"method":"newPairNotification","subscription_id":2,"params":{"slot":3,"pair":{"quoteTokenLiquidityAdded":"500"}}}`))
+		c.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+		c.ReadMessage()
+	}))
+}
+
+func TestTail(t *testing.T) {
+	server := newTailTestServer(t)
+	defer server.Close()
+
+	out := bytes.Buffer{}
+	task := NewTailTask()
+	task.out = &out
+	task.params.liveURL = "ws" + strings.TrimPrefix(server.URL, "http")
+	task.params.methods = MethodSwapSubscribe + "," + MethodNewPairSubscribe
+	assert.NotNil(t, task.Tail(context.Background()))
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, `{"slot":1,"swap":{"walletAccount":"wallet-a","swapType":"buy"}}`, lines[0])
+}
+
+func TestTailAlerts(t *testing.T) {
+	server := newTailTestServer(t)
+	defer server.Close()
+	posted := make(chan []byte, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		posted <- raw
+	}))
+	defer webhook.Close()
+
+	out := bytes.Buffer{}
+	task := NewTailTask()
+	task.out = &out
+	task.params.liveURL = "ws" + strings.TrimPrefix(server.URL, "http")
+	task.params.methods = MethodSwapSubscribe + "," + MethodNewPairSubscribe
+	task.rules = []AlertRule{
+		{Name: "wallet a buys", Wallets: []string{"wallet-a"}, SwapType: SwapTypeBuy},
+		{Name: "big pair", Event: AlertEventPair, MinQuoteLiquidity: 100, Webhook: webhook.URL},
+	}
+	task.webhooks = make(chan tailWebhook, webhookQueueSize)
+	go task.postWebhooks(context.Background())
+	assert.NotNil(t, task.Tail(context.Background()))
+	close(task.webhooks)
+
+	alert := Alert{}
+	assert.Nil(t, json.Unmarshal(bytes.TrimSpace(out.Bytes()), &alert))
+	assert.Equal(t, "wallet a buys", alert.Rule)
+	assert.Equal(t, "swapNotification", alert.Method)
+
+	select {
+	case raw := <-posted:
+		assert.Nil(t, json.Unmarshal(raw, &alert))
+		assert.Equal(t, "big pair", alert.Rule)
+		assert.Equal(t, `{"slot":3,"pair":{"quoteTokenLiquidityAdded":"500"}}`, string(alert.Event))
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert was not posted to the webhook")
+	}
+}
+
+func TestTailReconnect(t *testing.T) {
+	swap := func(slot int, signature string) []byte {
+		return []byte(fmt.Sprintf(`{"method":"swapNotification","params":{"slot":%d,"signature":"%s","swap":{}}}`, slot, signature))
+	}
+	connections := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if !assert.Nil(t, err) {
+			return
+		}
+		defer c.Close()
+		request := JSONRPC{}
+		assert.Nil(t, c.ReadJSON(&request))
+		c.WriteMessage(websocket.TextMessage, []byte(`{"id":1,"result":{"subscription_id":1}}`))
+		connections++
+		if connections == 1 {
+			c.WriteMessage(websocket.TextMessage, swap(2, "a"))
+			// behind the highest slot delivered, but not sent before
+			c.WriteMessage(websocket.TextMessage, swap(1, "x"))
+			c.WriteMessage(websocket.TextMessage, swap(2, "b"))
+			// dropped without a close message
+			return
+		}
+		// events around the disconnection are sent again after reconnecting
+		c.WriteMessage(websocket.TextMessage, swap(2, "b"))
+		c.WriteMessage(websocket.TextMessage, swap(2, "c"))
+		c.WriteMessage(websocket.TextMessage, swap(5, "d"))
+		c.ReadMessage()
+	}))
+	defer server.Close()
+
+	positionFile := t.TempDir() + "/tail.json"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	out := &syncBuffer{}
+	task := NewTailTask()
+	task.out = out
+	task.params.liveURL = "ws" + strings.TrimPrefix(server.URL, "http")
+	task.params.methods = MethodSwapSubscribe
+	task.position, _ = loadTailPositionFile(positionFile)
+	go func() {
+		for !strings.Contains(out.String(), `"slot":5`) {
+			time.Sleep(10 * time.Millisecond)
+		}
+		cancel()
+	}()
+	assert.Nil(t, task.TailReconnecting(ctx))
+
+	signatures := []string{}
+	for _, v := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		event := EventRow{}
+		assert.Nil(t, json.Unmarshal([]byte(v), &event))
+		signatures = append(signatures, event.Sig)
+	}
+	assert.Equal(t, []string{"a", "x", "b", "c", "d"}, signatures)
+
+	position, err := loadTailPositionFile(positionFile)
+	assert.Nil(t, err)
+	saved := position.Position()
+	assert.Equal(t, uint64(5), saved.Slot)
+	assert.Len(t, saved.Recent, 5)
+	assert.Len(t, saved.Gaps, 1)
+	assert.Equal(t, uint64(2), saved.Gaps[0].AfterSlot)
+	assert.Equal(t, uint64(2), saved.Gaps[0].ResumedSlot)
+	// events sent again just after the next run starts are dropped, matched
+	// on the signature and event
+	key := func(slot int, signature string) string {
+		raw := json.RawMessage(fmt.Sprintf(`{"slot":%d,"signature":"%s","swap":{}}`, slot, signature))
+		return tailEventKey(EventRow{Slot: uint64(slot), Sig: signature}, raw)
+	}
+	assert.True(t, position.Seen(key(5, "d")))
+	assert.True(t, position.Seen(key(1, "x")))
+	assert.False(t, position.Seen(key(5, "e")))
+	assert.False(t, position.Seen(""))
+	// and only for a short time after
+	position.dedupUntil = time.Now().Add(-time.Second)
+	assert.False(t, position.Seen(key(5, "d")))
+}
+
+// syncBuffer is a bytes.Buffer safe to read while tail writes to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *syncBuffer) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *syncBuffer) String() string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.buf.String()
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"hash/fnv"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// errLiveDisconnected marks the failures tail reconnects after with
+// --position-file
+var errLiveDisconnected = errors.New("live feed disconnected")
+
+// how long tail waits before reconnecting, doubled after each failed attempt
+const (
+	tailReconnectMin = time.Second
+	tailReconnectMax = 30 * time.Second
+)
+
+// tailDedupWindow is how long after the first event following a reconnect
+// or restart events already delivered are dropped, as the feed can send the
+// events around a disconnection again
+const tailDedupWindow = 10 * time.Second
+
+// tailRecentEvents is how many of the last delivered events are kept to
+// drop them if they are sent again
+const tailRecentEvents = 5000
+
+// TailPosition is saved to --position-file, the position tail has delivered
+// events up to
+type TailPosition struct {
+	Slot uint64 `json:"slot"`
+	// keys of the last events delivered, oldest first
+	Recent []string `json:"recent"`
+	// where events may have been missed while disconnected, oldest first
+	Gaps      []TailGap `json:"gaps,omitempty"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// TailGap is a disconnection, events after AfterSlot and before ResumedSlot,
+// or the rest of AfterSlot, may not have been delivered
+type TailGap struct {
+	AfterSlot    uint64    `json:"afterSlot"`
+	ResumedSlot  uint64    `json:"resumedSlot"`
+	Disconnected time.Time `json:"disconnected"`
+	Resumed      time.Time `json:"resumed"`
+}
+
+// tailEventKey identifies an event to tell when it is sent again, its
+// signature and a hash of the event as events of one transaction share a
+// signature. Events without a signature have no key and are never dropped.
+func tailEventKey(event EventRow, params json.RawMessage) string {
+	if event.Sig == "" {
+		return ""
+	}
+	h := fnv.New64a()
+	h.Write(params)
+	return event.Sig + ":" + hex.EncodeToString(h.Sum(nil))
+}
+
+// tailPositionFile tracks the position delivered up to across reconnects
+// and runs
+type tailPositionFile struct {
+	path     string
+	mu       sync.Mutex
+	position TailPosition
+	recent   map[string]bool
+	changed  bool
+	// set until the first event after a reconnect or restart
+	disconnected time.Time
+	// set after a reconnect or restart, and until when events sent again
+	// are dropped once events arrive
+	deduplicating bool
+	dedupUntil    time.Time
+}
+
+func loadTailPositionFile(path string) (*tailPositionFile, error) {
+	o := &tailPositionFile{path: path, recent: map[string]bool{}}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return o, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "cant read position file")
+	}
+	if err := json.Unmarshal(raw, &o.position); err != nil {
+		return nil, errors.Wrap(err, "invalid position file")
+	}
+	for _, v := range o.position.Recent {
+		o.recent[v] = true
+	}
+	if o.position.Slot != 0 {
+		o.disconnected = o.position.UpdatedAt
+		o.deduplicating = true
+		logrus.Infof("continuing after slot %d", o.position.Slot)
+	}
+	return o, nil
+}
+
+// Seen returns whether the event was delivered before and sent again after
+// a reconnect or restart. Events are only dropped for a short time after
+// one, so events arriving out of slot order are never dropped.
+func (o *tailPositionFile) Seen(key string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.deduplicating {
+		return false
+	}
+	now := time.Now()
+	if o.dedupUntil.IsZero() {
+		o.dedupUntil = now.Add(tailDedupWindow)
+	}
+	if now.After(o.dedupUntil) {
+		o.deduplicating = false
+		o.dedupUntil = time.Time{}
+		return false
+	}
+	return key != "" && o.recent[key]
+}
+
+// Delivered moves the position to the event
+func (o *tailPositionFile) Delivered(event EventRow, key string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if event.Slot == 0 {
+		return
+	}
+	if !o.disconnected.IsZero() {
+		gap := TailGap{AfterSlot: o.position.Slot, ResumedSlot: event.Slot, Disconnected: o.disconnected, Resumed: time.Now().UTC()}
+		o.position.Gaps = append(o.position.Gaps, gap)
+		o.disconnected = time.Time{}
+		logrus.Warnf("reconnected at slot %d, events after slot %d may have been missed while disconnected. They are listed as a gap in %s to backfill from the archives", gap.ResumedSlot, gap.AfterSlot, o.path)
+	}
+	o.position.Slot = max(o.position.Slot, event.Slot)
+	if key != "" && !o.recent[key] {
+		o.recent[key] = true
+		o.position.Recent = append(o.position.Recent, key)
+		if len(o.position.Recent) > tailRecentEvents {
+			delete(o.recent, o.position.Recent[0])
+			o.position.Recent = o.position.Recent[1:]
+		}
+	}
+	o.position.UpdatedAt = time.Now().UTC()
+	o.changed = true
+}
+
+// Disconnected records that the feed disconnected, for the gap after it and
+// to drop the events sent again after reconnecting
+func (o *tailPositionFile) Disconnected() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.deduplicating = true
+	o.dedupUntil = time.Time{}
+	if o.disconnected.IsZero() && o.position.Slot != 0 {
+		o.disconnected = time.Now().UTC()
+	}
+}
+
+func (o *tailPositionFile) Position() TailPosition {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	position := o.position
+	position.Recent = append([]string{}, position.Recent...)
+	position.Gaps = append([]TailGap{}, position.Gaps...)
+	return position
+}
+
+// Save writes the position when it has changed
+func (o *tailPositionFile) Save() {
+	o.mu.Lock()
+	if !o.changed {
+		o.mu.Unlock()
+		return
+	}
+	o.changed = false
+	raw, err := json.Marshal(o.position)
+	o.mu.Unlock()
+	if err != nil {
+		return
+	}
+	// replaced in one step so a crash never leaves a partial file
+	if err := os.WriteFile(o.path+".tmp", raw, 0644); err == nil {
+		err = os.Rename(o.path+".tmp", o.path)
+	}
+	if err != nil {
+		logrus.Warnf("cant save the tail position: %s", err)
+	}
+}
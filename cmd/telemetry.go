@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// Telemetry is off unless turned on with ss-cli telemetry enable. When on,
+// each command reports its name, how long it took and the type of any error,
+// never its flags, paths, keys or data.
+const (
+	defaultTelemetryURL = "https://api.solanastreaming.com/telemetry"
+	// setting either to anything but empty overrides the config, e.g. in CI
+	telemetryDisableEnv = "SS_CLI_TELEMETRY_DISABLED"
+	telemetryURLEnv     = "SS_CLI_TELEMETRY_URL"
+	telemetryTimeout    = 2 * time.Second
+)
+
+// TelemetryConfig is saved in the user config dir
+type TelemetryConfig struct {
+	Enabled bool `json:"enabled"`
+	// a random id so reports from one install can be counted together. It is
+	// not derived from the machine or the API key
+	InstallID string `json:"installId,omitempty"`
+}
+
+// TelemetryEvent is everything reported for a command
+type TelemetryEvent struct {
+	InstallID  string `json:"installId"`
+	Command    string `json:"command"`
+	Version    string `json:"version"`
+	OS         string `json:"os"`
+	Arch       string `json:"arch"`
+	DurationMs int64  `json:"durationMs"`
+	// the error type as in --error-format json, empty on success
+	Error string `json:"error,omitempty"`
+}
+
+func telemetryConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "ss-cli", "telemetry.json"), nil
+}
+
+func loadTelemetryConfig() (TelemetryConfig, error) {
+	config := TelemetryConfig{}
+	path, err := telemetryConfigPath()
+	if err != nil {
+		return config, err
+	}
+	raw, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	return config, json.Unmarshal(raw, &config)
+}
+
+func saveTelemetryConfig(config TelemetryConfig) error {
+	path, err := telemetryConfigPath()
+	if err != nil {
+		return err
+	}
+	raw, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, raw, 0644)
+}
+
+// telemetryEnabled returns the config if telemetry is on
+func telemetryEnabled() (TelemetryConfig, bool) {
+	if os.Getenv(telemetryDisableEnv) != "" {
+		return TelemetryConfig{}, false
+	}
+	config, err := loadTelemetryConfig()
+	if err != nil {
+		logrus.Debugf("telemetry off, cant load its config: %s", err)
+		return config, false
+	}
+	return config, config.Enabled && config.InstallID != ""
+}
+
+// reportTelemetry reports a command run when telemetry is on. It waits at
+// most telemetryTimeout and failures are ignored.
+func reportTelemetry(ctx context.Context, command string, took time.Duration, cmdErr error) {
+	config, ok := telemetryEnabled()
+	if !ok {
+		return
+	}
+	event := TelemetryEvent{
+		InstallID:  config.InstallID,
+		Command:    command,
+		Version:    version,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		DurationMs: took.Milliseconds(),
+	}
+	if cmdErr != nil {
+		event.Error = classifyError(cmdErr).Type
+	}
+	url := defaultTelemetryURL
+	if v := os.Getenv(telemetryURLEnv); v != "" {
+		url = v
+	}
+	if err := postTelemetry(ctx, url, event); err != nil {
+		logrus.Debugf("could not report telemetry: %s", err)
+	}
+}
+
+func postTelemetry(ctx context.Context, url string, event TelemetryEvent) error {
+	// reported even when the command was cancelled
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), telemetryTimeout)
+	defer cancel()
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return statusError(resp.StatusCode)
+	}
+	return nil
+}
+
+// TelemetryTask shows or changes the telemetry setting
+type TelemetryTask struct {
+	action string
+}
+
+const (
+	TelemetryStatus  = "status"
+	TelemetryEnable  = "enable"
+	TelemetryDisable = "disable"
+)
+
+func NewTelemetryTask(action string) *TelemetryTask {
+	return &TelemetryTask{action: action}
+}
+
+func (o *TelemetryTask) SetupParameters(cmd *cobra.Command) {}
+
+func (o *TelemetryTask) GetMeta() Meta {
+	descriptions := map[string]string{
+		TelemetryStatus:  "Show whether anonymous usage telemetry is on and exactly what it reports.",
+		TelemetryEnable:  "Opt in to reporting anonymous usage telemetry: the command, its duration and error type. Never flags, paths, keys or data.",
+		TelemetryDisable: "Stop reporting usage telemetry.",
+	}
+	return Meta{
+		Name:        "TelemetryTask",
+		Use:         o.action,
+		Description: descriptions[o.action],
+	}
+}
+
+func (o *TelemetryTask) Execute(ctx context.Context) error {
+	config, err := loadTelemetryConfig()
+	if err != nil {
+		return errors.Wrap(err, "cant load the telemetry config")
+	}
+	switch o.action {
+	case TelemetryEnable:
+		config.Enabled = true
+		if config.InstallID == "" {
+			id := make([]byte, 16)
+			if _, err := rand.Read(id); err != nil {
+				return err
+			}
+			config.InstallID = hex.EncodeToString(id)
+		}
+	case TelemetryDisable:
+		// a new id is made if it is enabled again
+		config = TelemetryConfig{}
+	}
+	if o.action != TelemetryStatus {
+		if err := saveTelemetryConfig(config); err != nil {
+			return errors.Wrap(err, "cant save the telemetry config")
+		}
+	}
+	o.printStatus(config)
+	return nil
+}
+
+func (o *TelemetryTask) printStatus(config TelemetryConfig) {
+	path, _ := telemetryConfigPath()
+	_, enabled := telemetryEnabled()
+	switch {
+	case enabled:
+		fmt.Printf("telemetry is on, reporting as %s\n", config.InstallID)
+		fmt.Println("each command reports its name, duration, error type, the ss-cli version, OS and architecture. Never flags, paths, keys or data")
+		fmt.Printf("turn it off with 'ss-cli telemetry disable' or set %s=1\n", telemetryDisableEnv)
+	case config.Enabled:
+		fmt.Printf("telemetry is off as %s is set\n", telemetryDisableEnv)
+	default:
+		fmt.Println("telemetry is off. Nothing is reported")
+		fmt.Println("opt in with 'ss-cli telemetry enable' to help prioritize work on the commands you use")
+	}
+	fmt.Printf("config: %s\n", path)
+}
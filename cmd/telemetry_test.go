@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/test-go/testify/assert"
+)
+
+type usageErrorTask struct{}
+
+func (o *usageErrorTask) SetupParameters(cmd *cobra.Command) {}
+
+func (o *usageErrorTask) GetMeta() Meta {
+	return Meta{Name: "UsageErrorTask", Use: "usage-error"}
+}
+
+func (o *usageErrorTask) Execute(ctx context.Context) error {
+	return withKind(ErrUsage, errors.New("bad flag /home/user/secret"))
+}
+
+func TestTelemetryOptIn(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	t.Setenv("HOME", t.TempDir())
+	lock := sync.Mutex{}
+	events := []TelemetryEvent{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		event := TelemetryEvent{}
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&event))
+		lock.Lock()
+		events = append(events, event)
+		lock.Unlock()
+	}))
+	defer server.Close()
+	t.Setenv(telemetryURLEnv, server.URL)
+	tm := NewTaskManager()
+
+	// off by default
+	assert.NotNil(t, tm.ExecuteTask(context.Background(), &usageErrorTask{}))
+	assert.Empty(t, events)
+
+	assert.Nil(t, tm.ExecuteTask(context.Background(), NewTelemetryTask(TelemetryEnable)))
+	config, ok := telemetryEnabled()
+	assert.True(t, ok)
+	assert.Len(t, config.InstallID, 32)
+	assert.NotNil(t, tm.ExecuteTask(context.Background(), &usageErrorTask{}))
+	assert.Len(t, events, 1)
+	assert.Equal(t, config.InstallID, events[0].InstallID)
+	assert.Equal(t, "UsageErrorTask", events[0].Command)
+	assert.Equal(t, "usage", events[0].Error)
+
+	// the env var overrides the config
+	t.Setenv(telemetryDisableEnv, "1")
+	assert.NotNil(t, tm.ExecuteTask(context.Background(), &usageErrorTask{}))
+	assert.Len(t, events, 1)
+	t.Setenv(telemetryDisableEnv, "")
+
+	assert.Nil(t, tm.ExecuteTask(context.Background(), NewTelemetryTask(TelemetryDisable)))
+	_, ok = telemetryEnabled()
+	assert.False(t, ok)
+	assert.NotNil(t, tm.ExecuteTask(context.Background(), &usageErrorTask{}))
+	assert.Len(t, events, 1)
+}
@@ -0,0 +1,116 @@
+;; A filter plugin for the wasm plugin tests. It keeps events mentioning
+;; raydium unchanged, replaces events mentioning pumpfun with {"tagged":true},
+;; traps on events mentioning trap and drops the rest.
+;; raydium.wasm is this module assembled, e.g. with wat2wasm raydium.wat
+(module
+  (memory (export "memory") 1)
+  (data (i32.const 16) "raydium")
+  (data (i32.const 32) "pumpfun")
+  (data (i32.const 48) "trap")
+  (data (i32.const 64) "{\"tagged\":true}")
+
+  ;; events are written at 1024, growing the memory to fit
+  (func (export "alloc") (param $len i32) (result i32)
+    (local $need i32)
+    local.get $len
+    i32.const 66559
+    i32.add
+    i32.const 16
+    i32.shr_u
+    memory.size
+    i32.sub
+    local.tee $need
+    i32.const 0
+    i32.gt_s
+    if
+      local.get $need
+      memory.grow
+      drop
+    end
+    i32.const 1024)
+
+  ;; returns whether the n bytes at needle are in the event
+  (func $contains (param $ptr i32) (param $len i32) (param $needle i32) (param $n i32) (result i32)
+    (local $i i32) (local $j i32)
+    block $notfound
+      loop $outer
+        local.get $i
+        local.get $n
+        i32.add
+        local.get $len
+        i32.gt_u
+        br_if $notfound
+        i32.const 0
+        local.set $j
+        block $mismatch
+          loop $inner
+            local.get $j
+            local.get $n
+            i32.eq
+            if
+              i32.const 1
+              return
+            end
+            local.get $ptr
+            local.get $i
+            i32.add
+            local.get $j
+            i32.add
+            i32.load8_u
+            local.get $needle
+            local.get $j
+            i32.add
+            i32.load8_u
+            i32.ne
+            br_if $mismatch
+            local.get $j
+            i32.const 1
+            i32.add
+            local.set $j
+            br $inner
+          end
+        end
+        local.get $i
+        i32.const 1
+        i32.add
+        local.set $i
+        br $outer
+      end
+    end
+    i32.const 0)
+
+  (func (export "filter") (param $ptr i32) (param $len i32) (result i64)
+    local.get $ptr
+    local.get $len
+    i32.const 48
+    i32.const 4
+    call $contains
+    if
+      unreachable
+    end
+    local.get $ptr
+    local.get $len
+    i32.const 16
+    i32.const 7
+    call $contains
+    if
+      local.get $ptr
+      i64.extend_i32_u
+      i64.const 32
+      i64.shl
+      local.get $len
+      i64.extend_i32_u
+      i64.or
+      return
+    end
+    local.get $ptr
+    local.get $len
+    i32.const 32
+    i32.const 7
+    call $contains
+    if
+      ;; 64<<32 | 15
+      i64.const 274877906959
+      return
+    end
+    i64.const 0))
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/itchyny/gojq"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// transformOptions are the flags of commands which can transform each event
+// before it is output
+type transformOptions struct {
+	expression string
+	transform  *eventTransform
+}
+
+func (o *transformOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.expression, "transform", "", "A jq expression applied to each event before it is output e.g. 'select(.swap != null) | .price = (.swap.quoteAmount | tonumber) / (.swap.baseAmount | tonumber)'. Events it outputs nothing for are dropped. See docs")
+}
+
+func (o *transformOptions) validate() error {
+	if o.expression == "" {
+		return nil
+	}
+	transform, err := parseTransform(o.expression)
+	if err != nil {
+		return errors.Wrap(err, "invalid transform")
+	}
+	o.transform = transform
+	return nil
+}
+
+// Apply returns the event as it should be output and whether to keep it.
+// Without --transform the event is returned unchanged.
+func (o *transformOptions) Apply(event []byte) ([]byte, bool, error) {
+	if o.transform == nil {
+		return event, true, nil
+	}
+	return o.transform.Apply(event)
+}
+
+// eventTransform is a compiled jq expression. It outputs at most one value
+// per event.
+type eventTransform struct {
+	code *gojq.Code
+}
+
+func parseTransform(expression string) (*eventTransform, error) {
+	query, err := gojq.Parse(expression)
+	if err != nil {
+		return nil, err
+	}
+	code, err := gojq.Compile(query)
+	if err != nil {
+		return nil, err
+	}
+	return &eventTransform{code: code}, nil
+}
+
+func (o *eventTransform) Apply(event []byte) ([]byte, bool, error) {
+	d := json.NewDecoder(bytes.NewReader(event))
+	// keeps integers such as slots exact
+	d.UseNumber()
+	var input any
+	if err := d.Decode(&input); err != nil {
+		return nil, false, errors.Wrap(err, "cant unmarshal event")
+	}
+	outputs := o.code.Run(input)
+	output, ok := outputs.Next()
+	if !ok {
+		return nil, false, nil
+	}
+	if err, ok := output.(error); ok {
+		return nil, false, errors.Wrap(err, "transform failed")
+	}
+	if _, ok := outputs.Next(); ok {
+		return nil, false, errors.New("transform failed: it output more than one value for an event")
+	}
+	raw, err := json.Marshal(output)
+	if err != nil {
+		return nil, false, errors.Wrap(err, "transform failed")
+	}
+	return raw, true, nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestTransform(t *testing.T) {
+	event := `{"slot":12345678901234567,"swap":{"walletAccount":"wallet-a","swapType":"buy","baseAmount":"4","quoteAmount":"2"},"tags":["a","b"]}`
+	for expression, expected := range map[string]string{
+		".":                                   `{"slot":12345678901234567,"swap":{"baseAmount":"4","quoteAmount":"2","swapType":"buy","walletAccount":"wallet-a"},"tags":["a","b"]}`,
+		".swap.walletAccount":                 `"wallet-a"`,
+		`.["swap"]."swapType"`:                `"buy"`,
+		".tags[1]":                            `"b"`,
+		".tags[-1]":                           `"b"`,
+		".missing.field":                      `null`,
+		"{slot, wallet: .swap.walletAccount}": `{"slot":12345678901234567,"wallet":"wallet-a"}`,
+		"[.slot, .swap.swapType]":             `[12345678901234567,"buy"]`,
+		".swap.price = (.swap.quoteAmount | tonumber) / (.swap.baseAmount | tonumber) | .swap.price": `0.5`,
+		".wallet = .swap.walletAccount | del(.swap) | del(.tags)":                                    `{"slot":12345678901234567,"wallet":"wallet-a"}`,
+		".tags |= length | .tags":   `2`,
+		".swap.swapType == \"buy\"": `true`,
+		".slot > 10 and .slot < 20": `false`,
+		"(.fee // 5) * 2":           `10`,
+		"if .swap.swapType == \"sell\" then \"s\" elif .swap != null then \"b\" else \"p\" end": `"b"`,
+		`.swap | has("swapType")`: `true`,
+		".swap | keys":            `["baseAmount","quoteAmount","swapType","walletAccount"]`,
+		".slot | tostring":        `"12345678901234567"`,
+		"-1 + 3 % 2":              `0`,
+		".x.y = 1 | .x":           `{"y":1}`,
+		".tags | map(ascii_upcase) | join(\",\")": `"A,B"`,
+	} {
+		transform, err := parseTransform(expression)
+		if !assert.Nil(t, err, expression) {
+			continue
+		}
+		out, keep, err := transform.Apply([]byte(event))
+		assert.Nil(t, err, expression)
+		assert.True(t, keep, expression)
+		assert.Equal(t, expected, string(out), expression)
+	}
+
+	for _, expression := range []string{"select(.pair != null)", "empty", "select(.swap.swapType == \"sell\") | .slot"} {
+		transform, err := parseTransform(expression)
+		assert.Nil(t, err, expression)
+		_, keep, err := transform.Apply([]byte(event))
+		assert.Nil(t, err, expression)
+		assert.False(t, keep, expression)
+	}
+
+	for _, expression := range []string{".a |", "{a: }", "foo", "(.a", `"open`, "if .a then 1", "input"} {
+		_, err := parseTransform(expression)
+		assert.NotNil(t, err, expression)
+	}
+
+	for _, expression := range []string{".swap.walletAccount | tonumber", "1 = 2", "del(1)", ".tags[]"} {
+		transform, err := parseTransform(expression)
+		assert.Nil(t, err, expression)
+		_, _, err = transform.Apply([]byte(event))
+		assert.NotNil(t, err, expression)
+	}
+}
+
+func TestReduceTransform(t *testing.T) {
+	wallet := fixtureKey("wallet", "")
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"swap":{"walletAccount":"` + wallet + `","swapType":"buy"}}` + "\n" + `{"slot":2,"swap":{"walletAccount":"` + wallet + `","swapType":"sell"}}` + "\n",
+	})
+
+	task := NewReduceTask()
+	task.params.dataInDir = dataDir
+	task.params.dataOutDir = t.TempDir()
+	task.params.concurrency = 1
+	task.params.fileWorkers = 1
+	task.params.wallets = wallet
+	task.transform.expression = `select(.swap.swapType == "buy") | {slot, side: .swap.swapType}`
+	assert.Nil(t, task.Execute(context.Background()))
+
+	rows := []string{}
+	assert.Nil(t, readArchiveRows(task.params.dataOutDir+"/20240505-120000.zip", func(row []byte) error {
+		rows = append(rows, string(row))
+		return nil
+	}))
+	assert.Equal(t, []string{`{"side":"buy","slot":1}`}, rows)
+
+	task.transform.expression = ".a |"
+	err := task.Execute(context.Background())
+	assert.NotNil(t, err)
+	assert.True(t, strings.Contains(err.Error(), "invalid transform"))
+}
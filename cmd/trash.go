@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+// trashTimeLayout prefixes the name of each file moved to the trash dir with
+// when it was moved, to purge it after the grace period
+const trashTimeLayout = "20060102T150405.000000000"
+
+// trashOptions moves files aside to --trash-dir instead of deleting them, so
+// pointing a command at the wrong dir can be undone
+type trashOptions struct {
+	dir   string
+	grace time.Duration
+}
+
+func (o *trashOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.dir, "trash-dir", "", "Move files to this dir instead of deleting or overwriting them. It must be on the same filesystem. Emptied of files older than --trash-grace at the start of each run")
+	cmd.Flags().DurationVar(&o.grace, "trash-grace", 7*24*time.Hour, "How long files are kept in --trash-dir")
+}
+
+func (o *trashOptions) Validate() error {
+	if o.grace < 0 {
+		return errors.New("trash-grace can not be negative")
+	}
+	return nil
+}
+
+// Purge creates the trash dir and deletes the files in it older than the
+// grace period
+func (o *trashOptions) Purge() error {
+	if o.dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(o.dir, 0755); err != nil {
+		return errors.Wrap(err, "cant create trash dir")
+	}
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return errors.Wrap(err, "cant read trash dir")
+	}
+	for _, v := range entries {
+		prefix, _, _ := strings.Cut(v.Name(), "-")
+		trashed, err := time.Parse(trashTimeLayout, prefix)
+		if err != nil || time.Since(trashed) < o.grace {
+			// not ours, or still in the grace period
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(o.dir, v.Name())); err != nil {
+			return errors.Wrap(err, "cant purge trash dir")
+		}
+		logrus.Debugf("purged %s from trash dir", v.Name())
+	}
+	return nil
+}
+
+// Remove deletes the file or dir at path, or moves it to the trash dir when
+// one is set. A path which does not exist is ignored.
+func (o *trashOptions) Remove(path string) error {
+	if o.dir == "" {
+		return os.RemoveAll(path)
+	}
+	return o.moveAside(path)
+}
+
+// Preserve moves the file at path to the trash dir before it is overwritten,
+// when one is set
+func (o *trashOptions) Preserve(path string) error {
+	if o.dir == "" {
+		return nil
+	}
+	return o.moveAside(path)
+}
+
+func (o *trashOptions) moveAside(path string) error {
+	if _, err := os.Lstat(path); os.IsNotExist(err) {
+		return nil
+	}
+	prefix := time.Now().UTC().Format(trashTimeLayout)
+	target := filepath.Join(o.dir, fmt.Sprintf("%s-%s", prefix, filepath.Base(path)))
+	for n := 1; ; n++ {
+		// rename replaces a file at the target, never lose an earlier one
+		if _, err := os.Lstat(target); os.IsNotExist(err) {
+			break
+		}
+		target = filepath.Join(o.dir, fmt.Sprintf("%s-%d-%s", prefix, n, filepath.Base(path)))
+	}
+	if err := os.Rename(path, target); err != nil {
+		return errors.Wrapf(err, "cant move %s to the trash dir, it must be on the same filesystem", path)
+	}
+	logrus.Debugf("moved %s to %s", path, target)
+	return nil
+}
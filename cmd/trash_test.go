@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestReduceTrashDir(t *testing.T) {
+	wallet := fixtureKey("wallet-a", "")
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"swap":{"walletAccount":"` + wallet + `"}}` + "\n",
+	})
+	outDir := t.TempDir()
+	trashDir := t.TempDir() + "/trash"
+	assert.Nil(t, os.WriteFile(outDir+"/20240505-120000.zip", []byte("earlier run"), 0666))
+
+	task := NewReduceTask()
+	task.params.dataInDir = dataDir
+	task.params.dataOutDir = outDir
+	task.params.concurrency = 1
+	task.params.wallets = wallet
+	task.trash.dir = trashDir
+	task.trash.grace = time.Hour
+	assert.Nil(t, task.Execute(context.Background()))
+
+	// the file it overwrote was moved to the trash
+	entries, err := os.ReadDir(trashDir)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.True(t, strings.HasSuffix(entries[0].Name(), "-20240505-120000.zip"))
+	raw, err := os.ReadFile(trashDir + "/" + entries[0].Name())
+	assert.Nil(t, err)
+	assert.Equal(t, "earlier run", string(raw))
+	rows := 0
+	assert.Nil(t, readArchiveRows(outDir+"/20240505-120000.zip", func(row []byte) error {
+		rows++
+		return nil
+	}))
+	assert.Equal(t, 1, rows)
+}
+
+func TestTrashPurge(t *testing.T) {
+	dir := t.TempDir()
+	trash := trashOptions{dir: dir, grace: time.Hour}
+	old := time.Now().Add(-2*time.Hour).UTC().Format(trashTimeLayout) + "-a.zip"
+	recent := time.Now().UTC().Format(trashTimeLayout) + "-b.zip"
+	for _, v := range []string{old, recent, "notes.txt"} {
+		assert.Nil(t, os.WriteFile(dir+"/"+v, nil, 0666))
+	}
+	assert.Nil(t, trash.Purge())
+	entries, err := os.ReadDir(dir)
+	assert.Nil(t, err)
+	names := []string{}
+	for _, v := range entries {
+		names = append(names, v.Name())
+	}
+	assert.Equal(t, []string{recent, "notes.txt"}, names)
+
+	// without a trash dir files are deleted
+	path := t.TempDir() + "/c.zip"
+	assert.Nil(t, os.WriteFile(path, nil, 0666))
+	assert.Nil(t, (&trashOptions{}).Remove(path))
+	_, err = os.Stat(path)
+	assert.True(t, os.IsNotExist(err))
+	assert.Nil(t, (&trashOptions{}).Remove(path))
+}
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type VolumeTask struct {
+	layout   layoutOptions
+	interval time.Duration
+	amounts  amountOptions
+	usd      usdPriceOptions
+	buckets  map[volumeKey]*volumeBucket
+	// buckets starting before this have been written and can no longer change
+	flushedUpTo time.Time
+	params      struct {
+		dataDir  string
+		interval string
+		groupBy  string
+		format   string
+		output   string
+	}
+}
+
+const (
+	GroupByNone     = ""
+	GroupByAmm      = "amm"
+	GroupByMint     = "mint"
+	GroupByExchange = "exchange"
+)
+
+type volumeKey struct {
+	start time.Time
+	group string
+	// quote volume is only summed within a quote mint
+	quoteMint string
+}
+
+type volumeBucket struct {
+	swaps uint64
+	buys  uint64
+	sells uint64
+	// in quote tokens, unless the decimals of the quote mint are not known
+	quoteTokens     *big.Rat
+	unknownDecimals bool
+	// with --usd-prices
+	quoteUSD *big.Rat
+}
+
+func NewVolumeTask() *VolumeTask {
+	return &VolumeTask{
+		buckets: map[volumeKey]*volumeBucket{},
+	}
+}
+
+func (o *VolumeTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir to get the archive data from")
+	cmd.Flags().StringVar(&o.params.interval, "interval", "5m", "The size of each time bucket e.g. 1m, 5m, 1h")
+	cmd.Flags().StringVarP(&o.params.groupBy, "group-by", "g", GroupByNone, "Split each bucket by: amm, mint or exchange. Leave empty for totals only")
+	cmd.Flags().StringVarP(&o.params.format, "format", "f", ReportFormatCSV, "Output format: csv, json or arrow")
+	cmd.Flags().StringVarP(&o.params.output, "output", "o", "", "File to write the time series to, or the dir with --layout hive. Defaults to stdout")
+	o.layout.SetupParameters(cmd)
+	o.amounts.SetupParameters(cmd)
+	o.usd.SetupParameters(cmd)
+}
+
+func (o *VolumeTask) GetMeta() Meta {
+	return Meta{
+		Name:        "VolumeTask",
+		Use:         "volume",
+		Description: "Aggregate swap counts and quote volume from local archive files into a time series, optionally grouped by amm, mint or exchange.",
+	}
+}
+
+func (o *VolumeTask) Execute(ctx context.Context) error {
+	if err := o.validateParams(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+
+	// quote amounts are summed in tokens of each quote mint as quote mints
+	// differ in decimals
+	if err := o.amounts.LoadDecimals(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	if err := o.usd.Load(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+
+	header := []string{"interval_start", "group", "quote_mint", "swaps", "buys", "sells", "quote_volume"}
+	if o.usd.Enabled() {
+		header = append(header, "quote_volume_usd")
+	}
+	w, out, err := o.layout.Open(o.params.output, o.params.format, header, "interval_start")
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var missingTime, late, unconverted, unpriced uint64
+	for i, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logrus.Infof("aggregating file (%d of %d) %s", i+1, len(files), v)
+		var latest time.Time
+		// cheap check to skip non swap rows without parsing them
+		err := readArchiveEvents(o.params.dataDir+"/"+v, []byte(`"swap"`), func(event EventRow) error {
+			if event.Swap == nil {
+				return nil
+			}
+			if event.BlockTime == 0 {
+				missingTime++
+				return nil
+			}
+			eventTime := event.Time()
+			if eventTime.After(latest) {
+				latest = eventTime
+			}
+			start := eventTime.Truncate(o.interval)
+			if start.Before(o.flushedUpTo) {
+				late++
+				return nil
+			}
+			converted, priced := o.add(volumeKey{start: start, group: o.groupOf(event.Swap), quoteMint: event.Swap.QuoteTokenMint}, event)
+			if !converted {
+				unconverted++
+			}
+			if !priced {
+				unpriced++
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		// archives are hourly and in order so anything a full interval before
+		// the latest event in this file is complete
+		if !latest.IsZero() {
+			if err := o.flush(w, latest.Add(-o.interval).Truncate(o.interval)); err != nil {
+				return err
+			}
+		}
+	}
+	if err := o.flush(w, time.Time{}); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if missingTime > 0 {
+		logrus.Warnf("skipped %d swaps without a blockTime", missingTime)
+	}
+	if unconverted > 0 {
+		logrus.Warnf("left quote_volume empty for %d swaps as the decimals of their quote mint are not known", unconverted)
+	}
+	if unpriced > 0 {
+		logrus.Warnf("left %d swaps out of quote_volume_usd as they are not quoted in SOL, USDC or USDT, or are before the first usd price", unpriced)
+	}
+	o.amounts.Report()
+	if late > 0 {
+		logrus.Warnf("skipped %d swaps that arrived after their interval was written. Check your archive files are consecutive", late)
+	}
+	return nil
+}
+
+func (o *VolumeTask) groupOf(swap *SwapEvent) string {
+	switch o.params.groupBy {
+	case GroupByAmm:
+		return swap.AmmAccount
+	case GroupByMint:
+		return swap.BaseTokenMint
+	case GroupByExchange:
+		return swap.SourceExchange
+	}
+	return "all"
+}
+
+// add counts a swap in its bucket. Returns whether its quote amount could be
+// converted to tokens and priced for --usd-prices.
+func (o *VolumeTask) add(key volumeKey, event EventRow) (bool, bool) {
+	swap := event.Swap
+	bucket, ok := o.buckets[key]
+	if !ok {
+		bucket = &volumeBucket{quoteTokens: new(big.Rat), quoteUSD: new(big.Rat)}
+		o.buckets[key] = bucket
+	}
+	bucket.swaps++
+	switch swap.SwapType {
+	case SwapTypeBuy:
+		bucket.buys++
+	case SwapTypeSell:
+		bucket.sells++
+	}
+	priced := true
+	if o.usd.Enabled() {
+		var usd *big.Rat
+		usd, priced = o.usd.USD(swap, event.Slot, event.BlockTime)
+		if priced {
+			bucket.quoteUSD.Add(bucket.quoteUSD, usd)
+		}
+	}
+	quote, ok := o.amounts.Rat(swap.QuoteAmount, swap.QuoteTokenMint)
+	if ok {
+		bucket.quoteTokens.Add(bucket.quoteTokens, quote)
+	}
+	bucket.unknownDecimals = !ok
+	return ok, priced
+}
+
+// flush writes and forgets all buckets starting before the given time, or all
+// buckets if before is zero
+func (o *VolumeTask) flush(w *recordWriter, before time.Time) error {
+	keys := []volumeKey{}
+	for k := range o.buckets {
+		if before.IsZero() || k.start.Before(before) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if !keys[i].start.Equal(keys[j].start) {
+			return keys[i].start.Before(keys[j].start)
+		}
+		if keys[i].group != keys[j].group {
+			return keys[i].group < keys[j].group
+		}
+		return keys[i].quoteMint < keys[j].quoteMint
+	})
+	for _, k := range keys {
+		bucket := o.buckets[k]
+		// a number, or exact with --human-amounts
+		var quoteVolume any = formatRat(bucket.quoteTokens)
+		switch {
+		case bucket.unknownDecimals:
+			quoteVolume = nil
+		case !o.amounts.human:
+			quoteVolume, _ = bucket.quoteTokens.Float64()
+		}
+		values := []any{k.start.Format(time.RFC3339), k.group, k.quoteMint, bucket.swaps, bucket.buys, bucket.sells, quoteVolume}
+		if o.usd.Enabled() {
+			values = append(values, formatUSD(bucket.quoteUSD))
+		}
+		err := w.Write(values...)
+		if err != nil {
+			return err
+		}
+		delete(o.buckets, k)
+	}
+	if before.After(o.flushedUpTo) {
+		o.flushedUpTo = before
+	}
+	return nil
+}
+
+func (o *VolumeTask) validateParams() error {
+	interval, err := time.ParseDuration(o.params.interval)
+	if err != nil {
+		return errors.Wrap(err, "invalid interval")
+	}
+	if interval < time.Second {
+		return errors.New("interval must be at least 1s")
+	}
+	o.interval = interval
+	switch o.params.groupBy {
+	case GroupByNone, GroupByAmm, GroupByMint, GroupByExchange:
+	default:
+		return fmt.Errorf("unknown group-by %q, must be one of: %s, %s, %s", o.params.groupBy, GroupByAmm, GroupByMint, GroupByExchange)
+	}
+	return o.layout.Validate(o.params.output)
+}
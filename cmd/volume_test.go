@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/test-go/testify/assert"
+)
+
+func TestVolume(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"blockTime":1714910400,"swap":{"baseTokenMint":"a","quoteTokenMint":"So11111111111111111111111111111111111111112","swapType":"buy","quoteAmount":"1500000000"}}
+{"slot":2,"blockTime":1714910460,"swap":{"baseTokenMint":"a","quoteTokenMint":"EPjFWdd5AufqSSqeM2qN1xzybapC8G4wEGGkZwyTDt1v","swapType":"sell","quoteAmount":"2000000"}}
+{"slot":3,"blockTime":1714910520,"swap":{"baseTokenMint":"b","quoteTokenMint":"unknown","swapType":"buy","quoteAmount":"7"}}
+{"slot":4,"swap":{"baseTokenMint":"b","quoteTokenMint":"So11111111111111111111111111111111111111112","swapType":"buy","quoteAmount":"1"}}
+{"slot":5,"blockTime":1714910700,"swap":{"baseTokenMint":"b","quoteTokenMint":"So11111111111111111111111111111111111111112","swapType":"sell","quoteAmount":"250000000"}}
+`,
+		"pairs.json": `{"slot":6,"blockTime":1714910400,"pair":{"baseToken":{"account":"a"}}}
+`,
+	})
+	decimals := filepath.Join(t.TempDir(), "decimals.json")
+	assert.Nil(t, os.WriteFile(decimals, []byte(`{"unknown": 0}`), 0644))
+
+	for _, test := range []struct {
+		groupBy  string
+		human    bool
+		decimals string
+		expected string
+	}{
+		// amounts are in tokens of each quote mint, and left empty for mints
+		// without known decimals
+		{expected: `interval_start,group,quote_mint,swaps,buys,sells,quote_volume
+2024-05-05T12:00:00Z,all,%[2]s,1,0,1,2
+2024-05-05T12:00:00Z,all,%[1]s,1,1,0,1.5
+2024-05-05T12:00:00Z,all,unknown,1,1,0,
+2024-05-05T12:05:00Z,all,%[1]s,1,0,1,0.25
+`},
+		{groupBy: GroupByMint, human: true, decimals: decimals, expected: `interval_start,group,quote_mint,swaps,buys,sells,quote_volume
+2024-05-05T12:00:00Z,a,%[2]s,1,0,1,2
+2024-05-05T12:00:00Z,a,%[1]s,1,1,0,1.5
+2024-05-05T12:00:00Z,b,unknown,1,1,0,7
+2024-05-05T12:05:00Z,b,%[1]s,1,0,1,0.25
+`},
+	} {
+		task := NewVolumeTask()
+		task.params.dataDir = dataDir
+		task.params.interval = "5m"
+		task.params.groupBy = test.groupBy
+		task.params.format = ReportFormatCSV
+		task.params.output = filepath.Join(t.TempDir(), "volume.csv")
+		task.amounts.human = test.human
+		task.amounts.decimalsFile = test.decimals
+		assert.Nil(t, task.Execute(context.Background()))
+		raw, err := os.ReadFile(task.params.output)
+		assert.Nil(t, err)
+		assert.Equal(t, fmt.Sprintf(test.expected, wrappedSOLMint, usdcMint), string(raw), test.groupBy)
+	}
+
+	for _, setup := range []func(task *VolumeTask){
+		func(task *VolumeTask) { task.params.interval = "soon" },
+		func(task *VolumeTask) { task.params.interval = "10ms" },
+		func(task *VolumeTask) { task.params.groupBy = "wallet" },
+	} {
+		task := NewVolumeTask()
+		task.params.dataDir = dataDir
+		task.params.interval = "5m"
+		task.params.format = ReportFormatCSV
+		setup(task)
+		err := task.Execute(context.Background())
+		assert.True(t, errors.Is(err, ErrUsage))
+	}
+}
+
+// TestVolumeFixtures aggregates the fixture archives, checks the totals
+// against the archives and compares the output to testdata/volume
+func TestVolumeFixtures(t *testing.T) {
+	dataDir := copyFixtures(t)
+	swaps := map[string]uint64{}
+	files, err := listArchiveFiles(dataDir)
+	assert.Nil(t, err)
+	for _, v := range files {
+		assert.Nil(t, readArchiveEvents(filepath.Join(dataDir, v), nil, func(event EventRow) error {
+			if event.Swap != nil {
+				swaps[event.Swap.SwapType]++
+			}
+			return nil
+		}))
+	}
+
+	for _, groupBy := range []string{GroupByNone, GroupByExchange, GroupByMint} {
+		task := NewVolumeTask()
+		task.params.dataDir = dataDir
+		task.params.interval = "15m"
+		task.params.groupBy = groupBy
+		task.params.format = ReportFormatJSON
+		task.params.output = filepath.Join(t.TempDir(), "volume.json")
+		task.amounts.human = true
+		assert.Nil(t, task.Execute(context.Background()))
+		raw, err := os.ReadFile(task.params.output)
+		assert.Nil(t, err)
+
+		var total, buys, sells uint64
+		for _, line := range strings.Split(strings.TrimSpace(string(raw)), "\n") {
+			row := struct {
+				Swaps uint64 `json:"swaps"`
+				Buys  uint64 `json:"buys"`
+				Sells uint64 `json:"sells"`
+			}{}
+			assert.Nil(t, json.Unmarshal([]byte(line), &row))
+			assert.Equal(t, row.Swaps, row.Buys+row.Sells)
+			total += row.Swaps
+			buys += row.Buys
+			sells += row.Sells
+		}
+		assert.Equal(t, swaps[SwapTypeBuy]+swaps[SwapTypeSell], total, groupBy)
+		assert.Equal(t, swaps[SwapTypeBuy], buys, groupBy)
+		assert.Equal(t, swaps[SwapTypeSell], sells, groupBy)
+
+		name := groupBy
+		if name == GroupByNone {
+			name = "all"
+		}
+		assertGolden(t, filepath.Join("testdata/volume", name+".golden"), string(raw))
+	}
+}
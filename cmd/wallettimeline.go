@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+type WalletTimelineTask struct {
+	amounts    amountOptions
+	provenance provenanceOptions
+	params     struct {
+		dataDir string
+		wallets string
+		format  string
+		output  string
+	}
+}
+
+func NewWalletTimelineTask() *WalletTimelineTask {
+	return &WalletTimelineTask{}
+}
+
+func (o *WalletTimelineTask) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVarP(&o.params.dataDir, "data-dir", "d", "out", "The dir to get the archive data from")
+	cmd.Flags().StringVarP(&o.params.wallets, "wallet", "w", "", "The wallets to list the swaps of. (Comma separated list)")
+	cmd.Flags().StringVarP(&o.params.format, "format", "f", ReportFormatCSV, "Output format: csv, json or arrow")
+	cmd.Flags().StringVarP(&o.params.output, "output", "o", "", "File to write the timeline to. Defaults to stdout")
+	o.amounts.SetupParameters(cmd)
+	o.provenance.SetupParameters(cmd)
+}
+
+func (o *WalletTimelineTask) GetMeta() Meta {
+	return Meta{
+		Name:        "WalletTimelineTask",
+		Use:         "wallet-timeline",
+		Description: "List every swap of one or more wallets across local archive files in chronological order.",
+	}
+}
+
+func (o *WalletTimelineTask) Execute(ctx context.Context) error {
+	wallets := splitList(o.params.wallets)
+	if len(wallets) == 0 {
+		return withKind(ErrUsage, errors.New("wallet must be specified"))
+	}
+	if err := o.amounts.Load(); err != nil {
+		return withKind(ErrUsage, err)
+	}
+	// rows are only parsed when they contain one of the wallets
+	needles := make([][]byte, len(wallets))
+	for i, v := range wallets {
+		needles[i] = []byte(v)
+	}
+
+	files, err := listArchiveFiles(o.params.dataDir)
+	if err != nil {
+		return err
+	}
+	out, err := openOutput(o.params.output)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	w, err := newRecordWriter(out, o.params.format, o.provenance.Columns([]string{"wallet", "time", "slot", "mint", "side", "base_amount", "quote_amount", "amm", "exchange", "signature"}))
+	if err != nil {
+		return err
+	}
+
+	swaps := 0
+	for i, v := range files {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		logrus.Infof("scanning file (%d of %d) %s", i+1, len(files), v)
+		err := o.provenance.ReadRows(o.params.dataDir+"/"+v, func(row []byte, provenance []any) error {
+			if !containsAny(row, needles) {
+				return nil
+			}
+			event := EventRow{}
+			if err := unmarshalEvent(row, &event); err != nil {
+				return errors.Wrap(err, "cant unmarshal event")
+			}
+			if event.Swap == nil || !inSlice(wallets, event.Swap.WalletAccount) {
+				return nil
+			}
+			eventTime := ""
+			if event.BlockTime != 0 {
+				eventTime = event.Time().Format(time.RFC3339)
+			}
+			swaps++
+			return w.Write(append([]any{
+				event.Swap.WalletAccount,
+				eventTime,
+				event.Slot,
+				event.Swap.BaseTokenMint,
+				event.Swap.SwapType,
+				o.amounts.Format(event.Swap.BaseAmount, event.Swap.BaseTokenMint),
+				o.amounts.Format(event.Swap.QuoteAmount, event.Swap.QuoteTokenMint),
+				event.Swap.AmmAccount,
+				event.Swap.SourceExchange,
+				event.Sig,
+			}, provenance...)...)
+		})
+		if err != nil {
+			return err
+		}
+	}
+	logrus.Infof("found %d swaps by %d wallets", swaps, len(wallets))
+	o.amounts.Report()
+	return w.Flush()
+}
+
+func containsAny(row []byte, needles [][]byte) bool {
+	for _, v := range needles {
+		if bytes.Contains(row, v) {
+			return true
+		}
+	}
+	return false
+}
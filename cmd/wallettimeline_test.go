@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestWalletTimeline(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"blockTime":1714910400,"signature":"s1","swap":{"walletAccount":"a","baseTokenMint":"m1","swapType":"buy","baseAmount":"10","quoteAmount":2}}
+{"slot":2,"signature":"s2","swap":{"walletAccount":"c","baseTokenMint":"a"}}
+{"slot":3,"signature":"s3","pair":{"ammAccount":"a"}}
+`,
+	})
+	writeTestArchive(t, dataDir+"/20240505-130000.zip", map[string]string{
+		"swaps.json": `{"slot":4,"signature":"s4","swap":{"walletAccount":"b","baseTokenMint":"m2","swapType":"sell","sourceExchange":"raydium"}}
+{"slot":5,"signature":"s5","swap":{"walletAccount":"a","baseTokenMint":"m2","swapType":"sell"}}
+`,
+	})
+	task := NewWalletTimelineTask()
+	task.params.dataDir = dataDir
+	task.params.wallets = "a,b"
+	task.params.format = ReportFormatCSV
+	task.params.output = t.TempDir() + "/timeline.csv"
+	assert.Nil(t, task.Execute(context.Background()))
+
+	raw, err := os.ReadFile(task.params.output)
+	assert.Nil(t, err)
+	assert.Equal(t, `wallet,time,slot,mint,side,base_amount,quote_amount,amm,exchange,signature
+a,2024-05-05T12:00:00Z,1,m1,buy,10,2,,,s1
+b,,4,m2,sell,,,,raydium,s4
+a,,5,m2,sell,,,,,s5
+`, string(raw))
+
+	task.params.wallets = ""
+	assert.NotNil(t, task.Execute(context.Background()))
+}
+
+func TestWalletTimelineProvenance(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"pairs.json": `{"slot":2,"signature":"s2","pair":{"ammAccount":"a"}}
+`,
+		"swaps.json": `{"slot":1,"signature":"s1","swap":{"walletAccount":"a","swapType":"buy"}}
+
+{"slot":3,"signature":"s3","swap":{"walletAccount":"a","swapType":"sell"}}
+`,
+	})
+	hash, err := fileSHA256(dataDir + "/20240505-120000.zip")
+	assert.Nil(t, err)
+	task := NewWalletTimelineTask()
+	task.params.dataDir = dataDir
+	task.params.wallets = "a"
+	task.params.format = ReportFormatCSV
+	task.params.output = t.TempDir() + "/timeline.csv"
+	task.provenance.enabled = true
+	assert.Nil(t, task.Execute(context.Background()))
+
+	raw, err := os.ReadFile(task.params.output)
+	assert.Nil(t, err)
+	// lines count the empty line, so they match an editor
+	assert.Equal(t, `wallet,time,slot,mint,side,base_amount,quote_amount,amm,exchange,signature,source_archive,source_file,source_line,archive_sha256
+a,,1,,buy,,,,,s1,20240505-120000.zip,swaps.json,1,`+hash+`
+a,,3,,sell,,,,,s3,20240505-120000.zip,swaps.json,3,`+hash+`
+`, string(raw))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// wasmPluginOptions are the flags of commands which can filter events with a
+// WASM plugin
+type wasmPluginOptions struct {
+	path   string
+	plugin *wasmPlugin
+}
+
+func (o *wasmPluginOptions) SetupParameters(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&o.path, "plugin", "", "A WASM module which keeps, drops or modifies each event e.g. my_filter.wasm. It exports alloc(len) and filter(ptr, len). See docs")
+}
+
+func (o *wasmPluginOptions) validate() error {
+	if o.path == "" {
+		return nil
+	}
+	plugin, err := loadWasmPlugin(context.Background(), o.path)
+	if err != nil {
+		return errors.Wrapf(err, "invalid plugin %s", o.path)
+	}
+	o.plugin = plugin
+	return nil
+}
+
+// Apply returns the event as it should be output and whether to keep it.
+// Without --plugin the event is returned unchanged.
+func (o *wasmPluginOptions) Apply(event []byte) ([]byte, bool, error) {
+	if o.plugin == nil {
+		return event, true, nil
+	}
+	return o.plugin.Apply(event)
+}
+
+func (o *wasmPluginOptions) Close() error {
+	if o.plugin == nil {
+		return nil
+	}
+	return o.plugin.Close()
+}
+
+// wasmPlugin runs the filter function of a WASM module. The module exports
+// its memory and:
+//
+//	alloc(len i32) i32          returns where to write an event of len bytes
+//	filter(ptr i32, len i32) i64 returns 0 to drop the event, or the ptr<<32|len
+//	                             of the event to output, which can be the input
+//
+// A module instance runs one event at a time, so one is kept per goroutine
+// calling Apply at once.
+type wasmPlugin struct {
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	mu       sync.Mutex
+	idle     []*wasmPluginInstance
+}
+
+type wasmPluginInstance struct {
+	module api.Module
+	alloc  api.Function
+	filter api.Function
+}
+
+func loadWasmPlugin(ctx context.Context, path string) (*wasmPlugin, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	runtime := wazero.NewRuntime(ctx)
+	// modules built for WASI, e.g. by TinyGo, Rust or Go, import it
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	compiled, err := runtime.CompileModule(ctx, raw)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	for _, name := range []string{"alloc", "filter"} {
+		if _, ok := compiled.ExportedFunctions()[name]; !ok {
+			runtime.Close(ctx)
+			return nil, errors.Errorf("it does not export a %s function", name)
+		}
+	}
+	plugin := &wasmPlugin{runtime: runtime, compiled: compiled}
+	// fails early on modules which can not be instantiated
+	instance, err := plugin.newInstance(ctx)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+	plugin.idle = append(plugin.idle, instance)
+	return plugin, nil
+}
+
+func (o *wasmPlugin) newInstance(ctx context.Context) (*wasmPluginInstance, error) {
+	config := wazero.NewModuleConfig().
+		// anonymous so the module can be instantiated more than once
+		WithName("").
+		// reactor modules initialise with _initialize instead of running main
+		WithStartFunctions("_initialize").
+		// stdout may be the output of the command
+		WithStdout(os.Stderr).
+		WithStderr(os.Stderr)
+	module, err := o.runtime.InstantiateModule(ctx, o.compiled, config)
+	if err != nil {
+		return nil, err
+	}
+	if module.Memory() == nil {
+		module.Close(ctx)
+		return nil, errors.New("it does not export its memory")
+	}
+	return &wasmPluginInstance{module: module, alloc: module.ExportedFunction("alloc"), filter: module.ExportedFunction("filter")}, nil
+}
+
+func (o *wasmPlugin) Apply(event []byte) ([]byte, bool, error) {
+	ctx := context.Background()
+	o.mu.Lock()
+	var instance *wasmPluginInstance
+	if n := len(o.idle); n > 0 {
+		instance = o.idle[n-1]
+		o.idle = o.idle[:n-1]
+	}
+	o.mu.Unlock()
+	if instance == nil {
+		var err error
+		if instance, err = o.newInstance(ctx); err != nil {
+			return nil, false, errors.Wrap(err, "cant start plugin")
+		}
+	}
+
+	output, keep, err := instance.Apply(ctx, event)
+	if err != nil {
+		// the module state is unknown after a trap
+		instance.module.Close(ctx)
+		return nil, false, errors.Wrap(err, "plugin failed")
+	}
+	o.mu.Lock()
+	o.idle = append(o.idle, instance)
+	o.mu.Unlock()
+	return output, keep, nil
+}
+
+func (o *wasmPlugin) Close() error {
+	return o.runtime.Close(context.Background())
+}
+
+func (o *wasmPluginInstance) Apply(ctx context.Context, event []byte) ([]byte, bool, error) {
+	results, err := o.alloc.Call(ctx, uint64(len(event)))
+	if err != nil {
+		return nil, false, err
+	}
+	ptr := uint32(results[0])
+	memory := o.module.Memory()
+	if !memory.Write(ptr, event) {
+		return nil, false, errors.Errorf("alloc returned %d which is outside its memory", ptr)
+	}
+	results, err = o.filter.Call(ctx, uint64(ptr), uint64(len(event)))
+	if err != nil {
+		return nil, false, err
+	}
+	if results[0] == 0 {
+		return nil, false, nil
+	}
+	output, ok := memory.Read(uint32(results[0]>>32), uint32(results[0]))
+	if !ok {
+		return nil, false, errors.New("filter returned an event outside its memory")
+	}
+	// the memory is reused for the next event
+	return bytes.Clone(output), true, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/test-go/testify/assert"
+)
+
+// testdata/plugins/raydium.wasm keeps raydium events, replaces pumpfun events
+// with {"tagged":true}, traps on events mentioning trap and drops the rest
+const testWasmPlugin = "testdata/plugins/raydium.wasm"
+
+func TestWasmPlugin(t *testing.T) {
+	plugin := wasmPluginOptions{path: testWasmPlugin}
+	assert.Nil(t, plugin.validate())
+	defer plugin.Close()
+
+	event := []byte(`{"slot":1,"swap":{"sourceExchange":"raydium"}}`)
+	output, keep, err := plugin.Apply(event)
+	assert.Nil(t, err)
+	assert.True(t, keep)
+	assert.Equal(t, string(event), string(output))
+
+	output, keep, err = plugin.Apply([]byte(`{"slot":2,"swap":{"sourceExchange":"pumpfun"}}`))
+	assert.Nil(t, err)
+	assert.True(t, keep)
+	assert.Equal(t, `{"tagged":true}`, string(output))
+
+	_, keep, err = plugin.Apply([]byte(`{"slot":3,"swap":{"sourceExchange":"orca"}}`))
+	assert.Nil(t, err)
+	assert.False(t, keep)
+
+	_, _, err = plugin.Apply([]byte(`{"slot":4,"swap":{"sourceExchange":"trap"}}`))
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "plugin failed")
+
+	// events larger than the first memory page, from many goroutines at once
+	large := append([]byte(`{"swap":{"sourceExchange":"raydium","walletAccount":"`), make([]byte, 200000)...)
+	for i := 54; i < len(large); i++ {
+		large[i] = 'w'
+	}
+	large = append(large, `"}}`...)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				output, keep, err := plugin.Apply(large)
+				assert.Nil(t, err)
+				assert.True(t, keep)
+				assert.Equal(t, len(large), len(output))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// not a module, or one without the filter exports
+	invalid := filepath.Join(t.TempDir(), "invalid.wasm")
+	assert.Nil(t, os.WriteFile(invalid, []byte("not wasm"), 0644))
+	for _, path := range []string{invalid, filepath.Join(t.TempDir(), "missing.wasm")} {
+		plugin := wasmPluginOptions{path: path}
+		assert.NotNil(t, plugin.validate(), path)
+	}
+}
+
+func TestReduceWasmPlugin(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": `{"slot":1,"swap":{"sourceExchange":"raydium","baseTokenMint":"a"}}
+{"slot":2,"swap":{"sourceExchange":"pumpfun","baseTokenMint":"b"}}
+{"slot":3,"swap":{"sourceExchange":"orca","baseTokenMint":"a"}}
+{"slot":4,"swap":{"sourceExchange":"raydium","baseTokenMint":"c"}}
+`,
+	})
+
+	// the plugin on its own sees every event, and with filters only the
+	// events they include
+	for suffix, expected := range map[string][]string{
+		"":  {`{"slot":1,"swap":{"sourceExchange":"raydium","baseTokenMint":"a"}}`, `{"tagged":true}`, `{"slot":4,"swap":{"sourceExchange":"raydium","baseTokenMint":"c"}}`},
+		"a": {`{"slot":1,"swap":{"sourceExchange":"raydium","baseTokenMint":"a"}}`},
+	} {
+		task := NewReduceTask()
+		task.params.dataInDir = dataDir
+		task.params.dataOutDir = t.TempDir()
+		task.params.concurrency = 1
+		task.params.mintSuffixes = suffix
+		task.plugin.path = testWasmPlugin
+		assert.Nil(t, task.Execute(context.Background()), suffix)
+		rows := []string{}
+		assert.Nil(t, readArchiveRows(task.params.dataOutDir+"/20240505-120000.zip", func(row []byte) error {
+			rows = append(rows, string(row))
+			return nil
+		}))
+		assert.Equal(t, expected, rows, suffix)
+	}
+}
+
+func TestReplayWasmPlugin(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestArchive(t, dataDir+"/20240505-120000.zip", map[string]string{
+		"swaps.json": "{\"slot\":1,\"swap\":{\"sourceExchange\":\"raydium\"}}\n{\"slot\":2,\"swap\":{\"sourceExchange\":\"orca\"}}\n{\"slot\":3,\"swap\":{\"sourceExchange\":\"pumpfun\"}}\n",
+	})
+	replay := replayOptions{dataDir: dataDir, rate: "0", concurrency: 2, plugin: wasmPluginOptions{path: testWasmPlugin}}
+	assert.Nil(t, replay.validate())
+	defer replay.plugin.Close()
+
+	sink := &memorySink{}
+	_, err := replay.Replay(context.Background(), sink, "memory")
+	assert.Nil(t, err)
+	data := []string{}
+	for _, v := range sink.messages {
+		data = append(data, string(v.Data))
+	}
+	assert.True(t, len(data) == 2 && (data[0] == `{"tagged":true}` || data[1] == `{"tagged":true}`), data)
+}
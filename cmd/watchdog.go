@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrTimeout = errors.New("timed out")
+	ErrStalled = errors.New("stalled")
+)
+
+const (
+	StallFail  = "fail"
+	StallRetry = "retry"
+
+	// how many times --on-stall retry runs a stalled task again
+	maxStallRetries = 3
+)
+
+// watchdog fails the running task after --timeout, or when it stops making
+// progress for --stall-timeout, instead of letting it hang silently
+var watchdog = &taskWatchdog{onStall: StallFail}
+
+type taskWatchdog struct {
+	timeout      time.Duration // 0 means no limit
+	stallTimeout time.Duration // 0 means no limit
+	onStall      string
+	// bytes downloaded or written and rows read so far
+	progress atomic.Uint64
+	// times the last command was run, more than once when it was retried
+	attempts int
+	// how often progress is checked
+	interval time.Duration
+	// how long a task gets to return once its context is cancelled
+	grace time.Duration
+}
+
+// Progress records that the running task did n units of work
+func (o *taskWatchdog) Progress(n int) {
+	o.progress.Add(uint64(n))
+}
+
+// Run runs execute within the timeout, retrying it on a stall when asked to
+func (o *taskWatchdog) Run(ctx context.Context, name string, execute func(context.Context) error) error {
+	o.attempts = 1
+	if o.timeout == 0 && o.stallTimeout == 0 {
+		return execute(ctx)
+	}
+	if o.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeoutCause(ctx, o.timeout, withKind(ErrTimeout, fmt.Errorf("%s did not finish within --timeout %s", name, o.timeout)))
+		defer cancel()
+	}
+	for attempt := 1; ; attempt++ {
+		o.attempts = attempt
+		returned, err := o.runOnce(ctx, name, execute)
+		// a task which did not return may still be running so it is not safe to
+		// start another
+		if !errors.Is(err, ErrStalled) || o.onStall != StallRetry || attempt > maxStallRetries || !returned {
+			return err
+		}
+		logrus.Warnf("%s stalled, retrying (%d of %d)", name, attempt, maxStallRetries)
+	}
+}
+
+// runOnce runs execute until it returns, stalls or the context ends. Returns
+// false if execute did not return.
+func (o *taskWatchdog) runOnce(ctx context.Context, name string, execute func(context.Context) error) (bool, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	done := make(chan error, 1)
+	go func() {
+		done <- execute(ctx)
+	}()
+
+	var ticks <-chan time.Time
+	if o.stallTimeout > 0 {
+		ticker := time.NewTicker(o.checkInterval())
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	last := o.progress.Load()
+	lastChange := time.Now()
+	for {
+		select {
+		case err := <-done:
+			return true, err
+		case <-ticks:
+			if progress := o.progress.Load(); progress != last {
+				last, lastChange = progress, time.Now()
+				continue
+			}
+			if time.Since(lastChange) < o.stallTimeout {
+				continue
+			}
+			logrus.Errorf("%s made no progress for %s, goroutines:", name, o.stallTimeout)
+			pprof.Lookup("goroutine").WriteTo(logrus.StandardLogger().Out, 2)
+			cancel(withKind(ErrStalled, fmt.Errorf("%s made no progress for --stall-timeout %s", name, o.stallTimeout)))
+			return o.stop(ctx, done)
+		case <-ctx.Done():
+			return o.stop(ctx, done)
+		}
+	}
+}
+
+// stop waits a little for a cancelled task to return. A task stuck somewhere
+// which ignores its context is left behind and the process exits after it.
+func (o *taskWatchdog) stop(ctx context.Context, done <-chan error) (bool, error) {
+	cause := context.Cause(ctx)
+	// only timeouts and stalls replace the task's own error
+	if !errors.Is(cause, ErrTimeout) && !errors.Is(cause, ErrStalled) {
+		return true, <-done
+	}
+	grace := o.grace
+	if grace == 0 {
+		grace = 10 * time.Second
+	}
+	select {
+	case <-done:
+		return true, cause
+	case <-time.After(grace):
+		logrus.Warnf("task did not stop within %s of being cancelled", grace)
+		return false, cause
+	}
+}
+
+func (o *taskWatchdog) checkInterval() time.Duration {
+	if o.interval != 0 {
+		return o.interval
+	}
+	return min(max(o.stallTimeout/10, 10*time.Millisecond), 10*time.Second)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/test-go/testify/assert"
+)
+
+func TestWatchdogTimeout(t *testing.T) {
+	w := &taskWatchdog{timeout: 50 * time.Millisecond, onStall: StallFail}
+	err := w.Run(context.Background(), "TestTask", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.True(t, errors.Is(err, ErrTimeout), "unexpected error %v", err)
+	assert.Equal(t, "task.timeout", classifyError(err).Type)
+
+	assert.Nil(t, w.Run(context.Background(), "TestTask", func(ctx context.Context) error {
+		return nil
+	}))
+}
+
+func TestWatchdogStall(t *testing.T) {
+	w := &taskWatchdog{stallTimeout: 50 * time.Millisecond, interval: 5 * time.Millisecond, grace: 50 * time.Millisecond, onStall: StallFail}
+	// progress keeps a slow task alive
+	err := w.Run(context.Background(), "TestTask", func(ctx context.Context) error {
+		for range 20 {
+			time.Sleep(10 * time.Millisecond)
+			w.Progress(1)
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+
+	// a task stuck somewhere which ignores its context still fails
+	stuck := make(chan struct{})
+	defer close(stuck)
+	err = w.Run(context.Background(), "TestTask", func(ctx context.Context) error {
+		<-stuck
+		return nil
+	})
+	assert.True(t, errors.Is(err, ErrStalled), "unexpected error %v", err)
+	assert.Equal(t, "task.stalled", classifyError(err).Type)
+
+	// retried until it gets going
+	w.onStall = StallRetry
+	attempts := 0
+	err = w.Run(context.Background(), "TestTask", func(ctx context.Context) error {
+		attempts++
+		if attempts < 3 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, 3, attempts)
+
+	// but not forever
+	attempts = 0
+	err = w.Run(context.Background(), "TestTask", func(ctx context.Context) error {
+		attempts++
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.True(t, errors.Is(err, ErrStalled), "unexpected error %v", err)
+	assert.Equal(t, maxStallRetries+1, attempts)
+}